@@ -0,0 +1,126 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+
+	"Unit-Test/internal/handlers"
+)
+
+// version is the release this binary was built as, set at build time with
+// -ldflags "-X main.version=1.2.3"
+var version = "dev"
+
+// Options are the command-line switches that change what the binary does
+// rather than how it is configured
+type Options struct {
+	Version     bool // --version: print buildVersion and exit
+	Migrate     bool // --migrate: apply pending migrations before serving
+	MigrateOnly bool // --migrate-only: apply pending migrations and exit
+	MigrateDown int  // --migrate-down N: revert the last N migrations and exit
+	Seed        int  // --seed N: create N fake users for local development and exit
+	DevTLS      bool // --dev-tls: serve HTTPS with a self-signed certificate for localhost
+}
+
+// Flags overriding configuration, keyed by the environment variable each replaces.
+// Secrets are left to the environment, where they don't show up in ps.
+var configFlags = []struct{ name, env, usage string }{
+	{"port", "PORT", "port to listen on"},
+	{"db-driver", "DB_DRIVER", "database driver: postgres, sqlite or mysql"},
+	{"db-url", "DATABASE_URL", "database connection string"},
+	{"log-level", "LOG_LEVEL", "debug, info, warn or error"},
+	{"shutdown-timeout", "SHUTDOWN_TIMEOUT", "time in-flight requests get to finish on shutdown"},
+	{"tls-cert", "TLS_CERT_FILE", "TLS certificate file, PEM encoded"},
+	{"tls-key", "TLS_KEY_FILE", "TLS private key file, PEM encoded"},
+	{"trusted-proxies", "TRUSTED_PROXIES", "comma-separated proxy IPs or CIDRs"},
+	{"cors-origins", "CORS_ALLOWED_ORIGINS", "comma-separated origins allowed by CORS"},
+	{"rate-limit-rps", "RATE_LIMIT_RPS", "requests per second allowed per client IP, 0 for no limit"},
+	{"rate-limit-burst", "RATE_LIMIT_BURST", "burst allowed per client IP"},
+}
+
+// parseFlags reads the command line in args and loads the configuration with
+// flags taking precedence over lookup, which takes precedence over the defaults.
+// Usage and parse errors go to output. With --version the configuration is not
+// loaded, so it works without a database configured.
+func parseFlags(args []string, lookup func(string) (string, bool), output io.Writer) (handlers.Config, Options, error) {
+	var opts Options
+	fs := flag.NewFlagSet("app", flag.ContinueOnError)
+	fs.SetOutput(output)
+	fs.BoolVar(&opts.Version, "version", false, "print the version and exit")
+	fs.BoolVar(&opts.Migrate, "migrate", false, "apply pending migrations before serving")
+	fs.BoolVar(&opts.MigrateOnly, "migrate-only", false, "apply pending migrations and exit")
+	fs.IntVar(&opts.MigrateDown, "migrate-down", 0, "revert the last `N` migrations and exit")
+	fs.BoolVar(&opts.DevTLS, "dev-tls", false, "serve HTTPS with a self-signed certificate for localhost")
+	fs.IntVar(&opts.Seed, "seed", 0, "create `N` fake users for local development and exit")
+	enablePprof := fs.Bool("pprof", false, "serve /debug/pprof (overrides PPROF_ENABLED)")
+	values := make(map[string]*string, len(configFlags))
+	for _, f := range configFlags {
+		values[f.name] = fs.String(f.name, "", f.usage+" (overrides "+f.env+")")
+	}
+	if err := fs.Parse(args); err != nil {
+		return handlers.Config{}, opts, err
+	}
+	if fs.NArg() > 0 {
+		return handlers.Config{}, opts, fmt.Errorf("unexpected arguments: %v", fs.Args())
+	}
+	if opts.MigrateDown < 0 {
+		return handlers.Config{}, opts, errors.New("--migrate-down needs a positive number of migrations")
+	}
+	if opts.Seed < 0 {
+		return handlers.Config{}, opts, errors.New("--seed needs a positive number of users")
+	}
+	if opts.MigrateDown > 0 && (opts.Migrate || opts.MigrateOnly || opts.Seed > 0) {
+		return handlers.Config{}, opts, errors.New("--migrate-down can't be combined with --migrate, --migrate-only or --seed")
+	}
+	if opts.Version {
+		return handlers.Config{}, opts, nil
+	}
+
+	// Only flags given on the command line override, so an unset flag can't
+	// blank out the environment
+	overrides := map[string]string{}
+	fs.Visit(func(f *flag.Flag) {
+		for _, cf := range configFlags {
+			if cf.name == f.Name {
+				overrides[cf.env] = *values[f.Name]
+			}
+		}
+		if f.Name == "pprof" {
+			overrides["PPROF_ENABLED"] = strconv.FormatBool(*enablePprof)
+		}
+	})
+	cfg, err := handlers.LoadConfig(func(key string) (string, bool) {
+		if value, ok := overrides[key]; ok {
+			return value, true
+		}
+		return lookup(key)
+	})
+	if err == nil && opts.DevTLS && cfg.TLSCertFile != "" {
+		err = errors.New("--dev-tls can't be combined with TLS_CERT_FILE")
+	}
+	return cfg, opts, err
+}
+
+// buildVersion describes the binary: its version, the commit it was built
+// from when known, and the Go release
+func buildVersion() string {
+	description := "version " + version
+	if info, ok := debug.ReadBuildInfo(); ok {
+		settings := map[string]string{}
+		for _, s := range info.Settings {
+			settings[s.Key] = s.Value
+		}
+		if revision := settings["vcs.revision"]; revision != "" {
+			description += ", commit " + revision
+			if settings["vcs.modified"] == "true" {
+				description += " (modified)"
+			}
+		}
+	}
+	return description + ", " + runtime.Version()
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"io"
+	"log/slog"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// envMap looks keys up in env, standing in for os.LookupEnv
+func envMap(env map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		value, ok := env[key]
+		return value, ok
+	}
+}
+
+// requiredEnv holds the variables without a default
+func requiredEnv() map[string]string {
+	return map[string]string{
+		"DATABASE_URL": "postgres://localhost/app",
+		"JWT_SECRET":   "secret",
+	}
+}
+
+func TestFlagsOverrideEnvironment(t *testing.T) {
+	env := requiredEnv()
+	env["PORT"] = "8080"
+	env["LOG_LEVEL"] = "warn"
+	env["RATE_LIMIT_BURST"] = "5"
+
+	cfg, opts, err := parseFlags([]string{"--port", "9090", "--db-url", "postgres://flag/app", "-rate-limit-rps=2", "--pprof"}, envMap(env), io.Discard)
+	assert.NoError(t, err)
+	assert.Equal(t, Options{}, opts)
+
+	// Flags beat the environment...
+	assert.Equal(t, 9090, cfg.Port)
+	assert.Equal(t, "postgres://flag/app", cfg.DatabaseURL)
+	assert.Equal(t, 2.0, cfg.RateLimitRPS)
+	assert.True(t, cfg.PprofEnabled)
+	// ...which beats the defaults
+	assert.Equal(t, slog.LevelWarn, cfg.LogLevel)
+	assert.Equal(t, 5, cfg.RateLimitBurst)
+	assert.Equal(t, "secret", cfg.JWTSecret)
+	assert.Equal(t, 15*time.Second, cfg.ShutdownTimeout)
+}
+
+func TestFlagsSupplyRequiredSettings(t *testing.T) {
+	env := map[string]string{"JWT_SECRET": "secret"}
+
+	cfg, _, err := parseFlags([]string{"--db-url", "postgres://flag/app"}, envMap(env), io.Discard)
+	assert.NoError(t, err)
+	assert.Equal(t, "postgres://flag/app", cfg.DatabaseURL)
+
+	_, _, err = parseFlags(nil, envMap(env), io.Discard)
+	assert.EqualError(t, err, "invalid configuration:\n\tDATABASE_URL must be set")
+}
+
+func TestFlagsInvalidValues(t *testing.T) {
+	_, _, err := parseFlags([]string{"--port", "http"}, envMap(requiredEnv()), io.Discard)
+	assert.EqualError(t, err, "invalid configuration:\n\tPORT must be an integer between 1 and 65535, got \"http\"")
+
+	var usage bytes.Buffer
+	_, _, err = parseFlags([]string{"--no-such-flag"}, envMap(requiredEnv()), &usage)
+	assert.EqualError(t, err, "flag provided but not defined: -no-such-flag")
+	assert.Contains(t, usage.String(), "-db-url")
+
+	_, _, err = parseFlags([]string{"serve"}, envMap(requiredEnv()), io.Discard)
+	assert.EqualError(t, err, "unexpected arguments: [serve]")
+
+	_, _, err = parseFlags([]string{"--help"}, envMap(requiredEnv()), io.Discard)
+	assert.True(t, errors.Is(err, flag.ErrHelp))
+}
+
+func TestVersionFlagSkipsConfiguration(t *testing.T) {
+	// No DATABASE_URL or JWT_SECRET, yet --version still works
+	_, opts, err := parseFlags([]string{"--version"}, envMap(nil), io.Discard)
+	assert.NoError(t, err)
+	assert.True(t, opts.Version)
+
+	assert.Contains(t, buildVersion(), "version dev")
+	assert.Contains(t, buildVersion(), runtime.Version())
+}
+
+func TestMigrateOnlyFlag(t *testing.T) {
+	_, opts, err := parseFlags([]string{"--migrate-only"}, envMap(requiredEnv()), io.Discard)
+	assert.NoError(t, err)
+	assert.Equal(t, Options{MigrateOnly: true}, opts)
+}
+
+func TestMigrateFlags(t *testing.T) {
+	_, opts, err := parseFlags([]string{"--migrate"}, envMap(requiredEnv()), io.Discard)
+	assert.NoError(t, err)
+	assert.Equal(t, Options{Migrate: true}, opts)
+
+	_, opts, err = parseFlags([]string{"--migrate-down", "2"}, envMap(requiredEnv()), io.Discard)
+	assert.NoError(t, err)
+	assert.Equal(t, Options{MigrateDown: 2}, opts)
+
+	_, _, err = parseFlags([]string{"--migrate-down", "-1"}, envMap(requiredEnv()), io.Discard)
+	assert.EqualError(t, err, "--migrate-down needs a positive number of migrations")
+
+	_, _, err = parseFlags([]string{"--migrate-only", "--migrate-down", "1"}, envMap(requiredEnv()), io.Discard)
+	assert.EqualError(t, err, "--migrate-down can't be combined with --migrate, --migrate-only or --seed")
+}
+
+func TestSeedFlag(t *testing.T) {
+	_, opts, err := parseFlags([]string{"--migrate", "--seed", "50"}, envMap(requiredEnv()), io.Discard)
+	assert.NoError(t, err)
+	assert.Equal(t, Options{Migrate: true, Seed: 50}, opts)
+
+	_, _, err = parseFlags([]string{"--seed", "-5"}, envMap(requiredEnv()), io.Discard)
+	assert.EqualError(t, err, "--seed needs a positive number of users")
+
+	_, _, err = parseFlags([]string{"--seed", "5", "--migrate-down", "1"}, envMap(requiredEnv()), io.Discard)
+	assert.EqualError(t, err, "--migrate-down can't be combined with --migrate, --migrate-only or --seed")
+}
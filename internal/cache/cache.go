@@ -0,0 +1,36 @@
+// Package cache stores short-lived values, such as rendered responses, in
+// this process or in Redis shared by every replica
+package cache
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// Cache keeps values under string keys until their TTL runs out. Errors mean
+// the cache could not be reached; callers should carry on without it.
+type Cache interface {
+	// Get returns the value under key, or false when there is none
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, key string) error
+	// DeleteByPrefix removes every key starting with prefix
+	DeleteByPrefix(ctx context.Context, prefix string) error
+}
+
+// Open returns the Redis cache at redisURL, or a Memory cache holding up to
+// maxEntries values when redisURL is empty. An unreachable Redis is logged and
+// gives no cache at all, nil, rather than keeping the service from starting;
+// a per-replica cache would serve reads other replicas' writes made stale.
+func Open(ctx context.Context, redisURL string, maxEntries int) Cache {
+	if redisURL == "" {
+		return NewMemory(maxEntries)
+	}
+	redis, err := NewRedis(ctx, redisURL)
+	if err != nil {
+		slog.Warn("redis unreachable, serving without a cache", "error", err.Error())
+		return nil
+	}
+	return redis
+}
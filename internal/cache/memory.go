@@ -0,0 +1,85 @@
+package cache
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Memory is a Cache in this process, holding up to maxEntries values. When it
+// is full the expired values go first, then the one closest to expiring.
+type Memory struct {
+	maxEntries int
+	now        func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]memoryEntry
+}
+
+type memoryEntry struct {
+	value   []byte
+	expires time.Time
+}
+
+// NewMemory returns an empty Memory cache for up to maxEntries values
+func NewMemory(maxEntries int) *Memory {
+	return &Memory{maxEntries: maxEntries, now: time.Now, entries: map[string]memoryEntry{}}
+}
+
+var _ Cache = (*Memory)(nil)
+
+func (m *Memory) Get(_ context.Context, key string) ([]byte, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry, ok := m.entries[key]
+	if !ok || !m.now().Before(entry.expires) {
+		delete(m.entries, key)
+		return nil, false, nil
+	}
+	return entry.value, true, nil
+}
+
+func (m *Memory) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	if _, ok := m.entries[key]; !ok && len(m.entries) >= m.maxEntries {
+		m.evict(now)
+	}
+	m.entries[key] = memoryEntry{value: value, expires: now.Add(ttl)}
+	return nil
+}
+
+// evict makes room for one entry
+func (m *Memory) evict(now time.Time) {
+	var oldest string
+	for key, entry := range m.entries {
+		if !now.Before(entry.expires) {
+			delete(m.entries, key)
+		} else if oldest == "" || entry.expires.Before(m.entries[oldest].expires) {
+			oldest = key
+		}
+	}
+	if len(m.entries) >= m.maxEntries {
+		delete(m.entries, oldest)
+	}
+}
+
+func (m *Memory) Delete(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.entries, key)
+	return nil
+}
+
+func (m *Memory) DeleteByPrefix(_ context.Context, prefix string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key := range m.entries {
+		if strings.HasPrefix(key, prefix) {
+			delete(m.entries, key)
+		}
+	}
+	return nil
+}
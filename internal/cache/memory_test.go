@@ -0,0 +1,75 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryExpiryAndEviction(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	m := NewMemory(2)
+	m.now = func() time.Time { return now }
+
+	require.NoError(t, m.Set(ctx, "a", []byte("a"), time.Minute))
+	now = now.Add(time.Second)
+	require.NoError(t, m.Set(ctx, "b", []byte("b"), time.Minute))
+	// Replacing a value needs no room
+	require.NoError(t, m.Set(ctx, "b", []byte("b2"), time.Minute))
+	_, ok, _ := m.Get(ctx, "a")
+	assert.True(t, ok)
+
+	now = now.Add(time.Second)
+	require.NoError(t, m.Set(ctx, "c", []byte("c"), time.Minute))
+	_, ok, _ = m.Get(ctx, "a")
+	assert.False(t, ok, "the value closest to expiring made room")
+	value, ok, _ := m.Get(ctx, "b")
+	assert.True(t, ok)
+	assert.Equal(t, "b2", string(value))
+
+	now = now.Add(time.Minute)
+	_, ok, _ = m.Get(ctx, "c")
+	assert.False(t, ok, "expired")
+}
+
+func TestMemory(t *testing.T) {
+	testCache(t, NewMemory(100))
+}
+
+// testCache checks the behaviour every Cache shares on an empty c
+func testCache(t *testing.T, c Cache) {
+	ctx := context.Background()
+
+	_, ok, err := c.Get(ctx, "missing")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	for _, key := range []string{"users:1", "users:2", "users*:3", "posts:1"} {
+		require.NoError(t, c.Set(ctx, key, []byte(key), time.Minute))
+	}
+	value, ok, err := c.Get(ctx, "users:1")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "users:1", string(value))
+
+	require.NoError(t, c.Delete(ctx, "users:1"))
+	_, ok, _ = c.Get(ctx, "users:1")
+	assert.False(t, ok)
+
+	// The prefix is matched literally, even with glob characters in it
+	require.NoError(t, c.DeleteByPrefix(ctx, "users*"))
+	_, ok, _ = c.Get(ctx, "users*:3")
+	assert.False(t, ok)
+	_, ok, _ = c.Get(ctx, "users:2")
+	assert.True(t, ok)
+
+	require.NoError(t, c.DeleteByPrefix(ctx, "users:"))
+	_, ok, _ = c.Get(ctx, "users:2")
+	assert.False(t, ok)
+	_, ok, _ = c.Get(ctx, "posts:1")
+	assert.True(t, ok, "other prefixes stay")
+}
@@ -0,0 +1,98 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// How long Redis may take to answer before the caller carries on without it
+const redisTimeout = 500 * time.Millisecond
+
+// Keys asked for per SCAN, and deleted per UNLINK, in DeleteByPrefix
+const redisScanCount = 500
+
+// Redis is a Cache shared by every replica connected to the same server
+type Redis struct {
+	client *redis.Client
+}
+
+// NewRedis connects to the Redis server at url, such as
+// redis://:password@localhost:6379/0, failing if it doesn't answer a PING
+func NewRedis(ctx context.Context, url string) (*Redis, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid REDIS_URL: %w", err)
+	}
+	opts.DialTimeout, opts.ReadTimeout, opts.WriteTimeout = redisTimeout, redisTimeout, redisTimeout
+	client := redis.NewClient(opts)
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("pinging redis at %s: %w", opts.Addr, err)
+	}
+	return &Redis{client: client}, nil
+}
+
+var _ Cache = (*Redis)(nil)
+
+func (r *Redis) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	value, err := r.client.Get(ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+func (r *Redis) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return r.client.Set(ctx, key, value, ttl).Err()
+}
+
+func (r *Redis) Delete(ctx context.Context, key string) error {
+	return r.client.Del(ctx, key).Err()
+}
+
+// DeleteByPrefix scans for the keys rather than using KEYS, which would block
+// the server while it walks the whole keyspace. The scan finishes before
+// anything is deleted, so no key moves under the cursor.
+func (r *Redis) DeleteByPrefix(ctx context.Context, prefix string) error {
+	var keys []string
+	iter := r.client.Scan(ctx, 0, escapeGlob(prefix)+"*", redisScanCount).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	if err := iter.Err(); err != nil {
+		return err
+	}
+	for batch := range slices.Chunk(keys, redisScanCount) {
+		if err := r.client.Unlink(ctx, batch...).Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes the connections to the server
+func (r *Redis) Close() error {
+	return r.client.Close()
+}
+
+// escapeGlob quotes the characters SCAN's MATCH pattern treats specially
+func escapeGlob(s string) string {
+	var b strings.Builder
+	for _, ch := range s {
+		switch ch {
+		case '*', '?', '[', ']', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(ch)
+	}
+	return b.String()
+}
@@ -0,0 +1,80 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestRedis connects to a miniredis server of t's own
+func newTestRedis(t *testing.T) (*Redis, *miniredis.Miniredis) {
+	server := miniredis.RunT(t)
+	r, err := NewRedis(context.Background(), "redis://"+server.Addr())
+	require.NoError(t, err)
+	t.Cleanup(func() { r.Close() })
+	return r, server
+}
+
+func TestRedis(t *testing.T) {
+	r, _ := newTestRedis(t)
+	testCache(t, r)
+}
+
+func TestRedisTTL(t *testing.T) {
+	r, server := newTestRedis(t)
+	ctx := context.Background()
+
+	require.NoError(t, r.Set(ctx, "key", []byte("value"), time.Minute))
+	assert.Equal(t, time.Minute, server.TTL("key"))
+	server.FastForward(time.Minute)
+	_, ok, err := r.Get(ctx, "key")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestRedisDeleteByPrefixManyKeys(t *testing.T) {
+	r, server := newTestRedis(t)
+	ctx := context.Background()
+	for i := 0; i < 2*redisScanCount+10; i++ {
+		require.NoError(t, r.Set(ctx, fmt.Sprintf("responses:%d", i), []byte("x"), time.Minute))
+	}
+	require.NoError(t, r.Set(ctx, "other", []byte("x"), time.Minute))
+
+	require.NoError(t, r.DeleteByPrefix(ctx, "responses:"))
+	assert.Equal(t, []string{"other"}, server.Keys())
+}
+
+func TestRedisUnreachable(t *testing.T) {
+	r, server := newTestRedis(t)
+	ctx := context.Background()
+	server.Close()
+
+	_, _, err := r.Get(ctx, "key")
+	assert.Error(t, err)
+	assert.Error(t, r.Set(ctx, "key", []byte("value"), time.Minute))
+	assert.Error(t, r.DeleteByPrefix(ctx, "responses:"))
+}
+
+func TestOpen(t *testing.T) {
+	ctx := context.Background()
+	assert.IsType(t, &Memory{}, Open(ctx, "", 10))
+
+	server := miniredis.RunT(t)
+	url := "redis://" + server.Addr()
+	c := Open(ctx, url, 10)
+	if assert.IsType(t, &Redis{}, c) {
+		c.(*Redis).Close()
+	}
+
+	// An unreachable Redis means no cache rather than a failed start
+	server.Close()
+	assert.Nil(t, Open(ctx, url, 10))
+
+	_, err := NewRedis(ctx, "http://not-redis")
+	assert.ErrorContains(t, err, "invalid REDIS_URL")
+}
@@ -0,0 +1,80 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"Unit-Test/internal/models"
+	"Unit-Test/internal/service"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// subjectPrefix starts the subject of every event: user.created is published
+// on users.created
+const subjectPrefix = "users."
+
+// Subject is the subject an event of kind is published on
+func Subject(kind string) string {
+	return subjectPrefix + strings.TrimPrefix(kind, "user.")
+}
+
+// Message is the body of an event on the bus
+type Message struct {
+	Event  string `json:"event"`
+	UserID int    `json:"user_id"`
+	Actor  string `json:"actor"`
+	// User as it is after the change; for deletions, as it was before
+	User      *models.User `json:"user"`
+	Timestamp time.Time    `json:"timestamp"`
+}
+
+// messageID identifies event to JetStream, which drops a message it has seen
+// the id of already, so retries are only stored once
+func messageID(event service.Event) string {
+	return fmt.Sprintf("%s-%d-%d", event.Type, event.UserID, event.At.UnixNano())
+}
+
+// NATSPublisher publishes events to a JetStream stream. Wrap it in an Outbox:
+// it fails when the server doesn't acknowledge an event.
+type NATSPublisher struct {
+	conn *nats.Conn
+	js   jetstream.JetStream
+}
+
+// ConnectNATS connects to the NATS server at url and makes sure stream exists
+// and takes the users.> subjects
+func ConnectNATS(ctx context.Context, url, stream string) (*NATSPublisher, error) {
+	conn, err := nats.Connect(url, nats.Name("user-api"), nats.MaxReconnects(-1))
+	if err != nil {
+		return nil, fmt.Errorf("connecting to NATS: %w", err)
+	}
+	js, err := jetstream.New(conn)
+	if err == nil {
+		_, err = js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{Name: stream, Subjects: []string{subjectPrefix + ">"}})
+	}
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("setting up stream %s: %w", stream, err)
+	}
+	return &NATSPublisher{conn: conn, js: js}, nil
+}
+
+// Publish stores event in the stream, returning once the server acknowledges it
+func (p *NATSPublisher) Publish(ctx context.Context, event service.Event) error {
+	data, err := json.Marshal(Message{Event: event.Type, UserID: event.UserID, Actor: event.Actor, User: event.User, Timestamp: event.At.UTC()})
+	if err != nil {
+		return err
+	}
+	_, err = p.js.Publish(ctx, Subject(event.Type), data, jetstream.WithMsgID(messageID(event)))
+	return err
+}
+
+// Close sends what is buffered and disconnects
+func (p *NATSPublisher) Close() error {
+	return p.conn.Drain()
+}
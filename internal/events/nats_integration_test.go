@@ -0,0 +1,89 @@
+//go:build integration
+
+package events
+
+// Publishing to a real NATS server started in a container:
+// go test -tags integration ./internal/events -run NATS
+// The tests skip when Docker isn't available.
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"Unit-Test/internal/models"
+	"Unit-Test/internal/service"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/testcontainers/testcontainers-go"
+	tcnats "github.com/testcontainers/testcontainers-go/modules/nats"
+)
+
+// skipWithoutDocker skips t unless Docker is up. testcontainers panics when it
+// finds no Docker host at all, rather than reporting it.
+func skipWithoutDocker(t *testing.T) {
+	t.Helper()
+	defer func() {
+		if r := recover(); r != nil {
+			t.Skipf("Docker is not available: %v", r)
+		}
+	}()
+	testcontainers.SkipIfProviderIsNotHealthy(t)
+}
+
+// startNATS starts a NATS server with JetStream for t and returns its URL
+func startNATS(t *testing.T) string {
+	skipWithoutDocker(t)
+	ctx := context.Background()
+	container, err := tcnats.Run(ctx, "nats:2.10-alpine")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = container.Terminate(context.Background()) })
+	url, err := container.ConnectionString(ctx)
+	require.NoError(t, err)
+	return url
+}
+
+func TestNATSPublisher(t *testing.T) {
+	ctx := context.Background()
+	bus, err := ConnectNATS(ctx, startNATS(t), "USERS")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = bus.Close() })
+
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	created := service.Event{Type: service.EventUserCreated, UserID: 1, Actor: "2", At: at,
+		User: &models.User{ID: 1, Name: "Alice", Email: "alice@example.com"}}
+	require.NoError(t, bus.Publish(ctx, created))
+	// A retry of the same event is only stored once
+	require.NoError(t, bus.Publish(ctx, created))
+	require.NoError(t, bus.Publish(ctx, service.Event{Type: service.EventUserDeleted, UserID: 1, At: at.Add(time.Second)}))
+
+	stream, err := bus.js.Stream(ctx, "USERS")
+	require.NoError(t, err)
+	info, err := stream.Info(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), info.State.Msgs)
+
+	first, err := stream.GetMsg(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "users.created", first.Subject)
+	var message Message
+	require.NoError(t, json.Unmarshal(first.Data, &message))
+	assert.Equal(t, "2", message.Actor)
+	assert.True(t, at.Equal(message.Timestamp))
+	if assert.NotNil(t, message.User) {
+		assert.Equal(t, "alice@example.com", message.User.Email)
+	}
+	second, err := stream.GetMsg(ctx, 2)
+	require.NoError(t, err)
+	assert.Equal(t, "users.deleted", second.Subject)
+
+	// Connecting again keeps the stream and what it holds
+	again, err := ConnectNATS(ctx, bus.conn.ConnectedUrl(), "USERS")
+	require.NoError(t, err)
+	defer again.Close()
+	info, err = stream.Info(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), info.State.Msgs)
+}
@@ -0,0 +1,21 @@
+package events
+
+import (
+	"context"
+	"testing"
+
+	"Unit-Test/internal/service"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubject(t *testing.T) {
+	assert.Equal(t, "users.created", Subject(service.EventUserCreated))
+	assert.Equal(t, "users.updated", Subject(service.EventUserUpdated))
+	assert.Equal(t, "users.deleted", Subject(service.EventUserDeleted))
+}
+
+func TestConnectNATSUnreachable(t *testing.T) {
+	_, err := ConnectNATS(context.Background(), "nats://127.0.0.1:1", "USERS")
+	assert.ErrorContains(t, err, "connecting to NATS")
+}
@@ -0,0 +1,90 @@
+// Package events carries the user events the services publish onto a
+// message bus: an Outbox that retries what the bus fails to take, and the
+// NATS JetStream publisher behind it
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"Unit-Test/internal/jobs"
+	"Unit-Test/internal/service"
+)
+
+// ErrClosed is returned for events published after Close
+var ErrClosed = jobs.ErrClosed
+
+// OutboxOptions tune an Outbox; zero values take the defaults
+type OutboxOptions struct {
+	// Size is how many events can wait before new ones are dropped, 256 by default
+	Size int
+	// MaxAttempts is how often an event is tried, 5 by default
+	MaxAttempts int
+	// Backoff is the wait before the first retry, doubled for every retry
+	// after it; 500ms by default
+	Backoff time.Duration
+}
+
+func (o *OutboxOptions) setDefaults() {
+	if o.Size <= 0 {
+		o.Size = 256
+	}
+	if o.MaxAttempts <= 0 {
+		o.MaxAttempts = 5
+	}
+	if o.Backoff <= 0 {
+		o.Backoff = 500 * time.Millisecond
+	}
+}
+
+// Outbox is a service.Publisher handing events to another one in the
+// background, one at a time and in order, retrying the ones it fails. The
+// request that made a change never waits on the bus, or fails with it.
+type Outbox struct {
+	next  service.Publisher
+	queue *jobs.Queue
+}
+
+// NewOutbox starts publishing the events given to it to next
+func NewOutbox(next service.Publisher, opts OutboxOptions) *Outbox {
+	opts.setDefaults()
+	// A single worker keeps the events in order
+	queue := jobs.NewQueue(jobs.Options{Name: "outbox", Workers: 1, QueueSize: opts.Size, MaxAttempts: opts.MaxAttempts, Backoff: opts.Backoff})
+	return &Outbox{next: next, queue: queue}
+}
+
+// Publish queues event, failing only when the outbox is full or closed
+func (o *Outbox) Publish(_ context.Context, event service.Event) error {
+	err := o.queue.Enqueue(&outboxEvent{next: o.next, event: event})
+	if errors.Is(err, jobs.ErrFull) {
+		return fmt.Errorf("events: outbox full, dropped %s of user %d", event.Type, event.UserID)
+	}
+	return err
+}
+
+// Close stops taking events and waits for the queued ones, retries included,
+// until ctx is done. Events still queued then are dropped.
+func (o *Outbox) Close(ctx context.Context) error {
+	if err := o.queue.Close(ctx); err != nil {
+		return fmt.Errorf("events: outbox not emptied: %w", err)
+	}
+	return nil
+}
+
+// outboxEvent is an event on its way to the publisher behind the outbox, a
+// job of the outbox's queue
+type outboxEvent struct {
+	next  service.Publisher
+	event service.Event
+}
+
+func (e *outboxEvent) Kind() string { return "event." + e.event.Type }
+
+func (e *outboxEvent) Run(ctx context.Context) error { return e.next.Publish(ctx, e.event) }
+
+func (e *outboxEvent) LogValue() slog.Value {
+	return slog.GroupValue(slog.String("type", e.event.Type), slog.Int("user_id", e.event.UserID))
+}
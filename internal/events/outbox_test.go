@@ -0,0 +1,104 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"Unit-Test/internal/service"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// flakyPublisher fails the first failures calls, then records like a
+// MemoryPublisher; release, if set, holds every call until it is closed
+type flakyPublisher struct {
+	service.MemoryPublisher
+	failures int
+	calls    chan service.Event
+	release  chan struct{}
+}
+
+func newFlakyPublisher(failures int) *flakyPublisher {
+	return &flakyPublisher{failures: failures, calls: make(chan service.Event, 100)}
+}
+
+func (p *flakyPublisher) Publish(ctx context.Context, event service.Event) error {
+	p.calls <- event
+	if p.release != nil {
+		select {
+		case <-p.release:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if p.failures > 0 {
+		p.failures--
+		return errors.New("bus unavailable")
+	}
+	return p.MemoryPublisher.Publish(ctx, event)
+}
+
+func userEvent(kind string, userID int) service.Event {
+	return service.Event{Type: kind, UserID: userID, At: time.Now()}
+}
+
+func TestOutboxRetriesFailures(t *testing.T) {
+	bus := newFlakyPublisher(2)
+	outbox := NewOutbox(bus, OutboxOptions{Backoff: time.Millisecond})
+
+	created, updated := userEvent(service.EventUserCreated, 1), userEvent(service.EventUserUpdated, 1)
+	require.NoError(t, outbox.Publish(context.Background(), created))
+	require.NoError(t, outbox.Publish(context.Background(), updated))
+	require.NoError(t, outbox.Close(context.Background()))
+
+	// Each is published once, in order, however often it was tried
+	assert.Equal(t, []service.Event{created, updated}, bus.Events())
+	assert.Len(t, bus.calls, 4)
+}
+
+func TestOutboxDropsAfterMaxAttempts(t *testing.T) {
+	bus := newFlakyPublisher(3)
+	outbox := NewOutbox(bus, OutboxOptions{MaxAttempts: 3, Backoff: time.Millisecond})
+
+	require.NoError(t, outbox.Publish(context.Background(), userEvent(service.EventUserCreated, 1)))
+	next := userEvent(service.EventUserCreated, 2)
+	require.NoError(t, outbox.Publish(context.Background(), next))
+	require.NoError(t, outbox.Close(context.Background()))
+
+	assert.Equal(t, []service.Event{next}, bus.Events(), "a dropped event doesn't hold up the next")
+}
+
+func TestOutboxNeverBlocksThePublisher(t *testing.T) {
+	bus := newFlakyPublisher(0)
+	bus.release = make(chan struct{})
+	outbox := NewOutbox(bus, OutboxOptions{Size: 2})
+
+	// One event with the bus, two waiting, and no room for a fourth
+	require.NoError(t, outbox.Publish(context.Background(), userEvent(service.EventUserCreated, 1)))
+	<-bus.calls
+	require.NoError(t, outbox.Publish(context.Background(), userEvent(service.EventUserCreated, 2)))
+	require.NoError(t, outbox.Publish(context.Background(), userEvent(service.EventUserCreated, 3)))
+	assert.EqualError(t, outbox.Publish(context.Background(), userEvent(service.EventUserCreated, 4)),
+		"events: outbox full, dropped user.created of user 4")
+
+	close(bus.release)
+	require.NoError(t, outbox.Close(context.Background()))
+	assert.Len(t, bus.Events(), 3)
+	assert.ErrorIs(t, outbox.Publish(context.Background(), userEvent(service.EventUserCreated, 5)), ErrClosed)
+}
+
+func TestOutboxCloseGivesUp(t *testing.T) {
+	bus := newFlakyPublisher(1)
+	outbox := NewOutbox(bus, OutboxOptions{Backoff: time.Hour})
+
+	require.NoError(t, outbox.Publish(context.Background(), userEvent(service.EventUserCreated, 1)))
+	<-bus.calls
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, outbox.Close(ctx), context.DeadlineExceeded)
+	assert.Empty(t, bus.Events())
+}
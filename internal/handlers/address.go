@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"strconv"
+
+	"Unit-Test/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// List a user's addresses
+// @Summary Get user addresses
+// @Description Retrieve all addresses of a user
+// @Tags Addresses
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {array} models.Address
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/v1/users/{id}/addresses [get]
+// @Router /api/v2/users/{id}/addresses [get]
+func (s *Server) getAddresses(c *gin.Context) error {
+	id, err := s.requireUser(c)
+	if err != nil {
+		return err
+	}
+
+	addresses := []models.Address{}
+	if err := s.dbFor(c).Where("user_id = ?", id).Order("id").Find(&addresses).Error; err != nil {
+		return err
+	}
+
+	c.JSON(200, addresses)
+	return nil
+}
+
+// Add an address to a user
+// @Summary Create user address
+// @Description Add a mailing address to a user. Only the user themselves or an admin may do this.
+// @Tags Addresses
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Param address body models.Address true "New address"
+// @Success 201 {object} models.Address
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Security BearerAuth
+// @Router /api/v1/users/{id}/addresses [post]
+// @Router /api/v2/users/{id}/addresses [post]
+func (s *Server) createAddress(c *gin.Context) error {
+	id, err := s.requireUser(c)
+	if err != nil {
+		return err
+	}
+
+	var address models.Address
+	if err := c.ShouldBindJSON(&address); err != nil {
+		return invalidInput(err)
+	}
+	// The owner and id come from the server, never from the body
+	address.ID = 0
+	address.UserID = id
+
+	if err := s.dbFor(c).Create(&address).Error; err != nil {
+		return err
+	}
+
+	c.JSON(201, address)
+	return nil
+}
+
+// Replace one of a user's addresses
+// @Summary Update user address
+// @Description Replace an address of a user. The address must belong to that user. Only the user themselves or an admin may do this.
+// @Tags Addresses
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Param addr_id path int true "Address ID"
+// @Param address body models.Address true "Updated address"
+// @Success 200 {object} models.Address
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Security BearerAuth
+// @Router /api/v1/users/{id}/addresses/{addr_id} [put]
+// @Router /api/v2/users/{id}/addresses/{addr_id} [put]
+func (s *Server) updateAddress(c *gin.Context) error {
+	address, err := s.lookupUserAddress(c)
+	if err != nil {
+		return err
+	}
+
+	var input models.Address
+	if err := c.ShouldBindJSON(&input); err != nil {
+		return invalidInput(err)
+	}
+
+	// Select also writes an emptied postal code
+	if err := s.dbFor(c).Model(&address).Select("street", "city", "country", "postal_code").Updates(&input).Error; err != nil {
+		return err
+	}
+
+	c.JSON(200, address)
+	return nil
+}
+
+// Remove one of a user's addresses
+// @Summary Delete user address
+// @Description Delete an address of a user. The address must belong to that user. Only the user themselves or an admin may do this.
+// @Tags Addresses
+// @Produce json
+// @Param id path int true "User ID"
+// @Param addr_id path int true "Address ID"
+// @Success 200 {object} map[string]string "Confirmation message in v1"
+// @Success 204 "No content in v2"
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Security BearerAuth
+// @Router /api/v1/users/{id}/addresses/{addr_id} [delete]
+// @Router /api/v2/users/{id}/addresses/{addr_id} [delete]
+func (s *Server) deleteAddress(c *gin.Context) error {
+	address, err := s.lookupUserAddress(c)
+	if err != nil {
+		return err
+	}
+
+	if err := s.dbFor(c).Delete(&address).Error; err != nil {
+		return err
+	}
+
+	respondDeleted(c, "Address deleted")
+	return nil
+}
+
+// lookupUserAddress loads the :addr_id address of the :id user. An address of
+// another user is reported as not found.
+func (s *Server) lookupUserAddress(c *gin.Context) (models.Address, error) {
+	var address models.Address
+
+	id, err := parseUserID(c)
+	if err != nil {
+		return address, validationError(err.Error())
+	}
+	addrID, err := strconv.Atoi(c.Param("addr_id"))
+	if err != nil || addrID < 1 {
+		return address, validationError("addr_id must be a positive integer")
+	}
+	if _, err := s.lookupUser(c, id); err != nil {
+		return address, notFoundAs(err, CodeUserNotFound, "User not found")
+	}
+
+	err = s.dbFor(c).Where("user_id = ?", id).First(&address, addrID).Error
+	return address, notFoundAs(err, CodeAddressNotFound, "Address not found")
+}
@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"Unit-Test/internal/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func sendAddress(env *testEnv, method, url, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, url, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+	return w
+}
+
+func fetchAddresses(t *testing.T, env *testEnv, url string) []models.Address {
+	w := sendAddress(env, "GET", url, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var addresses []models.Address
+	_ = json.Unmarshal(w.Body.Bytes(), &addresses)
+	return addresses
+}
+
+func TestCreateAndListAddresses(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	env.db.Create(&models.User{Name: "Alice", Email: "alice@example.com"})
+
+	w := sendAddress(env, "POST", "/api/v1/users/1/addresses", `{"street":"1 Main St","city":"Springfield","country":"US","postal_code":"12345","user_id":99}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var created models.Address
+	_ = json.Unmarshal(w.Body.Bytes(), &created)
+	assert.Equal(t, 1, created.UserID)
+	assert.Equal(t, "Springfield", created.City)
+
+	w = sendAddress(env, "POST", "/api/v1/users/1/addresses", `{"street":"2 High St","city":"London","country":"GB"}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	addresses := fetchAddresses(t, env, "/api/v1/users/1/addresses")
+	assert.Len(t, addresses, 2)
+	assert.Equal(t, "1 Main St", addresses[0].Street)
+	assert.Equal(t, "London", addresses[1].City)
+}
+
+func TestCreateAddressValidation(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	env.db.Create(&models.User{Name: "Alice", Email: "alice@example.com"})
+
+	w := sendAddress(env, "POST", "/api/v1/users/1/addresses", `{"street":"1 Main St"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	var resp models.ErrorResponse
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	assert.Len(t, resp.Errors, 2)
+}
+
+func TestAddressesUnknownUser(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	w := sendAddress(env, "GET", "/api/v1/users/42/addresses", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = sendAddress(env, "POST", "/api/v1/users/42/addresses", `{"street":"1 Main St","city":"Springfield","country":"US"}`)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestUpdateAddress(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	env.db.Create(&models.User{Name: "Alice", Email: "alice@example.com"})
+	env.db.Create(&models.Address{UserID: 1, Street: "1 Main St", City: "Springfield", Country: "US", PostalCode: "12345"})
+
+	w := sendAddress(env, "PUT", "/api/v1/users/1/addresses/1", `{"street":"9 Elm St","city":"Shelbyville","country":"US"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var stored models.Address
+	env.db.First(&stored, 1)
+	assert.Equal(t, "9 Elm St", stored.Street)
+	assert.Equal(t, "Shelbyville", stored.City)
+	assert.Equal(t, "", stored.PostalCode)
+	assert.Equal(t, 1, stored.UserID)
+}
+
+func TestAddressCrossUserAccess(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	env.db.Create(&models.User{Name: "Alice", Email: "alice@example.com"})
+	env.db.Create(&models.User{Name: "Bob", Email: "bob@example.com"})
+	env.db.Create(&models.Address{UserID: 1, Street: "1 Main St", City: "Springfield", Country: "US"})
+
+	// Bob must not see, change or remove Alice's address through his own path
+	w := sendAddress(env, "PUT", "/api/v1/users/2/addresses/1", `{"street":"Stolen","city":"Nowhere","country":"US"}`)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = sendAddress(env, "DELETE", "/api/v1/users/2/addresses/1", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	assert.Empty(t, fetchAddresses(t, env, "/api/v1/users/2/addresses"))
+
+	var stored models.Address
+	assert.NoError(t, env.db.First(&stored, 1).Error)
+	assert.Equal(t, "1 Main St", stored.Street)
+}
+
+func TestDeleteAddress(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	env.db.Create(&models.User{Name: "Alice", Email: "alice@example.com"})
+	env.db.Create(&models.Address{UserID: 1, Street: "1 Main St", City: "Springfield", Country: "US"})
+
+	w := sendAddress(env, "DELETE", "/api/v1/users/1/addresses/1", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, fetchAddresses(t, env, "/api/v1/users/1/addresses"))
+
+	w = sendAddress(env, "DELETE", "/api/v1/users/1/addresses/1", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestDeleteUserCascadesAddresses(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	env.db.Create(&models.User{Name: "Alice", Email: "alice@example.com"})
+	env.db.Create(&models.Address{UserID: 1, Street: "1 Main St", City: "Springfield", Country: "US"})
+	env.db.Create(&models.Address{UserID: 1, Street: "2 High St", City: "London", Country: "GB"})
+
+	// Removed before the user was deleted, so it stays removed after a restore
+	sendAddress(env, "DELETE", "/api/v1/users/1/addresses/2", "")
+
+	w := sendAddress(env, "DELETE", "/api/v1/users/1", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var count int64
+	env.db.Model(&models.Address{}).Where("user_id = ?", 1).Count(&count)
+	assert.Equal(t, int64(0), count)
+
+	w = sendAddress(env, "GET", "/api/v1/users/1/addresses", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = sendAddress(env, "POST", "/api/v1/users/1/restore", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	addresses := fetchAddresses(t, env, "/api/v1/users/1/addresses")
+	if assert.Len(t, addresses, 1) {
+		assert.Equal(t, "1 Main St", addresses[0].Street)
+	}
+}
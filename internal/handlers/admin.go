@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PurgeResponse is returned by the purge endpoint
+type PurgeResponse struct {
+	Purged int64     `json:"purged" example:"42"`
+	Before time.Time `json:"before" example:"2024-01-02T15:04:05Z"`
+}
+
+// Purge deleted users
+// @Summary Purge deleted users
+// @Description Delete for good the users soft-deleted before the given time, with their posts, addresses, API keys and tokens. Without before, purges those deleted longer than PURGE_RETENTION ago, as the scheduled purge does. Admins only.
+// @Tags Admin
+// @Produce json
+// @Param before query string false "RFC 3339 time, e.g. 2024-01-02T15:04:05Z"
+// @Success 200 {object} PurgeResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Security BearerAuth
+// @Router /api/v1/admin/purge [post]
+// @Router /api/v2/admin/purge [post]
+func (s *Server) purgeUsers(c *gin.Context) error {
+	before := s.purger.Cutoff()
+	if raw, ok := c.GetQuery("before"); ok {
+		parsed, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return validationError("before must be an RFC 3339 time such as 2024-01-02T15:04:05Z")
+		}
+		before = parsed
+	}
+
+	purged, err := s.purger.Purge(c.Request.Context(), before)
+	if err != nil {
+		return err
+	}
+	c.JSON(http.StatusOK, PurgeResponse{Purged: purged, Before: before})
+	return nil
+}
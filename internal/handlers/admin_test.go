@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"Unit-Test/internal/models"
+	"Unit-Test/internal/purge"
+	"Unit-Test/internal/testsupport/fixtures"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPurgeUsers(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	db := newTestDB(t)
+	env := newTestEnvWith(t, Deps{DB: db, Purger: purge.New(db, purge.Options{
+		Retention: 7 * 24 * time.Hour,
+		Clock:     func() time.Time { return now },
+	})})
+	active := fixtures.NewUser(t, db)
+	recent := fixtures.NewUser(t, db, fixtures.DeletedAt(now.Add(-24*time.Hour)))
+	fixtures.NewUser(t, db, fixtures.DeletedAt(now.Add(-10*24*time.Hour)))
+	older := fixtures.NewUser(t, db, fixtures.DeletedAt(now.Add(-3*24*time.Hour)))
+
+	remaining := func() []int {
+		var ids []int
+		require.NoError(t, db.Unscoped().Model(&models.User{}).Order("id").Pluck("id", &ids).Error)
+		return ids
+	}
+
+	// Without before, the retention period applies
+	w := send(env, "POST", "/api/v1/admin/purge", "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp PurgeResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, PurgeResponse{Purged: 1, Before: now.Add(-7 * 24 * time.Hour)}, resp)
+	assert.Equal(t, []int{active.ID, recent.ID, older.ID}, remaining())
+
+	w = send(env, "POST", "/api/v1/admin/purge?before="+now.Add(-2*24*time.Hour).Format(time.RFC3339), "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.JSONEq(t, `{"purged":1,"before":"2024-05-30T12:00:00Z"}`, w.Body.String())
+	assert.Equal(t, []int{active.ID, recent.ID}, remaining())
+
+	w = send(env, "POST", "/api/v1/admin/purge?before=yesterday", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "before must be an RFC 3339 time")
+
+	assert.Contains(t, scrapeMetrics(t, env.router), "# TYPE users_purged_total counter")
+}
+
+func TestPurgeUsersIsForAdmins(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+	seedRoles(env)
+	r := newAuthTestRouter(env)
+
+	assert.Equal(t, http.StatusUnauthorized, sendWithAuth(r, "POST", "/api/v1/admin/purge", "", "").Code)
+	assert.Equal(t, http.StatusForbidden, sendWithAuth(r, "POST", "/api/v1/admin/purge", "", bearerFor("2")).Code)
+	assert.Equal(t, http.StatusOK, sendWithAuth(r, "POST", "/api/v2/admin/purge", "", bearerFor("1")).Code)
+}
@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+
+	"Unit-Test/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreatedAPIKey is returned once when a key is created and carries the plaintext key
+type CreatedAPIKey struct {
+	models.APIKey
+	Key string `json:"key"`
+}
+
+// hashSecret returns the hex SHA-256 under which an API key or refresh token is stored.
+// Both are random enough that a fast unsalted hash is sufficient.
+func hashSecret(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// newSecret generates a random 256-bit secret, hex-encoded, for an API key,
+// refresh token or one-time token
+func newSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// verifyAPIKey looks up key, records its use and returns the owning user's id as
+// the subject. The keys of deleted users are not found, like unknown ones.
+func (s *Server) verifyAPIKey(ctx context.Context, key string) (string, error) {
+	var apiKey models.APIKey
+	owners := s.db.Model(&models.User{}).Select("id")
+	if err := s.db.WithContext(ctx).Where("key_hash = ? AND user_id IN (?)", hashSecret(key), owners).First(&apiKey).Error; err != nil {
+		return "", err
+	}
+	if err := s.db.WithContext(ctx).Model(&apiKey).UpdateColumn("last_used_at", s.now()).Error; err != nil {
+		return "", err
+	}
+	return strconv.Itoa(apiKey.UserID), nil
+}
+
+// List a user's API keys
+// @Summary Get user API keys
+// @Description Retrieve the API keys of a user. The keys themselves are never returned. Only the user themselves or an admin may do this.
+// @Tags API Keys
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {array} models.APIKey
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Security BearerAuth
+// @Router /api/v1/users/{id}/api-keys [get]
+// @Router /api/v2/users/{id}/api-keys [get]
+func (s *Server) getAPIKeys(c *gin.Context) error {
+	id, err := s.requireUser(c)
+	if err != nil {
+		return err
+	}
+
+	keys := []models.APIKey{}
+	if err := s.dbFor(c).Where("user_id = ?", id).Order("id").Find(&keys).Error; err != nil {
+		return err
+	}
+
+	c.JSON(200, keys)
+	return nil
+}
+
+// Create an API key for a user
+// @Summary Create user API key
+// @Description Create an API key for a user. The key is only returned in this response; send it in the X-API-Key header. Only the user themselves or an admin may do this.
+// @Tags API Keys
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Param key body models.APIKey true "Key label"
+// @Success 201 {object} CreatedAPIKey
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Security BearerAuth
+// @Router /api/v1/users/{id}/api-keys [post]
+// @Router /api/v2/users/{id}/api-keys [post]
+func (s *Server) createAPIKey(c *gin.Context) error {
+	id, err := s.requireUser(c)
+	if err != nil {
+		return err
+	}
+
+	var input models.APIKey
+	if err := c.ShouldBindJSON(&input); err != nil {
+		return invalidInput(err)
+	}
+
+	key, err := newSecret()
+	if err != nil {
+		return err
+	}
+	apiKey := models.APIKey{UserID: id, Label: input.Label, KeyHash: hashSecret(key)}
+	if err := s.dbFor(c).Create(&apiKey).Error; err != nil {
+		return err
+	}
+
+	c.JSON(201, CreatedAPIKey{APIKey: apiKey, Key: key})
+	return nil
+}
+
+// Revoke one of a user's API keys
+// @Summary Revoke user API key
+// @Description Delete an API key of a user. Requests using it are rejected from then on. Only the user themselves or an admin may do this.
+// @Tags API Keys
+// @Produce json
+// @Param id path int true "User ID"
+// @Param key_id path int true "API key ID"
+// @Success 200 {object} map[string]string "Confirmation message in v1"
+// @Success 204 "No content in v2"
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Security BearerAuth
+// @Router /api/v1/users/{id}/api-keys/{key_id} [delete]
+// @Router /api/v2/users/{id}/api-keys/{key_id} [delete]
+func (s *Server) revokeAPIKey(c *gin.Context) error {
+	id, err := parseUserID(c)
+	if err != nil {
+		return validationError(err.Error())
+	}
+	keyID, err := strconv.Atoi(c.Param("key_id"))
+	if err != nil || keyID < 1 {
+		return validationError("key_id must be a positive integer")
+	}
+	if _, err := s.lookupUser(c, id); err != nil {
+		return notFoundAs(err, CodeUserNotFound, "User not found")
+	}
+
+	// Hard delete, so the key stops working at once
+	result := s.dbFor(c).Where("user_id = ?", id).Delete(&models.APIKey{}, keyID)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return newAPIError(http.StatusNotFound, CodeAPIKeyNotFound, "API key not found")
+	}
+
+	respondDeleted(c, "API key revoked")
+	return nil
+}
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"Unit-Test/internal/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// sendWithAPIKey sends a JSON request to router authenticated only by key
+func sendWithAPIKey(router http.Handler, method, url, body, key string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, url, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-Key", key)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestAPIKeyLifecycle(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	env.db.Create(&models.User{Name: "Alice", Email: "alice@example.com"})
+	router := newAuthTestRouter(env)
+	bearer := "Bearer " + mintToken("1", time.Now().Add(time.Hour), []byte(testJWTSecret))
+
+	// Mint
+	w := sendWithAuth(router, "POST", "/api/v1/users/1/api-keys", `{"label":"ci"}`, bearer)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var created CreatedAPIKey
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.Len(t, created.Key, 64)
+	assert.Equal(t, "ci", created.Label)
+	assert.Nil(t, created.LastUsedAt)
+
+	var stored models.APIKey
+	env.db.First(&stored, created.ID)
+	assert.Equal(t, hashSecret(created.Key), stored.KeyHash)
+
+	// Use
+	w = sendWithAPIKey(router, "POST", "/api/v1/users", `{"name":"Bob","email":"bob@example.com"}`, created.Key)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	w = sendWithAuth(router, "GET", "/api/v1/users/1/api-keys", "", bearer)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), created.Key)
+	var keys []models.APIKey
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &keys))
+	assert.Len(t, keys, 1)
+	assert.NotNil(t, keys[0].LastUsedAt)
+
+	// Revoke
+	w = sendWithAuth(router, "DELETE", "/api/v1/users/1/api-keys/1", "", bearer)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = sendWithAPIKey(router, "POST", "/api/v1/users", `{"name":"Carol","email":"carol@example.com"}`, created.Key)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.JSONEq(t, withRequestID(`{"code":"UNAUTHORIZED","message":"Invalid API key"}`, w), w.Body.String())
+}
+
+func TestAPIKeyOfDeletedUser(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	env.db.Create(&models.User{Name: "Alice", Email: "alice@example.com", Role: models.RoleAdmin})
+	env.db.Create(&models.APIKey{UserID: 1, Label: "ci", KeyHash: hashSecret("alice-key")})
+	router := newAuthTestRouter(env)
+	assert.Equal(t, http.StatusCreated, sendWithAPIKey(router, "POST", "/api/v1/users", `{"name":"Bob","email":"bob@example.com"}`, "alice-key").Code)
+
+	env.db.Delete(&models.User{}, 1)
+	w := sendWithAPIKey(router, "POST", "/api/v1/users", `{"name":"Carol","email":"carol@example.com"}`, "alice-key")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.JSONEq(t, withRequestID(`{"code":"UNAUTHORIZED","message":"Invalid API key"}`, w), w.Body.String())
+}
+
+func TestAPIKeyUnknown(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	w := sendWithAPIKey(newAuthTestRouter(env), "DELETE", "/api/v1/users/1", "", "not-a-key")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestRevokeAPIKeyOfOtherUser(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	env.db.Create(&models.User{Name: "Alice", Email: "alice@example.com"})
+	env.db.Create(&models.User{Name: "Bob", Email: "bob@example.com"})
+	env.db.Create(&models.APIKey{UserID: 1, Label: "ci", KeyHash: hashSecret("alice-key")})
+
+	w := sendWithAuth(env.router, "DELETE", "/api/v1/users/2/api-keys/1", "", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	var resp models.ErrorResponse
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	assert.Equal(t, CodeAPIKeyNotFound, resp.Code)
+
+	var count int64
+	env.db.Model(&models.APIKey{}).Count(&count)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestAPIKeysOfOtherUserForbidden(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	seedRoles(env)
+	env.db.Create(&models.APIKey{UserID: 1, Label: "ci", KeyHash: hashSecret("admin-key")})
+	router := newAuthTestRouter(env)
+
+	tests := []struct{ method, url, body string }{
+		{"GET", "/api/v1/users/1/api-keys", ""},
+		{"POST", "/api/v1/users/1/api-keys", `{"label":"stolen"}`},
+		{"DELETE", "/api/v1/users/1/api-keys/1", ""},
+	}
+	for _, tt := range tests {
+		w := sendWithAuth(router, tt.method, tt.url, tt.body, bearerFor("2"))
+		assert.Equal(t, http.StatusForbidden, w.Code, "%s %s", tt.method, tt.url)
+	}
+
+	var count int64
+	env.db.Model(&models.APIKey{}).Count(&count)
+	assert.Equal(t, int64(1), count, "the admin's key is untouched and no key was minted")
+
+	// Members still manage their own keys, and admins anyone's
+	w := sendWithAuth(router, "POST", "/api/v1/users/2/api-keys", `{"label":"mine"}`, bearerFor("2"))
+	assert.Equal(t, http.StatusCreated, w.Code)
+	w = sendWithAuth(router, "GET", "/api/v1/users/2/api-keys", "", bearerFor("1"))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
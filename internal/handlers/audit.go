@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"strconv"
+
+	"Unit-Test/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// auditActor names who is making the current request: the authenticated
+// subject, or "anonymous"
+func auditActor(c *gin.Context) string {
+	if subject := c.GetString(authSubjectKey); subject != "" {
+		return subject
+	}
+	return "anonymous"
+}
+
+// List the audit log of a user
+// @Summary Get user audit log
+// @Description Every create, update, delete and restore of a user, newest first. Admins only.
+// @Tags Users
+// @Produce json
+// @Param id path int true "User ID"
+// @Param page query int false "Page number (1-based)"
+// @Param limit query int false "Number of entries per page (default 20, at most 100)"
+// @Success 200 {array} models.AuditLog "In v1"
+// @Success 200 {object} ListEnvelope "In v2"
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Security BearerAuth
+// @Router /api/v1/users/{id}/audit [get]
+// @Router /api/v2/users/{id}/audit [get]
+func (s *Server) getAuditLog(c *gin.Context) error {
+	id, err := parseUserID(c)
+	if err != nil {
+		return validationError(err.Error())
+	}
+	c.Header("X-Max-Page-Size", strconv.Itoa(s.cfg.MaxPageSize))
+	pagination, err := s.parsePagination(c)
+	if err != nil {
+		return validationError(err.Error())
+	}
+	if pagination == nil {
+		pagination = &Pagination{Page: 1, Limit: s.cfg.DefaultPageSize}
+	}
+	if pagination.UseCursor {
+		return validationError("cursor is not supported for the audit log")
+	}
+	// Deleted users keep their history
+	var user models.User
+	if err := s.dbFor(c).Unscoped().Select("id").First(&user, id).Error; err != nil {
+		return notFoundAs(err, CodeUserNotFound, "User not found")
+	}
+
+	entries := []models.AuditLog{}
+	err = s.dbFor(c).Where("user_id = ?", id).Order("id DESC").
+		Offset((pagination.Page - 1) * pagination.Limit).Limit(pagination.Limit).
+		Find(&entries).Error
+	if err != nil {
+		return err
+	}
+
+	if wantsEnvelope(c) {
+		var total int64
+		if err := s.dbFor(c).Model(&models.AuditLog{}).Where("user_id = ?", id).Count(&total).Error; err != nil {
+			return err
+		}
+		c.JSON(200, newListEnvelope(entries, total, pagination))
+		return nil
+	}
+	c.JSON(200, entries)
+	return nil
+}
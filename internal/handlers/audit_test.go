@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"Unit-Test/internal/models"
+	"Unit-Test/internal/testsupport/fixtures"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// send makes an authenticated request against env.router
+func send(env *testEnv, method, url, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, url, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+	return w
+}
+
+// snapshotField reads one field of an audit snapshot
+func snapshotField(t *testing.T, s models.Snapshot, field string) interface{} {
+	var m map[string]interface{}
+	assert.NoError(t, json.Unmarshal(s, &m))
+	return m[field]
+}
+
+func TestAuditCreateUpdateDelete(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	assert.Equal(t, http.StatusCreated, send(env, "POST", "/api/v1/users", `{"name":"Alice","email":"alice@example.com"}`).Code)
+	assert.Equal(t, http.StatusOK, send(env, "PUT", "/api/v1/users/1", `{"name":"Alicia","email":"alice@example.com","version":1}`).Code)
+	assert.Equal(t, http.StatusOK, send(env, "DELETE", "/api/v1/users/1", "").Code)
+
+	w := send(env, "GET", "/api/v1/users/1/audit", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var entries []models.AuditLog
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &entries))
+	if !assert.Len(t, entries, 3) {
+		return
+	}
+
+	// Newest first
+	del, upd, cre := entries[0], entries[1], entries[2]
+	assert.Equal(t, models.AuditDelete, del.Action)
+	assert.Equal(t, models.AuditUpdate, upd.Action)
+	assert.Equal(t, models.AuditCreate, cre.Action)
+	for _, e := range entries {
+		assert.Equal(t, "1", e.Actor)
+		assert.Equal(t, 1, e.UserID)
+	}
+
+	assert.Nil(t, cre.Before)
+	assert.Equal(t, "Alice", snapshotField(t, cre.After, "name"))
+
+	assert.Equal(t, "Alice", snapshotField(t, upd.Before, "name"))
+	assert.Equal(t, float64(1), snapshotField(t, upd.Before, "version"))
+	assert.Equal(t, "Alicia", snapshotField(t, upd.After, "name"))
+	assert.Equal(t, float64(2), snapshotField(t, upd.After, "version"))
+
+	assert.Equal(t, "Alicia", snapshotField(t, del.Before, "name"))
+	assert.Nil(t, del.After)
+}
+
+func TestAuditPatchRestoreAndUpsert(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	send(env, "PUT", "/api/v1/users/by-email/bob@example.com", `{"name":"Bob"}`)
+	send(env, "PUT", "/api/v1/users/by-email/bob@example.com", `{"name":"Robert"}`)
+	send(env, "PATCH", "/api/v1/users/1", `{"phone":"+15551234567","version":2}`)
+	send(env, "DELETE", "/api/v1/users/1", "")
+	send(env, "POST", "/api/v1/users/1/restore", "")
+
+	var actions []string
+	env.db.Model(&models.AuditLog{}).Order("id").Pluck("action", &actions)
+	assert.Equal(t, []string{models.AuditCreate, models.AuditUpdate, models.AuditUpdate, models.AuditDelete, models.AuditRestore}, actions)
+
+	var upsert models.AuditLog
+	env.db.Where("action = ?", models.AuditUpdate).Order("id").First(&upsert)
+	assert.Equal(t, "Bob", snapshotField(t, upsert.Before, "name"))
+	assert.Equal(t, "Robert", snapshotField(t, upsert.After, "name"))
+}
+
+func TestAuditBulkAndRejectedChanges(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	send(env, "POST", "/api/v1/users/bulk", `[{"name":"A","email":"a@example.com"},{"name":"B","email":"b@example.com"},{"name":"","email":"x"}]`)
+	// Failed changes leave no trace
+	send(env, "PUT", "/api/v1/users/1", `{"name":"A2","email":"a@example.com","version":9}`)
+	send(env, "POST", "/api/v1/users", `{"name":"Dup","email":"a@example.com"}`)
+
+	var count int64
+	env.db.Model(&models.AuditLog{}).Count(&count)
+	assert.Equal(t, int64(2), count)
+}
+
+func TestAuditLogPagination(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	send(env, "POST", "/api/v1/users", `{"name":"Alice","email":"alice@example.com"}`)
+	send(env, "PATCH", "/api/v1/users/1", `{"name":"B","version":1}`)
+	send(env, "PATCH", "/api/v1/users/1", `{"name":"C","version":2}`)
+
+	w := send(env, "GET", "/api/v1/users/1/audit?page=2&limit=2", "")
+	var entries []models.AuditLog
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &entries))
+	assert.Len(t, entries, 1)
+	assert.Equal(t, models.AuditCreate, entries[0].Action)
+}
+
+func TestAuditLogAdminOnly(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	seedRoles(env)
+
+	w := sendWithAuth(newAuthTestRouter(env), "GET", "/api/v1/users/2/audit", "", bearerFor("2"))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestAuditAnonymousActor(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	sendWithAuth(newAuthTestRouter(env), "POST", "/api/v1/auth/register", `{"name":"Alice","email":"alice@example.com","password":"correct horse"}`, "")
+
+	var entry models.AuditLog
+	env.db.First(&entry)
+	assert.Equal(t, "anonymous", entry.Actor)
+	assert.NotContains(t, string(entry.After), "password")
+}
+
+func TestAuditHistoryFromFixtures(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+	fixtures.Load(t, env.db, "audit_history.yaml")
+
+	// Deleted users keep their history, newest first
+	w := send(env, "GET", "/api/v1/users/1/audit?envelope=true&limit=2", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var page struct {
+		Data  []models.AuditLog `json:"data"`
+		Total int64             `json:"total"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	assert.Equal(t, int64(3), page.Total)
+	if assert.Len(t, page.Data, 2) {
+		assert.Equal(t, models.AuditDelete, page.Data[0].Action)
+		assert.Equal(t, models.AuditUpdate, page.Data[1].Action)
+		assert.Equal(t, "Alice", snapshotField(t, page.Data[1].Before, "name"))
+		assert.True(t, page.Data[0].CreatedAt.After(page.Data[1].CreatedAt))
+	}
+
+	// Restoring adds to the history it was loaded with
+	assert.Equal(t, http.StatusOK, send(env, "POST", "/api/v1/users/1/restore", "").Code)
+	w = send(env, "GET", "/api/v1/users/1/audit", "")
+	var entries []models.AuditLog
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &entries))
+	if assert.Len(t, entries, 4) {
+		assert.Equal(t, models.AuditRestore, entries[0].Action)
+		assert.Equal(t, "Alicia", snapshotField(t, entries[0].After, "name"))
+		assert.Equal(t, models.AuditCreate, entries[3].Action)
+	}
+}
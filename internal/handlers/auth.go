@@ -0,0 +1,286 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"Unit-Test/internal/models"
+	"Unit-Test/internal/storage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// Context key under which the authentication middleware stores the token subject
+const authSubjectKey = "auth_subject"
+
+// requireAuth rejects requests without a valid, unexpired Bearer token of a
+// user that still exists or a known X-API-Key, and stores the caller's subject in the context under authSubjectKey.
+// Callers whose role the route's access rule excludes get a 403.
+func (s *Server) requireAuth(c *gin.Context) {
+	if key := c.GetHeader("X-API-Key"); key != "" {
+		subject, err := s.verifyAPIKey(c.Request.Context(), key)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				respondError(c, http.StatusUnauthorized, CodeUnauthorized, "Invalid API key")
+			} else {
+				respondFailure(c, err, "Failed to verify API key")
+			}
+			c.Abort()
+			return
+		}
+		s.authenticated(c, subject)
+		return
+	}
+
+	raw, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !ok || raw == "" {
+		respondError(c, http.StatusUnauthorized, CodeUnauthorized, "Missing bearer token")
+		c.Abort()
+		return
+	}
+
+	subject, err := s.verifyToken(raw)
+	if err != nil {
+		message := "Invalid token"
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			message = "Token has expired"
+		}
+		respondError(c, http.StatusUnauthorized, CodeUnauthorized, message)
+		c.Abort()
+		return
+	}
+	// Tokens outlive their users: a deleted user's is refused until it expires.
+	// Loading the role spares the access rules a second lookup.
+	if _, err := s.subjectRole(c, subject); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			respondError(c, http.StatusUnauthorized, CodeUnauthorized, "Invalid token")
+		} else {
+			respondFailure(c, err, "Failed to verify token")
+		}
+		c.Abort()
+		return
+	}
+
+	s.authenticated(c, subject)
+}
+
+// authenticated records the caller's subject and continues if the route's
+// access rule lets them in
+func (s *Server) authenticated(c *gin.Context, subject string) {
+	c.Set(authSubjectKey, subject)
+	if !s.authorize(c, subject) {
+		c.Abort()
+		return
+	}
+	c.Next()
+}
+
+// readAuth is the middleware for GET routes: requireAuth when reads are
+// protected (Config.RequireAuthForReads), otherwise a no-op. Mutation routes
+// always require a token.
+func (s *Server) readAuth() gin.HandlerFunc {
+	if s.cfg.RequireAuthForReads {
+		return s.requireAuth
+	}
+	return func(c *gin.Context) { c.Next() }
+}
+
+// optionalAuth is the middleware for routes that check the caller themselves,
+// such as /graphql: callers sending credentials go through requireAuth, the
+// others pass anonymously unless reads are protected
+func (s *Server) optionalAuth(c *gin.Context) {
+	if s.cfg.RequireAuthForReads || c.GetHeader("Authorization") != "" || c.GetHeader("X-API-Key") != "" {
+		s.requireAuth(c)
+		return
+	}
+	c.Next()
+}
+
+// basicAuth is the middleware for the Swagger UI and admin routes: it demands
+// BASIC_AUTH_USER and BASIC_AUTH_PASSWORD when both are set, otherwise a
+// no-op, as in local development
+func (s *Server) basicAuth() gin.HandlerFunc {
+	wantUser, wantPassword := s.cfg.BasicAuthUser, s.cfg.BasicAuthPassword
+	if wantUser == "" || wantPassword == "" {
+		return func(c *gin.Context) { c.Next() }
+	}
+	return func(c *gin.Context) {
+		user, password, ok := c.Request.BasicAuth()
+		// Compare both in constant time so a wrong user takes as long as a wrong password
+		userOK := subtle.ConstantTimeCompare([]byte(user), []byte(wantUser)) == 1
+		passwordOK := subtle.ConstantTimeCompare([]byte(password), []byte(wantPassword)) == 1
+		if !ok || !userOK || !passwordOK {
+			c.Header("WWW-Authenticate", `Basic realm="restricted", charset="UTF-8"`)
+			respondError(c, http.StatusUnauthorized, CodeUnauthorized, "Invalid credentials")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// verifyToken checks an HS256 token's signature and expiry, by s.now, and returns its subject
+func (s *Server) verifyToken(raw string) (string, error) {
+	token, err := jwt.Parse(raw, func(*jwt.Token) (interface{}, error) {
+		return []byte(s.cfg.JWTSecret), nil
+	}, jwt.WithValidMethods([]string{"HS256"}), jwt.WithExpirationRequired(), jwt.WithTimeFunc(s.now))
+	if err != nil {
+		return "", err
+	}
+	subject, err := token.Claims.GetSubject()
+	if err != nil || subject == "" {
+		return "", errors.New("token has no subject")
+	}
+	return subject, nil
+}
+
+// issueToken signs an HS256 token for subject that expires after
+// Config.TokenTTL, kept short as clients renew it through /auth/refresh
+func (s *Server) issueToken(subject string) (string, time.Time, error) {
+	now := s.now()
+	expiresAt := now.Add(s.cfg.TokenTTL)
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Subject:   subject,
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(expiresAt),
+	})
+	signed, err := token.SignedString([]byte(s.cfg.JWTSecret))
+	return signed, expiresAt, err
+}
+
+// RegisterRequest is the body of a self-registration.
+// bcrypt only looks at the first 72 bytes, so longer passwords are refused.
+type RegisterRequest struct {
+	Name     string `json:"name" binding:"required,max=100"`
+	Email    string `json:"email" binding:"required,email,max=100"`
+	Password string `json:"password" binding:"required,min=8,max=72"`
+}
+
+// Normalize cleans up the name and email like User.normalize; the password is kept verbatim
+func (r *RegisterRequest) Normalize() {
+	r.Name = models.NormalizeName(r.Name)
+	r.Email = models.NormalizeEmail(r.Email)
+}
+
+// LoginRequest is the body of a login
+type LoginRequest struct {
+	Email    string `json:"email" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// Normalize lets the email be typed in any case
+func (r *LoginRequest) Normalize() {
+	r.Email = models.NormalizeEmail(r.Email)
+}
+
+// LoginResponse carries the issued access and refresh tokens
+type LoginResponse struct {
+	Token            string    `json:"token"`
+	TokenType        string    `json:"token_type"`
+	ExpiresAt        time.Time `json:"expires_at"`
+	RefreshToken     string    `json:"refresh_token"`
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+}
+
+// hashPassword hashes password at the configured bcrypt cost
+func (s *Server) hashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), s.cfg.BcryptCost)
+	return string(hash), err
+}
+
+// Register a new account
+// @Summary Register
+// @Description Create a user that can log in with the given password (8 to 72 characters).
+// @Description A token to verify the email with is sent to it.
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param user body RegisterRequest true "Account details"
+// @Success 201 {object} models.User
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/v1/auth/register [post]
+// @Router /api/v2/auth/register [post]
+func (s *Server) register(c *gin.Context) error {
+	var req RegisterRequest
+	if err := s.bindNormalized(c, &req); err != nil {
+		return invalidInput(err)
+	}
+
+	hash, err := s.hashPassword(req.Password)
+	if err != nil {
+		return err
+	}
+
+	user := models.User{Name: req.Name, Email: req.Email, PasswordHash: hash}
+	var verificationToken string
+	err = s.userService.Create(serviceContext(c), &user, func(ctx context.Context, _, created *models.User) error {
+		var err error
+		verificationToken, err = s.issueEmailVerification(storage.Session(ctx, s.db), created.ID)
+		return err
+	})
+	if err != nil {
+		return conflictAs(err, CodeDuplicateEmail, "email already in use")
+	}
+	s.sendEmailVerification(c, user.Email, verificationToken)
+
+	c.JSON(201, user)
+	return nil
+}
+
+// Log in with email and password
+// @Summary Log in
+// @Description Exchange an email and password for a bearer token and a refresh token
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param credentials body LoginRequest true "Credentials"
+// @Success 200 {object} LoginResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 423 {object} models.ErrorResponse // After too many failed logins for the email
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/v1/auth/login [post]
+// @Router /api/v2/auth/login [post]
+func (s *Server) login(c *gin.Context) error {
+	var req LoginRequest
+	if err := s.bindNormalized(c, &req); err != nil {
+		return invalidInput(err)
+	}
+	if wait := s.loginThrottle.Locked(req.Email); wait > 0 {
+		return accountLocked(c, wait)
+	}
+
+	// Unknown emails, users without a password and wrong passwords all get the same answer
+	user, err := s.users.GetForLogin(c.Request.Context(), req.Email)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return err
+	}
+	invalid := newAPIError(http.StatusUnauthorized, CodeUnauthorized, "Invalid email or password")
+	if err != nil || user.PasswordHash == "" {
+		_ = bcrypt.CompareHashAndPassword(s.dummyPasswordHash, []byte(req.Password))
+		s.loginThrottle.Fail(req.Email)
+		return invalid
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)) != nil {
+		s.loginThrottle.Fail(req.Email)
+		return invalid
+	}
+	s.loginThrottle.Reset(req.Email)
+
+	resp, err := s.issueTokens(c.Request.Context(), user.ID, "")
+	if err != nil {
+		return err
+	}
+
+	c.JSON(200, resp)
+	return nil
+}
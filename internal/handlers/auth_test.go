@@ -0,0 +1,277 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"Unit-Test/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+// mintToken signs an HS256 token for subject that expires at expiresAt
+func mintToken(subject string, expiresAt time.Time, secret []byte) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Subject:   subject,
+		ExpiresAt: jwt.NewNumericDate(expiresAt),
+	})
+	signed, _ := token.SignedString(secret)
+	return signed
+}
+
+// newAuthTestRouter builds a router for env.server that, unlike env.router, leaves the Authorization header alone
+func newAuthTestRouter(env *testEnv) *gin.Engine {
+	r := gin.Default()
+	env.server.initializeRoutes(r)
+	return r
+}
+
+func sendWithAuth(router *gin.Engine, method, url, body, authorization string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, url, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestMutationRequiresToken(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	router := newAuthTestRouter(env)
+
+	tests := []struct {
+		name          string
+		authorization string
+		message       string
+	}{
+		{"missing", "", "Missing bearer token"},
+		{"not bearer", "Basic dXNlcjpwYXNz", "Missing bearer token"},
+		{"garbage", "Bearer not-a-token", "Invalid token"},
+		{"expired", "Bearer " + mintToken("1", time.Now().Add(-time.Minute), []byte(testJWTSecret)), "Token has expired"},
+		{"wrong signature", "Bearer " + mintToken("1", time.Now().Add(time.Hour), []byte("other-secret")), "Invalid token"},
+		{"no subject", "Bearer " + mintToken("", time.Now().Add(time.Hour), []byte(testJWTSecret)), "Invalid token"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := sendWithAuth(router, "POST", "/api/v1/users", `{"name":"Alice","email":"alice@example.com"}`, tt.authorization)
+
+			assert.Equal(t, http.StatusUnauthorized, w.Code)
+			var resp models.ErrorResponse
+			_ = json.Unmarshal(w.Body.Bytes(), &resp)
+			assert.Equal(t, CodeUnauthorized, resp.Code)
+			assert.Equal(t, tt.message, resp.Message)
+		})
+	}
+
+	var count int64
+	env.db.Model(&models.User{}).Count(&count)
+	assert.Equal(t, int64(0), count)
+}
+
+func TestMutationWithValidToken(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	env.db.Create(&models.User{Name: "Root", Email: "root@example.com", Role: models.RoleAdmin})
+	router := newAuthTestRouter(env)
+
+	token := "Bearer " + mintToken("1", time.Now().Add(time.Hour), []byte(testJWTSecret))
+	w := sendWithAuth(router, "POST", "/api/v1/users", `{"name":"Alice","email":"alice@example.com"}`, token)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	w = sendWithAuth(router, "DELETE", "/api/v1/users/2", "", "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = sendWithAuth(router, "DELETE", "/api/v1/users/2", "", token)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestRequireAuthStoresSubject(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+	env.db.Create(&models.User{ID: 42, Name: "Alice", Email: "alice@example.com"})
+
+	r := gin.New()
+	r.GET("/whoami", env.server.requireAuth, func(c *gin.Context) {
+		c.String(200, c.GetString(authSubjectKey))
+	})
+
+	w := sendWithAuth(r, "GET", "/whoami", "", "Bearer "+mintToken("42", time.Now().Add(time.Hour), []byte(testJWTSecret)))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "42", w.Body.String())
+}
+
+func TestRequireAuthRejectsDeletedUser(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+	env.db.Create(&models.User{Name: "Alice", Email: "alice@example.com", Role: models.RoleAdmin})
+	token := "Bearer " + mintToken("1", time.Now().Add(time.Hour), []byte(testJWTSecret))
+	router := newAuthTestRouter(env)
+
+	assert.Equal(t, http.StatusCreated, sendWithAuth(router, "POST", "/api/v1/users", `{"name":"Bob","email":"bob@example.com"}`, token).Code)
+
+	env.db.Delete(&models.User{}, 1)
+	for _, token := range []string{token, "Bearer " + mintToken("99", time.Now().Add(time.Hour), []byte(testJWTSecret))} {
+		w := sendWithAuth(router, "POST", "/api/v1/users", `{"name":"Carol","email":"carol@example.com"}`, token)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.JSONEq(t, withRequestID(`{"code":"UNAUTHORIZED","message":"Invalid token"}`, w), w.Body.String())
+	}
+}
+
+func TestReadsArePublicByDefault(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	router := newAuthTestRouter(env)
+
+	w := sendWithAuth(router, "GET", "/api/v1/users", "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestReadsRequireTokenWhenConfigured(t *testing.T) {
+	t.Parallel()
+	cfg := testConfig()
+	cfg.RequireAuthForReads = true
+	env := newTestEnvWith(t, Deps{Config: cfg})
+	env.db.Create(&models.User{Name: "Alice", Email: "alice@example.com"})
+
+	router := newAuthTestRouter(env)
+
+	w := sendWithAuth(router, "GET", "/api/v1/users", "", "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = sendWithAuth(router, "GET", "/api/v1/users", "", "Bearer "+mintToken("1", time.Now().Add(time.Hour), []byte(testJWTSecret)))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestRegisterLoginAndUseToken(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	router := newAuthTestRouter(env)
+
+	w := sendWithAuth(router, "POST", "/api/v1/auth/register", `{"name":"Alice","email":"Alice@Example.com","password":"correct horse"}`, "")
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.NotContains(t, w.Body.String(), "password")
+
+	var user models.User
+	env.db.First(&user)
+	assert.NotEmpty(t, user.PasswordHash)
+	assert.NotEqual(t, "correct horse", user.PasswordHash)
+
+	w = sendWithAuth(router, "POST", "/api/v1/auth/login", `{"email":"alice@example.com","password":"correct horse"}`, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resp LoginResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "Bearer", resp.TokenType)
+	assert.True(t, resp.ExpiresAt.After(time.Now()))
+
+	subject, err := env.server.verifyToken(resp.Token)
+	assert.NoError(t, err)
+	assert.Equal(t, "1", subject)
+
+	w = sendWithAuth(router, "POST", "/api/v1/users", `{"name":"Bob","email":"bob@example.com"}`, "Bearer "+resp.Token)
+	assert.Equal(t, http.StatusCreated, w.Code)
+}
+
+func TestLoginRejectsBadCredentials(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	router := newAuthTestRouter(env)
+	sendWithAuth(router, "POST", "/api/v1/auth/register", `{"name":"Alice","email":"alice@example.com","password":"correct horse"}`, "")
+	env.db.Create(&models.User{Name: "Bob", Email: "bob@example.com"})
+
+	for _, body := range []string{
+		`{"email":"alice@example.com","password":"wrong password"}`,
+		`{"email":"nobody@example.com","password":"correct horse"}`,
+		`{"email":"bob@example.com","password":"correct horse"}`,
+	} {
+		w := sendWithAuth(router, "POST", "/api/v1/auth/login", body, "")
+		assert.Equal(t, http.StatusUnauthorized, w.Code, body)
+		assert.JSONEq(t, withRequestID(`{"code":"UNAUTHORIZED","message":"Invalid email or password"}`, w), w.Body.String())
+	}
+}
+
+func TestRegisterDuplicateEmail(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	router := newAuthTestRouter(env)
+	sendWithAuth(router, "POST", "/api/v1/auth/register", `{"name":"Alice","email":"alice@example.com","password":"correct horse"}`, "")
+
+	w := sendWithAuth(router, "POST", "/api/v1/auth/register", `{"name":"Other","email":"ALICE@example.com","password":"another one"}`, "")
+	assert.Equal(t, http.StatusConflict, w.Code)
+	var resp models.ErrorResponse
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	assert.Equal(t, CodeDuplicateEmail, resp.Code)
+}
+
+func TestRegisterShortPassword(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	w := sendWithAuth(newAuthTestRouter(env), "POST", "/api/v1/auth/register", `{"name":"Alice","email":"alice@example.com","password":"short"}`, "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `"field":"password"`)
+}
+
+// getSwagger requests the Swagger UI page. gin-swagger routes on RequestURI,
+// which only the server sets, so it is filled in here.
+func getSwagger(router *gin.Engine, authorization string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("GET", "/swagger/index.html", nil)
+	req.RequestURI = "/swagger/index.html"
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestSwaggerOpenWithoutBasicAuthConfigured(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	w := getSwagger(newAuthTestRouter(env), "")
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestSwaggerRequiresBasicAuthWhenConfigured(t *testing.T) {
+	t.Parallel()
+	cfg := testConfig()
+	cfg.BasicAuthUser, cfg.BasicAuthPassword = "admin", "s3cret"
+	env := newTestEnvWith(t, Deps{Config: cfg})
+
+	router := newAuthTestRouter(env)
+
+	tests := []struct {
+		name          string
+		authorization string
+		status        int
+	}{
+		{"missing", "", http.StatusUnauthorized},
+		{"wrong password", "Basic YWRtaW46d3Jvbmc=", http.StatusUnauthorized}, // admin:wrong
+		{"wrong user", "Basic cm9vdDpzM2NyZXQ=", http.StatusUnauthorized},     // root:s3cret
+		{"bearer instead", "Bearer " + mintToken("1", time.Now().Add(time.Hour), []byte(testJWTSecret)), http.StatusUnauthorized},
+		{"valid", "Basic YWRtaW46czNjcmV0", http.StatusOK}, // admin:s3cret
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := getSwagger(router, tt.authorization)
+			assert.Equal(t, tt.status, w.Code)
+			if tt.status == http.StatusUnauthorized {
+				assert.Contains(t, w.Header().Get("WWW-Authenticate"), "Basic")
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"Unit-Test/internal/models"
+	"Unit-Test/internal/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Context key holding the authenticated user's role once it has been looked up
+const authRoleKey = "auth_role"
+
+// accessSelf in an access rule admits a caller acting on their own user, the :id of the route
+const accessSelf = "self"
+
+// accessRules lists the roles allowed on a route, keyed by method and route
+// pattern without the version prefix. Routes without an entry are open to any authenticated caller.
+var accessRules = map[string][]string{
+	"PUT /users/:id":                       {accessSelf, models.RoleAdmin},
+	"PATCH /users/:id":                     {accessSelf, models.RoleAdmin},
+	"DELETE /users/:id":                    {models.RoleAdmin},
+	"POST /users/:id/restore":              {models.RoleAdmin},
+	"POST /users/bulk":                     {models.RoleAdmin},
+	"POST /users/import":                   {models.RoleAdmin},
+	"PUT /users/by-email/:email":           {models.RoleAdmin},
+	"PUT /users/:id/avatar":                {accessSelf, models.RoleAdmin},
+	"PATCH /users/:id/preferences":         {accessSelf, models.RoleAdmin},
+	"GET /users/:id/audit":                 {models.RoleAdmin},
+	"POST /users/:id/password":             {accessSelf, models.RoleAdmin},
+	"POST /users/:id/addresses":            {accessSelf, models.RoleAdmin},
+	"PUT /users/:id/addresses/:addr_id":    {accessSelf, models.RoleAdmin},
+	"DELETE /users/:id/addresses/:addr_id": {accessSelf, models.RoleAdmin},
+	"POST /users/:id/posts":                {accessSelf, models.RoleAdmin},
+	"PUT /users/:id/posts/:post_id":        {accessSelf, models.RoleAdmin},
+	"DELETE /users/:id/posts/:post_id":     {accessSelf, models.RoleAdmin},
+	// A key authenticates as the user it belongs to, so only they and admins manage them
+	"GET /users/:id/api-keys":            {accessSelf, models.RoleAdmin},
+	"POST /users/:id/api-keys":           {accessSelf, models.RoleAdmin},
+	"DELETE /users/:id/api-keys/:key_id": {accessSelf, models.RoleAdmin},
+	"GET /webhooks":                      {models.RoleAdmin},
+	"POST /webhooks":                     {models.RoleAdmin},
+	"GET /webhooks/:id":                  {models.RoleAdmin},
+	"PUT /webhooks/:id":                  {models.RoleAdmin},
+	"DELETE /webhooks/:id":               {models.RoleAdmin},
+	"POST /admin/purge":                  {models.RoleAdmin},
+}
+
+// authorize checks the access rule of the current route against the role of
+// subject, writing the 403 itself when the role is not allowed
+func (s *Server) authorize(c *gin.Context, subject string) bool {
+	err := s.checkAccess(c, c.Request.Method+" "+routeKey(c), c.Param("id"), subject)
+	var apiErr *APIError
+	switch {
+	case err == nil:
+		return true
+	case errors.As(err, &apiErr):
+		respondError(c, apiErr.Status, apiErr.Code, apiErr.Message)
+	default:
+		respondFailure(c, err, "Failed to check permissions")
+	}
+	return false
+}
+
+// checkAccess applies the access rule keyed rule to subject acting on the
+// user with id. A role the rule excludes is a 403 *APIError.
+func (s *Server) checkAccess(c *gin.Context, rule, id, subject string) error {
+	allowed, ok := accessRules[rule]
+	if !ok {
+		return nil
+	}
+	for _, r := range allowed {
+		if r == accessSelf && id == subject {
+			return nil
+		}
+	}
+
+	role, err := s.subjectRole(c, subject)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return newAPIError(http.StatusForbidden, CodeForbidden, "Authenticated user no longer exists")
+		}
+		return err
+	}
+	for _, r := range allowed {
+		if r == role {
+			return nil
+		}
+	}
+	return newAPIError(http.StatusForbidden, CodeForbidden, "Role "+role+" may not perform this action")
+}
+
+// subjectRole returns the role of the user subject refers to, loading it unless
+// an earlier middleware already put it in the context
+func (s *Server) subjectRole(c *gin.Context, subject string) (string, error) {
+	if role := c.GetString(authRoleKey); role != "" {
+		return role, nil
+	}
+	id, err := strconv.Atoi(subject)
+	if err != nil {
+		return "", storage.ErrNotFound
+	}
+	user, err := s.users.Get(c.Request.Context(), id)
+	if err != nil {
+		return "", err
+	}
+	c.Set(authRoleKey, user.Role)
+	return user.Role, nil
+}
+
+// callerIsAdmin reports whether the authenticated caller is an admin.
+// Anonymous callers and users that no longer exist are not.
+func (s *Server) callerIsAdmin(c *gin.Context) (bool, error) {
+	subject := c.GetString(authSubjectKey)
+	if subject == "" {
+		return false, nil
+	}
+	role, err := s.subjectRole(c, subject)
+	if errors.Is(err, storage.ErrNotFound) {
+		return false, nil
+	}
+	return role == models.RoleAdmin, err
+}
+
+// checkRoleChange lets only admins give a user a role other than from, the one
+// it has. Roles decide what the access rules let a caller do, so anyone else
+// could otherwise make themselves an admin.
+func (s *Server) checkRoleChange(c *gin.Context, from, to string) error {
+	if to == from {
+		return nil
+	}
+	admin, err := s.callerIsAdmin(c)
+	if err != nil {
+		return err
+	}
+	if !admin {
+		return newAPIError(http.StatusForbidden, CodeForbidden, "Only admins may change roles")
+	}
+	return nil
+}
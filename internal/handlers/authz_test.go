@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"Unit-Test/internal/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// seedRoles creates an admin (id 1), a member (id 2) and a viewer (id 3)
+func seedRoles(env *testEnv) {
+	env.db.Create(&models.User{Name: "Ada", Email: "ada@example.com", Role: models.RoleAdmin})
+	env.db.Create(&models.User{Name: "Max", Email: "max@example.com", Role: models.RoleMember})
+	env.db.Create(&models.User{Name: "Val", Email: "val@example.com", Role: models.RoleViewer})
+}
+
+// bearerFor returns an Authorization header for the user with the given id
+func bearerFor(id string) string {
+	return "Bearer " + mintToken(id, time.Now().Add(time.Hour), []byte(testJWTSecret))
+}
+
+func TestDeleteUserAccessRules(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+	seedRoles(env)
+
+	// The admin goes last: once the member is deleted, their token is invalid
+	tests := []struct {
+		name          string
+		authorization string
+		status        int
+		code          string
+	}{
+		{"member forbidden", bearerFor("2"), http.StatusForbidden, CodeForbidden},
+		{"viewer forbidden", bearerFor("3"), http.StatusForbidden, CodeForbidden},
+		{"unknown user", bearerFor("99"), http.StatusUnauthorized, CodeUnauthorized},
+		{"unauthenticated", "", http.StatusUnauthorized, CodeUnauthorized},
+		{"admin allowed", bearerFor("1"), http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := sendWithAuth(newAuthTestRouter(env), "DELETE", "/api/v1/users/2", "", tt.authorization)
+			assert.Equal(t, tt.status, w.Code)
+			if tt.code != "" {
+				var resp models.ErrorResponse
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+				assert.Equal(t, tt.code, resp.Code)
+			}
+		})
+	}
+}
+
+func TestDeleteUserAccessRuleWithAPIKey(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	seedRoles(env)
+	env.db.Create(&models.APIKey{UserID: 2, Label: "ci", KeyHash: hashSecret("member-key")})
+
+	w := sendWithAPIKey(newAuthTestRouter(env), "DELETE", "/api/v1/users/2", "", "member-key")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestMemberCanReadAndUpdateOwnRecord(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	seedRoles(env)
+	router := newAuthTestRouter(env)
+
+	w := sendWithAuth(router, "GET", "/api/v1/users/2", "", bearerFor("2"))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = sendWithAuth(router, "PATCH", "/api/v1/users/2", `{"name":"Maxine","version":1}`, bearerFor("2"))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"name":"Maxine"`)
+}
+
+func TestMemberCannotWriteOtherUsers(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	seedRoles(env)
+	env.db.Create(&models.User{Name: "Del", Email: "del@example.com"})
+	env.db.Delete(&models.User{}, 4)
+	router := newAuthTestRouter(env)
+
+	tests := []struct{ method, url, body string }{
+		{"PUT", "/api/v1/users/1", `{"name":"Ada","email":"ada@example.com","version":1}`},
+		{"PATCH", "/api/v1/users/1", `{"name":"Mallory","version":1}`},
+		{"PATCH", "/api/v1/users/1/preferences", `{"theme":"dark"}`},
+		{"PUT", "/api/v1/users/1/avatar", ""},
+		{"POST", "/api/v1/users/4/restore", ""},
+		{"POST", "/api/v1/users/bulk", `[{"name":"Eve","email":"eve@example.com"}]`},
+		{"POST", "/api/v1/users/import", "name,email\nEve,eve@example.com\n"},
+		{"PUT", "/api/v1/users/by-email/ada@example.com", `{"name":"Mallory"}`},
+		{"POST", "/api/v1/users/1/addresses", `{"street":"s","city":"c","country":"US"}`},
+		{"POST", "/api/v1/users/1/posts", `{"title":"t","body":"b"}`},
+	}
+	for _, tt := range tests {
+		w := sendWithAuth(router, tt.method, tt.url, tt.body, bearerFor("2"))
+		assert.Equal(t, http.StatusForbidden, w.Code, "%s %s", tt.method, tt.url)
+	}
+
+	var admin models.User
+	env.db.First(&admin, 1)
+	assert.Equal(t, "Ada", admin.Name)
+	assert.Equal(t, 1, admin.Version)
+}
+
+func TestOnlyAdminsChangeRoles(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	seedRoles(env)
+	router := newAuthTestRouter(env)
+
+	// Members can't promote themselves, nor create admins
+	w := sendWithAuth(router, "PATCH", "/api/v1/users/2", `{"role":"admin","version":1}`, bearerFor("2"))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = sendWithAuth(router, "PUT", "/api/v1/users/2", `{"name":"Max","email":"max@example.com","role":"admin","version":1}`, bearerFor("2"))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = sendWithAuth(router, "POST", "/api/v1/users", `{"name":"Eve","email":"eve@example.com","role":"admin"}`, bearerFor("2"))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	var member models.User
+	env.db.First(&member, 2)
+	assert.Equal(t, models.RoleMember, member.Role)
+
+	// Keeping the role they have is fine, and so is leaving it out
+	w = sendWithAuth(router, "PUT", "/api/v1/users/2", `{"name":"Max","email":"max@example.com","role":"member","version":1}`, bearerFor("2"))
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = sendWithAuth(router, "POST", "/api/v1/users", `{"name":"Eve","email":"eve@example.com"}`, bearerFor("2"))
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	// Admins change anyone's role
+	w = sendWithAuth(router, "PATCH", "/api/v1/users/2", `{"role":"admin","version":2}`, bearerFor("1"))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"role":"admin"`)
+}
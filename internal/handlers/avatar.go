@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Default maximum avatar size (2MB), overridable via AVATAR_MAX_BYTES
+const defaultAvatarMaxBytes = 2 << 20
+
+// File extensions for the image types accepted as avatars
+var avatarExtensions = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+}
+
+// Upload a user's avatar
+// @Summary Upload avatar
+// @Description Upload a PNG or JPEG avatar as the "avatar" field of a multipart form. The default size limit is 2MB. Only the user themselves or an admin may do this.
+// @Tags Users
+// @Accept multipart/form-data
+// @Produce json
+// @Param id path int true "User ID"
+// @Param avatar formData file true "PNG or JPEG image"
+// @Success 200 {object} models.User
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 413 {object} models.ErrorResponse
+// @Failure 415 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Security BearerAuth
+// @Router /api/v1/users/{id}/avatar [put]
+// @Router /api/v2/users/{id}/avatar [put]
+func (s *Server) uploadAvatar(c *gin.Context) error {
+	id, err := parseUserID(c)
+	if err != nil {
+		return validationError(err.Error())
+	}
+
+	user, err := s.lookupUser(c, id)
+	if err != nil {
+		return notFoundAs(err, CodeUserNotFound, "User not found")
+	}
+
+	maxBytes := s.cfg.AvatarMaxBytes
+	tooLarge := newAPIError(http.StatusRequestEntityTooLarge, CodePayloadTooLarge, "Avatar must be at most "+strconv.FormatInt(maxBytes, 10)+" bytes")
+	// Leave some room for the multipart headers around the file itself
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes+4096)
+	fileHeader, err := c.FormFile("avatar")
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			return tooLarge
+		}
+		return validationError("Missing avatar file")
+	}
+	if fileHeader.Size > maxBytes {
+		return tooLarge
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		return validationError("Unable to read avatar file")
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return validationError("Unable to read avatar file")
+	}
+
+	// Trust the bytes, not the client-supplied Content-Type
+	ext, ok := avatarExtensions[http.DetectContentType(data)]
+	if !ok {
+		return newAPIError(http.StatusUnsupportedMediaType, CodeUnsupportedMediaType, "Avatar must be a PNG or JPEG image")
+	}
+
+	if err := os.MkdirAll(s.cfg.AvatarDir, 0o755); err != nil {
+		return err
+	}
+	path := filepath.Join(s.cfg.AvatarDir, strconv.Itoa(user.ID)+ext)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return err
+	}
+	// Replacing a PNG with a JPEG (or vice versa) leaves the old file behind
+	if user.AvatarPath != "" && user.AvatarPath != path {
+		os.Remove(user.AvatarPath)
+	}
+
+	user, err = s.userService.SetAvatar(serviceContext(c), user.ID, path)
+	if err != nil {
+		return notFoundAs(err, CodeUserNotFound, "User not found")
+	}
+
+	c.JSON(200, user)
+	return nil
+}
+
+// Fetch a user's avatar
+// @Summary Get avatar
+// @Description Return the user's avatar image
+// @Tags Users
+// @Produce png
+// @Produce jpeg
+// @Param id path int true "User ID"
+// @Success 200 {file} file
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/v1/users/{id}/avatar [get]
+// @Router /api/v2/users/{id}/avatar [get]
+func (s *Server) getAvatar(c *gin.Context) error {
+	id, err := parseUserID(c)
+	if err != nil {
+		return validationError(err.Error())
+	}
+
+	user, err := s.lookupUser(c, id)
+	if err != nil {
+		return notFoundAs(err, CodeUserNotFound, "User not found")
+	}
+	if user.AvatarPath == "" {
+		return newAPIError(http.StatusNotFound, CodeAvatarNotFound, "User has no avatar")
+	}
+	if _, err := os.Stat(user.AvatarPath); err != nil {
+		return newAPIError(http.StatusNotFound, CodeAvatarNotFound, "User has no avatar")
+	}
+
+	// ServeFile picks the Content-Type from the .png/.jpg extension
+	c.File(user.AvatarPath)
+	return nil
+}
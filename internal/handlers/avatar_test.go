@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"Unit-Test/internal/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func putAvatar(t *testing.T, env *testEnv, url string, data []byte) *httptest.ResponseRecorder {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	part, _ := mw.CreateFormFile("avatar", "avatar.png")
+	_, _ = part.Write(data)
+	_ = mw.Close()
+
+	req, _ := http.NewRequest("PUT", url, &buf)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+	return w
+}
+
+func TestUploadAndGetAvatar(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	env.db.Create(&models.User{Name: "Dora", Email: "dora@example.com"})
+
+	png, err := os.ReadFile("testdata/avatar.png")
+	assert.NoError(t, err)
+
+	w := putAvatar(t, env, "/api/v1/users/1/avatar", png)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	req, _ := http.NewRequest("GET", "/api/v1/users/1/avatar", nil)
+	w = httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "image/png", w.Header().Get("Content-Type"))
+	assert.Equal(t, png, w.Body.Bytes())
+}
+
+func TestGetAvatarUnset(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	env.db.Create(&models.User{Name: "Dora", Email: "dora@example.com"})
+
+	req, _ := http.NewRequest("GET", "/api/v1/users/1/avatar", nil)
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestUploadAvatarRejectsTextFile(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	env.db.Create(&models.User{Name: "Dora", Email: "dora@example.com"})
+
+	w := putAvatar(t, env, "/api/v1/users/1/avatar", []byte("definitely not an image"))
+	assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+}
+
+func TestUploadAvatarRejectsOversizedFile(t *testing.T) {
+	t.Parallel()
+	cfg := testConfig()
+	cfg.AvatarMaxBytes = 64
+	env := newTestEnvWith(t, Deps{Config: cfg})
+
+	env.db.Create(&models.User{Name: "Dora", Email: "dora@example.com"})
+
+	png, _ := os.ReadFile("testdata/avatar.png")
+	w := putAvatar(t, env, "/api/v1/users/1/avatar", append(png, make([]byte, 8192)...))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+}
@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"Unit-Test/internal/cache"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Largest response body kept in the cache; bigger pages are served uncached
+const maxCachedBodyBytes = 1 << 20
+
+// Prefix of the response cache's keys, so writes can drop them all
+const responseKeyPrefix = "responses:"
+
+// cachedResponse is a successful response as its handler wrote it
+type cachedResponse struct {
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body"`
+}
+
+// responseCache keeps the responses of the user reads in a cache.Cache for
+// ttl. Every write this instance serves empties it, so reads here never trail
+// writes made here; with a per-replica cache, reads elsewhere may trail them
+// for up to the TTL. A cache that fails is logged and treated as empty.
+type responseCache struct {
+	store  cache.Cache
+	ttl    time.Duration
+	logger *slog.Logger
+	// generation changes with every write, so a read that raced one doesn't
+	// store what it read before it
+	generation atomic.Uint64
+}
+
+func newResponseCache(store cache.Cache, ttl time.Duration, logger *slog.Logger) *responseCache {
+	return &responseCache{store: store, ttl: ttl, logger: logger}
+}
+
+func (rc *responseCache) get(ctx context.Context, key string) (cachedResponse, bool) {
+	data, ok, err := rc.store.Get(ctx, responseKeyPrefix+key)
+	if err != nil {
+		rc.logger.Warn("response cache unavailable", "error", err.Error())
+		return cachedResponse{}, false
+	}
+	var resp cachedResponse
+	if !ok || json.Unmarshal(data, &resp) != nil {
+		return cachedResponse{}, false
+	}
+	return resp, true
+}
+
+// put stores a response read in generation, unless a write has happened since
+func (rc *responseCache) put(ctx context.Context, key string, generation uint64, resp cachedResponse) {
+	if generation != rc.generation.Load() {
+		return
+	}
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return
+	}
+	if err := rc.store.Set(ctx, responseKeyPrefix+key, data, rc.ttl); err != nil {
+		rc.logger.Warn("response cache unavailable", "error", err.Error())
+		return
+	}
+	// A write that finished while this was being stored may have emptied
+	// the cache before it; take the entry back out
+	if generation != rc.generation.Load() {
+		_ = rc.store.Delete(ctx, responseKeyPrefix+key)
+	}
+}
+
+// invalidate empties the cache and fails the puts of reads in progress
+func (rc *responseCache) invalidate(ctx context.Context) {
+	rc.generation.Add(1)
+	if err := rc.store.DeleteByPrefix(ctx, responseKeyPrefix); err != nil {
+		rc.logger.Error("response cache not emptied, reads may be stale until it expires", "error", err.Error())
+	}
+}
+
+// cacheKey identifies the response to a read: its path, its query with the
+// parameters sorted, and the format it accepts
+func cacheKey(c *gin.Context) string {
+	return c.Request.URL.Path + "?" + c.Request.URL.Query().Encode() + "\n" + c.GetHeader("Accept")
+}
+
+// cacheResponses answers a read from the cache, or stores the response of the
+// handlers after it when they succeed. Conditional requests and the admin view
+// of deleted users go to the handlers every time.
+func (s *Server) cacheResponses(c *gin.Context) {
+	if s.cache == nil || c.GetHeader("If-None-Match") != "" || c.Query("include_deleted") != "" {
+		c.Next()
+		return
+	}
+
+	key := cacheKey(c)
+	if entry, ok := s.cache.get(c.Request.Context(), key); ok {
+		cacheRequestsTotal.WithLabelValues(c.FullPath(), "hit").Inc()
+		for name, values := range entry.Header {
+			c.Writer.Header()[name] = values
+		}
+		c.Status(http.StatusOK)
+		_, _ = c.Writer.Write(entry.Body)
+		c.Abort()
+		return
+	}
+	cacheRequestsTotal.WithLabelValues(c.FullPath(), "miss").Inc()
+
+	generation := s.cache.generation.Load()
+	before := c.Writer.Header().Clone()
+	w := &capturingWriter{ResponseWriter: c.Writer}
+	c.Writer = w
+	c.Next()
+	c.Writer = w.ResponseWriter
+
+	// A failure left for handleErrors hasn't been written yet
+	if len(c.Errors) > 0 || !w.Written() || w.Status() != http.StatusOK || w.overflow {
+		return
+	}
+	// Only what the handlers set; the rest, such as the request id, belongs
+	// to each request
+	header := http.Header{}
+	for name, values := range c.Writer.Header() {
+		if !slices.Equal(before[name], values) {
+			header[name] = slices.Clone(values)
+		}
+	}
+	s.cache.put(c.Request.Context(), key, generation, cachedResponse{Header: header, Body: w.body.Bytes()})
+}
+
+// invalidateCache empties the response cache around every write: when it
+// starts, so reads racing it don't store what they read, and once it has
+// succeeded
+func (s *Server) invalidateCache(c *gin.Context) {
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		c.Next()
+		return
+	}
+	s.cache.invalidate(c.Request.Context())
+	c.Next()
+	if c.Writer.Status() < http.StatusBadRequest {
+		// Not the request's context, which may be cancelled by now
+		s.cache.invalidate(context.WithoutCancel(c.Request.Context()))
+	}
+}
+
+// capturingWriter keeps a copy of the body it writes, up to maxCachedBodyBytes
+type capturingWriter struct {
+	gin.ResponseWriter
+	body     bytes.Buffer
+	overflow bool
+}
+
+func (w *capturingWriter) Write(data []byte) (int, error) {
+	if !w.overflow {
+		if w.body.Len()+len(data) > maxCachedBodyBytes {
+			w.overflow = true
+			w.body = bytes.Buffer{}
+		} else {
+			w.body.Write(data)
+		}
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *capturingWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"Unit-Test/internal/cache"
+	"Unit-Test/internal/models"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// newCachingRouter serves a database of t's own with the response cache on,
+// counting the queries that reach the database
+func newCachingRouter(t *testing.T) (*gin.Engine, *atomic.Int64) {
+	return newCachingRouterWith(t, cache.NewMemory(100))
+}
+
+// newCachingRouterWith is newCachingRouter keeping the responses in store
+func newCachingRouterWith(t *testing.T, store cache.Cache) (*gin.Engine, *atomic.Int64) {
+	conn := newTestDB(t)
+	conn.Create(&models.User{Name: "Alice", Email: "alice@example.com"})
+
+	queries := &atomic.Int64{}
+	require.NoError(t, conn.Callback().Query().After("gorm:query").Register("test:count_queries", func(*gorm.DB) {
+		queries.Add(1)
+	}))
+
+	env := newTestEnvWith(t, Deps{DB: conn, Cache: store})
+	return env.router, queries
+}
+
+// cacheRequest sends method url with body through r
+func cacheRequest(r http.Handler, method, url, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, url, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestCacheServesRepeatedReads(t *testing.T) {
+	r, queries := newCachingRouter(t)
+	hits := testutil.ToFloat64(cacheRequestsTotal.WithLabelValues("/api/v1/users", "hit"))
+
+	first := cacheRequest(r, "GET", "/api/v1/users?limit=5&page=1", "")
+	assert.Equal(t, http.StatusOK, first.Code)
+	afterFirst := queries.Load()
+	assert.NotZero(t, afterFirst)
+
+	// The same query, its parameters in another order
+	second := cacheRequest(r, "GET", "/api/v1/users?page=1&limit=5", "")
+	assert.Equal(t, afterFirst, queries.Load(), "served from the cache")
+	assert.Equal(t, first.Body.String(), second.Body.String())
+	assert.Equal(t, first.Header().Get("Content-Type"), second.Header().Get("Content-Type"))
+	assert.Equal(t, "100", second.Header().Get("X-Max-Page-Size"))
+	assert.Equal(t, hits+1, testutil.ToFloat64(cacheRequestsTotal.WithLabelValues("/api/v1/users", "hit")))
+
+	// Each request keeps its own id
+	assert.NotEqual(t, first.Header().Get("X-Request-ID"), second.Header().Get("X-Request-ID"))
+
+	// Another format or query is another entry
+	cacheRequest(r, "GET", "/api/v1/users?page=2&limit=5", "")
+	assert.Greater(t, queries.Load(), afterFirst)
+}
+
+func TestCacheInvalidatedByWrites(t *testing.T) {
+	t.Parallel()
+	r, queries := newCachingRouter(t)
+
+	w := cacheRequest(r, "GET", "/api/v1/users/1", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	etag := w.Header().Get("ETag")
+	cacheRequest(r, "GET", "/api/v1/users", "")
+	before := queries.Load()
+	cacheRequest(r, "GET", "/api/v1/users", "")
+	require.Equal(t, before, queries.Load())
+
+	w = cacheRequest(r, "POST", "/api/v1/users", `{"name":"Bob","email":"bob@example.com"}`)
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	w = cacheRequest(r, "GET", "/api/v1/users", "")
+	assert.Contains(t, w.Body.String(), "bob@example.com", "the POST emptied the cache")
+
+	w = cacheRequest(r, "PUT", "/api/v1/users/1", `{"name":"Alice Smith","email":"alice@example.com","version":1}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	w = cacheRequest(r, "GET", "/api/v1/users/1", "")
+	assert.Contains(t, w.Body.String(), "Alice Smith")
+	assert.NotEqual(t, etag, w.Header().Get("ETag"))
+
+	// A failed write leaves the cache to refill as usual
+	w = cacheRequest(r, "POST", "/api/v1/users", `{"name":"Bob","email":"bob@example.com"}`)
+	require.Equal(t, http.StatusConflict, w.Code)
+	cacheRequest(r, "GET", "/api/v1/users", "")
+	before = queries.Load()
+	cacheRequest(r, "GET", "/api/v1/users", "")
+	assert.Equal(t, before, queries.Load())
+}
+
+func TestCacheInRedis(t *testing.T) {
+	t.Parallel()
+	server := miniredis.RunT(t)
+	store, err := cache.NewRedis(context.Background(), "redis://"+server.Addr())
+	require.NoError(t, err)
+	t.Cleanup(func() { store.Close() })
+	r, queries := newCachingRouterWith(t, store)
+
+	first := cacheRequest(r, "GET", "/api/v1/users/1", "")
+	require.Equal(t, http.StatusOK, first.Code)
+	assert.Len(t, server.Keys(), 1)
+	read := queries.Load()
+	second := cacheRequest(r, "GET", "/api/v1/users/1", "")
+	assert.Equal(t, read, queries.Load(), "served from redis")
+	assert.Equal(t, first.Body.String(), second.Body.String())
+
+	w := cacheRequest(r, "PUT", "/api/v1/users/1", `{"name":"Alice Smith","email":"alice@example.com","version":1}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, server.Keys(), "the write emptied redis")
+
+	// Without redis every request goes to the database, and still succeeds
+	server.Close()
+	read = queries.Load()
+	w = cacheRequest(r, "GET", "/api/v1/users/1", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Alice Smith")
+	assert.Greater(t, queries.Load(), read)
+	w = cacheRequest(r, "DELETE", "/api/v1/users/1", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestCacheBypasses(t *testing.T) {
+	t.Parallel()
+	r, queries := newCachingRouter(t)
+
+	w := cacheRequest(r, "GET", "/api/v1/users/1", "")
+	etag := w.Header().Get("ETag")
+	before := queries.Load()
+
+	req := httptest.NewRequest("GET", "/api/v1/users/1", nil)
+	req.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Greater(t, queries.Load(), before, "conditional requests reach the handler")
+
+	// Failures are not cached
+	cacheRequest(r, "GET", "/api/v1/users/99", "")
+	before = queries.Load()
+	w = cacheRequest(r, "GET", "/api/v1/users/99", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Greater(t, queries.Load(), before)
+}
+
+func TestResponseCacheSkipsRacingReads(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	rc := newResponseCache(cache.NewMemory(10), time.Minute, slog.Default())
+
+	rc.put(ctx, "a", rc.generation.Load(), cachedResponse{Body: []byte("a")})
+	got, ok := rc.get(ctx, "a")
+	assert.True(t, ok)
+	assert.Equal(t, "a", string(got.Body))
+
+	// A read that raced a write doesn't store what it read
+	generation := rc.generation.Load()
+	rc.invalidate(ctx)
+	_, ok = rc.get(ctx, "a")
+	assert.False(t, ok)
+	rc.put(ctx, "b", generation, cachedResponse{Body: []byte("b")})
+	_, ok = rc.get(ctx, "b")
+	assert.False(t, ok)
+}
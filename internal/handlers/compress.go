@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Content types compressed already, or not worth compressing
+var incompressibleTypes = []string{
+	"image/",
+	"video/",
+	"audio/",
+	"application/gzip",
+	"application/zip",
+	"application/octet-stream",
+}
+
+// compressResponses gzips the responses of clients that accept it, once the
+// body reaches minBytes; smaller ones would grow by the gzip header. Bodies
+// that are compressed already, such as avatars, are sent as they are.
+func compressResponses(level int, minBytes int64) gin.HandlerFunc {
+	pool := &sync.Pool{New: func() interface{} {
+		// The level was validated with the configuration
+		w, _ := gzip.NewWriterLevel(io.Discard, level)
+		return w
+	}}
+	return func(c *gin.Context) {
+		c.Header("Vary", "Accept-Encoding")
+		if c.Request.Method == http.MethodHead || !acceptsGzip(c.GetHeader("Accept-Encoding")) {
+			c.Next()
+			return
+		}
+
+		w := &gzipResponseWriter{ResponseWriter: c.Writer, pool: pool, minBytes: minBytes}
+		c.Writer = w
+		defer w.finish()
+		c.Next()
+	}
+}
+
+// acceptsGzip reports whether an Accept-Encoding header allows gzip
+func acceptsGzip(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != "gzip" && name != "*" {
+			continue
+		}
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if weight, err := strconv.ParseFloat(q, 64); err == nil && weight == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// gzipResponseWriter holds the body back until it reaches minBytes, then
+// decides from the headers whether to compress it
+type gzipResponseWriter struct {
+	gin.ResponseWriter
+	pool     *sync.Pool
+	minBytes int64
+
+	buf     bytes.Buffer
+	decided bool
+	gz      *gzip.Writer
+}
+
+func (w *gzipResponseWriter) Write(data []byte) (int, error) {
+	if !w.decided {
+		w.buf.Write(data)
+		if int64(w.buf.Len()) < w.minBytes {
+			return len(data), nil
+		}
+		if err := w.decide(); err != nil {
+			return 0, err
+		}
+		return len(data), nil
+	}
+	if w.gz != nil {
+		return w.gz.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *gzipResponseWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Written counts the body held back, so handlers don't write a second response
+func (w *gzipResponseWriter) Written() bool {
+	return w.buf.Len() > 0 || w.ResponseWriter.Written()
+}
+
+// Flush sends what is buffered, compressed if the response can be, so
+// streamed responses such as the export keep streaming
+func (w *gzipResponseWriter) Flush() {
+	if !w.decided {
+		if err := w.decide(); err != nil {
+			return
+		}
+	}
+	if w.gz != nil {
+		_ = w.gz.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+// decide starts compressing if the response allows it, and sends the
+// buffered body either way
+func (w *gzipResponseWriter) decide() error {
+	w.decided = true
+	if w.compressible() {
+		header := w.Header()
+		header.Set("Content-Encoding", "gzip")
+		header.Del("Content-Length")
+		w.gz = w.pool.Get().(*gzip.Writer)
+		w.gz.Reset(w.ResponseWriter)
+	}
+	data := w.buf.Bytes()
+	w.buf = bytes.Buffer{}
+	if w.gz != nil {
+		_, err := w.gz.Write(data)
+		return err
+	}
+	_, err := w.ResponseWriter.Write(data)
+	return err
+}
+
+// compressible reports whether the response may be gzipped: it has a body,
+// isn't encoded already and isn't of a compressed type
+func (w *gzipResponseWriter) compressible() bool {
+	switch status := w.Status(); {
+	case status < http.StatusOK, status == http.StatusNoContent, status == http.StatusNotModified, status == http.StatusPartialContent:
+		return false
+	}
+	if w.Header().Get("Content-Encoding") != "" {
+		return false
+	}
+	contentType := w.Header().Get("Content-Type")
+	for _, prefix := range incompressibleTypes {
+		if strings.HasPrefix(contentType, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// finish sends a body that stayed below minBytes as it is, or completes the
+// compressed one
+func (w *gzipResponseWriter) finish() {
+	if !w.decided {
+		w.decided = true
+		if w.buf.Len() > 0 {
+			_, _ = w.ResponseWriter.Write(w.buf.Bytes())
+		}
+		return
+	}
+	if w.gz != nil {
+		_ = w.gz.Close()
+		w.gz.Reset(io.Discard)
+		w.pool.Put(w.gz)
+	}
+}
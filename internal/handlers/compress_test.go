@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"Unit-Test/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// gunzip decompresses body
+func gunzip(t *testing.T, body []byte) string {
+	r, err := gzip.NewReader(bytes.NewReader(body))
+	require.NoError(t, err)
+	plain, err := io.ReadAll(r)
+	require.NoError(t, err)
+	return string(plain)
+}
+
+// getWithEncoding sends GET url through router with the given Accept-Encoding
+func getWithEncoding(router http.Handler, url, encoding string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", url, nil)
+	if encoding != "" {
+		req.Header.Set("Accept-Encoding", encoding)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestUsersListCompressed(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	for i := 1; i <= 50; i++ {
+		env.db.Create(&models.User{Name: "User " + strconv.Itoa(i), Email: "user" + strconv.Itoa(i) + "@example.com"})
+	}
+
+	plain := getWithEncoding(env.router, "/api/v1/users?limit=50", "")
+	assert.Equal(t, http.StatusOK, plain.Code)
+	assert.Empty(t, plain.Header().Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", plain.Header().Get("Vary"))
+
+	compressed := getWithEncoding(env.router, "/api/v1/users?limit=50", "br;q=1.0, gzip;q=0.8")
+	assert.Equal(t, http.StatusOK, compressed.Code)
+	assert.Equal(t, "gzip", compressed.Header().Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", compressed.Header().Get("Vary"))
+	assert.Less(t, compressed.Body.Len(), plain.Body.Len())
+	assert.JSONEq(t, plain.Body.String(), gunzip(t, compressed.Body.Bytes()))
+}
+
+func TestStreamedExportCompressed(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	for i := 1; i <= 3*exportBatchSize; i++ {
+		env.db.Create(&models.User{Name: "User " + strconv.Itoa(i), Email: "user" + strconv.Itoa(i) + "@example.com"})
+	}
+
+	plain := getWithEncoding(env.router, "/api/v1/users/export", "")
+	compressed := getWithEncoding(env.router, "/api/v1/users/export", "gzip")
+	assert.Equal(t, "gzip", compressed.Header().Get("Content-Encoding"))
+	assert.Equal(t, plain.Body.String(), gunzip(t, compressed.Body.Bytes()))
+}
+
+func TestCompressionSkips(t *testing.T) {
+	t.Parallel()
+	big := strings.Repeat("a", 4096)
+	r := gin.New()
+	r.Use(compressResponses(gzip.BestSpeed, 1024))
+	r.GET("/small", func(c *gin.Context) { c.String(http.StatusOK, "tiny") })
+	r.GET("/image", func(c *gin.Context) { c.Data(http.StatusOK, "image/png", []byte(big)) })
+	r.GET("/encoded", func(c *gin.Context) {
+		c.Header("Content-Encoding", "br")
+		c.Data(http.StatusOK, "text/plain", []byte(big))
+	})
+	r.GET("/empty", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	r.GET("/text", func(c *gin.Context) { c.String(http.StatusOK, big) })
+
+	for _, url := range []string{"/small", "/image", "/encoded", "/empty"} {
+		w := getWithEncoding(r, url, "gzip")
+		assert.NotEqual(t, "gzip", w.Header().Get("Content-Encoding"), url)
+		assert.Equal(t, "Accept-Encoding", w.Header().Get("Vary"), url)
+	}
+	w := getWithEncoding(r, "/small", "gzip")
+	assert.Equal(t, "tiny", w.Body.String())
+	w = getWithEncoding(r, "/image", "gzip")
+	assert.Equal(t, big, w.Body.String())
+
+	w = getWithEncoding(r, "/text", "gzip;q=0")
+	assert.Empty(t, w.Header().Get("Content-Encoding"))
+	w = getWithEncoding(r, "/text", "*")
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	assert.Equal(t, big, gunzip(t, w.Body.Bytes()))
+}
+
+func TestCompressedErrorResponse(t *testing.T) {
+	t.Parallel()
+	r := gin.New()
+	r.Use(compressResponses(gzip.DefaultCompression, 1), handleErrors)
+	r.GET("/fail", handle(func(c *gin.Context) error {
+		return validationError("something is wrong")
+	}))
+
+	w := getWithEncoding(r, "/fail", "gzip")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	assert.Contains(t, gunzip(t, w.Body.Bytes()), `"code":"VALIDATION_ERROR"`)
+}
+
+func TestAcceptsGzip(t *testing.T) {
+	t.Parallel()
+	tests := map[string]bool{
+		"":                  false,
+		"gzip":              true,
+		"GZIP":              true,
+		"deflate, gzip":     true,
+		"gzip;q=0.5":        true,
+		"gzip;q=0":          false,
+		"*":                 true,
+		"br, identity":      false,
+		" deflate ,  gzip ": true,
+	}
+	for header, want := range tests {
+		assert.Equal(t, want, acceptsGzip(header), header)
+	}
+}
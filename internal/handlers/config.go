@@ -0,0 +1,474 @@
+package handlers
+
+import (
+	"compress/gzip"
+	"fmt"
+	"log/slog"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"Unit-Test/internal/mail"
+	"Unit-Test/internal/storage"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Config is everything the service reads from its environment. Start from
+// defaultConfig; LoadConfig overlays the environment on it and validates the result.
+type Config struct {
+	// Server
+	Port             int           // PORT, 8000
+	ShutdownTimeout  time.Duration // SHUTDOWN_TIMEOUT, 15s to drain requests on SIGTERM
+	TrustedProxies   []string      // TRUSTED_PROXIES, comma-separated IPs or CIDRs; none by default
+	MaxBodyBytes     int64         // MAX_BODY_BYTES, 1MB
+	RequestTimeout   time.Duration // REQUEST_TIMEOUT, 10s; 0 disables it
+	ReadyMaxInFlight int64         // READY_MAX_IN_FLIGHT, 0 (off)
+	PprofEnabled     bool          // PPROF_ENABLED, false
+	TLSCertFile      string        // TLS_CERT_FILE, unset; with TLS_KEY_FILE the server speaks HTTPS
+	TLSKeyFile       string        // TLS_KEY_FILE, unset
+
+	// Connection limits, against clients holding connections open; 0 disables a timeout
+	ReadHeaderTimeout time.Duration // READ_HEADER_TIMEOUT, 5s
+	ReadTimeout       time.Duration // READ_TIMEOUT, 30s for the headers and body
+	WriteTimeout      time.Duration // WRITE_TIMEOUT, 60s from the end of the headers to the end of the response
+	IdleTimeout       time.Duration // IDLE_TIMEOUT, 120s between keep-alive requests
+	MaxHeaderBytes    int64         // MAX_HEADER_BYTES, 64KB
+
+	// Response compression
+	GzipLevel    int   // GZIP_LEVEL: 1 (fastest) to 9 (smallest), -1 for gzip's default (default); 0 turns compression off
+	GzipMinBytes int64 // GZIP_MIN_BYTES, 1KB; smaller responses are sent as they are
+
+	// Response cache of the user reads, emptied by every write
+	CacheEnabled    bool          // CACHE_ENABLED, true
+	CacheTTL        time.Duration // CACHE_TTL, 5s; how stale other instances' writes can leave a read
+	CacheMaxEntries int           // CACHE_MAX_ENTRIES, 1000 for the in-process cache
+	RedisURL        string        // REDIS_URL, unset; shares the cache between replicas through Redis
+
+	// Database and logging
+	DBDriver           string        // DB_DRIVER: postgres (default), sqlite or mysql
+	DatabaseURL        string        // DATABASE_URL, required; a file path for sqlite
+	DBConnectTimeout   time.Duration // DB_CONNECT_TIMEOUT, 30s of retries before startup fails
+	DBMaxOpenConns     int           // DB_MAX_OPEN_CONNS, 25; 0 means unlimited
+	DBMaxIdleConns     int           // DB_MAX_IDLE_CONNS, 10
+	DBConnMaxLifetime  time.Duration // DB_CONN_MAX_LIFETIME, 30m; 0 keeps connections forever
+	DBConnMaxIdleTime  time.Duration // DB_CONN_MAX_IDLE_TIME, 5m; 0 keeps idle connections forever
+	SlowQueryThreshold time.Duration // DB_SLOW_QUERY, 200ms; 0 disables slow query warnings
+	LogLevel           slog.Level    // LOG_LEVEL: debug, info (default), warn or error
+
+	// Authentication
+	JWTSecret           string        // JWT_SECRET, required
+	TokenTTL            time.Duration // JWT_TTL, 15m
+	RefreshTokenTTL     time.Duration // REFRESH_TOKEN_TTL, 720h
+	RequireAuthForReads bool          // AUTH_REQUIRED_FOR_READS, false
+	BasicAuthUser       string        // BASIC_AUTH_USER, unset
+	BasicAuthPassword   string        // BASIC_AUTH_PASSWORD, unset
+	LoginMaxFailures    int           // LOGIN_MAX_FAILURES, 5; 0 disables lockout
+	LoginFailureWindow  time.Duration // LOGIN_FAILURE_WINDOW, 15m
+	LoginLockout        time.Duration // LOGIN_LOCKOUT, 15m
+	BcryptCost          int           // BCRYPT_COST, 10; 4 to 31, each step doubling the time a password takes to hash
+
+	// Rate limiting and CORS
+	RateLimitRPS         float64  // RATE_LIMIT_RPS, 0 (off)
+	RateLimitBurst       int      // RATE_LIMIT_BURST, 20
+	CORSAllowedOrigins   []string // CORS_ALLOWED_ORIGINS, none; "*" allows every origin
+	CORSAllowedMethods   []string // CORS_ALLOWED_METHODS
+	CORSAllowedHeaders   []string // CORS_ALLOWED_HEADERS
+	CORSAllowCredentials bool     // CORS_ALLOW_CREDENTIALS, false
+
+	// Users API
+	DefaultPageSize     int    // DEFAULT_PAGE_SIZE, 20
+	MaxPageSize         int    // MAX_PAGE_SIZE, 100
+	AllowIncludeDeleted bool   // ALLOW_INCLUDE_DELETED, false
+	LenientJSON         bool   // LENIENT_JSON, false
+	AvatarDir           string // AVATAR_DIR, "avatars"
+	AvatarMaxBytes      int64  // AVATAR_MAX_BYTES, 2MB
+
+	// Webhook deliveries
+	WebhookMaxAttempts int           // WEBHOOK_MAX_ATTEMPTS, 5 tries of each delivery
+	WebhookBackoff     time.Duration // WEBHOOK_BACKOFF, 1s before the first retry, doubled for each after it
+	WebhookTimeout     time.Duration // WEBHOOK_TIMEOUT, 10s for each attempt
+	WebhookWorkers     int           // WEBHOOK_WORKERS, 4 deliveries sent at once
+
+	// Event bus
+	NATSURL    string // NATS_URL, unset; publishes user events to NATS JetStream
+	NATSStream string // NATS_STREAM, "USERS"; created if missing, taking the users.> subjects
+
+	// Purging deleted users
+	PurgeInterval  time.Duration // PURGE_INTERVAL, 1h between purges; 0 only purges through /admin/purge
+	PurgeRetention time.Duration // PURGE_RETENTION, 720h a deleted user is kept before it is purged
+	PurgeBatchSize int           // PURGE_BATCH_SIZE, 500 users deleted by each statement
+
+	// Email
+	SMTPHost     string // SMTP_HOST, unset; logs the emails instead of sending them
+	SMTPPort     int    // SMTP_PORT, 587
+	SMTPUsername string // SMTP_USERNAME, unset; authenticates with PLAIN when set
+	SMTPPassword string // SMTP_PASSWORD
+	SMTPFrom     string // SMTP_FROM, required with SMTP_HOST, e.g. "API <no-reply@example.com>"
+	SMTPTLS      string // SMTP_TLS, "starttls"; "tls" for implicit TLS, "none" for plain text
+
+	// GraphQL
+	GraphQLIntrospection bool // GRAPHQL_INTROSPECTION, false; lets clients query the schema
+
+	// API docs
+	SwaggerEnabled  bool   // ENABLE_SWAGGER, false; serves the Swagger UI and /openapi.json
+	SwaggerHost     string // SWAGGER_HOST, unset; where clients reach the API, e.g. api.example.com; the docs' own host when unset
+	SwaggerBasePath string // SWAGGER_BASE_PATH, unset; the path a proxy serves the API under, e.g. /users
+
+	// Security headers; an empty value drops the header
+	HeaderXContentTypeOptions     string // HEADER_X_CONTENT_TYPE_OPTIONS, "nosniff"
+	HeaderXFrameOptions           string // HEADER_X_FRAME_OPTIONS, "DENY"
+	HeaderReferrerPolicy          string // HEADER_REFERRER_POLICY, "no-referrer"
+	HeaderStrictTransportSecurity string // HEADER_STRICT_TRANSPORT_SECURITY, two years with subdomains
+}
+
+// defaultConfig returns the settings used for every variable left unset
+func defaultConfig() Config {
+	return Config{
+		Port:            8000,
+		ShutdownTimeout: 15 * time.Second,
+		MaxBodyBytes:    defaultMaxBodyBytes,
+		RequestTimeout:  10 * time.Second,
+
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       30 * time.Second,
+		WriteTimeout:      60 * time.Second,
+		IdleTimeout:       120 * time.Second,
+		MaxHeaderBytes:    64 << 10,
+
+		GzipLevel:    gzip.DefaultCompression,
+		GzipMinBytes: 1 << 10,
+
+		CacheEnabled:    true,
+		CacheTTL:        5 * time.Second,
+		CacheMaxEntries: 1000,
+
+		DBDriver:           storage.DriverPostgres,
+		DBConnectTimeout:   30 * time.Second,
+		DBMaxOpenConns:     25,
+		DBMaxIdleConns:     10,
+		DBConnMaxLifetime:  30 * time.Minute,
+		DBConnMaxIdleTime:  5 * time.Minute,
+		SlowQueryThreshold: 200 * time.Millisecond,
+		LogLevel:           slog.LevelInfo,
+
+		TokenTTL:           15 * time.Minute,
+		RefreshTokenTTL:    30 * 24 * time.Hour,
+		LoginMaxFailures:   5,
+		LoginFailureWindow: 15 * time.Minute,
+		LoginLockout:       15 * time.Minute,
+		BcryptCost:         bcrypt.DefaultCost,
+
+		RateLimitBurst:     20,
+		CORSAllowedMethods: []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE"},
+		CORSAllowedHeaders: []string{"Origin", "Content-Type", "Accept", "Authorization", "X-API-Key", "X-Request-ID", "If-Match", "If-None-Match"},
+
+		DefaultPageSize: 20,
+		MaxPageSize:     100,
+		AvatarDir:       "avatars",
+		AvatarMaxBytes:  defaultAvatarMaxBytes,
+
+		WebhookMaxAttempts: 5,
+		WebhookBackoff:     time.Second,
+		WebhookTimeout:     10 * time.Second,
+		WebhookWorkers:     4,
+
+		NATSStream: "USERS",
+
+		PurgeInterval:  time.Hour,
+		PurgeRetention: 30 * 24 * time.Hour,
+		PurgeBatchSize: 500,
+
+		SMTPPort: 587,
+		SMTPTLS:  mail.TLSStartTLS,
+
+		HeaderXContentTypeOptions:     "nosniff",
+		HeaderXFrameOptions:           "DENY",
+		HeaderReferrerPolicy:          "no-referrer",
+		HeaderStrictTransportSecurity: "max-age=63072000; includeSubDomains",
+	}
+}
+
+// ConfigError lists every problem found in the environment, so they can all
+// be fixed in one go
+type ConfigError struct {
+	Problems []string
+}
+
+func (e *ConfigError) Error() string {
+	return "invalid configuration:\n\t" + strings.Join(e.Problems, "\n\t")
+}
+
+// LoadConfig reads the environment through lookup (os.LookupEnv outside tests)
+// on top of defaultConfig. It returns a *ConfigError naming every variable
+// that is missing or invalid.
+func LoadConfig(lookup func(string) (string, bool)) (Config, error) {
+	cfg := defaultConfig()
+	env := &envReader{lookup: lookup}
+
+	env.int("PORT", &cfg.Port, 1, 65535)
+	env.duration("SHUTDOWN_TIMEOUT", &cfg.ShutdownTimeout, 1)
+	env.list("TRUSTED_PROXIES", &cfg.TrustedProxies)
+	env.bytes("MAX_BODY_BYTES", &cfg.MaxBodyBytes)
+	env.duration("REQUEST_TIMEOUT", &cfg.RequestTimeout, 0)
+	env.int64("READY_MAX_IN_FLIGHT", &cfg.ReadyMaxInFlight)
+	env.bool("PPROF_ENABLED", &cfg.PprofEnabled)
+	env.string("TLS_CERT_FILE", &cfg.TLSCertFile)
+	env.string("TLS_KEY_FILE", &cfg.TLSKeyFile)
+	env.duration("READ_HEADER_TIMEOUT", &cfg.ReadHeaderTimeout, 0)
+	env.duration("READ_TIMEOUT", &cfg.ReadTimeout, 0)
+	env.duration("WRITE_TIMEOUT", &cfg.WriteTimeout, 0)
+	env.duration("IDLE_TIMEOUT", &cfg.IdleTimeout, 0)
+	env.bytes("MAX_HEADER_BYTES", &cfg.MaxHeaderBytes)
+	env.int("GZIP_LEVEL", &cfg.GzipLevel, gzip.DefaultCompression, gzip.BestCompression)
+	env.bytes("GZIP_MIN_BYTES", &cfg.GzipMinBytes)
+	env.bool("CACHE_ENABLED", &cfg.CacheEnabled)
+	env.duration("CACHE_TTL", &cfg.CacheTTL, 1)
+	env.int("CACHE_MAX_ENTRIES", &cfg.CacheMaxEntries, 1, maxInt)
+	env.string("REDIS_URL", &cfg.RedisURL)
+
+	env.oneOf("DB_DRIVER", &cfg.DBDriver, storage.Drivers)
+	env.required("DATABASE_URL", &cfg.DatabaseURL)
+	env.duration("DB_CONNECT_TIMEOUT", &cfg.DBConnectTimeout, 0)
+	env.int("DB_MAX_OPEN_CONNS", &cfg.DBMaxOpenConns, 0, maxInt)
+	env.int("DB_MAX_IDLE_CONNS", &cfg.DBMaxIdleConns, 0, maxInt)
+	env.duration("DB_CONN_MAX_LIFETIME", &cfg.DBConnMaxLifetime, 0)
+	env.duration("DB_CONN_MAX_IDLE_TIME", &cfg.DBConnMaxIdleTime, 0)
+	env.duration("DB_SLOW_QUERY", &cfg.SlowQueryThreshold, 0)
+	env.logLevel("LOG_LEVEL", &cfg.LogLevel)
+
+	env.required("JWT_SECRET", &cfg.JWTSecret)
+	env.duration("JWT_TTL", &cfg.TokenTTL, 1)
+	env.duration("REFRESH_TOKEN_TTL", &cfg.RefreshTokenTTL, 1)
+	env.bool("AUTH_REQUIRED_FOR_READS", &cfg.RequireAuthForReads)
+	env.string("BASIC_AUTH_USER", &cfg.BasicAuthUser)
+	env.string("BASIC_AUTH_PASSWORD", &cfg.BasicAuthPassword)
+	env.int("LOGIN_MAX_FAILURES", &cfg.LoginMaxFailures, 0, maxInt)
+	env.duration("LOGIN_FAILURE_WINDOW", &cfg.LoginFailureWindow, 1)
+	env.duration("LOGIN_LOCKOUT", &cfg.LoginLockout, 1)
+	env.int("BCRYPT_COST", &cfg.BcryptCost, bcrypt.MinCost, bcrypt.MaxCost)
+
+	env.float("RATE_LIMIT_RPS", &cfg.RateLimitRPS)
+	env.int("RATE_LIMIT_BURST", &cfg.RateLimitBurst, 1, maxInt)
+	env.list("CORS_ALLOWED_ORIGINS", &cfg.CORSAllowedOrigins)
+	env.list("CORS_ALLOWED_METHODS", &cfg.CORSAllowedMethods)
+	env.list("CORS_ALLOWED_HEADERS", &cfg.CORSAllowedHeaders)
+	env.bool("CORS_ALLOW_CREDENTIALS", &cfg.CORSAllowCredentials)
+
+	env.int("DEFAULT_PAGE_SIZE", &cfg.DefaultPageSize, 1, maxInt)
+	env.int("MAX_PAGE_SIZE", &cfg.MaxPageSize, 1, maxInt)
+	env.bool("ALLOW_INCLUDE_DELETED", &cfg.AllowIncludeDeleted)
+	env.bool("LENIENT_JSON", &cfg.LenientJSON)
+	env.string("AVATAR_DIR", &cfg.AvatarDir)
+	env.bytes("AVATAR_MAX_BYTES", &cfg.AvatarMaxBytes)
+
+	env.int("WEBHOOK_MAX_ATTEMPTS", &cfg.WebhookMaxAttempts, 1, maxInt)
+	env.duration("WEBHOOK_BACKOFF", &cfg.WebhookBackoff, 1)
+	env.duration("WEBHOOK_TIMEOUT", &cfg.WebhookTimeout, 1)
+	env.int("WEBHOOK_WORKERS", &cfg.WebhookWorkers, 1, maxInt)
+
+	env.string("NATS_URL", &cfg.NATSURL)
+	env.string("NATS_STREAM", &cfg.NATSStream)
+
+	env.duration("PURGE_INTERVAL", &cfg.PurgeInterval, 0)
+	env.duration("PURGE_RETENTION", &cfg.PurgeRetention, 1)
+	env.int("PURGE_BATCH_SIZE", &cfg.PurgeBatchSize, 1, maxInt)
+
+	env.string("SMTP_HOST", &cfg.SMTPHost)
+	env.int("SMTP_PORT", &cfg.SMTPPort, 1, 65535)
+	env.string("SMTP_USERNAME", &cfg.SMTPUsername)
+	env.string("SMTP_PASSWORD", &cfg.SMTPPassword)
+	env.string("SMTP_FROM", &cfg.SMTPFrom)
+	env.oneOf("SMTP_TLS", &cfg.SMTPTLS, []string{mail.TLSStartTLS, mail.TLSImplicit, mail.TLSNone})
+
+	env.bool("GRAPHQL_INTROSPECTION", &cfg.GraphQLIntrospection)
+
+	env.bool("ENABLE_SWAGGER", &cfg.SwaggerEnabled)
+	env.string("SWAGGER_HOST", &cfg.SwaggerHost)
+	env.string("SWAGGER_BASE_PATH", &cfg.SwaggerBasePath)
+
+	env.string("HEADER_X_CONTENT_TYPE_OPTIONS", &cfg.HeaderXContentTypeOptions)
+	env.string("HEADER_X_FRAME_OPTIONS", &cfg.HeaderXFrameOptions)
+	env.string("HEADER_REFERRER_POLICY", &cfg.HeaderReferrerPolicy)
+	env.string("HEADER_STRICT_TRANSPORT_SECURITY", &cfg.HeaderStrictTransportSecurity)
+
+	// Rules spanning several variables
+	for _, proxy := range cfg.TrustedProxies {
+		if net.ParseIP(proxy) == nil {
+			if _, _, err := net.ParseCIDR(proxy); err != nil {
+				env.fail("TRUSTED_PROXIES entry %q is neither an IP nor a CIDR", proxy)
+			}
+		}
+	}
+	if cfg.WriteTimeout > 0 && cfg.RequestTimeout > 0 && cfg.WriteTimeout <= cfg.RequestTimeout {
+		// The connection would close before the handler could answer 504
+		env.fail("WRITE_TIMEOUT (%s) must exceed REQUEST_TIMEOUT (%s)", cfg.WriteTimeout, cfg.RequestTimeout)
+	}
+	if (cfg.TLSCertFile == "") != (cfg.TLSKeyFile == "") {
+		env.fail("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	if (cfg.BasicAuthUser == "") != (cfg.BasicAuthPassword == "") {
+		env.fail("BASIC_AUTH_USER and BASIC_AUTH_PASSWORD must be set together")
+	}
+	if cfg.DBMaxOpenConns > 0 && cfg.DBMaxIdleConns > cfg.DBMaxOpenConns {
+		env.fail("DB_MAX_IDLE_CONNS (%d) must not exceed DB_MAX_OPEN_CONNS (%d)", cfg.DBMaxIdleConns, cfg.DBMaxOpenConns)
+	}
+	if cfg.MaxPageSize < cfg.DefaultPageSize {
+		env.fail("MAX_PAGE_SIZE (%d) must not be below DEFAULT_PAGE_SIZE (%d)", cfg.MaxPageSize, cfg.DefaultPageSize)
+	}
+	if cfg.NATSURL != "" && cfg.NATSStream == "" {
+		env.fail("NATS_STREAM must be set when NATS_URL is")
+	}
+	if cfg.SMTPHost != "" && cfg.SMTPFrom == "" {
+		env.fail("SMTP_FROM must be set when SMTP_HOST is")
+	}
+	if strings.ContainsAny(cfg.SwaggerHost, "/?#") {
+		env.fail("SWAGGER_HOST must be a host such as api.example.com, without a scheme or path, got %q", cfg.SwaggerHost)
+	}
+	if cfg.SwaggerBasePath != "" && !strings.HasPrefix(cfg.SwaggerBasePath, "/") {
+		env.fail("SWAGGER_BASE_PATH must start with /, got %q", cfg.SwaggerBasePath)
+	}
+	if cfg.CORSAllowCredentials && slices.Contains(cfg.CORSAllowedOrigins, "*") {
+		env.fail("CORS_ALLOW_CREDENTIALS=true cannot be combined with the wildcard origin in CORS_ALLOWED_ORIGINS")
+	}
+
+	if len(env.problems) > 0 {
+		return cfg, &ConfigError{Problems: env.problems}
+	}
+	return cfg, nil
+}
+
+const maxInt = int(^uint(0) >> 1)
+
+// envReader parses environment variables into a Config, collecting a problem
+// for each invalid one instead of stopping at the first. Unset variables, and
+// empty ones other than strings, keep their default.
+type envReader struct {
+	lookup   func(string) (string, bool)
+	problems []string
+}
+
+func (r *envReader) fail(format string, args ...interface{}) {
+	r.problems = append(r.problems, fmt.Sprintf(format, args...))
+}
+
+// value returns key's value, or false when it is unset or empty
+func (r *envReader) value(key string) (string, bool) {
+	value, ok := r.lookup(key)
+	return value, ok && value != ""
+}
+
+func (r *envReader) string(key string, dst *string) {
+	if value, ok := r.lookup(key); ok {
+		*dst = value
+	}
+}
+
+func (r *envReader) required(key string, dst *string) {
+	r.string(key, dst)
+	if *dst == "" {
+		r.fail("%s must be set", key)
+	}
+}
+
+func (r *envReader) oneOf(key string, dst *string, choices []string) {
+	if value, ok := r.value(key); ok {
+		if !slices.Contains(choices, value) {
+			r.fail("%s must be one of %s, got %q", key, strings.Join(choices, ", "), value)
+			return
+		}
+		*dst = value
+	}
+}
+
+func (r *envReader) list(key string, dst *[]string) {
+	if value, ok := r.lookup(key); ok {
+		*dst = splitList(value)
+	}
+}
+
+func (r *envReader) bool(key string, dst *bool) {
+	if value, ok := r.value(key); ok {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			r.fail("%s must be true or false, got %q", key, value)
+			return
+		}
+		*dst = parsed
+	}
+}
+
+func (r *envReader) int(key string, dst *int, min, max int) {
+	if value, ok := r.value(key); ok {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < min || parsed > max {
+			if max == maxInt {
+				r.fail("%s must be an integer of at least %d, got %q", key, min, value)
+			} else {
+				r.fail("%s must be an integer between %d and %d, got %q", key, min, max, value)
+			}
+			return
+		}
+		*dst = parsed
+	}
+}
+
+func (r *envReader) int64(key string, dst *int64) {
+	if value, ok := r.value(key); ok {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || parsed < 0 {
+			r.fail("%s must be a non-negative integer, got %q", key, value)
+			return
+		}
+		*dst = parsed
+	}
+}
+
+func (r *envReader) bytes(key string, dst *int64) {
+	if value, ok := r.value(key); ok {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || parsed <= 0 {
+			r.fail("%s must be a positive number of bytes, got %q", key, value)
+			return
+		}
+		*dst = parsed
+	}
+}
+
+func (r *envReader) float(key string, dst *float64) {
+	if value, ok := r.value(key); ok {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil || parsed < 0 {
+			r.fail("%s must be a non-negative number, got %q", key, value)
+			return
+		}
+		*dst = parsed
+	}
+}
+
+// duration parses values such as "15m"; min is 0 or 1 for durations that must
+// be positive
+func (r *envReader) duration(key string, dst *time.Duration, min time.Duration) {
+	if value, ok := r.value(key); ok {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed < min {
+			kind := "a duration"
+			if min > 0 {
+				kind = "a positive duration"
+			}
+			r.fail("%s must be %s such as \"15m\", got %q", key, kind, value)
+			return
+		}
+		*dst = parsed
+	}
+}
+
+func (r *envReader) logLevel(key string, dst *slog.Level) {
+	if value, ok := r.value(key); ok {
+		if err := dst.UnmarshalText([]byte(value)); err != nil {
+			r.fail("%s must be debug, info, warn or error, got %q", key, value)
+		}
+	}
+}
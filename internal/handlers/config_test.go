@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// envMap is a lookup over a fixed environment
+func envMap(env map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		value, ok := env[key]
+		return value, ok
+	}
+}
+
+// requiredEnv holds the variables without a default
+func requiredEnv() map[string]string {
+	return map[string]string{
+		"DATABASE_URL": "postgres://localhost/app",
+		"JWT_SECRET":   "secret",
+	}
+}
+
+// configProblems returns the problems LoadConfig reports for env
+func configProblems(t *testing.T, env map[string]string) []string {
+	_, err := LoadConfig(envMap(env))
+	var configErr *ConfigError
+	if !assert.True(t, errors.As(err, &configErr), "expected a *ConfigError, got %v", err) {
+		return nil
+	}
+	return configErr.Problems
+}
+
+func TestLoadConfigDefaults(t *testing.T) {
+	t.Parallel()
+	cfg, err := LoadConfig(envMap(requiredEnv()))
+	assert.NoError(t, err)
+
+	expected := defaultConfig()
+	expected.DatabaseURL = "postgres://localhost/app"
+	expected.JWTSecret = "secret"
+	assert.Equal(t, expected, cfg)
+	assert.Equal(t, 8000, cfg.Port)
+	assert.Equal(t, 15*time.Second, cfg.ShutdownTimeout)
+	assert.Equal(t, slog.LevelInfo, cfg.LogLevel)
+	assert.Equal(t, "postgres", cfg.DBDriver)
+	assert.Equal(t, 5*time.Second, cfg.ReadHeaderTimeout)
+	assert.Equal(t, int64(64<<10), cfg.MaxHeaderBytes)
+	assert.Equal(t, "DENY", cfg.HeaderXFrameOptions)
+}
+
+func TestLoadConfigOverrides(t *testing.T) {
+	t.Parallel()
+	env := requiredEnv()
+	env["PORT"] = "9090"
+	env["LOG_LEVEL"] = "debug"
+	env["DB_DRIVER"] = "sqlite"
+	env["JWT_TTL"] = "30m"
+	env["BCRYPT_COST"] = "12"
+	env["RATE_LIMIT_RPS"] = "2.5"
+	env["AUTH_REQUIRED_FOR_READS"] = "true"
+	env["CORS_ALLOWED_ORIGINS"] = "https://a.example.com, https://b.example.com"
+	env["TRUSTED_PROXIES"] = "10.0.0.1,192.168.0.0/16"
+	env["HEADER_X_FRAME_OPTIONS"] = ""
+	// Empty non-string values keep their default
+	env["MAX_PAGE_SIZE"] = ""
+
+	cfg, err := LoadConfig(envMap(env))
+	assert.NoError(t, err)
+	assert.Equal(t, 9090, cfg.Port)
+	assert.Equal(t, slog.LevelDebug, cfg.LogLevel)
+	assert.Equal(t, "sqlite", cfg.DBDriver)
+	assert.Equal(t, 30*time.Minute, cfg.TokenTTL)
+	assert.Equal(t, 12, cfg.BcryptCost)
+	assert.Equal(t, 2.5, cfg.RateLimitRPS)
+	assert.True(t, cfg.RequireAuthForReads)
+	assert.Equal(t, []string{"https://a.example.com", "https://b.example.com"}, cfg.CORSAllowedOrigins)
+	assert.Equal(t, []string{"10.0.0.1", "192.168.0.0/16"}, cfg.TrustedProxies)
+	assert.Equal(t, "", cfg.HeaderXFrameOptions)
+	assert.Equal(t, 100, cfg.MaxPageSize)
+}
+
+func TestLoadConfigInvalidPort(t *testing.T) {
+	t.Parallel()
+	for _, port := range []string{"http", "0", "65536", "-1"} {
+		env := requiredEnv()
+		env["PORT"] = port
+		assert.Equal(t, []string{`PORT must be an integer between 1 and 65535, got "` + port + `"`}, configProblems(t, env))
+	}
+}
+
+func TestLoadConfigReportsEveryProblem(t *testing.T) {
+	t.Parallel()
+	_, err := LoadConfig(envMap(map[string]string{
+		"PORT":                    "abc",
+		"LOG_LEVEL":               "verbose",
+		"DB_DRIVER":               "oracle",
+		"JWT_TTL":                 "soon",
+		"BCRYPT_COST":             "3",
+		"RATE_LIMIT_RPS":          "-1",
+		"AUTH_REQUIRED_FOR_READS": "yes",
+		"BASIC_AUTH_USER":         "admin",
+		"TLS_KEY_FILE":            "server.key",
+		"WRITE_TIMEOUT":           "5s",
+		"TRUSTED_PROXIES":         "10.0.0.1,proxy.local",
+		"DEFAULT_PAGE_SIZE":       "50",
+		"MAX_PAGE_SIZE":           "10",
+		"SMTP_HOST":               "smtp.example.com",
+		"SMTP_TLS":                "ssl",
+		"SWAGGER_HOST":            "https://api.example.com",
+		"SWAGGER_BASE_PATH":       "users",
+		"CORS_ALLOWED_ORIGINS":    "*",
+		"CORS_ALLOW_CREDENTIALS":  "true",
+	}))
+
+	assert.EqualError(t, err, `invalid configuration:
+	PORT must be an integer between 1 and 65535, got "abc"
+	DB_DRIVER must be one of postgres, sqlite, mysql, got "oracle"
+	DATABASE_URL must be set
+	LOG_LEVEL must be debug, info, warn or error, got "verbose"
+	JWT_SECRET must be set
+	JWT_TTL must be a positive duration such as "15m", got "soon"
+	AUTH_REQUIRED_FOR_READS must be true or false, got "yes"
+	BCRYPT_COST must be an integer between 4 and 31, got "3"
+	RATE_LIMIT_RPS must be a non-negative number, got "-1"
+	SMTP_TLS must be one of starttls, tls, none, got "ssl"
+	TRUSTED_PROXIES entry "proxy.local" is neither an IP nor a CIDR
+	WRITE_TIMEOUT (5s) must exceed REQUEST_TIMEOUT (10s)
+	TLS_CERT_FILE and TLS_KEY_FILE must be set together
+	BASIC_AUTH_USER and BASIC_AUTH_PASSWORD must be set together
+	MAX_PAGE_SIZE (10) must not be below DEFAULT_PAGE_SIZE (50)
+	SMTP_FROM must be set when SMTP_HOST is
+	SWAGGER_HOST must be a host such as api.example.com, without a scheme or path, got "https://api.example.com"
+	SWAGGER_BASE_PATH must start with /, got "users"
+	CORS_ALLOW_CREDENTIALS=true cannot be combined with the wildcard origin in CORS_ALLOWED_ORIGINS`)
+}
+
+// Two servers built from different configurations answer each by its own
+func TestServersKeepTheirConfig(t *testing.T) {
+	t.Parallel()
+	cfg := testConfig()
+	cfg.HeaderReferrerPolicy = "same-origin"
+	cfg.ReadyMaxInFlight = 10
+	cfg.MaxPageSize = 30
+	cfg.LoginMaxFailures = 1
+	env := newTestEnvWith(t, Deps{Config: cfg})
+	other := newTestEnv(t)
+
+	assert.Len(t, env.server.checks, 3)
+	assert.Len(t, other.server.checks, 2)
+
+	w := send(env, "GET", "/api/v1/users", "")
+	assert.Equal(t, "same-origin", w.Header().Get("Referrer-Policy"))
+	assert.Equal(t, "30", w.Header().Get("X-Max-Page-Size"))
+	w = send(other, "GET", "/api/v1/users", "")
+	assert.Equal(t, "no-referrer", w.Header().Get("Referrer-Policy"))
+	assert.Equal(t, "100", w.Header().Get("X-Max-Page-Size"))
+
+	login := `{"email":"nobody@example.com","password":"wrong password"}`
+	send(env, "POST", "/api/v1/auth/login", login)
+	assert.Equal(t, http.StatusLocked, send(env, "POST", "/api/v1/auth/login", login).Code)
+	assert.Equal(t, http.StatusUnauthorized, send(other, "POST", "/api/v1/auth/login", login).Code)
+}
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+)
+
+// corsMiddleware builds the CORS handler for the Config.CORS* policy of cfg.
+// Cross-origin requests are refused while no origin is allowed; "*" allows
+// every origin. It fails on credentials combined with a wildcard origin,
+// which browsers refuse anyway.
+func corsMiddleware(cfg Config) (gin.HandlerFunc, error) {
+	if len(cfg.CORSAllowedOrigins) == 0 {
+		return func(c *gin.Context) { c.Next() }, nil
+	}
+
+	config := cors.Config{
+		AllowMethods:     cfg.CORSAllowedMethods,
+		AllowHeaders:     cfg.CORSAllowedHeaders,
+		AllowCredentials: cfg.CORSAllowCredentials,
+	}
+	for _, origin := range cfg.CORSAllowedOrigins {
+		if origin == "*" {
+			config.AllowAllOrigins = true
+		}
+	}
+	if config.AllowAllOrigins {
+		if cfg.CORSAllowCredentials {
+			return nil, errors.New("CORS_ALLOW_CREDENTIALS=true cannot be combined with the wildcard origin in CORS_ALLOWED_ORIGINS")
+		}
+	} else {
+		config.AllowOrigins = cfg.CORSAllowedOrigins
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return cors.New(config), nil
+}
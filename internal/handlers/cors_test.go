@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// corsConfig is testConfig with the given CORS policy
+func corsConfig(origins []string, credentials bool) Config {
+	cfg := testConfig()
+	cfg.CORSAllowedOrigins, cfg.CORSAllowCredentials = origins, credentials
+	return cfg
+}
+
+// preflight sends a CORS preflight for a POST to /api/v1/users from origin,
+// answered under the policy of cfg
+func preflight(t *testing.T, cfg Config, origin string) *httptest.ResponseRecorder {
+	handler, err := corsMiddleware(cfg)
+	assert.NoError(t, err)
+	r := gin.New()
+	r.Use(handler)
+	r.POST("/api/v1/users", func(c *gin.Context) { c.Status(201) })
+
+	req, _ := http.NewRequest("OPTIONS", "/api/v1/users", nil)
+	req.Header.Set("Origin", origin)
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	req.Header.Set("Access-Control-Request-Headers", "Content-Type, Authorization")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestCORSAllowedOrigin(t *testing.T) {
+	t.Parallel()
+	cfg := corsConfig([]string{"https://app.example.com", "https://admin.example.com"}, true)
+
+	w := preflight(t, cfg, "https://admin.example.com")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "https://admin.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
+	assert.Contains(t, w.Header().Get("Access-Control-Allow-Methods"), "POST")
+}
+
+func TestCORSDisallowedOrigin(t *testing.T) {
+	t.Parallel()
+	cfg := corsConfig([]string{"https://app.example.com"}, false)
+
+	w := preflight(t, cfg, "https://evil.example.com")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestCORSWildcardOrigin(t *testing.T) {
+	t.Parallel()
+	cfg := corsConfig([]string{"*"}, false)
+
+	w := preflight(t, cfg, "https://anywhere.example.com")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestCORSUnconfiguredAllowsNoOrigin(t *testing.T) {
+	t.Parallel()
+	cfg := corsConfig(nil, false)
+
+	w := preflight(t, cfg, "https://app.example.com")
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestCORSWildcardWithCredentialsFails(t *testing.T) {
+	t.Parallel()
+	_, err := corsMiddleware(corsConfig([]string{"https://app.example.com", "*"}, true))
+	assert.ErrorContains(t, err, "wildcard")
+}
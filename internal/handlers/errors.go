@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"runtime"
+	"strings"
+
+	"Unit-Test/internal/models"
+	"Unit-Test/internal/storage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"gorm.io/gorm"
+)
+
+// Machine-readable error codes carried in ErrorResponse.Code.
+// Clients should branch on these rather than on the message text.
+const (
+	CodeValidation           = "VALIDATION_ERROR"
+	CodeUserNotFound         = "USER_NOT_FOUND"
+	CodeAddressNotFound      = "ADDRESS_NOT_FOUND"
+	CodePostNotFound         = "POST_NOT_FOUND"
+	CodeAPIKeyNotFound       = "API_KEY_NOT_FOUND"
+	CodeWebhookNotFound      = "WEBHOOK_NOT_FOUND"
+	CodeAvatarNotFound       = "AVATAR_NOT_FOUND"
+	CodeUserNotDeleted       = "USER_NOT_DELETED"
+	CodeDuplicateEmail       = "DUPLICATE_EMAIL"
+	CodeVersionConflict      = "VERSION_CONFLICT"
+	CodePreconditionRequired = "PRECONDITION_REQUIRED"
+	CodeUnauthorized         = "UNAUTHORIZED"
+	CodeForbidden            = "FORBIDDEN"
+	CodeNotAcceptable        = "NOT_ACCEPTABLE"
+	CodePayloadTooLarge      = "PAYLOAD_TOO_LARGE"
+	CodeRateLimited          = "RATE_LIMITED"
+	CodeAccountLocked        = "ACCOUNT_LOCKED"
+	CodeUnsupportedMediaType = "UNSUPPORTED_MEDIA_TYPE"
+	CodeNotFound             = "NOT_FOUND"
+	CodeConflict             = "CONFLICT"
+	CodeTimeout              = "TIMEOUT"
+	CodeClientClosedRequest  = "CLIENT_CLOSED_REQUEST"
+	CodeUpgradeRequired      = "UPGRADE_REQUIRED"
+	CodeUnavailable          = "UNAVAILABLE"
+	CodeInternal             = "INTERNAL"
+)
+
+// StatusClientClosedRequest is nginx's status for a request whose client went
+// away before the answer; the client never sees it, but logs and metrics do
+const StatusClientClosedRequest = 499
+
+// APIError is an error with the status, code and message the client should
+// see. Err is the underlying cause, if any, and is never shown to the client.
+type APIError struct {
+	Status  int
+	Code    string
+	Message string
+	Err     error
+}
+
+func (e *APIError) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+// newAPIError describes a failure to the client
+func newAPIError(status int, code, message string) *APIError {
+	return &APIError{Status: status, Code: code, Message: message}
+}
+
+// validationError is a 400 for input that is wrong in a way binding can't tell
+func validationError(message string) *APIError {
+	return newAPIError(http.StatusBadRequest, CodeValidation, message)
+}
+
+// notFoundAs gives a missing record its resource-specific code and message.
+// Other errors pass through unchanged, so a failing database stays a 500.
+func notFoundAs(err error, code, message string) error {
+	if isNotFound(err) {
+		return &APIError{Status: http.StatusNotFound, Code: code, Message: message, Err: err}
+	}
+	return err
+}
+
+// conflictAs gives a unique violation its resource-specific code and message.
+// Other errors pass through unchanged.
+func conflictAs(err error, code, message string) error {
+	if isDuplicate(err) {
+		return &APIError{Status: http.StatusConflict, Code: code, Message: message, Err: err}
+	}
+	return err
+}
+
+// isNotFound reports a missing record, whether GORM or a repository says so
+func isNotFound(err error) bool {
+	return errors.Is(err, gorm.ErrRecordNotFound) || errors.Is(err, storage.ErrNotFound)
+}
+
+// isDuplicate reports a unique violation, whether GORM or a repository says so
+func isDuplicate(err error) bool {
+	return errors.Is(err, gorm.ErrDuplicatedKey) || errors.Is(err, storage.ErrDuplicateEmail)
+}
+
+// bindingError marks a failure to bind the request body
+type bindingError struct {
+	err error
+}
+
+func (e bindingError) Error() string {
+	return e.err.Error()
+}
+
+func (e bindingError) Unwrap() error {
+	return e.err
+}
+
+// invalidInput marks err as a failure to bind the request body
+func invalidInput(err error) error {
+	return bindingError{err: err}
+}
+
+// handle adapts a handler that returns its failure instead of writing it.
+// The error is left on the context for handleErrors to answer.
+func handle(h func(c *gin.Context) error) gin.HandlerFunc {
+	// Method values are named with a "-fm" suffix
+	name := strings.TrimSuffix(runtime.FuncForPC(reflect.ValueOf(h).Pointer()).Name(), "-fm")
+	return func(c *gin.Context) {
+		if err := h(c); err != nil {
+			// Checked here, while the request's context is still the handler's
+			err = contextError(c, err)
+			logHandlerError(c, name, err)
+			_ = c.Error(err)
+			c.Abort()
+		}
+	}
+}
+
+// handleErrors answers the last error a handler left on the context, unless
+// a response has already been written
+func handleErrors(c *gin.Context) {
+	c.Next()
+	if len(c.Errors) == 0 || c.Writer.Written() {
+		return
+	}
+	err := c.Errors.Last().Err
+	status, resp := errorResponse(err)
+	logFailure(c, status, err)
+	// A HEAD response has no body to describe the error in
+	if c.Request.Method == http.MethodHead {
+		c.Status(status)
+		return
+	}
+	resp.RequestID = requestID(c)
+	render(c, c.GetString(errorFormatKey), status, resp)
+}
+
+// errorFormatKey holds the format a handler negotiated, which its errors are
+// answered in too
+const errorFormatKey = "error_format"
+
+// negotiateFormat picks the response format the Accept header allows, and
+// has handleErrors answer in it as well
+func negotiateFormat(c *gin.Context) (string, error) {
+	format := c.NegotiateFormat(offeredFormats...)
+	if format == "" {
+		return "", newAPIError(http.StatusNotAcceptable, CodeNotAcceptable, "Accept must allow application/json or application/xml")
+	}
+	c.Set(errorFormatKey, format)
+	return format, nil
+}
+
+// errorResponse is the one mapping from handler errors to responses. Anything
+// it doesn't recognize is a 500 that reveals nothing of the cause.
+func errorResponse(err error) (int, models.ErrorResponse) {
+	var apiErr *APIError
+	var bindErr bindingError
+	var verrs validator.ValidationErrors
+	switch {
+	case errors.As(err, &apiErr):
+		return apiErr.Status, models.ErrorResponse{Code: apiErr.Code, Message: apiErr.Message}
+	case isBodyTooLarge(err):
+		return http.StatusRequestEntityTooLarge, models.ErrorResponse{Code: CodePayloadTooLarge, Message: bodyTooLargeMessage(err)}
+	case errors.As(err, &bindErr), errors.As(err, &verrs):
+		return http.StatusBadRequest, bindingErrorResponse(err)
+	case isNotFound(err):
+		return http.StatusNotFound, models.ErrorResponse{Code: CodeNotFound, Message: "Resource not found"}
+	case isDuplicate(err):
+		return http.StatusConflict, models.ErrorResponse{Code: CodeConflict, Message: "Resource already exists"}
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout, models.ErrorResponse{Code: CodeTimeout, Message: "Request timed out"}
+	case errors.Is(err, context.Canceled):
+		return StatusClientClosedRequest, models.ErrorResponse{Code: CodeClientClosedRequest, Message: "Client closed request"}
+	}
+	return http.StatusInternalServerError, models.ErrorResponse{Code: CodeInternal, Message: "Internal server error"}
+}
+
+// logFailure logs the cause of a server error, which its response never shows.
+// Every 5xx a handler answers is logged here, once.
+func logFailure(c *gin.Context, status int, err error) {
+	if status >= http.StatusInternalServerError {
+		requestLog(c).Error("request failed", "method", c.Request.Method, "route", c.FullPath(), "error", err.Error())
+	}
+}
+
+// contextError attributes err to the request's context once that is done.
+// Drivers don't all wrap the context's error in the ones they return, so a
+// query cut short by a timeout could otherwise pass for a database failure.
+func contextError(c *gin.Context, err error) error {
+	if ctxErr := c.Request.Context().Err(); ctxErr != nil && !errors.Is(err, ctxErr) {
+		return fmt.Errorf("%w: %w", ctxErr, err)
+	}
+	return err
+}
+
+// respondFailure logs an unexpected err and writes a 500 with message, unless
+// the request timed out or its client went away, which errorResponse answers
+func respondFailure(c *gin.Context, err error, message string) {
+	err = contextError(c, err)
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		status, resp := errorResponse(err)
+		logFailure(c, status, err)
+		resp.RequestID = requestID(c)
+		c.JSON(status, resp)
+		return
+	}
+	logFailure(c, http.StatusInternalServerError, err)
+	respondError(c, http.StatusInternalServerError, CodeInternal, message)
+}
+
+// newErrorResponse builds an error body tagged with the current request's id
+func newErrorResponse(c *gin.Context, code, message string) models.ErrorResponse {
+	return models.ErrorResponse{Code: code, Message: message, RequestID: requestID(c)}
+}
+
+// respondError writes a JSON error response
+func respondError(c *gin.Context, status int, code, message string) {
+	c.JSON(status, newErrorResponse(c, code, message))
+}
@@ -0,0 +1,383 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"Unit-Test/internal/models"
+	"Unit-Test/internal/testsupport"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+// seedErrorCases creates an active user with an address and a post, a second
+// active user and a soft-deleted one
+func seedErrorCases(env *testEnv) {
+	env.db.Create(&models.User{Name: "Alice", Email: "alice@example.com"})
+	env.db.Create(&models.User{Name: "Bob", Email: "bob@example.com"})
+	deleted := models.User{Name: "Carol", Email: "carol@example.com"}
+	env.db.Create(&deleted)
+	env.db.Delete(&deleted)
+	env.db.Create(&models.Address{UserID: 1, Street: "1 Main St", City: "Springfield", Country: "US"})
+	env.db.Create(&models.Post{UserID: 1, Title: "Hello", Body: "First post"})
+}
+
+func TestErrorCodes(t *testing.T) {
+	t.Parallel()
+	cfg := testConfig()
+	cfg.AllowIncludeDeleted = true
+	env := newTestEnvWith(t, Deps{Config: cfg})
+
+	tests := []struct {
+		name    string
+		method  string
+		url     string
+		body    string
+		headers map[string]string
+		status  int
+		code    string
+	}{
+		{"list not acceptable", "GET", "/api/v1/users", "", map[string]string{"Accept": "text/plain"}, 406, CodeNotAcceptable},
+		{"list bad page", "GET", "/api/v1/users?page=0", "", nil, 400, CodeValidation},
+		{"list bad sort", "GET", "/api/v1/users?sort=password", "", nil, 400, CodeValidation},
+		{"list sort with cursor", "GET", "/api/v1/users?sort=name&cursor=0", "", nil, 400, CodeValidation},
+		{"list bad ids", "GET", "/api/v1/users?ids=a", "", nil, 400, CodeValidation},
+		{"list bad fields", "GET", "/api/v1/users?fields=password", "", nil, 400, CodeValidation},
+		{"list bad include", "GET", "/api/v1/users?include=comments", "", nil, 400, CodeValidation},
+		{"list include_deleted without admin", "GET", "/api/v1/users?include_deleted=true", "", map[string]string{"Authorization": bearerFor("2")}, 403, CodeForbidden},
+		{"list envelope with cursor", "GET", "/api/v1/users?envelope=true&cursor=0", "", nil, 400, CodeValidation},
+		{"search short query", "GET", "/api/v1/users/search?q=a", "", nil, 400, CodeValidation},
+		{"search with cursor", "GET", "/api/v1/users/search?q=alice&cursor=0", "", nil, 400, CodeValidation},
+		{"get not acceptable", "GET", "/api/v1/users/1", "", map[string]string{"Accept": "text/plain"}, 406, CodeNotAcceptable},
+		{"get bad id", "GET", "/api/v1/users/abc", "", nil, 400, CodeValidation},
+		{"get bad fields", "GET", "/api/v1/users/1?fields=password", "", nil, 400, CodeValidation},
+		{"get not found", "GET", "/api/v1/users/99", "", nil, 404, CodeUserNotFound},
+		{"get deleted", "GET", "/api/v1/users/3", "", nil, 404, CodeUserNotFound},
+		{"get by email invalid", "GET", "/api/v1/users/by-email/not-an-email", "", nil, 400, CodeValidation},
+		{"get by email not found", "GET", "/api/v1/users/by-email/nobody@example.com", "", nil, 404, CodeUserNotFound},
+		{"create invalid", "POST", "/api/v1/users", `{"name":"","email":"x"}`, nil, 400, CodeValidation},
+		{"create malformed", "POST", "/api/v1/users", `{"name":`, nil, 400, CodeValidation},
+		{"create duplicate email", "POST", "/api/v1/users", `{"name":"Al","email":"alice@example.com"}`, nil, 409, CodeDuplicateEmail},
+		{"bulk empty", "POST", "/api/v1/users/bulk", `[]`, nil, 400, CodeValidation},
+		{"import missing header", "POST", "/api/v1/users/import", "a,b\n", map[string]string{"Content-Type": "text/csv"}, 400, CodeValidation},
+		{"update bad id", "PUT", "/api/v1/users/0", `{}`, nil, 400, CodeValidation},
+		{"update not found", "PUT", "/api/v1/users/99", `{"name":"A","email":"a@example.com","version":1}`, nil, 404, CodeUserNotFound},
+		{"update invalid", "PUT", "/api/v1/users/1", `{"name":"A","email":"x","version":1}`, nil, 400, CodeValidation},
+		{"update without version", "PUT", "/api/v1/users/1", `{"name":"A","email":"a@example.com"}`, nil, 428, CodePreconditionRequired},
+		{"update stale version", "PUT", "/api/v1/users/1", `{"name":"A","email":"a@example.com","version":7}`, nil, 409, CodeVersionConflict},
+		{"update duplicate email", "PUT", "/api/v1/users/1", `{"name":"A","email":"bob@example.com","version":1}`, nil, 409, CodeDuplicateEmail},
+		{"patch bad id", "PATCH", "/api/v1/users/x", `{}`, nil, 400, CodeValidation},
+		{"patch not found", "PATCH", "/api/v1/users/99", `{"name":"A","version":1}`, nil, 404, CodeUserNotFound},
+		{"patch id", "PATCH", "/api/v1/users/1", `{"id":5,"version":1}`, nil, 400, CodeValidation},
+		{"patch empty name", "PATCH", "/api/v1/users/1", `{"name":"","version":1}`, nil, 400, CodeValidation},
+		{"patch without version", "PATCH", "/api/v1/users/1", `{"name":"A"}`, nil, 428, CodePreconditionRequired},
+		{"patch stale version", "PATCH", "/api/v1/users/1", `{"name":"A","version":7}`, nil, 409, CodeVersionConflict},
+		{"patch duplicate email", "PATCH", "/api/v1/users/1", `{"email":"bob@example.com","version":1}`, nil, 409, CodeDuplicateEmail},
+		{"upsert invalid email", "PUT", "/api/v1/users/by-email/not-an-email", `{"name":"A"}`, nil, 400, CodeValidation},
+		{"upsert invalid body", "PUT", "/api/v1/users/by-email/new@example.com", `{}`, nil, 400, CodeValidation},
+		{"delete bad id", "DELETE", "/api/v1/users/-1", "", nil, 400, CodeValidation},
+		{"delete not found", "DELETE", "/api/v1/users/99", "", nil, 404, CodeUserNotFound},
+		{"restore bad id", "POST", "/api/v1/users/x/restore", "", nil, 400, CodeValidation},
+		{"restore not found", "POST", "/api/v1/users/99/restore", "", nil, 404, CodeUserNotFound},
+		{"restore active user", "POST", "/api/v1/users/1/restore", "", nil, 400, CodeUserNotDeleted},
+		{"upload avatar not found", "PUT", "/api/v1/users/99/avatar", "", nil, 404, CodeUserNotFound},
+		{"upload avatar missing file", "PUT", "/api/v1/users/1/avatar", "", nil, 400, CodeValidation},
+		{"get avatar unset", "GET", "/api/v1/users/1/avatar", "", nil, 404, CodeAvatarNotFound},
+		{"addresses unknown user", "GET", "/api/v1/users/99/addresses", "", nil, 404, CodeUserNotFound},
+		{"create address invalid", "POST", "/api/v1/users/1/addresses", `{}`, nil, 400, CodeValidation},
+		{"update address bad id", "PUT", "/api/v1/users/1/addresses/x", `{}`, nil, 400, CodeValidation},
+		{"update address of other user", "PUT", "/api/v1/users/2/addresses/1", `{"street":"s","city":"c","country":"US"}`, nil, 404, CodeAddressNotFound},
+		{"delete address not found", "DELETE", "/api/v1/users/1/addresses/99", "", nil, 404, CodeAddressNotFound},
+		{"posts unknown user", "GET", "/api/v1/users/99/posts", "", nil, 404, CodeUserNotFound},
+		{"create post invalid", "POST", "/api/v1/users/1/posts", `{"title":"t"}`, nil, 400, CodeValidation},
+		{"get post bad id", "GET", "/api/v1/users/1/posts/0", "", nil, 400, CodeValidation},
+		{"get post of other user", "GET", "/api/v1/users/2/posts/1", "", nil, 404, CodePostNotFound},
+		{"preferences unknown user", "GET", "/api/v1/users/99/preferences", "", nil, 404, CodeUserNotFound},
+		{"preferences not an object", "PATCH", "/api/v1/users/1/preferences", `[1]`, nil, 400, CodeValidation},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seedErrorCases(env)
+
+			req, _ := http.NewRequest(tt.method, tt.url, bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			env.router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.status, w.Code)
+			var resp models.ErrorResponse
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Equal(t, tt.code, resp.Code)
+			assert.NotEmpty(t, resp.Message)
+		})
+	}
+}
+
+func TestErrorResponseEchoesRequestID(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	req, _ := http.NewRequest("GET", "/api/v1/users/1", nil)
+	req.Header.Set("X-Request-ID", "req-123")
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.JSONEq(t, `{"code":"USER_NOT_FOUND","message":"User not found","request_id":"req-123"}`, w.Body.String())
+}
+
+// failTable makes every query and insert on table fail with err until the test ends
+func failTable(t *testing.T, env *testEnv, table string, err error) {
+	inject := func(tx *gorm.DB) {
+		if tx.Statement.Table == table {
+			_ = tx.AddError(err)
+		}
+	}
+	name := "test:fail_" + table
+	_ = env.db.Callback().Query().Before("gorm:query").Register(name, inject)
+	_ = env.db.Callback().Create().Before("gorm:create").Register(name, inject)
+	t.Cleanup(func() {
+		_ = env.db.Callback().Query().Remove(name)
+		_ = env.db.Callback().Create().Remove(name)
+	})
+}
+
+func TestErrorMapping(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	tests := []struct {
+		name    string
+		method  string
+		url     string
+		body    string
+		table   string
+		failing error
+		status  int
+		code    string
+	}{
+		{"record not found", "GET", "/api/v1/users/1/addresses", "", "addresses", gorm.ErrRecordNotFound, 404, CodeNotFound},
+		{"unique violation", "POST", "/api/v1/users/1/posts", `{"title":"t","body":"b"}`, "posts", gorm.ErrDuplicatedKey, 409, CodeConflict},
+		{"deadline exceeded", "GET", "/api/v1/users/1/posts", "", "posts", context.DeadlineExceeded, 504, CodeTimeout},
+		{"client gone", "GET", "/api/v1/users/1/posts", "", "posts", context.Canceled, StatusClientClosedRequest, CodeClientClosedRequest},
+		{"database failure", "GET", "/api/v1/users/1/api-keys", "", "api_keys", errors.New("connection refused"), 500, CodeInternal},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seedErrorCases(env)
+			failTable(t, env, tt.table, tt.failing)
+
+			req, _ := http.NewRequest(tt.method, tt.url, bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("X-Request-ID", "req-mapping")
+			w := httptest.NewRecorder()
+			env.router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.status, w.Code)
+			var resp models.ErrorResponse
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Equal(t, tt.code, resp.Code)
+			assert.Equal(t, "req-mapping", resp.RequestID)
+		})
+	}
+}
+
+func TestDatabaseFailureIsNotReportedAsNotFound(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	seedErrorCases(env)
+	failTable(t, env, "users", errors.New("connection refused"))
+
+	w := send(env, "GET", "/api/v1/users/1/addresses", "")
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	// The cause stays in the log
+	assert.NotContains(t, w.Body.String(), "connection refused")
+	assert.Contains(t, w.Body.String(), `"code":"INTERNAL"`)
+}
+
+func TestValidationErrorThroughMiddleware(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	seedErrorCases(env)
+
+	w := send(env, "POST", "/api/v1/users/1/addresses", `{"street":"1 Main St"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	var resp models.ErrorResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, CodeValidation, resp.Code)
+	assert.ElementsMatch(t, []models.FieldError{{Field: "city", Error: "is required"}, {Field: "country", Error: "is required"}}, resp.Errors)
+	assert.NotEmpty(t, resp.RequestID)
+}
+
+// breakDatabase makes every statement on env's database fail with err, as if
+// the database had gone away, until the test ends
+func breakDatabase(t *testing.T, env *testEnv, err error) {
+	inject := func(tx *gorm.DB) { _ = tx.AddError(err) }
+	const name = "test:database_down"
+	callbacks := env.db.Callback()
+	_ = callbacks.Query().Before("gorm:query").Register(name, inject)
+	_ = callbacks.Create().Before("gorm:create").Register(name, inject)
+	_ = callbacks.Update().Before("gorm:update").Register(name, inject)
+	_ = callbacks.Delete().Before("gorm:delete").Register(name, inject)
+	_ = callbacks.Row().Before("gorm:row").Register(name, inject)
+	_ = callbacks.Raw().Before("gorm:raw").Register(name, inject)
+	t.Cleanup(func() {
+		_ = callbacks.Query().Remove(name)
+		_ = callbacks.Create().Remove(name)
+		_ = callbacks.Update().Remove(name)
+		_ = callbacks.Delete().Remove(name)
+		_ = callbacks.Row().Remove(name)
+		_ = callbacks.Raw().Remove(name)
+	})
+}
+
+// An outage answers every handler with a 500 that hides its cause, carries
+// the request id and is logged once. Sequential: it captures the logs.
+func TestDatabaseOutage(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		method string
+		url    string
+		body   string
+	}{
+		{"GET", "/api/v1/users", ""},
+		{"GET", "/api/v2/users", ""},
+		{"GET", "/api/v1/users/1", ""},
+		{"GET", "/api/v1/users/count", ""},
+		{"GET", "/api/v1/users/search?q=al", ""},
+		{"GET", "/api/v1/users/export", ""},
+		{"GET", "/api/v1/users/stream", ""},
+		{"GET", "/api/v1/users/by-email/alice@example.com", ""},
+		{"POST", "/api/v1/users", `{"name":"Carol","email":"carol@example.com"}`},
+		{"POST", "/api/v1/users/bulk", `[{"name":"Carol","email":"carol@example.com"}]`},
+		{"POST", "/api/v1/users/import", "name,email\nCarol,carol@example.com\n"},
+		{"PUT", "/api/v1/users/1", `{"name":"Alice","email":"alice@example.com","version":1}`},
+		{"PATCH", "/api/v1/users/1", `{"name":"Alicia","version":1}`},
+		{"PUT", "/api/v1/users/by-email/carol@example.com", `{"name":"Carol"}`},
+		{"DELETE", "/api/v1/users/1", ""},
+		{"POST", "/api/v1/users/1/restore", ""},
+		{"GET", "/api/v1/users/1/avatar", ""},
+		{"PUT", "/api/v1/users/1/avatar", ""},
+		{"GET", "/api/v1/users/1/preferences", ""},
+		{"PATCH", "/api/v1/users/1/preferences", `{"theme":"dark"}`},
+		{"GET", "/api/v1/users/1/addresses", ""},
+		{"POST", "/api/v1/users/1/addresses", `{"street":"1 Main St","city":"Springfield","country":"US"}`},
+		{"PUT", "/api/v1/users/1/addresses/1", `{"street":"2 Main St","city":"Springfield","country":"US"}`},
+		{"DELETE", "/api/v1/users/1/addresses/1", ""},
+		{"GET", "/api/v1/users/1/posts", ""},
+		{"POST", "/api/v1/users/1/posts", `{"title":"Hello","body":"First post"}`},
+		{"GET", "/api/v1/users/1/posts/1", ""},
+		{"PUT", "/api/v1/users/1/posts/1", `{"title":"Hello again","body":"Edited"}`},
+		{"DELETE", "/api/v1/users/1/posts/1", ""},
+		{"GET", "/api/v1/users/1/audit", ""},
+		{"GET", "/api/v1/users/1/api-keys", ""},
+		{"POST", "/api/v1/users/1/api-keys", `{"label":"ci"}`},
+		{"DELETE", "/api/v1/users/1/api-keys/1", ""},
+		{"POST", "/api/v1/users/1/password", `{"current_password":"x","new_password":"long enough password"}`},
+		{"POST", "/api/v1/auth/register", `{"name":"Carol","email":"carol@example.com","password":"long enough password"}`},
+		{"POST", "/api/v1/auth/login", `{"email":"alice@example.com","password":"long enough password"}`},
+		{"POST", "/api/v1/auth/refresh", `{"refresh_token":"token"}`},
+		{"POST", "/api/v1/auth/logout", `{"refresh_token":"token"}`},
+		{"POST", "/api/v1/auth/reset", `{"token":"token","new_password":"long enough password"}`},
+		{"POST", "/api/v1/auth/verify", `{"token":"token"}`},
+		{"GET", "/api/v1/webhooks", ""},
+		{"POST", "/api/v1/webhooks", `{"url":"https://example.com/hook","events":["user.created"]}`},
+		{"GET", "/api/v1/webhooks/1", ""},
+		{"PUT", "/api/v1/webhooks/1", `{"url":"https://example.com/hook","events":["user.created"]}`},
+		{"DELETE", "/api/v1/webhooks/1", ""},
+		{"POST", "/api/v1/admin/purge", ""},
+	}
+
+	users := testsupport.NewFakeUserRepository()
+	logger, logs := captureLogs(slog.LevelDebug)
+	env := newTestEnvWith(t, Deps{Users: users, Logger: logger})
+	users.FailWith(errDatabaseDown)
+	breakDatabase(t, env, errDatabaseDown)
+
+	// send makes the request with id, returning the response and the logs it left
+	send := func(t *testing.T, method, url, body, id string) (*httptest.ResponseRecorder, *bytes.Buffer) {
+		logs.Reset()
+		req, _ := http.NewRequest(method, url, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Request-ID", id)
+		w := httptest.NewRecorder()
+		env.router.ServeHTTP(w, req)
+		assert.NotContains(t, w.Body.String(), errDatabaseDown.Error())
+		return w, logs
+	}
+	// loggedOnce checks the failure was logged as msg exactly once, with its cause
+	loggedOnce := func(t *testing.T, logs *bytes.Buffer, msg, id string) {
+		var logged []map[string]interface{}
+		for _, line := range logLines(t, logs, msg) {
+			if line["level"] == "ERROR" {
+				logged = append(logged, line)
+			}
+		}
+		if assert.Len(t, logged, 1, logs.String()) {
+			assert.Equal(t, id, logged[0]["request_id"])
+			assert.Contains(t, logged[0]["error"], errDatabaseDown.Error())
+		}
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.method+" "+tt.url, func(t *testing.T) {
+			id := fmt.Sprintf("req-outage-%d", i)
+			w, logs := send(t, tt.method, tt.url, tt.body, id)
+
+			assert.Equal(t, http.StatusInternalServerError, w.Code, w.Body.String())
+			var resp models.ErrorResponse
+			if assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp), w.Body.String()) {
+				assert.Equal(t, CodeInternal, resp.Code)
+				assert.NotEmpty(t, resp.Message)
+				assert.Equal(t, id, resp.RequestID)
+			}
+			loggedOnce(t, logs, "request failed", id)
+		})
+	}
+
+	// A HEAD response has no body to describe the failure in
+	t.Run("HEAD /api/v1/users/1", func(t *testing.T) {
+		w, logs := send(t, "HEAD", "/api/v1/users/1", "", "req-outage-head")
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		assert.Empty(t, w.Body.Bytes())
+		loggedOnce(t, logs, "request failed", "req-outage-head")
+	})
+
+	// GraphQL reports the failure among the response's errors
+	t.Run("POST /api/v1/graphql", func(t *testing.T) {
+		w, logs := send(t, "POST", "/api/v1/graphql", `{"query":"{ users { users { id } } }"}`, "req-outage-graphql")
+		assert.Equal(t, http.StatusOK, w.Code)
+		var resp struct {
+			Errors []struct {
+				Extensions map[string]interface{} `json:"extensions"`
+			} `json:"errors"`
+		}
+		if assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp), w.Body.String()) && assert.Len(t, resp.Errors, 1) {
+			assert.Equal(t, CodeInternal, resp.Errors[0].Extensions["code"])
+		}
+		loggedOnce(t, logs, "request failed", "req-outage-graphql")
+	})
+
+	// Answering a reset request any differently would reveal which emails are registered
+	t.Run("POST /api/v1/auth/forgot", func(t *testing.T) {
+		w, logs := send(t, "POST", "/api/v1/auth/forgot", `{"email":"alice@example.com"}`, "req-outage-forgot")
+		assert.Equal(t, http.StatusAccepted, w.Code)
+		loggedOnce(t, logs, "password reset failed", "req-outage-forgot")
+	})
+}
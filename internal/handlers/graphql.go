@@ -0,0 +1,460 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"Unit-Test/internal/models"
+	"Unit-Test/internal/storage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	graphql "github.com/graph-gophers/graphql-go"
+)
+
+// graphQLSchema is the schema served on /graphql. Its users are the ones of
+// the REST API, read through the same repository and changed through the
+// same service, so validation, auditing and events are the same.
+const graphQLSchema = `
+schema {
+	query: Query
+	mutation: Mutation
+}
+
+scalar Time
+
+type Query {
+	"One page of the users matching filter, 1 of 20 users by default"
+	users(filter: UserFilter, page: PageInput): UserPage!
+	"The user with id; USER_NOT_FOUND if there is none"
+	user(id: Int!): User!
+}
+
+type Mutation {
+	"Requires a caller"
+	createUser(input: CreateUserInput!): User!
+	"Requires a caller; input.version must be the stored version"
+	updateUser(id: Int!, input: UpdateUserInput!): User!
+	"Requires an admin; soft-deletes the user and its addresses"
+	deleteUser(id: Int!): Boolean!
+}
+
+input UserFilter {
+	"Case-insensitive substring of the name"
+	name: String
+	email: String
+	role: String
+	verified: Boolean
+}
+
+input PageInput {
+	page: Int
+	limit: Int
+}
+
+type UserPage {
+	users: [User!]!
+	total: Int!
+	page: Int!
+	limit: Int!
+}
+
+type User {
+	id: Int!
+	name: String!
+	email: String!
+	role: String!
+	phone: String
+	version: Int!
+	emailVerifiedAt: Time
+	createdAt: Time!
+	updatedAt: Time!
+	"Oldest first"
+	posts: [Post!]!
+}
+
+type Post {
+	id: Int!
+	title: String!
+	body: String!
+	createdAt: Time!
+}
+
+input CreateUserInput {
+	name: String!
+	email: String!
+	role: String
+	phone: String
+}
+
+input UpdateUserInput {
+	name: String
+	email: String
+	role: String
+	"An empty phone clears it"
+	phone: String
+	version: Int!
+}
+`
+
+// newGraphQLSchema parses graphQLSchema, answering from s
+func newGraphQLSchema(s *Server) *graphql.Schema {
+	opts := []graphql.SchemaOpt{graphql.UseFieldResolvers()}
+	if !s.cfg.GraphQLIntrospection {
+		opts = append(opts, graphql.DisableIntrospection())
+	}
+	return graphql.MustParseSchema(graphQLSchema, &graphQLResolver{s: s}, opts...)
+}
+
+// GraphQLRequest is the body of a GraphQL query
+type GraphQLRequest struct {
+	Query         string                 `json:"query" binding:"required"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// GraphQLResponse is what a GraphQL query answers: the data selected and the
+// errors met on the way, each with the code of the matching REST error in
+// extensions.code
+type GraphQLResponse struct {
+	Data   interface{}   `json:"data" swaggertype:"object"`
+	Errors []interface{} `json:"errors,omitempty" swaggertype:"array,object"`
+}
+
+// Run a GraphQL query
+// @Summary GraphQL
+// @Description Query the users with field selection and their posts inlined, or change them. Reads follow the
+// @Description REST API's authentication; mutations need a caller, and deleteUser an admin. Failures come back as
+// @Description GraphQL errors with a 200, their extensions.code the one the REST API answers with.
+// @Description Introspection is only enabled with GRAPHQL_INTROSPECTION=true.
+// @Tags GraphQL
+// @Accept json
+// @Produce json
+// @Param query body GraphQLRequest true "Query, operation name and variables"
+// @Success 200 {object} GraphQLResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Security BearerAuth
+// @Router /api/v1/graphql [post]
+// @Router /api/v2/graphql [post]
+func (s *Server) graphQL(c *gin.Context) error {
+	var req GraphQLRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		return invalidInput(err)
+	}
+	ctx := context.WithValue(c.Request.Context(), ginContextKey{}, c)
+	c.JSON(http.StatusOK, s.graphql.Exec(ctx, req.Query, req.OperationName, req.Variables))
+	return nil
+}
+
+// ginContextKey holds the request's *gin.Context in the context the
+// resolvers are given
+type ginContextKey struct{}
+
+// graphQLResolver resolves the Query and Mutation types
+type graphQLResolver struct {
+	s *Server
+}
+
+// ginContext is the *gin.Context of the query ctx belongs to
+func ginContext(ctx context.Context) *gin.Context {
+	return ctx.Value(ginContextKey{}).(*gin.Context)
+}
+
+// graphQLFailure turns err into the error the client is shown, with the
+// message and code errorResponse gives it; server errors are logged like the
+// REST API's
+func graphQLFailure(c *gin.Context, err error) error {
+	err = contextError(c, err)
+	status, resp := errorResponse(err)
+	logFailure(c, status, err)
+	return graphQLError{resp: resp}
+}
+
+// graphQLError is a resolver's failure, carrying its code to the client in
+// the error's extensions
+type graphQLError struct {
+	resp models.ErrorResponse
+}
+
+func (e graphQLError) Error() string {
+	return e.resp.Message
+}
+
+func (e graphQLError) Extensions() map[string]interface{} {
+	ext := map[string]interface{}{"code": e.resp.Code}
+	if len(e.resp.Errors) > 0 {
+		ext["errors"] = e.resp.Errors
+	}
+	return ext
+}
+
+type graphQLUserFilter struct {
+	Name, Email, Role *string
+	Verified          *bool
+}
+
+type graphQLPage struct {
+	Page, Limit *int32
+}
+
+func (r *graphQLResolver) Users(ctx context.Context, args struct {
+	Filter *graphQLUserFilter
+	Page   *graphQLPage
+}) (*userPageResolver, error) {
+	c := ginContext(ctx)
+	var filter storage.UserFilter
+	if f := args.Filter; f != nil {
+		filter = storage.UserFilter{Name: deref(f.Name), Email: deref(f.Email), Role: deref(f.Role), Verified: f.Verified}
+	}
+	page, limit := 1, r.s.cfg.DefaultPageSize
+	if p := args.Page; p != nil {
+		if p.Page != nil {
+			page = int(*p.Page)
+		}
+		if p.Limit != nil {
+			limit = int(*p.Limit)
+		}
+	}
+	switch {
+	case page < 1:
+		return nil, graphQLFailure(c, validationError("page must be a positive integer"))
+	case limit < 1:
+		return nil, graphQLFailure(c, validationError("limit must be a positive integer"))
+	case limit > r.s.cfg.MaxPageSize:
+		return nil, graphQLFailure(c, validationError("limit must be at most "+strconv.Itoa(r.s.cfg.MaxPageSize)))
+	}
+
+	users, err := r.s.users.List(ctx, filter, storage.ListOptions{Limit: limit, Offset: (page - 1) * limit})
+	if err != nil {
+		return nil, graphQLFailure(c, err)
+	}
+	total, err := r.s.users.Count(ctx, filter)
+	if err != nil {
+		return nil, graphQLFailure(c, err)
+	}
+	return &userPageResolver{Users: r.s.userResolvers(users), Total: int32(total), Page: int32(page), Limit: int32(limit)}, nil
+}
+
+func (r *graphQLResolver) User(ctx context.Context, args struct{ ID int32 }) (*userResolver, error) {
+	c := ginContext(ctx)
+	user, err := r.s.users.Get(ctx, int(args.ID))
+	if err != nil {
+		return nil, graphQLFailure(c, notFoundAs(err, CodeUserNotFound, "User not found"))
+	}
+	return r.s.userResolvers([]models.User{user})[0], nil
+}
+
+// graphQLCaller is the subject of the query's credentials, or a 401 without any
+func graphQLCaller(c *gin.Context) (string, error) {
+	subject := c.GetString(authSubjectKey)
+	if subject == "" {
+		return "", newAPIError(http.StatusUnauthorized, CodeUnauthorized, "Missing bearer token")
+	}
+	return subject, nil
+}
+
+func (r *graphQLResolver) CreateUser(ctx context.Context, args struct {
+	Input struct {
+		Name, Email string
+		Role, Phone *string
+	}
+}) (*userResolver, error) {
+	c := ginContext(ctx)
+	if _, err := graphQLCaller(c); err != nil {
+		return nil, graphQLFailure(c, err)
+	}
+	user := models.User{Name: args.Input.Name, Email: args.Input.Email, Role: deref(args.Input.Role), Phone: deref(args.Input.Phone)}
+	user.Normalize()
+	if err := binding.Validator.ValidateStruct(&user); err != nil {
+		return nil, graphQLFailure(c, invalidInput(err))
+	}
+	if user.Role != "" {
+		if err := r.s.checkRoleChange(c, models.RoleMember, user.Role); err != nil {
+			return nil, graphQLFailure(c, err)
+		}
+	}
+	if err := r.s.userService.Create(serviceContext(c), &user); err != nil {
+		return nil, graphQLFailure(c, conflictAs(err, CodeDuplicateEmail, "email already in use"))
+	}
+	return r.s.userResolvers([]models.User{user})[0], nil
+}
+
+func (r *graphQLResolver) UpdateUser(ctx context.Context, args struct {
+	ID    int32
+	Input struct {
+		Name, Email, Role, Phone *string
+		Version                  int32
+	}
+}) (*userResolver, error) {
+	c := ginContext(ctx)
+	subject, err := graphQLCaller(c)
+	if err != nil {
+		return nil, graphQLFailure(c, err)
+	}
+	id := int(args.ID)
+	if err := r.s.checkAccess(c, "PATCH /users/:id", strconv.Itoa(id), subject); err != nil {
+		return nil, graphQLFailure(c, err)
+	}
+	patch := UserPatch{Name: args.Input.Name, Email: args.Input.Email, Role: args.Input.Role, Phone: args.Input.Phone}
+	patch.Normalize()
+	if err := binding.Validator.ValidateStruct(&patch); err != nil {
+		return nil, graphQLFailure(c, invalidInput(err))
+	}
+
+	user, err := r.s.users.Get(ctx, id)
+	if err != nil {
+		return nil, graphQLFailure(c, notFoundAs(err, CodeUserNotFound, "User not found"))
+	}
+	before := user
+	changed, err := patch.apply(&user)
+	if err != nil {
+		return nil, graphQLFailure(c, err)
+	}
+	if err := r.s.checkRoleChange(c, before.Role, user.Role); err != nil {
+		return nil, graphQLFailure(c, err)
+	}
+	if int(args.Input.Version) != user.Version {
+		return nil, graphQLFailure(c, errVersionConflict)
+	}
+	if !changed {
+		return r.s.userResolvers([]models.User{user})[0], nil
+	}
+
+	var verificationToken string
+	err = r.s.userService.Update(serviceContext(c), &user, r.s.reverifyChangedEmail(&verificationToken))
+	if errors.Is(err, storage.ErrVersionConflict) {
+		return nil, graphQLFailure(c, errVersionConflict)
+	}
+	if err != nil {
+		return nil, graphQLFailure(c, conflictAs(notFoundAs(err, CodeUserNotFound, "User not found"), CodeDuplicateEmail, "email already in use"))
+	}
+	logRoleChange(c, user.ID, before.Role, user.Role)
+	r.s.sendEmailVerification(c, user.Email, verificationToken)
+	return r.s.userResolvers([]models.User{user})[0], nil
+}
+
+// errVersionConflict is an update based on a version that is no longer stored.
+// The REST API answers it with the stored user; GraphQL clients query it.
+var errVersionConflict = newAPIError(http.StatusConflict, CodeVersionConflict, "User was modified by another request")
+
+func (r *graphQLResolver) DeleteUser(ctx context.Context, args struct{ ID int32 }) (bool, error) {
+	c := ginContext(ctx)
+	subject, err := graphQLCaller(c)
+	if err != nil {
+		return false, graphQLFailure(c, err)
+	}
+	id := int(args.ID)
+	if err := r.s.checkAccess(c, "DELETE /users/:id", strconv.Itoa(id), subject); err != nil {
+		return false, graphQLFailure(c, err)
+	}
+	if err := r.s.userService.Delete(serviceContext(c), id, r.s.deleteAddresses(id), r.s.endSessions(id)); err != nil {
+		return false, graphQLFailure(c, notFoundAs(err, CodeUserNotFound, "User not found"))
+	}
+	return true, nil
+}
+
+type userPageResolver struct {
+	Users              []*userResolver
+	Total, Page, Limit int32
+}
+
+// userResolver resolves a User, loading its posts only when they are asked for
+type userResolver struct {
+	user  models.User
+	posts *postLoader
+}
+
+// userResolvers resolves users, which share one postLoader
+func (s *Server) userResolvers(users []models.User) []*userResolver {
+	loader := &postLoader{s: s, ids: make([]int, len(users))}
+	resolvers := make([]*userResolver, len(users))
+	for i := range users {
+		loader.ids[i] = users[i].ID
+		resolvers[i] = &userResolver{user: users[i], posts: loader}
+	}
+	return resolvers
+}
+
+// postLoader loads the posts of all its users in one query, the first time
+// the posts of any of them are asked for
+type postLoader struct {
+	s     *Server
+	ids   []int
+	once  sync.Once
+	posts map[int][]models.Post
+	err   error
+}
+
+// load returns the posts of the user with id, oldest first
+func (l *postLoader) load(ctx context.Context, id int) ([]models.Post, error) {
+	l.once.Do(func() {
+		var users []models.User
+		users, l.err = l.s.users.List(ctx, storage.UserFilter{IDs: l.ids}, storage.ListOptions{Columns: []string{"id"}, WithPosts: true})
+		l.posts = make(map[int][]models.Post, len(users))
+		for _, u := range users {
+			l.posts[u.ID] = u.Posts
+		}
+	})
+	return l.posts[id], l.err
+}
+
+func (u *userResolver) ID() int32      { return int32(u.user.ID) }
+func (u *userResolver) Name() string   { return u.user.Name }
+func (u *userResolver) Email() string  { return u.user.Email }
+func (u *userResolver) Role() string   { return u.user.Role }
+func (u *userResolver) Version() int32 { return int32(u.user.Version) }
+func (u *userResolver) CreatedAt() graphql.Time {
+	return graphql.Time{Time: u.user.CreatedAt}
+}
+func (u *userResolver) UpdatedAt() graphql.Time {
+	return graphql.Time{Time: u.user.UpdatedAt}
+}
+
+func (u *userResolver) Phone() *string {
+	if u.user.Phone == "" {
+		return nil
+	}
+	return &u.user.Phone
+}
+
+func (u *userResolver) EmailVerifiedAt() *graphql.Time {
+	if u.user.EmailVerifiedAt == nil {
+		return nil
+	}
+	return &graphql.Time{Time: *u.user.EmailVerifiedAt}
+}
+
+func (u *userResolver) Posts(ctx context.Context) ([]*postResolver, error) {
+	posts, err := u.posts.load(ctx, u.user.ID)
+	if err != nil {
+		return nil, graphQLFailure(ginContext(ctx), err)
+	}
+	resolvers := make([]*postResolver, len(posts))
+	for i := range posts {
+		resolvers[i] = &postResolver{post: posts[i]}
+	}
+	return resolvers, nil
+}
+
+type postResolver struct {
+	post models.Post
+}
+
+func (p *postResolver) ID() int32     { return int32(p.post.ID) }
+func (p *postResolver) Title() string { return p.post.Title }
+func (p *postResolver) Body() string  { return p.post.Body }
+func (p *postResolver) CreatedAt() graphql.Time {
+	return graphql.Time{Time: p.post.CreatedAt}
+}
+
+// deref is the string p points to, or "" for nil
+func deref(p *string) string {
+	if p == nil {
+		return ""
+	}
+	return *p
+}
@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"Unit-Test/internal/models"
+	"Unit-Test/internal/service"
+	"Unit-Test/internal/testsupport/fixtures"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// graphQLResult is a GraphQL response as the client reads it
+type graphQLResult struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []struct {
+		Message    string                 `json:"message"`
+		Path       []interface{}          `json:"path"`
+		Extensions map[string]interface{} `json:"extensions"`
+	} `json:"errors"`
+}
+
+// code is the extensions.code of the only error in r
+func (r graphQLResult) code(t *testing.T) string {
+	t.Helper()
+	require.Len(t, r.Errors, 1, "errors")
+	code, _ := r.Errors[0].Extensions["code"].(string)
+	return code
+}
+
+// postGraphQL runs query with variables through r, with authorization if set
+func postGraphQL(t *testing.T, r *gin.Engine, authorization, query string, variables map[string]interface{}) graphQLResult {
+	t.Helper()
+	body, err := json.Marshal(GraphQLRequest{Query: query, Variables: variables})
+	require.NoError(t, err)
+	w := sendWithAuth(r, "POST", "/api/v1/graphql", string(body), authorization)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var result graphQLResult
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	return result
+}
+
+func TestGraphQLQueries(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+	users := fixtures.SeedUsers(t, env.db, 3, fixtures.WithRole(models.RoleViewer))
+	fixtures.NewUser(t, env.db, fixtures.WithRole(models.RoleAdmin))
+	post := fixtures.NewPost(t, env.db, users[0])
+
+	result := postGraphQL(t, env.router, "", `query($limit: Int) {
+		users(filter: {role: "viewer"}, page: {page: 2, limit: $limit}) { total page limit users { id email } }
+	}`, map[string]interface{}{"limit": 2})
+	require.Empty(t, result.Errors)
+	assert.JSONEq(t, fmt.Sprintf(`{"users":{"total":3,"page":2,"limit":2,"users":[{"id":%d,"email":%q}]}}`, users[2].ID, users[2].Email), string(result.Data))
+
+	// Only the fields asked for, with the posts inlined
+	result = postGraphQL(t, env.router, "", fmt.Sprintf(`{ user(id: %d) { name phone posts { id title } } }`, users[0].ID), nil)
+	require.Empty(t, result.Errors)
+	assert.JSONEq(t, fmt.Sprintf(`{"user":{"name":%q,"phone":null,"posts":[{"id":%d,"title":%q}]}}`, users[0].Name, post.ID, post.Title), string(result.Data))
+}
+
+func TestGraphQLLoadsPostsPerPage(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+	users := fixtures.SeedUsers(t, env.db, 3)
+	first := fixtures.NewPost(t, env.db, users[0])
+	last := fixtures.NewPost(t, env.db, users[2])
+
+	log := logQueries(t, env)
+	result := postGraphQL(t, env.router, "", `{ users { users { id posts { id } } } }`, nil)
+	require.Empty(t, result.Errors)
+	assert.JSONEq(t, fmt.Sprintf(`{"users":{"users":[{"id":%d,"posts":[{"id":%d}]},{"id":%d,"posts":[]},{"id":%d,"posts":[{"id":%d}]}]}}`,
+		users[0].ID, first.ID, users[1].ID, users[2].ID, last.ID), string(result.Data))
+	assert.Len(t, log.selects("posts"), 1, "one query for the posts of the whole page")
+}
+
+func TestGraphQLQueryErrors(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	result := postGraphQL(t, env.router, "", `{ user(id: 99) { id } }`, nil)
+	assert.Equal(t, CodeUserNotFound, result.code(t))
+	assert.Equal(t, "User not found", result.Errors[0].Message)
+	assert.Equal(t, []interface{}{"user"}, result.Errors[0].Path)
+	assert.JSONEq(t, `null`, string(result.Data))
+
+	result = postGraphQL(t, env.router, "", `{ users(page: {limit: 1000}) { total } }`, nil)
+	assert.Equal(t, CodeValidation, result.code(t))
+	assert.Equal(t, "limit must be at most 100", result.Errors[0].Message)
+
+	// Queries the schema rejects never reach a resolver
+	result = postGraphQL(t, env.router, "", `{ user(id: 1) { password } }`, nil)
+	require.Len(t, result.Errors, 1)
+	assert.Contains(t, result.Errors[0].Message, `Cannot query field "password"`)
+
+	w := send(env, "POST", "/api/v1/graphql", `{"variables":{}}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), CodeValidation)
+}
+
+func TestGraphQLMutations(t *testing.T) {
+	t.Parallel()
+	events := &service.MemoryPublisher{}
+	env := newTestEnvWith(t, Deps{Events: events})
+
+	const create = `mutation($input: CreateUserInput!) { createUser(input: $input) { id name email role version } }`
+	result := postGraphQL(t, env.router, "", create, map[string]interface{}{
+		"input": map[string]interface{}{"name": " Alice ", "email": "Alice@Example.com"},
+	})
+	require.Empty(t, result.Errors)
+	assert.JSONEq(t, `{"createUser":{"id":1,"name":"Alice","email":"alice@example.com","role":"member","version":1}}`, string(result.Data))
+
+	// The service's rules apply as they do to the REST API
+	result = postGraphQL(t, env.router, "", create, map[string]interface{}{
+		"input": map[string]interface{}{"name": "Alice", "email": "alice@example.com"},
+	})
+	assert.Equal(t, CodeDuplicateEmail, result.code(t))
+	result = postGraphQL(t, env.router, "", create, map[string]interface{}{
+		"input": map[string]interface{}{"name": "Bob", "email": "not-an-email", "role": "owner"},
+	})
+	assert.Equal(t, CodeValidation, result.code(t))
+	assert.ElementsMatch(t, []interface{}{
+		map[string]interface{}{"field": "email", "error": "must be a valid email"},
+		map[string]interface{}{"field": "role", "error": "must be one of: admin, member, viewer"},
+	}, result.Errors[0].Extensions["errors"])
+
+	const update = `mutation($input: UpdateUserInput!) { updateUser(id: 1, input: $input) { name version } }`
+	result = postGraphQL(t, env.router, "", update, map[string]interface{}{
+		"input": map[string]interface{}{"name": "Alicia", "version": 1},
+	})
+	require.Empty(t, result.Errors)
+	assert.JSONEq(t, `{"updateUser":{"name":"Alicia","version":2}}`, string(result.Data))
+	result = postGraphQL(t, env.router, "", update, map[string]interface{}{
+		"input": map[string]interface{}{"name": "Ali", "version": 1},
+	})
+	assert.Equal(t, CodeVersionConflict, result.code(t))
+	result = postGraphQL(t, env.router, "", update, map[string]interface{}{
+		"input": map[string]interface{}{"name": "", "version": 2},
+	})
+	assert.Equal(t, CodeValidation, result.code(t))
+	assert.Equal(t, "name cannot be empty", result.Errors[0].Message)
+
+	result = postGraphQL(t, env.router, "", `mutation { deleteUser(id: 1) }`, nil)
+	require.Empty(t, result.Errors)
+	assert.JSONEq(t, `{"deleteUser":true}`, string(result.Data))
+	result = postGraphQL(t, env.router, "", `mutation { deleteUser(id: 1) }`, nil)
+	assert.Equal(t, CodeUserNotFound, result.code(t))
+
+	var kinds []string
+	for _, event := range events.Events() {
+		kinds = append(kinds, event.Type)
+	}
+	assert.Equal(t, []string{service.EventUserCreated, service.EventUserUpdated, service.EventUserDeleted}, kinds)
+	var audits int64
+	require.NoError(t, env.db.Model(&models.AuditLog{}).Where("user_id = ?", 1).Count(&audits).Error)
+	assert.EqualValues(t, 3, audits)
+}
+
+func TestGraphQLAuthorization(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+	seedRoles(env)
+	r := newAuthTestRouter(env)
+
+	// Reads are open, like the REST API's
+	result := postGraphQL(t, r, "", `{ users { total } }`, nil)
+	require.Empty(t, result.Errors)
+	assert.JSONEq(t, `{"users":{"total":3}}`, string(result.Data))
+
+	result = postGraphQL(t, r, "", `mutation { createUser(input: {name: "Eve", email: "eve@example.com"}) { id } }`, nil)
+	assert.Equal(t, CodeUnauthorized, result.code(t))
+	result = postGraphQL(t, r, bearerFor("2"), `mutation { deleteUser(id: 3) }`, nil)
+	assert.Equal(t, CodeForbidden, result.code(t))
+	assert.Equal(t, "Role member may not perform this action", result.Errors[0].Message)
+	result = postGraphQL(t, r, bearerFor("1"), `mutation { deleteUser(id: 3) }`, nil)
+	assert.Empty(t, result.Errors)
+
+	// Members edit only themselves, and never their role
+	result = postGraphQL(t, r, bearerFor("2"), `mutation { updateUser(id: 1, input: {name: "Mallory", version: 1}) { id } }`, nil)
+	assert.Equal(t, CodeForbidden, result.code(t))
+	result = postGraphQL(t, r, bearerFor("2"), `mutation { updateUser(id: 2, input: {role: "admin", version: 1}) { id } }`, nil)
+	assert.Equal(t, CodeForbidden, result.code(t))
+	result = postGraphQL(t, r, bearerFor("2"), `mutation { createUser(input: {name: "Eve", email: "eve@example.com", role: "admin"}) { id } }`, nil)
+	assert.Equal(t, CodeForbidden, result.code(t))
+	result = postGraphQL(t, r, bearerFor("2"), `mutation { updateUser(id: 2, input: {name: "Maxine", version: 1}) { name } }`, nil)
+	assert.Empty(t, result.Errors)
+
+	w := sendWithAuth(r, "POST", "/api/v1/graphql", `{"query":"{ users { total } }"}`, "Bearer not-a-token")
+	assert.Equal(t, http.StatusUnauthorized, w.Code, "bad credentials are refused, not ignored")
+}
+
+func TestGraphQLIntrospection(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+	const query = `{ __schema { queryType { name } } }`
+
+	result := postGraphQL(t, env.router, "", query, nil)
+	assert.JSONEq(t, `{}`, string(result.Data), "introspection is off by default")
+
+	env.server.cfg.GraphQLIntrospection = true
+	env.server.graphql = newGraphQLSchema(env.server)
+	result = postGraphQL(t, env.router, "", query, nil)
+	require.Empty(t, result.Errors)
+	assert.JSONEq(t, `{"__schema":{"queryType":{"name":"Query"}}}`, string(result.Data))
+}
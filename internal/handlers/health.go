@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"Unit-Test/internal/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// How long /healthz waits for the database to answer a ping
+const healthPingTimeout = 2 * time.Second
+
+// HealthResponse reports whether the service can work, and why not if it can't
+type HealthResponse struct {
+	Status string `json:"status" example:"ok"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Liveness check
+// @Summary Liveness check
+// @Description Report whether the process is up and the database answers a ping. Needs no authentication and is not rate limited.
+// @Tags Health
+// @Produce json
+// @Success 200 {object} HealthResponse
+// @Failure 503 {object} HealthResponse
+// @Router /healthz [get]
+func (s *Server) healthz(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), healthPingTimeout)
+	defer cancel()
+	if err := storage.Ping(ctx, s.db); err != nil {
+		c.JSON(http.StatusServiceUnavailable, HealthResponse{Status: "unavailable", Error: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, HealthResponse{Status: "ok"})
+}
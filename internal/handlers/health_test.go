@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func getHealthz(router *gin.Engine) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/healthz", nil))
+	return w
+}
+
+// closedDB is a database whose connections are closed, so every Ping fails
+func closedDB(t *testing.T) *gorm.DB {
+	broken, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := broken.DB()
+	sqlDB.Close()
+	return broken
+}
+
+func TestHealthzOK(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	w := getHealthz(env.router)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"status":"ok"}`, w.Body.String())
+}
+
+func TestHealthzDatabaseDown(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	defer env.useDB(closedDB(t))()
+
+	w := getHealthz(env.router)
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.JSONEq(t, `{"status":"unavailable","error":"sql: database is closed"}`, w.Body.String())
+}
+
+func TestHealthzFollowsDatabase(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	assert.Equal(t, http.StatusOK, getHealthz(env.router).Code)
+
+	// Unavailable while Ping fails, and back once the database is
+	restore := env.useDB(closedDB(t))
+	assert.Equal(t, http.StatusServiceUnavailable, getHealthz(env.router).Code)
+	restore()
+	assert.Equal(t, http.StatusOK, getHealthz(env.router).Code)
+}
+
+func TestHealthzBypassesAuthAndRateLimit(t *testing.T) {
+	t.Parallel()
+	cfg := testConfig()
+	cfg.RequireAuthForReads, cfg.RateLimitRPS, cfg.RateLimitBurst = true, 0.001, 1
+	env := newTestEnvWith(t, Deps{Config: cfg})
+
+	router := newAuthTestRouter(env)
+
+	for i := 0; i < 3; i++ {
+		w := getHealthz(router)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Header().Get("X-RateLimit-Remaining"))
+	}
+
+	// The same router does limit and authenticate the API
+	w := sendWithAuth(router, "GET", "/api/v1/users", "", "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = sendWithAuth(router, "GET", "/api/v1/users", "", "")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+}
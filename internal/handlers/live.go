@@ -0,0 +1,261 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"Unit-Test/internal/models"
+	"Unit-Test/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// UserUpdate is a message on /users/ws: one change to a user
+type UserUpdate struct {
+	Event  string `json:"event" example:"user.updated"`
+	UserID int    `json:"user_id" example:"1"`
+	// User as it is after the change; for deletions, as it was before
+	User      *models.User `json:"user"`
+	Timestamp time.Time    `json:"timestamp"`
+}
+
+// LiveOptions tune a LiveFeed; zero values take the defaults
+type LiveOptions struct {
+	// SendBuffer is how many updates a client may fall behind before it is
+	// disconnected, 64 by default
+	SendBuffer int
+	// PingInterval is how often clients are pinged, 30s by default
+	PingInterval time.Duration
+	// PongWait is how long a client may go without answering a ping before it
+	// is disconnected, two ping intervals by default
+	PongWait time.Duration
+	// WriteTimeout bounds every write to a client, 10s by default
+	WriteTimeout time.Duration
+}
+
+func (o *LiveOptions) setDefaults() {
+	if o.SendBuffer <= 0 {
+		o.SendBuffer = 64
+	}
+	if o.PingInterval <= 0 {
+		o.PingInterval = 30 * time.Second
+	}
+	if o.PongWait <= 0 {
+		o.PongWait = 2 * o.PingInterval
+	}
+	if o.WriteTimeout <= 0 {
+		o.WriteTimeout = 10 * time.Second
+	}
+}
+
+// LiveFeed is a service.Publisher pushing every user event to the WebSocket
+// clients of /users/ws. Publishing never waits on a client: one whose buffer
+// is full is disconnected instead.
+type LiveFeed struct {
+	opts LiveOptions
+
+	mu      sync.Mutex
+	clients map[*liveClient]struct{}
+	closed  bool
+}
+
+// liveClient is one connection's queue of updates
+type liveClient struct {
+	send chan []byte
+	// done is closed when the feed drops the client, with closeCode and
+	// closeText telling it why
+	done      chan struct{}
+	closeCode int
+	closeText string
+}
+
+// NewLiveFeed builds a LiveFeed without clients
+func NewLiveFeed(opts LiveOptions) *LiveFeed {
+	opts.setDefaults()
+	return &LiveFeed{opts: opts, clients: make(map[*liveClient]struct{})}
+}
+
+// Publish queues event for every client
+func (f *LiveFeed) Publish(_ context.Context, event service.Event) error {
+	msg, err := json.Marshal(UserUpdate{Event: event.Type, UserID: event.UserID, User: event.User, Timestamp: event.At.UTC()})
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for client := range f.clients {
+		select {
+		case client.send <- msg:
+		default:
+			f.drop(client, websocket.CloseTryAgainLater, "too slow, reconnect")
+		}
+	}
+	return nil
+}
+
+// Close disconnects every client and refuses new ones; it is meant for
+// http.Server.RegisterOnShutdown, as Shutdown doesn't wait for WebSockets
+func (f *LiveFeed) Close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
+	for client := range f.clients {
+		f.drop(client, websocket.CloseGoingAway, "server shutting down")
+	}
+}
+
+// subscribe adds a client, or returns nil once the feed is closed
+func (f *LiveFeed) subscribe() *liveClient {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return nil
+	}
+	client := &liveClient{send: make(chan []byte, f.opts.SendBuffer), done: make(chan struct{})}
+	f.clients[client] = struct{}{}
+	return client
+}
+
+// unsubscribe removes a client that went away by itself
+func (f *LiveFeed) unsubscribe(client *liveClient) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.clients, client)
+}
+
+// drop removes client, telling it why; f.mu must be held
+func (f *LiveFeed) drop(client *liveClient, code int, text string) {
+	if _, ok := f.clients[client]; !ok {
+		return
+	}
+	delete(f.clients, client)
+	client.closeCode, client.closeText = code, text
+	close(client.done)
+}
+
+// newUpgrader accepts WebSockets from the API's own origin and the ones CORS
+// allows
+func newUpgrader(allowedOrigins []string) *websocket.Upgrader {
+	return &websocket.Upgrader{
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
+		CheckOrigin:     checkOrigin(allowedOrigins),
+	}
+}
+
+// checkOrigin admits clients without an Origin, from the host they connect to,
+// or from one of allowed, the CORS_ALLOWED_ORIGINS
+func checkOrigin(allowed []string) func(r *http.Request) bool {
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			return true
+		}
+		if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+			return true
+		}
+		for _, a := range allowed {
+			if a == "*" || strings.EqualFold(a, origin) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// tokenFromQuery takes the bearer token from the token query parameter when
+// there is no Authorization header, as browsers can't set one on a WebSocket
+func tokenFromQuery(c *gin.Context) {
+	if token := c.Query("token"); token != "" && c.GetHeader("Authorization") == "" {
+		c.Request.Header.Set("Authorization", "Bearer "+token)
+	}
+	c.Next()
+}
+
+// Stream user changes over a WebSocket
+// @Summary Live user updates
+// @Description Upgrades to a WebSocket sending a UserUpdate as a JSON text message for every user created, updated or deleted.
+// @Description Browsers pass the token as the token query parameter. The server pings every 30s; clients that
+// @Description don't answer, or fall too far behind, are disconnected.
+// @Tags Users
+// @Param token query string false "Access token, when it can't be sent as a header"
+// @Success 101 {object} UserUpdate "Switching to the WebSocket protocol"
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 426 {object} models.ErrorResponse
+// @Failure 503 {object} models.ErrorResponse
+// @Security BearerAuth
+// @Router /api/v1/users/ws [get]
+// @Router /api/v2/users/ws [get]
+func (s *Server) userUpdates(c *gin.Context) {
+	if !websocket.IsWebSocketUpgrade(c.Request) {
+		c.Header("Upgrade", "websocket")
+		respondError(c, http.StatusUpgradeRequired, CodeUpgradeRequired, "This endpoint only speaks WebSocket")
+		return
+	}
+	client := s.live.subscribe()
+	if client == nil {
+		respondError(c, http.StatusServiceUnavailable, CodeUnavailable, "Server is shutting down")
+		return
+	}
+	defer s.live.unsubscribe(client)
+
+	// Upgrade answers a failed handshake itself
+	conn, err := s.upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	s.pushUpdates(conn, client)
+}
+
+// pushUpdates writes the client's updates and pings to conn until either side
+// closes it
+func (s *Server) pushUpdates(conn *websocket.Conn, client *liveClient) {
+	opts := s.live.opts
+	pongWait := opts.PongWait
+
+	// Clients only send control frames; reading handles them, and notices
+	// when the client goes away
+	gone := make(chan struct{})
+	go func() {
+		defer close(gone)
+		conn.SetReadLimit(512)
+		_ = conn.SetReadDeadline(time.Now().Add(pongWait))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(pongWait))
+		})
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(opts.PingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case msg := <-client.send:
+			_ = conn.SetWriteDeadline(time.Now().Add(opts.WriteTimeout))
+			if err := conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+				return
+			}
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(opts.WriteTimeout)); err != nil {
+				return
+			}
+		case <-client.done:
+			closing := websocket.FormatCloseMessage(client.closeCode, client.closeText)
+			_ = conn.WriteControl(websocket.CloseMessage, closing, time.Now().Add(opts.WriteTimeout))
+			return
+		case <-gone:
+			return
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"Unit-Test/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// dialUpdates opens /api/v1/users/ws on a test server running r, with query
+// appended to the URL
+func dialUpdates(t *testing.T, r *gin.Engine, query string) (*websocket.Conn, *http.Response, error) {
+	t.Helper()
+	ts := httptest.NewServer(r)
+	t.Cleanup(ts.Close)
+	url := "ws" + strings.TrimPrefix(ts.URL, "http") + "/api/v1/users/ws" + query
+	conn, resp, err := websocket.DefaultDialer.Dial(url, nil)
+	if err == nil {
+		t.Cleanup(func() { conn.Close() })
+	}
+	return conn, resp, err
+}
+
+// readUpdate reads the next message on conn, failing t after a second
+func readUpdate(t *testing.T, conn *websocket.Conn) UserUpdate {
+	t.Helper()
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	var update UserUpdate
+	require.NoError(t, conn.ReadJSON(&update))
+	return update
+}
+
+func TestUserUpdatesOverWebSocket(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+	conn, _, err := dialUpdates(t, env.router, "")
+	require.NoError(t, err)
+
+	require.Equal(t, http.StatusCreated, send(env, "POST", "/api/v1/users", `{"name":"Alice","email":"alice@example.com"}`).Code)
+	require.Equal(t, http.StatusOK, send(env, "PATCH", "/api/v1/users/1", `{"name":"Alicia","version":1}`).Code)
+	require.Equal(t, http.StatusOK, send(env, "DELETE", "/api/v1/users/1", "").Code)
+
+	for _, want := range []struct{ event, name string }{
+		{service.EventUserCreated, "Alice"},
+		{service.EventUserUpdated, "Alicia"},
+		{service.EventUserDeleted, "Alicia"},
+	} {
+		update := readUpdate(t, conn)
+		assert.Equal(t, want.event, update.Event)
+		assert.Equal(t, 1, update.UserID)
+		if assert.NotNil(t, update.User, want.event) {
+			assert.Equal(t, want.name, update.User.Name, want.event)
+			assert.Equal(t, "alice@example.com", update.User.Email, want.event)
+		}
+	}
+}
+
+func TestUserUpdatesTokenFromQuery(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+	seedRoles(env)
+	r := newAuthTestRouter(env)
+
+	_, resp, err := dialUpdates(t, r, "")
+	require.ErrorIs(t, err, websocket.ErrBadHandshake)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	_, resp, err = dialUpdates(t, r, "?token=not-a-token")
+	require.ErrorIs(t, err, websocket.ErrBadHandshake)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	_, _, err = dialUpdates(t, r, "?token="+mintToken("3", time.Now().Add(time.Hour), []byte(testJWTSecret)))
+	assert.NoError(t, err, "any role may watch")
+}
+
+func TestUserUpdatesNeedAWebSocket(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	w := send(env, "GET", "/api/v1/users/ws", "")
+	assert.Equal(t, http.StatusUpgradeRequired, w.Code)
+	assert.Equal(t, "websocket", w.Header().Get("Upgrade"))
+	assert.Contains(t, w.Body.String(), CodeUpgradeRequired)
+}
+
+func TestUserUpdatesRejectForeignOrigins(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+	ts := httptest.NewServer(env.router)
+	t.Cleanup(ts.Close)
+
+	header := http.Header{"Origin": {"https://evil.example"}}
+	_, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+"/api/v1/users/ws", header)
+	require.ErrorIs(t, err, websocket.ErrBadHandshake)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+}
+
+func TestLiveFeedDropsSlowConsumers(t *testing.T) {
+	t.Parallel()
+	feed := NewLiveFeed(LiveOptions{SendBuffer: 2})
+	slow, fast := feed.subscribe(), feed.subscribe()
+
+	for id := 1; id <= 3; id++ {
+		require.NoError(t, feed.Publish(context.Background(), service.Event{Type: service.EventUserCreated, UserID: id}))
+		<-fast.send
+	}
+
+	select {
+	case <-slow.done:
+		assert.Equal(t, websocket.CloseTryAgainLater, slow.closeCode)
+	default:
+		t.Fatal("the client three updates behind wasn't dropped")
+	}
+	assert.Len(t, slow.send, 2, "what was queued before is still sent")
+	select {
+	case <-fast.done:
+		t.Fatal("the client keeping up was dropped")
+	default:
+	}
+}
+
+func TestSlowConsumerIsDisconnected(t *testing.T) {
+	t.Parallel()
+	feed := NewLiveFeed(LiveOptions{SendBuffer: 1})
+	env := newTestEnvWith(t, Deps{Live: feed})
+	conn, _, err := dialUpdates(t, env.router, "")
+	require.NoError(t, err)
+
+	// Publish faster than the updates can be written until the client falls behind
+	feed.mu.Lock()
+	var client *liveClient
+	for c := range feed.clients {
+		client = c
+	}
+	feed.mu.Unlock()
+	require.NotNil(t, client)
+	for id := 1; ; id++ {
+		require.NoError(t, feed.Publish(context.Background(), service.Event{Type: service.EventUserUpdated, UserID: id}))
+		select {
+		case <-client.done:
+		default:
+			continue
+		}
+		break
+	}
+
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	for {
+		if _, _, err = conn.ReadMessage(); err != nil {
+			break
+		}
+	}
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseTryAgainLater), err.Error())
+}
+
+// TestUserUpdatesKeepAlive depends on timing, so it doesn't run in parallel,
+// and gives the clients answering pings far longer than they need
+func TestUserUpdatesKeepAlive(t *testing.T) {
+	env := newTestEnvWith(t, Deps{Live: NewLiveFeed(LiveOptions{PingInterval: 100 * time.Millisecond, PongWait: 5 * time.Second})})
+
+	// Answering the pings keeps the client connected
+	conn, _, err := dialUpdates(t, env.router, "")
+	require.NoError(t, err)
+	pings := make(chan struct{}, 10)
+	conn.SetPingHandler(func(data string) error {
+		select {
+		case pings <- struct{}{}:
+		default:
+		}
+		return conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(time.Second))
+	})
+	go func() {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+	for i := 0; i < 4; i++ {
+		select {
+		case <-pings:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("only %d pings arrived", i)
+		}
+	}
+}
+
+func TestUserUpdatesDropSilentClients(t *testing.T) {
+	t.Parallel()
+	env := newTestEnvWith(t, Deps{Live: NewLiveFeed(LiveOptions{PingInterval: 100 * time.Millisecond, PongWait: 300 * time.Millisecond})})
+
+	// A client that never answers is cut off once PongWait has passed
+	silent, _, err := dialUpdates(t, env.router, "")
+	require.NoError(t, err)
+	silent.SetPingHandler(func(string) error { return nil })
+	require.NoError(t, silent.SetReadDeadline(time.Now().Add(10*time.Second)))
+	for err == nil {
+		_, _, err = silent.ReadMessage()
+	}
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseAbnormalClosure), "the server should have hung up: %v", err)
+}
+
+func TestLiveFeedCloseDisconnectsClients(t *testing.T) {
+	t.Parallel()
+	feed := NewLiveFeed(LiveOptions{})
+	env := newTestEnvWith(t, Deps{Live: feed})
+	conn, _, err := dialUpdates(t, env.router, "")
+	require.NoError(t, err)
+
+	feed.Close()
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	_, _, err = conn.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseGoingAway), err.Error())
+
+	_, resp, err := dialUpdates(t, env.router, "")
+	require.ErrorIs(t, err, websocket.ErrBadHandshake)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+}
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// LoginThrottle tracks failed logins per email. It is keyed by the email as
+// typed, registered or not, so a lockout says nothing about the account.
+// Implementations must be safe for concurrent use; the in-memory one only
+// covers a single instance.
+type LoginThrottle interface {
+	// Locked reports how long logins for email stay refused, or zero
+	Locked(email string) time.Duration
+	// Fail records a failed login for email
+	Fail(email string)
+	// Reset forgets the failures of email after a successful login
+	Reset(email string)
+}
+
+// memoryLoginThrottle keeps failure counts in process memory
+type memoryLoginThrottle struct {
+	maxFailures int
+	window      time.Duration
+	lockout     time.Duration
+	now         func() time.Time
+
+	mu        sync.Mutex
+	entries   map[string]*loginFailures
+	lastSweep time.Time
+}
+
+type loginFailures struct {
+	count       int
+	first       time.Time
+	lockedUntil time.Time
+}
+
+// newMemoryLoginThrottle locks an email for lockout after maxFailures failures
+// that all fall within window of the first; with maxFailures zero it never does
+func newMemoryLoginThrottle(maxFailures int, window, lockout time.Duration) *memoryLoginThrottle {
+	return &memoryLoginThrottle{maxFailures: maxFailures, window: window, lockout: lockout, now: time.Now, entries: map[string]*loginFailures{}}
+}
+
+func (t *memoryLoginThrottle) Locked(email string) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if e, ok := t.entries[email]; ok {
+		if wait := e.lockedUntil.Sub(t.now()); wait > 0 {
+			return wait
+		}
+	}
+	return 0
+}
+
+func (t *memoryLoginThrottle) Fail(email string) {
+	if t.maxFailures <= 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	t.sweep(now)
+
+	e, ok := t.entries[email]
+	if !ok || now.Sub(e.first) > t.window {
+		e = &loginFailures{first: now}
+		t.entries[email] = e
+	}
+	e.count++
+	if e.count >= t.maxFailures {
+		// The count starts over once the lockout ends
+		e.lockedUntil = now.Add(t.lockout)
+		e.count = 0
+		e.first = e.lockedUntil
+	}
+}
+
+func (t *memoryLoginThrottle) Reset(email string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.entries, email)
+}
+
+// sweep drops, at most once a minute, the entries whose window and lockout
+// have both passed, since a missing entry behaves the same
+func (t *memoryLoginThrottle) sweep(now time.Time) {
+	if now.Sub(t.lastSweep) < time.Minute {
+		return
+	}
+	t.lastSweep = now
+	for email, e := range t.entries {
+		if now.Sub(e.first) > t.window && !now.Before(e.lockedUntil) {
+			delete(t.entries, email)
+		}
+	}
+}
+
+// accountLocked refuses a login for the remaining lockout with a 423 and Retry-After
+func accountLocked(c *gin.Context, wait time.Duration) error {
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	return newAPIError(http.StatusLocked, CodeAccountLocked, "Too many failed logins, try again later")
+}
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// throttleLogins gives env's server a login throttle of 3 failures per
+// minute, locking for 5 minutes, whose clock the test moves with advance
+func throttleLogins(env *testEnv) (advance func(time.Duration)) {
+	throttle := newMemoryLoginThrottle(3, time.Minute, 5*time.Minute)
+	now := time.Now()
+	throttle.now = func() time.Time { return now }
+	env.server.loginThrottle = throttle
+	return func(d time.Duration) { now = now.Add(d) }
+}
+
+// attemptLogin logs in as email with password
+func attemptLogin(env *testEnv, email, password string) *httptest.ResponseRecorder {
+	return sendWithAuth(newAuthTestRouter(env), "POST", "/api/v1/auth/login", `{"email":"`+email+`","password":"`+password+`"}`, "")
+}
+
+func TestLoginLockoutAfterFailures(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	advance := throttleLogins(env)
+	loginAlice(t, env)
+
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusUnauthorized, attemptLogin(env, "alice@example.com", "wrong horse").Code)
+	}
+
+	// Locked out even with the right password, in any case of the email
+	w := attemptLogin(env, "Alice@Example.com", "correct horse")
+	assert.Equal(t, http.StatusLocked, w.Code)
+	assert.Equal(t, "300", w.Header().Get("Retry-After"))
+	assert.Contains(t, w.Body.String(), CodeAccountLocked)
+
+	advance(4 * time.Minute)
+	w = attemptLogin(env, "alice@example.com", "correct horse")
+	assert.Equal(t, http.StatusLocked, w.Code)
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+
+	advance(time.Minute)
+	assert.Equal(t, http.StatusOK, attemptLogin(env, "alice@example.com", "correct horse").Code)
+}
+
+func TestLoginSuccessResetsFailures(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	throttleLogins(env)
+	loginAlice(t, env)
+
+	for round := 0; round < 3; round++ {
+		for i := 0; i < 2; i++ {
+			assert.Equal(t, http.StatusUnauthorized, attemptLogin(env, "alice@example.com", "wrong horse").Code)
+		}
+		assert.Equal(t, http.StatusOK, attemptLogin(env, "alice@example.com", "correct horse").Code)
+	}
+}
+
+func TestLoginFailuresOutsideWindow(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	advance := throttleLogins(env)
+	loginAlice(t, env)
+
+	attemptLogin(env, "alice@example.com", "wrong horse")
+	attemptLogin(env, "alice@example.com", "wrong horse")
+	advance(2 * time.Minute)
+	attemptLogin(env, "alice@example.com", "wrong horse")
+
+	// The first two failures fell out of the window
+	assert.Equal(t, http.StatusOK, attemptLogin(env, "alice@example.com", "correct horse").Code)
+}
+
+func TestLoginLockoutUnknownEmail(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	throttleLogins(env)
+
+	// An unregistered email locks out exactly like a registered one
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusUnauthorized, attemptLogin(env, "nobody@example.com", "wrong horse").Code)
+	}
+	w := attemptLogin(env, "nobody@example.com", "wrong horse")
+	assert.Equal(t, http.StatusLocked, w.Code)
+	assert.Equal(t, "300", w.Header().Get("Retry-After"))
+}
+
+func TestLoginLockoutIsPerEmail(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	throttleLogins(env)
+	loginAlice(t, env)
+
+	for i := 0; i < 3; i++ {
+		attemptLogin(env, "mallory@example.com", "wrong horse")
+	}
+	assert.Equal(t, http.StatusOK, attemptLogin(env, "alice@example.com", "correct horse").Code)
+}
+
+func TestLoginLockoutDisabled(t *testing.T) {
+	t.Parallel()
+	throttle := newMemoryLoginThrottle(0, time.Minute, time.Minute)
+	for i := 0; i < 10; i++ {
+		throttle.Fail("alice@example.com")
+	}
+	assert.Zero(t, throttle.Locked("alice@example.com"))
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"log/slog"
+	"os"
+	"runtime/debug"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ConfigureLogging returns a logger writing one JSON object per line to
+// stderr, from level up (LOG_LEVEL: debug, info, warn or error). It becomes
+// the default, which the storage package and the standard log package log
+// through; give it to the Server as Deps.Logger.
+func ConfigureLogging(level slog.Level) *slog.Logger {
+	logger := slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+	slog.SetDefault(logger)
+	return logger
+}
+
+// Context key under which the Server leaves its logger for requestLog
+const loggerKey = "logger"
+
+// useLogger has requestLog log the requests through the Server's logger
+func (s *Server) useLogger(c *gin.Context) {
+	c.Set(loggerKey, s.logger)
+	c.Next()
+}
+
+// requestLog is the Server's logger tagged with the current request's id, or
+// the default logger's outside the Server's routes
+func requestLog(c *gin.Context) *slog.Logger {
+	logger, ok := c.Value(loggerKey).(*slog.Logger)
+	if !ok {
+		logger = slog.Default()
+	}
+	return logger.With("request_id", requestID(c))
+}
+
+// requestLogger logs one line per request to logger once it has been
+// answered: info for successes, warn for client errors and error for server
+// errors
+func requestLogger(logger *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		switch {
+		case status >= 500:
+			level = slog.LevelError
+		case status >= 400:
+			level = slog.LevelWarn
+		}
+		logger.LogAttrs(c.Request.Context(), level, "request",
+			slog.String("method", c.Request.Method),
+			slog.String("path", c.Request.URL.Path),
+			slog.String("route", c.FullPath()),
+			slog.Int("status", status),
+			slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.String("client_ip", c.ClientIP()),
+			slog.String("request_id", requestID(c)),
+			slog.Int("size", max(c.Writer.Size(), 0)),
+		)
+	}
+}
+
+// logHandlerError logs an error returned by the named handler, with the stack
+// it was returned through, when debug logging is on
+func logHandlerError(c *gin.Context, handler string, err error) {
+	log := requestLog(c)
+	if !log.Enabled(c.Request.Context(), slog.LevelDebug) {
+		return
+	}
+	log.Debug("handler error", "handler", handler, "error", err.Error(), "stack", string(debug.Stack()))
+}
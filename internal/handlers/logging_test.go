@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"Unit-Test/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// captureLogs is a logger writing JSON lines to the returned buffer, from level up
+func captureLogs(level slog.Leveler) (*slog.Logger, *bytes.Buffer) {
+	var buf bytes.Buffer
+	return slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: level})), &buf
+}
+
+// logLines decodes the captured JSON lines whose msg is msg
+func logLines(t *testing.T, buf *bytes.Buffer, msg string) []map[string]interface{} {
+	var lines []map[string]interface{}
+	scanner := bufio.NewScanner(bytes.NewReader(buf.Bytes()))
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var line map[string]interface{}
+		if !assert.NoError(t, json.Unmarshal(scanner.Bytes(), &line), scanner.Text()) {
+			continue
+		}
+		if line["msg"] == msg {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// newLoggedRouter serves the API behind requestLogger, like main does
+func newLoggedRouter(env *testEnv) *gin.Engine {
+	r := gin.New()
+	r.Use(requestLogger(env.server.logger), authenticateTestRequests)
+	env.server.initializeRoutes(r)
+	return r
+}
+
+func TestRequestLogFields(t *testing.T) {
+	t.Parallel()
+	logger, logs := captureLogs(slog.LevelInfo)
+	env := newTestEnvWith(t, Deps{Logger: logger})
+
+	env.db.Create(&models.User{Name: "Alice", Email: "alice@example.com"})
+	router := newLoggedRouter(env)
+
+	for _, tc := range []struct {
+		url, route, level string
+		status            float64
+	}{
+		{"/api/v1/users/1", "/api/v1/users/:id", "INFO", 200},
+		{"/api/v1/users/99", "/api/v1/users/:id", "WARN", 404},
+	} {
+		logs.Reset()
+		req, _ := http.NewRequest("GET", tc.url, nil)
+		req.Header.Set("X-Request-ID", "log-me")
+		req.RemoteAddr = "192.0.2.7:4321"
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		lines := logLines(t, logs, "request")
+		if !assert.Len(t, lines, 1, tc.url) {
+			continue
+		}
+		line := lines[0]
+		assert.Equal(t, tc.level, line["level"])
+		assert.Equal(t, "GET", line["method"])
+		assert.Equal(t, tc.url, line["path"])
+		assert.Equal(t, tc.route, line["route"])
+		assert.Equal(t, tc.status, line["status"])
+		assert.Equal(t, "192.0.2.7", line["client_ip"])
+		assert.Equal(t, "log-me", line["request_id"])
+		assert.Equal(t, float64(w.Body.Len()), line["size"])
+		assert.Contains(t, line, "latency_ms")
+	}
+}
+
+func TestHandlerErrorsLoggedAtDebug(t *testing.T) {
+	t.Parallel()
+	level := new(slog.LevelVar)
+	level.Set(slog.LevelDebug)
+	logger, logs := captureLogs(level)
+	env := newTestEnvWith(t, Deps{Logger: logger})
+
+	router := newLoggedRouter(env)
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/v1/users/99/addresses", nil))
+	lines := logLines(t, logs, "handler error")
+	if assert.Len(t, lines, 1) {
+		assert.Equal(t, "User not found: record not found", lines[0]["error"])
+		assert.Equal(t, "Unit-Test/internal/handlers.(*Server).getAddresses", lines[0]["handler"])
+		assert.Contains(t, lines[0]["stack"], "Unit-Test/internal/handlers.handle")
+		assert.NotEmpty(t, lines[0]["request_id"])
+	}
+
+	level.Set(slog.LevelInfo)
+	logs.Reset()
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/v1/users/99/addresses", nil))
+	assert.Empty(t, logLines(t, logs, "handler error"))
+}
+
+func TestConfigureLoggingSetsLevel(t *testing.T) {
+	saved := slog.Default()
+	defer slog.SetDefault(saved)
+
+	logger := ConfigureLogging(slog.LevelDebug)
+	assert.True(t, logger.Enabled(context.Background(), slog.LevelDebug))
+	assert.Same(t, logger, slog.Default())
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"strconv"
+	"time"
+
+	"Unit-Test/internal/jobs"
+	"Unit-Test/internal/purge"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"gorm.io/gorm"
+)
+
+// metricsRegistry holds everything /metrics exposes. It is separate from
+// prometheus.DefaultRegisterer so only our own collectors end up there.
+var metricsRegistry = prometheus.NewRegistry()
+
+var (
+	httpRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Time taken to serve HTTP requests.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	httpRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests served.",
+	}, []string{"method", "route", "status"})
+
+	dbQueriesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "db_queries_total",
+		Help: "Database statements issued through GORM.",
+	}, []string{"operation", "table"})
+
+	cacheRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_cache_requests_total",
+		Help: "Reads looked up in the response cache, by result: hit or miss.",
+	}, []string{"route", "result"})
+)
+
+func init() {
+	metricsRegistry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequestDuration,
+		httpRequestsTotal,
+		dbQueriesTotal,
+		cacheRequestsTotal,
+		purge.UsersPurged,
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "http_requests_in_flight",
+			Help: "HTTP requests being served right now.",
+		}, func() float64 { return float64(inFlightRequests.Load()) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "http_panics_recovered_total",
+			Help: "Handler panics turned into a 500.",
+		}, func() float64 { return float64(panicsRecovered.Value()) }),
+	)
+	metricsRegistry.MustRegister(jobs.Collectors()...)
+}
+
+// unmatchedRoute labels requests that matched no route, so scanners probing
+// random paths cannot blow up the number of series
+const unmatchedRoute = "unmatched"
+
+// recordMetrics observes every request's duration and status under its route
+// pattern (/api/v1/users/:id), never the raw path
+func recordMetrics(c *gin.Context) {
+	start := time.Now()
+	c.Next()
+
+	route := c.FullPath()
+	if route == "" {
+		route = unmatchedRoute
+	}
+	status := strconv.Itoa(c.Writer.Status())
+	httpRequestDuration.WithLabelValues(c.Request.Method, route, status).Observe(time.Since(start).Seconds())
+	httpRequestsTotal.WithLabelValues(c.Request.Method, route, status).Inc()
+}
+
+// metricsHandler serves metricsRegistry in the Prometheus text format
+// @Summary Prometheus metrics
+// @Description Scraped by Prometheus; behind Basic Auth when BASIC_AUTH_USER and BASIC_AUTH_PASSWORD are set.
+// @Tags Operations
+// @Produce plain
+// @Success 200 {string} string "Metrics in the Prometheus text format"
+// @Failure 401
+// @Security BasicAuth
+// @Router /metrics [get]
+func metricsHandler() gin.HandlerFunc {
+	return gin.WrapH(promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{}))
+}
+
+// InstrumentQueries counts the statements tx issues in dbQueriesTotal
+func InstrumentQueries(tx *gorm.DB) error {
+	count := func(operation string) func(*gorm.DB) {
+		return func(tx *gorm.DB) {
+			dbQueriesTotal.WithLabelValues(operation, tx.Statement.Table).Inc()
+		}
+	}
+	callbacks := tx.Callback()
+	for _, err := range []error{
+		callbacks.Create().After("gorm:create").Register("metrics:create", count("create")),
+		callbacks.Query().After("gorm:query").Register("metrics:query", count("query")),
+		callbacks.Update().After("gorm:update").Register("metrics:update", count("update")),
+		callbacks.Delete().After("gorm:delete").Register("metrics:delete", count("delete")),
+		callbacks.Row().After("gorm:row").Register("metrics:row", count("row")),
+		callbacks.Raw().After("gorm:raw").Register("metrics:raw", count("raw")),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
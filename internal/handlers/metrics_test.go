@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"Unit-Test/internal/jobs"
+	"Unit-Test/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// scrapeMetrics returns the /metrics body served by router
+func scrapeMetrics(t *testing.T, router *gin.Engine) string {
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	return w.Body.String()
+}
+
+func TestMetricsRecordRequestsByRoute(t *testing.T) {
+	env := newTestEnv(t)
+
+	env.db.Create(&models.User{Name: "Alice", Email: "alice@example.com"})
+
+	send(env, "GET", "/api/v1/users", "")
+	send(env, "GET", "/api/v1/users/1", "")
+	send(env, "GET", "/api/v1/users/42", "")
+	send(env, "GET", "/no/such/path", "")
+
+	body := scrapeMetrics(t, env.router)
+	assert.Contains(t, body, `http_requests_total{method="GET",route="/api/v1/users",status="200"}`)
+	assert.Contains(t, body, `http_requests_total{method="GET",route="/api/v1/users/:id",status="200"}`)
+	assert.Contains(t, body, `http_requests_total{method="GET",route="/api/v1/users/:id",status="404"}`)
+	assert.Contains(t, body, `http_requests_total{method="GET",route="unmatched",status="404"}`)
+	assert.Contains(t, body, `http_request_duration_seconds_bucket{method="GET",route="/api/v1/users/:id",status="200",le="0.005"}`)
+	assert.Contains(t, body, `http_request_duration_seconds_count{method="GET",route="/api/v1/users",status="200"}`)
+	// Raw paths never become labels
+	assert.NotContains(t, body, `route="/api/v1/users/1"`)
+	assert.NotContains(t, body, `route="/no/such/path"`)
+}
+
+func TestMetricsInFlightAndPanics(t *testing.T) {
+	env := newTestEnv(t)
+	waitForIdle(t)
+
+	body := scrapeMetrics(t, env.router)
+	// The scrape itself is in flight while it is served
+	assert.Contains(t, body, "http_requests_in_flight 1\n")
+	assert.Contains(t, body, "# TYPE http_panics_recovered_total counter")
+	assert.Contains(t, body, "# TYPE go_goroutines gauge")
+}
+
+func TestMetricsCountQueries(t *testing.T) {
+	env := newTestEnv(t)
+
+	send(env, "POST", "/api/v1/users", `{"name":"Alice","email":"alice@example.com"}`)
+	send(env, "GET", "/api/v1/users", "")
+
+	body := scrapeMetrics(t, env.router)
+	assert.Contains(t, body, `db_queries_total{operation="create",table="users"}`)
+	assert.Contains(t, body, `db_queries_total{operation="query",table="users"}`)
+}
+
+// brokenJob fails for good on its first attempt
+type brokenJob struct{}
+
+func (brokenJob) Kind() string              { return "test.broken" }
+func (brokenJob) Run(context.Context) error { return jobs.Permanent(errors.New("broken")) }
+
+func TestMetricsJobs(t *testing.T) {
+	env := newTestEnv(t)
+	// A queue of each run's own, as the counters outlive it with -count
+	name := fmt.Sprintf("metrics_test_%d", testDBs.Add(1))
+	queue := jobs.NewQueue(jobs.Options{Name: name})
+	require.NoError(t, queue.Enqueue(brokenJob{}))
+	require.NoError(t, queue.Close(context.Background()))
+
+	body := scrapeMetrics(t, env.router)
+	assert.Contains(t, body, `jobs_failed_total{kind="test.broken",queue="`+name+`"} 1`)
+	assert.Contains(t, body, `jobs_queued{queue="`+name+`"} 0`)
+	assert.Contains(t, body, `jobs_active{queue="`+name+`"} 0`)
+}
+
+func TestMetricsBehindBasicAuth(t *testing.T) {
+	cfg := testConfig()
+	cfg.BasicAuthUser, cfg.BasicAuthPassword = "admin", "s3cret"
+	env := newTestEnvWith(t, Deps{Config: cfg})
+
+	router := newAuthTestRouter(env)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	req.SetBasicAuth("admin", "s3cret")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "http_requests_total")
+}
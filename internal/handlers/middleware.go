@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Default request body limit (1MB), overridable via MAX_BODY_BYTES
+const defaultMaxBodyBytes = 1 << 20
+
+// Routes that enforce their own body limit, such as the larger one for avatars.
+// A MaxBytesReader can only be tightened, so these must skip the default one.
+var ownBodyLimitRoutes = map[string]bool{
+	"/users/:id/avatar": true,
+}
+
+// limitRequestBody caps the request body at limit bytes. Reading past the limit
+// fails with *http.MaxBytesError, which handlers report via isBodyTooLarge.
+func limitRequestBody(limit int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Body != nil && !ownBodyLimitRoutes[routeKey(c)] {
+			c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+		}
+		c.Next()
+	}
+}
+
+// Routes allowed to outlive Config.RequestTimeout: the export and the stream send
+// however many users there are, the WebSocket stays open until either side
+// closes it, and a CPU profile samples for as long as it is asked to
+var longRunningRoutes = map[string]bool{
+	"/users/export":      true,
+	"/users/stream":      true,
+	"/users/ws":          true,
+	"/debug/pprof/*name": true,
+}
+
+// limitRequestTime cancels the request's context after timeout, unless it is zero. Queries run
+// through dbFor then fail with context.DeadlineExceeded, which handleErrors
+// answers with a 504, instead of holding on to a connection indefinitely.
+func limitRequestTime(timeout time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if timeout <= 0 || longRunningRoutes[routeKey(c)] {
+			c.Next()
+			return
+		}
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
+// setSecurityHeaders adds the security headers of cfg to every response, and
+// its Strict-Transport-Security when the request arrived over TLS. Each can be
+// overridden through its environment variable, or dropped by setting that
+// variable to an empty string, e.g. HEADER_X_FRAME_OPTIONS= to allow
+// embedding the API in a frame.
+func setSecurityHeaders(cfg Config) gin.HandlerFunc {
+	headers := []struct{ name, value string }{
+		{"X-Content-Type-Options", cfg.HeaderXContentTypeOptions},
+		{"X-Frame-Options", cfg.HeaderXFrameOptions},
+		{"Referrer-Policy", cfg.HeaderReferrerPolicy},
+	}
+	return func(c *gin.Context) {
+		for _, h := range headers {
+			if h.value != "" {
+				c.Header(h.name, h.value)
+			}
+		}
+		if c.Request.TLS != nil && cfg.HeaderStrictTransportSecurity != "" {
+			c.Header("Strict-Transport-Security", cfg.HeaderStrictTransportSecurity)
+		}
+		c.Next()
+	}
+}
+
+// isBodyTooLarge reports whether err comes from reading past the body limit
+func isBodyTooLarge(err error) bool {
+	var maxErr *http.MaxBytesError
+	return errors.As(err, &maxErr)
+}
+
+// bodyTooLargeMessage tells the client the body limit err ran into
+func bodyTooLargeMessage(err error) string {
+	var maxErr *http.MaxBytesError
+	errors.As(err, &maxErr)
+	return "Request body must be at most " + strconv.FormatInt(maxErr.Limit, 10) + " bytes"
+}
@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"Unit-Test/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestRequestBodyTooLarge(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	name := strings.Repeat("a", int(env.server.cfg.MaxBodyBytes))
+	req, _ := http.NewRequest("POST", "/api/v1/users", bytes.NewBufferString(`{"name":"`+name+`","email":"big@example.com"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	var resp models.ErrorResponse
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	assert.Equal(t, CodePayloadTooLarge, resp.Code)
+
+	var count int64
+	env.db.Model(&models.User{}).Count(&count)
+	assert.Equal(t, int64(0), count)
+}
+
+func TestBulkBodyTooLarge(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	w, _ := postBulk(env, "/api/v1/users/bulk", `[{"name":"`+strings.Repeat("a", int(env.server.cfg.MaxBodyBytes))+`","email":"big@example.com"}]`)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+}
+
+func TestImportBodyTooLarge(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	w, _ := postCSV(env, "name,email\n"+strings.Repeat("Alice,alice@example.com\n", int(env.server.cfg.MaxBodyBytes)/20))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+}
+
+func TestNormalBodyUnaffectedByLimit(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	req, _ := http.NewRequest("POST", "/api/v1/users", bytes.NewBufferString(`{"name":"Alice","email":"alice@example.com"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+}
+
+func TestAvatarUploadHasItsOwnLimit(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	env.db.Create(&models.User{Name: "Dora", Email: "dora@example.com"})
+
+	// Larger than the default body limit, but within the avatar limit
+	png, _ := os.ReadFile("testdata/avatar.png")
+	w := putAvatar(t, env, "/api/v1/users/1/avatar", append(png, make([]byte, env.server.cfg.MaxBodyBytes+1024)...))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestSecurityHeaders(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	for _, url := range []string{"/api/v1/users", "/api/v1/users/99", "/swagger/index.html"} {
+		req, _ := http.NewRequest("GET", url, nil)
+		w := httptest.NewRecorder()
+		env.router.ServeHTTP(w, req)
+
+		assert.Equal(t, "nosniff", w.Header().Get("X-Content-Type-Options"), url)
+		assert.Equal(t, "DENY", w.Header().Get("X-Frame-Options"), url)
+		assert.Equal(t, "no-referrer", w.Header().Get("Referrer-Policy"), url)
+		// Plain HTTP must not pin clients to HTTPS
+		assert.Empty(t, w.Header().Get("Strict-Transport-Security"), url)
+	}
+}
+
+func TestSecurityHeadersHSTSOverTLS(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	req, _ := http.NewRequest("GET", "/api/v1/users", nil)
+	req.TLS = &tls.ConnectionState{}
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+
+	assert.Equal(t, "max-age=63072000; includeSubDomains", w.Header().Get("Strict-Transport-Security"))
+}
+
+func TestSecurityHeadersOverridden(t *testing.T) {
+	t.Parallel()
+	cfg := testConfig()
+	cfg.HeaderXFrameOptions = ""                                 // X-Frame-Options disabled
+	cfg.HeaderReferrerPolicy = "strict-origin-when-cross-origin" // Referrer-Policy changed
+
+	r := gin.New()
+	r.Use(setSecurityHeaders(cfg))
+	r.GET("/ping", func(c *gin.Context) { c.String(200, "pong") })
+	req, _ := http.NewRequest("GET", "/ping", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, "nosniff", w.Header().Get("X-Content-Type-Options"))
+	assert.Empty(t, w.Header().Get("X-Frame-Options"))
+	assert.Equal(t, "strict-origin-when-cross-origin", w.Header().Get("Referrer-Policy"))
+}
+
+// stallTable makes queries on table hang like a stuck database would, until
+// their context is done. A query without the request's context would only be
+// released by the safety limit, and fail differently.
+func stallTable(t *testing.T, env *testEnv, table string) {
+	stall := func(tx *gorm.DB) {
+		if tx.Statement.Table != table {
+			return
+		}
+		select {
+		case <-tx.Statement.Context.Done():
+			_ = tx.AddError(tx.Statement.Context.Err())
+		case <-time.After(5 * time.Second):
+			_ = tx.AddError(errors.New("query was never cancelled"))
+		}
+	}
+	name := "test:stall_" + table
+	_ = env.db.Callback().Query().Before("gorm:query").Register(name, stall)
+	t.Cleanup(func() { _ = env.db.Callback().Query().Remove(name) })
+}
+
+// newTimeoutEnv builds a testEnv whose requests time out after timeout
+func newTimeoutEnv(t *testing.T, timeout time.Duration) *testEnv {
+	cfg := testConfig()
+	cfg.RequestTimeout = timeout
+	return newTestEnvWith(t, Deps{Config: cfg})
+}
+
+func TestRequestTimeoutAnswers504(t *testing.T) {
+	t.Parallel()
+	env := newTimeoutEnv(t, 50*time.Millisecond)
+
+	seedErrorCases(env)
+	stallTable(t, env, "users")
+	router := newAuthTestRouter(env)
+
+	// Handlers reporting through handleErrors, and ones writing their own errors
+	for _, url := range []string{"/api/v1/users/search?q=al", "/api/v1/users/count", "/api/v1/users", "/api/v1/users/1"} {
+		start := time.Now()
+		w := sendWithAuth(router, "GET", url, "", "")
+
+		assert.Equal(t, http.StatusGatewayTimeout, w.Code, url)
+		assert.Contains(t, w.Body.String(), `"code":"TIMEOUT"`, url)
+		assert.Less(t, time.Since(start), time.Second, url)
+	}
+}
+
+func TestCancelledRequestAnswers499(t *testing.T) {
+	t.Parallel()
+	env := newTimeoutEnv(t, time.Minute)
+
+	seedErrorCases(env)
+	stallTable(t, env, "users")
+	router := newAuthTestRouter(env)
+
+	for _, url := range []string{"/api/v1/users/search?q=al", "/api/v1/users"} {
+		// The client hangs up while the query runs
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(20*time.Millisecond, cancel)
+		req, _ := http.NewRequestWithContext(ctx, "GET", url, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, StatusClientClosedRequest, w.Code, url)
+		assert.Contains(t, w.Body.String(), `"code":"CLIENT_CLOSED_REQUEST"`, url)
+	}
+}
+
+func TestRequestTimeoutSkipsLongRunningRoutes(t *testing.T) {
+	t.Parallel()
+	hasDeadline := func(c *gin.Context) {
+		_, ok := c.Request.Context().Deadline()
+		c.JSON(http.StatusOK, ok)
+	}
+	r := gin.New()
+	r.Use(limitRequestTime(time.Minute))
+	r.GET("/api/v1/users/export", hasDeadline)
+	r.GET("/api/v1/users/count", hasDeadline)
+
+	for url, expected := range map[string]string{"/api/v1/users/export": "false", "/api/v1/users/count": "true"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+		assert.Equal(t, expected, w.Body.String(), url)
+	}
+
+	// Zero disables the limit
+	r = gin.New()
+	r.Use(limitRequestTime(0))
+	r.GET("/api/v1/users/count", hasDeadline)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/users/count", nil))
+	assert.Equal(t, "false", w.Body.String())
+}
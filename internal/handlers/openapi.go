@@ -0,0 +1,93 @@
+package handlers
+
+//go:generate go run ../openapi/gen -general ../../main.go .
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+
+	"Unit-Test/internal/openapi"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/gin-gonic/gin"
+	swaggerFiles "github.com/swaggo/files"
+	ginSwagger "github.com/swaggo/gin-swagger"
+)
+
+// swaggerServerURL is the URL of the API the OpenAPI document gives, from
+// SWAGGER_HOST and SWAGGER_BASE_PATH: relative to the document, unless host
+// names the host
+func swaggerServerURL(host, basePath string) string {
+	url := strings.TrimSuffix(basePath, "/")
+	if host != "" {
+		// Without a scheme, clients use the document's
+		url = "//" + host + url
+	}
+	if url == "" {
+		url = "/"
+	}
+	return url
+}
+
+// buildOpenAPI is the OpenAPI document of routes served at serverURL, from the
+// operations generated off the handlers' annotations
+func buildOpenAPI(routes gin.RoutesInfo, serverURL string) (*openapi3.T, error) {
+	doc, err := openapi.Build(apiInfo, routes, apiOperations)
+	if err != nil {
+		return nil, err
+	}
+	doc.Servers = openapi3.Servers{{URL: serverURL}}
+	if errorResponse, ok := doc.Components.Schemas["models.ErrorResponse"]; ok {
+		code := errorResponse.Value.Properties["code"].Value
+		for _, c := range apiErrorCodes {
+			code.Enum = append(code.Enum, c)
+		}
+	}
+	return doc, nil
+}
+
+// serveOpenAPI serves the OpenAPI document of the routes of r at serverURL,
+// built on the first request, once they are all registered
+// @Summary OpenAPI document
+// @Description The OpenAPI 3 document of every route, which the Swagger UI shows. Served when ENABLE_SWAGGER is true, behind Basic Auth when it is configured.
+// @Tags Operations
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Failure 401
+// @Failure 500 {object} models.ErrorResponse
+// @Security BasicAuth
+// @Router /openapi.json [get]
+func serveOpenAPI(r *gin.Engine, serverURL string) gin.HandlerFunc {
+	document := sync.OnceValues(func() ([]byte, error) {
+		doc, err := buildOpenAPI(r.Routes(), serverURL)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(doc)
+	})
+	return handle(func(c *gin.Context) error {
+		body, err := document()
+		if err != nil {
+			return err
+		}
+		c.Data(http.StatusOK, "application/json; charset=utf-8", body)
+		return nil
+	})
+}
+
+// swaggerUI serves the Swagger UI, showing /openapi.json
+// @Summary Swagger UI
+// @Description The Swagger UI and its assets. Served when ENABLE_SWAGGER is true, behind Basic Auth when it is configured.
+// @Tags Operations
+// @Produce html
+// @Param any path string true "Page or asset, such as /index.html"
+// @Success 200 {string} string "The page or asset"
+// @Failure 401
+// @Failure 404
+// @Security BasicAuth
+// @Router /swagger/{any} [get]
+func swaggerUI() gin.HandlerFunc {
+	return ginSwagger.WrapHandler(swaggerFiles.Handler, ginSwagger.URL("/openapi.json"))
+}
@@ -0,0 +1,1058 @@
+// Code generated by internal/openapi/gen from the swag annotations; DO NOT EDIT.
+
+package handlers
+
+import (
+	"reflect"
+
+	"Unit-Test/internal/models"
+	"Unit-Test/internal/openapi"
+)
+
+// apiInfo is the general information annotated on main
+var apiInfo = openapi.Info{
+	Title:       "User API",
+	Version:     "1.0",
+	Description: "This is a simple API for managing users in a PostgreSQL database.",
+	Contact:     openapi.Contact{Name: "API Support", URL: "http://localhost:8000/support", Email: "support@localhost.com"},
+	SecuritySchemes: []openapi.SecurityScheme{
+		{Name: "BearerAuth", Type: "apikey", In: "header", Param: "Authorization", Description: "JWT sent as \"Bearer <token>\"; required for every POST, PUT, PATCH and DELETE"},
+		{Name: "ApiKeyAuth", Type: "apikey", In: "header", Param: "X-API-Key", Description: "API key created under /users/{id}/api-keys; accepted wherever BearerAuth is"},
+		{Name: "BasicAuth", Type: "basic", Description: "BASIC_AUTH_USER and BASIC_AUTH_PASSWORD, for the docs, metrics and profiles when both are set"},
+	},
+}
+
+// apiOperations are the operations annotated on the handlers
+var apiOperations = []openapi.Operation{
+	{
+		Routes:      []string{"GET /api/v1/users/{id}/addresses", "GET /api/v2/users/{id}/addresses"},
+		Summary:     "Get user addresses",
+		Description: "Retrieve all addresses of a user",
+		Tags:        []string{"Addresses"},
+		Produce:     []string{"application/json"},
+		Params: []openapi.Param{
+			{Name: "id", In: "path", Type: reflect.TypeFor[int](), Required: true, Description: "User ID"},
+		},
+		Responses: []openapi.Response{
+			{Status: 200, Type: reflect.TypeFor[[]models.Address]()},
+			{Status: 400, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 404, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 500, Type: reflect.TypeFor[models.ErrorResponse]()},
+		},
+	},
+	{
+		Routes:      []string{"POST /api/v1/users/{id}/addresses", "POST /api/v2/users/{id}/addresses"},
+		Summary:     "Create user address",
+		Description: "Add a mailing address to a user. Only the user themselves or an admin may do this.",
+		Tags:        []string{"Addresses"},
+		Accept:      []string{"application/json"},
+		Produce:     []string{"application/json"},
+		Params: []openapi.Param{
+			{Name: "id", In: "path", Type: reflect.TypeFor[int](), Required: true, Description: "User ID"},
+			{Name: "address", In: "body", Type: reflect.TypeFor[models.Address](), Required: true, Description: "New address"},
+		},
+		Responses: []openapi.Response{
+			{Status: 201, Type: reflect.TypeFor[models.Address]()},
+			{Status: 400, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 403, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 404, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 500, Type: reflect.TypeFor[models.ErrorResponse]()},
+		},
+		Security: []string{"BearerAuth"},
+	},
+	{
+		Routes:      []string{"PUT /api/v1/users/{id}/addresses/{addr_id}", "PUT /api/v2/users/{id}/addresses/{addr_id}"},
+		Summary:     "Update user address",
+		Description: "Replace an address of a user. The address must belong to that user. Only the user themselves or an admin may do this.",
+		Tags:        []string{"Addresses"},
+		Accept:      []string{"application/json"},
+		Produce:     []string{"application/json"},
+		Params: []openapi.Param{
+			{Name: "id", In: "path", Type: reflect.TypeFor[int](), Required: true, Description: "User ID"},
+			{Name: "addr_id", In: "path", Type: reflect.TypeFor[int](), Required: true, Description: "Address ID"},
+			{Name: "address", In: "body", Type: reflect.TypeFor[models.Address](), Required: true, Description: "Updated address"},
+		},
+		Responses: []openapi.Response{
+			{Status: 200, Type: reflect.TypeFor[models.Address]()},
+			{Status: 400, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 403, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 404, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 500, Type: reflect.TypeFor[models.ErrorResponse]()},
+		},
+		Security: []string{"BearerAuth"},
+	},
+	{
+		Routes:      []string{"DELETE /api/v1/users/{id}/addresses/{addr_id}", "DELETE /api/v2/users/{id}/addresses/{addr_id}"},
+		Summary:     "Delete user address",
+		Description: "Delete an address of a user. The address must belong to that user. Only the user themselves or an admin may do this.",
+		Tags:        []string{"Addresses"},
+		Produce:     []string{"application/json"},
+		Params: []openapi.Param{
+			{Name: "id", In: "path", Type: reflect.TypeFor[int](), Required: true, Description: "User ID"},
+			{Name: "addr_id", In: "path", Type: reflect.TypeFor[int](), Required: true, Description: "Address ID"},
+		},
+		Responses: []openapi.Response{
+			{Status: 200, Type: reflect.TypeFor[map[string]string](), Description: "Confirmation message in v1"},
+			{Status: 204, Description: "No content in v2"},
+			{Status: 400, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 403, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 404, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 500, Type: reflect.TypeFor[models.ErrorResponse]()},
+		},
+		Security: []string{"BearerAuth"},
+	},
+	{
+		Routes:      []string{"POST /api/v1/admin/purge", "POST /api/v2/admin/purge"},
+		Summary:     "Purge deleted users",
+		Description: "Delete for good the users soft-deleted before the given time, with their posts, addresses, API keys and tokens. Without before, purges those deleted longer than PURGE_RETENTION ago, as the scheduled purge does. Admins only.",
+		Tags:        []string{"Admin"},
+		Produce:     []string{"application/json"},
+		Params: []openapi.Param{
+			{Name: "before", In: "query", Type: reflect.TypeFor[string](), Description: "RFC 3339 time, e.g. 2024-01-02T15:04:05Z"},
+		},
+		Responses: []openapi.Response{
+			{Status: 200, Type: reflect.TypeFor[PurgeResponse]()},
+			{Status: 400, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 401, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 403, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 500, Type: reflect.TypeFor[models.ErrorResponse]()},
+		},
+		Security: []string{"BearerAuth"},
+	},
+	{
+		Routes:      []string{"GET /api/v1/users/{id}/api-keys", "GET /api/v2/users/{id}/api-keys"},
+		Summary:     "Get user API keys",
+		Description: "Retrieve the API keys of a user. The keys themselves are never returned. Only the user themselves or an admin may do this.",
+		Tags:        []string{"API Keys"},
+		Produce:     []string{"application/json"},
+		Params: []openapi.Param{
+			{Name: "id", In: "path", Type: reflect.TypeFor[int](), Required: true, Description: "User ID"},
+		},
+		Responses: []openapi.Response{
+			{Status: 200, Type: reflect.TypeFor[[]models.APIKey]()},
+			{Status: 400, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 403, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 404, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 500, Type: reflect.TypeFor[models.ErrorResponse]()},
+		},
+		Security: []string{"BearerAuth"},
+	},
+	{
+		Routes:      []string{"POST /api/v1/users/{id}/api-keys", "POST /api/v2/users/{id}/api-keys"},
+		Summary:     "Create user API key",
+		Description: "Create an API key for a user. The key is only returned in this response; send it in the X-API-Key header. Only the user themselves or an admin may do this.",
+		Tags:        []string{"API Keys"},
+		Accept:      []string{"application/json"},
+		Produce:     []string{"application/json"},
+		Params: []openapi.Param{
+			{Name: "id", In: "path", Type: reflect.TypeFor[int](), Required: true, Description: "User ID"},
+			{Name: "key", In: "body", Type: reflect.TypeFor[models.APIKey](), Required: true, Description: "Key label"},
+		},
+		Responses: []openapi.Response{
+			{Status: 201, Type: reflect.TypeFor[CreatedAPIKey]()},
+			{Status: 400, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 403, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 404, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 500, Type: reflect.TypeFor[models.ErrorResponse]()},
+		},
+		Security: []string{"BearerAuth"},
+	},
+	{
+		Routes:      []string{"DELETE /api/v1/users/{id}/api-keys/{key_id}", "DELETE /api/v2/users/{id}/api-keys/{key_id}"},
+		Summary:     "Revoke user API key",
+		Description: "Delete an API key of a user. Requests using it are rejected from then on. Only the user themselves or an admin may do this.",
+		Tags:        []string{"API Keys"},
+		Produce:     []string{"application/json"},
+		Params: []openapi.Param{
+			{Name: "id", In: "path", Type: reflect.TypeFor[int](), Required: true, Description: "User ID"},
+			{Name: "key_id", In: "path", Type: reflect.TypeFor[int](), Required: true, Description: "API key ID"},
+		},
+		Responses: []openapi.Response{
+			{Status: 200, Type: reflect.TypeFor[map[string]string](), Description: "Confirmation message in v1"},
+			{Status: 204, Description: "No content in v2"},
+			{Status: 400, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 403, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 404, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 500, Type: reflect.TypeFor[models.ErrorResponse]()},
+		},
+		Security: []string{"BearerAuth"},
+	},
+	{
+		Routes:      []string{"GET /api/v1/users/{id}/audit", "GET /api/v2/users/{id}/audit"},
+		Summary:     "Get user audit log",
+		Description: "Every create, update, delete and restore of a user, newest first. Admins only.",
+		Tags:        []string{"Users"},
+		Produce:     []string{"application/json"},
+		Params: []openapi.Param{
+			{Name: "id", In: "path", Type: reflect.TypeFor[int](), Required: true, Description: "User ID"},
+			{Name: "page", In: "query", Type: reflect.TypeFor[int](), Description: "Page number (1-based)"},
+			{Name: "limit", In: "query", Type: reflect.TypeFor[int](), Description: "Number of entries per page (default 20, at most 100)"},
+		},
+		Responses: []openapi.Response{
+			{Status: 200, Type: reflect.TypeFor[[]models.AuditLog](), Description: "In v1"},
+			{Status: 200, Type: reflect.TypeFor[ListEnvelope](), Description: "In v2"},
+			{Status: 400, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 403, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 404, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 500, Type: reflect.TypeFor[models.ErrorResponse]()},
+		},
+		Security: []string{"BearerAuth"},
+	},
+	{
+		Routes:      []string{"POST /api/v1/auth/register", "POST /api/v2/auth/register"},
+		Summary:     "Register",
+		Description: "Create a user that can log in with the given password (8 to 72 characters).\nA token to verify the email with is sent to it.",
+		Tags:        []string{"Auth"},
+		Accept:      []string{"application/json"},
+		Produce:     []string{"application/json"},
+		Params: []openapi.Param{
+			{Name: "user", In: "body", Type: reflect.TypeFor[RegisterRequest](), Required: true, Description: "Account details"},
+		},
+		Responses: []openapi.Response{
+			{Status: 201, Type: reflect.TypeFor[models.User]()},
+			{Status: 400, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 409, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 500, Type: reflect.TypeFor[models.ErrorResponse]()},
+		},
+	},
+	{
+		Routes:      []string{"POST /api/v1/auth/login", "POST /api/v2/auth/login"},
+		Summary:     "Log in",
+		Description: "Exchange an email and password for a bearer token and a refresh token",
+		Tags:        []string{"Auth"},
+		Accept:      []string{"application/json"},
+		Produce:     []string{"application/json"},
+		Params: []openapi.Param{
+			{Name: "credentials", In: "body", Type: reflect.TypeFor[LoginRequest](), Required: true, Description: "Credentials"},
+		},
+		Responses: []openapi.Response{
+			{Status: 200, Type: reflect.TypeFor[LoginResponse]()},
+			{Status: 400, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 401, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 423, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 500, Type: reflect.TypeFor[models.ErrorResponse]()},
+		},
+	},
+	{
+		Routes:      []string{"PUT /api/v1/users/{id}/avatar", "PUT /api/v2/users/{id}/avatar"},
+		Summary:     "Upload avatar",
+		Description: "Upload a PNG or JPEG avatar as the \"avatar\" field of a multipart form. The default size limit is 2MB. Only the user themselves or an admin may do this.",
+		Tags:        []string{"Users"},
+		Accept:      []string{"multipart/form-data"},
+		Produce:     []string{"application/json"},
+		Params: []openapi.Param{
+			{Name: "id", In: "path", Type: reflect.TypeFor[int](), Required: true, Description: "User ID"},
+			{Name: "avatar", In: "formData", Type: reflect.TypeFor[openapi.File](), Required: true, Description: "PNG or JPEG image"},
+		},
+		Responses: []openapi.Response{
+			{Status: 200, Type: reflect.TypeFor[models.User]()},
+			{Status: 400, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 403, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 404, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 413, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 415, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 500, Type: reflect.TypeFor[models.ErrorResponse]()},
+		},
+		Security: []string{"BearerAuth"},
+	},
+	{
+		Routes:      []string{"GET /api/v1/users/{id}/avatar", "GET /api/v2/users/{id}/avatar"},
+		Summary:     "Get avatar",
+		Description: "Return the user's avatar image",
+		Tags:        []string{"Users"},
+		Produce:     []string{"image/png", "image/jpeg"},
+		Params: []openapi.Param{
+			{Name: "id", In: "path", Type: reflect.TypeFor[int](), Required: true, Description: "User ID"},
+		},
+		Responses: []openapi.Response{
+			{Status: 200, Type: reflect.TypeFor[openapi.File]()},
+			{Status: 400, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 404, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 500, Type: reflect.TypeFor[models.ErrorResponse]()},
+		},
+	},
+	{
+		Routes:      []string{"POST /api/v1/graphql", "POST /api/v2/graphql"},
+		Summary:     "GraphQL",
+		Description: "Query the users with field selection and their posts inlined, or change them. Reads follow the\nREST API's authentication; mutations need a caller, and deleteUser an admin. Failures come back as\nGraphQL errors with a 200, their extensions.code the one the REST API answers with.\nIntrospection is only enabled with GRAPHQL_INTROSPECTION=true.",
+		Tags:        []string{"GraphQL"},
+		Accept:      []string{"application/json"},
+		Produce:     []string{"application/json"},
+		Params: []openapi.Param{
+			{Name: "query", In: "body", Type: reflect.TypeFor[GraphQLRequest](), Required: true, Description: "Query, operation name and variables"},
+		},
+		Responses: []openapi.Response{
+			{Status: 200, Type: reflect.TypeFor[GraphQLResponse]()},
+			{Status: 400, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 401, Type: reflect.TypeFor[models.ErrorResponse]()},
+		},
+		Security: []string{"BearerAuth"},
+	},
+	{
+		Routes:      []string{"GET /healthz"},
+		Summary:     "Liveness check",
+		Description: "Report whether the process is up and the database answers a ping. Needs no authentication and is not rate limited.",
+		Tags:        []string{"Health"},
+		Produce:     []string{"application/json"},
+		Responses: []openapi.Response{
+			{Status: 200, Type: reflect.TypeFor[HealthResponse]()},
+			{Status: 503, Type: reflect.TypeFor[HealthResponse]()},
+		},
+	},
+	{
+		Routes:      []string{"GET /api/v1/users/ws", "GET /api/v2/users/ws"},
+		Summary:     "Live user updates",
+		Description: "Upgrades to a WebSocket sending a UserUpdate as a JSON text message for every user created, updated or deleted.\nBrowsers pass the token as the token query parameter. The server pings every 30s; clients that\ndon't answer, or fall too far behind, are disconnected.",
+		Tags:        []string{"Users"},
+		Params: []openapi.Param{
+			{Name: "token", In: "query", Type: reflect.TypeFor[string](), Description: "Access token, when it can't be sent as a header"},
+		},
+		Responses: []openapi.Response{
+			{Status: 101, Type: reflect.TypeFor[UserUpdate](), Description: "Switching to the WebSocket protocol"},
+			{Status: 401, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 426, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 503, Type: reflect.TypeFor[models.ErrorResponse]()},
+		},
+		Security: []string{"BearerAuth"},
+	},
+	{
+		Routes:      []string{"GET /metrics"},
+		Summary:     "Prometheus metrics",
+		Description: "Scraped by Prometheus; behind Basic Auth when BASIC_AUTH_USER and BASIC_AUTH_PASSWORD are set.",
+		Tags:        []string{"Operations"},
+		Produce:     []string{"text/plain"},
+		Responses: []openapi.Response{
+			{Status: 200, Type: reflect.TypeFor[string](), Description: "Metrics in the Prometheus text format"},
+			{Status: 401},
+		},
+		Security: []string{"BasicAuth"},
+	},
+	{
+		Routes:      []string{"GET /openapi.json"},
+		Summary:     "OpenAPI document",
+		Description: "The OpenAPI 3 document of every route, which the Swagger UI shows. Served when ENABLE_SWAGGER is true, behind Basic Auth when it is configured.",
+		Tags:        []string{"Operations"},
+		Produce:     []string{"application/json"},
+		Responses: []openapi.Response{
+			{Status: 200, Type: reflect.TypeFor[map[string]interface{}]()},
+			{Status: 401},
+			{Status: 500, Type: reflect.TypeFor[models.ErrorResponse]()},
+		},
+		Security: []string{"BasicAuth"},
+	},
+	{
+		Routes:      []string{"GET /swagger/{any}"},
+		Summary:     "Swagger UI",
+		Description: "The Swagger UI and its assets. Served when ENABLE_SWAGGER is true, behind Basic Auth when it is configured.",
+		Tags:        []string{"Operations"},
+		Produce:     []string{"text/html"},
+		Params: []openapi.Param{
+			{Name: "any", In: "path", Type: reflect.TypeFor[string](), Required: true, Description: "Page or asset, such as /index.html"},
+		},
+		Responses: []openapi.Response{
+			{Status: 200, Type: reflect.TypeFor[string](), Description: "The page or asset"},
+			{Status: 401},
+			{Status: 404},
+		},
+		Security: []string{"BasicAuth"},
+	},
+	{
+		Routes:      []string{"POST /api/v1/users/{id}/password", "POST /api/v2/users/{id}/password"},
+		Summary:     "Change password",
+		Description: "Replace the password of a user after checking the current one. Only the user themselves or an admin may do this. Every refresh token of the user is revoked.",
+		Tags:        []string{"Auth"},
+		Accept:      []string{"application/json"},
+		Produce:     []string{"application/json"},
+		Params: []openapi.Param{
+			{Name: "id", In: "path", Type: reflect.TypeFor[int](), Required: true, Description: "User ID"},
+			{Name: "body", In: "body", Type: reflect.TypeFor[ChangePasswordRequest](), Required: true, Description: "Current and new password"},
+		},
+		Responses: []openapi.Response{
+			{Status: 200, Type: reflect.TypeFor[map[string]string]()},
+			{Status: 400, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 403, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 404, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 500, Type: reflect.TypeFor[models.ErrorResponse]()},
+		},
+		Security: []string{"BearerAuth"},
+	},
+	{
+		Routes:      []string{"POST /api/v1/auth/forgot", "POST /api/v2/auth/forgot"},
+		Summary:     "Forgot password",
+		Description: "Send a single-use password reset token, valid for an hour, to the email if it belongs to a user.\nThe answer is the same whether or not it does.",
+		Tags:        []string{"Auth"},
+		Accept:      []string{"application/json"},
+		Produce:     []string{"application/json"},
+		Params: []openapi.Param{
+			{Name: "body", In: "body", Type: reflect.TypeFor[ForgotPasswordRequest](), Required: true, Description: "Email of the account"},
+		},
+		Responses: []openapi.Response{
+			{Status: 202, Type: reflect.TypeFor[map[string]string]()},
+			{Status: 400, Type: reflect.TypeFor[models.ErrorResponse]()},
+		},
+	},
+	{
+		Routes:      []string{"POST /api/v1/auth/reset", "POST /api/v2/auth/reset"},
+		Summary:     "Reset password",
+		Description: "Set a new password using a token from /auth/forgot. Each token works once. Every refresh token of the user is revoked.",
+		Tags:        []string{"Auth"},
+		Accept:      []string{"application/json"},
+		Produce:     []string{"application/json"},
+		Params: []openapi.Param{
+			{Name: "body", In: "body", Type: reflect.TypeFor[ResetPasswordRequest](), Required: true, Description: "Reset token and new password"},
+		},
+		Responses: []openapi.Response{
+			{Status: 200, Type: reflect.TypeFor[map[string]string]()},
+			{Status: 400, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 500, Type: reflect.TypeFor[models.ErrorResponse]()},
+		},
+	},
+	{
+		Routes:      []string{"GET /api/v1/users/{id}/posts", "GET /api/v2/users/{id}/posts"},
+		Summary:     "Get user posts",
+		Description: "Retrieve all posts of a user, oldest first",
+		Tags:        []string{"Posts"},
+		Produce:     []string{"application/json"},
+		Params: []openapi.Param{
+			{Name: "id", In: "path", Type: reflect.TypeFor[int](), Required: true, Description: "User ID"},
+		},
+		Responses: []openapi.Response{
+			{Status: 200, Type: reflect.TypeFor[[]models.Post]()},
+			{Status: 400, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 404, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 500, Type: reflect.TypeFor[models.ErrorResponse]()},
+		},
+	},
+	{
+		Routes:      []string{"GET /api/v1/users/{id}/posts/{post_id}", "GET /api/v2/users/{id}/posts/{post_id}"},
+		Summary:     "Get user post",
+		Description: "Retrieve a post of a user. The post must belong to that user.",
+		Tags:        []string{"Posts"},
+		Produce:     []string{"application/json"},
+		Params: []openapi.Param{
+			{Name: "id", In: "path", Type: reflect.TypeFor[int](), Required: true, Description: "User ID"},
+			{Name: "post_id", In: "path", Type: reflect.TypeFor[int](), Required: true, Description: "Post ID"},
+		},
+		Responses: []openapi.Response{
+			{Status: 200, Type: reflect.TypeFor[models.Post]()},
+			{Status: 400, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 404, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 500, Type: reflect.TypeFor[models.ErrorResponse]()},
+		},
+	},
+	{
+		Routes:      []string{"POST /api/v1/users/{id}/posts", "POST /api/v2/users/{id}/posts"},
+		Summary:     "Create user post",
+		Description: "Publish a post on behalf of a user. Only the user themselves or an admin may do this.",
+		Tags:        []string{"Posts"},
+		Accept:      []string{"application/json"},
+		Produce:     []string{"application/json"},
+		Params: []openapi.Param{
+			{Name: "id", In: "path", Type: reflect.TypeFor[int](), Required: true, Description: "User ID"},
+			{Name: "post", In: "body", Type: reflect.TypeFor[models.Post](), Required: true, Description: "New post"},
+		},
+		Responses: []openapi.Response{
+			{Status: 201, Type: reflect.TypeFor[models.Post]()},
+			{Status: 400, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 403, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 404, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 500, Type: reflect.TypeFor[models.ErrorResponse]()},
+		},
+		Security: []string{"BearerAuth"},
+	},
+	{
+		Routes:      []string{"PUT /api/v1/users/{id}/posts/{post_id}", "PUT /api/v2/users/{id}/posts/{post_id}"},
+		Summary:     "Update user post",
+		Description: "Replace the title and body of a post. The post must belong to that user. Only the user themselves or an admin may do this.",
+		Tags:        []string{"Posts"},
+		Accept:      []string{"application/json"},
+		Produce:     []string{"application/json"},
+		Params: []openapi.Param{
+			{Name: "id", In: "path", Type: reflect.TypeFor[int](), Required: true, Description: "User ID"},
+			{Name: "post_id", In: "path", Type: reflect.TypeFor[int](), Required: true, Description: "Post ID"},
+			{Name: "post", In: "body", Type: reflect.TypeFor[models.Post](), Required: true, Description: "Updated post"},
+		},
+		Responses: []openapi.Response{
+			{Status: 200, Type: reflect.TypeFor[models.Post]()},
+			{Status: 400, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 403, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 404, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 500, Type: reflect.TypeFor[models.ErrorResponse]()},
+		},
+		Security: []string{"BearerAuth"},
+	},
+	{
+		Routes:      []string{"DELETE /api/v1/users/{id}/posts/{post_id}", "DELETE /api/v2/users/{id}/posts/{post_id}"},
+		Summary:     "Delete user post",
+		Description: "Delete a post of a user. The post must belong to that user. Only the user themselves or an admin may do this.",
+		Tags:        []string{"Posts"},
+		Produce:     []string{"application/json"},
+		Params: []openapi.Param{
+			{Name: "id", In: "path", Type: reflect.TypeFor[int](), Required: true, Description: "User ID"},
+			{Name: "post_id", In: "path", Type: reflect.TypeFor[int](), Required: true, Description: "Post ID"},
+		},
+		Responses: []openapi.Response{
+			{Status: 200, Type: reflect.TypeFor[map[string]string](), Description: "Confirmation message in v1"},
+			{Status: 204, Description: "No content in v2"},
+			{Status: 400, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 403, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 404, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 500, Type: reflect.TypeFor[models.ErrorResponse]()},
+		},
+		Security: []string{"BearerAuth"},
+	},
+	{
+		Routes:      []string{"GET /debug/pprof/{name}", "POST /debug/pprof/{name}"},
+		Summary:     "Profiles",
+		Description: "The net/http/pprof index, profiles and traces, served when PPROF_ENABLED is true.",
+		Tags:        []string{"Operations"},
+		Produce:     []string{"text/html", "application/octet-stream"},
+		Params: []openapi.Param{
+			{Name: "name", In: "path", Type: reflect.TypeFor[string](), Required: true, Description: "Profile, such as /heap or /profile; / for the index"},
+		},
+		Responses: []openapi.Response{
+			{Status: 200, Type: reflect.TypeFor[openapi.File]()},
+			{Status: 401},
+		},
+		Security: []string{"BasicAuth"},
+	},
+	{
+		Routes:      []string{"GET /api/v1/users/{id}/preferences", "GET /api/v2/users/{id}/preferences"},
+		Summary:     "Get user preferences",
+		Description: "Return the user's UI preferences as a JSON object, {} when none were saved",
+		Tags:        []string{"Users"},
+		Produce:     []string{"application/json"},
+		Params: []openapi.Param{
+			{Name: "id", In: "path", Type: reflect.TypeFor[int](), Required: true, Description: "User ID"},
+		},
+		Responses: []openapi.Response{
+			{Status: 200, Type: reflect.TypeFor[map[string]interface{}]()},
+			{Status: 400, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 404, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 500, Type: reflect.TypeFor[models.ErrorResponse]()},
+		},
+	},
+	{
+		Routes:      []string{"PATCH /api/v1/users/{id}/preferences", "PATCH /api/v2/users/{id}/preferences"},
+		Summary:     "Update user preferences",
+		Description: "Shallow-merge the given keys into the user's preferences. A key set to null is removed.\nThe body and the merged result are limited to 16KB. Only the user themselves or an admin may do this.",
+		Tags:        []string{"Users"},
+		Accept:      []string{"application/json"},
+		Produce:     []string{"application/json"},
+		Params: []openapi.Param{
+			{Name: "id", In: "path", Type: reflect.TypeFor[int](), Required: true, Description: "User ID"},
+			{Name: "preferences", In: "body", Type: reflect.TypeFor[map[string]interface{}](), Required: true, Description: "Preference keys to set or remove"},
+		},
+		Responses: []openapi.Response{
+			{Status: 200, Type: reflect.TypeFor[map[string]interface{}]()},
+			{Status: 400, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 403, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 404, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 413, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 500, Type: reflect.TypeFor[models.ErrorResponse]()},
+		},
+		Security: []string{"BearerAuth"},
+	},
+	{
+		Routes:      []string{"GET /readyz"},
+		Summary:     "Readiness check",
+		Description: "Report whether this instance should take traffic: the database answers, its schema is the one this build expects\nand, when READY_MAX_IN_FLIGHT is set, fewer requests than that are in flight. Needs no authentication and is not rate limited.\nThe body also reports the database connection pool: open, in use and idle connections, and waits for one.",
+		Tags:        []string{"Health"},
+		Produce:     []string{"application/json"},
+		Responses: []openapi.Response{
+			{Status: 200, Type: reflect.TypeFor[ReadinessResponse]()},
+			{Status: 503, Type: reflect.TypeFor[ReadinessResponse]()},
+		},
+	},
+	{
+		Routes:      []string{"POST /api/v1/auth/refresh", "POST /api/v2/auth/refresh"},
+		Summary:     "Refresh tokens",
+		Description: "Trade a refresh token for a new access token and a new refresh token. Each refresh token works once; reusing one revokes every token descended from the same login.\nThe tokens of deleted users are refused.",
+		Tags:        []string{"Auth"},
+		Accept:      []string{"application/json"},
+		Produce:     []string{"application/json"},
+		Params: []openapi.Param{
+			{Name: "body", In: "body", Type: reflect.TypeFor[RefreshRequest](), Required: true, Description: "Refresh token"},
+		},
+		Responses: []openapi.Response{
+			{Status: 200, Type: reflect.TypeFor[LoginResponse]()},
+			{Status: 400, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 401, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 500, Type: reflect.TypeFor[models.ErrorResponse]()},
+		},
+	},
+	{
+		Routes:      []string{"POST /api/v1/auth/logout", "POST /api/v2/auth/logout"},
+		Summary:     "Log out",
+		Description: "Revoke a refresh token. Access tokens already issued stay valid until they expire.",
+		Tags:        []string{"Auth"},
+		Accept:      []string{"application/json"},
+		Produce:     []string{"application/json"},
+		Params: []openapi.Param{
+			{Name: "body", In: "body", Type: reflect.TypeFor[RefreshRequest](), Required: true, Description: "Refresh token"},
+		},
+		Responses: []openapi.Response{
+			{Status: 200, Type: reflect.TypeFor[map[string]string]()},
+			{Status: 400, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 401, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 500, Type: reflect.TypeFor[models.ErrorResponse]()},
+		},
+	},
+	{
+		Routes:      []string{"GET /api/v1/users", "GET /api/v2/users"},
+		Summary:     "Get all users",
+		Description: "Retrieve a list of all users in the database\nSupports offset pagination (page, limit) or keyset pagination (cursor, limit), but not both",
+		Tags:        []string{"Users"},
+		Accept:      []string{"application/json"},
+		Produce:     []string{"application/json", "application/xml"},
+		Params: []openapi.Param{
+			{Name: "page", In: "query", Type: reflect.TypeFor[int](), Description: "Page number (1-based)"},
+			{Name: "limit", In: "query", Type: reflect.TypeFor[int](), Description: "Number of users per page (default 20, at most 100)"},
+			{Name: "cursor", In: "query", Type: reflect.TypeFor[int](), Description: "ID of the last user from the previous page (0 to start)"},
+			{Name: "sort", In: "query", Type: reflect.TypeFor[string](), Description: "Comma-separated sort keys, prefix with - for descending (e.g. name,-id)"},
+			{Name: "name", In: "query", Type: reflect.TypeFor[string](), Description: "Case-insensitive substring match on name"},
+			{Name: "email", In: "query", Type: reflect.TypeFor[string](), Description: "Exact match on email, ignoring case"},
+			{Name: "role", In: "query", Type: reflect.TypeFor[string](), Description: "Exact match on role (admin, member, viewer)"},
+			{Name: "verified", In: "query", Type: reflect.TypeFor[bool](), Description: "Only users whose email is (true) or is not (false) verified"},
+			{Name: "ids", In: "query", Type: reflect.TypeFor[string](), Description: "Comma-separated user IDs to fetch (e.g. 1,2,3)"},
+			{Name: "fields", In: "query", Type: reflect.TypeFor[string](), Description: "Comma-separated fields to return (id is always included)"},
+			{Name: "include", In: "query", Type: reflect.TypeFor[string](), Description: "Associations to inline; only posts is supported"},
+			{Name: "include_deleted", In: "query", Type: reflect.TypeFor[bool](), Description: "Include soft-deleted users with their deleted_at time (admins only)"},
+			{Name: "envelope", In: "query", Type: reflect.TypeFor[bool](), Description: "Wrap the page in an object with total and page metadata (JSON only, not with cursor); always on in v2"},
+		},
+		Responses: []openapi.Response{
+			{Status: 200, Type: reflect.TypeFor[[]models.User](), Headers: []openapi.Header{
+				{Name: "X-Next-Cursor", Type: reflect.TypeFor[string](), Description: "Cursor for the next page (cursor mode only)"},
+				{Name: "X-Max-Page-Size", Type: reflect.TypeFor[int](), Description: "Largest accepted limit"},
+			}},
+			{Status: 200, Type: reflect.TypeFor[ListEnvelope](), Description: "With envelope=true, and always in v2"},
+			{Status: 400, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 403, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 500, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 406, Type: reflect.TypeFor[models.ErrorResponse]()},
+		},
+	},
+	{
+		Routes:      []string{"GET /api/v1/users/search", "GET /api/v2/users/search"},
+		Summary:     "Search users",
+		Description: "Case-insensitive search across name and email, exact email matches are ranked first",
+		Tags:        []string{"Users"},
+		Accept:      []string{"application/json"},
+		Produce:     []string{"application/json"},
+		Params: []openapi.Param{
+			{Name: "q", In: "query", Type: reflect.TypeFor[string](), Required: true, Description: "Search text (at least 2 characters)"},
+			{Name: "page", In: "query", Type: reflect.TypeFor[int](), Description: "Page number (1-based)"},
+			{Name: "limit", In: "query", Type: reflect.TypeFor[int](), Description: "Number of users per page (default 20, at most 100)"},
+		},
+		Responses: []openapi.Response{
+			{Status: 200, Type: reflect.TypeFor[[]models.User](), Description: "In v1", Headers: []openapi.Header{
+				{Name: "X-Max-Page-Size", Type: reflect.TypeFor[int](), Description: "Largest accepted limit"},
+			}},
+			{Status: 200, Type: reflect.TypeFor[ListEnvelope](), Description: "In v2"},
+			{Status: 400, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 500, Type: reflect.TypeFor[models.ErrorResponse]()},
+		},
+	},
+	{
+		Routes:      []string{"GET /api/v1/users/count", "GET /api/v2/users/count"},
+		Summary:     "Count users",
+		Description: "Return the number of users, honoring the same filters as the list endpoint",
+		Tags:        []string{"Users"},
+		Accept:      []string{"application/json"},
+		Produce:     []string{"application/json"},
+		Params: []openapi.Param{
+			{Name: "name", In: "query", Type: reflect.TypeFor[string](), Description: "Case-insensitive substring match on name"},
+			{Name: "email", In: "query", Type: reflect.TypeFor[string](), Description: "Exact match on email, ignoring case"},
+			{Name: "role", In: "query", Type: reflect.TypeFor[string](), Description: "Exact match on role (admin, member, viewer)"},
+			{Name: "verified", In: "query", Type: reflect.TypeFor[bool](), Description: "Only users whose email is (true) or is not (false) verified"},
+		},
+		Responses: []openapi.Response{
+			{Status: 200, Type: reflect.TypeFor[CountResponse]()},
+			{Status: 500, Type: reflect.TypeFor[models.ErrorResponse]()},
+		},
+	},
+	{
+		Routes:      []string{"GET /api/v1/users/export", "GET /api/v2/users/export"},
+		Summary:     "Export users as CSV",
+		Description: "Stream all users as a CSV attachment, honoring the same filters as the list endpoint",
+		Tags:        []string{"Users"},
+		Produce:     []string{"text/csv"},
+		Params: []openapi.Param{
+			{Name: "name", In: "query", Type: reflect.TypeFor[string](), Description: "Case-insensitive substring match on name"},
+			{Name: "email", In: "query", Type: reflect.TypeFor[string](), Description: "Exact match on email, ignoring case"},
+			{Name: "role", In: "query", Type: reflect.TypeFor[string](), Description: "Exact match on role (admin, member, viewer)"},
+			{Name: "verified", In: "query", Type: reflect.TypeFor[bool](), Description: "Only users whose email is (true) or is not (false) verified"},
+		},
+		Responses: []openapi.Response{
+			{Status: 200, Type: reflect.TypeFor[string](), Description: "CSV with columns id,name,email"},
+			{Status: 500, Type: reflect.TypeFor[models.ErrorResponse]()},
+		},
+	},
+	{
+		Routes:      []string{"GET /api/v1/users/stream", "GET /api/v2/users/stream"},
+		Summary:     "Stream users as NDJSON",
+		Description: "Stream all users as newline-delimited JSON, one user per line, honoring the same filters as the list endpoint",
+		Tags:        []string{"Users"},
+		Produce:     []string{"application/x-ndjson"},
+		Params: []openapi.Param{
+			{Name: "name", In: "query", Type: reflect.TypeFor[string](), Description: "Case-insensitive substring match on name"},
+			{Name: "email", In: "query", Type: reflect.TypeFor[string](), Description: "Exact match on email, ignoring case"},
+			{Name: "role", In: "query", Type: reflect.TypeFor[string](), Description: "Exact match on role (admin, member, viewer)"},
+			{Name: "verified", In: "query", Type: reflect.TypeFor[bool](), Description: "Only users whose email is (true) or is not (false) verified"},
+		},
+		Responses: []openapi.Response{
+			{Status: 200, Type: reflect.TypeFor[string](), Description: "One JSON user per line"},
+			{Status: 500, Type: reflect.TypeFor[models.ErrorResponse]()},
+		},
+	},
+	{
+		Routes:      []string{"GET /api/v1/users/{id}", "GET /api/v2/users/{id}"},
+		Summary:     "Get user by ID",
+		Description: "Retrieve a single user's details by their ID",
+		Tags:        []string{"Users"},
+		Accept:      []string{"application/json"},
+		Produce:     []string{"application/json", "application/xml"},
+		Params: []openapi.Param{
+			{Name: "id", In: "path", Type: reflect.TypeFor[int](), Required: true, Description: "User ID"},
+			{Name: "fields", In: "query", Type: reflect.TypeFor[string](), Description: "Comma-separated fields to return (id is always included)"},
+			{Name: "include", In: "query", Type: reflect.TypeFor[string](), Description: "Associations to inline; only posts is supported"},
+			{Name: "If-None-Match", In: "header", Type: reflect.TypeFor[string](), Description: "ETag from a previous response"},
+		},
+		Responses: []openapi.Response{
+			{Status: 200, Type: reflect.TypeFor[models.User](), Headers: []openapi.Header{
+				{Name: "ETag", Type: reflect.TypeFor[string](), Description: "Weak validator for the returned user"},
+			}},
+			{Status: 304, Description: "User has not changed since the given ETag"},
+			{Status: 400, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 404, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 406, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 500, Type: reflect.TypeFor[models.ErrorResponse]()},
+		},
+	},
+	{
+		Routes:      []string{"HEAD /api/v1/users/{id}", "HEAD /api/v2/users/{id}"},
+		Summary:     "Check user existence",
+		Description: "Return 200 with an empty body when the user exists, 404 otherwise",
+		Tags:        []string{"Users"},
+		Params: []openapi.Param{
+			{Name: "id", In: "path", Type: reflect.TypeFor[int](), Required: true, Description: "User ID"},
+		},
+		Responses: []openapi.Response{
+			{Status: 200},
+			{Status: 400},
+			{Status: 404},
+			{Status: 500},
+		},
+	},
+	{
+		Routes:      []string{"POST /api/v1/users", "POST /api/v2/users"},
+		Summary:     "Create a new user",
+		Description: "Create a new user by providing a name and email. Only admins may give it a role other than member.",
+		Tags:        []string{"Users"},
+		Accept:      []string{"application/json"},
+		Produce:     []string{"application/json"},
+		Params: []openapi.Param{
+			{Name: "user", In: "body", Type: reflect.TypeFor[models.User](), Required: true, Description: "New user information"},
+		},
+		Responses: []openapi.Response{
+			{Status: 201, Type: reflect.TypeFor[models.User]()},
+			{Status: 400, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 403, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 409, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 500, Type: reflect.TypeFor[models.ErrorResponse]()},
+		},
+		Security: []string{"BearerAuth"},
+	},
+	{
+		Routes:      []string{"POST /api/v1/users/bulk", "POST /api/v2/users/bulk"},
+		Summary:     "Create users in bulk",
+		Description: "Create up to 1000 users in a single transaction. Invalid or duplicate entries are reported by index.\nWith atomic=true nothing is inserted unless every entry is valid. Admins only.",
+		Tags:        []string{"Users"},
+		Accept:      []string{"application/json"},
+		Produce:     []string{"application/json"},
+		Params: []openapi.Param{
+			{Name: "users", In: "body", Type: reflect.TypeFor[[]models.User](), Required: true, Description: "Users to create"},
+			{Name: "atomic", In: "query", Type: reflect.TypeFor[bool](), Description: "Reject the whole batch if any entry fails"},
+		},
+		Responses: []openapi.Response{
+			{Status: 201, Type: reflect.TypeFor[BulkCreateResponse]()},
+			{Status: 207, Type: reflect.TypeFor[BulkCreateResponse]()},
+			{Status: 400, Type: reflect.TypeFor[BulkCreateResponse]()},
+			{Status: 403, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 500, Type: reflect.TypeFor[models.ErrorResponse]()},
+		},
+		Security: []string{"BearerAuth"},
+	},
+	{
+		Routes:      []string{"POST /api/v1/users/import", "POST /api/v2/users/import"},
+		Summary:     "Import users from CSV",
+		Description: "Import users from a CSV with a name,email header, sent as a multipart \"file\" field or a raw text/csv body.\nRows with an email that is already in use are skipped; invalid rows are reported as failed. Admins only.",
+		Tags:        []string{"Users"},
+		Accept:      []string{"text/csv", "multipart/form-data"},
+		Produce:     []string{"application/json"},
+		Params: []openapi.Param{
+			{Name: "file", In: "formData", Type: reflect.TypeFor[openapi.File](), Description: "CSV file"},
+		},
+		Responses: []openapi.Response{
+			{Status: 200, Type: reflect.TypeFor[ImportResponse]()},
+			{Status: 400, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 403, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 500, Type: reflect.TypeFor[models.ErrorResponse]()},
+		},
+		Security: []string{"BearerAuth"},
+	},
+	{
+		Routes:      []string{"PUT /api/v1/users/{id}", "PUT /api/v2/users/{id}"},
+		Summary:     "Update an existing user",
+		Description: "Update a user's name and email by their ID. The version of the user being\nupdated must be supplied; a stale version returns 409 with the current record.\nAn id in the body is optional; if present it must match the path id, otherwise 400 is returned. Only the user themselves or an admin may do this, and only admins may change the role.",
+		Tags:        []string{"Users"},
+		Accept:      []string{"application/json"},
+		Produce:     []string{"application/json"},
+		Params: []openapi.Param{
+			{Name: "id", In: "path", Type: reflect.TypeFor[int](), Required: true, Description: "User ID"},
+			{Name: "user", In: "body", Type: reflect.TypeFor[models.User](), Required: true, Description: "Updated user information"},
+			{Name: "If-Match", In: "header", Type: reflect.TypeFor[string](), Description: "Version the update is based on, if not sent in the body"},
+		},
+		Responses: []openapi.Response{
+			{Status: 200, Type: reflect.TypeFor[models.User]()},
+			{Status: 400, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 403, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 404, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 409, Type: reflect.TypeFor[VersionConflictResponse]()},
+			{Status: 428, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 500, Type: reflect.TypeFor[models.ErrorResponse]()},
+		},
+		Security: []string{"BearerAuth"},
+	},
+	{
+		Routes:      []string{"PATCH /api/v1/users/{id}", "PATCH /api/v2/users/{id}"},
+		Summary:     "Partially update a user",
+		Description: "Update only the fields present in the request body; the id cannot be changed. Only the user themselves or an admin may do this, and only admins may change the role.",
+		Tags:        []string{"Users"},
+		Accept:      []string{"application/json"},
+		Produce:     []string{"application/json"},
+		Params: []openapi.Param{
+			{Name: "id", In: "path", Type: reflect.TypeFor[int](), Required: true, Description: "User ID"},
+			{Name: "user", In: "body", Type: reflect.TypeFor[UserPatch](), Required: true, Description: "Fields to update"},
+			{Name: "If-Match", In: "header", Type: reflect.TypeFor[string](), Description: "Version the update is based on, if not sent in the body"},
+		},
+		Responses: []openapi.Response{
+			{Status: 200, Type: reflect.TypeFor[models.User]()},
+			{Status: 400, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 403, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 404, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 409, Type: reflect.TypeFor[VersionConflictResponse]()},
+			{Status: 428, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 500, Type: reflect.TypeFor[models.ErrorResponse]()},
+		},
+		Security: []string{"BearerAuth"},
+	},
+	{
+		Routes:      []string{"DELETE /api/v1/users/{id}", "DELETE /api/v2/users/{id}"},
+		Summary:     "Delete a user",
+		Description: "Soft-delete a user by their ID; the row is kept but hidden from every read endpoint. Their refresh tokens are revoked. Admins only.",
+		Tags:        []string{"Users"},
+		Accept:      []string{"application/json"},
+		Produce:     []string{"application/json"},
+		Params: []openapi.Param{
+			{Name: "id", In: "path", Type: reflect.TypeFor[int](), Required: true, Description: "User ID"},
+		},
+		Responses: []openapi.Response{
+			{Status: 200, Type: reflect.TypeFor[string](), Description: "Confirmation message in v1"},
+			{Status: 204, Description: "No content in v2"},
+			{Status: 400, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 403, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 404, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 500, Type: reflect.TypeFor[models.ErrorResponse]()},
+		},
+		Security: []string{"BearerAuth"},
+	},
+	{
+		Routes:      []string{"POST /api/v1/users/{id}/restore", "POST /api/v2/users/{id}/restore"},
+		Summary:     "Restore a deleted user",
+		Description: "Undo a soft delete. Fails with 409 if another active user has taken the email since. Admins only.",
+		Tags:        []string{"Users"},
+		Accept:      []string{"application/json"},
+		Produce:     []string{"application/json"},
+		Params: []openapi.Param{
+			{Name: "id", In: "path", Type: reflect.TypeFor[int](), Required: true, Description: "User ID"},
+		},
+		Responses: []openapi.Response{
+			{Status: 200, Type: reflect.TypeFor[models.User]()},
+			{Status: 400, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 403, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 404, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 409, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 500, Type: reflect.TypeFor[models.ErrorResponse]()},
+		},
+		Security: []string{"BearerAuth"},
+	},
+	{
+		Routes:      []string{"GET /api/v1/users/by-email/{email}", "GET /api/v2/users/by-email/{email}"},
+		Summary:     "Get user by email",
+		Description: "Retrieve a user by email address, ignoring case. Encode reserved characters such as + as %2B.",
+		Tags:        []string{"Users"},
+		Produce:     []string{"application/json"},
+		Params: []openapi.Param{
+			{Name: "email", In: "path", Type: reflect.TypeFor[string](), Required: true, Description: "User email"},
+		},
+		Responses: []openapi.Response{
+			{Status: 200, Type: reflect.TypeFor[models.User]()},
+			{Status: 400, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 404, Type: reflect.TypeFor[models.ErrorResponse]()},
+		},
+	},
+	{
+		Routes:      []string{"PUT /api/v1/users/by-email/{email}", "PUT /api/v2/users/by-email/{email}"},
+		Summary:     "Upsert a user by email",
+		Description: "Create the user if no active user has this email, otherwise update its name. The operation is atomic. Admins only.",
+		Tags:        []string{"Users"},
+		Accept:      []string{"application/json"},
+		Produce:     []string{"application/json"},
+		Params: []openapi.Param{
+			{Name: "email", In: "path", Type: reflect.TypeFor[string](), Required: true, Description: "User email"},
+			{Name: "user", In: "body", Type: reflect.TypeFor[UpsertUserRequest](), Required: true, Description: "User name"},
+		},
+		Responses: []openapi.Response{
+			{Status: 200, Type: reflect.TypeFor[models.User]()},
+			{Status: 201, Type: reflect.TypeFor[models.User]()},
+			{Status: 400, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 403, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 500, Type: reflect.TypeFor[models.ErrorResponse]()},
+		},
+		Security: []string{"BearerAuth"},
+	},
+	{
+		Routes:      []string{"POST /api/v1/auth/verify", "POST /api/v2/auth/verify"},
+		Summary:     "Verify email",
+		Description: "Mark the email of a user as verified using the token sent to it on registration or email change.\nEach token works once; using it again fails with 400.",
+		Tags:        []string{"Auth"},
+		Accept:      []string{"application/json"},
+		Produce:     []string{"application/json"},
+		Params: []openapi.Param{
+			{Name: "body", In: "body", Type: reflect.TypeFor[VerifyEmailRequest](), Required: true, Description: "Verification token"},
+		},
+		Responses: []openapi.Response{
+			{Status: 200, Type: reflect.TypeFor[models.User]()},
+			{Status: 400, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 500, Type: reflect.TypeFor[models.ErrorResponse]()},
+		},
+	},
+	{
+		Routes:      []string{"GET /api/v1/webhooks", "GET /api/v2/webhooks"},
+		Summary:     "List webhooks",
+		Description: "Every webhook subscription, oldest first. Secrets are never returned. Admins only.",
+		Tags:        []string{"Webhooks"},
+		Produce:     []string{"application/json"},
+		Responses: []openapi.Response{
+			{Status: 200, Type: reflect.TypeFor[[]models.Webhook]()},
+			{Status: 403, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 500, Type: reflect.TypeFor[models.ErrorResponse]()},
+		},
+		Security: []string{"BearerAuth"},
+	},
+	{
+		Routes:      []string{"GET /api/v1/webhooks/{id}", "GET /api/v2/webhooks/{id}"},
+		Summary:     "Get webhook",
+		Description: "Retrieve a webhook subscription by its ID. Admins only.",
+		Tags:        []string{"Webhooks"},
+		Produce:     []string{"application/json"},
+		Params: []openapi.Param{
+			{Name: "id", In: "path", Type: reflect.TypeFor[int](), Required: true, Description: "Webhook ID"},
+		},
+		Responses: []openapi.Response{
+			{Status: 200, Type: reflect.TypeFor[models.Webhook]()},
+			{Status: 400, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 403, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 404, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 500, Type: reflect.TypeFor[models.ErrorResponse]()},
+		},
+		Security: []string{"BearerAuth"},
+	},
+	{
+		Routes:      []string{"POST /api/v1/webhooks", "POST /api/v2/webhooks"},
+		Summary:     "Create webhook",
+		Description: "Subscribe a URL to user.created, user.updated and user.deleted events. Each delivery is a JSON POST\nsigned with the secret in X-Webhook-Signature (sha256=<hex HMAC-SHA256 of the body>); the secret is\nonly returned in this response. Deliveries answered with anything but 2xx are retried with backoff. Admins only.",
+		Tags:        []string{"Webhooks"},
+		Accept:      []string{"application/json"},
+		Produce:     []string{"application/json"},
+		Params: []openapi.Param{
+			{Name: "webhook", In: "body", Type: reflect.TypeFor[WebhookRequest](), Required: true, Description: "URL and events"},
+		},
+		Responses: []openapi.Response{
+			{Status: 201, Type: reflect.TypeFor[CreatedWebhook]()},
+			{Status: 400, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 403, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 500, Type: reflect.TypeFor[models.ErrorResponse]()},
+		},
+		Security: []string{"BearerAuth"},
+	},
+	{
+		Routes:      []string{"PUT /api/v1/webhooks/{id}", "PUT /api/v2/webhooks/{id}"},
+		Summary:     "Update webhook",
+		Description: "Replace the URL and events of a webhook, and enable or disable it. The secret stays the same. Admins only.",
+		Tags:        []string{"Webhooks"},
+		Accept:      []string{"application/json"},
+		Produce:     []string{"application/json"},
+		Params: []openapi.Param{
+			{Name: "id", In: "path", Type: reflect.TypeFor[int](), Required: true, Description: "Webhook ID"},
+			{Name: "webhook", In: "body", Type: reflect.TypeFor[WebhookRequest](), Required: true, Description: "URL and events"},
+		},
+		Responses: []openapi.Response{
+			{Status: 200, Type: reflect.TypeFor[models.Webhook]()},
+			{Status: 400, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 403, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 404, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 500, Type: reflect.TypeFor[models.ErrorResponse]()},
+		},
+		Security: []string{"BearerAuth"},
+	},
+	{
+		Routes:      []string{"DELETE /api/v1/webhooks/{id}", "DELETE /api/v2/webhooks/{id}"},
+		Summary:     "Delete webhook",
+		Description: "Delete a webhook subscription. Deliveries already queued are still sent. Admins only.",
+		Tags:        []string{"Webhooks"},
+		Produce:     []string{"application/json"},
+		Params: []openapi.Param{
+			{Name: "id", In: "path", Type: reflect.TypeFor[int](), Required: true, Description: "Webhook ID"},
+		},
+		Responses: []openapi.Response{
+			{Status: 200, Type: reflect.TypeFor[map[string]string](), Description: "Confirmation message in v1"},
+			{Status: 204, Description: "No content in v2"},
+			{Status: 400, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 403, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 404, Type: reflect.TypeFor[models.ErrorResponse]()},
+			{Status: 500, Type: reflect.TypeFor[models.ErrorResponse]()},
+		},
+		Security: []string{"BearerAuth"},
+	},
+}
+
+// apiErrorCodes are the codes ErrorResponse.Code takes
+var apiErrorCodes = []string{
+	CodeValidation,
+	CodeUserNotFound,
+	CodeAddressNotFound,
+	CodePostNotFound,
+	CodeAPIKeyNotFound,
+	CodeWebhookNotFound,
+	CodeAvatarNotFound,
+	CodeUserNotDeleted,
+	CodeDuplicateEmail,
+	CodeVersionConflict,
+	CodePreconditionRequired,
+	CodeUnauthorized,
+	CodeForbidden,
+	CodeNotAcceptable,
+	CodePayloadTooLarge,
+	CodeRateLimited,
+	CodeAccountLocked,
+	CodeUnsupportedMediaType,
+	CodeNotFound,
+	CodeConflict,
+	CodeTimeout,
+	CodeClientClosedRequest,
+	CodeUpgradeRequired,
+	CodeUnavailable,
+	CodeInternal,
+}
@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"testing"
+
+	"Unit-Test/internal/openapi"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// getOpenAPI fetches and validates the OpenAPI document router serves
+func getOpenAPI(t *testing.T, router *gin.Engine) *openapi3.T {
+	t.Helper()
+	w := sendWithAuth(router, "GET", "/openapi.json", "", "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+
+	doc, err := openapi3.NewLoader().LoadFromData(w.Body.Bytes())
+	require.NoError(t, err)
+	require.NoError(t, doc.Validate(context.Background()))
+	return doc
+}
+
+// assertDocumentsRoutes checks doc has an operation for each of the routes of
+// router, and none besides
+func assertDocumentsRoutes(t *testing.T, doc *openapi3.T, router *gin.Engine) {
+	t.Helper()
+	operations := 0
+	for _, item := range doc.Paths.Map() {
+		operations += len(item.Operations())
+	}
+	routes := router.Routes()
+	assert.Equal(t, len(routes), operations, "operations documented")
+	for _, route := range routes {
+		item := doc.Paths.Find(openapi.Path(route.Path))
+		if assert.NotNil(t, item, route.Path) {
+			assert.NotNil(t, item.GetOperation(route.Method), "%s %s", route.Method, route.Path)
+		}
+	}
+}
+
+func TestOpenAPIDocumentsEveryRoute(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+	doc := getOpenAPI(t, newAuthTestRouter(env))
+	assertDocumentsRoutes(t, doc, env.router)
+
+	assert.Equal(t, "User API", doc.Info.Title)
+	assert.Equal(t, "/", doc.Servers[0].URL, "relative to the document by default")
+	assert.ElementsMatch(t, []string{"BearerAuth", "ApiKeyAuth", "BasicAuth"}, keys(doc.Components.SecuritySchemes))
+
+	users := doc.Paths.Find("/api/v1/users").Get
+	for _, name := range []string{"page", "limit", "cursor"} {
+		assert.NotNil(t, users.Parameters.GetByInAndName("query", name), name)
+	}
+	ok := users.Responses.Status(http.StatusOK).Value
+	assert.Contains(t, ok.Headers, "X-Next-Cursor")
+	assert.Len(t, ok.Content.Get("application/json").Schema.Value.OneOf, 2, "the array, or the envelope")
+
+	create := doc.Paths.Find("/api/v2/users").Post
+	assert.Equal(t, openapi3.SecurityRequirements{{"BearerAuth": {}}}, *create.Security)
+	assert.Equal(t, "#/components/schemas/models.ErrorResponse",
+		create.Responses.Status(http.StatusBadRequest).Value.Content.Get("application/json").Schema.Ref)
+
+	code := doc.Components.Schemas["models.ErrorResponse"].Value.Properties["code"].Value
+	assert.Contains(t, code.Enum, CodeValidation)
+	assert.Contains(t, code.Enum, CodeRateLimited)
+	assert.Len(t, code.Enum, len(apiErrorCodes))
+}
+
+func TestOpenAPIDocumentsPprof(t *testing.T) {
+	t.Parallel()
+	r := gin.New()
+	registerPprof(r, func(c *gin.Context) { c.Next() })
+	doc, err := buildOpenAPI(r.Routes(), "/")
+	require.NoError(t, err)
+	assert.NotNil(t, doc.Paths.Find("/debug/pprof/{name}").Post)
+}
+
+func TestOpenAPIRejectsUndocumentedRoutes(t *testing.T) {
+	t.Parallel()
+	r := gin.New()
+	r.GET("/healthz", func(*gin.Context) {})
+	r.GET("/undocumented", func(*gin.Context) {})
+	_, err := buildOpenAPI(r.Routes(), "/")
+	assert.EqualError(t, err, "openapi: undocumented routes: GET /undocumented")
+}
+
+func TestOpenAPIIsGenerated(t *testing.T) {
+	t.Parallel()
+	generated, err := openapi.Generate(".", "../../main.go")
+	require.NoError(t, err)
+	committed, err := os.ReadFile("openapi_generated.go")
+	require.NoError(t, err)
+	assert.Equal(t, string(generated), string(committed), "openapi_generated.go is stale; run go generate ./...")
+}
+
+func TestSwaggerShowsOpenAPIDocument(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	w := getSwagger(newAuthTestRouter(env), "")
+	require.Equal(t, http.StatusOK, w.Code)
+	// The template escapes the slash as JavaScript allows
+	assert.Contains(t, w.Body.String(), `url: "\/openapi.json"`)
+}
+
+// newSwaggerRouter builds a router with the docs enabled or not, served at host
+// and basePath
+func newSwaggerRouter(t *testing.T, enabled bool, host, basePath string) *gin.Engine {
+	cfg := testConfig()
+	cfg.SwaggerEnabled, cfg.SwaggerHost, cfg.SwaggerBasePath = enabled, host, basePath
+	return newAuthTestRouter(newTestEnvWith(t, Deps{Config: cfg}))
+}
+
+func TestSwaggerDisabled(t *testing.T) {
+	t.Parallel()
+	router := newSwaggerRouter(t, false, "", "")
+
+	assert.Equal(t, http.StatusNotFound, getSwagger(router, "").Code)
+	assert.Equal(t, http.StatusNotFound, sendWithAuth(router, "GET", "/openapi.json", "", "").Code)
+}
+
+func TestOpenAPIServedAtConfiguredHost(t *testing.T) {
+	t.Parallel()
+	router := newSwaggerRouter(t, true, "api.example.com", "/users")
+
+	doc := getOpenAPI(t, router)
+	require.Len(t, doc.Servers, 1)
+	assert.Equal(t, "//api.example.com/users", doc.Servers[0].URL)
+}
+
+func TestSwaggerServerURL(t *testing.T) {
+	t.Parallel()
+	tests := []struct{ host, basePath, want string }{
+		{"", "", "/"},
+		{"", "/users", "/users"},
+		{"", "/users/", "/users"},
+		{"api.example.com", "", "//api.example.com"},
+		{"api.example.com:8443", "/users", "//api.example.com:8443/users"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, swaggerServerURL(tt.host, tt.basePath), "%q %q", tt.host, tt.basePath)
+	}
+}
+
+func keys[V any](m map[string]V) []string {
+	var names []string
+	for name := range m {
+		names = append(names, name)
+	}
+	return names
+}
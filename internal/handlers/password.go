@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"Unit-Test/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// How long a password reset token stays usable
+const passwordResetTTL = time.Hour
+
+// ForgotPasswordRequest is the body of a password reset request
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// Normalize lets the email be typed in any case
+func (r *ForgotPasswordRequest) Normalize() {
+	r.Email = models.NormalizeEmail(r.Email)
+}
+
+// ResetPasswordRequest is the body of a password reset. The new password
+// follows the same rules as RegisterRequest.Password.
+type ResetPasswordRequest struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required,min=8,max=72"`
+}
+
+// errInvalidResetToken covers unknown, used and expired reset tokens alike
+var errInvalidResetToken = errors.New("invalid reset token")
+
+// ChangePasswordRequest is the body of a password change. The new password
+// follows the same rules as RegisterRequest.Password.
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required,min=8,max=72"`
+}
+
+// setPassword stores a new bcrypt hash for the user and revokes their refresh
+// tokens, so sessions started with the old password end
+func (s *Server) setPassword(tx *gorm.DB, userID int, password string) error {
+	hash, err := s.hashPassword(password)
+	if err != nil {
+		return err
+	}
+	if err := tx.Model(&models.User{}).Where("id = ?", userID).UpdateColumn("password_hash", hash).Error; err != nil {
+		return err
+	}
+	return revokeRefreshTokensOf(tx, userID, s.now())
+}
+
+// Change a user's password
+// @Summary Change password
+// @Description Replace the password of a user after checking the current one. Only the user themselves or an admin may do this. Every refresh token of the user is revoked.
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Param body body ChangePasswordRequest true "Current and new password"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Security BearerAuth
+// @Router /api/v1/users/{id}/password [post]
+// @Router /api/v2/users/{id}/password [post]
+func (s *Server) changePassword(c *gin.Context) error {
+	id, err := parseUserID(c)
+	if err != nil {
+		return validationError(err.Error())
+	}
+
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		return invalidInput(err)
+	}
+
+	user, err := s.lookupUser(c, id)
+	if err != nil {
+		return notFoundAs(err, CodeUserNotFound, "User not found")
+	}
+	// Users without a password have nothing to verify against
+	if user.PasswordHash == "" || bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.CurrentPassword)) != nil {
+		return newAPIError(http.StatusForbidden, CodeForbidden, "Current password is incorrect")
+	}
+	if req.NewPassword == req.CurrentPassword {
+		return validationError("new_password must differ from the current password")
+	}
+
+	err = s.dbFor(c).Transaction(func(tx *gorm.DB) error {
+		return s.setPassword(tx, id, req.NewPassword)
+	})
+	if err != nil {
+		return err
+	}
+
+	c.JSON(200, gin.H{"message": "Password changed"})
+	return nil
+}
+
+// Request a password reset
+// @Summary Forgot password
+// @Description Send a single-use password reset token, valid for an hour, to the email if it belongs to a user.
+// @Description The answer is the same whether or not it does.
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param body body ForgotPasswordRequest true "Email of the account"
+// @Success 202 {object} map[string]string
+// @Failure 400 {object} models.ErrorResponse
+// @Router /api/v1/auth/forgot [post]
+// @Router /api/v2/auth/forgot [post]
+func (s *Server) forgotPassword(c *gin.Context) error {
+	var req ForgotPasswordRequest
+	if err := s.bindNormalized(c, &req); err != nil {
+		return invalidInput(err)
+	}
+
+	// Failures are only logged, since answering differently would reveal that the email exists
+	if err := s.startPasswordReset(c.Request.Context(), req.Email); err != nil {
+		requestLog(c).Error("password reset failed", "error", err.Error())
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "If the email is registered, a reset token has been sent"})
+	return nil
+}
+
+// startPasswordReset stores a reset token for the user with email, if any, and notifies them
+func (s *Server) startPasswordReset(ctx context.Context, email string) error {
+	var user models.User
+	if err := s.db.WithContext(ctx).Select("id", "email").Where("LOWER(email) = ?", email).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	token, err := newSecret()
+	if err != nil {
+		return err
+	}
+	reset := models.PasswordReset{UserID: user.ID, TokenHash: hashSecret(token), ExpiresAt: s.now().Add(passwordResetTTL)}
+	if err := s.db.WithContext(ctx).Create(&reset).Error; err != nil {
+		return err
+	}
+	return s.notifier.SendPasswordReset(user.Email, token)
+}
+
+// Reset a password with a reset token
+// @Summary Reset password
+// @Description Set a new password using a token from /auth/forgot. Each token works once. Every refresh token of the user is revoked.
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param body body ResetPasswordRequest true "Reset token and new password"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/v1/auth/reset [post]
+// @Router /api/v2/auth/reset [post]
+func (s *Server) resetPassword(c *gin.Context) error {
+	var req ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		return invalidInput(err)
+	}
+
+	err := s.dbFor(c).Transaction(func(tx *gorm.DB) error {
+		var reset models.PasswordReset
+		if err := tx.Where("token_hash = ?", hashSecret(req.Token)).First(&reset).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errInvalidResetToken
+			}
+			return err
+		}
+		now := s.now()
+		if now.After(reset.ExpiresAt) {
+			return errInvalidResetToken
+		}
+		// The used_at condition lets only one of two concurrent resets through
+		result := tx.Model(&models.PasswordReset{}).Where("id = ? AND used_at IS NULL", reset.ID).Update("used_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errInvalidResetToken
+		}
+		return s.setPassword(tx, reset.UserID, req.NewPassword)
+	})
+	if errors.Is(err, errInvalidResetToken) {
+		return validationError("Invalid or expired reset token")
+	}
+	if err != nil {
+		return err
+	}
+
+	c.JSON(200, gin.H{"message": "Password reset"})
+	return nil
+}
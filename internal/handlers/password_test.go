@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"Unit-Test/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestChangePassword(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	tokens := loginAlice(t, env)
+	router := newAuthTestRouter(env)
+
+	w := sendWithAuth(router, "POST", "/api/v1/users/1/password", `{"current_password":"correct horse","new_password":"battery staple"}`, "Bearer "+tokens.Token)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Only the new password works from now on
+	w = sendWithAuth(router, "POST", "/api/v1/auth/login", `{"email":"alice@example.com","password":"correct horse"}`, "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = sendWithAuth(router, "POST", "/api/v1/auth/login", `{"email":"alice@example.com","password":"battery staple"}`, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Sessions from before the change are over
+	status, _ := refresh(env, tokens.RefreshToken)
+	assert.Equal(t, http.StatusUnauthorized, status)
+}
+
+func TestChangePasswordWrongCurrent(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	tokens := loginAlice(t, env)
+
+	w := sendWithAuth(newAuthTestRouter(env), "POST", "/api/v1/users/1/password", `{"current_password":"wrong horse","new_password":"battery staple"}`, "Bearer "+tokens.Token)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	var user models.User
+	env.db.First(&user, 1)
+	assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte("correct horse")))
+}
+
+func TestChangePasswordRejectsWeakOrReusedPassword(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	tokens := loginAlice(t, env)
+	router := newAuthTestRouter(env)
+
+	w := sendWithAuth(router, "POST", "/api/v1/users/1/password", `{"current_password":"correct horse","new_password":"short"}`, "Bearer "+tokens.Token)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `"field":"new_password"`)
+
+	w = sendWithAuth(router, "POST", "/api/v1/users/1/password", `{"current_password":"correct horse","new_password":"correct horse"}`, "Bearer "+tokens.Token)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	var resp models.ErrorResponse
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	assert.Equal(t, CodeValidation, resp.Code)
+}
+
+func TestChangePasswordOfOtherUser(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	seedRoles(env)
+	router := newAuthTestRouter(env)
+	body := `{"current_password":"whatever1","new_password":"battery staple"}`
+
+	// A member may not touch someone else's password...
+	w := sendWithAuth(router, "POST", "/api/v1/users/3/password", body, bearerFor("2"))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "may not perform this action")
+
+	// ...while an admin gets as far as the password check
+	w = sendWithAuth(router, "POST", "/api/v1/users/3/password", body, bearerFor("1"))
+	assert.Contains(t, w.Body.String(), "Current password is incorrect")
+}
+
+// recordingNotifier keeps the latest message it was asked to send to each email
+type recordingNotifier struct {
+	welcomes      map[string]string
+	resets        map[string]string
+	verifications map[string]string
+}
+
+func (n *recordingNotifier) SendUserWelcome(email, name string) error {
+	n.welcomes[email] = name
+	return nil
+}
+
+func (n *recordingNotifier) SendPasswordReset(email, token string) error {
+	n.resets[email] = token
+	return nil
+}
+
+func (n *recordingNotifier) SendEmailVerification(email, token string) error {
+	n.verifications[email] = token
+	return nil
+}
+
+// newRecordingEnv is newTestEnv sending its notifications to a recordingNotifier
+func newRecordingEnv(t *testing.T) (*testEnv, *recordingNotifier) {
+	return newRecordingEnvWith(t, Deps{})
+}
+
+// newRecordingEnvWith is newRecordingEnv on top of deps
+func newRecordingEnvWith(t *testing.T, deps Deps) (*testEnv, *recordingNotifier) {
+	rec := &recordingNotifier{welcomes: map[string]string{}, resets: map[string]string{}, verifications: map[string]string{}}
+	deps.Notifier = rec
+	return newTestEnvWith(t, deps), rec
+}
+
+// forgot requests a password reset for email
+func forgot(env *testEnv, email string) int {
+	return sendWithAuth(newAuthTestRouter(env), "POST", "/api/v1/auth/forgot", `{"email":"`+email+`"}`, "").Code
+}
+
+// reset sets a new password with a reset token
+func reset(env *testEnv, token, password string) *httptest.ResponseRecorder {
+	return sendWithAuth(newAuthTestRouter(env), "POST", "/api/v1/auth/reset", `{"token":"`+token+`","new_password":"`+password+`"}`, "")
+}
+
+func TestPasswordReset(t *testing.T) {
+	t.Parallel()
+	env, rec := newRecordingEnv(t)
+	tokens := loginAlice(t, env)
+
+	assert.Equal(t, http.StatusAccepted, forgot(env, "Alice@Example.com"))
+	token := rec.resets["alice@example.com"]
+	assert.NotEmpty(t, token)
+
+	var stored models.PasswordReset
+	env.db.First(&stored)
+	assert.Equal(t, hashSecret(token), stored.TokenHash)
+
+	w := reset(env, token, "battery staple")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = sendWithAuth(newAuthTestRouter(env), "POST", "/api/v1/auth/login", `{"email":"alice@example.com","password":"battery staple"}`, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	status, _ := refresh(env, tokens.RefreshToken)
+	assert.Equal(t, http.StatusUnauthorized, status)
+}
+
+func TestPasswordResetUnknownEmail(t *testing.T) {
+	t.Parallel()
+	env, rec := newRecordingEnv(t)
+
+	// Same answer as for a registered email, but nothing is sent
+	assert.Equal(t, http.StatusAccepted, forgot(env, "nobody@example.com"))
+	assert.Empty(t, rec.resets)
+}
+
+func TestPasswordResetTokenReuse(t *testing.T) {
+	t.Parallel()
+	env, rec := newRecordingEnv(t)
+	loginAlice(t, env)
+	forgot(env, "alice@example.com")
+	token := rec.resets["alice@example.com"]
+
+	assert.Equal(t, http.StatusOK, reset(env, token, "battery staple").Code)
+	w := reset(env, token, "another password")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "Invalid or expired reset token")
+}
+
+func TestPasswordResetTokenExpiry(t *testing.T) {
+	t.Parallel()
+	now := time.Now()
+	env, rec := newRecordingEnvWith(t, Deps{Clock: func() time.Time { return now }})
+	loginAlice(t, env)
+
+	forgot(env, "alice@example.com")
+	token := rec.resets["alice@example.com"]
+
+	now = now.Add(passwordResetTTL + time.Second)
+	assert.Equal(t, http.StatusBadRequest, reset(env, token, "battery staple").Code)
+}
+
+func TestPasswordResetUnknownToken(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	assert.Equal(t, http.StatusBadRequest, reset(env, "not-a-token", "battery staple").Code)
+}
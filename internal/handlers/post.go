@@ -0,0 +1,223 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"Unit-Test/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// parseInclude validates the comma-separated ?include parameter and reports
+// whether posts were requested. posts is the only association offered so far.
+func parseInclude(raw string) (bool, error) {
+	if raw == "" {
+		return false, nil
+	}
+	includePosts := false
+	for _, name := range strings.Split(raw, ",") {
+		name = strings.TrimSpace(name)
+		switch name {
+		case "posts":
+			includePosts = true
+		default:
+			return false, errors.New("invalid include: " + name)
+		}
+	}
+	return includePosts, nil
+}
+
+// preloadPosts loads the posts of the queried users in one extra query
+func preloadPosts(query *gorm.DB) *gorm.DB {
+	return query.Preload("Posts", func(tx *gorm.DB) *gorm.DB {
+		return tx.Order("id")
+	})
+}
+
+// withPosts pairs a user with its preloaded posts
+func withPosts(user models.User) models.UserWithPosts {
+	posts := user.Posts
+	if posts == nil {
+		posts = []models.Post{}
+	}
+	user.Posts = nil
+	return models.UserWithPosts{User: user, Posts: posts}
+}
+
+// List a user's posts
+// @Summary Get user posts
+// @Description Retrieve all posts of a user, oldest first
+// @Tags Posts
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {array} models.Post
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/v1/users/{id}/posts [get]
+// @Router /api/v2/users/{id}/posts [get]
+func (s *Server) getPosts(c *gin.Context) error {
+	id, err := s.requireUser(c)
+	if err != nil {
+		return err
+	}
+
+	posts := []models.Post{}
+	if err := s.dbFor(c).Where("user_id = ?", id).Order("id").Find(&posts).Error; err != nil {
+		return err
+	}
+
+	c.JSON(200, posts)
+	return nil
+}
+
+// Fetch one of a user's posts
+// @Summary Get user post
+// @Description Retrieve a post of a user. The post must belong to that user.
+// @Tags Posts
+// @Produce json
+// @Param id path int true "User ID"
+// @Param post_id path int true "Post ID"
+// @Success 200 {object} models.Post
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/v1/users/{id}/posts/{post_id} [get]
+// @Router /api/v2/users/{id}/posts/{post_id} [get]
+func (s *Server) getPost(c *gin.Context) error {
+	post, err := s.lookupUserPost(c)
+	if err != nil {
+		return err
+	}
+
+	c.JSON(200, post)
+	return nil
+}
+
+// Add a post to a user
+// @Summary Create user post
+// @Description Publish a post on behalf of a user. Only the user themselves or an admin may do this.
+// @Tags Posts
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Param post body models.Post true "New post"
+// @Success 201 {object} models.Post
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Security BearerAuth
+// @Router /api/v1/users/{id}/posts [post]
+// @Router /api/v2/users/{id}/posts [post]
+func (s *Server) createPost(c *gin.Context) error {
+	id, err := s.requireUser(c)
+	if err != nil {
+		return err
+	}
+
+	var post models.Post
+	if err := c.ShouldBindJSON(&post); err != nil {
+		return invalidInput(err)
+	}
+	// The author and id come from the server, never from the body
+	post.ID = 0
+	post.UserID = id
+
+	if err := s.dbFor(c).Create(&post).Error; err != nil {
+		return err
+	}
+
+	c.JSON(201, post)
+	return nil
+}
+
+// Replace one of a user's posts
+// @Summary Update user post
+// @Description Replace the title and body of a post. The post must belong to that user. Only the user themselves or an admin may do this.
+// @Tags Posts
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Param post_id path int true "Post ID"
+// @Param post body models.Post true "Updated post"
+// @Success 200 {object} models.Post
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Security BearerAuth
+// @Router /api/v1/users/{id}/posts/{post_id} [put]
+// @Router /api/v2/users/{id}/posts/{post_id} [put]
+func (s *Server) updatePost(c *gin.Context) error {
+	post, err := s.lookupUserPost(c)
+	if err != nil {
+		return err
+	}
+
+	var input models.Post
+	if err := c.ShouldBindJSON(&input); err != nil {
+		return invalidInput(err)
+	}
+
+	if err := s.dbFor(c).Model(&post).Select("title", "body").Updates(&input).Error; err != nil {
+		return err
+	}
+
+	c.JSON(200, post)
+	return nil
+}
+
+// Remove one of a user's posts
+// @Summary Delete user post
+// @Description Delete a post of a user. The post must belong to that user. Only the user themselves or an admin may do this.
+// @Tags Posts
+// @Produce json
+// @Param id path int true "User ID"
+// @Param post_id path int true "Post ID"
+// @Success 200 {object} map[string]string "Confirmation message in v1"
+// @Success 204 "No content in v2"
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Security BearerAuth
+// @Router /api/v1/users/{id}/posts/{post_id} [delete]
+// @Router /api/v2/users/{id}/posts/{post_id} [delete]
+func (s *Server) deletePost(c *gin.Context) error {
+	post, err := s.lookupUserPost(c)
+	if err != nil {
+		return err
+	}
+
+	if err := s.dbFor(c).Delete(&post).Error; err != nil {
+		return err
+	}
+
+	respondDeleted(c, "Post deleted")
+	return nil
+}
+
+// lookupUserPost loads the :post_id post of the :id user. A post of another
+// user is reported as not found.
+func (s *Server) lookupUserPost(c *gin.Context) (models.Post, error) {
+	var post models.Post
+
+	id, err := parseUserID(c)
+	if err != nil {
+		return post, validationError(err.Error())
+	}
+	postID, err := strconv.Atoi(c.Param("post_id"))
+	if err != nil || postID < 1 {
+		return post, validationError("post_id must be a positive integer")
+	}
+	if _, err := s.lookupUser(c, id); err != nil {
+		return post, notFoundAs(err, CodeUserNotFound, "User not found")
+	}
+
+	err = s.dbFor(c).Where("user_id = ?", id).First(&post, postID).Error
+	return post, notFoundAs(err, CodePostNotFound, "Post not found")
+}
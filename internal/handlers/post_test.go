@@ -0,0 +1,245 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"Unit-Test/internal/models"
+	"Unit-Test/internal/testsupport/fixtures"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// queryCounter is a GORM logger that counts the SQL statements it sees
+type queryCounter struct {
+	gormlogger.Interface
+	queries atomic.Int64
+}
+
+func (q *queryCounter) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	q.queries.Add(1)
+}
+
+// countQueries runs fn with the package db logging through a counter and
+// returns how many statements were issued
+func countQueries(env *testEnv, fn func()) int64 {
+	counter := &queryCounter{Interface: gormlogger.Discard}
+	defer env.useDB(env.db.Session(&gorm.Session{Logger: counter}))()
+
+	fn()
+	return counter.queries.Load()
+}
+
+func sendPost(env *testEnv, method, url, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, url, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+	return w
+}
+
+func seedPostUsers(env *testEnv) {
+	env.db.Create(&models.User{Name: "Alice", Email: "alice@example.com"})
+	env.db.Create(&models.User{Name: "Bob", Email: "bob@example.com"})
+	env.db.Create(&models.User{Name: "Carol", Email: "carol@example.com"})
+	env.db.Create(&models.Post{UserID: 1, Title: "Hello", Body: "First post"})
+	env.db.Create(&models.Post{UserID: 1, Title: "Again", Body: "Second post"})
+	env.db.Create(&models.Post{UserID: 2, Title: "Hi", Body: "Bob's post"})
+}
+
+func TestPostCRUD(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	env.db.Create(&models.User{Name: "Alice", Email: "alice@example.com"})
+
+	w := sendPost(env, "POST", "/api/v1/users/1/posts", `{"title":"Hello","body":"First post","user_id":7}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var created models.Post
+	_ = json.Unmarshal(w.Body.Bytes(), &created)
+	assert.Equal(t, 1, created.UserID)
+
+	w = sendPost(env, "PUT", "/api/v1/users/1/posts/1", `{"title":"Hello again","body":"Edited"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = sendPost(env, "GET", "/api/v1/users/1/posts/1", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var fetched models.Post
+	_ = json.Unmarshal(w.Body.Bytes(), &fetched)
+	assert.Equal(t, "Hello again", fetched.Title)
+	assert.Equal(t, "Edited", fetched.Body)
+
+	w = sendPost(env, "DELETE", "/api/v1/users/1/posts/1", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = sendPost(env, "GET", "/api/v1/users/1/posts", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `[]`, w.Body.String())
+}
+
+func TestPostCrossUserAccess(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	seedPostUsers(env)
+
+	w := sendPost(env, "GET", "/api/v1/users/2/posts/1", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = sendPost(env, "DELETE", "/api/v1/users/2/posts/1", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = sendPost(env, "POST", "/api/v1/users/42/posts", `{"title":"Hello","body":"First post"}`)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestGetUserWithoutIncludeHasNoPosts(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	seedPostUsers(env)
+
+	w := sendPost(env, "GET", "/api/v1/users/1", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var body map[string]interface{}
+	_ = json.Unmarshal(w.Body.Bytes(), &body)
+	assert.NotContains(t, body, "posts")
+
+	w = sendPost(env, "GET", "/api/v1/users", "")
+	assert.NotContains(t, w.Body.String(), "posts")
+}
+
+func TestGetUserIncludePosts(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	seedPostUsers(env)
+
+	w := sendPost(env, "GET", "/api/v1/users/1?include=posts", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var user models.UserWithPosts
+	_ = json.Unmarshal(w.Body.Bytes(), &user)
+	assert.Equal(t, "Alice", user.Name)
+	if assert.Len(t, user.Posts, 2) {
+		assert.Equal(t, "Hello", user.Posts[0].Title)
+		assert.Equal(t, "Again", user.Posts[1].Title)
+	}
+}
+
+func TestGetUserIncludePostsEmpty(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	seedPostUsers(env)
+
+	w := sendPost(env, "GET", "/api/v1/users/3?include=posts", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var body map[string]json.RawMessage
+	_ = json.Unmarshal(w.Body.Bytes(), &body)
+	assert.Equal(t, "[]", string(body["posts"]))
+}
+
+func TestGetUserIncludeUnknown(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	seedPostUsers(env)
+
+	w := sendPost(env, "GET", "/api/v1/users/1?include=comments", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestGetUsersIncludePostsPreloads(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	seedPostUsers(env)
+
+	var w *httptest.ResponseRecorder
+	queries := countQueries(env, func() {
+		w = sendPost(env, "GET", "/api/v1/users?include=posts", "")
+	})
+	assert.Equal(t, http.StatusOK, w.Code)
+	// One query for the users and one for all of their posts, however many users there are
+	assert.Equal(t, int64(2), queries)
+
+	var users []models.UserWithPosts
+	_ = json.Unmarshal(w.Body.Bytes(), &users)
+	if assert.Len(t, users, 3) {
+		assert.Len(t, users[0].Posts, 2)
+		assert.Len(t, users[1].Posts, 1)
+		assert.NotNil(t, users[2].Posts)
+		assert.Empty(t, users[2].Posts)
+	}
+}
+
+func TestGetUsersIncludePostsXML(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	seedPostUsers(env)
+
+	req, _ := http.NewRequest("GET", "/api/v1/users?include=posts&ids=2", nil)
+	req.Header.Set("Accept", "application/xml")
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, strings.Contains(w.Body.String(), "<posts><post><id>3</id>"))
+
+	var list models.UserWithPostsList
+	assert.NoError(t, xml.Unmarshal(w.Body.Bytes(), &list))
+	if assert.Len(t, list.Users, 1) {
+		assert.Equal(t, "Hi", list.Users[0].Posts[0].Title)
+	}
+}
+
+func TestUserRelationsFromFixtures(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+	fixtures.Load(t, env.db, "users_with_posts.yaml")
+
+	w := send(env, "GET", "/api/v1/users/1?include=posts", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var alice models.UserWithPosts
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &alice))
+	var titles []string
+	for _, p := range alice.Posts {
+		titles = append(titles, p.Title)
+	}
+	assert.Equal(t, []string{"First", "Second", "Third"}, titles)
+
+	// Deleted users and their posts stay out of the list
+	w = send(env, "GET", "/api/v1/users?include=posts", "")
+	var users []models.UserWithPosts
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &users))
+	if assert.Len(t, users, 2) {
+		assert.Len(t, users[0].Posts, 3)
+		assert.Empty(t, users[1].Posts)
+	}
+
+	// Restoring Carol brings back the address deleted with her, not the older one
+	assert.Equal(t, http.StatusOK, send(env, "POST", "/api/v1/users/3/restore", "").Code)
+	w = send(env, "GET", "/api/v1/users/3/addresses", "")
+	var addresses []models.Address
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &addresses))
+	if assert.Len(t, addresses, 1) {
+		assert.Equal(t, "2 Elm St", addresses[0].Street)
+	}
+	w = send(env, "GET", "/api/v1/users/3/posts", "")
+	assert.Contains(t, w.Body.String(), "Deleted with Carol")
+}
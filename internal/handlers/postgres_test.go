@@ -0,0 +1,204 @@
+//go:build integration
+
+package handlers
+
+// The behaviour SQLite can't show, against a real Postgres started in a
+// container: go test -tags integration ./internal/handlers -run Postgres
+// The tests skip when Docker isn't available.
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"Unit-Test/internal/models"
+	"Unit-Test/internal/storage"
+	"Unit-Test/internal/testsupport/fixtures"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/modules/postgres"
+	"github.com/testcontainers/testcontainers-go/wait"
+	"gorm.io/gorm"
+)
+
+// The container every test shares; each test gets a database of its own in it.
+// Ryuk removes the container once the test binary exits.
+var (
+	postgresOnce sync.Once
+	postgresDSN  string
+	postgresErr  error
+)
+
+// postgresDBs numbers the databases created in the container
+var postgresDBs atomic.Int64
+
+// skipWithoutDocker skips t unless Docker is up. testcontainers panics when it
+// finds no Docker host at all, rather than reporting it.
+func skipWithoutDocker(t *testing.T) {
+	t.Helper()
+	defer func() {
+		if r := recover(); r != nil {
+			t.Skipf("Docker is not available: %v", r)
+		}
+	}()
+	testcontainers.SkipIfProviderIsNotHealthy(t)
+}
+
+// startPostgres starts the container the first time it is called and returns
+// the DSN of its maintenance database
+func startPostgres(t *testing.T) string {
+	skipWithoutDocker(t)
+	postgresOnce.Do(func() {
+		ctx := context.Background()
+		container, err := postgres.Run(ctx, "postgres:16-alpine",
+			postgres.WithDatabase("postgres"),
+			postgres.WithUsername("postgres"),
+			postgres.WithPassword("postgres"),
+			// Postgres restarts once after initializing the data directory
+			testcontainers.WithWaitStrategy(wait.ForLog("database system is ready to accept connections").
+				WithOccurrence(2).WithStartupTimeout(time.Minute)),
+		)
+		if err != nil {
+			postgresErr = fmt.Errorf("starting Postgres: %w", err)
+			return
+		}
+		postgresDSN, postgresErr = container.ConnectionString(ctx, "sslmode=disable")
+	})
+	require.NoError(t, postgresErr)
+	return postgresDSN
+}
+
+// openPostgres connects to dsn the way the app does
+func openPostgres(t *testing.T, dsn string) *gorm.DB {
+	opener := storage.Opener{Driver: storage.DriverPostgres, DSN: dsn, Config: &gorm.Config{TranslateError: true}}
+	conn, err := storage.Connect(context.Background(), opener, 30*time.Second)
+	require.NoError(t, err)
+	return conn
+}
+
+// newPostgresDB is a database of t's own in the container, migrated with the
+// production migrations and dropped when t finishes
+func newPostgresDB(t *testing.T) *gorm.DB {
+	base := startPostgres(t)
+	admin := openPostgres(t, base)
+	t.Cleanup(func() { storage.Close(admin) })
+
+	name := fmt.Sprintf("test_%d", postgresDBs.Add(1))
+	require.NoError(t, admin.Exec("CREATE DATABASE "+name).Error)
+	t.Cleanup(func() { admin.Exec("DROP DATABASE IF EXISTS " + name + " WITH (FORCE)") })
+
+	dsn, err := url.Parse(base)
+	require.NoError(t, err)
+	dsn.Path = "/" + name
+	conn := openPostgres(t, dsn.String())
+	t.Cleanup(func() { storage.Close(conn) })
+	require.NoError(t, InstrumentQueries(conn))
+	require.NoError(t, storage.Migrate(context.Background(), conn))
+	return conn
+}
+
+// newPostgresEnv serves the API from a Postgres database of t's own
+func newPostgresEnv(t *testing.T) *testEnv {
+	return newTestEnvWith(t, Deps{DB: newPostgresDB(t)})
+}
+
+func TestPostgresCreateAndDuplicate(t *testing.T) {
+	t.Parallel()
+	env := newPostgresEnv(t)
+
+	w := send(env, "POST", "/api/v1/users", `{"name":"Alice","email":"alice@example.com"}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var alice models.User
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &alice))
+
+	// The unique violation is mapped to a 409, whatever the email's case
+	w = send(env, "POST", "/api/v1/users", `{"name":"Alice","email":"ALICE@example.com"}`)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	var resp models.ErrorResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, CodeDuplicateEmail, resp.Code)
+
+	// The unique index only covers active users
+	require.Equal(t, http.StatusOK, send(env, "DELETE", fmt.Sprintf("/api/v1/users/%d", alice.ID), "").Code)
+	w = send(env, "POST", "/api/v1/users", `{"name":"Alice","email":"alice@example.com"}`)
+	assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	w = send(env, "POST", fmt.Sprintf("/api/v1/users/%d/restore", alice.ID), "")
+	assert.Equal(t, http.StatusConflict, w.Code, w.Body.String())
+}
+
+func TestPostgresFilterAndSearch(t *testing.T) {
+	t.Parallel()
+	env := newPostgresEnv(t)
+
+	var ids []int
+	for _, name := range []string{"Alice", "Malik", "Bob", "ALINA"} {
+		ids = append(ids, fixtures.NewUser(t, env.db, fixtures.WithName(name)).ID)
+	}
+
+	// ILIKE matches regardless of case
+	assert.Equal(t, []int{ids[0], ids[1], ids[3]}, fetchUserIDs(t, env, "/api/v1/users?name=ali"))
+	assert.Equal(t, int64(3), countOf(t, env, "/api/v1/users/count?name=ALI"))
+
+	w := send(env, "GET", "/api/v1/users/search?q=ali", "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var found []models.User
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &found))
+	assert.Len(t, found, 3)
+}
+
+func TestPostgresUpsertByEmail(t *testing.T) {
+	t.Parallel()
+	env := newPostgresEnv(t)
+
+	// ON CONFLICT targets the partial unique index on LOWER(email)
+	w := send(env, "PUT", "/api/v1/users/by-email/carol@example.com", `{"name":"Carol"}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	w = send(env, "PUT", "/api/v1/users/by-email/CAROL@example.com", `{"name":"Caroline"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var user models.User
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &user))
+	assert.Equal(t, "Caroline", user.Name)
+	assert.Equal(t, 2, user.Version)
+}
+
+func TestPostgresJSONBColumns(t *testing.T) {
+	t.Parallel()
+	env := newPostgresEnv(t)
+	user := fixtures.NewUser(t, env.db)
+	base := fmt.Sprintf("/api/v1/users/%d", user.ID)
+
+	// Preferences are merged into a jsonb column
+	w := send(env, "PATCH", base+"/preferences", `{"theme":"dark","layout":{"sidebar":true}}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = send(env, "PATCH", base+"/preferences", `{"theme":null,"language":"de"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = send(env, "GET", base+"/preferences", "")
+	assert.JSONEq(t, `{"language":"de","layout":{"sidebar":true}}`, w.Body.String())
+
+	// Audit snapshots are stored as jsonb too
+	w = send(env, "PUT", base, fmt.Sprintf(`{"name":"Renamed","email":%q,"version":%d}`, user.Email, user.Version))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = send(env, "GET", base+"/audit", "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var entries []models.AuditLog
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &entries))
+	require.NotEmpty(t, entries)
+	assert.Equal(t, "Renamed", snapshotField(t, entries[0].After, "name"))
+}
+
+// countOf is the count GET url answers with
+func countOf(t *testing.T, env *testEnv, url string) int64 {
+	w := send(env, "GET", url, "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp CountResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	return resp.Count
+}
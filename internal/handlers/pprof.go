@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"net/http/pprof"
+
+	"github.com/gin-gonic/gin"
+)
+
+// registerPprof mounts the profiling endpoints behind auth.
+// gin cannot register static routes next to a catch-all, so one wildcard route
+// dispatches to the dedicated handlers and leaves the index and the named
+// profiles (heap, goroutine, ...) to pprof.Index, which reads them off the path.
+// @Summary Profiles
+// @Description The net/http/pprof index, profiles and traces, served when PPROF_ENABLED is true.
+// @Tags Operations
+// @Produce html
+// @Produce octet-stream
+// @Param name path string true "Profile, such as /heap or /profile; / for the index"
+// @Success 200 {file} file
+// @Failure 401
+// @Security BasicAuth
+// @Router /debug/pprof/{name} [get]
+// @Router /debug/pprof/{name} [post]
+func registerPprof(r *gin.Engine, auth gin.HandlerFunc) {
+	handlers := map[string]gin.HandlerFunc{
+		"/cmdline": gin.WrapF(pprof.Cmdline),
+		"/profile": gin.WrapF(pprof.Profile),
+		"/symbol":  gin.WrapF(pprof.Symbol),
+		"/trace":   gin.WrapF(pprof.Trace),
+	}
+	index := gin.WrapF(pprof.Index)
+	serve := func(c *gin.Context) {
+		if handler, ok := handlers[c.Param("name")]; ok {
+			handler(c)
+			return
+		}
+		index(c)
+	}
+
+	group := r.Group("/debug/pprof", auth)
+	group.GET("/*name", serve)
+	// pprof's symbol lookup posts the addresses it wants resolved
+	group.POST("/*name", serve)
+}
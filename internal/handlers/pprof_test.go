@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// newPprofRouter builds a router serving cfg with PPROF_ENABLED set to enabled
+func newPprofRouter(t *testing.T, cfg Config, enabled bool) *gin.Engine {
+	cfg.PprofEnabled = enabled
+	return newAuthTestRouter(newTestEnvWith(t, Deps{Config: cfg}))
+}
+
+func getPprof(router *gin.Engine, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+	return w
+}
+
+func TestPprofEnabled(t *testing.T) {
+	t.Parallel()
+	router := newPprofRouter(t, testConfig(), true)
+
+	w := getPprof(router, "/debug/pprof/heap")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/octet-stream", w.Header().Get("Content-Type"))
+
+	w = getPprof(router, "/debug/pprof/")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "goroutine")
+
+	w = getPprof(router, "/debug/pprof/goroutine?debug=1")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, strings.HasPrefix(w.Body.String(), "goroutine profile:"))
+
+	w = getPprof(router, "/debug/pprof/cmdline")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = getPprof(router, "/debug/pprof/profile?seconds=1")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotEmpty(t, w.Body.Bytes())
+
+	w = getPprof(router, "/debug/pprof/nosuchprofile")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestPprofDisabledByDefault(t *testing.T) {
+	t.Parallel()
+	router := newPprofRouter(t, testConfig(), false)
+
+	for _, path := range []string{"/debug/pprof/", "/debug/pprof/heap", "/debug/pprof/profile"} {
+		assert.Equal(t, http.StatusNotFound, getPprof(router, path).Code, path)
+	}
+}
+
+func TestPprofBehindBasicAuth(t *testing.T) {
+	t.Parallel()
+	cfg := testConfig()
+	cfg.BasicAuthUser, cfg.BasicAuthPassword = "admin", "s3cret"
+	router := newPprofRouter(t, cfg, true)
+
+	assert.Equal(t, http.StatusUnauthorized, getPprof(router, "/debug/pprof/heap").Code)
+
+	req := httptest.NewRequest("GET", "/debug/pprof/heap", nil)
+	req.SetBasicAuth("admin", "s3cret")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"Unit-Test/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Largest preferences object accepted, both per request and once merged
+const maxPreferencesBytes = 16 << 10
+
+// errPreferencesTooLarge aborts a merge whose result exceeds maxPreferencesBytes
+var errPreferencesTooLarge = errors.New("preferences too large")
+
+// Fetch a user's preferences
+// @Summary Get user preferences
+// @Description Return the user's UI preferences as a JSON object, {} when none were saved
+// @Tags Users
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/v1/users/{id}/preferences [get]
+// @Router /api/v2/users/{id}/preferences [get]
+func (s *Server) getPreferences(c *gin.Context) error {
+	id, err := parseUserID(c)
+	if err != nil {
+		return validationError(err.Error())
+	}
+
+	user, err := s.lookupUser(c, id)
+	if err != nil {
+		return notFoundAs(err, CodeUserNotFound, "User not found")
+	}
+	if user.Preferences == nil {
+		user.Preferences = models.Preferences{}
+	}
+
+	c.JSON(200, user.Preferences)
+	return nil
+}
+
+// Merge into a user's preferences
+// @Summary Update user preferences
+// @Description Shallow-merge the given keys into the user's preferences. A key set to null is removed.
+// @Description The body and the merged result are limited to 16KB. Only the user themselves or an admin may do this.
+// @Tags Users
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Param preferences body map[string]interface{} true "Preference keys to set or remove"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 413 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Security BearerAuth
+// @Router /api/v1/users/{id}/preferences [patch]
+// @Router /api/v2/users/{id}/preferences [patch]
+func (s *Server) patchPreferences(c *gin.Context) error {
+	id, err := parseUserID(c)
+	if err != nil {
+		return validationError(err.Error())
+	}
+
+	tooLarge := newAPIError(http.StatusRequestEntityTooLarge, CodePayloadTooLarge, "Preferences must be at most "+strconv.Itoa(maxPreferencesBytes)+" bytes")
+	data, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxPreferencesBytes))
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			return tooLarge
+		}
+		return validationError("Invalid input")
+	}
+	// Only an object can be merged; arrays, scalars and null are rejected
+	var changes map[string]json.RawMessage
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) || json.Unmarshal(data, &changes) != nil {
+		return validationError("Preferences must be a JSON object")
+	}
+
+	user, err := s.userService.UpdatePreferences(serviceContext(c), id, func(prefs models.Preferences) (models.Preferences, error) {
+		merged := models.Preferences{}
+		for key, value := range prefs {
+			merged[key] = value
+		}
+		for key, value := range changes {
+			if string(value) == "null" {
+				delete(merged, key)
+				continue
+			}
+			merged[key] = value
+		}
+		encoded, _ := json.Marshal(merged)
+		if len(encoded) > maxPreferencesBytes {
+			return nil, errPreferencesTooLarge
+		}
+		return merged, nil
+	})
+	if errors.Is(err, errPreferencesTooLarge) {
+		return tooLarge
+	}
+	if err != nil {
+		return notFoundAs(err, CodeUserNotFound, "User not found")
+	}
+
+	c.JSON(200, user.Preferences)
+	return nil
+}
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"Unit-Test/internal/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func patchPrefs(env *testEnv, url, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("PATCH", url, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+	return w
+}
+
+func getPrefs(t *testing.T, env *testEnv, url string) string {
+	req, _ := http.NewRequest("GET", url, nil)
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	return w.Body.String()
+}
+
+func TestPreferencesDefaultEmpty(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	env.db.Create(&models.User{Name: "Alice", Email: "alice@example.com"})
+
+	assert.JSONEq(t, `{}`, getPrefs(t, env, "/api/v1/users/1/preferences"))
+
+	req, _ := http.NewRequest("GET", "/api/v1/users/42/preferences", nil)
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestPreferencesShallowMerge(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	env.db.Create(&models.User{Name: "Alice", Email: "alice@example.com"})
+
+	w := patchPrefs(env, "/api/v1/users/1/preferences", `{"theme":"dark","layout":{"sidebar":true,"density":"compact"}}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Nested objects are replaced, not merged
+	w = patchPrefs(env, "/api/v1/users/1/preferences", `{"language":"de","layout":{"sidebar":false}}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	expected := `{"theme":"dark","language":"de","layout":{"sidebar":false}}`
+	assert.JSONEq(t, expected, w.Body.String())
+	assert.JSONEq(t, expected, getPrefs(t, env, "/api/v1/users/1/preferences"))
+}
+
+func TestPreferencesNullDeletesKey(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	env.db.Create(&models.User{Name: "Alice", Email: "alice@example.com"})
+
+	patchPrefs(env, "/api/v1/users/1/preferences", `{"theme":"dark","language":"de"}`)
+	w := patchPrefs(env, "/api/v1/users/1/preferences", `{"theme":null,"unknown":null}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"language":"de"}`, getPrefs(t, env, "/api/v1/users/1/preferences"))
+}
+
+func TestPreferencesRejectsNonObject(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	env.db.Create(&models.User{Name: "Alice", Email: "alice@example.com"})
+
+	for _, body := range []string{`["dark"]`, `"dark"`, `42`, `null`, `{"theme":`} {
+		w := patchPrefs(env, "/api/v1/users/1/preferences", body)
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+	}
+}
+
+func TestPreferencesSizeLimit(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	env.db.Create(&models.User{Name: "Alice", Email: "alice@example.com"})
+
+	w := patchPrefs(env, "/api/v1/users/1/preferences", `{"note":"`+strings.Repeat("x", maxPreferencesBytes)+`"}`)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+
+	// Each request fits, but the merged object would not
+	half := strings.Repeat("x", maxPreferencesBytes/2)
+	w = patchPrefs(env, "/api/v1/users/1/preferences", `{"a":"`+half+`"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = patchPrefs(env, "/api/v1/users/1/preferences", `{"b":"`+half+`"}`)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+
+	assert.NotContains(t, getPrefs(t, env, "/api/v1/users/1/preferences"), `"b"`)
+}
+
+func TestPreferencesSurviveUserUpdate(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	env.db.Create(&models.User{Name: "Alice", Email: "alice@example.com"})
+	patchPrefs(env, "/api/v1/users/1/preferences", `{"theme":"dark"}`)
+
+	req, _ := http.NewRequest("PUT", "/api/v1/users/1", bytes.NewBufferString(`{"name":"Alice B","email":"alice@example.com","version":1}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	assert.JSONEq(t, `{"theme":"dark"}`, getPrefs(t, env, "/api/v1/users/1/preferences"))
+}
@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RateLimiter decides whether a request under key may proceed. Implementations
+// must be safe for concurrent use; the in-memory one only limits a single instance.
+type RateLimiter interface {
+	// Allow takes a token for key and reports whether one was available, how
+	// many remain, and otherwise how long until the next one
+	Allow(key string) (allowed bool, remaining int, retryAfter time.Duration)
+}
+
+// memoryRateLimiter is a token bucket per key, kept in process memory
+type memoryRateLimiter struct {
+	rate  float64
+	burst int
+	now   func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// newMemoryRateLimiter refills rate tokens per second up to burst
+func newMemoryRateLimiter(rate float64, burst int) *memoryRateLimiter {
+	return &memoryRateLimiter{rate: rate, burst: burst, now: time.Now, buckets: map[string]*tokenBucket{}}
+}
+
+func (l *memoryRateLimiter) Allow(key string) (bool, int, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: float64(l.burst), last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(l.burst), b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+		return false, 0, wait
+	}
+	b.tokens--
+	return true, int(b.tokens), 0
+}
+
+// sweep drops, at most once a minute, the buckets that have refilled
+// completely, since a missing bucket behaves the same
+func (l *memoryRateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+	full := time.Duration(float64(l.burst) / l.rate * float64(time.Second))
+	for key, b := range l.buckets {
+		if now.Sub(b.last) >= full {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// Routes never rate limited, such as the health checks orchestrators poll
+var unlimitedRoutes = map[string]bool{
+	"/healthz": true,
+	"/readyz":  true,
+	"/metrics": true,
+}
+
+// rateLimit rejects clients that exceed limiter with a 429 and Retry-After.
+// Every other response carries X-RateLimit-Remaining.
+func rateLimit(limiter RateLimiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if unlimitedRoutes[c.FullPath()] {
+			c.Next()
+			return
+		}
+		allowed, remaining, retryAfter := limiter.Allow(c.ClientIP())
+		c.Header("X-RateLimit-Remaining", strconv.Itoa(remaining))
+		if !allowed {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			respondError(c, http.StatusTooManyRequests, CodeRateLimited, "Too many requests")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// splitList splits a comma-separated setting, dropping blanks; nil when there is nothing
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// newRateLimitedRouter serves GET /ping behind limiter, trusting proxies
+func newRateLimitedRouter(limiter RateLimiter, proxies []string) *gin.Engine {
+	r := gin.New()
+	_ = r.SetTrustedProxies(proxies)
+	r.Use(rateLimit(limiter))
+	r.GET("/ping", func(c *gin.Context) { c.String(200, "pong") })
+	return r
+}
+
+// ping sends GET /ping from remoteAddr, optionally forwarded for another client
+func ping(router *gin.Engine, remoteAddr, forwardedFor string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("GET", "/ping", nil)
+	req.RemoteAddr = remoteAddr
+	if forwardedFor != "" {
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestRateLimitPastBurst(t *testing.T) {
+	t.Parallel()
+	router := newRateLimitedRouter(newMemoryRateLimiter(0.5, 3), nil)
+
+	for i, remaining := range []string{"2", "1", "0"} {
+		w := ping(router, "192.0.2.1:1234", "")
+		assert.Equal(t, http.StatusOK, w.Code, "request %d", i+1)
+		assert.Equal(t, remaining, w.Header().Get("X-RateLimit-Remaining"))
+	}
+
+	w := ping(router, "192.0.2.1:1234", "")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "0", w.Header().Get("X-RateLimit-Remaining"))
+	assert.Equal(t, "2", w.Header().Get("Retry-After"))
+	assert.JSONEq(t, `{"code":"RATE_LIMITED","message":"Too many requests"}`, w.Body.String())
+
+	// Other clients have their own bucket
+	w = ping(router, "192.0.2.2:1234", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestRateLimitRefills(t *testing.T) {
+	t.Parallel()
+	limiter := newMemoryRateLimiter(1, 2)
+	now := time.Now()
+	limiter.now = func() time.Time { return now }
+
+	assert.True(t, allowedOnly(limiter.Allow("a")))
+	assert.True(t, allowedOnly(limiter.Allow("a")))
+	allowed, _, retryAfter := limiter.Allow("a")
+	assert.False(t, allowed)
+	assert.Equal(t, time.Second, retryAfter)
+
+	now = now.Add(time.Second)
+	allowed, remaining, _ := limiter.Allow("a")
+	assert.True(t, allowed)
+	assert.Equal(t, 0, remaining)
+}
+
+func TestRateLimitForwardedFor(t *testing.T) {
+	t.Parallel()
+	// Behind a trusted proxy every forwarded client gets its own bucket
+	router := newRateLimitedRouter(newMemoryRateLimiter(0.5, 1), []string{"10.0.0.1"})
+	assert.Equal(t, http.StatusOK, ping(router, "10.0.0.1:1234", "203.0.113.1").Code)
+	assert.Equal(t, http.StatusOK, ping(router, "10.0.0.1:1234", "203.0.113.2").Code)
+	assert.Equal(t, http.StatusTooManyRequests, ping(router, "10.0.0.1:1234", "203.0.113.1").Code)
+
+	// From anywhere else X-Forwarded-For is ignored, so it cannot dodge the limit
+	router = newRateLimitedRouter(newMemoryRateLimiter(0.5, 1), nil)
+	assert.Equal(t, http.StatusOK, ping(router, "192.0.2.1:1234", "203.0.113.1").Code)
+	assert.Equal(t, http.StatusTooManyRequests, ping(router, "192.0.2.1:1234", "203.0.113.2").Code)
+}
+
+// allowedOnly keeps the verdict of RateLimiter.Allow
+func allowedOnly(allowed bool, _ int, _ time.Duration) bool {
+	return allowed
+}
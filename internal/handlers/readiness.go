@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+
+	"Unit-Test/internal/storage"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// inFlightRequests counts the requests being served right now
+var inFlightRequests atomic.Int64
+
+// trackInFlight keeps inFlightRequests up to date
+func trackInFlight(c *gin.Context) {
+	inFlightRequests.Add(1)
+	defer inFlightRequests.Add(-1)
+	c.Next()
+}
+
+// ReadinessCheck is one condition an instance must meet before it takes traffic
+type ReadinessCheck interface {
+	// Name identifies the check in the /readyz body
+	Name() string
+	// Check returns why the instance is not ready, or nil
+	Check(ctx context.Context) error
+}
+
+func (s *Server) defaultReadinessChecks() []ReadinessCheck {
+	checks := []ReadinessCheck{databaseCheck{db: s.db}, schemaCheck{db: s.db}}
+	if s.cfg.ReadyMaxInFlight > 0 {
+		checks = append(checks, inFlightCheck{max: s.cfg.ReadyMaxInFlight})
+	}
+	return checks
+}
+
+// databaseCheck requires the database to answer a ping
+type databaseCheck struct {
+	db *gorm.DB
+}
+
+func (databaseCheck) Name() string { return "database" }
+
+func (c databaseCheck) Check(ctx context.Context) error {
+	return storage.Ping(ctx, c.db)
+}
+
+// schemaCheck requires the database to be migrated to schemaVersion
+type schemaCheck struct {
+	db *gorm.DB
+}
+
+func (schemaCheck) Name() string { return "schema" }
+
+func (c schemaCheck) Check(ctx context.Context) error {
+	return storage.CheckSchema(ctx, c.db)
+}
+
+// inFlightCheck requires fewer than max other requests to be in flight
+type inFlightCheck struct {
+	max int64
+}
+
+func (inFlightCheck) Name() string { return "in_flight" }
+
+func (c inFlightCheck) Check(context.Context) error {
+	// Leave out the probe itself
+	if n := inFlightRequests.Load() - 1; n >= c.max {
+		return fmt.Errorf("%d requests in flight, limit is %d", n, c.max)
+	}
+	return nil
+}
+
+// ReadinessResponse holds the overall readiness, the result of every check and
+// the state of the database connection pool
+type ReadinessResponse struct {
+	Status string                    `json:"status" example:"ready"`
+	Checks map[string]HealthResponse `json:"checks"`
+	Pool   *storage.PoolStats        `json:"pool,omitempty"`
+}
+
+// Readiness check
+// @Summary Readiness check
+// @Description Report whether this instance should take traffic: the database answers, its schema is the one this build expects
+// @Description and, when READY_MAX_IN_FLIGHT is set, fewer requests than that are in flight. Needs no authentication and is not rate limited.
+// @Description The body also reports the database connection pool: open, in use and idle connections, and waits for one.
+// @Tags Health
+// @Produce json
+// @Success 200 {object} ReadinessResponse
+// @Failure 503 {object} ReadinessResponse
+// @Router /readyz [get]
+func (s *Server) readyz(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), healthPingTimeout)
+	defer cancel()
+
+	resp := ReadinessResponse{Status: "ready", Checks: map[string]HealthResponse{}}
+	status := http.StatusOK
+	for _, check := range s.checks {
+		if err := check.Check(ctx); err != nil {
+			resp.Checks[check.Name()] = HealthResponse{Status: "failing", Error: err.Error()}
+			resp.Status = "not ready"
+			status = http.StatusServiceUnavailable
+			continue
+		}
+		resp.Checks[check.Name()] = HealthResponse{Status: "ok"}
+	}
+	resp.Pool = storage.Stats(s.db)
+	c.JSON(status, resp)
+}
@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"Unit-Test/internal/models"
+	"Unit-Test/internal/storage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubCheck is a readiness check that fails with err, if set
+type stubCheck struct {
+	name string
+	err  error
+}
+
+func (s *stubCheck) Name() string                { return s.name }
+func (s *stubCheck) Check(context.Context) error { return s.err }
+
+// useReadinessChecks swaps in checks for the ones env's server runs
+func useReadinessChecks(env *testEnv, checks ...ReadinessCheck) {
+	env.server.checks = checks
+}
+
+func getReadyz(t *testing.T, router *gin.Engine) (int, ReadinessResponse) {
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/readyz", nil))
+	var resp ReadinessResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	return w.Code, resp
+}
+
+func TestReadyzDefaultChecks(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	status, resp := getReadyz(t, env.router)
+
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "ready", resp.Status)
+	assert.Equal(t, map[string]HealthResponse{
+		"database": {Status: "ok"},
+		"schema":   {Status: "ok"},
+	}, resp.Checks)
+}
+
+func TestReadyzReportsPool(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	sqlDB, _ := env.db.DB()
+	saved := sqlDB.Stats().MaxOpenConnections
+	sqlDB.SetMaxOpenConns(7)
+	defer sqlDB.SetMaxOpenConns(saved)
+
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, httptest.NewRequest("GET", "/readyz", nil))
+
+	var body struct {
+		Pool map[string]interface{} `json:"pool"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	pool := body.Pool
+	assert.Equal(t, float64(7), pool["max_open"])
+	for _, field := range []string{"open", "in_use", "idle", "wait_count", "wait_duration_ms"} {
+		assert.Contains(t, pool, field)
+	}
+	assert.GreaterOrEqual(t, pool["open"], float64(1))
+}
+
+func TestReadyzAggregatesChecks(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	first, second := &stubCheck{name: "first"}, &stubCheck{name: "second"}
+	useReadinessChecks(env, first, second)
+
+	status, resp := getReadyz(t, env.router)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "ready", resp.Status)
+
+	// Any failing check makes the instance unready, and each reports its own result
+	for _, failing := range []*stubCheck{first, second} {
+		failing.err = errors.New(failing.name + " is down")
+		status, resp = getReadyz(t, env.router)
+		assert.Equal(t, http.StatusServiceUnavailable, status)
+		assert.Equal(t, "not ready", resp.Status)
+		assert.Equal(t, HealthResponse{Status: "failing", Error: failing.name + " is down"}, resp.Checks[failing.name])
+		failing.err = nil
+	}
+
+	second.err = errors.New("down")
+	status, resp = getReadyz(t, env.router)
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Equal(t, HealthResponse{Status: "ok"}, resp.Checks["first"])
+}
+
+func TestSchemaCheck(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	defer func() {
+		env.db.Where("1 = 1").Delete(&models.SchemaMigration{})
+		storage.RecordSchemaVersion(env.db)
+	}()
+	check := schemaCheck{db: env.db}
+	assert.NoError(t, check.Check(context.Background()))
+
+	env.db.Create(&models.SchemaMigration{Version: storage.SchemaVersion + 1})
+	assert.EqualError(t, check.Check(context.Background()), "database schema is at version 3, expected 2")
+
+	env.db.Where("1 = 1").Delete(&models.SchemaMigration{})
+	assert.EqualError(t, check.Check(context.Background()), "database has not been migrated")
+}
+
+// waitForIdle waits until no request is in flight, such as a websocket an
+// earlier test has not finished hanging up
+func waitForIdle(t *testing.T) {
+	require.Eventually(t, func() bool { return inFlightRequests.Load() == 0 }, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestInFlightCheck(t *testing.T) {
+	env := newTestEnv(t)
+	waitForIdle(t)
+
+	useReadinessChecks(env, inFlightCheck{max: 1})
+
+	status, _ := getReadyz(t, env.router)
+	assert.Equal(t, http.StatusOK, status)
+
+	// Another request being served reaches the limit
+	inFlightRequests.Add(1)
+	defer inFlightRequests.Add(-1)
+	status, resp := getReadyz(t, env.router)
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Equal(t, "1 requests in flight, limit is 1", resp.Checks["in_flight"].Error)
+}
+
+func TestReadyzBypassesAuthAndRateLimit(t *testing.T) {
+	t.Parallel()
+	cfg := testConfig()
+	cfg.RequireAuthForReads, cfg.RateLimitRPS, cfg.RateLimitBurst = true, 0.001, 1
+	env := newTestEnvWith(t, Deps{Config: cfg})
+
+	router := newAuthTestRouter(env)
+
+	for i := 0; i < 3; i++ {
+		status, _ := getReadyz(t, router)
+		assert.Equal(t, http.StatusOK, status)
+	}
+}
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"expvar"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/gin-gonic/gin"
+)
+
+// panicsRecovered counts the handler panics recoverPanics has caught
+var panicsRecovered = expvar.NewInt("panics_recovered")
+
+// recoverPanics turns a panic further down the chain into a logged 500 with a
+// JSON ErrorResponse. When the response had already started there is no
+// status left to send, so the connection is cut instead of letting the client
+// take a truncated body for a complete one.
+func recoverPanics(c *gin.Context) {
+	defer func() {
+		rec := recover()
+		if rec == nil {
+			return
+		}
+		// net/http's own signal to abort the response; pass it on untouched
+		if rec == http.ErrAbortHandler {
+			panic(rec)
+		}
+
+		panicsRecovered.Add(1)
+		requestLog(c).Error("panic recovered", "panic", fmt.Sprint(rec), "stack", string(debug.Stack()))
+		if c.Writer.Written() {
+			c.Abort()
+			panic(http.ErrAbortHandler)
+		}
+		c.AbortWithStatusJSON(http.StatusInternalServerError, newErrorResponse(c, CodeInternal, "internal server error"))
+	}()
+	c.Next()
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// newPanickingRouter is the API plus two test-only routes that panic, one
+// before and one after starting the response
+func newPanickingRouter(env *testEnv) *gin.Engine {
+	r := gin.New()
+	env.server.initializeRoutes(r)
+	r.GET("/test/panic", func(c *gin.Context) {
+		panic("boom")
+	})
+	r.GET("/test/panic-midstream", func(c *gin.Context) {
+		c.String(http.StatusOK, "partial")
+		c.Writer.Flush()
+		panic("boom")
+	})
+	return r
+}
+
+func TestPanicReturnsJSONError(t *testing.T) {
+	logger, logs := captureLogs(slog.LevelError)
+	env := newTestEnvWith(t, Deps{Logger: logger})
+
+	before := panicsRecovered.Value()
+
+	req, _ := http.NewRequest("GET", "/test/panic", nil)
+	req.Header.Set("X-Request-ID", "req-panic")
+	w := httptest.NewRecorder()
+	newPanickingRouter(env).ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.JSONEq(t, `{"message":"internal server error","code":"INTERNAL","request_id":"req-panic"}`, w.Body.String())
+	assert.Equal(t, before+1, panicsRecovered.Value())
+
+	lines := logLines(t, logs, "panic recovered")
+	if assert.Len(t, lines, 1) {
+		assert.Equal(t, "boom", lines[0]["panic"])
+		assert.Equal(t, "req-panic", lines[0]["request_id"])
+		assert.Contains(t, lines[0]["stack"], "recovery_test.go")
+	}
+}
+
+func TestPanicAfterResponseStartedAbortsConnection(t *testing.T) {
+	logger, _ := captureLogs(slog.LevelError)
+	env := newTestEnvWith(t, Deps{Logger: logger})
+
+	before := panicsRecovered.Value()
+
+	w := httptest.NewRecorder()
+	// net/http recovers ErrAbortHandler and closes the connection
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		newPanickingRouter(env).ServeHTTP(w, httptest.NewRequest("GET", "/test/panic-midstream", nil))
+	})
+	assert.Equal(t, "partial", w.Body.String())
+	assert.Equal(t, before+1, panicsRecovered.Value())
+}
+
+func TestPanicAfterResponseStartedOverHTTP(t *testing.T) {
+	logger, _ := captureLogs(slog.LevelError)
+	env := newTestEnvWith(t, Deps{Logger: logger})
+
+	server := httptest.NewServer(newPanickingRouter(env))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/test/panic-midstream")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer resp.Body.Close()
+	// The client learns the body is incomplete rather than taking it as whole
+	_, err = io.ReadAll(resp.Body)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
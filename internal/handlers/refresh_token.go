@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"Unit-Test/internal/models"
+	"Unit-Test/internal/storage"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// RefreshRequest is the body of a refresh or logout
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// errInvalidRefreshToken covers unknown, expired, revoked and reused refresh tokens alike
+var errInvalidRefreshToken = errors.New("invalid refresh token")
+
+// issueTokens signs an access token for userID and stores a new refresh token in
+// family, starting a new family when it is empty
+func (s *Server) issueTokens(ctx context.Context, userID int, family string) (LoginResponse, error) {
+	token, expiresAt, err := s.issueToken(strconv.Itoa(userID))
+	if err != nil {
+		return LoginResponse{}, err
+	}
+
+	refresh, err := newSecret()
+	if err != nil {
+		return LoginResponse{}, err
+	}
+	if family == "" {
+		if family, err = newSecret(); err != nil {
+			return LoginResponse{}, err
+		}
+	}
+	stored := models.RefreshToken{
+		UserID:    userID,
+		TokenHash: hashSecret(refresh),
+		FamilyID:  family,
+		ExpiresAt: s.now().Add(s.cfg.RefreshTokenTTL),
+	}
+	if err := s.db.WithContext(ctx).Create(&stored).Error; err != nil {
+		return LoginResponse{}, err
+	}
+
+	return LoginResponse{
+		Token:            token,
+		TokenType:        "Bearer",
+		ExpiresAt:        expiresAt,
+		RefreshToken:     refresh,
+		RefreshExpiresAt: stored.ExpiresAt,
+	}, nil
+}
+
+// revokeRefreshToken revokes raw and returns the stored token. A token that was
+// already revoked is a reuse: its whole family is revoked and errInvalidRefreshToken
+// returned, as it is for unknown and expired tokens.
+func (s *Server) revokeRefreshToken(ctx context.Context, raw string) (models.RefreshToken, error) {
+	var stored models.RefreshToken
+	if err := s.db.WithContext(ctx).Where("token_hash = ?", hashSecret(raw)).First(&stored).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return stored, errInvalidRefreshToken
+		}
+		return stored, err
+	}
+
+	now := s.now()
+	// The revoked_at condition makes concurrent uses of one token race for a single winner
+	result := s.db.WithContext(ctx).Model(&models.RefreshToken{}).Where("id = ? AND revoked_at IS NULL", stored.ID).Update("revoked_at", now)
+	if result.Error != nil {
+		return stored, result.Error
+	}
+	if result.RowsAffected == 0 {
+		if err := s.db.WithContext(ctx).Model(&models.RefreshToken{}).Where("family_id = ? AND revoked_at IS NULL", stored.FamilyID).Update("revoked_at", now).Error; err != nil {
+			return stored, err
+		}
+		return stored, errInvalidRefreshToken
+	}
+	if now.After(stored.ExpiresAt) {
+		return stored, errInvalidRefreshToken
+	}
+	return stored, nil
+}
+
+// revokeRefreshTokensOf revokes every refresh token of the user with id, ending
+// all their sessions
+func revokeRefreshTokensOf(tx *gorm.DB, userID int, at time.Time) error {
+	return tx.Model(&models.RefreshToken{}).Where("user_id = ? AND revoked_at IS NULL", userID).Update("revoked_at", at).Error
+}
+
+// refreshError makes an unusable refresh token a 401 *APIError. Other errors
+// pass through unchanged.
+func refreshError(err error) error {
+	if errors.Is(err, errInvalidRefreshToken) {
+		return &APIError{Status: http.StatusUnauthorized, Code: CodeUnauthorized, Message: "Invalid refresh token", Err: err}
+	}
+	return err
+}
+
+// Exchange a refresh token for new tokens
+// @Summary Refresh tokens
+// @Description Trade a refresh token for a new access token and a new refresh token. Each refresh token works once; reusing one revokes every token descended from the same login.
+// @Description The tokens of deleted users are refused.
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param body body RefreshRequest true "Refresh token"
+// @Success 200 {object} LoginResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/v1/auth/refresh [post]
+// @Router /api/v2/auth/refresh [post]
+func (s *Server) refreshTokens(c *gin.Context) error {
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		return invalidInput(err)
+	}
+
+	stored, err := s.revokeRefreshToken(c.Request.Context(), req.RefreshToken)
+	if err != nil {
+		return refreshError(err)
+	}
+	// Deleted users get no new tokens
+	if _, err := s.users.Get(c.Request.Context(), stored.UserID); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			err = errInvalidRefreshToken
+		}
+		return refreshError(err)
+	}
+
+	resp, err := s.issueTokens(c.Request.Context(), stored.UserID, stored.FamilyID)
+	if err != nil {
+		return err
+	}
+
+	c.JSON(200, resp)
+	return nil
+}
+
+// Revoke a refresh token
+// @Summary Log out
+// @Description Revoke a refresh token. Access tokens already issued stay valid until they expire.
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param body body RefreshRequest true "Refresh token"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/v1/auth/logout [post]
+// @Router /api/v2/auth/logout [post]
+func (s *Server) logout(c *gin.Context) error {
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		return invalidInput(err)
+	}
+
+	if _, err := s.revokeRefreshToken(c.Request.Context(), req.RefreshToken); err != nil {
+		return refreshError(err)
+	}
+
+	c.JSON(200, gin.H{"message": "Logged out"})
+	return nil
+}
@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"Unit-Test/internal/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// loginAlice registers alice@example.com and logs her in
+func loginAlice(t *testing.T, env *testEnv) LoginResponse {
+	router := newAuthTestRouter(env)
+	sendWithAuth(router, "POST", "/api/v1/auth/register", `{"name":"Alice","email":"alice@example.com","password":"correct horse"}`, "")
+	w := sendWithAuth(router, "POST", "/api/v1/auth/login", `{"email":"alice@example.com","password":"correct horse"}`, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resp LoginResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.NotEmpty(t, resp.RefreshToken)
+	return resp
+}
+
+// refresh posts refreshToken to /auth/refresh
+func refresh(env *testEnv, refreshToken string) (int, LoginResponse) {
+	w := sendWithAuth(newAuthTestRouter(env), "POST", "/api/v1/auth/refresh", `{"refresh_token":"`+refreshToken+`"}`, "")
+	var resp LoginResponse
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	return w.Code, resp
+}
+
+func TestRefreshRotatesToken(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	first := loginAlice(t, env)
+
+	status, second := refresh(env, first.RefreshToken)
+	assert.Equal(t, http.StatusOK, status)
+	assert.NotEqual(t, first.RefreshToken, second.RefreshToken)
+	subject, err := env.server.verifyToken(second.Token)
+	assert.NoError(t, err)
+	assert.Equal(t, "1", subject)
+
+	status, third := refresh(env, second.RefreshToken)
+	assert.Equal(t, http.StatusOK, status)
+	assert.NotEmpty(t, third.Token)
+
+	// Rotated tokens stay in one family
+	var families int64
+	env.db.Model(&models.RefreshToken{}).Distinct("family_id").Count(&families)
+	assert.Equal(t, int64(1), families)
+}
+
+func TestRefreshReuseRevokesFamily(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	first := loginAlice(t, env)
+	_, second := refresh(env, first.RefreshToken)
+
+	// Replaying the rotated token is rejected...
+	status, _ := refresh(env, first.RefreshToken)
+	assert.Equal(t, http.StatusUnauthorized, status)
+
+	// ...and takes its successor down with it
+	status, _ = refresh(env, second.RefreshToken)
+	assert.Equal(t, http.StatusUnauthorized, status)
+
+	var active int64
+	env.db.Model(&models.RefreshToken{}).Where("revoked_at IS NULL").Count(&active)
+	assert.Equal(t, int64(0), active)
+}
+
+func TestRefreshReuseLeavesOtherLoginsAlone(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	first := loginAlice(t, env)
+	w := sendWithAuth(newAuthTestRouter(env), "POST", "/api/v1/auth/login", `{"email":"alice@example.com","password":"correct horse"}`, "")
+	var other LoginResponse
+	_ = json.Unmarshal(w.Body.Bytes(), &other)
+
+	refresh(env, first.RefreshToken)
+	refresh(env, first.RefreshToken)
+
+	status, _ := refresh(env, other.RefreshToken)
+	assert.Equal(t, http.StatusOK, status)
+}
+
+func TestRefreshExpired(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	env.db.Create(&models.User{Name: "Alice", Email: "alice@example.com"})
+	env.db.Create(&models.RefreshToken{UserID: 1, TokenHash: hashSecret("stale"), FamilyID: "f", ExpiresAt: time.Now().Add(-time.Minute)})
+
+	status, _ := refresh(env, "stale")
+	assert.Equal(t, http.StatusUnauthorized, status)
+}
+
+func TestRefreshUnknown(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	w := sendWithAuth(newAuthTestRouter(env), "POST", "/api/v1/auth/refresh", `{"refresh_token":"nope"}`, "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.JSONEq(t, withRequestID(`{"code":"UNAUTHORIZED","message":"Invalid refresh token"}`, w), w.Body.String())
+}
+
+func TestLogoutRevokesRefreshToken(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	tokens := loginAlice(t, env)
+
+	w := sendWithAuth(newAuthTestRouter(env), "POST", "/api/v1/auth/logout", `{"refresh_token":"`+tokens.RefreshToken+`"}`, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	status, _ := refresh(env, tokens.RefreshToken)
+	assert.Equal(t, http.StatusUnauthorized, status)
+}
+
+func TestDeletingUserRevokesRefreshTokens(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	tokens := loginAlice(t, env)
+	assert.Equal(t, http.StatusOK, send(env, "DELETE", "/api/v1/users/1", "").Code)
+
+	status, _ := refresh(env, tokens.RefreshToken)
+	assert.Equal(t, http.StatusUnauthorized, status)
+	var active int64
+	env.db.Model(&models.RefreshToken{}).Where("revoked_at IS NULL").Count(&active)
+	assert.Equal(t, int64(0), active)
+}
+
+func TestRefreshRejectsDeletedUser(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	// A token left unrevoked still issues nothing once its user is gone
+	tokens := loginAlice(t, env)
+	env.db.Delete(&models.User{}, 1)
+
+	status, _ := refresh(env, tokens.RefreshToken)
+	assert.Equal(t, http.StatusUnauthorized, status)
+}
+
+func TestTokensExpireByServerClock(t *testing.T) {
+	t.Parallel()
+	now := time.Now()
+	env := newTestEnvWith(t, Deps{Clock: func() time.Time { return now }})
+	router := newAuthTestRouter(env)
+	createBob := func(token string) *httptest.ResponseRecorder {
+		return sendWithAuth(router, "POST", "/api/v1/users", `{"name":"Bob","email":"bob@example.com"}`, "Bearer "+token)
+	}
+
+	tokens := loginAlice(t, env)
+	assert.True(t, now.Add(env.server.cfg.TokenTTL).Equal(tokens.ExpiresAt))
+
+	now = now.Add(env.server.cfg.TokenTTL + time.Second)
+	w := createBob(tokens.Token)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), "Token has expired")
+
+	status, renewed := refresh(env, tokens.RefreshToken)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, http.StatusCreated, createBob(renewed.Token).Code)
+
+	now = now.Add(env.server.cfg.RefreshTokenTTL + time.Second)
+	status, _ = refresh(env, renewed.RefreshToken)
+	assert.Equal(t, http.StatusUnauthorized, status)
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Context key holding the current request's id
+const requestIDKey = "request_id"
+
+// Longest client-supplied X-Request-ID that is accepted as is
+const maxRequestIDLength = 128
+
+// assignRequestID gives every request an id, taken from X-Request-ID when the
+// client sent a usable one and generated otherwise, and echoes it in the response
+func assignRequestID(c *gin.Context) {
+	id := c.GetHeader("X-Request-ID")
+	if !validRequestID(id) {
+		id = uuid.NewString()
+	}
+	c.Set(requestIDKey, id)
+	c.Header("X-Request-ID", id)
+	c.Next()
+}
+
+// validRequestID accepts non-empty ids of printable ASCII, so a client
+// cannot inject line breaks or control characters into the logs
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// requestID returns the id assignRequestID gave the current request
+func requestID(c *gin.Context) string {
+	return c.GetString(requestIDKey)
+}
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"Unit-Test/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// withRequestID adds the request id w was answered with to an expected JSON error body
+func withRequestID(expected string, w *httptest.ResponseRecorder) string {
+	return strings.TrimSuffix(strings.TrimSpace(expected), "}") + `,"request_id":"` + w.Header().Get("X-Request-ID") + `"}`
+}
+
+func TestRequestIDRoundTrips(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	req, _ := http.NewRequest("GET", "/api/v1/users", nil)
+	req.Header.Set("X-Request-ID", "client-id-42")
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "client-id-42", w.Header().Get("X-Request-ID"))
+}
+
+func TestRequestIDGeneratedWhenAbsent(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	for _, sent := range []string{"", "bad id\nwith newline", strings.Repeat("x", maxRequestIDLength+1)} {
+		req, _ := http.NewRequest("GET", "/api/v1/users", nil)
+		if sent != "" {
+			req.Header["X-Request-Id"] = []string{sent}
+		}
+		w := httptest.NewRecorder()
+		env.router.ServeHTTP(w, req)
+
+		_, err := uuid.Parse(w.Header().Get("X-Request-ID"))
+		assert.NoError(t, err, "sent %q", sent)
+	}
+}
+
+func TestRequestIDInServerError(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	// A database without tables makes every query fail
+	broken, _ := gorm.Open(sqlite.Open("file:requestid_broken?mode=memory"), &gorm.Config{})
+	defer env.useDB(broken)()
+
+	req, _ := http.NewRequest("GET", "/api/v1/users", nil)
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	var resp models.ErrorResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, CodeInternal, resp.Code)
+	assert.NotEmpty(t, resp.RequestID)
+	assert.Equal(t, w.Header().Get("X-Request-ID"), resp.RequestID)
+}
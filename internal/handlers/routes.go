@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+)
+
+// NewRouter builds the engine serving the API: the request logger, trusted
+// proxies and CORS around the routes RegisterRoutes adds
+func NewRouter(deps Deps) (*gin.Engine, error) {
+	srv := newServer(deps)
+
+	r := gin.New()
+	r.Use(requestLogger(srv.logger))
+	if err := r.SetTrustedProxies(deps.Config.TrustedProxies); err != nil {
+		return nil, fmt.Errorf("invalid TRUSTED_PROXIES: %w", err)
+	}
+	corsHandler, err := corsMiddleware(deps.Config)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CORS configuration: %w", err)
+	}
+	r.Use(corsHandler)
+	srv.initializeRoutes(r)
+	return r, nil
+}
+
+// RegisterRoutes adds the API, its middleware and the operational endpoints to r,
+// served from deps
+func RegisterRoutes(r *gin.Engine, deps Deps) {
+	newServer(deps).initializeRoutes(r)
+}
+
+// Register the API routes on the given engine
+func (s *Server) initializeRoutes(r *gin.Engine) {
+	r.Use(s.useLogger)
+	r.Use(trackInFlight)
+	r.Use(recordMetrics)
+	r.Use(assignRequestID)
+	// Outside the handlers that write errors, so it sees their responses too
+	// A level of 0 turns compression off
+	if s.cfg.GzipLevel != 0 {
+		r.Use(compressResponses(s.cfg.GzipLevel, s.cfg.GzipMinBytes))
+	}
+	r.Use(recoverPanics)
+	r.Use(handleErrors)
+	r.Use(setSecurityHeaders(s.cfg))
+	if s.cfg.RateLimitRPS > 0 {
+		r.Use(rateLimit(newMemoryRateLimiter(s.cfg.RateLimitRPS, s.cfg.RateLimitBurst)))
+	}
+	r.Use(limitRequestBody(s.cfg.MaxBodyBytes))
+	r.Use(limitRequestTime(s.cfg.RequestTimeout))
+	if s.cache != nil {
+		r.Use(s.invalidateCache)
+	}
+
+	// Serve the OpenAPI document and the Swagger UI showing it, behind Basic
+	// Auth when it is configured; without them, both paths answer 404. Off by
+	// default, so production doesn't advertise every route.
+	if s.cfg.SwaggerEnabled {
+		r.GET("/openapi.json", s.basicAuth(), serveOpenAPI(r, swaggerServerURL(s.cfg.SwaggerHost, s.cfg.SwaggerBasePath)))
+		r.GET("/swagger/*any", s.basicAuth(), swaggerUI())
+	}
+
+	// Probed by the orchestrator without credentials
+	r.GET("/healthz", s.healthz)
+	r.GET("/readyz", s.readyz)
+	// Scraped by Prometheus, behind Basic Auth when it is configured
+	r.GET("/metrics", s.basicAuth(), metricsHandler())
+	// Off by default: profiles expose internals and a CPU profile keeps a
+	// request busy for as long as it samples
+	if s.cfg.PprofEnabled {
+		registerPprof(r, s.basicAuth())
+	}
+
+	r.NoRoute(respondNoRoute)
+	s.registerAPI(r.Group(apiPrefixes[apiV1], useAPIVersion(apiV1)))
+	s.registerAPI(r.Group(apiPrefixes[apiV2], useAPIVersion(apiV2)))
+}
+
+// registerAPI adds the API's routes to g. Every version shares the handlers,
+// which check apiVersion where the versions answer differently.
+func (s *Server) registerAPI(g *gin.RouterGroup) {
+	// Mutations always need a token; reads only when AUTH_REQUIRED_FOR_READS is set
+	reads := s.readAuth()
+
+	g.POST("/auth/register", handle(s.register))
+	g.POST("/auth/login", handle(s.login))
+	g.POST("/auth/refresh", handle(s.refreshTokens))
+	g.POST("/auth/logout", handle(s.logout))
+	g.POST("/auth/forgot", handle(s.forgotPassword))
+	g.POST("/auth/reset", handle(s.resetPassword))
+	g.POST("/auth/verify", handle(s.verifyEmail))
+
+	g.GET("/users", s.listAuth(), s.cacheResponses, handle(s.getUsers))
+	g.GET("/users/search", reads, handle(s.searchUsers))
+	g.GET("/users/count", reads, handle(s.countUsers))
+	g.GET("/users/export", reads, handle(s.exportUsers))
+	g.GET("/users/stream", reads, handle(s.streamUsers))
+	g.GET("/users/ws", tokenFromQuery, s.requireAuth, s.userUpdates)
+	g.GET("/users/:id", reads, s.cacheResponses, handle(s.getUser))
+	g.HEAD("/users/:id", reads, handle(s.headUser))
+	g.GET("/users/by-email/:email", reads, handle(s.getUserByEmail))
+	g.POST("/users", s.requireAuth, handle(s.createUser))
+	g.POST("/users/bulk", s.requireAuth, handle(s.createUsersBulk))
+	g.POST("/users/import", s.requireAuth, handle(s.importUsers))
+	g.PUT("/users/:id", s.requireAuth, handle(s.updateUser))
+	g.PATCH("/users/:id", s.requireAuth, handle(s.patchUser))
+	g.PUT("/users/by-email/:email", s.requireAuth, handle(s.upsertUserByEmail))
+	g.DELETE("/users/:id", s.requireAuth, handle(s.deleteUser))
+	g.POST("/users/:id/restore", s.requireAuth, handle(s.restoreUser))
+	g.PUT("/users/:id/avatar", s.requireAuth, handle(s.uploadAvatar))
+	g.GET("/users/:id/avatar", reads, handle(s.getAvatar))
+	g.GET("/users/:id/addresses", reads, handle(s.getAddresses))
+	g.POST("/users/:id/addresses", s.requireAuth, handle(s.createAddress))
+	g.PUT("/users/:id/addresses/:addr_id", s.requireAuth, handle(s.updateAddress))
+	g.DELETE("/users/:id/addresses/:addr_id", s.requireAuth, handle(s.deleteAddress))
+	g.GET("/users/:id/posts", reads, handle(s.getPosts))
+	g.POST("/users/:id/posts", s.requireAuth, handle(s.createPost))
+	g.GET("/users/:id/posts/:post_id", reads, handle(s.getPost))
+	g.PUT("/users/:id/posts/:post_id", s.requireAuth, handle(s.updatePost))
+	g.DELETE("/users/:id/posts/:post_id", s.requireAuth, handle(s.deletePost))
+	g.GET("/users/:id/preferences", reads, handle(s.getPreferences))
+	g.PATCH("/users/:id/preferences", s.requireAuth, handle(s.patchPreferences))
+	g.GET("/users/:id/audit", s.requireAuth, handle(s.getAuditLog))
+	g.POST("/users/:id/password", s.requireAuth, handle(s.changePassword))
+	g.GET("/users/:id/api-keys", s.requireAuth, handle(s.getAPIKeys))
+	g.POST("/users/:id/api-keys", s.requireAuth, handle(s.createAPIKey))
+	g.DELETE("/users/:id/api-keys/:key_id", s.requireAuth, handle(s.revokeAPIKey))
+
+	g.POST("/graphql", s.optionalAuth, handle(s.graphQL))
+
+	g.GET("/webhooks", s.requireAuth, handle(s.getWebhooks))
+	g.POST("/webhooks", s.requireAuth, handle(s.createWebhook))
+	g.GET("/webhooks/:id", s.requireAuth, handle(s.getWebhook))
+	g.PUT("/webhooks/:id", s.requireAuth, handle(s.updateWebhook))
+	g.DELETE("/webhooks/:id", s.requireAuth, handle(s.deleteWebhook))
+
+	g.POST("/admin/purge", s.requireAuth, handle(s.purgeUsers))
+}
@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"Unit-Test/internal/cache"
+	"Unit-Test/internal/purge"
+	"Unit-Test/internal/service"
+	"Unit-Test/internal/storage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	graphql "github.com/graph-gophers/graphql-go"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// Server holds what the handlers share: the database, the repositories, the
+// services and the configuration the server was built with
+type Server struct {
+	db          *gorm.DB
+	users       storage.UserRepository
+	userService *service.UserService
+	cfg         Config
+	// checks are the checks /readyz runs, in order
+	checks []ReadinessCheck
+	// cache holds the responses of the user reads; nil when disabled
+	cache *responseCache
+	// live pushes the user events to the clients of /users/ws
+	live *LiveFeed
+	// graphql answers /graphql
+	graphql *graphql.Schema
+	// notifier sends the welcome, password reset and verification emails
+	notifier service.Notifier
+	// purger answers /admin/purge
+	purger *purge.Purger
+	// loginThrottle guards /auth/login
+	loginThrottle LoginThrottle
+	// upgrader accepts the WebSockets of /users/ws
+	upgrader *websocket.Upgrader
+	// logger is what the handlers and middleware log through
+	logger *slog.Logger
+	// now tells the time that tokens expire by
+	now service.Clock
+	// dummyPasswordHash is compared against when the email is unknown, so a
+	// failed login takes as long whether or not the account exists
+	dummyPasswordHash []byte
+}
+
+// newServer builds a Server answering from deps
+func newServer(deps Deps) *Server {
+	cfg := deps.Config
+	users := deps.Users
+	if users == nil {
+		users = storage.NewUserRepository(deps.DB)
+	}
+	live := deps.Live
+	if live == nil {
+		live = NewLiveFeed(LiveOptions{})
+	}
+	var events service.Publisher = live
+	if deps.Events != nil {
+		events = service.Publishers{deps.Events, live}
+	}
+	logger := deps.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	now := deps.Clock
+	if now == nil {
+		now = time.Now
+	}
+	notifier := deps.Notifier
+	if notifier == nil {
+		notifier = service.LogNotifier{}
+	}
+	userService := service.NewUserService(service.Deps{
+		Users:    users,
+		Audit:    storage.NewAuditRepository(deps.DB),
+		Tx:       storage.NewTransactor(deps.DB),
+		Clock:    now,
+		Events:   events,
+		Notifier: notifier,
+		Logger:   logger,
+	})
+	purger := deps.Purger
+	if purger == nil {
+		purger = purge.New(deps.DB, purge.Options{Retention: cfg.PurgeRetention, BatchSize: cfg.PurgeBatchSize})
+	}
+	s := &Server{
+		db:            deps.DB,
+		users:         users,
+		userService:   userService,
+		cfg:           cfg,
+		live:          live,
+		notifier:      notifier,
+		purger:        purger,
+		loginThrottle: newMemoryLoginThrottle(cfg.LoginMaxFailures, cfg.LoginFailureWindow, cfg.LoginLockout),
+		upgrader:      newUpgrader(cfg.CORSAllowedOrigins),
+		logger:        logger,
+		now:           now,
+	}
+	s.dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("not-a-real-password"), cfg.BcryptCost)
+	s.checks = s.defaultReadinessChecks()
+	s.graphql = newGraphQLSchema(s)
+	if deps.Cache != nil {
+		s.cache = newResponseCache(deps.Cache, cfg.CacheTTL, logger)
+	}
+	return s
+}
+
+// dbFor is the database bound to the request's context, so its queries are
+// cancelled when the client goes away or the request times out
+func (s *Server) dbFor(c *gin.Context) *gorm.DB {
+	return s.db.WithContext(c.Request.Context())
+}
+
+// serviceContext is the request's context naming its caller as the actor of
+// the changes the services make
+func serviceContext(c *gin.Context) context.Context {
+	return service.WithActor(c.Request.Context(), auditActor(c))
+}
+
+// Deps are what the handlers are built from
+type Deps struct {
+	DB *gorm.DB
+	// Users stores the users; defaults to the GORM repository on DB
+	Users storage.UserRepository
+	// Events hears about every change to a user; defaults to dropping them
+	Events service.Publisher
+	// Live pushes the changes to the clients of /users/ws; defaults to a
+	// LiveFeed of its own, which is never closed
+	Live *LiveFeed
+	// Notifier sends the emails of registration, password resets and
+	// verification; defaults to logging them
+	Notifier service.Notifier
+	// Purger purges deleted users for /admin/purge; defaults to one on DB
+	// keeping them for PURGE_RETENTION
+	Purger *purge.Purger
+	// Cache holds the responses of the user reads; nil serves them uncached
+	Cache cache.Cache
+	// Logger logs the requests and what goes wrong answering them; defaults
+	// to slog.Default()
+	Logger *slog.Logger
+	// Clock tells the time that tokens expire by, and that changes are
+	// audited at; defaults to time.Now
+	Clock  service.Clock
+	Config Config
+}
@@ -0,0 +1,1576 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"Unit-Test/internal/models"
+	"Unit-Test/internal/service"
+	"Unit-Test/internal/storage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// UserPatch holds the fields accepted by a partial update.
+// A nil pointer means the key was absent from the request body.
+type UserPatch struct {
+	ID    *int    `json:"id,omitempty"`
+	Name  *string `json:"name,omitempty"`
+	Email *string `json:"email,omitempty" binding:"omitempty,email,max=100"`
+	Role  *string `json:"role,omitempty" binding:"omitempty,oneof=admin member viewer"`
+	Phone *string `json:"phone,omitempty" binding:"omitempty,phone"`
+	// Version must match the stored version unless an If-Match header is sent
+	Version *int `json:"version,omitempty"`
+}
+
+// Normalize cleans up the fields present in the patch the same way User.Normalize does
+func (p *UserPatch) Normalize() {
+	if p.Name != nil {
+		*p.Name = models.NormalizeName(*p.Name)
+	}
+	if p.Email != nil {
+		*p.Email = models.NormalizeEmail(*p.Email)
+	}
+}
+
+// apply sets the fields present in the patch on user, reporting whether there
+// were any. Required fields can't be emptied.
+func (p *UserPatch) apply(user *models.User) (bool, error) {
+	if p.Name != nil {
+		if *p.Name == "" {
+			return false, validationError("name cannot be empty")
+		}
+		user.Name = *p.Name
+	}
+	if p.Email != nil {
+		if *p.Email == "" {
+			return false, validationError("email cannot be empty")
+		}
+		user.Email = models.NormalizeEmail(*p.Email)
+	}
+	if p.Role != nil {
+		if *p.Role == "" {
+			return false, validationError("role cannot be empty")
+		}
+		user.Role = *p.Role
+	}
+	if p.Phone != nil {
+		// An empty phone clears the optional field
+		user.Phone = models.NormalizePhone(*p.Phone)
+	}
+	return p.Name != nil || p.Email != nil || p.Role != nil || p.Phone != nil, nil
+}
+
+// UpsertUserRequest is the body of an upsert keyed by email
+type UpsertUserRequest struct {
+	Name string `json:"name" binding:"required,max=100"`
+}
+
+// Normalize trims the requested name
+func (r *UpsertUserRequest) Normalize() {
+	r.Name = models.NormalizeName(r.Name)
+}
+
+// VersionConflictResponse is returned when an update was based on a stale version.
+// Current holds the stored user so the client can merge its changes.
+type VersionConflictResponse struct {
+	Code      string      `json:"code"`
+	Message   string      `json:"message"`
+	RequestID string      `json:"request_id,omitempty"`
+	Current   models.User `json:"current"`
+}
+
+// BulkCreated reports a user inserted by a bulk request
+type BulkCreated struct {
+	Index int `json:"index"`
+	ID    int `json:"id"`
+}
+
+// BulkError reports why the item at Index of a bulk request was not inserted
+type BulkError struct {
+	Index   int    `json:"index"`
+	Message string `json:"message"`
+}
+
+// BulkCreateResponse summarizes the outcome of a bulk create request
+type BulkCreateResponse struct {
+	Created []BulkCreated `json:"created"`
+	Errors  []BulkError   `json:"errors"`
+}
+
+// ListEnvelope is one page of a list with paging metadata, returned for
+// envelope=true and by every paginated list in v2. Data holds the same items
+// the plain list would contain.
+type ListEnvelope struct {
+	Data       interface{} `json:"data" swaggertype:"array,object"`
+	Total      int64       `json:"total"`
+	Page       int         `json:"page"`
+	PerPage    int         `json:"per_page"`
+	TotalPages int         `json:"total_pages"`
+}
+
+// CountResponse is returned by the count endpoint
+type CountResponse struct {
+	Count int64 `json:"count"`
+}
+
+// ImportRowError identifies a CSV line that was not imported
+type ImportRowError struct {
+	Line    int    `json:"line"`
+	Message string `json:"message"`
+}
+
+// ImportResponse summarizes the outcome of a CSV import
+type ImportResponse struct {
+	Imported int              `json:"imported"`
+	Skipped  []ImportRowError `json:"skipped"`
+	Failed   []ImportRowError `json:"failed"`
+}
+
+// Number of rows loaded per query when exporting users
+const exportBatchSize = 500
+
+// Columns the CSV export writes, the only ones it loads
+var exportColumns = []string{"id", "name", "email"}
+
+// Most users a bulk create accepts
+const maxBulkUsers = 1000
+
+// Pagination holds the parsed paging parameters for the users list.
+// Page mode uses OFFSET, cursor mode uses keyset pagination on the id column.
+type Pagination struct {
+	Page      int
+	Limit     int
+	Cursor    int
+	UseCursor bool
+}
+
+// Columns the users list may be sorted by, keyed by their JSON field name
+var userSortColumns = map[string]string{
+	"id":         "id",
+	"name":       "name",
+	"email":      "email",
+	"created_at": "created_at",
+	"updated_at": "updated_at",
+	"role":       "role",
+}
+
+// Fields that may be requested via ?fields=, keyed by JSON name
+var userFieldColumns = map[string]string{
+	"id":                "id",
+	"name":              "name",
+	"email":             "email",
+	"created_at":        "created_at",
+	"updated_at":        "updated_at",
+	"role":              "role",
+	"phone":             "phone",
+	"version":           "version",
+	"email_verified_at": "email_verified_at",
+}
+
+// Response formats offered by the read endpoints, in order of preference
+var offeredFormats = []string{gin.MIMEJSON, gin.MIMEXML}
+
+// E.164: a leading +, a non-zero country code digit and at most 15 digits in total
+var e164Pattern = regexp.MustCompile(`^\+[1-9][0-9]{1,14}$`)
+
+// Report validation errors using JSON field names rather than Go struct field names,
+// and register the custom validations used in binding tags
+func init() {
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterTagNameFunc(func(f reflect.StructField) string {
+			name := strings.SplitN(f.Tag.Get("json"), ",", 2)[0]
+			if name == "-" {
+				return ""
+			}
+			return name
+		})
+		v.RegisterValidation("phone", func(fl validator.FieldLevel) bool {
+			return e164Pattern.MatchString(models.NormalizePhone(fl.Field().String()))
+		})
+	}
+}
+
+// Fetch all users
+// @Summary Get all users
+// @Description Retrieve a list of all users in the database
+// @Description Supports offset pagination (page, limit) or keyset pagination (cursor, limit), but not both
+// @Tags Users
+// @Accept  json
+// @Produce  json
+// @Produce  xml
+// @Param page query int false "Page number (1-based)"
+// @Param limit query int false "Number of users per page (default 20, at most 100)"
+// @Param cursor query int false "ID of the last user from the previous page (0 to start)"
+// @Param sort query string false "Comma-separated sort keys, prefix with - for descending (e.g. name,-id)"
+// @Param name query string false "Case-insensitive substring match on name"
+// @Param email query string false "Exact match on email, ignoring case"
+// @Param role query string false "Exact match on role (admin, member, viewer)"
+// @Param verified query bool false "Only users whose email is (true) or is not (false) verified"
+// @Param ids query string false "Comma-separated user IDs to fetch (e.g. 1,2,3)"
+// @Param fields query string false "Comma-separated fields to return (id is always included)"
+// @Param include query string false "Associations to inline; only posts is supported"
+// @Param include_deleted query bool false "Include soft-deleted users with their deleted_at time (admins only)"
+// @Param envelope query bool false "Wrap the page in an object with total and page metadata (JSON only, not with cursor); always on in v2"
+// @Success 200 {array} models.User
+// @Success 200 {object} ListEnvelope "With envelope=true, and always in v2"
+// @Header 200 {string} X-Next-Cursor "Cursor for the next page (cursor mode only)"
+// @Header 200 {integer} X-Max-Page-Size "Largest accepted limit"
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Failure 406 {object} models.ErrorResponse
+// @Router /api/v1/users [get]
+// @Router /api/v2/users [get]
+func (s *Server) getUsers(c *gin.Context) error {
+	format, err := negotiateFormat(c)
+	if err != nil {
+		return err
+	}
+
+	c.Header("X-Max-Page-Size", strconv.Itoa(s.cfg.MaxPageSize))
+	pagination, err := s.parsePagination(c)
+	if err != nil {
+		return validationError(err.Error())
+	}
+
+	order, err := parseSort(c.Query("sort"))
+	if err != nil {
+		return validationError(err.Error())
+	}
+	if len(order) > 0 && pagination != nil && pagination.UseCursor {
+		return validationError("sort cannot be combined with cursor")
+	}
+
+	ids, hasIDs, err := parseIDs(c.Query("ids"))
+	if err != nil {
+		return validationError(err.Error())
+	}
+
+	fields, err := parseFields(c.Query("fields"))
+	if err != nil {
+		return validationError(err.Error())
+	}
+
+	includePosts, err := parseInclude(c.Query("include"))
+	if err != nil {
+		return validationError(err.Error())
+	}
+
+	includeDeleted := s.cfg.AllowIncludeDeleted && c.Query("include_deleted") == "true"
+	if includeDeleted {
+		admin, err := s.callerIsAdmin(c)
+		if err != nil {
+			return err
+		}
+		if !admin {
+			return newAPIError(http.StatusForbidden, CodeForbidden, "include_deleted requires admin access")
+		}
+	}
+	if includeDeleted && includePosts {
+		return validationError("include cannot be combined with include_deleted")
+	}
+
+	envelope := wantsEnvelope(c)
+	if envelope {
+		if format == gin.MIMEXML {
+			return validationError("envelope is only available as JSON")
+		}
+		if pagination != nil && pagination.UseCursor {
+			return validationError("envelope cannot be combined with cursor")
+		}
+		// The envelope always describes a page, so fall back to the first one
+		if pagination == nil {
+			pagination = &Pagination{Page: 1, Limit: s.cfg.DefaultPageSize}
+		}
+	}
+
+	filter := userFilter(c)
+	filter.IncludeDeleted = includeDeleted
+	if hasIDs {
+		filter.IDs = ids
+	}
+
+	var total int64
+	if envelope {
+		if total, err = s.users.Count(c.Request.Context(), filter); err != nil {
+			return err
+		}
+	}
+
+	opts := pagination.options()
+	opts.Sort = order
+	opts.WithPosts = includePosts
+	if fields != nil {
+		opts.Columns = fieldColumns(fields)
+		if includeDeleted {
+			opts.Columns = append(opts.Columns, "deleted_at")
+		}
+	}
+	users, err := s.users.List(c.Request.Context(), filter, opts)
+	if err != nil {
+		return err
+	}
+
+	// A full page means there may be more rows after the last id
+	if pagination != nil && pagination.UseCursor && len(users) == pagination.Limit {
+		c.Header("X-Next-Cursor", strconv.Itoa(users[len(users)-1].ID))
+	}
+
+	var body interface{}
+	switch {
+	case includeDeleted:
+		body = usersWithDeletedBody(format, users, fields)
+	case includePosts:
+		body = usersWithPostsBody(format, users, fields)
+	case format == gin.MIMEXML:
+		// Unselected fields are empty and dropped by their omitempty tags
+		body = models.UserList{Users: users}
+	case fields != nil:
+		projected := make([]map[string]interface{}, 0, len(users))
+		for _, u := range users {
+			projected = append(projected, projectUser(u, fields))
+		}
+		body = projected
+	default:
+		body = users
+	}
+	if envelope {
+		body = newListEnvelope(body, total, pagination)
+	}
+	render(c, format, 200, body)
+	return nil
+}
+
+// usersWithDeletedBody builds the admin view of the users list, where every user
+// carries a deleted_at field that is null for active users
+func usersWithDeletedBody(format string, users []models.User, fields []string) interface{} {
+	list := make([]models.UserWithDeleted, 0, len(users))
+	for _, u := range users {
+		item := models.UserWithDeleted{User: u}
+		if u.DeletedAt.Valid {
+			item.DeletedAt = &u.DeletedAt.Time
+		}
+		list = append(list, item)
+	}
+
+	if format == gin.MIMEXML {
+		return models.UserWithDeletedList{Users: list}
+	}
+	if fields != nil {
+		projected := make([]map[string]interface{}, 0, len(list))
+		for _, u := range list {
+			item := projectUser(u.User, fields)
+			item["deleted_at"] = u.DeletedAt
+			projected = append(projected, item)
+		}
+		return projected
+	}
+	return list
+}
+
+// usersWithPostsBody builds the users list with every user's posts inlined
+func usersWithPostsBody(format string, users []models.User, fields []string) interface{} {
+	list := make([]models.UserWithPosts, 0, len(users))
+	for _, u := range users {
+		list = append(list, withPosts(u))
+	}
+
+	if format == gin.MIMEXML {
+		return models.UserWithPostsList{Users: list}
+	}
+	if fields != nil {
+		projected := make([]map[string]interface{}, 0, len(list))
+		for _, u := range list {
+			item := projectUser(u.User, fields)
+			item["posts"] = u.Posts
+			projected = append(projected, item)
+		}
+		return projected
+	}
+	return list
+}
+
+// newListEnvelope wraps one page of a list with the paging totals
+func newListEnvelope(data interface{}, total int64, p *Pagination) ListEnvelope {
+	return ListEnvelope{
+		Data:       data,
+		Total:      total,
+		Page:       p.Page,
+		PerPage:    p.Limit,
+		TotalPages: int((total + int64(p.Limit) - 1) / int64(p.Limit)),
+	}
+}
+
+// listAuth is readAuth for the users list, except that asking for deleted
+// users always takes credentials, which tell whether the caller is an admin
+func (s *Server) listAuth() gin.HandlerFunc {
+	reads := s.readAuth()
+	return func(c *gin.Context) {
+		if s.cfg.AllowIncludeDeleted && c.Query("include_deleted") != "" {
+			s.requireAuth(c)
+			return
+		}
+		reads(c)
+	}
+}
+
+// render writes data as XML when that format was negotiated, JSON otherwise
+func render(c *gin.Context, format string, status int, data interface{}) {
+	if format == gin.MIMEXML {
+		c.XML(status, data)
+		return
+	}
+	c.JSON(status, data)
+}
+
+// parseIDs parses a comma-separated list of user IDs, dropping duplicates.
+// The boolean result reports whether any ids were requested at all.
+func parseIDs(raw string) ([]int, bool, error) {
+	if raw == "" {
+		return nil, false, nil
+	}
+
+	seen := map[int]bool{}
+	ids := []int{}
+	for _, token := range strings.Split(raw, ",") {
+		token = strings.TrimSpace(token)
+		if token == "" {
+			continue
+		}
+		id, err := strconv.Atoi(token)
+		if err != nil {
+			return nil, true, errors.New("invalid id: " + token)
+		}
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	return ids, true, nil
+}
+
+// parseFields validates a comma-separated list of JSON field names.
+// It returns nil when no fields were requested; otherwise id is always included.
+func parseFields(raw string) ([]string, error) {
+	if raw == "" {
+		return nil, nil
+	}
+
+	fields := []string{"id"}
+	seen := map[string]bool{"id": true}
+	for _, field := range strings.Split(raw, ",") {
+		field = strings.TrimSpace(field)
+		if _, ok := userFieldColumns[field]; !ok {
+			return nil, errors.New("invalid field: " + field)
+		}
+		if !seen[field] {
+			seen[field] = true
+			fields = append(fields, field)
+		}
+	}
+	return fields, nil
+}
+
+// fieldColumns maps JSON field names to their database columns
+func fieldColumns(fields []string) []string {
+	columns := make([]string, 0, len(fields))
+	for _, f := range fields {
+		columns = append(columns, userFieldColumns[f])
+	}
+	return columns
+}
+
+// projectUser returns only the requested JSON fields of a user
+func projectUser(user models.User, fields []string) map[string]interface{} {
+	var full map[string]interface{}
+	data, _ := json.Marshal(user)
+	_ = json.Unmarshal(data, &full)
+
+	projected := make(map[string]interface{}, len(fields))
+	for _, f := range fields {
+		projected[f] = full[f]
+	}
+	return projected
+}
+
+// userFilter reads the name, email, role and verified query filters shared by
+// the list endpoints
+func userFilter(c *gin.Context) storage.UserFilter {
+	filter := storage.UserFilter{Name: c.Query("name"), Email: c.Query("email"), Role: c.Query("role")}
+	switch c.Query("verified") {
+	case "true":
+		filter.Verified = &[]bool{true}[0]
+	case "false":
+		filter.Verified = &[]bool{false}[0]
+	}
+	return filter
+}
+
+// parsePagination reads page, limit and cursor from the query string.
+// It returns nil when no paging parameters were supplied.
+func (s *Server) parsePagination(c *gin.Context) (*Pagination, error) {
+	pageStr, hasPage := c.GetQuery("page")
+	limitStr, hasLimit := c.GetQuery("limit")
+	cursorStr, hasCursor := c.GetQuery("cursor")
+
+	if !hasPage && !hasLimit && !hasCursor {
+		return nil, nil
+	}
+	if hasPage && hasCursor {
+		return nil, errors.New("page and cursor are mutually exclusive")
+	}
+
+	p := &Pagination{Page: 1, Limit: s.cfg.DefaultPageSize}
+	if hasLimit {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit < 1 {
+			return nil, errors.New("limit must be a positive integer")
+		}
+		if limit > s.cfg.MaxPageSize {
+			return nil, errors.New("limit must be at most " + strconv.Itoa(s.cfg.MaxPageSize))
+		}
+		p.Limit = limit
+	}
+	if hasPage {
+		page, err := strconv.Atoi(pageStr)
+		if err != nil || page < 1 {
+			return nil, errors.New("page must be a positive integer")
+		}
+		p.Page = page
+	}
+	if hasCursor {
+		cursor, err := strconv.Atoi(cursorStr)
+		if err != nil || cursor < 0 {
+			return nil, errors.New("cursor must be a non-negative integer")
+		}
+		p.Cursor = cursor
+		p.UseCursor = true
+	}
+	return p, nil
+}
+
+// parseSort turns a value like "name,-id" into the columns to order by.
+// Only keys listed in userSortColumns are accepted.
+func parseSort(sort string) ([]storage.Sort, error) {
+	if sort == "" {
+		return nil, nil
+	}
+
+	var order []storage.Sort
+	for _, key := range strings.Split(sort, ",") {
+		key = strings.TrimSpace(key)
+		desc := strings.HasPrefix(key, "-")
+		field := strings.TrimPrefix(key, "-")
+
+		column, ok := userSortColumns[field]
+		if !ok {
+			return nil, errors.New("invalid sort field: " + field)
+		}
+		order = append(order, storage.Sort{Column: column, Desc: desc})
+	}
+	return order, nil
+}
+
+// options are the repository's paging options for p
+func (p *Pagination) options() storage.ListOptions {
+	if p == nil {
+		return storage.ListOptions{}
+	}
+	if p.UseCursor {
+		return storage.ListOptions{Limit: p.Limit, AfterID: &p.Cursor}
+	}
+	return storage.ListOptions{Limit: p.Limit, Offset: (p.Page - 1) * p.Limit}
+}
+
+// Minimum length of a search query
+const minSearchLength = 2
+
+// Search users by name or email
+// @Summary Search users
+// @Description Case-insensitive search across name and email, exact email matches are ranked first
+// @Tags Users
+// @Accept  json
+// @Produce  json
+// @Param q query string true "Search text (at least 2 characters)"
+// @Param page query int false "Page number (1-based)"
+// @Param limit query int false "Number of users per page (default 20, at most 100)"
+// @Success 200 {array} models.User "In v1"
+// @Success 200 {object} ListEnvelope "In v2"
+// @Header 200 {integer} X-Max-Page-Size "Largest accepted limit"
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/v1/users/search [get]
+// @Router /api/v2/users/search [get]
+func (s *Server) searchUsers(c *gin.Context) error {
+	q := strings.TrimSpace(c.Query("q"))
+	if len([]rune(q)) < minSearchLength {
+		return validationError("q must be at least 2 characters")
+	}
+
+	c.Header("X-Max-Page-Size", strconv.Itoa(s.cfg.MaxPageSize))
+	pagination, err := s.parsePagination(c)
+	if err != nil {
+		return validationError(err.Error())
+	}
+	if pagination != nil && pagination.UseCursor {
+		return validationError("cursor is not supported for search")
+	}
+	envelope := wantsEnvelope(c)
+	if envelope && pagination == nil {
+		pagination = &Pagination{Page: 1, Limit: s.cfg.DefaultPageSize}
+	}
+
+	ctx := c.Request.Context()
+	var total int64
+	if envelope {
+		if total, err = s.users.Count(ctx, storage.UserFilter{Search: q}); err != nil {
+			return err
+		}
+	}
+	users, err := s.users.Search(ctx, q, pagination.options())
+	if err != nil {
+		return err
+	}
+	if envelope {
+		c.JSON(200, newListEnvelope(users, total, pagination))
+		return nil
+	}
+	c.JSON(200, users)
+	return nil
+}
+
+// Count users
+// @Summary Count users
+// @Description Return the number of users, honoring the same filters as the list endpoint
+// @Tags Users
+// @Accept  json
+// @Produce  json
+// @Param name query string false "Case-insensitive substring match on name"
+// @Param email query string false "Exact match on email, ignoring case"
+// @Param role query string false "Exact match on role (admin, member, viewer)"
+// @Param verified query bool false "Only users whose email is (true) or is not (false) verified"
+// @Success 200 {object} CountResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/v1/users/count [get]
+// @Router /api/v2/users/count [get]
+func (s *Server) countUsers(c *gin.Context) error {
+	count, err := s.users.Count(c.Request.Context(), userFilter(c))
+	if err != nil {
+		return err
+	}
+	c.JSON(200, CountResponse{Count: count})
+	return nil
+}
+
+// Export users as CSV
+// @Summary Export users as CSV
+// @Description Stream all users as a CSV attachment, honoring the same filters as the list endpoint
+// @Tags Users
+// @Produce  text/csv
+// @Param name query string false "Case-insensitive substring match on name"
+// @Param email query string false "Exact match on email, ignoring case"
+// @Param role query string false "Exact match on role (admin, member, viewer)"
+// @Param verified query bool false "Only users whose email is (true) or is not (false) verified"
+// @Success 200 {string} string "CSV with columns id,name,email"
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/v1/users/export [get]
+// @Router /api/v2/users/export [get]
+func (s *Server) exportUsers(c *gin.Context) error {
+	c.Header("Content-Type", "text/csv")
+	c.Header("Content-Disposition", `attachment; filename="users.csv"`)
+
+	w := csv.NewWriter(c.Writer)
+	_ = w.Write(exportColumns)
+
+	err := s.users.Stream(c.Request.Context(), userFilter(c), exportColumns, exportBatchSize, func(batch []models.User) error {
+		for _, u := range batch {
+			_ = w.Write([]string{strconv.Itoa(u.ID), u.Name, u.Email})
+		}
+		// Flush each batch so memory stays flat regardless of table size
+		w.Flush()
+		return w.Error()
+	})
+	if err == nil {
+		w.Flush()
+		err = w.Error()
+	}
+
+	if err != nil {
+		if !c.Writer.Written() {
+			c.Header("Content-Type", "application/json; charset=utf-8")
+			c.Header("Content-Disposition", "")
+			return err
+		}
+		// The status line is already sent, so all we can do is cut the stream short
+		requestLog(c).Error("user export aborted", "error", err.Error())
+		c.Abort()
+	}
+	return nil
+}
+
+// Stream users as NDJSON
+// @Summary Stream users as NDJSON
+// @Description Stream all users as newline-delimited JSON, one user per line, honoring the same filters as the list endpoint
+// @Tags Users
+// @Produce  application/x-ndjson
+// @Param name query string false "Case-insensitive substring match on name"
+// @Param email query string false "Exact match on email, ignoring case"
+// @Param role query string false "Exact match on role (admin, member, viewer)"
+// @Param verified query bool false "Only users whose email is (true) or is not (false) verified"
+// @Success 200 {string} string "One JSON user per line"
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/v1/users/stream [get]
+// @Router /api/v2/users/stream [get]
+func (s *Server) streamUsers(c *gin.Context) error {
+	c.Header("Content-Type", "application/x-ndjson")
+
+	enc := json.NewEncoder(c.Writer)
+	ctx := c.Request.Context()
+	err := s.users.Stream(ctx, userFilter(c), nil, exportBatchSize, func(batch []models.User) error {
+		// A client that went away stops the stream at the next batch
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		for _, u := range batch {
+			if err := enc.Encode(u); err != nil {
+				return err
+			}
+		}
+		// Flush each batch so memory stays flat regardless of table size
+		c.Writer.Flush()
+		return nil
+	})
+
+	switch {
+	case err == nil:
+	case !c.Writer.Written():
+		c.Header("Content-Type", "application/json; charset=utf-8")
+		return err
+	case ctx.Err() != nil:
+		requestLog(c).Info("user stream stopped, the client went away")
+		c.Abort()
+	default:
+		// The status line is already sent, so all we can do is cut the stream short
+		requestLog(c).Error("user stream aborted", "error", err.Error())
+		c.Abort()
+	}
+	return nil
+}
+
+// Fetch a single user by ID
+// @Summary Get user by ID
+// @Description Retrieve a single user's details by their ID
+// @Tags Users
+// @Accept json
+// @Produce json
+// @Produce xml
+// @Param id path int true "User ID" // The ID of the user to retrieve
+// @Param fields query string false "Comma-separated fields to return (id is always included)"
+// @Param include query string false "Associations to inline; only posts is supported"
+// @Param If-None-Match header string false "ETag from a previous response"
+// @Success 200 {object} models.User // The user object returned in the response
+// @Header 200 {string} ETag "Weak validator for the returned user"
+// @Success 304 "User has not changed since the given ETag"
+// @Failure 400 {object} models.ErrorResponse // Bad request if the ID is invalid
+// @Failure 404 {object} models.ErrorResponse // models.User not found
+// @Failure 406 {object} models.ErrorResponse // Unsupported Accept header
+// @Failure 500 {object} models.ErrorResponse // Internal server error
+// @Router /api/v1/users/{id} [get]
+// @Router /api/v2/users/{id} [get]
+func (s *Server) getUser(c *gin.Context) error {
+	format, err := negotiateFormat(c)
+	if err != nil {
+		return err
+	}
+
+	fields, err := parseFields(c.Query("fields"))
+	if err != nil {
+		return validationError(err.Error())
+	}
+
+	includePosts, err := parseInclude(c.Query("include"))
+	if err != nil {
+		return validationError(err.Error())
+	}
+
+	id, err := parseUserID(c)
+	if err != nil {
+		return validationError(err.Error())
+	}
+
+	opts := storage.ListOptions{WithPosts: includePosts}
+	if fields != nil {
+		opts.Columns = fieldColumns(fields)
+	}
+	found, err := s.users.List(c.Request.Context(), storage.UserFilter{IDs: []int{id}}, opts)
+	if err != nil {
+		return err
+	}
+	if len(found) == 0 {
+		return newAPIError(http.StatusNotFound, CodeUserNotFound, "User not found")
+	}
+	user := found[0]
+
+	// The included posts are part of the representation, so they count towards the ETag
+	var body interface{} = user
+	if includePosts {
+		body = withPosts(user)
+	}
+	etag := userETag(body)
+	c.Header("ETag", etag)
+	if etagMatches(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
+		return nil
+	}
+
+	if fields != nil && format == gin.MIMEJSON {
+		projected := projectUser(user, fields)
+		if includePosts {
+			projected["posts"] = body.(models.UserWithPosts).Posts
+		}
+		c.JSON(200, projected)
+		return nil
+	}
+	render(c, format, 200, body)
+	return nil
+}
+
+// Check whether a user exists
+// @Summary Check user existence
+// @Description Return 200 with an empty body when the user exists, 404 otherwise
+// @Tags Users
+// @Param id path int true "User ID"
+// @Success 200
+// @Failure 400
+// @Failure 404
+// @Failure 500
+// @Router /api/v1/users/{id} [head]
+// @Router /api/v2/users/{id} [head]
+func (s *Server) headUser(c *gin.Context) error {
+	// A HEAD response never has a body, whatever the outcome
+	c.Header("Content-Length", "0")
+	id, err := parseUserID(c)
+	if err != nil {
+		return validationError(err.Error())
+	}
+	if _, err := s.lookupUser(c, id); err != nil {
+		return notFoundAs(err, CodeUserNotFound, "User not found")
+	}
+	c.Status(http.StatusOK)
+	return nil
+}
+
+// userETag computes a weak ETag from the serialized user representation
+func userETag(user interface{}) string {
+	data, _ := json.Marshal(user)
+	sum := sha1.Sum(data)
+	return `W/"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+// etagMatches reports whether an If-None-Match header matches etag using weak comparison
+func etagMatches(header, etag string) bool {
+	if header == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// parseUserID reads the :id path parameter, which must be a positive integer
+func parseUserID(c *gin.Context) (int, error) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id < 1 {
+		return 0, errors.New("id must be a positive integer")
+	}
+	return id, nil
+}
+
+// lookupUser loads the user with the given id
+func (s *Server) lookupUser(c *gin.Context, id int) (models.User, error) {
+	return s.users.Get(c.Request.Context(), id)
+}
+
+// requireUser reads the :id path parameter and checks that the user exists
+func (s *Server) requireUser(c *gin.Context) (int, error) {
+	id, err := parseUserID(c)
+	if err != nil {
+		return 0, validationError(err.Error())
+	}
+	if _, err := s.lookupUser(c, id); err != nil {
+		return 0, notFoundAs(err, CodeUserNotFound, "User not found")
+	}
+	return id, nil
+}
+
+// Create a new user
+// @Summary Create a new user
+// @Description Create a new user by providing a name and email. Only admins may give it a role other than member.
+// @Tags Users
+// @Accept  json
+// @Produce  json
+// @Param user body models.User true "New user information"
+// @Success 201 {object} models.User
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Security BearerAuth
+// @Router /api/v1/users [post]
+// @Router /api/v2/users [post]
+func (s *Server) createUser(c *gin.Context) error {
+	var user models.User
+	if err := s.bindNormalized(c, &user); err != nil {
+		return invalidInput(err)
+	}
+	// Ids are assigned, never chosen by the client
+	user.ID = 0
+	if user.Role != "" {
+		if err := s.checkRoleChange(c, models.RoleMember, user.Role); err != nil {
+			return err
+		}
+	}
+
+	if err := s.userService.Create(serviceContext(c), &user); err != nil {
+		return conflictAs(err, CodeDuplicateEmail, "email already in use")
+	}
+
+	c.JSON(201, user)
+	return nil
+}
+
+// Create many users in one request
+// @Summary Create users in bulk
+// @Description Create up to 1000 users in a single transaction. Invalid or duplicate entries are reported by index.
+// @Description With atomic=true nothing is inserted unless every entry is valid. Admins only.
+// @Tags Users
+// @Accept  json
+// @Produce  json
+// @Param users body []models.User true "Users to create"
+// @Param atomic query bool false "Reject the whole batch if any entry fails"
+// @Success 201 {object} BulkCreateResponse
+// @Success 207 {object} BulkCreateResponse
+// @Failure 400 {object} BulkCreateResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Security BearerAuth
+// @Router /api/v1/users/bulk [post]
+// @Router /api/v2/users/bulk [post]
+func (s *Server) createUsersBulk(c *gin.Context) error {
+	// Decode without binding validation so invalid entries are reported per index
+	var users []models.User
+	if err := json.NewDecoder(c.Request.Body).Decode(&users); err != nil {
+		if isBodyTooLarge(err) {
+			return err
+		}
+		return validationError("Invalid input")
+	}
+	if len(users) == 0 || len(users) > maxBulkUsers {
+		return validationError("Request must contain between 1 and 1000 users")
+	}
+	atomic := c.Query("atomic") == "true"
+	// Ids are assigned, never chosen by the client
+	for i := range users {
+		users[i].ID = 0
+	}
+
+	rejected, err := s.userService.CreateMany(serviceContext(c), users, checkNewUser, atomic)
+	if err != nil && !errors.Is(err, service.ErrRejected) {
+		return err
+	}
+
+	resp := BulkCreateResponse{Created: []BulkCreated{}, Errors: []BulkError{}}
+	skipped := map[int]bool{}
+	for _, r := range rejected {
+		resp.Errors = append(resp.Errors, BulkError{Index: r.Index, Message: rejectionMessage(r.Err)})
+		skipped[r.Index] = true
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, resp)
+		return nil
+	}
+	for i, u := range users {
+		if !skipped[i] {
+			resp.Created = append(resp.Created, BulkCreated{Index: i, ID: u.ID})
+		}
+	}
+	if len(resp.Errors) > 0 {
+		c.JSON(http.StatusMultiStatus, resp)
+		return nil
+	}
+	c.JSON(201, resp)
+	return nil
+}
+
+// checkNewUser validates a user of a bulk create or import, which are decoded
+// without binding so that every invalid entry can be reported
+func checkNewUser(user *models.User) error {
+	if user.Name == "" || user.Email == "" {
+		return errors.New("name and email are required")
+	}
+	if err := binding.Validator.ValidateStruct(user); err != nil {
+		return errors.New(validationMessage(err))
+	}
+	return nil
+}
+
+// rejectionMessage tells the client why a bulk create or import skipped a user
+func rejectionMessage(err error) string {
+	if errors.Is(err, storage.ErrDuplicateEmail) {
+		return "email already in use"
+	}
+	return err.Error()
+}
+
+// Import users from CSV
+// @Summary Import users from CSV
+// @Description Import users from a CSV with a name,email header, sent as a multipart "file" field or a raw text/csv body.
+// @Description Rows with an email that is already in use are skipped; invalid rows are reported as failed. Admins only.
+// @Tags Users
+// @Accept  text/csv
+// @Accept  multipart/form-data
+// @Produce  json
+// @Param file formData file false "CSV file"
+// @Success 200 {object} ImportResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Security BearerAuth
+// @Router /api/v1/users/import [post]
+// @Router /api/v2/users/import [post]
+func (s *Server) importUsers(c *gin.Context) error {
+	body := io.Reader(c.Request.Body)
+	if strings.HasPrefix(c.ContentType(), "multipart/form-data") {
+		fileHeader, err := c.FormFile("file")
+		if isBodyTooLarge(err) {
+			return err
+		}
+		if err != nil {
+			return validationError("Missing file upload")
+		}
+		file, err := fileHeader.Open()
+		if err != nil {
+			return validationError("Unable to read file upload")
+		}
+		defer file.Close()
+		body = file
+	}
+
+	// Parse the whole file first so malformed input never touches the database
+	reader := csv.NewReader(body)
+	reader.FieldsPerRecord = 2
+	header, err := reader.Read()
+	if isBodyTooLarge(err) {
+		return err
+	}
+	if err != nil || !strings.EqualFold(strings.TrimSpace(header[0]), "name") || !strings.EqualFold(strings.TrimSpace(header[1]), "email") {
+		return validationError("CSV must start with a name,email header")
+	}
+
+	var users []models.User
+	var lines []int
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if isBodyTooLarge(err) {
+			return err
+		}
+		if err != nil {
+			return validationError("Malformed CSV: " + err.Error())
+		}
+		line, _ := reader.FieldPos(0)
+		users = append(users, models.User{Name: record[0], Email: record[1]})
+		lines = append(lines, line)
+	}
+
+	resp := ImportResponse{Skipped: []ImportRowError{}, Failed: []ImportRowError{}}
+	if len(users) == 0 {
+		c.JSON(200, resp)
+		return nil
+	}
+
+	rejected, err := s.userService.CreateMany(serviceContext(c), users, checkNewUser, false)
+	if err != nil {
+		return err
+	}
+	for _, r := range rejected {
+		row := ImportRowError{Line: lines[r.Index], Message: rejectionMessage(r.Err)}
+		if errors.Is(r.Err, storage.ErrDuplicateEmail) {
+			resp.Skipped = append(resp.Skipped, row)
+		} else {
+			resp.Failed = append(resp.Failed, row)
+		}
+	}
+	resp.Imported = len(users) - len(rejected)
+
+	c.JSON(200, resp)
+	return nil
+}
+
+// normalizer is implemented by request bodies that clean up their own input
+type normalizer interface {
+	Normalize()
+}
+
+// bindNormalized decodes the JSON body into obj and normalizes it before validating,
+// so that surrounding whitespace doesn't fail rules such as email or required
+func (s *Server) bindNormalized(c *gin.Context, obj normalizer) error {
+	if c.Request.Body == nil {
+		return errors.New("missing request body")
+	}
+	decoder := json.NewDecoder(c.Request.Body)
+	// LENIENT_JSON ignores unknown fields instead of rejecting them, for
+	// clients that send extra metadata along with the user
+	if !s.cfg.LenientJSON {
+		decoder.DisallowUnknownFields()
+	}
+	if err := decoder.Decode(obj); err != nil {
+		// encoding/json has no typed error for this case, only the message
+		if field, ok := strings.CutPrefix(err.Error(), `json: unknown field "`); ok {
+			return unknownFieldError{Field: strings.TrimSuffix(field, `"`)}
+		}
+		return err
+	}
+	obj.Normalize()
+	return binding.Validator.ValidateStruct(obj)
+}
+
+// unknownFieldError reports a body key that doesn't belong to the target struct
+type unknownFieldError struct {
+	Field string
+}
+
+func (e unknownFieldError) Error() string {
+	return "unknown field: " + e.Field
+}
+
+// bindingErrorResponse turns a binding failure into an ErrorResponse with one entry per failed field
+func bindingErrorResponse(err error) models.ErrorResponse {
+	var unknown unknownFieldError
+	if errors.As(err, &unknown) {
+		return models.ErrorResponse{
+			Code:    CodeValidation,
+			Message: unknown.Error(),
+			Errors:  []models.FieldError{{Field: unknown.Field, Error: "is not a known field"}},
+		}
+	}
+
+	var verrs validator.ValidationErrors
+	if !errors.As(err, &verrs) {
+		return models.ErrorResponse{Code: CodeValidation, Message: "Invalid input"}
+	}
+
+	resp := models.ErrorResponse{Code: CodeValidation, Message: "validation failed"}
+	for _, fe := range verrs {
+		resp.Errors = append(resp.Errors, models.FieldError{Field: fe.Field(), Error: fieldErrorText(fe)})
+	}
+	return resp
+}
+
+// fieldErrorText describes a failed validation rule in plain words
+func fieldErrorText(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "email":
+		return "must be a valid email"
+	case "max":
+		return "must be at most " + fe.Param() + " characters"
+	case "oneof":
+		return "must be one of: " + strings.ReplaceAll(fe.Param(), " ", ", ")
+	case "phone":
+		return "must be a valid E.164 phone number, e.g. +15551234567"
+	case "http_url":
+		return "must be an http or https URL"
+	}
+	return "is invalid"
+}
+
+// validationMessage summarizes a binding failure in one line, naming the first offending field
+func validationMessage(err error) string {
+	resp := bindingErrorResponse(err)
+	if len(resp.Errors) == 0 {
+		return resp.Message
+	}
+	return resp.Errors[0].Field + " " + resp.Errors[0].Error
+}
+
+// Update an existing user
+// @Summary Update an existing user
+// @Description Update a user's name and email by their ID. The version of the user being
+// @Description updated must be supplied; a stale version returns 409 with the current record.
+// @Description An id in the body is optional; if present it must match the path id, otherwise 400 is returned. Only the user themselves or an admin may do this, and only admins may change the role.
+// @Tags Users
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID" // This is the ID parameter from the URL path
+// @Param user body models.User true "Updated user information" // The request body (updated user data)
+// @Param If-Match header string false "Version the update is based on, if not sent in the body"
+// @Success 200 {object} models.User // The updated user object returned in the response
+// @Failure 400 {object} models.ErrorResponse // Bad request if the input is invalid
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse // If the user is not found
+// @Failure 409 {object} VersionConflictResponse // If the email belongs to another user or the version is stale
+// @Failure 428 {object} models.ErrorResponse // If no version was supplied
+// @Failure 500 {object} models.ErrorResponse // Internal server error
+// @Security BearerAuth
+// @Router /api/v1/users/{id} [put]
+// @Router /api/v2/users/{id} [put]
+func (s *Server) updateUser(c *gin.Context) error {
+	id, err := parseUserID(c)
+	if err != nil {
+		return validationError(err.Error())
+	}
+
+	user, err := s.lookupUser(c, id)
+	if err != nil {
+		return notFoundAs(err, CodeUserNotFound, "User not found")
+	}
+
+	before := user
+
+	// Binding into the loaded user could overwrite the creation time, so keep the stored one.
+	// ID and Version are cleared first so we can tell whether the body supplied them.
+	createdAt, storedVersion, previousRole := user.CreatedAt, user.Version, user.Role
+	user.ID, user.Version = 0, 0
+	if err := s.bindNormalized(c, &user); err != nil {
+		return invalidInput(err)
+	}
+	// Clients may send back the id they fetched, but never retarget the update
+	if user.ID != 0 && user.ID != id {
+		return validationError("id cannot be modified")
+	}
+	user.ID = id
+	user.CreatedAt = createdAt
+	// Only verification sets email_verified_at
+	user.EmailVerifiedAt = before.EmailVerifiedAt
+	if err := s.checkRoleChange(c, previousRole, user.Role); err != nil {
+		return err
+	}
+
+	var bodyVersion *int
+	if user.Version != 0 {
+		bodyVersion = &user.Version
+	}
+	expected, err := expectedVersion(c, bodyVersion)
+	if err != nil {
+		return newAPIError(http.StatusPreconditionRequired, CodePreconditionRequired, err.Error())
+	}
+	if expected != storedVersion {
+		return s.respondVersionConflict(c, id)
+	}
+
+	// Fails with a version conflict if another request bumped the version
+	// between our read and write
+	user.Version = expected
+	var verificationToken string
+	err = s.userService.Update(serviceContext(c), &user, s.reverifyChangedEmail(&verificationToken))
+	if errors.Is(err, storage.ErrVersionConflict) {
+		return s.respondVersionConflict(c, id)
+	}
+	if err != nil {
+		return conflictAs(err, CodeDuplicateEmail, "email already in use")
+	}
+	logRoleChange(c, user.ID, previousRole, user.Role)
+	s.sendEmailVerification(c, user.Email, verificationToken)
+
+	c.JSON(200, user)
+	return nil
+}
+
+// logRoleChange records role changes, which downstream authorization depends on
+func logRoleChange(c *gin.Context, userID int, from, to string) {
+	if from != to {
+		requestLog(c).Info("user role changed", "user_id", userID, "from", from, "to", to)
+	}
+}
+
+// expectedVersion returns the version an update is based on, taken from the
+// request body or, failing that, from an If-Match header
+func expectedVersion(c *gin.Context, bodyVersion *int) (int, error) {
+	if bodyVersion != nil {
+		return *bodyVersion, nil
+	}
+	if header := c.GetHeader("If-Match"); header != "" {
+		version, err := strconv.Atoi(strings.Trim(strings.TrimPrefix(header, "W/"), `"`))
+		if err == nil {
+			return version, nil
+		}
+	}
+	return 0, errors.New("version is required, send it in the body or an If-Match header")
+}
+
+// respondVersionConflict writes a 409 carrying the currently stored user. It
+// returns an error instead when that user can no longer be loaded.
+func (s *Server) respondVersionConflict(c *gin.Context, id int) error {
+	current, err := s.lookupUser(c, id)
+	if err != nil {
+		return notFoundAs(err, CodeUserNotFound, "User not found")
+	}
+	c.JSON(http.StatusConflict, VersionConflictResponse{
+		Code:      CodeVersionConflict,
+		Message:   "User was modified by another request",
+		RequestID: requestID(c),
+		Current:   current,
+	})
+	return nil
+}
+
+// Partially update an existing user
+// @Summary Partially update a user
+// @Description Update only the fields present in the request body; the id cannot be changed. Only the user themselves or an admin may do this, and only admins may change the role.
+// @Tags Users
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Param user body UserPatch true "Fields to update"
+// @Param If-Match header string false "Version the update is based on, if not sent in the body"
+// @Success 200 {object} models.User
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} VersionConflictResponse
+// @Failure 428 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Security BearerAuth
+// @Router /api/v1/users/{id} [patch]
+// @Router /api/v2/users/{id} [patch]
+func (s *Server) patchUser(c *gin.Context) error {
+	id, err := parseUserID(c)
+	if err != nil {
+		return validationError(err.Error())
+	}
+
+	user, err := s.lookupUser(c, id)
+	if err != nil {
+		return notFoundAs(err, CodeUserNotFound, "User not found")
+	}
+
+	var patch UserPatch
+	if err := s.bindNormalized(c, &patch); err != nil {
+		return invalidInput(err)
+	}
+	if patch.ID != nil {
+		return validationError("id cannot be modified")
+	}
+
+	before := user
+	changed, err := patch.apply(&user)
+	if err != nil {
+		return err
+	}
+	if err := s.checkRoleChange(c, before.Role, user.Role); err != nil {
+		return err
+	}
+
+	expected, err := expectedVersion(c, patch.Version)
+	if err != nil {
+		return newAPIError(http.StatusPreconditionRequired, CodePreconditionRequired, err.Error())
+	}
+	if expected != user.Version {
+		return s.respondVersionConflict(c, id)
+	}
+
+	if changed {
+		var verificationToken string
+		err := s.userService.Update(serviceContext(c), &user, s.reverifyChangedEmail(&verificationToken))
+		if errors.Is(err, storage.ErrVersionConflict) {
+			return s.respondVersionConflict(c, id)
+		}
+		if err != nil {
+			return conflictAs(err, CodeDuplicateEmail, "email already in use")
+		}
+		logRoleChange(c, user.ID, before.Role, user.Role)
+		s.sendEmailVerification(c, user.Email, verificationToken)
+	}
+
+	c.JSON(200, user)
+	return nil
+}
+
+// Delete a user by ID
+// @Summary Delete a user
+// @Description Soft-delete a user by their ID; the row is kept but hidden from every read endpoint. Their refresh tokens are revoked. Admins only.
+// @Tags Users
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID" // ID of the user to delete
+// @Success 200 {string} string "Confirmation message in v1"
+// @Success 204 "No content in v2"
+// @Failure 400 {object} models.ErrorResponse // Bad request if the ID is invalid
+// @Failure 403 {object} models.ErrorResponse // If the caller is not an admin
+// @Failure 404 {object} models.ErrorResponse // If the user is not found
+// @Failure 500 {object} models.ErrorResponse // Internal server error
+// @Security BearerAuth
+// @Router /api/v1/users/{id} [delete]
+// @Router /api/v2/users/{id} [delete]
+func (s *Server) deleteUser(c *gin.Context) error {
+	id, err := parseUserID(c)
+	if err != nil {
+		return validationError(err.Error())
+	}
+
+	if err := s.userService.Delete(serviceContext(c), id, s.deleteAddresses(id), s.endSessions(id)); err != nil {
+		return notFoundAs(err, CodeUserNotFound, "User not found")
+	}
+
+	respondDeleted(c, "User deleted")
+	return nil
+}
+
+// deleteAddresses soft-deletes the addresses of the user with id along with it;
+// restoring the user brings them back
+func (s *Server) deleteAddresses(id int) service.Step {
+	return func(ctx context.Context, _, _ *models.User) error {
+		return storage.Session(ctx, s.db).Where("user_id = ?", id).Delete(&models.Address{}).Error
+	}
+}
+
+// endSessions revokes the refresh tokens of the user with id as it is deleted;
+// restoring the user does not bring them back
+func (s *Server) endSessions(id int) service.Step {
+	return func(ctx context.Context, _, _ *models.User) error {
+		return revokeRefreshTokensOf(storage.Session(ctx, s.db), id, s.now())
+	}
+}
+
+// Restore a soft-deleted user
+// @Summary Restore a deleted user
+// @Description Undo a soft delete. Fails with 409 if another active user has taken the email since. Admins only.
+// @Tags Users
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {object} models.User
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Security BearerAuth
+// @Router /api/v1/users/{id}/restore [post]
+// @Router /api/v2/users/{id}/restore [post]
+func (s *Server) restoreUser(c *gin.Context) error {
+	id, err := parseUserID(c)
+	if err != nil {
+		return validationError(err.Error())
+	}
+
+	user, err := s.userService.Restore(serviceContext(c), id, s.restoreAddresses(id))
+	if errors.Is(err, service.ErrNotDeleted) {
+		return newAPIError(http.StatusBadRequest, CodeUserNotDeleted, "User is not deleted")
+	}
+	if err != nil {
+		err = notFoundAs(err, CodeUserNotFound, "User not found")
+		return conflictAs(err, CodeDuplicateEmail, "email already in use")
+	}
+
+	c.JSON(200, user)
+	return nil
+}
+
+// restoreAddresses restores the addresses deleted together with the user with
+// id, but not those deleted before it
+func (s *Server) restoreAddresses(id int) service.Step {
+	return func(ctx context.Context, before, _ *models.User) error {
+		return storage.Session(ctx, s.db).Unscoped().Model(&models.Address{}).
+			Where("user_id = ? AND deleted_at >= ?", id, before.DeletedAt.Time).
+			Update("deleted_at", nil).Error
+	}
+}
+
+// Fetch a single user by email
+// @Summary Get user by email
+// @Description Retrieve a user by email address, ignoring case. Encode reserved characters such as + as %2B.
+// @Tags Users
+// @Produce json
+// @Param email path string true "User email"
+// @Success 200 {object} models.User
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /api/v1/users/by-email/{email} [get]
+// @Router /api/v2/users/by-email/{email} [get]
+func (s *Server) getUserByEmail(c *gin.Context) error {
+	// gin hands us the already decoded path segment
+	email := models.NormalizeEmail(c.Param("email"))
+	if err := validateEmail(email); err != nil {
+		return validationError("email must be a valid email")
+	}
+
+	user, err := s.users.GetByEmail(c.Request.Context(), email)
+	if err != nil {
+		return notFoundAs(err, CodeUserNotFound, "User not found")
+	}
+	c.JSON(200, user)
+	return nil
+}
+
+// Create or update a user by email
+// @Summary Upsert a user by email
+// @Description Create the user if no active user has this email, otherwise update its name. The operation is atomic. Admins only.
+// @Tags Users
+// @Accept json
+// @Produce json
+// @Param email path string true "User email"
+// @Param user body UpsertUserRequest true "User name"
+// @Success 200 {object} models.User
+// @Success 201 {object} models.User
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Security BearerAuth
+// @Router /api/v1/users/by-email/{email} [put]
+// @Router /api/v2/users/by-email/{email} [put]
+func (s *Server) upsertUserByEmail(c *gin.Context) error {
+	email := models.NormalizeEmail(c.Param("email"))
+	if err := validateEmail(email); err != nil {
+		return validationError("email must be a valid email")
+	}
+
+	var req UpsertUserRequest
+	if err := s.bindNormalized(c, &req); err != nil {
+		return invalidInput(err)
+	}
+
+	user, created, err := s.userService.Upsert(serviceContext(c), email, func(user *models.User) {
+		user.Name = req.Name
+	})
+	if err != nil {
+		return err
+	}
+
+	if created {
+		c.JSON(http.StatusCreated, user)
+		return nil
+	}
+	c.JSON(200, user)
+	return nil
+}
+
+// validateEmail applies the same rules as the email binding on User
+func validateEmail(email string) error {
+	v, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return errors.New("validator unavailable")
+	}
+	return v.Var(email, "required,email,max=100")
+}
@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"Unit-Test/internal/models"
+	"Unit-Test/internal/storage"
+	"Unit-Test/internal/testsupport"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// Run with: go test ./internal/handlers -run '^$' -bench . -benchmem
+
+// Rows seeded for the list benchmarks
+const benchUsers = 10_000
+
+// benchDBs numbers the in-memory databases so every benchmark has its own
+var benchDBs atomic.Int64
+
+// newBenchDB is a migrated in-memory SQLite database of b's own, logging nothing
+func newBenchDB(b *testing.B) *gorm.DB {
+	name := fmt.Sprintf("file:bench%d?mode=memory&cache=shared", benchDBs.Add(1))
+	conn, err := gorm.Open(storage.KeepKeyNames(sqlite.Open(name)), &gorm.Config{TranslateError: true, Logger: gormlogger.Discard})
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { storage.Close(conn) })
+	if err := storage.AutoMigrate(conn); err != nil {
+		b.Fatal(err)
+	}
+	return conn
+}
+
+// benchRepos are the user repositories every handler benchmark runs against
+var benchRepos = []struct {
+	name  string
+	users func(conn *gorm.DB) storage.UserRepository
+}{
+	{"sqlite", func(conn *gorm.DB) storage.UserRepository { return storage.NewUserRepository(conn) }},
+	{"fake", func(*gorm.DB) storage.UserRepository { return testsupport.NewFakeUserRepository() }},
+}
+
+// newBenchRouter serves the API from users, with conn for everything else,
+// the response cache off and nothing logged
+func newBenchRouter(b *testing.B, conn *gorm.DB, users storage.UserRepository) *gin.Engine {
+	saved := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	b.Cleanup(func() { slog.SetDefault(saved) })
+	return newTestEnvWith(b, Deps{DB: conn, Users: users}).router
+}
+
+// seedBenchUsers stores n users in users
+func seedBenchUsers(b *testing.B, users storage.UserRepository, n int) {
+	ctx := context.Background()
+	for i := 1; i <= n; i++ {
+		user := models.User{Name: fmt.Sprintf("User %d", i), Email: fmt.Sprintf("user-%d@example.com", i)}
+		if err := users.Create(ctx, &user); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// benchRequest sends method url with body through r, failing b unless it
+// answers status
+func benchRequest(b *testing.B, r http.Handler, method, url, body string, status int) {
+	req := httptest.NewRequest(method, url, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != status {
+		b.Fatalf("%s %s: got %d, want %d: %s", method, url, w.Code, status, w.Body.String())
+	}
+}
+
+func BenchmarkCreateUser(b *testing.B) {
+	for _, repo := range benchRepos {
+		b.Run(repo.name, func(b *testing.B) {
+			conn := newBenchDB(b)
+			r := newBenchRouter(b, conn, repo.users(conn))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				body := fmt.Sprintf(`{"name":"User %d","email":"user-%d@example.com"}`, i, i)
+				benchRequest(b, r, "POST", "/api/v1/users", body, http.StatusCreated)
+			}
+		})
+	}
+}
+
+func BenchmarkGetUsers(b *testing.B) {
+	for _, repo := range benchRepos {
+		b.Run(repo.name, func(b *testing.B) {
+			conn := newBenchDB(b)
+			users := repo.users(conn)
+			seedBenchUsers(b, users, benchUsers)
+			r := newBenchRouter(b, conn, users)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				benchRequest(b, r, "GET", "/api/v1/users", "", http.StatusOK)
+			}
+		})
+	}
+}
+
+func BenchmarkGetUsersPaginated(b *testing.B) {
+	pages := []struct{ name, url string }{
+		{"first-page", "/api/v1/users?page=1&limit=100"},
+		{"deep-page", "/api/v1/users?page=90&limit=100"},
+		{"deep-cursor", "/api/v1/users?cursor=8900&limit=100"},
+		{"envelope", "/api/v2/users?page=90&limit=100"},
+	}
+	for _, repo := range benchRepos {
+		b.Run(repo.name, func(b *testing.B) {
+			conn := newBenchDB(b)
+			users := repo.users(conn)
+			seedBenchUsers(b, users, benchUsers)
+			r := newBenchRouter(b, conn, users)
+			for _, page := range pages {
+				b.Run(page.name, func(b *testing.B) {
+					b.ReportAllocs()
+					for i := 0; i < b.N; i++ {
+						benchRequest(b, r, "GET", page.url, "", http.StatusOK)
+					}
+				})
+			}
+		})
+	}
+}
+
+func BenchmarkEncodeUserList(b *testing.B) {
+	users := make([]models.User, benchUsers)
+	for i := range users {
+		users[i] = models.User{ID: i + 1, Name: fmt.Sprintf("User %d", i+1), Email: fmt.Sprintf("user-%d@example.com", i+1), Role: models.RoleMember, Version: 1}
+	}
+	fields := []string{"id", "email"}
+
+	b.Run("json", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if err := json.NewEncoder(io.Discard).Encode(users); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("projected", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			projected := make([]map[string]interface{}, 0, len(users))
+			for _, u := range users {
+				projected = append(projected, projectUser(u, fields))
+			}
+			if err := json.NewEncoder(io.Discard).Encode(projected); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// BenchmarkUpdateUser compares the statements an update could be written
+// with: Save, which writes every column, and the Updates the repository uses,
+// which leaves out the ones an update mustn't touch, and the handler itself
+func BenchmarkUpdateUser(b *testing.B) {
+	conn := newBenchDB(b)
+	users := storage.NewUserRepository(conn)
+	seedBenchUsers(b, users, 1)
+	user, err := users.Get(context.Background(), 1)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.Run("save", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			user.Name = fmt.Sprintf("User %d", i)
+			if err := conn.Save(&user).Error; err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("updates", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			user.Name = fmt.Sprintf("User %d", i)
+			err := conn.Model(&user).Select("*").Omit("id", "created_at", "deleted_at", "preferences", "password_hash", "email_verified_at").Updates(&user).Error
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("handler", func(b *testing.B) {
+		r := newBenchRouter(b, conn, users)
+		stored, err := users.Get(context.Background(), 1)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			body := fmt.Sprintf(`{"name":"User %d","email":"user-1@example.com","version":%d}`, i, stored.Version+i)
+			benchRequest(b, r, "PUT", "/api/v1/users/1", body, http.StatusOK)
+		}
+	})
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"Unit-Test/internal/testsupport/fixtures"
+)
+
+// Run with: go test ./internal/handlers -run '^$' -fuzz FuzzCreateUser -fuzztime 10s
+// Without -fuzz, the seeds run as ordinary tests.
+
+// fuzzRequest sends method url with body through env and fails t if a
+// handler panicked, or the answer isn't JSON
+func fuzzRequest(t *testing.T, env *testEnv, method, url string, body []byte) *httptest.ResponseRecorder {
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		t.Skip("not a request a client could send")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	panics := panicsRecovered.Value()
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+
+	if panicsRecovered.Value() != panics {
+		t.Fatalf("%s %s with %q panicked", method, url, body)
+	}
+	if !json.Valid(w.Body.Bytes()) {
+		t.Fatalf("%s %s with %q: answered %d with invalid JSON %q", method, url, body, w.Code, w.Body.String())
+	}
+	return w
+}
+
+func FuzzCreateUser(f *testing.F) {
+	// The payloads of the create tests, and the shapes that caused trouble before
+	for _, body := range []string{
+		`{"name":"Dave","email":"dave@example.com"}`,
+		`{"name":"Alice","email":"ALICE@example.com"}`,
+		`{"name":"   ","email":"new@example.com"}`,
+		`{"name":`,
+		`{"name":"Carol"}`,
+		`{"name":"Carol","email":"carol@example.com","nickname":"c"}`,
+		`{"name":"Carol","email":"carol@example.com","phone":"+15551234567","role":"viewer"}`,
+		`{"name":"Zoë 𝄞","email":"zoë@exämple.com"}`,
+		`{"name":"` + strings.Repeat("a", 1000) + `","email":"long@example.com"}`,
+		`{"name":{"first":"Ada"},"email":["ada@example.com"]}`,
+		`[{"name":"Ada","email":"ada@example.com"}]`,
+		`null`,
+		``,
+	} {
+		f.Add([]byte(body))
+	}
+
+	env := newTestEnv(f)
+	fixtures.NewUser(f, env.db, fixtures.WithName("Alice"), fixtures.WithEmail("alice@example.com"))
+
+	f.Fuzz(func(t *testing.T, body []byte) {
+		w := fuzzRequest(t, env, "POST", "/api/v1/users", body)
+		switch w.Code {
+		case http.StatusCreated, http.StatusBadRequest, http.StatusConflict, http.StatusInternalServerError:
+		case http.StatusRequestEntityTooLarge:
+			if int64(len(body)) <= env.server.cfg.MaxBodyBytes {
+				t.Fatalf("%q: answered 413 below the size limit", body)
+			}
+		default:
+			t.Fatalf("%q: unexpected status %d: %s", body, w.Code, w.Body.String())
+		}
+	})
+}
+
+func FuzzIDParam(f *testing.F) {
+	for _, id := range []string{"1", "2", "99", "0", "-1", "abc", "+1", "01", "1.5", "1e3", "9223372036854775808", " 1", "١", "%00", "1;DROP TABLE users"} {
+		f.Add(id)
+	}
+
+	env := newTestEnv(f)
+	fixtures.SeedUsers(f, env.db, 2)
+
+	f.Fuzz(func(t *testing.T, id string) {
+		// Anything else isn't routed to the :id handlers
+		if id == "" || strings.Contains(id, "/") || id == "." || id == ".." {
+			t.Skip()
+		}
+		n, err := strconv.Atoi(id)
+		valid := err == nil && n > 0
+		path := "/api/v1/users/" + url.PathEscape(id)
+
+		for _, r := range []struct {
+			method string
+			body   string
+			ok     []int
+		}{
+			{"GET", "", []int{http.StatusOK, http.StatusNotFound}},
+			{"PUT", `{"name":"Fuzzed","email":"fuzzed@example.com","version":1}`, []int{http.StatusOK, http.StatusNotFound, http.StatusConflict}},
+			{"DELETE", "", []int{http.StatusOK, http.StatusNotFound}},
+		} {
+			w := fuzzRequest(t, env, r.method, path, []byte(r.body))
+			switch {
+			case !valid && w.Code != http.StatusBadRequest:
+				t.Fatalf("%s %q: got %d for an invalid id: %s", r.method, id, w.Code, w.Body.String())
+			case valid && !slices.Contains(r.ok, w.Code):
+				t.Fatalf("%s %q: unexpected status %d: %s", r.method, id, w.Code, w.Body.String())
+			}
+		}
+	})
+}
@@ -0,0 +1,2595 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"Unit-Test/internal/models"
+	"Unit-Test/internal/service"
+	"Unit-Test/internal/storage"
+	"Unit-Test/internal/testsupport"
+	"Unit-Test/internal/testsupport/fixtures"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// TestMain quiets gin for every test
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	os.Exit(m.Run())
+}
+
+// testEnv is a Server over an in-memory database of the test's own, and the
+// router serving it with every request authenticated as an admin
+type testEnv struct {
+	server *Server
+	router *gin.Engine
+	db     *gorm.DB
+}
+
+// newTestEnv builds a testEnv for t, closing its database when t finishes
+func newTestEnv(t testing.TB) *testEnv {
+	return newTestEnvWith(t, Deps{})
+}
+
+// newTestEnvWith is newTestEnv built from deps, which default to a database
+// of t's own and testConfig's configuration. Avatars go to a directory of t's own.
+func newTestEnvWith(t testing.TB, deps Deps) *testEnv {
+	if deps.DB == nil {
+		deps.DB = newTestDB(t)
+	}
+	if deps.Config.JWTSecret == "" {
+		deps.Config = testConfig()
+	}
+	deps.Config.AvatarDir = t.TempDir()
+	srv := newServer(deps)
+	r := gin.New()
+	r.Use(authenticateTestRequests)
+	srv.initializeRoutes(r)
+	return &testEnv{server: srv, router: r, db: deps.DB}
+}
+
+// testDBs numbers the test databases, so no two tests share one
+var testDBs atomic.Int64
+
+// newTestDB is a migrated in-memory SQLite database of t's own
+func newTestDB(t testing.TB) *gorm.DB {
+	name := fmt.Sprintf("file:test%d?mode=memory&cache=shared", testDBs.Add(1))
+	conn, err := gorm.Open(storage.KeepKeyNames(sqlite.Open(name)), &gorm.Config{TranslateError: true})
+	require.NoError(t, err)
+	t.Cleanup(func() { storage.Close(conn) })
+	InstrumentQueries(conn)
+	require.NoError(t, storage.AutoMigrate(conn))
+	return conn
+}
+
+// useDB points the server and its repositories at db until the returned
+// function restores them
+func (e *testEnv) useDB(db *gorm.DB) (restore func()) {
+	savedDB, savedUsers := e.server.db, e.server.users
+	e.server.db, e.server.users = db, storage.NewUserRepository(db)
+	return func() { e.server.db, e.server.users = savedDB, savedUsers }
+}
+
+// testJWTSecret signs the tokens of the tests
+const testJWTSecret = "test-secret"
+
+// testConfig is the configuration tests run with: the defaults plus a JWT secret
+func testConfig() Config {
+	cfg := defaultConfig()
+	cfg.JWTSecret = testJWTSecret
+	cfg.SwaggerEnabled = true
+	// The cheapest hashes keep the password tests fast under -race
+	cfg.BcryptCost = bcrypt.MinCost
+	return cfg
+}
+
+// authenticateTestRequests signs requests that carry no Authorization header with
+// a valid admin token, so tests not concerned with authentication can ignore it
+func authenticateTestRequests(c *gin.Context) {
+	if c.GetHeader("Authorization") == "" {
+		c.Request.Header.Set("Authorization", "Bearer "+mintToken("1", time.Now().Add(time.Hour), []byte(testJWTSecret)))
+		c.Set(authRoleKey, models.RoleAdmin)
+	}
+}
+
+func TestGetUsers(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	fixtures.SeedUsers(t, env.db, 2)
+
+	req, _ := http.NewRequest("GET", "/api/v1/users", nil)
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var users []models.User
+	_ = json.Unmarshal(w.Body.Bytes(), &users)
+	assert.Equal(t, 2, len(users))
+}
+
+func TestGetUser(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	user := fixtures.NewUser(t, env.db, fixtures.WithName("Charlie"))
+
+	req, _ := http.NewRequest("GET", fmt.Sprintf("/api/v1/users/%d", user.ID), nil)
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var fetchedUser models.User
+	_ = json.Unmarshal(w.Body.Bytes(), &fetchedUser)
+	assert.Equal(t, "Charlie", fetchedUser.Name)
+}
+
+func TestCreateUser(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	newUser := models.User{Name: "Dave", Email: "dave@example.com"}
+	jsonData, _ := json.Marshal(newUser)
+
+	req, _ := http.NewRequest("POST", "/api/v1/users", bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var createdUser models.User
+	// db.First(&createdUser, "email = ?", "dave@example.com")
+	err := json.Unmarshal(w.Body.Bytes(), &createdUser)
+	assert.NoError(t, err, "Response body should unmarshal correctly")
+	assert.Equal(t, "Dave", createdUser.Name)
+}
+
+func TestUpdateUser(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	user := fixtures.NewUser(t, env.db, fixtures.WithName("Eve"))
+
+	updatedUser := models.User{Name: "Eve Updated", Email: "eve.updated@example.com", Version: user.Version}
+	jsonData, _ := json.Marshal(updatedUser)
+
+	req, _ := http.NewRequest("PUT", fmt.Sprintf("/api/v1/users/%d", user.ID), bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var fetchedUser models.User
+	err := json.Unmarshal(w.Body.Bytes(), &fetchedUser)
+	assert.NoError(t, err, "Response body should unmarshal correctly")
+	// db.First(&fetchedUser, 1)
+	assert.Equal(t, "Eve Updated", fetchedUser.Name)
+}
+
+func TestDeleteUser(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	user := fixtures.NewUser(t, env.db)
+
+	req, _ := http.NewRequest("DELETE", fmt.Sprintf("/api/v1/users/%d", user.ID), nil)
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var fetchedUser models.User
+	err := env.db.First(&fetchedUser, user.ID).Error
+	assert.Error(t, err)
+	assert.Equal(t, gorm.ErrRecordNotFound, err)
+}
+
+func TestGetUsersCursorPagination(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	// Seed seven users so the last page is partial
+	fixtures.SeedUsers(t, env.db, 7)
+
+	seen := map[int]bool{}
+	var ids []int
+	url := "/api/v1/users?limit=3&cursor=0"
+	for page := 1; page <= 3; page++ {
+		req, _ := http.NewRequest("GET", url, nil)
+		w := httptest.NewRecorder()
+		env.router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var users []models.User
+		_ = json.Unmarshal(w.Body.Bytes(), &users)
+		for _, u := range users {
+			assert.False(t, seen[u.ID], "user %d returned twice", u.ID)
+			seen[u.ID] = true
+			ids = append(ids, u.ID)
+		}
+
+		next := w.Header().Get("X-Next-Cursor")
+		if page < 3 {
+			assert.Len(t, users, 3)
+			assert.NotEmpty(t, next)
+		} else {
+			assert.Len(t, users, 1)
+			assert.Empty(t, next)
+		}
+		url = "/api/v1/users?limit=3&cursor=" + next
+	}
+
+	assert.Equal(t, []int{1, 2, 3, 4, 5, 6, 7}, ids)
+}
+
+func TestGetUsersPageAndCursorConflict(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	req, _ := http.NewRequest("GET", "/api/v1/users?page=1&cursor=3", nil)
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	var resp models.ErrorResponse
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	assert.Contains(t, resp.Message, "mutually exclusive")
+}
+
+func seedSortUsers(env *testEnv) {
+	env.db.Create(&models.User{Name: "Bob", Email: "bob@example.com"})
+	env.db.Create(&models.User{Name: "Alice", Email: "alice@example.com"})
+	env.db.Create(&models.User{Name: "Bob", Email: "bob2@example.com"})
+}
+
+func fetchUserIDs(t *testing.T, env *testEnv, url string) []int {
+	req, _ := http.NewRequest("GET", url, nil)
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var users []models.User
+	_ = json.Unmarshal(w.Body.Bytes(), &users)
+	ids := []int{}
+	for _, u := range users {
+		ids = append(ids, u.ID)
+	}
+	return ids
+}
+
+func TestGetUsersSortAscending(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	seedSortUsers(env)
+
+	assert.Equal(t, []int{2, 1, 3}, fetchUserIDs(t, env, "/api/v1/users?sort=name"))
+}
+
+func TestGetUsersSortDescending(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	seedSortUsers(env)
+
+	assert.Equal(t, []int{3, 2, 1}, fetchUserIDs(t, env, "/api/v1/users?sort=-id"))
+}
+
+func TestGetUsersSortMultipleKeys(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	seedSortUsers(env)
+
+	assert.Equal(t, []int{2, 3, 1}, fetchUserIDs(t, env, "/api/v1/users?sort=name,-id"))
+}
+
+func TestGetUsersSortInvalidField(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	req, _ := http.NewRequest("GET", "/api/v1/users?sort=name,password", nil)
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	var resp models.ErrorResponse
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	assert.Equal(t, "invalid sort field: password", resp.Message)
+}
+
+func seedFilterUsers(env *testEnv) {
+	env.db.Create(&models.User{Name: "Alice", Email: "alice@example.com"})
+	env.db.Create(&models.User{Name: "Malik", Email: "malik@example.com"})
+	env.db.Create(&models.User{Name: "Bob", Email: "bob@example.com"})
+	env.db.Create(&models.User{Name: "ALINA", Email: "alina@example.com"})
+}
+
+func TestGetUsersFilterByName(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	seedFilterUsers(env)
+
+	assert.Equal(t, []int{1, 2, 4}, fetchUserIDs(t, env, "/api/v1/users?name=ali"))
+}
+
+func TestGetUsersFilterByEmail(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	seedFilterUsers(env)
+
+	assert.Equal(t, []int{3}, fetchUserIDs(t, env, "/api/v1/users?email=bob@example.com"))
+	// Emails are stored lowercased, and matched however they are typed
+	assert.Equal(t, []int{3}, fetchUserIDs(t, env, "/api/v1/users?email=Bob@Example.com"))
+	assert.Equal(t, int64(1), fetchCount(t, env, "/api/v1/users/count?email=BOB@example.com"))
+}
+
+func TestGetUsersFilterWithSortAndPagination(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	seedFilterUsers(env)
+
+	assert.Equal(t, []int{4, 2}, fetchUserIDs(t, env, "/api/v1/users?name=ali&sort=-id&limit=2"))
+	assert.Equal(t, []int{1}, fetchUserIDs(t, env, "/api/v1/users?name=ali&sort=-id&limit=2&page=2"))
+}
+
+func TestGetUsersFilterNoMatch(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	seedFilterUsers(env)
+
+	req, _ := http.NewRequest("GET", "/api/v1/users?name=zed", nil)
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "[]", w.Body.String())
+}
+
+func seedSearchUsers(env *testEnv) {
+	env.db.Create(&models.User{Name: "Jordan Smith", Email: "jsmith@example.com"})
+	env.db.Create(&models.User{Name: "Kim Lee", Email: "kim@smith.org"})
+	env.db.Create(&models.User{Name: "Pat Smithers", Email: "smith@example.com"})
+	env.db.Create(&models.User{Name: "Alex Doe", Email: "alex@example.com"})
+}
+
+func TestSearchUsersByName(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	seedSearchUsers(env)
+
+	assert.Equal(t, []int{4}, fetchUserIDs(t, env, "/api/v1/users/search?q=alex%20d"))
+}
+
+func TestSearchUsersByEmail(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	seedSearchUsers(env)
+
+	assert.Equal(t, []int{2}, fetchUserIDs(t, env, "/api/v1/users/search?q=smith.org"))
+}
+
+func TestNameFiltersMatchWildcardsLiterally(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	seedFilterUsers(env)
+	env.db.Create(&models.User{Name: "100% Carol", Email: "carol_c@example.com"})
+
+	assert.Equal(t, []int{5}, fetchUserIDs(t, env, "/api/v1/users?name=%25"))
+	assert.Empty(t, fetchUserIDs(t, env, "/api/v1/users?name=B_b"))
+	assert.Empty(t, fetchUserIDs(t, env, "/api/v1/users/search?q=%25%25"))
+	assert.Equal(t, []int{5}, fetchUserIDs(t, env, "/api/v1/users/search?q=l_c"))
+}
+
+func TestSearchUsersByNameAndEmail(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	seedSearchUsers(env)
+
+	// The exact email match is ranked ahead of the substring matches
+	assert.Equal(t, []int{3, 1}, fetchUserIDs(t, env, "/api/v1/users/search?q=SMITH@example.com"))
+	assert.Equal(t, []int{1, 2, 3}, fetchUserIDs(t, env, "/api/v1/users/search?q=smith"))
+	assert.Equal(t, []int{3}, fetchUserIDs(t, env, "/api/v1/users/search?q=smith&limit=2&page=2"))
+}
+
+func TestSearchUsersQueryTooShort(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	req, _ := http.NewRequest("GET", "/api/v1/users/search?q=a", nil)
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestPatchUserKeepsOmittedFields(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	env.db.Create(&models.User{Name: "Grace", Email: "grace@example.com"})
+
+	req, _ := http.NewRequest("PATCH", "/api/v1/users/1", bytes.NewBufferString(`{"name":"Grace Hopper","version":1}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var patchedUser models.User
+	_ = json.Unmarshal(w.Body.Bytes(), &patchedUser)
+	assert.Equal(t, "Grace Hopper", patchedUser.Name)
+	assert.Equal(t, "grace@example.com", patchedUser.Email)
+
+	var storedUser models.User
+	env.db.First(&storedUser, 1)
+	assert.Equal(t, "Grace Hopper", storedUser.Name)
+	assert.Equal(t, "grace@example.com", storedUser.Email)
+}
+
+func TestPatchUserRejectsEmptyEmail(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	env.db.Create(&models.User{Name: "Heidi", Email: "heidi@example.com"})
+
+	req, _ := http.NewRequest("PATCH", "/api/v1/users/1", bytes.NewBufferString(`{"email":""}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	var storedUser models.User
+	env.db.First(&storedUser, 1)
+	assert.Equal(t, "heidi@example.com", storedUser.Email)
+}
+
+func TestPatchUserRejectsID(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	env.db.Create(&models.User{Name: "Ivan", Email: "ivan@example.com"})
+
+	req, _ := http.NewRequest("PATCH", "/api/v1/users/1", bytes.NewBufferString(`{"id":2}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestPatchUserNotFound(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	req, _ := http.NewRequest("PATCH", "/api/v1/users/42", bytes.NewBufferString(`{"name":"Nobody"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func postBulk(env *testEnv, url, body string) (*httptest.ResponseRecorder, BulkCreateResponse) {
+	req, _ := http.NewRequest("POST", url, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+
+	var resp BulkCreateResponse
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	return w, resp
+}
+
+func TestCreateUsersBulk(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	w, resp := postBulk(env, "/api/v1/users/bulk", `[
+		{"name":"Judy","email":"judy@example.com"},
+		{"name":"Ken","email":"ken@example.com"},
+		{"name":"Liam","email":"liam@example.com"}
+	]`)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, []BulkCreated{{Index: 0, ID: 1}, {Index: 1, ID: 2}, {Index: 2, ID: 3}}, resp.Created)
+	assert.Empty(t, resp.Errors)
+
+	var count int64
+	env.db.Model(&models.User{}).Count(&count)
+	assert.Equal(t, int64(3), count)
+}
+
+func TestCreateUsersBulkDuplicateEmail(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	env.db.Create(&models.User{Name: "Judy", Email: "judy@example.com"})
+
+	w, resp := postBulk(env, "/api/v1/users/bulk", `[
+		{"name":"Ken","email":"ken@example.com"},
+		{"name":"Judy Again","email":"judy@example.com"},
+		{"name":"Liam","email":"liam@example.com"}
+	]`)
+
+	assert.Equal(t, http.StatusMultiStatus, w.Code)
+	assert.Equal(t, []BulkCreated{{Index: 0, ID: 2}, {Index: 2, ID: 3}}, resp.Created)
+	assert.Equal(t, []BulkError{{Index: 1, Message: "email already in use"}}, resp.Errors)
+}
+
+func TestCreateUsersBulkAtomicRollback(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	w, resp := postBulk(env, "/api/v1/users/bulk?atomic=true", `[
+		{"name":"Ken","email":"ken@example.com"},
+		{"name":"","email":"nobody@example.com"},
+		{"name":"Ken Twin","email":"ken@example.com"}
+	]`)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Empty(t, resp.Created)
+	assert.Equal(t, []BulkError{
+		{Index: 1, Message: "name and email are required"},
+		{Index: 2, Message: "email already in use"},
+	}, resp.Errors)
+
+	var count int64
+	env.db.Model(&models.User{}).Count(&count)
+	assert.Equal(t, int64(0), count)
+}
+
+func TestGetUsersByIDs(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	seedFilterUsers(env)
+
+	assert.Equal(t, []int{1, 3, 4}, fetchUserIDs(t, env, "/api/v1/users?ids=4,1,3,1,99"))
+}
+
+func TestGetUsersByIDsNoValidIDs(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	seedFilterUsers(env)
+
+	req, _ := http.NewRequest("GET", "/api/v1/users?ids=,", nil)
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "[]", w.Body.String())
+}
+
+func TestGetUsersByIDsInvalidToken(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	req, _ := http.NewRequest("GET", "/api/v1/users?ids=1,two,3", nil)
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	var resp models.ErrorResponse
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	assert.Equal(t, "invalid id: two", resp.Message)
+}
+
+func fetchCount(t *testing.T, env *testEnv, url string) int64 {
+	req, _ := http.NewRequest("GET", url, nil)
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var resp CountResponse
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	return resp.Count
+}
+
+func TestCountUsers(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	assert.Equal(t, int64(0), fetchCount(t, env, "/api/v1/users/count"))
+
+	seedFilterUsers(env)
+	assert.Equal(t, int64(4), fetchCount(t, env, "/api/v1/users/count"))
+}
+
+func TestCountUsersFiltered(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	seedFilterUsers(env)
+
+	assert.Equal(t, int64(3), fetchCount(t, env, "/api/v1/users/count?name=ali"))
+	assert.Equal(t, int64(1), fetchCount(t, env, "/api/v1/users/count?email=bob@example.com"))
+	assert.Equal(t, int64(0), fetchCount(t, env, "/api/v1/users/count?name=ali&email=bob@example.com"))
+}
+
+func TestHeadUser(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	env.db.Create(&models.User{Name: "Mallory", Email: "mallory@example.com"})
+
+	req, _ := http.NewRequest("HEAD", "/api/v1/users/1", nil)
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "0", w.Header().Get("Content-Length"))
+	assert.Empty(t, w.Body.Bytes())
+}
+
+func TestHeadUserNotFound(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	req, _ := http.NewRequest("HEAD", "/api/v1/users/1", nil)
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "0", w.Header().Get("Content-Length"))
+	assert.Empty(t, w.Body.Bytes())
+}
+
+func TestGetUsersSparseFields(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	seedFilterUsers(env)
+
+	req, _ := http.NewRequest("GET", "/api/v1/users?fields=name&ids=1", nil)
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var users []map[string]interface{}
+	_ = json.Unmarshal(w.Body.Bytes(), &users)
+	assert.Equal(t, []map[string]interface{}{{"id": float64(1), "name": "Alice"}}, users)
+}
+
+func TestGetUserSparseFields(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	seedFilterUsers(env)
+
+	req, _ := http.NewRequest("GET", "/api/v1/users/3?fields=email", nil)
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var user map[string]interface{}
+	_ = json.Unmarshal(w.Body.Bytes(), &user)
+	assert.Equal(t, map[string]interface{}{"id": float64(3), "email": "bob@example.com"}, user)
+}
+
+func TestGetUsersSparseFieldsUnknown(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	for _, url := range []string{"/api/v1/users?fields=name,password", "/api/v1/users/1?fields=password"} {
+		req, _ := http.NewRequest("GET", url, nil)
+		w := httptest.NewRecorder()
+		env.router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		var resp models.ErrorResponse
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+		assert.Equal(t, "invalid field: password", resp.Message)
+	}
+}
+
+func TestExportUsersCSV(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	env.db.Create(&models.User{Name: "Doe, Jane", Email: "jane@example.com"})
+	env.db.Create(&models.User{Name: "Oscar \"Ozzy\" Lee", Email: "oscar@example.com"})
+	env.db.Create(&models.User{Name: "Peggy", Email: "peggy@example.com"})
+
+	req, _ := http.NewRequest("GET", "/api/v1/users/export", nil)
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/csv", w.Header().Get("Content-Type"))
+	assert.Equal(t, `attachment; filename="users.csv"`, w.Header().Get("Content-Disposition"))
+	assert.Contains(t, w.Body.String(), `"Doe, Jane"`)
+
+	records, err := csv.NewReader(w.Body).ReadAll()
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{
+		{"id", "name", "email"},
+		{"1", "Doe, Jane", "jane@example.com"},
+		{"2", `Oscar "Ozzy" Lee`, "oscar@example.com"},
+		{"3", "Peggy", "peggy@example.com"},
+	}, records)
+}
+
+func TestExportUsersCSVFiltered(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	seedFilterUsers(env)
+
+	req, _ := http.NewRequest("GET", "/api/v1/users/export?name=ali", nil)
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	records, err := csv.NewReader(w.Body).ReadAll()
+	assert.NoError(t, err)
+	assert.Len(t, records, 4)
+	assert.Equal(t, []string{"id", "name", "email"}, records[0])
+}
+
+// flushRecorder is a ResponseRecorder noting how many lines of body it had
+// at each flush
+type flushRecorder struct {
+	*httptest.ResponseRecorder
+	flushedLines []int
+	onFlush      func()
+}
+
+func (r *flushRecorder) Flush() {
+	r.flushedLines = append(r.flushedLines, bytes.Count(r.Body.Bytes(), []byte("\n")))
+	if r.onFlush != nil {
+		r.onFlush()
+	}
+	r.ResponseRecorder.Flush()
+}
+
+func TestStreamUsersNDJSON(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	total := 2*exportBatchSize + 10
+	fixtures.SeedUsers(t, env.db, total)
+
+	req, _ := http.NewRequest("GET", "/api/v1/users/stream", nil)
+	w := &flushRecorder{ResponseRecorder: httptest.NewRecorder()}
+	env.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+	// One flush per batch, so no more than a batch is ever held back
+	assert.Equal(t, []int{exportBatchSize, 2 * exportBatchSize, total}, w.flushedLines)
+
+	dec := json.NewDecoder(w.Body)
+	for i := 1; i <= total; i++ {
+		var user models.User
+		require.NoError(t, dec.Decode(&user), "line %d", i)
+		assert.Equal(t, i, user.ID)
+	}
+	assert.False(t, dec.More())
+}
+
+func TestStreamUsersFiltered(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	seedFilterUsers(env)
+
+	req, _ := http.NewRequest("GET", "/api/v1/users/stream?name=ali", nil)
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var names []string
+	for _, line := range strings.Split(strings.TrimSuffix(w.Body.String(), "\n"), "\n") {
+		var user models.User
+		require.NoError(t, json.Unmarshal([]byte(line), &user))
+		names = append(names, user.Name)
+	}
+	assert.Equal(t, []string{"Alice", "Malik", "ALINA"}, names)
+}
+
+func TestStreamUsersStopsWhenClientLeaves(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	fixtures.SeedUsers(t, env.db, 3*exportBatchSize)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", "/api/v1/users/stream", nil)
+	// The client goes away once it has the first batch
+	w := &flushRecorder{ResponseRecorder: httptest.NewRecorder(), onFlush: cancel}
+	env.router.ServeHTTP(w, req)
+
+	assert.Equal(t, []int{exportBatchSize}, w.flushedLines)
+	assert.Equal(t, exportBatchSize, strings.Count(w.Body.String(), "\n"))
+}
+
+func TestStreamUsersOverHTTP(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	fixtures.SeedUsers(t, env.db, exportBatchSize+1)
+	srv := httptest.NewServer(env.router)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/api/v1/users/stream")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	// Read one user at a time, as a client would
+	dec := json.NewDecoder(resp.Body)
+	count := 0
+	for dec.More() {
+		var user models.User
+		require.NoError(t, dec.Decode(&user))
+		count++
+	}
+	assert.Equal(t, exportBatchSize+1, count)
+}
+
+// queryLog is a GORM logger keeping the SQL of every statement
+type queryLog struct {
+	gormlogger.Interface
+	mu         sync.Mutex
+	statements []string
+}
+
+func (l *queryLog) Trace(_ context.Context, _ time.Time, fc func() (string, int64), _ error) {
+	sql, _ := fc()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.statements = append(l.statements, sql)
+}
+
+// selects returns the logged statements reading from table
+func (l *queryLog) selects(table string) []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var found []string
+	for _, sql := range l.statements {
+		if strings.HasPrefix(sql, "SELECT") && strings.Contains(sql, "FROM `"+table+"`") {
+			found = append(found, sql)
+		}
+	}
+	return found
+}
+
+// logQueries logs the statements env's database runs until t finishes
+func logQueries(t *testing.T, env *testEnv) *queryLog {
+	saved := env.db.Logger
+	log := &queryLog{Interface: gormlogger.Discard}
+	env.db.Logger = log
+	t.Cleanup(func() { env.db.Logger = saved })
+	return log
+}
+
+func TestUserReadsSelectColumns(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	seedFilterUsers(env)
+	env.db.Model(&models.User{}).Where("id = 1").Update("password_hash", "secret-hash")
+
+	for _, tt := range []struct {
+		url     string
+		columns string
+	}{
+		{"/api/v1/users", "SELECT `id`,`name`,`email`,`created_at`,`updated_at`,`deleted_at`,`version`,`role`,`phone`,`email_verified_at` FROM"},
+		{"/api/v1/users?fields=email", "SELECT `id`,`email` FROM"},
+		{"/api/v1/users/1?fields=name", "SELECT `id`,`name` FROM"},
+		{"/api/v1/users/export", "SELECT `id`,`name`,`email` FROM"},
+		{"/api/v1/users/stream", "SELECT `id`,`name`,`email`,`created_at`,`updated_at`,`deleted_at`,`version`,`role`,`phone`,`email_verified_at` FROM"},
+		{"/api/v1/users/search?q=alice", "SELECT id, name, email, created_at, updated_at, deleted_at, version, role, phone, email_verified_at, CASE"},
+	} {
+		t.Run(tt.url, func(t *testing.T) {
+			log := logQueries(t, env)
+			req, _ := http.NewRequest("GET", tt.url, nil)
+			w := httptest.NewRecorder()
+			env.router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.NotContains(t, w.Body.String(), "secret-hash")
+			selects := log.selects("users")
+			if assert.NotEmpty(t, selects) {
+				assert.Contains(t, selects[len(selects)-1], tt.columns)
+			}
+			for _, sql := range selects {
+				assert.NotContains(t, sql, "*")
+				assert.NotContains(t, sql, "password_hash")
+			}
+		})
+	}
+
+	// The hash isn't a field that can be asked for
+	req, _ := http.NewRequest("GET", "/api/v1/users?fields=password_hash", nil)
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func postCSV(env *testEnv, body string) (*httptest.ResponseRecorder, ImportResponse) {
+	req, _ := http.NewRequest("POST", "/api/v1/users/import", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "text/csv")
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+
+	var resp ImportResponse
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	return w, resp
+}
+
+func TestImportUsersCSV(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	w, resp := postCSV(env, "name,email\nQuinn,quinn@example.com\n\"Roe, Rita\",rita@example.com\n")
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 2, resp.Imported)
+	assert.Empty(t, resp.Skipped)
+	assert.Empty(t, resp.Failed)
+
+	var user models.User
+	env.db.First(&user, "email = ?", "rita@example.com")
+	assert.Equal(t, "Roe, Rita", user.Name)
+}
+
+func TestImportUsersCSVMultipart(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	part, _ := mw.CreateFormFile("file", "users.csv")
+	_, _ = part.Write([]byte("name,email\nQuinn,quinn@example.com\n"))
+	_ = mw.Close()
+
+	req, _ := http.NewRequest("POST", "/api/v1/users/import", &buf)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var resp ImportResponse
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	assert.Equal(t, 1, resp.Imported)
+}
+
+func TestImportUsersCSVDuplicate(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	env.db.Create(&models.User{Name: "Quinn", Email: "quinn@example.com"})
+
+	w, resp := postCSV(env, "name,email\nQuinn Again,quinn@example.com\nSybil,sybil@example.com\n,nameless@example.com\n")
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 1, resp.Imported)
+	assert.Equal(t, []ImportRowError{{Line: 2, Message: "email already in use"}}, resp.Skipped)
+	assert.Equal(t, []ImportRowError{{Line: 4, Message: "name and email are required"}}, resp.Failed)
+}
+
+func TestImportUsersCSVBrokenRow(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	w, _ := postCSV(env, "name,email\nQuinn,quinn@example.com\nSybil,sybil@example.com,extra\n")
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	var count int64
+	env.db.Model(&models.User{}).Count(&count)
+	assert.Equal(t, int64(0), count)
+}
+
+func TestImportUsersCSVMissingHeader(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	w, _ := postCSV(env, "Quinn,quinn@example.com\n")
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestGetUserXML(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	env.db.Create(&models.User{Name: "Trent", Email: "trent@example.com"})
+
+	req, _ := http.NewRequest("GET", "/api/v1/users/1", nil)
+	req.Header.Set("Accept", "application/xml")
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "application/xml")
+
+	var user models.User
+	err := xml.Unmarshal(w.Body.Bytes(), &user)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, user.ID)
+	assert.Equal(t, "Trent", user.Name)
+	assert.Equal(t, "trent@example.com", user.Email)
+}
+
+func TestGetUsersXML(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	seedFilterUsers(env)
+
+	req, _ := http.NewRequest("GET", "/api/v1/users?name=ali", nil)
+	req.Header.Set("Accept", "application/xml")
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var list models.UserList
+	err := xml.Unmarshal(w.Body.Bytes(), &list)
+	assert.NoError(t, err)
+	assert.Len(t, list.Users, 3)
+	assert.Equal(t, "Alice", list.Users[0].Name)
+}
+
+func TestGetUserXMLNotFound(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	req, _ := http.NewRequest("GET", "/api/v1/users/1", nil)
+	req.Header.Set("Accept", "application/xml")
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	var resp models.ErrorResponse
+	err := xml.Unmarshal(w.Body.Bytes(), &resp)
+	assert.NoError(t, err)
+	assert.Equal(t, "User not found", resp.Message)
+}
+
+func TestGetUserJSONUnchanged(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	env.db.Create(&models.User{Name: "Trent", Email: "trent@example.com"})
+
+	req, _ := http.NewRequest("GET", "/api/v1/users/1", nil)
+	req.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var user map[string]interface{}
+	_ = json.Unmarshal(w.Body.Bytes(), &user)
+	assert.Equal(t, float64(1), user["id"])
+	assert.Equal(t, "Trent", user["name"])
+	assert.Equal(t, "trent@example.com", user["email"])
+}
+
+func TestGetUserNotAcceptable(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	for _, url := range []string{"/api/v1/users", "/api/v1/users/1"} {
+		req, _ := http.NewRequest("GET", url, nil)
+		req.Header.Set("Accept", "text/html")
+		w := httptest.NewRecorder()
+		env.router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotAcceptable, w.Code)
+
+		var resp models.ErrorResponse
+		err := json.Unmarshal(w.Body.Bytes(), &resp)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, resp.Message)
+	}
+}
+
+func TestGetUserETag(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	env.db.Create(&models.User{Name: "Uma", Email: "uma@example.com"})
+
+	req, _ := http.NewRequest("GET", "/api/v1/users/1", nil)
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	etag := w.Header().Get("ETag")
+	assert.True(t, strings.HasPrefix(etag, `W/"`))
+
+	// A matching If-None-Match returns 304 without a body
+	req, _ = http.NewRequest("GET", "/api/v1/users/1", nil)
+	req.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Empty(t, w.Body.Bytes())
+	assert.Equal(t, etag, w.Header().Get("ETag"))
+
+	// After an update the old ETag no longer matches
+	req, _ = http.NewRequest("PATCH", "/api/v1/users/1", bytes.NewBufferString(`{"name":"Uma Updated","version":1}`))
+	req.Header.Set("Content-Type", "application/json")
+	env.router.ServeHTTP(httptest.NewRecorder(), req)
+
+	req, _ = http.NewRequest("GET", "/api/v1/users/1", nil)
+	req.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotEqual(t, etag, w.Header().Get("ETag"))
+}
+
+func TestCreateUserIgnoresClientID(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	for i, body := range []string{
+		`{"id":500,"name":"Alice","email":"alice@example.com"}`,
+		`{"id":1,"name":"Bob","email":"bob@example.com"}`,
+	} {
+		w := send(env, "POST", "/api/v1/users", body)
+		assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		var user models.User
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &user))
+		assert.Equal(t, i+1, user.ID)
+	}
+}
+
+func TestCreateUserDuplicateEmail(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	for _, expected := range []int{http.StatusCreated, http.StatusConflict} {
+		req, _ := http.NewRequest("POST", "/api/v1/users", bytes.NewBufferString(`{"name":"Victor","email":"victor@example.com"}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		env.router.ServeHTTP(w, req)
+
+		assert.Equal(t, expected, w.Code)
+		if expected == http.StatusConflict {
+			var resp models.ErrorResponse
+			_ = json.Unmarshal(w.Body.Bytes(), &resp)
+			assert.Equal(t, "email already in use", resp.Message)
+		}
+	}
+}
+
+func TestUpdateUserDuplicateEmail(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	env.db.Create(&models.User{Name: "Victor", Email: "victor@example.com"})
+	env.db.Create(&models.User{Name: "Wendy", Email: "wendy@example.com"})
+
+	req, _ := http.NewRequest("PUT", "/api/v1/users/2", bytes.NewBufferString(`{"name":"Wendy","email":"victor@example.com","version":1}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	var storedUser models.User
+	env.db.First(&storedUser, 2)
+	assert.Equal(t, "wendy@example.com", storedUser.Email)
+}
+
+func TestInvalidUserIDParam(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	for _, method := range []string{"GET", "PUT", "PATCH", "DELETE"} {
+		for _, id := range []string{"abc", "-1", "0"} {
+			req, _ := http.NewRequest(method, "/api/v1/users/"+id, bytes.NewBufferString(`{"name":"X","email":"x@example.com"}`))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			env.router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code, "%s %s", method, id)
+
+			var resp models.ErrorResponse
+			_ = json.Unmarshal(w.Body.Bytes(), &resp)
+			assert.Equal(t, "id must be a positive integer", resp.Message)
+		}
+	}
+}
+
+func TestUserEmailValidation(t *testing.T) {
+	t.Parallel()
+	longEmail := strings.Repeat("a", 89) + "@example.com"
+	cases := []struct {
+		body    string
+		status  int
+		message string
+	}{
+		{`{"name":"Xena"}`, http.StatusBadRequest, "is required"},
+		{`{"name":"Xena","email":"not-an-email"}`, http.StatusBadRequest, "must be a valid email"},
+		{`{"name":"Xena","email":"` + longEmail + `"}`, http.StatusBadRequest, "must be at most 100 characters"},
+		{`{"name":"Xena","email":"xena@example.com"}`, http.StatusCreated, ""},
+	}
+
+	for _, tc := range cases {
+		env := newTestEnv(t)
+		req, _ := http.NewRequest("POST", "/api/v1/users", bytes.NewBufferString(tc.body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		env.router.ServeHTTP(w, req)
+
+		assert.Equal(t, tc.status, w.Code, tc.body)
+		if tc.message != "" {
+			var resp models.ErrorResponse
+			_ = json.Unmarshal(w.Body.Bytes(), &resp)
+			assert.Equal(t, []models.FieldError{{Field: "email", Error: tc.message}}, resp.Errors)
+		}
+	}
+}
+
+func TestUpdateUserEmailValidation(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	env.db.Create(&models.User{Name: "Yusuf", Email: "yusuf@example.com"})
+
+	for _, body := range []string{`{"name":"Yusuf","email":"not-an-email"}`, `{"name":"Yusuf","email":""}`} {
+		req, _ := http.NewRequest("PUT", "/api/v1/users/1", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		env.router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+	}
+
+	req, _ := http.NewRequest("PATCH", "/api/v1/users/1", bytes.NewBufferString(`{"email":"still-not-an-email"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	var storedUser models.User
+	env.db.First(&storedUser, 1)
+	assert.Equal(t, "yusuf@example.com", storedUser.Email)
+}
+
+func TestCreateUserFieldErrors(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	req, _ := http.NewRequest("POST", "/api/v1/users", bytes.NewBufferString(`{"name":"","email":"not-an-email"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.JSONEq(t, withRequestID(`{
+		"code": "VALIDATION_ERROR",
+		"message": "validation failed",
+		"errors": [
+			{"field": "name", "error": "is required"},
+			{"field": "email", "error": "must be a valid email"}
+		]
+	}`, w), w.Body.String())
+}
+
+func TestCreateUserMalformedJSON(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	req, _ := http.NewRequest("POST", "/api/v1/users", bytes.NewBufferString(`{"name":`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.JSONEq(t, withRequestID(`{"code":"VALIDATION_ERROR","message":"Invalid input"}`, w), w.Body.String())
+}
+
+func TestSoftDeletedUserIsHidden(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	env.db.Create(&models.User{Name: "Zara", Email: "zara@example.com"})
+	env.db.Create(&models.User{Name: "Yann", Email: "yann@example.com"})
+
+	req, _ := http.NewRequest("DELETE", "/api/v1/users/1", nil)
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Gone from list and get
+	assert.Equal(t, []int{2}, fetchUserIDs(t, env, "/api/v1/users"))
+
+	req, _ = http.NewRequest("GET", "/api/v1/users/1", nil)
+	w = httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// Still stored, with DeletedAt set
+	var deletedUser models.User
+	err := env.db.Unscoped().First(&deletedUser, 1).Error
+	assert.NoError(t, err)
+	assert.Equal(t, "Zara", deletedUser.Name)
+	assert.True(t, deletedUser.DeletedAt.Valid)
+}
+
+func TestDeleteUserAlreadyDeleted(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	env.db.Create(&models.User{Name: "Zara", Email: "zara@example.com"})
+
+	for _, expected := range []int{http.StatusOK, http.StatusNotFound} {
+		req, _ := http.NewRequest("DELETE", "/api/v1/users/1", nil)
+		w := httptest.NewRecorder()
+		env.router.ServeHTTP(w, req)
+
+		assert.Equal(t, expected, w.Code)
+	}
+}
+
+func TestRestoreUser(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	env.db.Create(&models.User{Name: "Zara", Email: "zara@example.com"})
+
+	req, _ := http.NewRequest("DELETE", "/api/v1/users/1", nil)
+	env.router.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Equal(t, []int{}, fetchUserIDs(t, env, "/api/v1/users"))
+
+	req, _ = http.NewRequest("POST", "/api/v1/users/1/restore", nil)
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var restoredUser models.User
+	_ = json.Unmarshal(w.Body.Bytes(), &restoredUser)
+	assert.Equal(t, "Zara", restoredUser.Name)
+	assert.Equal(t, []int{1}, fetchUserIDs(t, env, "/api/v1/users"))
+}
+
+func TestRestoreUserNotDeleted(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	env.db.Create(&models.User{Name: "Zara", Email: "zara@example.com"})
+
+	req, _ := http.NewRequest("POST", "/api/v1/users/1/restore", nil)
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestRestoreUserEmailReused(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	env.db.Create(&models.User{Name: "Zara", Email: "zara@example.com"})
+
+	req, _ := http.NewRequest("DELETE", "/api/v1/users/1", nil)
+	env.router.ServeHTTP(httptest.NewRecorder(), req)
+
+	// The email is free again once its owner is deleted
+	req, _ = http.NewRequest("POST", "/api/v1/users", bytes.NewBufferString(`{"name":"New Zara","email":"zara@example.com"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	req, _ = http.NewRequest("POST", "/api/v1/users/1/restore", nil)
+	w = httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	var deletedUser models.User
+	env.db.Unscoped().First(&deletedUser, 1)
+	assert.True(t, deletedUser.DeletedAt.Valid)
+}
+
+func TestGetUsersIncludeDeleted(t *testing.T) {
+	t.Parallel()
+	cfg := testConfig()
+	cfg.AllowIncludeDeleted = true
+	env := newTestEnvWith(t, Deps{Config: cfg})
+
+	router := newAuthTestRouter(env)
+
+	seedRoles(env)
+	env.db.Delete(&models.User{}, 3)
+
+	// Without the flag deleted users stay hidden
+	w := sendWithAuth(router, "GET", "/api/v1/users", "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var users []map[string]interface{}
+	_ = json.Unmarshal(w.Body.Bytes(), &users)
+	assert.Len(t, users, 2)
+	assert.NotContains(t, users[0], "deleted_at")
+
+	// With the flag admins see them, with deleted_at null for active users
+	w = sendWithAuth(router, "GET", "/api/v1/users?include_deleted=true", "", bearerFor("1"))
+	assert.Equal(t, http.StatusOK, w.Code)
+	users = nil
+	_ = json.Unmarshal(w.Body.Bytes(), &users)
+	assert.Len(t, users, 3)
+	assert.Nil(t, users[0]["deleted_at"])
+	assert.Contains(t, users[0], "deleted_at")
+	assert.NotNil(t, users[2]["deleted_at"])
+}
+
+func TestGetUsersIncludeDeletedRequiresAdmin(t *testing.T) {
+	t.Parallel()
+	cfg := testConfig()
+	cfg.AllowIncludeDeleted = true
+	env := newTestEnvWith(t, Deps{Config: cfg})
+
+	router := newAuthTestRouter(env)
+	seedRoles(env)
+
+	// Even with reads open, asking for deleted users takes credentials
+	w := sendWithAuth(router, "GET", "/api/v1/users?include_deleted=true", "", "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = sendWithAuth(router, "GET", "/api/v1/users?include_deleted=true", "", bearerFor("2"))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestGetUsersIncludeDeletedIgnoredWhenDisabled(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	env.db.Create(&models.User{Name: "Zara", Email: "zara@example.com"})
+	env.db.Delete(&models.User{}, 1)
+
+	assert.Equal(t, []int{}, fetchUserIDs(t, env, "/api/v1/users?include_deleted=true"))
+}
+
+func TestUserTimestamps(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	req, _ := http.NewRequest("POST", "/api/v1/users", bytes.NewBufferString(`{"name":"Abe","email":"abe@example.com","created_at":"2000-01-01T00:00:00Z"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var created map[string]string
+	_ = json.Unmarshal(w.Body.Bytes(), &created)
+	createdAt, err := time.Parse(time.RFC3339, created["created_at"])
+	assert.NoError(t, err)
+	assert.False(t, createdAt.IsZero())
+	assert.NotEqual(t, 2000, createdAt.Year(), "client-supplied created_at must be ignored")
+
+	time.Sleep(10 * time.Millisecond)
+
+	req, _ = http.NewRequest("PUT", "/api/v1/users/1", bytes.NewBufferString(`{"name":"Abe Updated","email":"abe@example.com","created_at":"2000-01-01T00:00:00Z","version":1}`))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var storedUser models.User
+	env.db.First(&storedUser, 1)
+	assert.True(t, storedUser.CreatedAt.Equal(createdAt))
+	assert.True(t, storedUser.UpdatedAt.After(createdAt))
+}
+
+func TestPatchUserBumpsUpdatedAt(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	user := models.User{Name: "Abe", Email: "abe@example.com"}
+	env.db.Create(&user)
+
+	time.Sleep(10 * time.Millisecond)
+
+	req, _ := http.NewRequest("PATCH", "/api/v1/users/1", bytes.NewBufferString(`{"name":"Abe Patched","version":1}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+
+	var patchedUser models.User
+	_ = json.Unmarshal(w.Body.Bytes(), &patchedUser)
+	assert.True(t, patchedUser.CreatedAt.Equal(user.CreatedAt))
+	assert.True(t, patchedUser.UpdatedAt.After(user.UpdatedAt))
+}
+
+func TestUpdateUserVersionConflict(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	env.db.Create(&models.User{Name: "Bea", Email: "bea@example.com"})
+
+	// Both admins load version 1; A saves first
+	req, _ := http.NewRequest("PUT", "/api/v1/users/1", bytes.NewBufferString(`{"name":"Bea A","email":"bea@example.com","version":1}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var updated models.User
+	_ = json.Unmarshal(w.Body.Bytes(), &updated)
+	assert.Equal(t, 2, updated.Version)
+
+	// B's update is based on the stale version and must not overwrite A's
+	req, _ = http.NewRequest("PUT", "/api/v1/users/1", bytes.NewBufferString(`{"name":"Bea B","email":"bea@example.com","version":1}`))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	var conflict VersionConflictResponse
+	_ = json.Unmarshal(w.Body.Bytes(), &conflict)
+	assert.Equal(t, "Bea A", conflict.Current.Name)
+	assert.Equal(t, 2, conflict.Current.Version)
+
+	var storedUser models.User
+	env.db.First(&storedUser, 1)
+	assert.Equal(t, "Bea A", storedUser.Name)
+}
+
+func TestPatchUserVersionFromIfMatch(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	env.db.Create(&models.User{Name: "Bea", Email: "bea@example.com"})
+
+	for _, tc := range []struct {
+		ifMatch string
+		status  int
+	}{
+		{`"1"`, http.StatusOK},
+		{`"1"`, http.StatusConflict},
+		{"", http.StatusPreconditionRequired},
+	} {
+		req, _ := http.NewRequest("PATCH", "/api/v1/users/1", bytes.NewBufferString(`{"name":"Bea Patched"}`))
+		req.Header.Set("Content-Type", "application/json")
+		if tc.ifMatch != "" {
+			req.Header.Set("If-Match", tc.ifMatch)
+		}
+		w := httptest.NewRecorder()
+		env.router.ServeHTTP(w, req)
+
+		assert.Equal(t, tc.status, w.Code)
+	}
+}
+
+func TestCreateUserStartsAtVersionOne(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	req, _ := http.NewRequest("POST", "/api/v1/users", bytes.NewBufferString(`{"name":"Bea","email":"bea@example.com","version":7}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+
+	var created models.User
+	_ = json.Unmarshal(w.Body.Bytes(), &created)
+	assert.Equal(t, 1, created.Version)
+}
+
+func TestUpsertUserByEmail(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	for i, tc := range []struct {
+		name   string
+		status int
+	}{
+		{"Cleo", http.StatusCreated},
+		{"Cleo Updated", http.StatusOK},
+	} {
+		req, _ := http.NewRequest("PUT", "/api/v1/users/by-email/cleo@example.com", bytes.NewBufferString(`{"name":"`+tc.name+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		env.router.ServeHTTP(w, req)
+
+		assert.Equal(t, tc.status, w.Code)
+
+		var user models.User
+		_ = json.Unmarshal(w.Body.Bytes(), &user)
+		assert.Equal(t, 1, user.ID)
+		assert.Equal(t, tc.name, user.Name)
+		assert.Equal(t, i+1, user.Version)
+	}
+
+	var users []models.User
+	env.db.Find(&users)
+	assert.Len(t, users, 1)
+	assert.Equal(t, "Cleo Updated", users[0].Name)
+	assert.Equal(t, "cleo@example.com", users[0].Email)
+}
+
+// 201 or 200 tells whether the upsert inserted the user, whatever its version
+func TestUpsertUserByEmailStatus(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	env.db.Create(&models.User{Name: "Gone", Email: "gone@example.com"})
+	env.db.Delete(&models.User{}, 1)
+	env.db.Create(&models.User{Name: "Vera", Email: "vera@example.com"})
+	env.db.Model(&models.User{}).Where("id = ?", 2).Update("version", 5)
+
+	w := send(env, "PUT", "/api/v1/users/by-email/gone@example.com", `{"name":"Back"}`)
+	assert.Equal(t, http.StatusCreated, w.Code, "a deleted user's email is free")
+	var user models.User
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &user))
+	assert.Equal(t, 3, user.ID)
+
+	w = send(env, "PUT", "/api/v1/users/by-email/VERA@example.com", `{"name":"Vera Updated"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &user))
+	assert.Equal(t, 2, user.ID)
+	assert.Equal(t, 6, user.Version)
+}
+
+func TestUpsertUserByEmailInvalid(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	req, _ := http.NewRequest("PUT", "/api/v1/users/by-email/not-an-email", bytes.NewBufferString(`{"name":"Cleo"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestGetUserByEmail(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	env.db.Create(&models.User{Name: "Alice", Email: "alice@example.com"})
+	env.db.Create(&models.User{Name: "Dana", Email: "dana+news@example.com"})
+
+	for url, expected := range map[string]string{
+		"/api/v1/users/by-email/Alice@Example.com":         "Alice",
+		"/api/v1/users/by-email/dana%2Bnews@example.com":   "Dana",
+		"/api/v1/users/by-email/DANA%2BNEWS%40example.com": "Dana",
+	} {
+		req, _ := http.NewRequest("GET", url, nil)
+		w := httptest.NewRecorder()
+		env.router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code, url)
+
+		var user models.User
+		_ = json.Unmarshal(w.Body.Bytes(), &user)
+		assert.Equal(t, expected, user.Name)
+	}
+}
+
+func TestGetUserByEmailNotFound(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	req, _ := http.NewRequest("GET", "/api/v1/users/by-email/nobody@example.com", nil)
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	req, _ = http.NewRequest("GET", "/api/v1/users/by-email/not-an-email", nil)
+	w = httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestCreateUserDefaultRole(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	req, _ := http.NewRequest("POST", "/api/v1/users", bytes.NewBufferString(`{"name":"Eli","email":"eli@example.com"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var created models.User
+	_ = json.Unmarshal(w.Body.Bytes(), &created)
+	assert.Equal(t, "member", created.Role)
+}
+
+func TestUserRoleRejectsUnknownValue(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	req, _ := http.NewRequest("POST", "/api/v1/users", bytes.NewBufferString(`{"name":"Eli","email":"eli@example.com","role":"superuser"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	var resp models.ErrorResponse
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	assert.Equal(t, []models.FieldError{{Field: "role", Error: "must be one of: admin, member, viewer"}}, resp.Errors)
+
+	env.db.Create(&models.User{Name: "Eli", Email: "eli@example.com"})
+
+	for _, method := range []string{"PUT", "PATCH"} {
+		req, _ = http.NewRequest(method, "/api/v1/users/1", bytes.NewBufferString(`{"name":"Eli","email":"eli@example.com","role":"superuser","version":1}`))
+		req.Header.Set("Content-Type", "application/json")
+		w = httptest.NewRecorder()
+		env.router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code, method)
+	}
+}
+
+func TestPatchUserRole(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	env.db.Create(&models.User{Name: "Eli", Email: "eli@example.com"})
+
+	req, _ := http.NewRequest("PATCH", "/api/v1/users/1", bytes.NewBufferString(`{"role":"admin","version":1}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var patchedUser models.User
+	_ = json.Unmarshal(w.Body.Bytes(), &patchedUser)
+	assert.Equal(t, "admin", patchedUser.Role)
+}
+
+func TestGetUsersFilterByRole(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	env.db.Create(&models.User{Name: "Eli", Email: "eli@example.com", Role: "admin"})
+	env.db.Create(&models.User{Name: "Fay", Email: "fay@example.com"})
+	env.db.Create(&models.User{Name: "Gus", Email: "gus@example.com", Role: "admin"})
+
+	assert.Equal(t, []int{1, 3}, fetchUserIDs(t, env, "/api/v1/users?role=admin"))
+	assert.Equal(t, []int{2}, fetchUserIDs(t, env, "/api/v1/users?role=member"))
+}
+
+func TestUserPhoneNormalization(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	req, _ := http.NewRequest("POST", "/api/v1/users", bytes.NewBufferString(`{"name":"Hal","email":"hal@example.com","phone":"+1 (555) 123-4567"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var created models.User
+	_ = json.Unmarshal(w.Body.Bytes(), &created)
+	assert.Equal(t, "+15551234567", created.Phone)
+
+	req, _ = http.NewRequest("PUT", "/api/v1/users/1", bytes.NewBufferString(`{"name":"Hal","email":"hal@example.com","phone":"+44 20-7946-0958","version":1}`))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var storedUser models.User
+	env.db.First(&storedUser, 1)
+	assert.Equal(t, "+442079460958", storedUser.Phone)
+
+	req, _ = http.NewRequest("PATCH", "/api/v1/users/1", bytes.NewBufferString(`{"phone":"+49 30 123456","version":2}`))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	env.db.First(&storedUser, 1)
+	assert.Equal(t, "+4930123456", storedUser.Phone)
+}
+
+func TestUserPhoneOptional(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	for _, body := range []string{
+		`{"name":"Hal","email":"hal@example.com"}`,
+		`{"name":"Ida","email":"ida@example.com","phone":""}`,
+	} {
+		req, _ := http.NewRequest("POST", "/api/v1/users", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		env.router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.NotContains(t, w.Body.String(), "phone")
+	}
+}
+
+func TestUserPhoneRejectsLetters(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	req, _ := http.NewRequest("POST", "/api/v1/users", bytes.NewBufferString(`{"name":"Hal","email":"hal@example.com","phone":"+1 555 CALL NOW"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	var resp models.ErrorResponse
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	assert.Len(t, resp.Errors, 1)
+	assert.Equal(t, "phone", resp.Errors[0].Field)
+}
+
+func fetchEnvelope(t *testing.T, env *testEnv, url string) ListEnvelope {
+	req, _ := http.NewRequest("GET", url, nil)
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var envelope ListEnvelope
+	var users []models.User
+	envelope.Data = &users
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &envelope))
+	envelope.Data = users
+	return envelope
+}
+
+func TestGetUsersEnvelopeLastPartialPage(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	for i := 1; i <= 7; i++ {
+		env.db.Create(&models.User{Name: "User " + strconv.Itoa(i), Email: "user" + strconv.Itoa(i) + "@example.com"})
+	}
+
+	envelope := fetchEnvelope(t, env, "/api/v1/users?envelope=true&page=3&limit=3")
+	assert.Equal(t, int64(7), envelope.Total)
+	assert.Equal(t, 3, envelope.Page)
+	assert.Equal(t, 3, envelope.PerPage)
+	assert.Equal(t, 3, envelope.TotalPages)
+	if users := envelope.Data.([]models.User); assert.Len(t, users, 1) {
+		assert.Equal(t, 7, users[0].ID)
+	}
+
+	envelope = fetchEnvelope(t, env, "/api/v1/users?envelope=true&page=2&limit=7")
+	assert.Equal(t, 1, envelope.TotalPages)
+	assert.Empty(t, envelope.Data)
+}
+
+func TestGetUsersEnvelopeDefaultsAndFilters(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	seedFilterUsers(env)
+
+	envelope := fetchEnvelope(t, env, "/api/v1/users?envelope=true&name=ali")
+	assert.Equal(t, 1, envelope.Page)
+	assert.Equal(t, env.server.cfg.DefaultPageSize, envelope.PerPage)
+	assert.Equal(t, int64(3), envelope.Total)
+	assert.Len(t, envelope.Data, 3)
+	assert.Equal(t, 1, envelope.TotalPages)
+
+	envelope = fetchEnvelope(t, env, "/api/v1/users?envelope=true&name=nobody")
+	assert.Equal(t, int64(0), envelope.Total)
+	assert.Equal(t, 0, envelope.TotalPages)
+}
+
+func TestGetUsersPlainArrayByDefault(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	seedFilterUsers(env)
+
+	req, _ := http.NewRequest("GET", "/api/v1/users?page=1&limit=2", nil)
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, strings.HasPrefix(w.Body.String(), "["))
+}
+
+func TestGetUsersEnvelopeWithCursor(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	req, _ := http.NewRequest("GET", "/api/v1/users?envelope=true&cursor=0", nil)
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestEmailUniquenessIgnoresCase(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	req, _ := http.NewRequest("POST", "/api/v1/users", bytes.NewBufferString(`{"name":"Alice","email":"alice@example.com"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	req, _ = http.NewRequest("POST", "/api/v1/users", bytes.NewBufferString(`{"name":"Alice","email":"Alice@Example.com"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	var resp models.ErrorResponse
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	assert.Equal(t, CodeDuplicateEmail, resp.Code)
+
+	req, _ = http.NewRequest("GET", "/api/v1/users/by-email/ALICE@EXAMPLE.COM", nil)
+	w = httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var user models.User
+	_ = json.Unmarshal(w.Body.Bytes(), &user)
+	assert.Equal(t, 1, user.ID)
+}
+
+func TestEmailStoredLowercase(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	req, _ := http.NewRequest("POST", "/api/v1/users", bytes.NewBufferString(`{"name":"Bob","email":"Bob@Example.com"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	req, _ = http.NewRequest("PATCH", "/api/v1/users/1", bytes.NewBufferString(`{"email":"ROBERT@example.com","version":1}`))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var storedUser models.User
+	env.db.First(&storedUser, 1)
+	assert.Equal(t, "robert@example.com", storedUser.Email)
+
+	// A differently-cased upsert updates the existing user instead of inserting
+	req, _ = http.NewRequest("PUT", "/api/v1/users/by-email/Robert@Example.com", bytes.NewBufferString(`{"name":"Robert"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var count int64
+	env.db.Model(&models.User{}).Count(&count)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestCreateUsersBulkDuplicateEmailIgnoresCase(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	env.db.Create(&models.User{Name: "Alice", Email: "alice@example.com"})
+
+	w, resp := postBulk(env, "/api/v1/users/bulk", `[{"name":"A","email":"ALICE@example.com"},{"name":"B","email":"b@example.com"},{"name":"B2","email":"B@example.com"}]`)
+	assert.Equal(t, http.StatusMultiStatus, w.Code)
+	assert.Len(t, resp.Created, 1)
+	assert.Len(t, resp.Errors, 2)
+}
+
+func TestUserInputWhitespaceIsNormalized(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	req, _ := http.NewRequest("POST", "/api/v1/users", bytes.NewBufferString(`{"name":"  Alice   van  Dyke  ","email":"  alice@example.com "}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var storedUser models.User
+	env.db.First(&storedUser, 1)
+	assert.Equal(t, "Alice van Dyke", storedUser.Name)
+	assert.Equal(t, "alice@example.com", storedUser.Email)
+
+	req, _ = http.NewRequest("PUT", "/api/v1/users/1", bytes.NewBufferString(`{"name":"  Alice  ","email":"alice@example.com ","version":1}`))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	env.db.First(&storedUser, 1)
+	assert.Equal(t, "Alice", storedUser.Name)
+
+	req, _ = http.NewRequest("PATCH", "/api/v1/users/1", bytes.NewBufferString(`{"name":" Alicia ","version":2}`))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	env.db.First(&storedUser, 1)
+	assert.Equal(t, "Alicia", storedUser.Name)
+}
+
+func TestWhitespaceOnlyNameIsRejected(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	env.db.Create(&models.User{Name: "Bob", Email: "bob@example.com"})
+
+	for _, tt := range []struct{ method, url, body string }{
+		{"POST", "/api/v1/users", `{"name":"   ","email":"new@example.com"}`},
+		{"PUT", "/api/v1/users/1", `{"name":" \t ","email":"bob@example.com","version":1}`},
+		{"PATCH", "/api/v1/users/1", `{"name":"  ","version":1}`},
+		{"PUT", "/api/v1/users/by-email/new@example.com", `{"name":"  "}`},
+	} {
+		req, _ := http.NewRequest(tt.method, tt.url, bytes.NewBufferString(tt.body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		env.router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code, tt.method+" "+tt.url)
+	}
+
+	var storedUser models.User
+	env.db.First(&storedUser, 1)
+	assert.Equal(t, "Bob", storedUser.Name)
+}
+
+func TestBulkAndImportNormalizeWhitespace(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	w, resp := postBulk(env, "/api/v1/users/bulk", `[{"name":"  Alice  ","email":" alice@example.com "},{"name":"   ","email":"blank@example.com"}]`)
+	assert.Equal(t, http.StatusMultiStatus, w.Code)
+	assert.Len(t, resp.Created, 1)
+	assert.Len(t, resp.Errors, 1)
+
+	w, imported := postCSV(env, "name,email\n  Bob   Smith ,  BOB@example.com\n")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 1, imported.Imported)
+
+	var users []models.User
+	env.db.Order("id").Find(&users)
+	if assert.Len(t, users, 2) {
+		assert.Equal(t, "Alice", users[0].Name)
+		assert.Equal(t, "alice@example.com", users[0].Email)
+		assert.Equal(t, "Bob Smith", users[1].Name)
+		assert.Equal(t, "bob@example.com", users[1].Email)
+	}
+}
+
+func TestUpdateUserRejectsMismatchedID(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	env.db.Create(&models.User{Name: "Alice", Email: "alice@example.com"})
+	env.db.Create(&models.User{Name: "Bob", Email: "bob@example.com"})
+
+	req, _ := http.NewRequest("PUT", "/api/v1/users/1", bytes.NewBufferString(`{"id":2,"name":"Mallory","email":"mallory@example.com","version":1}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	req, _ = http.NewRequest("PUT", "/api/v1/users/1", bytes.NewBufferString(`{"id":999,"name":"Mallory","email":"mallory@example.com","version":1}`))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	var users []models.User
+	env.db.Order("id").Find(&users)
+	if assert.Len(t, users, 2) {
+		assert.Equal(t, "Alice", users[0].Name)
+		assert.Equal(t, "Bob", users[1].Name)
+	}
+}
+
+func TestUpdateUserAcceptsMatchingID(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	env.db.Create(&models.User{Name: "Alice", Email: "alice@example.com"})
+
+	req, _ := http.NewRequest("PUT", "/api/v1/users/1", bytes.NewBufferString(`{"id":1,"name":"Alicia","email":"alice@example.com","version":1}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var users []models.User
+	env.db.Find(&users)
+	if assert.Len(t, users, 1) {
+		assert.Equal(t, 1, users[0].ID)
+		assert.Equal(t, "Alicia", users[0].Name)
+	}
+}
+
+func TestCreateUserRejectsUnknownField(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	req, _ := http.NewRequest("POST", "/api/v1/users", bytes.NewBufferString(`{"name":"Alice","emial":"alice@example.com"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.JSONEq(t, withRequestID(`{
+		"code": "VALIDATION_ERROR",
+		"message": "unknown field: emial",
+		"errors": [{"field": "emial", "error": "is not a known field"}]
+	}`, w), w.Body.String())
+}
+
+func TestUpdateUserRejectsUnknownField(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	env.db.Create(&models.User{Name: "Alice", Email: "alice@example.com"})
+
+	req, _ := http.NewRequest("PUT", "/api/v1/users/1", bytes.NewBufferString(`{"name":"Alicia","email":"alice@example.com","version":1,"nickname":"Ali"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "nickname")
+
+	var storedUser models.User
+	env.db.First(&storedUser, 1)
+	assert.Equal(t, "Alice", storedUser.Name)
+}
+
+func TestLenientJSONAcceptsUnknownField(t *testing.T) {
+	t.Parallel()
+	cfg := testConfig()
+	cfg.LenientJSON = true
+	env := newTestEnvWith(t, Deps{Config: cfg})
+
+	req, _ := http.NewRequest("POST", "/api/v1/users", bytes.NewBufferString(`{"name":"Alice","email":"alice@example.com","emial":"typo@example.com"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+}
+
+func TestGetUsersLimitAtMax(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	seedSortUsers(env)
+
+	req, _ := http.NewRequest("GET", "/api/v1/users?limit="+strconv.Itoa(env.server.cfg.MaxPageSize), nil)
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, strconv.Itoa(env.server.cfg.MaxPageSize), w.Header().Get("X-Max-Page-Size"))
+}
+
+func TestGetUsersLimitOverMax(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	req, _ := http.NewRequest("GET", "/api/v1/users?limit="+strconv.Itoa(env.server.cfg.MaxPageSize+1), nil)
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	var resp models.ErrorResponse
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	assert.Equal(t, "limit must be at most "+strconv.Itoa(env.server.cfg.MaxPageSize), resp.Message)
+	assert.Equal(t, strconv.Itoa(env.server.cfg.MaxPageSize), w.Header().Get("X-Max-Page-Size"))
+}
+
+func TestMaxPageSizeHeaderOnListResponses(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	seedSearchUsers(env)
+
+	for _, url := range []string{"/api/v1/users", "/api/v1/users/search?q=al"} {
+		req, _ := http.NewRequest("GET", url, nil)
+		w := httptest.NewRecorder()
+		env.router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code, url)
+		assert.Equal(t, "100", w.Header().Get("X-Max-Page-Size"), url)
+	}
+}
+
+// unavailableUsers is a UserRepository whose reads fail as if its database were down
+type unavailableUsers struct {
+	storage.UserRepository
+}
+
+func (unavailableUsers) Get(context.Context, int) (models.User, error) {
+	return models.User{}, errors.New("database is down")
+}
+
+func TestHandlersUseInjectedUserRepository(t *testing.T) {
+	t.Parallel()
+	env := newTestEnvWith(t, Deps{Users: unavailableUsers{}})
+
+	// A lookup that fails for a reason other than a missing user is not a 404
+	req, _ := http.NewRequest("POST", "/api/v1/users/1/password", strings.NewReader(`{"current_password":"x","new_password":"long enough password"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+func TestGetUserFromFakeRepository(t *testing.T) {
+	t.Parallel()
+	// No database at all: the read endpoints only need the repository
+	users := testsupport.NewFakeUserRepository()
+	alice := models.User{Name: "Alice", Email: "alice@example.com"}
+	assert.NoError(t, users.Create(context.Background(), &alice))
+	srv := newServer(Deps{Users: users, Config: testConfig()})
+	r := gin.New()
+	srv.initializeRoutes(r)
+
+	for _, url := range []string{"/api/v1/users/1", "/api/v1/users/by-email/ALICE@example.com"} {
+		req, _ := http.NewRequest("GET", url, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code, url)
+		var got models.User
+		_ = json.Unmarshal(w.Body.Bytes(), &got)
+		assert.Equal(t, "Alice", got.Name, url)
+	}
+
+	req, _ := http.NewRequest("GET", "/api/v1/users/2", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestSearchAndExportFromFakeRepository(t *testing.T) {
+	t.Parallel()
+	users := testsupport.NewFakeUserRepository()
+	for _, name := range []string{"Alice", "Bob", "Malice"} {
+		user := models.User{Name: name, Email: strings.ToLower(name) + "@example.com"}
+		require.NoError(t, users.Create(context.Background(), &user))
+	}
+	srv := newServer(Deps{Users: users, Config: testConfig()})
+	r := gin.New()
+	srv.initializeRoutes(r)
+
+	req, _ := http.NewRequest("GET", "/api/v2/users/search?q=alice@example.com", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var envelope struct {
+		Data  []models.User `json:"data"`
+		Total int64         `json:"total"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &envelope))
+	if assert.Len(t, envelope.Data, 2) {
+		assert.Equal(t, 1, envelope.Data[0].ID, "the exact email match leads")
+		assert.Equal(t, 3, envelope.Data[1].ID)
+	}
+	assert.Equal(t, int64(2), envelope.Total)
+
+	req, _ = http.NewRequest("GET", "/api/v1/users/export?name=ali", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "id,name,email\n1,Alice,alice@example.com\n3,Malice,malice@example.com\n", w.Body.String())
+
+	users.FailWith(errDatabaseDown)
+	req, _ = http.NewRequest("GET", "/api/v1/users/stream", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+}
+
+func TestUserChangesArePublished(t *testing.T) {
+	t.Parallel()
+	events := &service.MemoryPublisher{}
+	env := newTestEnvWith(t, Deps{Events: events})
+
+	// Exactly one event per change, and none for requests that change nothing
+	for _, step := range []struct {
+		method, url, body string
+		status            int
+	}{
+		{"POST", "/api/v1/users", `{"name":"Alice","email":"alice@example.com"}`, http.StatusCreated},
+		{"POST", "/api/v1/users", `{"name":"Alice","email":"ALICE@example.com"}`, http.StatusConflict},
+		{"PUT", "/api/v1/users/1", `{"name":"Alice","email":"alice@example.org","version":1}`, http.StatusOK},
+		{"PATCH", "/api/v1/users/1", `{"name":"Alice Smith","version":1}`, http.StatusConflict},
+		{"PATCH", "/api/v1/users/1", `{"name":"Alice Smith","version":2}`, http.StatusOK},
+		{"PATCH", "/api/v1/users/1", `{"name":"","version":3}`, http.StatusBadRequest},
+		{"DELETE", "/api/v1/users/1", "", http.StatusOK},
+		{"DELETE", "/api/v1/users/1", "", http.StatusNotFound},
+	} {
+		w := send(env, step.method, step.url, step.body)
+		assert.Equal(t, step.status, w.Code, "%s %s %s: %s", step.method, step.url, step.body, w.Body.String())
+	}
+
+	var kinds []string
+	for _, e := range events.Events() {
+		kinds = append(kinds, e.Type)
+		assert.Equal(t, 1, e.UserID)
+		assert.Equal(t, "1", e.Actor)
+	}
+	assert.Equal(t, []string{service.EventUserCreated, service.EventUserUpdated, service.EventUserUpdated, service.EventUserDeleted}, kinds)
+}
+
+func TestBatchAndColumnChangesArePublished(t *testing.T) {
+	t.Parallel()
+	events := &service.MemoryPublisher{}
+	env := newTestEnvWith(t, Deps{Events: events})
+
+	for _, step := range []struct {
+		method, url, body string
+		status            int
+	}{
+		{"POST", "/api/v1/users/bulk", `[{"name":"Alice","email":"alice@example.com"},{"name":"","email":"x@example.com"},{"name":"Bob","email":"bob@example.com"}]`, http.StatusMultiStatus},
+		{"POST", "/api/v1/users/bulk?atomic=true", `[{"name":"Carol","email":"carol@example.com"},{"name":"Alice","email":"alice@example.com"}]`, http.StatusBadRequest},
+		{"POST", "/api/v1/users/import", "name,email\nCarol,carol@example.com\nBob,bob@example.com\n", http.StatusOK},
+		{"PUT", "/api/v1/users/by-email/dave@example.com", `{"name":"Dave"}`, http.StatusCreated},
+		{"PUT", "/api/v1/users/by-email/dave@example.com", `{"name":"David"}`, http.StatusOK},
+		{"PATCH", "/api/v1/users/1/preferences", `{"theme":"dark"}`, http.StatusOK},
+		{"PATCH", "/api/v1/users/1/preferences", `[]`, http.StatusBadRequest},
+		{"DELETE", "/api/v1/users/2", "", http.StatusOK},
+		{"POST", "/api/v1/users/2/restore", "", http.StatusOK},
+		{"POST", "/api/v1/users/2/restore", "", http.StatusBadRequest},
+	} {
+		w := send(env, step.method, step.url, step.body)
+		assert.Equal(t, step.status, w.Code, "%s %s %s: %s", step.method, step.url, step.body, w.Body.String())
+	}
+	png, err := os.ReadFile("testdata/avatar.png")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, putAvatar(t, env, "/api/v1/users/1/avatar", png).Code)
+
+	type published struct {
+		kind string
+		id   int
+	}
+	var got []published
+	for _, e := range events.Events() {
+		got = append(got, published{e.Type, e.UserID})
+		assert.Equal(t, "1", e.Actor)
+	}
+	assert.Equal(t, []published{
+		{service.EventUserCreated, 1},
+		{service.EventUserCreated, 2},
+		{service.EventUserCreated, 3},
+		{service.EventUserCreated, 4},
+		{service.EventUserUpdated, 4},
+		{service.EventUserUpdated, 1},
+		{service.EventUserDeleted, 2},
+		{service.EventUserUpdated, 2},
+		{service.EventUserUpdated, 1},
+	}, got)
+}
+
+// errDatabaseDown is what a broken database answers the fake repository's calls with
+var errDatabaseDown = errors.New("database is down")
+
+// userErrorCase is a request to a user handler and the error it must be answered with
+type userErrorCase struct {
+	name    string
+	method  string
+	url     string
+	body    string
+	failing error // returned by every repository call, if set
+	status  int
+	code    string
+	message string
+}
+
+// runUserErrorCases sends each case to a server of its own, backed by a fake
+// repository holding alice@example.com (1) and bob@example.com (2)
+func runUserErrorCases(t *testing.T, cases []userErrorCase) {
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			users := testsupport.NewFakeUserRepository()
+			for _, name := range []string{"alice", "bob"} {
+				require.NoError(t, users.Create(context.Background(), &models.User{Name: name, Email: name + "@example.com"}))
+			}
+			users.FailWith(tt.failing)
+			env := newTestEnvWith(t, Deps{Users: users})
+
+			req, _ := http.NewRequest(tt.method, tt.url, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			env.router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.status, w.Code, w.Body.String())
+			var resp models.ErrorResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Equal(t, tt.code, resp.Code)
+			assert.Equal(t, tt.message, resp.Message)
+		})
+	}
+}
+
+func TestGetUsersErrors(t *testing.T) {
+	t.Parallel()
+	runUserErrorCases(t, []userErrorCase{
+		{name: "bad page", method: "GET", url: "/api/v1/users?page=x", status: 400, code: CodeValidation, message: "page must be a positive integer"},
+		{name: "repository failure", method: "GET", url: "/api/v1/users", failing: errDatabaseDown, status: 500, code: CodeInternal, message: "Internal server error"},
+		{name: "count failure", method: "GET", url: "/api/v2/users", failing: errDatabaseDown, status: 500, code: CodeInternal, message: "Internal server error"},
+		{name: "timeout", method: "GET", url: "/api/v1/users", failing: context.DeadlineExceeded, status: 504, code: CodeTimeout, message: "Request timed out"},
+	})
+}
+
+func TestCountUsersErrors(t *testing.T) {
+	t.Parallel()
+	runUserErrorCases(t, []userErrorCase{
+		{name: "repository failure", method: "GET", url: "/api/v1/users/count", failing: errDatabaseDown, status: 500, code: CodeInternal, message: "Internal server error"},
+	})
+}
+
+func TestGetUserErrors(t *testing.T) {
+	t.Parallel()
+	runUserErrorCases(t, []userErrorCase{
+		{name: "invalid id", method: "GET", url: "/api/v1/users/abc", status: 400, code: CodeValidation, message: "id must be a positive integer"},
+		{name: "zero id", method: "GET", url: "/api/v1/users/0", status: 400, code: CodeValidation, message: "id must be a positive integer"},
+		{name: "missing record", method: "GET", url: "/api/v1/users/99", status: 404, code: CodeUserNotFound, message: "User not found"},
+		{name: "repository failure", method: "GET", url: "/api/v1/users/1", failing: errDatabaseDown, status: 500, code: CodeInternal, message: "Internal server error"},
+		{name: "client gone", method: "GET", url: "/api/v1/users/1", failing: context.Canceled, status: StatusClientClosedRequest, code: CodeClientClosedRequest, message: "Client closed request"},
+	})
+}
+
+// A failing repository is a 500, not a missing user, wherever a user is looked up
+func TestUserLookupErrors(t *testing.T) {
+	t.Parallel()
+	runUserErrorCases(t, []userErrorCase{
+		{name: "get avatar", method: "GET", url: "/api/v1/users/1/avatar", failing: errDatabaseDown, status: 500, code: CodeInternal, message: "Internal server error"},
+		{name: "upload avatar", method: "PUT", url: "/api/v1/users/1/avatar", failing: errDatabaseDown, status: 500, code: CodeInternal, message: "Internal server error"},
+		{name: "get preferences", method: "GET", url: "/api/v1/users/1/preferences", failing: errDatabaseDown, status: 500, code: CodeInternal, message: "Internal server error"},
+		{name: "missing avatar owner", method: "GET", url: "/api/v1/users/99/avatar", status: 404, code: CodeUserNotFound, message: "User not found"},
+		{name: "missing preferences owner", method: "GET", url: "/api/v1/users/99/preferences", status: 404, code: CodeUserNotFound, message: "User not found"},
+	})
+}
+
+func TestHeadUserRepositoryFailure(t *testing.T) {
+	t.Parallel()
+	users := testsupport.NewFakeUserRepository()
+	users.FailWith(errDatabaseDown)
+	env := newTestEnvWith(t, Deps{Users: users})
+
+	req, _ := http.NewRequest("HEAD", "/api/v1/users/1", nil)
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Empty(t, w.Body.Bytes())
+}
+
+func TestGetUserByEmailErrors(t *testing.T) {
+	t.Parallel()
+	runUserErrorCases(t, []userErrorCase{
+		{name: "invalid email", method: "GET", url: "/api/v1/users/by-email/alice", status: 400, code: CodeValidation, message: "email must be a valid email"},
+		{name: "missing record", method: "GET", url: "/api/v1/users/by-email/carol@example.com", status: 404, code: CodeUserNotFound, message: "User not found"},
+		{name: "repository failure", method: "GET", url: "/api/v1/users/by-email/alice@example.com", failing: errDatabaseDown, status: 500, code: CodeInternal, message: "Internal server error"},
+	})
+}
+
+func TestCreateUserErrors(t *testing.T) {
+	t.Parallel()
+	runUserErrorCases(t, []userErrorCase{
+		{name: "invalid json", method: "POST", url: "/api/v1/users", body: `{"name":`, status: 400, code: CodeValidation, message: "Invalid input"},
+		{name: "missing field", method: "POST", url: "/api/v1/users", body: `{"name":"Carol"}`, status: 400, code: CodeValidation, message: "validation failed"},
+		{name: "unknown field", method: "POST", url: "/api/v1/users", body: `{"name":"Carol","email":"carol@example.com","nickname":"c"}`, status: 400, code: CodeValidation, message: "unknown field: nickname"},
+		{name: "duplicate email", method: "POST", url: "/api/v1/users", body: `{"name":"Alice","email":"ALICE@example.com"}`, status: 409, code: CodeDuplicateEmail, message: "email already in use"},
+		{name: "repository failure", method: "POST", url: "/api/v1/users", body: `{"name":"Carol","email":"carol@example.com"}`, failing: errDatabaseDown, status: 500, code: CodeInternal, message: "Internal server error"},
+	})
+}
+
+func TestUpdateUserErrors(t *testing.T) {
+	t.Parallel()
+	runUserErrorCases(t, []userErrorCase{
+		{name: "invalid id", method: "PUT", url: "/api/v1/users/abc", body: `{"name":"Alice","email":"alice@example.com","version":1}`, status: 400, code: CodeValidation, message: "id must be a positive integer"},
+		{name: "missing record", method: "PUT", url: "/api/v1/users/99", body: `{"name":"Alice","email":"alice@example.com","version":1}`, status: 404, code: CodeUserNotFound, message: "User not found"},
+		{name: "invalid json", method: "PUT", url: "/api/v1/users/1", body: `{"name":`, status: 400, code: CodeValidation, message: "Invalid input"},
+		{name: "id changed", method: "PUT", url: "/api/v1/users/1", body: `{"id":2,"name":"Alice","email":"alice@example.com","version":1}`, status: 400, code: CodeValidation, message: "id cannot be modified"},
+		{name: "no version", method: "PUT", url: "/api/v1/users/1", body: `{"name":"Alice","email":"alice@example.com"}`, status: 428, code: CodePreconditionRequired, message: "version is required, send it in the body or an If-Match header"},
+		{name: "duplicate email", method: "PUT", url: "/api/v1/users/1", body: `{"name":"Alice","email":"bob@example.com","version":1}`, status: 409, code: CodeDuplicateEmail, message: "email already in use"},
+		{name: "repository failure", method: "PUT", url: "/api/v1/users/1", body: `{"name":"Alice","email":"alice@example.com","version":1}`, failing: errDatabaseDown, status: 500, code: CodeInternal, message: "Internal server error"},
+	})
+}
+
+func TestPatchUserErrors(t *testing.T) {
+	t.Parallel()
+	runUserErrorCases(t, []userErrorCase{
+		{name: "invalid id", method: "PATCH", url: "/api/v1/users/-1", body: `{"name":"Alicia","version":1}`, status: 400, code: CodeValidation, message: "id must be a positive integer"},
+		{name: "missing record", method: "PATCH", url: "/api/v1/users/99", body: `{"name":"Alicia","version":1}`, status: 404, code: CodeUserNotFound, message: "User not found"},
+		{name: "invalid json", method: "PATCH", url: "/api/v1/users/1", body: `[]`, status: 400, code: CodeValidation, message: "Invalid input"},
+		{name: "id changed", method: "PATCH", url: "/api/v1/users/1", body: `{"id":2,"version":1}`, status: 400, code: CodeValidation, message: "id cannot be modified"},
+		{name: "empty name", method: "PATCH", url: "/api/v1/users/1", body: `{"name":"","version":1}`, status: 400, code: CodeValidation, message: "name cannot be empty"},
+		// Binding rejects these before the handler sees them
+		{name: "invalid email", method: "PATCH", url: "/api/v1/users/1", body: `{"email":"","version":1}`, status: 400, code: CodeValidation, message: "validation failed"},
+		{name: "invalid role", method: "PATCH", url: "/api/v1/users/1", body: `{"role":"","version":1}`, status: 400, code: CodeValidation, message: "validation failed"},
+		{name: "no version", method: "PATCH", url: "/api/v1/users/1", body: `{"name":"Alicia"}`, status: 428, code: CodePreconditionRequired, message: "version is required, send it in the body or an If-Match header"},
+		{name: "duplicate email", method: "PATCH", url: "/api/v1/users/1", body: `{"email":"bob@example.com","version":1}`, status: 409, code: CodeDuplicateEmail, message: "email already in use"},
+		{name: "repository failure", method: "PATCH", url: "/api/v1/users/1", body: `{"name":"Alicia","version":1}`, failing: errDatabaseDown, status: 500, code: CodeInternal, message: "Internal server error"},
+	})
+}
+
+func TestDeleteUserErrors(t *testing.T) {
+	t.Parallel()
+	runUserErrorCases(t, []userErrorCase{
+		{name: "invalid id", method: "DELETE", url: "/api/v1/users/abc", status: 400, code: CodeValidation, message: "id must be a positive integer"},
+		{name: "missing record", method: "DELETE", url: "/api/v1/users/99", status: 404, code: CodeUserNotFound, message: "User not found"},
+		{name: "repository failure", method: "DELETE", url: "/api/v1/users/1", failing: errDatabaseDown, status: 500, code: CodeInternal, message: "Internal server error"},
+	})
+}
+
+func TestRestoreUserErrors(t *testing.T) {
+	t.Parallel()
+	runUserErrorCases(t, []userErrorCase{
+		{name: "invalid id", method: "POST", url: "/api/v1/users/abc/restore", status: 400, code: CodeValidation, message: "id must be a positive integer"},
+		{name: "missing record", method: "POST", url: "/api/v1/users/99/restore", status: 404, code: CodeUserNotFound, message: "User not found"},
+		{name: "active user", method: "POST", url: "/api/v1/users/1/restore", status: 400, code: CodeUserNotDeleted, message: "User is not deleted"},
+		{name: "repository failure", method: "POST", url: "/api/v1/users/1/restore", failing: errDatabaseDown, status: 500, code: CodeInternal, message: "Internal server error"},
+	})
+}
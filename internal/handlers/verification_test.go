@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"Unit-Test/internal/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// verify posts a verification token to /auth/verify
+func verify(env *testEnv, token string) *httptest.ResponseRecorder {
+	return sendWithAuth(newAuthTestRouter(env), "POST", "/api/v1/auth/verify", `{"token":"`+token+`"}`, "")
+}
+
+// emailVerifiedAt reads the stored verification time of a user
+func emailVerifiedAt(env *testEnv, id int) *time.Time {
+	var user models.User
+	env.db.Select("email_verified_at").First(&user, id)
+	return user.EmailVerifiedAt
+}
+
+func TestEmailVerificationOnRegister(t *testing.T) {
+	t.Parallel()
+	env, rec := newRecordingEnv(t)
+	loginAlice(t, env)
+
+	assert.Equal(t, "Alice", rec.welcomes["alice@example.com"], "registering welcomes the user")
+	token := rec.verifications["alice@example.com"]
+	assert.NotEmpty(t, token)
+	assert.Nil(t, emailVerifiedAt(env, 1))
+
+	w := verify(env, token)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var user models.User
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &user))
+	assert.NotNil(t, user.EmailVerifiedAt)
+	assert.NotNil(t, emailVerifiedAt(env, 1))
+
+	// Each token works once
+	w = verify(env, token)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "Invalid or expired verification token")
+}
+
+func TestEveryCreatedUserIsWelcomed(t *testing.T) {
+	t.Parallel()
+	env, rec := newRecordingEnv(t)
+
+	for _, step := range []struct {
+		method, url, body string
+		status            int
+	}{
+		{"POST", "/api/v1/users", `{"name":"Alice","email":"alice@example.com"}`, http.StatusCreated},
+		{"POST", "/api/v1/users/bulk", `[{"name":"Bob","email":"bob@example.com"},{"name":"","email":"x@example.com"}]`, http.StatusMultiStatus},
+		{"POST", "/api/v1/users/import", "name,email\nCarol,carol@example.com\nBob,bob@example.com\n", http.StatusOK},
+		{"PUT", "/api/v1/users/by-email/dave@example.com", `{"name":"Dave"}`, http.StatusCreated},
+		{"PUT", "/api/v1/users/by-email/alice@example.com", `{"name":"Alicia"}`, http.StatusOK},
+		{"POST", "/api/v1/graphql", `{"query":"mutation { createUser(input: {name: \"Eve\", email: \"eve@example.com\"}) { id } }"}`, http.StatusOK},
+	} {
+		w := send(env, step.method, step.url, step.body)
+		assert.Equal(t, step.status, w.Code, "%s %s: %s", step.method, step.url, w.Body.String())
+	}
+
+	assert.Equal(t, map[string]string{
+		"alice@example.com": "Alice",
+		"bob@example.com":   "Bob",
+		"carol@example.com": "Carol",
+		"dave@example.com":  "Dave",
+		"eve@example.com":   "Eve",
+	}, rec.welcomes, "only the users created are welcomed, once each")
+}
+
+func TestEmailVerificationTokenExpiry(t *testing.T) {
+	t.Parallel()
+	now := time.Now()
+	env, rec := newRecordingEnvWith(t, Deps{Clock: func() time.Time { return now }})
+
+	loginAlice(t, env)
+	token := rec.verifications["alice@example.com"]
+
+	now = now.Add(emailVerificationTTL + time.Second)
+	assert.Equal(t, http.StatusBadRequest, verify(env, token).Code)
+	assert.Nil(t, emailVerifiedAt(env, 1))
+}
+
+func TestEmailVerificationUnknownToken(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	assert.Equal(t, http.StatusBadRequest, verify(env, "not-a-token").Code)
+}
+
+func TestEmailChangeRestartsVerification(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		method, body string
+	}{
+		{"PATCH", `{"email":"alicia@example.com","version":1}`},
+		{"PUT", `{"name":"Alice","email":"alicia@example.com","version":1}`},
+	} {
+		t.Run(tc.method, func(t *testing.T) {
+			env, rec := newRecordingEnv(t)
+			loginAlice(t, env)
+			oldToken := rec.verifications["alice@example.com"]
+			assert.Equal(t, http.StatusOK, verify(env, oldToken).Code)
+
+			w := send(env, tc.method, "/api/v1/users/1", tc.body)
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Contains(t, w.Body.String(), `"email_verified_at":null`)
+			assert.Nil(t, emailVerifiedAt(env, 1))
+
+			newToken := rec.verifications["alicia@example.com"]
+			assert.NotEmpty(t, newToken)
+			assert.Equal(t, http.StatusOK, verify(env, newToken).Code)
+			assert.NotNil(t, emailVerifiedAt(env, 1))
+		})
+	}
+}
+
+func TestEmailChangeInvalidatesPendingToken(t *testing.T) {
+	t.Parallel()
+	env, rec := newRecordingEnv(t)
+	loginAlice(t, env)
+	oldToken := rec.verifications["alice@example.com"]
+
+	assert.Equal(t, http.StatusOK, send(env, "PATCH", "/api/v1/users/1", `{"email":"alicia@example.com","version":1}`).Code)
+
+	// The old token would otherwise verify the new, unconfirmed email
+	assert.Equal(t, http.StatusBadRequest, verify(env, oldToken).Code)
+	assert.Nil(t, emailVerifiedAt(env, 1))
+}
+
+func TestUpdateWithoutEmailChangeKeepsVerification(t *testing.T) {
+	t.Parallel()
+	env, rec := newRecordingEnv(t)
+	loginAlice(t, env)
+	verify(env, rec.verifications["alice@example.com"])
+	delete(rec.verifications, "alice@example.com")
+
+	assert.Equal(t, http.StatusOK, send(env, "PATCH", "/api/v1/users/1", `{"name":"Alicia","version":1}`).Code)
+	assert.NotNil(t, emailVerifiedAt(env, 1))
+	assert.Empty(t, rec.verifications)
+}
+
+func TestEmailVerifiedAtIsNotWritable(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	w := send(env, "POST", "/api/v1/users", `{"name":"Alice","email":"alice@example.com","email_verified_at":"2020-01-01T00:00:00Z"}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Nil(t, emailVerifiedAt(env, 1))
+
+	w = send(env, "PUT", "/api/v1/users/1", `{"name":"Alice","email":"alice@example.com","version":1,"email_verified_at":"2020-01-01T00:00:00Z"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Nil(t, emailVerifiedAt(env, 1))
+}
+
+func TestFilterUsersByVerified(t *testing.T) {
+	t.Parallel()
+	env, rec := newRecordingEnv(t)
+	loginAlice(t, env)
+	verify(env, rec.verifications["alice@example.com"])
+	send(env, "POST", "/api/v1/users", `{"name":"Bob","email":"bob@example.com"}`)
+
+	for query, want := range map[string]string{"true": "Alice", "false": "Bob"} {
+		w := send(env, "GET", "/api/v1/users?verified="+query, "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		var users []models.User
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &users))
+		if assert.Len(t, users, 1, query) {
+			assert.Equal(t, want, users[0].Name)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Context key holding the API version of the route, set by its group
+const apiVersionKey = "api_version"
+
+// API versions served side by side. v2 makes the changes v1 clients can't
+// take: paginated lists always answer with the envelope and deletes with 204.
+const (
+	apiV1 = 1
+	apiV2 = 2
+)
+
+// apiPrefixes are the path prefixes of the API versions
+var apiPrefixes = map[int]string{
+	apiV1: "/api/v1",
+	apiV2: "/api/v2",
+}
+
+// useAPIVersion marks the requests of a route group as made to version v
+func useAPIVersion(v int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(apiVersionKey, v)
+		c.Next()
+	}
+}
+
+// apiVersion is the API version the request was made to, 1 outside the groups
+func apiVersion(c *gin.Context) int {
+	if v := c.GetInt(apiVersionKey); v != 0 {
+		return v
+	}
+	return apiV1
+}
+
+// routeKey is the request's route pattern without its /api/vN prefix, so the
+// rules keyed by route cover every version of it
+func routeKey(c *gin.Context) string {
+	route := c.FullPath()
+	for _, prefix := range apiPrefixes {
+		if rest, ok := strings.CutPrefix(route, prefix); ok {
+			return rest
+		}
+	}
+	return route
+}
+
+// wantsEnvelope reports whether a paginated list should come wrapped with its
+// totals: always in v2, on request with envelope=true in v1
+func wantsEnvelope(c *gin.Context) bool {
+	return apiVersion(c) >= apiV2 || c.Query("envelope") == "true"
+}
+
+// respondDeleted answers a successful delete: v1 confirms it with message,
+// v2 with 204 No Content
+func respondDeleted(c *gin.Context, message string) {
+	if apiVersion(c) >= apiV2 {
+		c.Status(http.StatusNoContent)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": message})
+}
+
+// respondNoRoute answers requests no route matches under /api/v2 with a coded
+// error. Elsewhere it writes nothing, leaving gin's plain text 404 that v1 has
+// always answered with.
+func respondNoRoute(c *gin.Context) {
+	if strings.HasPrefix(c.Request.URL.Path, apiPrefixes[apiV2]+"/") {
+		respondError(c, http.StatusNotFound, CodeNotFound, "No route matches "+c.Request.Method+" "+c.Request.URL.Path)
+	}
+}
@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"Unit-Test/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// serveRequest sends a request without a body through env.router
+func serveRequest(env *testEnv, method, url string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, url, nil)
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+	return w
+}
+
+// decodeError reads the error body of w
+func decodeError(t *testing.T, w *httptest.ResponseRecorder) models.ErrorResponse {
+	var resp models.ErrorResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	return resp
+}
+
+// seedVersionUsers stores alice and bob, returning them as the database has them
+func seedVersionUsers(t *testing.T, env *testEnv) []models.User {
+	env.db.Create(&models.User{Name: "Alice", Email: "alice@example.com"})
+	env.db.Create(&models.User{Name: "Bob", Email: "bob@example.com"})
+	var users []models.User
+	require.NoError(t, env.db.Order("id").Find(&users).Error)
+	return users
+}
+
+// marshal is the JSON gin writes for v
+func marshal(t *testing.T, v interface{}) string {
+	body, err := json.Marshal(v)
+	require.NoError(t, err)
+	return string(body)
+}
+
+func TestV1ResponsesAreUnchanged(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	users := seedVersionUsers(t, env)
+
+	w := serveRequest(env, "GET", "/api/v1/users")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, marshal(t, users), w.Body.String())
+
+	w = serveRequest(env, "GET", "/api/v1/users/search?q=ali")
+	assert.Equal(t, marshal(t, users[:1]), w.Body.String())
+
+	w = serveRequest(env, "GET", "/api/v1/users/abc")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	resp := decodeError(t, w)
+	assert.Equal(t, CodeValidation, resp.Code)
+	assert.Equal(t, "id must be a positive integer", resp.Message)
+
+	w = serveRequest(env, "DELETE", "/api/v1/users/2")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `{"message":"User deleted"}`, w.Body.String())
+
+	w = serveRequest(env, "GET", "/api/v1/nothing-here")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "404 page not found", w.Body.String())
+}
+
+func TestV2ListsAreEnveloped(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	users := seedVersionUsers(t, env)
+
+	w := serveRequest(env, "GET", "/api/v2/users?limit=1")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, marshal(t, ListEnvelope{Data: users[:1], Total: 2, Page: 1, PerPage: 1, TotalPages: 2}), w.Body.String())
+
+	// Without paging parameters the envelope holds the first page
+	w = serveRequest(env, "GET", "/api/v2/users/search?q=example")
+	assert.Equal(t, marshal(t, ListEnvelope{Data: users, Total: 2, Page: 1, PerPage: env.server.cfg.DefaultPageSize, TotalPages: 1}), w.Body.String())
+
+	env.db.Create(&models.AuditLog{Actor: "1", Action: models.AuditCreate, UserID: 1})
+	w = serveRequest(env, "GET", "/api/v2/users/1/audit")
+	var envelope ListEnvelope
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &envelope))
+	assert.Equal(t, int64(1), envelope.Total)
+	assert.Len(t, envelope.Data, 1)
+
+	w = serveRequest(env, "GET", "/api/v2/users?cursor=0")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, CodeValidation, decodeError(t, w).Code)
+}
+
+func TestV2Deletes(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	seedVersionUsers(t, env)
+	env.db.Create(&models.Post{UserID: 1, Title: "Hello", Body: "World"})
+
+	w := serveRequest(env, "DELETE", "/api/v2/users/1/posts/1")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Empty(t, w.Body.String())
+
+	w = serveRequest(env, "DELETE", "/api/v2/users/2")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Empty(t, w.Body.String())
+	var count int64
+	env.db.Model(&models.User{}).Count(&count)
+	assert.Equal(t, int64(1), count)
+
+	w = serveRequest(env, "DELETE", "/api/v2/users/2")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, CodeUserNotFound, decodeError(t, w).Code)
+}
+
+func TestV2ErrorsAreCoded(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	seedVersionUsers(t, env)
+
+	w := serveRequest(env, "GET", "/api/v2/users/abc")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, CodeValidation, decodeError(t, w).Code)
+
+	w = serveRequest(env, "GET", "/api/v2/nothing-here")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	resp := decodeError(t, w)
+	assert.Equal(t, CodeNotFound, resp.Code)
+	assert.Equal(t, "No route matches GET /api/v2/nothing-here", resp.Message)
+}
+
+func TestV2SharesAccessRules(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	seedRoles(env)
+
+	w := sendWithAuth(newAuthTestRouter(env), "DELETE", "/api/v2/users/2", "", bearerFor("2"))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = sendWithAuth(newAuthTestRouter(env), "DELETE", "/api/v2/users/2", "", bearerFor("1"))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+}
+
+func TestRouteKey(t *testing.T) {
+	t.Parallel()
+	for version, prefix := range apiPrefixes {
+		r := gin.New()
+		var key string
+		var got int
+		r.GET(prefix+"/users/:id", useAPIVersion(version), func(c *gin.Context) {
+			key, got = routeKey(c), apiVersion(c)
+		})
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", prefix+"/users/1", nil))
+		assert.Equal(t, "/users/:id", key)
+		assert.Equal(t, version, got)
+	}
+}
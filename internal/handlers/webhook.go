@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"Unit-Test/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// WebhookRequest subscribes a URL to user events
+type WebhookRequest struct {
+	URL    string           `json:"url" binding:"required,http_url,max=2048" example:"https://example.com/hooks/users"`
+	Events models.EventMask `json:"events" binding:"required" swaggertype:"array,string" example:"user.created,user.deleted"`
+	// Enabled defaults to true on creation and is left as it is on update
+	Enabled *bool `json:"enabled"`
+}
+
+// Normalize trims the URL
+func (r *WebhookRequest) Normalize() {
+	r.URL = strings.TrimSpace(r.URL)
+}
+
+// CreatedWebhook is returned once when a webhook is created and carries the
+// secret its deliveries are signed with
+type CreatedWebhook struct {
+	models.Webhook
+	Secret string `json:"secret"`
+}
+
+// parseWebhookID reads the :id path parameter of the webhook routes
+func parseWebhookID(c *gin.Context) (int, error) {
+	id, err := parseUserID(c)
+	if err != nil {
+		return 0, validationError(err.Error())
+	}
+	return id, nil
+}
+
+// findWebhook loads the webhook with the :id of the route
+func (s *Server) findWebhook(c *gin.Context) (models.Webhook, error) {
+	id, err := parseWebhookID(c)
+	if err != nil {
+		return models.Webhook{}, err
+	}
+	var webhook models.Webhook
+	if err := s.dbFor(c).First(&webhook, id).Error; err != nil {
+		return models.Webhook{}, notFoundAs(err, CodeWebhookNotFound, "Webhook not found")
+	}
+	return webhook, nil
+}
+
+// List the webhooks
+// @Summary List webhooks
+// @Description Every webhook subscription, oldest first. Secrets are never returned. Admins only.
+// @Tags Webhooks
+// @Produce json
+// @Success 200 {array} models.Webhook
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Security BearerAuth
+// @Router /api/v1/webhooks [get]
+// @Router /api/v2/webhooks [get]
+func (s *Server) getWebhooks(c *gin.Context) error {
+	webhooks := []models.Webhook{}
+	if err := s.dbFor(c).Order("id").Find(&webhooks).Error; err != nil {
+		return err
+	}
+	c.JSON(200, webhooks)
+	return nil
+}
+
+// Fetch a single webhook
+// @Summary Get webhook
+// @Description Retrieve a webhook subscription by its ID. Admins only.
+// @Tags Webhooks
+// @Produce json
+// @Param id path int true "Webhook ID"
+// @Success 200 {object} models.Webhook
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Security BearerAuth
+// @Router /api/v1/webhooks/{id} [get]
+// @Router /api/v2/webhooks/{id} [get]
+func (s *Server) getWebhook(c *gin.Context) error {
+	webhook, err := s.findWebhook(c)
+	if err != nil {
+		return err
+	}
+	c.JSON(200, webhook)
+	return nil
+}
+
+// Subscribe a URL to user events
+// @Summary Create webhook
+// @Description Subscribe a URL to user.created, user.updated and user.deleted events. Each delivery is a JSON POST
+// @Description signed with the secret in X-Webhook-Signature (sha256=<hex HMAC-SHA256 of the body>); the secret is
+// @Description only returned in this response. Deliveries answered with anything but 2xx are retried with backoff. Admins only.
+// @Tags Webhooks
+// @Accept json
+// @Produce json
+// @Param webhook body WebhookRequest true "URL and events"
+// @Success 201 {object} CreatedWebhook
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Security BearerAuth
+// @Router /api/v1/webhooks [post]
+// @Router /api/v2/webhooks [post]
+func (s *Server) createWebhook(c *gin.Context) error {
+	var req WebhookRequest
+	if err := s.bindNormalized(c, &req); err != nil {
+		return invalidInput(err)
+	}
+
+	secret, err := newSecret()
+	if err != nil {
+		return err
+	}
+	webhook := models.Webhook{URL: req.URL, Events: req.Events, Enabled: req.Enabled == nil || *req.Enabled, Secret: secret}
+	if err := s.dbFor(c).Create(&webhook).Error; err != nil {
+		return err
+	}
+
+	c.JSON(http.StatusCreated, CreatedWebhook{Webhook: webhook, Secret: secret})
+	return nil
+}
+
+// Change a webhook
+// @Summary Update webhook
+// @Description Replace the URL and events of a webhook, and enable or disable it. The secret stays the same. Admins only.
+// @Tags Webhooks
+// @Accept json
+// @Produce json
+// @Param id path int true "Webhook ID"
+// @Param webhook body WebhookRequest true "URL and events"
+// @Success 200 {object} models.Webhook
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Security BearerAuth
+// @Router /api/v1/webhooks/{id} [put]
+// @Router /api/v2/webhooks/{id} [put]
+func (s *Server) updateWebhook(c *gin.Context) error {
+	webhook, err := s.findWebhook(c)
+	if err != nil {
+		return err
+	}
+	var req WebhookRequest
+	if err := s.bindNormalized(c, &req); err != nil {
+		return invalidInput(err)
+	}
+
+	webhook.URL, webhook.Events = req.URL, req.Events
+	if req.Enabled != nil {
+		webhook.Enabled = *req.Enabled
+	}
+	if err := s.dbFor(c).Save(&webhook).Error; err != nil {
+		return err
+	}
+
+	c.JSON(200, webhook)
+	return nil
+}
+
+// Remove a webhook
+// @Summary Delete webhook
+// @Description Delete a webhook subscription. Deliveries already queued are still sent. Admins only.
+// @Tags Webhooks
+// @Produce json
+// @Param id path int true "Webhook ID"
+// @Success 200 {object} map[string]string "Confirmation message in v1"
+// @Success 204 "No content in v2"
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Security BearerAuth
+// @Router /api/v1/webhooks/{id} [delete]
+// @Router /api/v2/webhooks/{id} [delete]
+func (s *Server) deleteWebhook(c *gin.Context) error {
+	id, err := parseWebhookID(c)
+	if err != nil {
+		return err
+	}
+
+	result := s.dbFor(c).Delete(&models.Webhook{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return newAPIError(http.StatusNotFound, CodeWebhookNotFound, "Webhook not found")
+	}
+
+	respondDeleted(c, "Webhook deleted")
+	return nil
+}
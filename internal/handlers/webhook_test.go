@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"Unit-Test/internal/models"
+	"Unit-Test/internal/webhooks"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookCRUD(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	w := send(env, "POST", "/api/v1/webhooks", `{"url":" https://example.com/hooks ","events":["user.created","user.deleted"]}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var created CreatedWebhook
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.Equal(t, "https://example.com/hooks", created.URL)
+	assert.True(t, created.Enabled)
+	assert.Equal(t, models.EventMaskUserCreated|models.EventMaskUserDeleted, created.Events)
+	assert.Len(t, created.Secret, 64)
+	base := fmt.Sprintf("/api/v1/webhooks/%d", created.ID)
+
+	// The secret is only shown on creation
+	w = send(env, "GET", "/api/v1/webhooks", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), created.Secret)
+	var listed []models.Webhook
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &listed))
+	assert.Len(t, listed, 1)
+
+	w = send(env, "PUT", base, `{"url":"https://example.com/v2/hooks","events":["user.updated"],"enabled":false}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = send(env, "GET", base, "")
+	assert.JSONEq(t, `["user.updated"]`, string(jsonField(t, w.Body.Bytes(), "events")))
+	var stored models.Webhook
+	require.NoError(t, env.db.First(&stored, created.ID).Error)
+	assert.Equal(t, "https://example.com/v2/hooks", stored.URL)
+	assert.False(t, stored.Enabled)
+	assert.Equal(t, created.Secret, stored.Secret, "updates keep the secret")
+
+	// Leaving enabled out keeps it as it is
+	w = send(env, "PUT", base, `{"url":"https://example.com/v2/hooks","events":["user.updated"]}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.NoError(t, env.db.First(&stored, created.ID).Error)
+	assert.False(t, stored.Enabled)
+
+	assert.Equal(t, http.StatusOK, send(env, "DELETE", base, "").Code)
+	for _, method := range []string{"GET", "DELETE"} {
+		w = send(env, method, base, "")
+		assert.Equal(t, http.StatusNotFound, w.Code, method)
+		assert.Contains(t, w.Body.String(), CodeWebhookNotFound, method)
+	}
+}
+
+// jsonField is one field of a JSON object, as it was sent
+func jsonField(t *testing.T, body []byte, field string) json.RawMessage {
+	var m map[string]json.RawMessage
+	require.NoError(t, json.Unmarshal(body, &m))
+	return m[field]
+}
+
+func TestWebhookValidation(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+
+	tests := []struct {
+		name, method, url, body string
+		status                  int
+		message                 string
+	}{
+		{"not http", "POST", "/api/v1/webhooks", `{"url":"ftp://example.com","events":["user.created"]}`, 400, "must be an http or https URL"},
+		{"no url", "POST", "/api/v1/webhooks", `{"events":["user.created"]}`, 400, "is required"},
+		{"no events", "POST", "/api/v1/webhooks", `{"url":"https://example.com","events":[]}`, 400, "is required"},
+		{"unknown event", "POST", "/api/v1/webhooks", `{"url":"https://example.com","events":["user.renamed"]}`, 400, "Invalid input"},
+		{"unknown field", "POST", "/api/v1/webhooks", `{"url":"https://example.com","events":["user.created"],"secret":"mine"}`, 400, "unknown field: secret"},
+		{"bad id", "GET", "/api/v1/webhooks/abc", "", 400, "id must be a positive integer"},
+		{"missing", "PUT", "/api/v1/webhooks/99", `{"url":"https://example.com","events":["user.created"]}`, 404, "Webhook not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := send(env, tt.method, tt.url, tt.body)
+			assert.Equal(t, tt.status, w.Code, w.Body.String())
+			assert.Contains(t, w.Body.String(), tt.message)
+		})
+	}
+}
+
+func TestWebhooksAreForAdmins(t *testing.T) {
+	t.Parallel()
+	env := newTestEnv(t)
+	seedRoles(env)
+	r := newAuthTestRouter(env)
+
+	for _, route := range []struct{ method, url string }{
+		{"GET", "/api/v1/webhooks"},
+		{"POST", "/api/v1/webhooks"},
+		{"GET", "/api/v1/webhooks/1"},
+		{"PUT", "/api/v1/webhooks/1"},
+		{"DELETE", "/api/v2/webhooks/1"},
+	} {
+		w := sendWithAuth(r, route.method, route.url, `{}`, bearerFor("2"))
+		assert.Equal(t, http.StatusForbidden, w.Code, route.method+" "+route.url)
+	}
+	assert.Equal(t, http.StatusOK, sendWithAuth(r, "GET", "/api/v1/webhooks", "", bearerFor("1")).Code)
+}
+
+func TestUserEventsAreDeliveredAfterCommit(t *testing.T) {
+	t.Parallel()
+	db := newTestDB(t)
+
+	type delivery struct {
+		event, signature string
+		body             []byte
+		// committed is whether the user could be read back when the delivery arrived
+		committed bool
+	}
+	arrived := make(chan delivery, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var payload webhooks.Payload
+		_ = json.Unmarshal(body, &payload)
+		var count int64
+		db.Unscoped().Model(&models.User{}).Where("id = ?", payload.UserID).Count(&count)
+		arrived <- delivery{event: r.Header.Get(webhooks.EventHeader), signature: r.Header.Get(webhooks.SignatureHeader), body: body, committed: count == 1}
+	}))
+	t.Cleanup(receiver.Close)
+
+	hooks := webhooks.NewDispatcher(db, webhooks.Options{Backoff: time.Millisecond})
+	t.Cleanup(func() { _ = hooks.Close(context.Background()) })
+	env := newTestEnvWith(t, Deps{DB: db, Events: hooks})
+
+	w := send(env, "POST", "/api/v1/webhooks", fmt.Sprintf(`{"url":%q,"events":["user.created","user.deleted"]}`, receiver.URL))
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var webhook CreatedWebhook
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &webhook))
+
+	require.Equal(t, http.StatusCreated, send(env, "POST", "/api/v1/users", `{"name":"Alice","email":"alice@example.com"}`).Code)
+	require.Equal(t, http.StatusOK, send(env, "PATCH", "/api/v1/users/1", `{"name":"Alicia","version":1}`).Code)
+	require.Equal(t, http.StatusOK, send(env, "DELETE", "/api/v1/users/1", "").Code)
+
+	// The update isn't subscribed to; the others may arrive in either order
+	var events []string
+	for len(events) < 2 {
+		select {
+		case got := <-arrived:
+			events = append(events, got.event)
+			assert.Equal(t, webhooks.Sign(webhook.Secret, got.body), got.signature)
+			assert.True(t, got.committed, "%s delivered before the change committed", got.event)
+			var payload webhooks.Payload
+			require.NoError(t, json.Unmarshal(got.body, &payload))
+			if assert.NotNil(t, payload.User, got.event) {
+				assert.Equal(t, "alice@example.com", payload.User.Email)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("only %v were delivered", events)
+		}
+	}
+	assert.ElementsMatch(t, []string{"user.created", "user.deleted"}, events)
+}
@@ -0,0 +1,237 @@
+// Package jobs runs work the requests shouldn't wait on, such as webhook
+// deliveries and emails, on a pool of workers in the background. A job that
+// fails is retried with exponential backoff until it succeeds, fails for good
+// or its attempts run out; closing a queue lets the queued jobs finish.
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Errors Enqueue returns for the jobs it can't take
+var (
+	ErrClosed = errors.New("jobs: queue closed")
+	ErrFull   = errors.New("jobs: queue full")
+)
+
+// Job is a piece of work a Queue runs
+type Job interface {
+	// Kind names the job in logs and metrics, such as "webhook.delivery"
+	Kind() string
+	// Run makes one attempt at the job, giving up when ctx is done. Errors
+	// made with Permanent are not retried.
+	Run(ctx context.Context) error
+}
+
+// permanentError is an error retrying won't fix
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as one retrying won't fix, so the job is given up on at once
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanentError{err}
+}
+
+var (
+	jobsQueued = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "jobs_queued",
+		Help: "Background jobs waiting for a worker.",
+	}, []string{"queue"})
+
+	jobsActive = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "jobs_active",
+		Help: "Background jobs being run or waiting to be retried.",
+	}, []string{"queue"})
+
+	jobsRetried = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "jobs_retried_total",
+		Help: "Failed attempts at background jobs that were retried.",
+	}, []string{"queue", "kind"})
+
+	jobsFailed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "jobs_failed_total",
+		Help: "Background jobs given up on.",
+	}, []string{"queue", "kind"})
+)
+
+// Collectors are the metrics of every queue; the API serves them on /metrics
+func Collectors() []prometheus.Collector {
+	return []prometheus.Collector{jobsQueued, jobsActive, jobsRetried, jobsFailed}
+}
+
+// Options tune a Queue; zero values take the defaults
+type Options struct {
+	// Name labels the queue's logs and metrics
+	Name string
+	// Workers is how many jobs run at once, 4 by default. A single worker
+	// runs the jobs one at a time, in the order they were queued.
+	Workers int
+	// QueueSize is how many jobs can wait for a worker before new ones are
+	// refused, 1000 by default
+	QueueSize int
+	// MaxAttempts is how often a job is tried, 5 by default
+	MaxAttempts int
+	// Backoff is the wait before the first retry, doubled for every retry
+	// after it; 1s by default
+	Backoff time.Duration
+}
+
+func (o *Options) setDefaults() {
+	if o.Name == "" {
+		o.Name = "default"
+	}
+	if o.Workers <= 0 {
+		o.Workers = 4
+	}
+	if o.QueueSize <= 0 {
+		o.QueueSize = 1000
+	}
+	if o.MaxAttempts <= 0 {
+		o.MaxAttempts = 5
+	}
+	if o.Backoff <= 0 {
+		o.Backoff = time.Second
+	}
+}
+
+// Queue runs the jobs given to it on its workers. A worker keeps a failed job
+// until it is retried, so the jobs of a queue with several workers can finish
+// out of order.
+type Queue struct {
+	opts Options
+
+	// mu guards closed and sending on jobs, which Close closes
+	mu     sync.RWMutex
+	closed bool
+	jobs   chan Job
+	// ctx is cancelled when Close gives up waiting, abandoning the jobs
+	ctx     context.Context
+	cancel  context.CancelFunc
+	workers sync.WaitGroup
+}
+
+// NewQueue starts the workers running the jobs given to the returned Queue
+func NewQueue(opts Options) *Queue {
+	opts.setDefaults()
+	ctx, cancel := context.WithCancel(context.Background())
+	q := &Queue{opts: opts, jobs: make(chan Job, opts.QueueSize), ctx: ctx, cancel: cancel}
+	q.workers.Add(opts.Workers)
+	for i := 0; i < opts.Workers; i++ {
+		go q.work()
+	}
+	return q
+}
+
+// Enqueue queues job without waiting for a worker. It returns ErrFull when
+// no more jobs can wait, and ErrClosed after Close.
+func (q *Queue) Enqueue(job Job) error {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.closed {
+		return ErrClosed
+	}
+	select {
+	case q.jobs <- job:
+		jobsQueued.WithLabelValues(q.opts.Name).Inc()
+		return nil
+	default:
+		return ErrFull
+	}
+}
+
+// Close stops taking jobs and waits for the queued ones, retries included,
+// until ctx is done. It abandons the jobs still running then, and drops the
+// ones still queued.
+func (q *Queue) Close(ctx context.Context) error {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.jobs)
+	}
+	q.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		q.workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		q.cancel()
+		return nil
+	case <-ctx.Done():
+		q.cancel()
+		<-done
+		return fmt.Errorf("jobs: %s queue abandoned: %w", q.opts.Name, ctx.Err())
+	}
+}
+
+// work runs the queued jobs until the queue is closed
+func (q *Queue) work() {
+	defer q.workers.Done()
+	for job := range q.jobs {
+		jobsQueued.WithLabelValues(q.opts.Name).Dec()
+		if q.ctx.Err() != nil {
+			q.logger(job).Error("job dropped on shutdown")
+			jobsFailed.WithLabelValues(q.opts.Name, job.Kind()).Inc()
+			continue
+		}
+		jobsActive.WithLabelValues(q.opts.Name).Inc()
+		q.run(job)
+		jobsActive.WithLabelValues(q.opts.Name).Dec()
+	}
+}
+
+// run tries job until it succeeds, fails for good, its attempts run out or
+// the queue gives up on it
+func (q *Queue) run(job Job) {
+	log := q.logger(job)
+	wait := q.opts.Backoff
+	for attempt := 1; ; attempt++ {
+		err := job.Run(q.ctx)
+		if err == nil {
+			log.Debug("job done", "attempt", attempt)
+			return
+		}
+		var permanent permanentError
+		if attempt == q.opts.MaxAttempts || errors.As(err, &permanent) {
+			log.Error("job failed", "attempts", attempt, "error", err.Error())
+			jobsFailed.WithLabelValues(q.opts.Name, job.Kind()).Inc()
+			return
+		}
+		log.Warn("job attempt failed", "attempt", attempt, "retry_in", wait.String(), "error", err.Error())
+		jobsRetried.WithLabelValues(q.opts.Name, job.Kind()).Inc()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-q.ctx.Done():
+			timer.Stop()
+			log.Error("job abandoned on shutdown", "attempts", attempt)
+			jobsFailed.WithLabelValues(q.opts.Name, job.Kind()).Inc()
+			return
+		}
+		wait *= 2
+	}
+}
+
+// logger logs about job, with what it tells about itself if it is a slog.LogValuer
+func (q *Queue) logger(job Job) *slog.Logger {
+	log := slog.With("queue", q.opts.Name, "kind", job.Kind())
+	if _, ok := job.(slog.LogValuer); ok {
+		log = log.With("job", job)
+	}
+	return log
+}
@@ -0,0 +1,247 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// flakyJob fails its first failures attempts, then succeeds
+type flakyJob struct {
+	failures int
+	err      error // what it fails with; a plain error by default
+	attempts atomic.Int32
+}
+
+func newFlakyJob(failures int) *flakyJob {
+	return &flakyJob{failures: failures}
+}
+
+func (j *flakyJob) Kind() string { return "test.flaky" }
+
+func (j *flakyJob) Run(context.Context) error {
+	if int(j.attempts.Add(1)) <= j.failures {
+		if j.err != nil {
+			return j.err
+		}
+		return errors.New("not yet")
+	}
+	return nil
+}
+
+// blockingJob runs until released or its context is done
+type blockingJob struct {
+	started, release chan struct{}
+	finished         atomic.Bool
+	cancelled        atomic.Bool
+}
+
+func newBlockingJob() *blockingJob {
+	return &blockingJob{started: make(chan struct{}), release: make(chan struct{})}
+}
+
+func (j *blockingJob) Kind() string { return "test.blocking" }
+
+func (j *blockingJob) Run(ctx context.Context) error {
+	close(j.started)
+	select {
+	case <-j.release:
+		j.finished.Store(true)
+		return nil
+	case <-ctx.Done():
+		j.cancelled.Store(true)
+		return ctx.Err()
+	}
+}
+
+// newTestQueue is a queue named after t, retrying at once, closed with t
+func newTestQueue(t *testing.T, opts Options) *Queue {
+	opts.Name = t.Name()
+	if opts.Backoff == 0 {
+		opts.Backoff = time.Millisecond
+	}
+	q := NewQueue(opts)
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_ = q.Close(ctx)
+	})
+	return q
+}
+
+// closeQueue drains q, failing t if that takes a second
+func closeQueue(t *testing.T, q *Queue) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, q.Close(ctx))
+}
+
+func TestJobsAreRetriedUntilTheySucceed(t *testing.T) {
+	t.Parallel()
+	q := newTestQueue(t, Options{MaxAttempts: 5})
+	retried, failed := jobsRetried.WithLabelValues(t.Name(), "test.flaky"), jobsFailed.WithLabelValues(t.Name(), "test.flaky")
+	retriedBefore, failedBefore := testutil.ToFloat64(retried), testutil.ToFloat64(failed)
+
+	jobs := []*flakyJob{newFlakyJob(0), newFlakyJob(1), newFlakyJob(4)}
+	for _, job := range jobs {
+		require.NoError(t, q.Enqueue(job))
+	}
+	closeQueue(t, q)
+
+	for i, job := range jobs {
+		assert.EqualValues(t, job.failures+1, job.attempts.Load(), "job %d", i)
+	}
+	assert.Equal(t, 5.0, testutil.ToFloat64(retried)-retriedBefore)
+	assert.Equal(t, failedBefore, testutil.ToFloat64(failed))
+}
+
+func TestJobsAreGivenUpOn(t *testing.T) {
+	t.Parallel()
+	q := newTestQueue(t, Options{MaxAttempts: 3})
+	retried, failed := jobsRetried.WithLabelValues(t.Name(), "test.flaky"), jobsFailed.WithLabelValues(t.Name(), "test.flaky")
+	retriedBefore, failedBefore := testutil.ToFloat64(retried), testutil.ToFloat64(failed)
+
+	exhausted := newFlakyJob(10)
+	permanent := newFlakyJob(10)
+	permanent.err = Permanent(errors.New("no such recipient"))
+	require.NoError(t, q.Enqueue(exhausted))
+	require.NoError(t, q.Enqueue(permanent))
+	closeQueue(t, q)
+
+	assert.EqualValues(t, 3, exhausted.attempts.Load())
+	assert.EqualValues(t, 1, permanent.attempts.Load(), "permanent errors aren't retried")
+	assert.Equal(t, 2.0, testutil.ToFloat64(retried)-retriedBefore)
+	assert.Equal(t, 2.0, testutil.ToFloat64(failed)-failedBefore)
+}
+
+func TestCloseDrainsTheQueue(t *testing.T) {
+	t.Parallel()
+	q := newTestQueue(t, Options{Workers: 1})
+
+	running := newBlockingJob()
+	queued := newFlakyJob(1)
+	require.NoError(t, q.Enqueue(running))
+	require.NoError(t, q.Enqueue(queued))
+	<-running.started
+	assert.Equal(t, 1.0, testutil.ToFloat64(jobsActive.WithLabelValues(t.Name())))
+	assert.Equal(t, 1.0, testutil.ToFloat64(jobsQueued.WithLabelValues(t.Name())))
+
+	closed := make(chan error)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		closed <- q.Close(ctx)
+	}()
+	// Close waits for the job in flight, and the one queued behind it
+	select {
+	case err := <-closed:
+		t.Fatalf("Close returned %v before the jobs finished", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	assert.ErrorIs(t, q.Enqueue(newFlakyJob(0)), ErrClosed)
+	close(running.release)
+	require.NoError(t, <-closed)
+
+	assert.True(t, running.finished.Load())
+	assert.EqualValues(t, 2, queued.attempts.Load())
+	assert.Zero(t, testutil.ToFloat64(jobsActive.WithLabelValues(t.Name())))
+	assert.Zero(t, testutil.ToFloat64(jobsQueued.WithLabelValues(t.Name())))
+}
+
+func TestCloseGivesUp(t *testing.T) {
+	t.Parallel()
+	q := newTestQueue(t, Options{Workers: 1, Backoff: time.Hour})
+
+	running := newBlockingJob()
+	retrying := newFlakyJob(1)
+	require.NoError(t, q.Enqueue(retrying))
+	require.NoError(t, q.Enqueue(running))
+	require.Eventually(t, func() bool { return retrying.attempts.Load() == 1 }, time.Second, time.Millisecond)
+	failedBefore := testutil.ToFloat64(jobsFailed.WithLabelValues(t.Name(), "test.flaky")) + testutil.ToFloat64(jobsFailed.WithLabelValues(t.Name(), "test.blocking"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, q.Close(ctx), context.DeadlineExceeded)
+	assert.EqualValues(t, 1, retrying.attempts.Load(), "the retry waited out the shutdown")
+	select {
+	case <-running.started:
+		t.Fatal("a queued job started after the shutdown")
+	default:
+	}
+	failed := testutil.ToFloat64(jobsFailed.WithLabelValues(t.Name(), "test.flaky")) + testutil.ToFloat64(jobsFailed.WithLabelValues(t.Name(), "test.blocking"))
+	assert.Equal(t, 2.0, failed-failedBefore, "the abandoned and the dropped job count as failed")
+}
+
+func TestCloseCancelsRunningJobs(t *testing.T) {
+	t.Parallel()
+	q := newTestQueue(t, Options{})
+
+	running := newBlockingJob()
+	require.NoError(t, q.Enqueue(running))
+	<-running.started
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, q.Close(ctx), context.DeadlineExceeded)
+	assert.True(t, running.cancelled.Load())
+}
+
+func TestEnqueueNeverWaits(t *testing.T) {
+	t.Parallel()
+	q := newTestQueue(t, Options{Workers: 1, QueueSize: 1})
+
+	running := newBlockingJob()
+	require.NoError(t, q.Enqueue(running))
+	<-running.started
+	require.NoError(t, q.Enqueue(newFlakyJob(0)))
+	assert.ErrorIs(t, q.Enqueue(newFlakyJob(0)), ErrFull)
+	close(running.release)
+}
+
+func TestWorkersRunConcurrently(t *testing.T) {
+	t.Parallel()
+	q := newTestQueue(t, Options{Workers: 3})
+
+	jobs := []*blockingJob{newBlockingJob(), newBlockingJob(), newBlockingJob()}
+	for _, job := range jobs {
+		require.NoError(t, q.Enqueue(job))
+	}
+	var wg sync.WaitGroup
+	for _, job := range jobs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-job.started
+		}()
+	}
+	started := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(started)
+	}()
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		t.Fatal("the jobs didn't all start at once")
+	}
+	for _, job := range jobs {
+		close(job.release)
+	}
+	closeQueue(t, q)
+}
+
+func TestPermanent(t *testing.T) {
+	t.Parallel()
+	cause := errors.New("refused")
+	err := Permanent(cause)
+	assert.ErrorIs(t, err, cause)
+	assert.EqualError(t, err, "refused")
+	assert.NoError(t, Permanent(nil))
+}
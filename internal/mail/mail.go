@@ -0,0 +1,319 @@
+// Package mail sends the notifications of the API as emails over SMTP. Each
+// email is rendered from a template in templates/, queued, and sent in the
+// background, retried with exponential backoff until the server accepts it,
+// refuses it for good or the attempts run out.
+package mail
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	netmail "net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"Unit-Test/internal/jobs"
+)
+
+// ErrClosed is returned for emails sent after Close
+var ErrClosed = jobs.ErrClosed
+
+// How the connection to the SMTP server is secured
+const (
+	// TLSStartTLS upgrades a plain connection, failing if the server can't
+	TLSStartTLS = "starttls"
+	// TLSImplicit connects over TLS from the start, as on port 465
+	TLSImplicit = "tls"
+	// TLSNone sends in plain text, for local test servers only
+	TLSNone = "none"
+)
+
+// Config locates the SMTP server and the sender
+type Config struct {
+	Host string
+	Port int
+	// Username and Password authenticate with PLAIN when Username is set
+	Username, Password string
+	// From is the sender's address, optionally with a name: "API <no-reply@example.com>"
+	From string
+	// TLS is TLSStartTLS, TLSImplicit or TLSNone; TLSStartTLS when empty
+	TLS string
+	// TLSConfig overrides the TLS settings, which otherwise verify the
+	// server's certificate against Host
+	TLSConfig *tls.Config
+}
+
+// Options tune a Notifier; zero values take the defaults
+type Options struct {
+	// MaxAttempts is how often an email is tried, 3 by default
+	MaxAttempts int
+	// Backoff is the wait before the first retry, doubled for every retry
+	// after it; 2s by default
+	Backoff time.Duration
+	// Timeout bounds each attempt, 30s by default
+	Timeout time.Duration
+	// QueueSize is how many emails can wait before new ones are dropped, 100
+	// by default
+	QueueSize int
+}
+
+func (o *Options) setDefaults() {
+	if o.MaxAttempts <= 0 {
+		o.MaxAttempts = 3
+	}
+	if o.Backoff <= 0 {
+		o.Backoff = 2 * time.Second
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = 30 * time.Second
+	}
+	if o.QueueSize <= 0 {
+		o.QueueSize = 100
+	}
+}
+
+//go:embed templates/*.tmpl
+var templateFiles embed.FS
+
+// templates holds each kind of email, by the name of its file in templates/
+var templates = map[string]*template.Template{
+	"welcome":            parseTemplate("welcome.tmpl"),
+	"password_reset":     parseTemplate("password_reset.tmpl"),
+	"email_verification": parseTemplate("email_verification.tmpl"),
+}
+
+func parseTemplate(name string) *template.Template {
+	return template.Must(template.ParseFS(templateFiles, "templates/"+name))
+}
+
+// templateData is what the templates are rendered with
+type templateData struct {
+	Email, Name, Token string
+}
+
+// message is one rendered email on its way to its recipient, a job of the
+// notifier's queue
+type message struct {
+	n        *Notifier
+	kind, to string
+	data     []byte
+}
+
+func (msg *message) Kind() string { return "mail." + msg.kind }
+
+// Run makes one attempt at sending msg. Refusals with a 5xx, such as an
+// unknown recipient, won't be fixed by retrying.
+func (msg *message) Run(ctx context.Context) error {
+	err := msg.n.send(ctx, msg)
+	var protoErr *textproto.Error
+	if errors.As(err, &protoErr) && protoErr.Code >= 500 {
+		return jobs.Permanent(err)
+	}
+	return err
+}
+
+func (msg *message) LogValue() slog.Value {
+	return slog.GroupValue(slog.String("to", msg.to))
+}
+
+// Notifier is a service.Notifier sending emails through an SMTP server. Its
+// methods only queue the email, so they return at once; how the sending goes
+// is logged.
+type Notifier struct {
+	cfg   Config
+	opts  Options
+	from  string // the address of cfg.From
+	queue *jobs.Queue
+}
+
+// NewNotifier starts sending the emails given to it through the server of cfg
+func NewNotifier(cfg Config, opts Options) (*Notifier, error) {
+	if cfg.Host == "" {
+		return nil, errors.New("mail: no SMTP host")
+	}
+	switch cfg.TLS {
+	case "":
+		cfg.TLS = TLSStartTLS
+	case TLSStartTLS, TLSImplicit, TLSNone:
+	default:
+		return nil, fmt.Errorf("mail: unknown TLS mode %q", cfg.TLS)
+	}
+	from, err := netmail.ParseAddress(cfg.From)
+	if err != nil {
+		return nil, fmt.Errorf("mail: invalid sender %q: %w", cfg.From, err)
+	}
+	opts.setDefaults()
+	// One worker, so a struggling server isn't hit with several retries at once
+	queue := jobs.NewQueue(jobs.Options{Name: "mail", Workers: 1, QueueSize: opts.QueueSize, MaxAttempts: opts.MaxAttempts, Backoff: opts.Backoff})
+	return &Notifier{cfg: cfg, opts: opts, from: from.Address, queue: queue}, nil
+}
+
+func (n *Notifier) SendUserWelcome(email, name string) error {
+	return n.enqueue("welcome", email, templateData{Email: email, Name: name})
+}
+
+func (n *Notifier) SendPasswordReset(email, token string) error {
+	return n.enqueue("password_reset", email, templateData{Email: email, Token: token})
+}
+
+func (n *Notifier) SendEmailVerification(email, token string) error {
+	return n.enqueue("email_verification", email, templateData{Email: email, Token: token})
+}
+
+// enqueue renders the email of kind for to and queues it, failing only when
+// it can't be rendered or the queue is full or closed
+func (n *Notifier) enqueue(kind, to string, data templateData) error {
+	body, err := n.render(kind, to, data)
+	if err != nil {
+		return err
+	}
+	err = n.queue.Enqueue(&message{n: n, kind: kind, to: to, data: body})
+	if errors.Is(err, jobs.ErrFull) {
+		return fmt.Errorf("mail: dropped %s to %s: %w", kind, to, err)
+	}
+	return err
+}
+
+// headerText keeps a value on one header line, whatever it was given
+var headerText = strings.NewReplacer("\r", "", "\n", " ")
+
+// render builds the whole email of kind to to: its headers and its body in
+// quoted-printable UTF-8
+func (n *Notifier) render(kind, to string, data templateData) ([]byte, error) {
+	tmpl := templates[kind]
+	data.Name = headerText.Replace(data.Name)
+	var subject, body bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return nil, fmt.Errorf("mail: rendering %s: %w", kind, err)
+	}
+	if err := tmpl.ExecuteTemplate(&body, "body", data); err != nil {
+		return nil, fmt.Errorf("mail: rendering %s: %w", kind, err)
+	}
+	id, err := messageID(n.cfg.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	var msg bytes.Buffer
+	header := func(name, value string) {
+		fmt.Fprintf(&msg, "%s: %s\r\n", name, value)
+	}
+	header("From", n.cfg.From)
+	header("To", to)
+	header("Subject", mime.QEncoding.Encode("utf-8", headerText.Replace(subject.String())))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("Message-ID", id)
+	header("MIME-Version", "1.0")
+	header("Content-Type", "text/plain; charset=utf-8")
+	header("Content-Transfer-Encoding", "quoted-printable")
+	msg.WriteString("\r\n")
+	qp := quotedprintable.NewWriter(&msg)
+	if _, err := qp.Write(bytes.ReplaceAll(body.Bytes(), []byte("\n"), []byte("\r\n"))); err != nil {
+		return nil, err
+	}
+	if err := qp.Close(); err != nil {
+		return nil, err
+	}
+	return msg.Bytes(), nil
+}
+
+// messageID is a new Message-ID header value for a server at host
+func messageID(host string) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "<" + hex.EncodeToString(b) + "@" + host + ">", nil
+}
+
+// Close stops taking emails and waits for the queued ones, retries included,
+// until ctx is done. Emails still queued then are dropped.
+func (n *Notifier) Close(ctx context.Context) error {
+	if err := n.queue.Close(ctx); err != nil {
+		return fmt.Errorf("mail: emails not sent: %w", err)
+	}
+	return nil
+}
+
+// send makes one attempt at msg, over a connection of its own
+func (n *Notifier) send(ctx context.Context, msg *message) error {
+	addr := net.JoinHostPort(n.cfg.Host, strconv.Itoa(n.cfg.Port))
+	dialer := &net.Dialer{Timeout: n.opts.Timeout}
+	var conn net.Conn
+	var err error
+	if n.cfg.TLS == TLSImplicit {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: n.tlsConfig()}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	if err := conn.SetDeadline(time.Now().Add(n.opts.Timeout)); err != nil {
+		conn.Close()
+		return err
+	}
+	client, err := smtp.NewClient(conn, n.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if n.cfg.TLS == TLSStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return errors.New("server doesn't offer STARTTLS")
+		}
+		if err := client.StartTLS(n.tlsConfig()); err != nil {
+			return err
+		}
+	}
+	if n.cfg.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", n.cfg.Username, n.cfg.Password, n.cfg.Host)); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(n.from); err != nil {
+		return err
+	}
+	if err := client.Rcpt(msg.to); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg.data); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// tlsConfig is cfg.TLSConfig, or the defaults, checking the certificate
+// against Host unless told another name
+func (n *Notifier) tlsConfig() *tls.Config {
+	if n.cfg.TLSConfig == nil {
+		return &tls.Config{ServerName: n.cfg.Host, MinVersion: tls.VersionTLS12}
+	}
+	cfg := n.cfg.TLSConfig.Clone()
+	if cfg.ServerName == "" {
+		cfg.ServerName = n.cfg.Host
+	}
+	return cfg
+}
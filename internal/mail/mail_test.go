@@ -0,0 +1,369 @@
+package mail
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"io"
+	"math/big"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	netmail "net/mail"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// delivered is an email as the SMTP server took it
+type delivered struct {
+	from, to string
+	auth     string // the decoded AUTH PLAIN response, if any
+	tls      bool
+	msg      *netmail.Message
+	body     string
+}
+
+// smtpServer is an SMTP server on the loopback interface, just enough for
+// net/smtp. Its first failures connections are turned away with a 421, and
+// every recipient is refused with rcptReply when it is set.
+type smtpServer struct {
+	ln        net.Listener
+	tlsConfig *tls.Config // offers STARTTLS when set
+	failures  int
+	rcptReply string
+
+	mu       sync.Mutex
+	attempts int
+	got      []delivered
+	arrived  chan struct{}
+}
+
+func newSMTPServer(t *testing.T, configure func(*smtpServer)) *smtpServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := &smtpServer{ln: ln, arrived: make(chan struct{}, 100)}
+	if configure != nil {
+		configure(s)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+// config points a Notifier at s
+func (s *smtpServer) config(tlsMode string) Config {
+	host, port, _ := net.SplitHostPort(s.ln.Addr().String())
+	p, _ := strconv.Atoi(port)
+	return Config{Host: host, Port: p, From: "API <no-reply@example.com>", TLS: tlsMode}
+}
+
+func (s *smtpServer) serve(conn net.Conn) {
+	defer func() { conn.Close() }()
+	s.mu.Lock()
+	s.attempts++
+	turnAway := s.attempts <= s.failures
+	s.mu.Unlock()
+
+	text := textproto.NewConn(conn)
+	if turnAway {
+		text.PrintfLine("421 busy, try again later")
+		return
+	}
+	text.PrintfLine("220 localhost ESMTP")
+	var mail delivered
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			text.PrintfLine("250-localhost")
+			if s.tlsConfig != nil && !mail.tls {
+				text.PrintfLine("250-STARTTLS")
+			}
+			text.PrintfLine("250 AUTH PLAIN")
+		case "STARTTLS":
+			text.PrintfLine("220 ready")
+			tlsConn := tls.Server(conn, s.tlsConfig)
+			if tlsConn.Handshake() != nil {
+				return
+			}
+			conn, text = tlsConn, textproto.NewConn(tlsConn)
+			mail = delivered{tls: true}
+		case "AUTH":
+			resp, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(arg, "PLAIN "))
+			mail.auth = string(resp)
+			text.PrintfLine("235 authenticated")
+		case "MAIL":
+			mail.from = strings.Trim(strings.TrimPrefix(arg, "FROM:"), "<>")
+			text.PrintfLine("250 ok")
+		case "RCPT":
+			if s.rcptReply != "" {
+				text.PrintfLine(s.rcptReply)
+				continue
+			}
+			mail.to = strings.Trim(strings.TrimPrefix(arg, "TO:"), "<>")
+			text.PrintfLine("250 ok")
+		case "DATA":
+			text.PrintfLine("354 go ahead")
+			data, err := io.ReadAll(text.DotReader())
+			if err != nil {
+				return
+			}
+			mail.msg, err = netmail.ReadMessage(strings.NewReader(string(data)))
+			if err != nil {
+				text.PrintfLine("554 unreadable")
+				continue
+			}
+			body, _ := io.ReadAll(quotedprintable.NewReader(mail.msg.Body))
+			mail.body = string(body)
+			s.mu.Lock()
+			s.got = append(s.got, mail)
+			s.mu.Unlock()
+			text.PrintfLine("250 queued")
+			s.arrived <- struct{}{}
+		case "QUIT":
+			text.PrintfLine("221 bye")
+			return
+		default:
+			text.PrintfLine("502 not implemented")
+		}
+	}
+}
+
+// wait blocks until an email has arrived
+func (s *smtpServer) wait(t *testing.T) delivered {
+	t.Helper()
+	select {
+	case <-s.arrived:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no email arrived")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.got[len(s.got)-1]
+}
+
+func (s *smtpServer) stats() (attempts, delivered int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.attempts, len(s.got)
+}
+
+// newTestNotifier is a Notifier for cfg retrying at once, closed with t
+func newTestNotifier(t *testing.T, cfg Config, opts Options) *Notifier {
+	t.Helper()
+	if opts.Backoff == 0 {
+		opts.Backoff = time.Millisecond
+	}
+	opts.Timeout = 5 * time.Second
+	n, err := NewNotifier(cfg, opts)
+	require.NoError(t, err)
+	t.Cleanup(func() { n.Close(context.Background()) })
+	return n
+}
+
+// closeNotifier waits for n to finish its queue
+func closeNotifier(t *testing.T, n *Notifier) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, n.Close(ctx))
+}
+
+// selfSignedTLS is a server certificate for 127.0.0.1 and the pool trusting it
+func selfSignedTLS(t *testing.T) (*tls.Config, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}, pool
+}
+
+func TestNotifierSendsTheTemplates(t *testing.T) {
+	t.Parallel()
+	server := newSMTPServer(t, nil)
+	n := newTestNotifier(t, server.config(TLSNone), Options{})
+
+	require.NoError(t, n.SendUserWelcome("alice@example.com", "Alice Ünal"))
+	got := server.wait(t)
+	assert.Equal(t, "no-reply@example.com", got.from)
+	assert.Equal(t, "alice@example.com", got.to)
+	assert.Equal(t, "API <no-reply@example.com>", got.msg.Header.Get("From"))
+	assert.Equal(t, "alice@example.com", got.msg.Header.Get("To"))
+	subject, err := new(mime.WordDecoder).DecodeHeader(got.msg.Header.Get("Subject"))
+	require.NoError(t, err)
+	assert.Equal(t, "Welcome, Alice Ünal", subject)
+	assert.Equal(t, "text/plain; charset=utf-8", got.msg.Header.Get("Content-Type"))
+	assert.NotEmpty(t, got.msg.Header.Get("Message-ID"))
+	_, err = got.msg.Header.Date()
+	assert.NoError(t, err)
+	assert.Contains(t, got.body, "Hi Alice Ünal,\n")
+
+	require.NoError(t, n.SendPasswordReset("bob@example.com", "reset-token"))
+	got = server.wait(t)
+	assert.Equal(t, "Reset your password", got.msg.Header.Get("Subject"))
+	assert.Contains(t, got.body, "    reset-token\n")
+
+	require.NoError(t, n.SendEmailVerification("carol@example.com", "verify-token"))
+	got = server.wait(t)
+	assert.Equal(t, "Confirm your email address", got.msg.Header.Get("Subject"))
+	assert.Contains(t, got.body, "carol@example.com is your address")
+	assert.Contains(t, got.body, "    verify-token\n")
+}
+
+func TestNotifierKeepsNamesOutOfTheHeaders(t *testing.T) {
+	t.Parallel()
+	server := newSMTPServer(t, nil)
+	n := newTestNotifier(t, server.config(TLSNone), Options{})
+
+	require.NoError(t, n.SendUserWelcome("alice@example.com", "Alice\r\nBcc: eve@example.com"))
+	got := server.wait(t)
+	assert.Empty(t, got.msg.Header.Get("Bcc"))
+	assert.Equal(t, "Welcome, Alice Bcc: eve@example.com", got.msg.Header.Get("Subject"))
+}
+
+func TestNotifierStartTLSAndAuth(t *testing.T) {
+	t.Parallel()
+	serverTLS, roots := selfSignedTLS(t)
+	server := newSMTPServer(t, func(s *smtpServer) { s.tlsConfig = serverTLS })
+	cfg := server.config(TLSStartTLS)
+	cfg.Username, cfg.Password = "api", "s3cret"
+	cfg.TLSConfig = &tls.Config{RootCAs: roots}
+	n := newTestNotifier(t, cfg, Options{})
+
+	require.NoError(t, n.SendPasswordReset("alice@example.com", "token"))
+	got := server.wait(t)
+	assert.True(t, got.tls, "sent before STARTTLS")
+	assert.Equal(t, "\x00api\x00s3cret", got.auth)
+}
+
+func TestNotifierRequiresStartTLS(t *testing.T) {
+	t.Parallel()
+	server := newSMTPServer(t, nil)
+	n := newTestNotifier(t, server.config(TLSStartTLS), Options{MaxAttempts: 2})
+
+	require.NoError(t, n.SendPasswordReset("alice@example.com", "token"))
+	closeNotifier(t, n)
+	attempts, delivered := server.stats()
+	assert.Equal(t, 2, attempts)
+	assert.Zero(t, delivered, "the token went out in plain text")
+}
+
+func TestNotifierRetries(t *testing.T) {
+	t.Parallel()
+
+	t.Run("until the server takes it", func(t *testing.T) {
+		t.Parallel()
+		server := newSMTPServer(t, func(s *smtpServer) { s.failures = 2 })
+		n := newTestNotifier(t, server.config(TLSNone), Options{MaxAttempts: 3})
+		require.NoError(t, n.SendUserWelcome("alice@example.com", "Alice"))
+		server.wait(t)
+		attempts, _ := server.stats()
+		assert.Equal(t, 3, attempts)
+	})
+
+	t.Run("until the attempts run out", func(t *testing.T) {
+		t.Parallel()
+		server := newSMTPServer(t, func(s *smtpServer) { s.failures = 10 })
+		n := newTestNotifier(t, server.config(TLSNone), Options{MaxAttempts: 3})
+		require.NoError(t, n.SendUserWelcome("alice@example.com", "Alice"))
+		closeNotifier(t, n)
+		attempts, delivered := server.stats()
+		assert.Equal(t, 3, attempts)
+		assert.Zero(t, delivered)
+	})
+
+	t.Run("not when refused for good", func(t *testing.T) {
+		t.Parallel()
+		server := newSMTPServer(t, func(s *smtpServer) { s.rcptReply = "550 no such user" })
+		n := newTestNotifier(t, server.config(TLSNone), Options{MaxAttempts: 3})
+		require.NoError(t, n.SendUserWelcome("nobody@example.com", "Nobody"))
+		closeNotifier(t, n)
+		attempts, _ := server.stats()
+		assert.Equal(t, 1, attempts)
+	})
+}
+
+func TestNotifierNeverBlocksTheSender(t *testing.T) {
+	t.Parallel()
+	server := newSMTPServer(t, func(s *smtpServer) { s.failures = 10 })
+	n := newTestNotifier(t, server.config(TLSNone), Options{Backoff: time.Hour, QueueSize: 1})
+
+	start := time.Now()
+	require.NoError(t, n.SendUserWelcome("alice@example.com", "Alice"))
+	// The first is being retried, the second waits in the queue, the third has no room
+	require.Eventually(t, func() bool { attempts, _ := server.stats(); return attempts == 1 }, time.Second, time.Millisecond)
+	require.NoError(t, n.SendUserWelcome("bob@example.com", "Bob"))
+	assert.ErrorContains(t, n.SendUserWelcome("carol@example.com", "Carol"), "queue full")
+	assert.Less(t, time.Since(start), time.Second)
+
+	// Closing gives up on the retry rather than waiting an hour
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, n.Close(ctx), context.DeadlineExceeded)
+	attempts, _ := server.stats()
+	assert.Equal(t, 1, attempts, "bob's email was sent after the shutdown")
+	assert.ErrorIs(t, n.SendPasswordReset("alice@example.com", "token"), ErrClosed)
+}
+
+func TestNewNotifierValidates(t *testing.T) {
+	t.Parallel()
+	_, err := NewNotifier(Config{From: "no-reply@example.com"}, Options{})
+	assert.ErrorContains(t, err, "no SMTP host")
+	_, err = NewNotifier(Config{Host: "smtp.example.com", From: "no-reply@example.com", TLS: "ssl"}, Options{})
+	assert.ErrorContains(t, err, `unknown TLS mode "ssl"`)
+	_, err = NewNotifier(Config{Host: "smtp.example.com", From: "not an address"}, Options{})
+	assert.ErrorContains(t, err, "invalid sender")
+}
+
+// Scanning the raw message guards against the parser hiding a broken header
+func TestRenderedHeadersEndInCRLF(t *testing.T) {
+	t.Parallel()
+	n := &Notifier{cfg: Config{Host: "smtp.example.com", From: "no-reply@example.com"}}
+	data, err := n.render("password_reset", "alice@example.com", templateData{Email: "alice@example.com", Token: "t"})
+	require.NoError(t, err)
+	header, _, found := strings.Cut(string(data), "\r\n\r\n")
+	require.True(t, found)
+	scanner := bufio.NewScanner(strings.NewReader(header))
+	for scanner.Scan() {
+		assert.Contains(t, scanner.Text(), ": ")
+	}
+	assert.NotContains(t, strings.ReplaceAll(header, "\r\n", ""), "\n")
+}
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Address represents a mailing address belonging to a user
+type Address struct {
+	ID         int            `json:"id" gorm:"primaryKey;autoIncrement"`
+	UserID     int            `json:"user_id" gorm:"not null;index"`
+	User       *User          `json:"-" gorm:"constraint:OnDelete:CASCADE"`
+	Street     string         `json:"street" gorm:"type:varchar(200);not null" binding:"required,max=200"`
+	City       string         `json:"city" gorm:"type:varchar(100);not null" binding:"required,max=100"`
+	Country    string         `json:"country" gorm:"type:varchar(100);not null" binding:"required,max=100"`
+	PostalCode string         `json:"postal_code" gorm:"type:varchar(20)" binding:"max=20"`
+	CreatedAt  time.Time      `json:"created_at"`
+	UpdatedAt  time.Time      `json:"updated_at"`
+	DeletedAt  gorm.DeletedAt `json:"-" gorm:"index"`
+}
@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+)
+
+// APIKey is a long-lived credential for server-to-server callers. Only the
+// SHA-256 of the key is stored; the key itself is shown once, on creation.
+type APIKey struct {
+	ID         int        `json:"id" gorm:"primaryKey;autoIncrement"`
+	UserID     int        `json:"user_id" gorm:"not null;index"`
+	User       *User      `json:"-" gorm:"constraint:OnDelete:CASCADE"`
+	KeyHash    string     `json:"-" gorm:"type:char(64);not null;uniqueIndex"`
+	Label      string     `json:"label" gorm:"type:varchar(100);not null" binding:"required,max=100"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
@@ -0,0 +1,95 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// Actions recorded in the audit log
+const (
+	AuditCreate  = "create"
+	AuditUpdate  = "update"
+	AuditDelete  = "delete"
+	AuditRestore = "restore"
+)
+
+// AuditLog records one change to a user: who made it, and the user as the API
+// showed it before and after. Before is null for creates and restores, after for deletes.
+type AuditLog struct {
+	ID        int       `json:"id" gorm:"primaryKey;autoIncrement"`
+	Actor     string    `json:"actor" gorm:"type:varchar(100);not null"`
+	Action    string    `json:"action" gorm:"type:varchar(20);not null"`
+	UserID    int       `json:"user_id" gorm:"not null;index"`
+	Before    Snapshot  `json:"before" swaggertype:"object"`
+	After     Snapshot  `json:"after" swaggertype:"object"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Snapshot is a JSON document stored verbatim, or null
+type Snapshot json.RawMessage
+
+// SnapshotOf captures user as the API renders it; a nil user gives an empty snapshot
+func SnapshotOf(user *User) Snapshot {
+	if user == nil {
+		return nil
+	}
+	data, err := json.Marshal(user)
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+// GormDBDataType stores snapshots as jsonb on Postgres and as text elsewhere
+func (Snapshot) GormDBDataType(db *gorm.DB, field *schema.Field) string {
+	if db.Dialector.Name() == "postgres" {
+		return "jsonb"
+	}
+	return "text"
+}
+
+// Value stores an empty snapshot as NULL
+func (s Snapshot) Value() (driver.Value, error) {
+	if len(s) == 0 {
+		return nil, nil
+	}
+	return string(s), nil
+}
+
+// Scan reads a snapshot stored as JSON text or jsonb
+func (s *Snapshot) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*s = nil
+	case []byte:
+		*s = append(Snapshot(nil), v...)
+	case string:
+		*s = Snapshot(v)
+	default:
+		return errors.New("unsupported snapshot value")
+	}
+	return nil
+}
+
+// MarshalJSON writes the snapshot as is, and an empty one as null
+func (s Snapshot) MarshalJSON() ([]byte, error) {
+	if len(s) == 0 {
+		return []byte("null"), nil
+	}
+	return s, nil
+}
+
+// UnmarshalJSON keeps the document as is, and null as an empty snapshot
+func (s *Snapshot) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*s = nil
+		return nil
+	}
+	*s = append(Snapshot(nil), data...)
+	return nil
+}
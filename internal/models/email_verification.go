@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+)
+
+// EmailVerification is a single-use token proving control of a user's email.
+// Only its SHA-256 is stored; the token itself goes to the user through the notifier.
+type EmailVerification struct {
+	ID        int       `gorm:"primaryKey;autoIncrement"`
+	UserID    int       `gorm:"not null;index"`
+	User      *User     `gorm:"constraint:OnDelete:CASCADE"`
+	TokenHash string    `gorm:"type:char(64);not null;uniqueIndex"`
+	ExpiresAt time.Time `gorm:"not null"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
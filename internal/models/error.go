@@ -0,0 +1,19 @@
+package models
+
+import "encoding/xml"
+
+// FieldError describes a validation rule a request field failed
+type FieldError struct {
+	Field string `json:"field" xml:"field"`
+	Error string `json:"error" xml:"error"`
+}
+
+// ErrorResponse is the body of every failed request. Code is a stable,
+// machine-readable identifier such as NOT_FOUND; RequestID echoes the request's id so it can be found in the logs.
+type ErrorResponse struct {
+	XMLName   xml.Name     `json:"-" xml:"error"`
+	Code      string       `json:"code" xml:"code"`
+	Message   string       `json:"message" xml:"message"`
+	RequestID string       `json:"request_id,omitempty" xml:"request_id,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty" xml:"errors>error,omitempty"`
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"encoding/xml"
+	"time"
+)
+
+// Post represents an article written by a user
+type Post struct {
+	ID        int       `json:"id" xml:"id" gorm:"primaryKey;autoIncrement"`
+	UserID    int       `json:"user_id" xml:"user_id" gorm:"not null;index"`
+	Title     string    `json:"title" xml:"title" gorm:"type:varchar(200);not null" binding:"required,max=200"`
+	Body      string    `json:"body" xml:"body" gorm:"type:text;not null" binding:"required"`
+	CreatedAt time.Time `json:"created_at" xml:"created_at"`
+}
+
+// UserWithPosts is a user rendered together with its posts for ?include=posts.
+// Posts is never nil so a user without posts renders an empty array.
+type UserWithPosts struct {
+	User
+	Posts []Post `json:"posts" xml:"posts>post"`
+}
+
+// UserWithPostsList wraps users with their posts for XML responses
+type UserWithPostsList struct {
+	XMLName xml.Name        `xml:"users"`
+	Users   []UserWithPosts `xml:"user"`
+}
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// Preferences holds arbitrary UI settings of a user as a JSON object
+type Preferences map[string]json.RawMessage
+
+// GormDataType tells GORM the map is a column value rather than an association
+func (Preferences) GormDataType() string {
+	return "json"
+}
+
+// GormDBDataType stores preferences as jsonb on Postgres and as text elsewhere
+func (Preferences) GormDBDataType(db *gorm.DB, field *schema.Field) string {
+	if db.Dialector.Name() == "postgres" {
+		return "jsonb"
+	}
+	return "text"
+}
+
+// Value serializes the preferences for the database; no preferences are stored as NULL
+func (p Preferences) Value() (driver.Value, error) {
+	if p == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(p)
+	return string(data), err
+}
+
+// Scan reads preferences stored as JSON text or jsonb
+func (p *Preferences) Scan(value interface{}) error {
+	var data []byte
+	switch v := value.(type) {
+	case nil:
+		*p = nil
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return errors.New("unsupported preferences value")
+	}
+	return json.Unmarshal(data, p)
+}
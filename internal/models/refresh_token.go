@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+)
+
+// RefreshToken is an opaque, single-use token that buys a new access token.
+// Each use revokes it and issues a successor in the same family, so presenting
+// an already revoked token means it leaked and the whole family is revoked.
+type RefreshToken struct {
+	ID        int       `gorm:"primaryKey;autoIncrement"`
+	UserID    int       `gorm:"not null;index"`
+	User      *User     `gorm:"constraint:OnDelete:CASCADE"`
+	TokenHash string    `gorm:"type:char(64);not null;uniqueIndex"`
+	FamilyID  string    `gorm:"type:char(64);not null;index"`
+	ExpiresAt time.Time `gorm:"not null"`
+	RevokedAt *time.Time
+	CreatedAt time.Time
+}
@@ -0,0 +1,11 @@
+package models
+
+import (
+	"time"
+)
+
+// SchemaMigration records a schema version the database has been migrated to
+type SchemaMigration struct {
+	Version   int `gorm:"primaryKey;autoIncrement:false"`
+	AppliedAt time.Time
+}
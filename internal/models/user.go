@@ -0,0 +1,103 @@
+// Package models holds the types stored in the database and the error body the
+// API answers with
+package models
+
+import (
+	"encoding/xml"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// User is an account of the API, stored in the users table
+type User struct {
+	XMLName         xml.Name       `json:"-" xml:"user" gorm:"-"`
+	ID              int            `json:"id" xml:"id" gorm:"primaryKey;autoIncrement"`
+	Name            string         `json:"name" xml:"name,omitempty" gorm:"type:varchar(100);not null" binding:"required,max=100"`
+	Email           string         `json:"email" xml:"email,omitempty" gorm:"type:varchar(100);uniqueIndex:idx_users_email_lower_active,expression:LOWER(email),where:deleted_at IS NULL;not null" binding:"required,email,max=100"`
+	CreatedAt       time.Time      `json:"created_at" xml:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at" xml:"updated_at"`
+	DeletedAt       gorm.DeletedAt `json:"-" xml:"-" gorm:"index"`
+	Version         int            `json:"version" xml:"version" gorm:"not null;default:1"`
+	AvatarPath      string         `json:"-" xml:"-" gorm:"type:varchar(255)"`
+	Role            string         `json:"role" xml:"role,omitempty" gorm:"type:varchar(20);not null;default:member" binding:"omitempty,oneof=admin member viewer"`
+	Phone           string         `json:"phone,omitempty" xml:"phone,omitempty" gorm:"type:varchar(20)" binding:"omitempty,phone"`
+	EmailVerifiedAt *time.Time     `json:"email_verified_at" xml:"email_verified_at,omitempty"`
+	Posts           []Post         `json:"-" xml:"-" gorm:"constraint:OnDelete:CASCADE"`
+	Preferences     Preferences    `json:"-" xml:"-"`
+	PasswordHash    string         `json:"-" xml:"-" gorm:"type:varchar(255)"`
+}
+
+// Roles a user can hold; new users are members unless told otherwise
+const (
+	RoleAdmin  = "admin"
+	RoleMember = "member"
+	RoleViewer = "viewer"
+)
+
+// BeforeSave makes sure users are stored normalized, however they were created
+func (u *User) BeforeSave(tx *gorm.DB) error {
+	u.Normalize()
+	return nil
+}
+
+// Normalize trims the user's name and email, lowercases the email and
+// puts the phone number in E.164 form
+func (u *User) Normalize() {
+	u.Name = NormalizeName(u.Name)
+	u.Email = NormalizeEmail(u.Email)
+	u.Phone = NormalizePhone(u.Phone)
+}
+
+// BeforeCreate ignores any timestamps supplied by the client
+func (u *User) BeforeCreate(tx *gorm.DB) error {
+	now := tx.NowFunc()
+	u.CreatedAt = now
+	u.UpdatedAt = now
+	u.EmailVerifiedAt = nil
+	u.Version = 1
+	if u.Role == "" {
+		u.Role = RoleMember
+	}
+	return nil
+}
+
+// UserList wraps a list of users so it forms a single XML document
+type UserList struct {
+	XMLName xml.Name `xml:"users"`
+	Users   []User   `xml:"user"`
+}
+
+// UserWithDeleted is the admin view of a user, including when it was soft-deleted
+type UserWithDeleted struct {
+	User
+	DeletedAt *time.Time `json:"deleted_at" xml:"deleted_at,omitempty"`
+}
+
+// UserWithDeletedList wraps the admin view of the users list for XML responses
+type UserWithDeletedList struct {
+	XMLName xml.Name          `xml:"users"`
+	Users   []UserWithDeleted `xml:"user"`
+}
+
+// NormalizeName trims a name and collapses runs of whitespace inside it to single spaces
+func NormalizeName(name string) string {
+	return strings.Join(strings.Fields(name), " ")
+}
+
+// NormalizeEmail trims and lowercases an email; addresses are unique regardless of case
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// NormalizePhone strips the spaces, dashes, dots and parentheses people type in phone numbers
+func NormalizePhone(phone string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '-', '.', '(', ')':
+			return -1
+		}
+		return r
+	}, phone)
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserNormalize(t *testing.T) {
+	user := User{Name: "  Ada \t Lovelace ", Email: " Ada@Example.COM ", Phone: "+44 (20) 7946-0958"}
+	user.Normalize()
+
+	assert.Equal(t, "Ada Lovelace", user.Name)
+	assert.Equal(t, "ada@example.com", user.Email)
+	assert.Equal(t, "+442079460958", user.Phone)
+}
+
+func TestSnapshotJSON(t *testing.T) {
+	var log AuditLog
+	assert.NoError(t, json.Unmarshal([]byte(`{"before":null,"after":{"id":1}}`), &log))
+	assert.Nil(t, log.Before)
+
+	data, err := json.Marshal(log)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `"before":null,"after":{"id":1}`)
+}
@@ -0,0 +1,84 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// EventMask is the set of user events a webhook is sent, one bit per event.
+// It is stored as an integer and written in JSON as the list of event names.
+type EventMask int
+
+// The events a webhook can subscribe to
+const (
+	EventMaskUserCreated EventMask = 1 << iota
+	EventMaskUserUpdated
+	EventMaskUserDeleted
+)
+
+// webhookEvents names the bits of an EventMask, in the order they are listed
+var webhookEvents = []struct {
+	name string
+	bit  EventMask
+}{
+	{"user.created", EventMaskUserCreated},
+	{"user.updated", EventMaskUserUpdated},
+	{"user.deleted", EventMaskUserDeleted},
+}
+
+// Has reports whether m includes the event called name
+func (m EventMask) Has(name string) bool {
+	for _, e := range webhookEvents {
+		if e.name == name {
+			return m&e.bit != 0
+		}
+	}
+	return false
+}
+
+// MarshalJSON writes m as the names of its events
+func (m EventMask) MarshalJSON() ([]byte, error) {
+	names := []string{}
+	for _, e := range webhookEvents {
+		if m&e.bit != 0 {
+			names = append(names, e.name)
+		}
+	}
+	return json.Marshal(names)
+}
+
+// UnmarshalJSON reads a list of event names, rejecting unknown ones
+func (m *EventMask) UnmarshalJSON(data []byte) error {
+	var names []string
+	if err := json.Unmarshal(data, &names); err != nil {
+		return err
+	}
+	var mask EventMask
+	for _, name := range names {
+		known := false
+		for _, e := range webhookEvents {
+			if e.name == name {
+				mask |= e.bit
+				known = true
+			}
+		}
+		if !known {
+			return fmt.Errorf("unknown event %q", name)
+		}
+	}
+	*m = mask
+	return nil
+}
+
+// Webhook is a URL told about user events as they happen. The secret signs
+// every delivery; it is generated by the server and only shown on creation.
+type Webhook struct {
+	ID        int       `json:"id" gorm:"primaryKey;autoIncrement"`
+	URL       string    `json:"url" gorm:"type:varchar(2048);not null"`
+	Secret    string    `json:"-" gorm:"type:varchar(64);not null"`
+	Enabled   bool      `json:"enabled" gorm:"not null"`
+	Events    EventMask `json:"events" gorm:"column:event_mask;not null" swaggertype:"array,string"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventMaskJSON(t *testing.T) {
+	var mask EventMask
+	require.NoError(t, json.Unmarshal([]byte(`["user.deleted","user.created"]`), &mask))
+	assert.Equal(t, EventMaskUserCreated|EventMaskUserDeleted, mask)
+	assert.True(t, mask.Has("user.deleted"))
+	assert.False(t, mask.Has("user.updated"))
+	assert.False(t, mask.Has("user.renamed"))
+
+	data, err := json.Marshal(mask)
+	require.NoError(t, err)
+	assert.JSONEq(t, `["user.created","user.deleted"]`, string(data))
+	data, err = json.Marshal(EventMask(0))
+	require.NoError(t, err)
+	assert.JSONEq(t, `[]`, string(data))
+
+	assert.EqualError(t, json.Unmarshal([]byte(`["user.renamed"]`), &mask), `unknown event "user.renamed"`)
+}
@@ -0,0 +1,33 @@
+// Command gen writes the operations annotated on the handlers of a package,
+// with the API's general information, for the package to build its OpenAPI
+// document from. go generate runs it in internal/handlers:
+//
+//	go run ../openapi/gen -general ../../main.go .
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+
+	"Unit-Test/internal/openapi"
+)
+
+func main() {
+	general := flag.String("general", "", "the file annotating main with the API's general information")
+	out := flag.String("o", "openapi_generated.go", "the file to write, in the package's directory")
+	flag.Parse()
+	dir := flag.Arg(0)
+	if dir == "" {
+		dir = "."
+	}
+
+	src, err := openapi.Generate(dir, *general)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, *out), src, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,507 @@
+package openapi
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"path"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Generate reads the swag annotations of the handlers of the package in dir,
+// and the general ones on the main function in the file main, and returns Go
+// source declaring them in the package: apiInfo is the Info, apiOperations an
+// Operation for every handler with a @Router, and apiErrorCodes lists the
+// package's string constants named Code...
+func Generate(dir, main string) ([]byte, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return nil, err
+	}
+	g := &generator{fset: token.NewFileSet(), imports: map[string]string{}, used: map[string]bool{}}
+	var pkg string
+	var operations []*Operation
+	var codes []string
+	for _, file := range files {
+		if strings.HasSuffix(file, "_test.go") {
+			continue
+		}
+		f, err := parser.ParseFile(g.fset, file, nil, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		pkg = f.Name.Name
+		g.addImports(f)
+		for _, decl := range f.Decls {
+			switch decl := decl.(type) {
+			case *ast.FuncDecl:
+				op, err := g.operation(decl)
+				if err != nil {
+					return nil, err
+				}
+				if op != nil {
+					operations = append(operations, op)
+				}
+			case *ast.GenDecl:
+				codes = append(codes, errorCodes(decl)...)
+			}
+		}
+	}
+	if pkg == "" {
+		return nil, fmt.Errorf("openapi: no Go files in %s", dir)
+	}
+	info, err := g.info(main)
+	if err != nil {
+		return nil, err
+	}
+	return g.source(pkg, info, operations, codes)
+}
+
+type generator struct {
+	fset *token.FileSet
+	// imports maps the names the package's files import packages under to
+	// their paths, and used is those the annotations refer to
+	imports map[string]string
+	used    map[string]bool
+}
+
+func (g *generator) addImports(f *ast.File) {
+	for _, spec := range f.Imports {
+		importPath, _ := strconv.Unquote(spec.Path.Value)
+		name := path.Base(importPath)
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		g.imports[name] = importPath
+	}
+}
+
+// annotations are the swag annotations in doc, without their @ and trailing
+// comments
+func annotations(doc *ast.CommentGroup) []string {
+	if doc == nil {
+		return nil
+	}
+	var lines []string
+	for _, line := range strings.Split(doc.Text(), "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "@") {
+			continue
+		}
+		line, _, _ = strings.Cut(line, " //")
+		lines = append(lines, strings.TrimSpace(line[1:]))
+	}
+	return lines
+}
+
+// operation is the operation annotated on decl, nil when it has no @Router
+func (g *generator) operation(decl *ast.FuncDecl) (*Operation, error) {
+	lines := annotations(decl.Doc)
+	if !slices.ContainsFunc(lines, func(line string) bool { return strings.HasPrefix(line, "Router ") }) {
+		return nil, nil
+	}
+
+	op := &Operation{}
+	var headers []struct {
+		status int
+		header Header
+	}
+	for _, line := range lines {
+		key, rest, _ := strings.Cut(line, " ")
+		rest = strings.TrimSpace(rest)
+		args := fields(rest)
+		var err error
+		switch key {
+		case "Summary":
+			op.Summary = rest
+		case "Description":
+			op.Description = strings.TrimPrefix(op.Description+"\n"+rest, "\n")
+		case "Tags":
+			op.Tags = append(op.Tags, splitList(rest)...)
+		case "Accept":
+			op.Accept = append(op.Accept, mediaTypes(rest)...)
+		case "Produce":
+			op.Produce = append(op.Produce, mediaTypes(rest)...)
+		case "Param":
+			err = g.param(op, args)
+		case "Success", "Failure":
+			err = g.response(op, args)
+		case "Header":
+			if len(args) < 3 {
+				err = fmt.Errorf("want @Header status {type} name [description]")
+				break
+			}
+			var status int
+			if status, err = strconv.Atoi(args[0]); err != nil {
+				break
+			}
+			h := Header{Name: args[2], Type: g.typeOf(primitive(strings.Trim(args[1], "{}")))}
+			if len(args) > 3 {
+				h.Description = args[3]
+			}
+			headers = append(headers, struct {
+				status int
+				header Header
+			}{status, h})
+		case "Security":
+			if len(args) > 0 {
+				op.Security = append(op.Security, args[0])
+			}
+		case "Router":
+			if len(args) < 2 {
+				err = fmt.Errorf("want @Router path [method]")
+				break
+			}
+			op.Routes = append(op.Routes, strings.ToUpper(strings.Trim(args[1], "[]"))+" "+args[0])
+		default:
+			err = fmt.Errorf("unknown annotation")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("openapi: %s: @%s: %w", g.fset.Position(decl.Pos()), line, err)
+		}
+	}
+
+	for _, h := range headers {
+		i := slices.IndexFunc(op.Responses, func(resp Response) bool { return resp.Status == h.status })
+		if i < 0 {
+			return nil, fmt.Errorf("openapi: %s: @Header for status %d without a response", g.fset.Position(decl.Pos()), h.status)
+		}
+		op.Responses[i].Headers = append(op.Responses[i].Headers, h.header)
+	}
+	return op, nil
+}
+
+// param adds the parameter of a @Param name in type required "description" to op
+func (g *generator) param(op *Operation, args []string) error {
+	if len(args) < 4 {
+		return fmt.Errorf("want @Param name in type required [description]")
+	}
+	required, err := strconv.ParseBool(args[3])
+	if err != nil {
+		return err
+	}
+	typ := args[2]
+	if args[1] != InBody {
+		typ = primitive(typ)
+	}
+	p := Param{Name: args[0], In: args[1], Type: g.typeOf(typ), Required: required}
+	if len(args) > 4 {
+		p.Description = args[4]
+	}
+	op.Params = append(op.Params, p)
+	return nil
+}
+
+// response adds the response of a @Success or @Failure status [{kind} type]
+// ["description"] to op
+func (g *generator) response(op *Operation, args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("want status [{kind} type] [description]")
+	}
+	status, err := strconv.Atoi(args[0])
+	if err != nil {
+		return err
+	}
+	resp := Response{Status: status}
+	args = args[1:]
+	if len(args) > 0 && strings.HasPrefix(args[0], "{") {
+		if len(args) < 2 {
+			return fmt.Errorf("want a type after %s", args[0])
+		}
+		switch kind := strings.Trim(args[0], "{}"); kind {
+		case "object":
+			resp.Type = g.typeOf(args[1])
+		case "array":
+			resp.Type = g.typeOf("[]" + primitive(args[1]))
+		default:
+			resp.Type = g.typeOf(primitive(kind))
+		}
+		args = args[2:]
+	}
+	if len(args) > 0 {
+		resp.Description = args[0]
+	}
+	op.Responses = append(op.Responses, resp)
+	return nil
+}
+
+// typeOf is a stand-in reflect.Type for the Go type expr, which the source
+// spells out in its place
+func (g *generator) typeOf(expr string) reflect.Type {
+	for _, match := range qualifier.FindAllStringSubmatch(expr, -1) {
+		g.used[match[1]] = true
+	}
+	return typeExpr{expr: expr}
+}
+
+// typeExpr stands for the Go type expr in the operations being generated;
+// only its expression is ever used
+type typeExpr struct {
+	reflect.Type
+	expr string
+}
+
+// qualifier matches the package names in a type expression
+var qualifier = regexp.MustCompile(`([A-Za-z_][A-Za-z0-9_]*)\.`)
+
+// primitive is the Go type of swag's names for parameter and header types
+func primitive(name string) string {
+	switch name {
+	case "integer", "int":
+		return "int"
+	case "number":
+		return "float64"
+	case "boolean", "bool":
+		return "bool"
+	case "file":
+		return "openapi.File"
+	}
+	return name
+}
+
+// mediaTypes are the media types of an @Accept or @Produce list, which may
+// use swag's short names
+func mediaTypes(list string) []string {
+	short := map[string]string{
+		"json":                  "application/json",
+		"xml":                   "application/xml",
+		"plain":                 "text/plain",
+		"html":                  "text/html",
+		"mpfd":                  "multipart/form-data",
+		"x-www-form-urlencoded": "application/x-www-form-urlencoded",
+		"json-api":              "application/vnd.api+json",
+		"json-stream":           "application/x-json-stream",
+		"octet-stream":          "application/octet-stream",
+		"png":                   "image/png",
+		"jpeg":                  "image/jpeg",
+		"gif":                   "image/gif",
+	}
+	var types []string
+	for _, name := range splitList(list) {
+		if full, ok := short[name]; ok {
+			name = full
+		}
+		types = append(types, name)
+	}
+	return types
+}
+
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// fields splits an annotation into its space-separated fields, keeping quoted
+// ones whole, without their quotes
+func fields(s string) []string {
+	var out []string
+	for s = strings.TrimSpace(s); s != ""; s = strings.TrimSpace(s) {
+		if s[0] == '"' {
+			end := strings.IndexByte(s[1:], '"')
+			if end < 0 {
+				out = append(out, s[1:])
+				break
+			}
+			out = append(out, s[1:end+1])
+			s = s[end+2:]
+			continue
+		}
+		end := strings.IndexFunc(s, unicode.IsSpace)
+		if end < 0 {
+			end = len(s)
+		}
+		out = append(out, s[:end])
+		s = s[end:]
+	}
+	return out
+}
+
+// errorCodes are the names of the string constants named Code... in decl
+func errorCodes(decl *ast.GenDecl) []string {
+	if decl.Tok != token.CONST {
+		return nil
+	}
+	var codes []string
+	for _, spec := range decl.Specs {
+		spec := spec.(*ast.ValueSpec)
+		for i, name := range spec.Names {
+			if !strings.HasPrefix(name.Name, "Code") || i >= len(spec.Values) {
+				continue
+			}
+			if lit, ok := spec.Values[i].(*ast.BasicLit); ok && lit.Kind == token.STRING {
+				codes = append(codes, name.Name)
+			}
+		}
+	}
+	return codes
+}
+
+// info is the general information annotated on the main function in file
+func (g *generator) info(file string) (Info, error) {
+	f, err := parser.ParseFile(g.fset, file, nil, parser.ParseComments)
+	if err != nil {
+		return Info{}, err
+	}
+	var doc *ast.CommentGroup
+	for _, decl := range f.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok && fn.Name.Name == "main" && fn.Recv == nil {
+			doc = fn.Doc
+		}
+	}
+
+	var info Info
+	// The annotations after a @securityDefinitions describe that scheme
+	var scheme *SecurityScheme
+	for _, line := range annotations(doc) {
+		key, rest, _ := strings.Cut(line, " ")
+		rest = strings.TrimSpace(rest)
+		switch {
+		case key == "title":
+			info.Title = rest
+		case key == "version":
+			info.Version = rest
+		case key == "description" && scheme != nil:
+			scheme.Description = rest
+		case key == "description":
+			info.Description = rest
+		case key == "contact.name":
+			info.Contact.Name = rest
+		case key == "contact.url":
+			info.Contact.URL = rest
+		case key == "contact.email":
+			info.Contact.Email = rest
+		case strings.HasPrefix(key, "securityDefinitions."):
+			info.SecuritySchemes = append(info.SecuritySchemes, SecurityScheme{
+				Name: rest,
+				Type: strings.TrimPrefix(key, "securityDefinitions."),
+			})
+			scheme = &info.SecuritySchemes[len(info.SecuritySchemes)-1]
+		case key == "in" && scheme != nil:
+			scheme.In = rest
+		case key == "name" && scheme != nil:
+			scheme.Param = rest
+		}
+	}
+	for _, scheme := range info.SecuritySchemes {
+		if scheme.Type != SchemeAPIKey && scheme.Type != SchemeBasic {
+			return Info{}, fmt.Errorf("openapi: %s: unsupported security scheme %s", file, scheme.Type)
+		}
+	}
+	return info, nil
+}
+
+// source is the Go source declaring info, operations and codes in package pkg
+func (g *generator) source(pkg string, info Info, operations []*Operation, codes []string) ([]byte, error) {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// Code generated by internal/openapi/gen from the swag annotations; DO NOT EDIT.\n\npackage %s\n\n", pkg)
+
+	self := reflect.TypeFor[File]().PkgPath()
+	imports := map[string]string{"reflect": "reflect", path.Base(self): self}
+	for name := range g.used {
+		if _, ok := imports[name]; ok {
+			continue
+		}
+		importPath, ok := g.imports[name]
+		if !ok {
+			return nil, fmt.Errorf("openapi: the annotations refer to package %s, which isn't imported", name)
+		}
+		imports[name] = importPath
+	}
+	b.WriteString("import (\n")
+	for _, std := range []bool{true, false} {
+		var group []string
+		for name, importPath := range imports {
+			if isStd(importPath) != std {
+				continue
+			}
+			spec := strconv.Quote(importPath)
+			if name != path.Base(importPath) {
+				spec = name + " " + spec
+			}
+			group = append(group, spec)
+		}
+		slices.SortFunc(group, func(a, b string) int {
+			return strings.Compare(a[strings.IndexByte(a, '"'):], b[strings.IndexByte(b, '"'):])
+		})
+		b.WriteString(strings.Join(group, "\n") + "\n\n")
+	}
+	b.WriteString(")\n\n")
+
+	b.WriteString("// apiInfo is the general information annotated on main\n")
+	fmt.Fprintf(&b, "var apiInfo = %s\n\n", g.literal(reflect.ValueOf(info)))
+	b.WriteString("// apiOperations are the operations annotated on the handlers\n")
+	b.WriteString("var apiOperations = []openapi.Operation{\n")
+	for _, op := range operations {
+		fmt.Fprintf(&b, "%s,\n", strings.TrimPrefix(g.literal(reflect.ValueOf(*op)), "openapi.Operation"))
+	}
+	b.WriteString("}\n\n")
+	b.WriteString("// apiErrorCodes are the codes ErrorResponse.Code takes\n")
+	fmt.Fprintf(&b, "var apiErrorCodes = []string{\n%s,\n}\n", strings.Join(codes, ",\n"))
+
+	src, err := format.Source(b.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("openapi: formatting the generated source: %w", err)
+	}
+	return src, nil
+}
+
+// literal is the Go expression of v, one of the types of this package, leaving
+// out zero fields
+func (g *generator) literal(v reflect.Value) string {
+	if v.Type() == reflect.TypeFor[reflect.Type]() {
+		return "reflect.TypeFor[" + v.Interface().(typeExpr).expr + "]()"
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return strconv.Quote(v.String())
+	case reflect.Bool, reflect.Int:
+		return fmt.Sprint(v.Interface())
+	case reflect.Slice:
+		items := make([]string, v.Len())
+		multiline := v.Type().Elem().Kind() == reflect.Struct
+		for i := range items {
+			items[i] = strings.TrimPrefix(g.literal(v.Index(i)), "openapi."+v.Type().Elem().Name())
+			if multiline {
+				items[i] += ",\n"
+			}
+		}
+		if multiline {
+			return "[]openapi." + v.Type().Elem().Name() + "{\n" + strings.Join(items, "") + "}"
+		}
+		return "[]" + v.Type().Elem().String() + "{" + strings.Join(items, ", ") + "}"
+	case reflect.Struct:
+		var fields []string
+		for i := 0; i < v.NumField(); i++ {
+			if !v.Field(i).IsZero() {
+				fields = append(fields, v.Type().Field(i).Name+": "+g.literal(v.Field(i)))
+			}
+		}
+		// Operations and the info a field a line, the rest on a line of their own
+		if name := v.Type().Name(); name == "Operation" || name == "Info" {
+			return "openapi." + name + "{\n" + strings.Join(fields, ",\n") + ",\n}"
+		}
+		return "openapi." + v.Type().Name() + "{" + strings.Join(fields, ", ") + "}"
+	}
+	panic(fmt.Sprintf("openapi: can't generate a %s", v.Type()))
+}
+
+// isStd reports whether importPath is a package of the standard library
+func isStd(importPath string) bool {
+	pkg, err := build.Default.Import(importPath, "", build.FindOnly)
+	return err == nil && pkg.Goroot
+}
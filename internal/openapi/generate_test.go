@@ -0,0 +1,196 @@
+package openapi
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testMain = `package main
+
+// @title Pets
+// @version 2.0
+// @description Pets and their owners.
+// Prose between the annotations is left out.
+// @contact.email pets@example.com
+// @securityDefinitions.apikey Token
+// @in header
+// @name Authorization
+// @description "Bearer <token>"
+// @securityDefinitions.basic Admin
+func main() {}
+`
+
+const testHandlers = `package pets
+
+import (
+	"net/http"
+
+	petmodels "example.com/pets/models"
+)
+
+const (
+	CodeNotFound = "NOT_FOUND"
+	CodeInvalid  = "INVALID"
+	codeHidden   = "HIDDEN"
+	CodeCount    = 2
+)
+
+// getPet answers with a pet
+// @Summary Get a pet
+// @Description Find a pet by its ID.
+// @Description Deleted pets are not found.
+// @Tags Pets, Read
+// @Produce json,xml
+// @Param id path int true "Pet ID" // the pet's ID
+// @Param If-None-Match header string false "ETag"
+// @Success 200 {object} petmodels.Pet
+// @Header 200 {string} ETag "Version of the pet"
+// @Success 304 "Not modified"
+// @Failure 404 {object} Error // unknown pet
+// @Security Token
+// @Router /pets/{id} [get]
+// @Router /v2/pets/{id} [get]
+func getPet(w http.ResponseWriter, r *http.Request) {}
+
+// @Summary Upload a photo
+// @Accept mpfd
+// @Param photo formData file true "Photo"
+// @Param tags body []string false "Tags"
+// @Success 200 {array} petmodels.Pet
+// @Success 201 {file} file
+// @Failure 400
+// @Router /pets/{id}/photo [put]
+func putPhoto(w http.ResponseWriter, r *http.Request) {}
+
+// notAHandler has no @Router
+// @Summary Ignored
+func notAHandler() {}
+`
+
+const wantGenerated = `// Code generated by internal/openapi/gen from the swag annotations; DO NOT EDIT.
+
+package pets
+
+import (
+	"reflect"
+
+	"Unit-Test/internal/openapi"
+	petmodels "example.com/pets/models"
+)
+
+// apiInfo is the general information annotated on main
+var apiInfo = openapi.Info{
+	Title:       "Pets",
+	Version:     "2.0",
+	Description: "Pets and their owners.",
+	Contact:     openapi.Contact{Email: "pets@example.com"},
+	SecuritySchemes: []openapi.SecurityScheme{
+		{Name: "Token", Type: "apikey", In: "header", Param: "Authorization", Description: "\"Bearer <token>\""},
+		{Name: "Admin", Type: "basic"},
+	},
+}
+
+// apiOperations are the operations annotated on the handlers
+var apiOperations = []openapi.Operation{
+	{
+		Routes:      []string{"GET /pets/{id}", "GET /v2/pets/{id}"},
+		Summary:     "Get a pet",
+		Description: "Find a pet by its ID.\nDeleted pets are not found.",
+		Tags:        []string{"Pets", "Read"},
+		Produce:     []string{"application/json", "application/xml"},
+		Params: []openapi.Param{
+			{Name: "id", In: "path", Type: reflect.TypeFor[int](), Required: true, Description: "Pet ID"},
+			{Name: "If-None-Match", In: "header", Type: reflect.TypeFor[string](), Description: "ETag"},
+		},
+		Responses: []openapi.Response{
+			{Status: 200, Type: reflect.TypeFor[petmodels.Pet](), Headers: []openapi.Header{
+				{Name: "ETag", Type: reflect.TypeFor[string](), Description: "Version of the pet"},
+			}},
+			{Status: 304, Description: "Not modified"},
+			{Status: 404, Type: reflect.TypeFor[Error]()},
+		},
+		Security: []string{"Token"},
+	},
+	{
+		Routes:  []string{"PUT /pets/{id}/photo"},
+		Summary: "Upload a photo",
+		Accept:  []string{"multipart/form-data"},
+		Params: []openapi.Param{
+			{Name: "photo", In: "formData", Type: reflect.TypeFor[openapi.File](), Required: true, Description: "Photo"},
+			{Name: "tags", In: "body", Type: reflect.TypeFor[[]string](), Description: "Tags"},
+		},
+		Responses: []openapi.Response{
+			{Status: 200, Type: reflect.TypeFor[[]petmodels.Pet]()},
+			{Status: 201, Type: reflect.TypeFor[openapi.File]()},
+			{Status: 400},
+		},
+	},
+}
+
+// apiErrorCodes are the codes ErrorResponse.Code takes
+var apiErrorCodes = []string{
+	CodeNotFound,
+	CodeInvalid,
+}
+`
+
+// writePackage writes files, by name, to a new directory
+func writePackage(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600))
+	}
+	return dir
+}
+
+func TestGenerate(t *testing.T) {
+	t.Parallel()
+	dir := writePackage(t, map[string]string{
+		"pets.go":      testHandlers,
+		"main.txt":     testMain,
+		"pets_test.go": "package pets\n\n// @Router /tests [get]\nfunc ignored() {}\n",
+	})
+
+	src, err := Generate(dir, filepath.Join(dir, "main.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, wantGenerated, string(src))
+}
+
+func TestGenerateRejects(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name       string
+		annotation string
+		err        string
+	}{
+		{"unknown annotations", "// @Deprecated", "@Deprecated: unknown annotation"},
+		{"short params", "// @Param id path", "@Param id path: want @Param name in type required [description]"},
+		{"bad statuses", "// @Success ok", `@Success ok: strconv.Atoi: parsing "ok": invalid syntax`},
+		{"headers without a response", "// @Header 200 {string} ETag", "@Header for status 200 without a response"},
+		{"unimported packages", "// @Success 200 {object} models.Pet", "refer to package models, which isn't imported"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			dir := writePackage(t, map[string]string{
+				"pets.go":  "package pets\n\n" + tt.annotation + "\n// @Router /pets [get]\nfunc getPets() {}\n",
+				"main.txt": testMain,
+			})
+			_, err := Generate(dir, filepath.Join(dir, "main.txt"))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.err)
+		})
+	}
+}
+
+func TestFields(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, []string{"id", "path", "int", "true", "The pet's ID"}, fields(`id path int  true "The pet's ID"`))
+	assert.Equal(t, []string{"204", "unterminated"}, fields(`204 "unterminated`))
+	assert.Empty(t, fields("  "))
+}
@@ -0,0 +1,330 @@
+// Package openapi builds the OpenAPI 3 document of the API from the routes an
+// engine serves and the operations annotated on their handlers. The
+// operations are read off the handlers' swag annotations by Generate, which
+// go generate runs, so the document follows the code it describes.
+package openapi
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/gin-gonic/gin"
+)
+
+// File stands for a file in the types of parameters and responses, such as
+// an uploaded form field or a downloaded image
+type File struct{}
+
+// Info is the general information of the API, annotated on its main package
+type Info struct {
+	Title       string
+	Version     string
+	Description string
+	Contact     Contact
+	// SecuritySchemes are the ways to authenticate that operations name in
+	// their Security
+	SecuritySchemes []SecurityScheme
+}
+
+// Contact is who to ask about the API
+type Contact struct {
+	Name  string
+	URL   string
+	Email string
+}
+
+// Security scheme types, as swag's @securityDefinitions names them
+const (
+	SchemeAPIKey = "apikey"
+	SchemeBasic  = "basic"
+)
+
+// SecurityScheme is a way to authenticate: an API key sent in the header,
+// query or cookie named Param, or HTTP basic auth
+type SecurityScheme struct {
+	Name        string
+	Type        string
+	In          string
+	Param       string
+	Description string
+}
+
+// Operation is what a handler does, served at each of its Routes
+type Operation struct {
+	// Routes are the method and path the handler is served at, with the path
+	// in OpenAPI form, such as "GET /api/v1/users/{id}"
+	Routes      []string
+	Summary     string
+	Description string
+	Tags        []string
+	// Accept and Produce are the media types of the request and response
+	// bodies, JSON when none are given
+	Accept    []string
+	Produce   []string
+	Params    []Param
+	Responses []Response
+	// Security names the schemes that authenticate the operation, any one of
+	// them will do
+	Security []string
+}
+
+// Parameter locations; a body parameter is the whole request body, and the
+// formData ones its fields
+const (
+	InPath     = "path"
+	InQuery    = "query"
+	InHeader   = "header"
+	InBody     = "body"
+	InFormData = "formData"
+)
+
+// Param is a parameter of an operation, of Go type Type
+type Param struct {
+	Name        string
+	In          string
+	Type        reflect.Type
+	Required    bool
+	Description string
+}
+
+// Response is one of the answers of an operation. Type is the Go type of the
+// body, nil when there is none.
+type Response struct {
+	Status      int
+	Type        reflect.Type
+	Description string
+	Headers     []Header
+}
+
+// Header is a header sent with a response
+type Header struct {
+	Name        string
+	Type        reflect.Type
+	Description string
+}
+
+// ginParam matches the parameters and catch-alls of gin's paths
+var ginParam = regexp.MustCompile(`[:*]([A-Za-z0-9_]+)`)
+
+// Path turns a gin path such as /users/:id into its OpenAPI form, /users/{id}
+func Path(ginPath string) string {
+	return ginParam.ReplaceAllString(ginPath, "{$1}")
+}
+
+// Build documents every route with the operation served there. It fails when
+// a route has no operation, or one has two, so none goes undocumented.
+func Build(info Info, routes gin.RoutesInfo, operations []Operation) (*openapi3.T, error) {
+	doc := &openapi3.T{
+		OpenAPI: "3.0.3",
+		Info: &openapi3.Info{
+			Title:       info.Title,
+			Version:     info.Version,
+			Description: info.Description,
+		},
+		Paths: openapi3.NewPaths(),
+		Components: &openapi3.Components{
+			Schemas:         openapi3.Schemas{},
+			SecuritySchemes: openapi3.SecuritySchemes{},
+		},
+	}
+	if info.Contact != (Contact{}) {
+		doc.Info.Contact = &openapi3.Contact{Name: info.Contact.Name, URL: info.Contact.URL, Email: info.Contact.Email}
+	}
+	for _, scheme := range info.SecuritySchemes {
+		doc.Components.SecuritySchemes[scheme.Name] = &openapi3.SecuritySchemeRef{Value: scheme.build()}
+	}
+
+	byRoute := make(map[string]*Operation)
+	for i, op := range operations {
+		for _, route := range op.Routes {
+			if _, ok := byRoute[route]; ok {
+				return nil, fmt.Errorf("openapi: %s is documented twice", route)
+			}
+			byRoute[route] = &operations[i]
+		}
+	}
+
+	schemas := schemas{doc.Components.Schemas}
+	var undocumented []string
+	for _, route := range routes {
+		path := Path(route.Path)
+		op, ok := byRoute[route.Method+" "+path]
+		if !ok {
+			undocumented = append(undocumented, route.Method+" "+route.Path)
+			continue
+		}
+		doc.AddOperation(path, route.Method, op.build(schemas))
+	}
+	if len(undocumented) > 0 {
+		return nil, fmt.Errorf("openapi: undocumented routes: %s", strings.Join(undocumented, ", "))
+	}
+	return doc, nil
+}
+
+func (s SecurityScheme) build() *openapi3.SecurityScheme {
+	if s.Type == SchemeBasic {
+		return &openapi3.SecurityScheme{Type: "http", Scheme: "basic", Description: s.Description}
+	}
+	return &openapi3.SecurityScheme{Type: "apiKey", In: s.In, Name: s.Param, Description: s.Description}
+}
+
+// build is the OpenAPI operation of op, with its types' schemas added to schemas
+func (op *Operation) build(schemas schemas) *openapi3.Operation {
+	o := &openapi3.Operation{
+		Summary:     op.Summary,
+		Description: op.Description,
+		Tags:        op.Tags,
+		Responses:   openapi3.NewResponsesWithCapacity(len(op.Responses)),
+	}
+
+	var body *Param
+	var form []Param
+	for i, p := range op.Params {
+		switch p.In {
+		case InBody:
+			body = &op.Params[i]
+		case InFormData:
+			form = append(form, p)
+		default:
+			param := &openapi3.Parameter{
+				Name:        p.Name,
+				In:          p.In,
+				Description: p.Description,
+				Required:    p.Required || p.In == InPath,
+				Schema:      schemas.ref(p.Type),
+			}
+			o.Parameters = append(o.Parameters, &openapi3.ParameterRef{Value: param})
+		}
+	}
+	if body != nil || len(form) > 0 {
+		o.RequestBody = &openapi3.RequestBodyRef{Value: op.requestBody(schemas, body, form)}
+	}
+
+	// Responses of the same status are alternatives, such as v1's array and
+	// v2's envelope
+	for _, status := range op.statuses() {
+		o.Responses.Set(strconv.Itoa(status), &openapi3.ResponseRef{Value: op.response(schemas, status)})
+	}
+
+	if len(op.Security) > 0 {
+		security := openapi3.NewSecurityRequirements()
+		for _, name := range op.Security {
+			security.With(openapi3.NewSecurityRequirement().Authenticate(name))
+		}
+		o.Security = security
+	}
+	return o
+}
+
+// requestBody is the request body of op: its body parameter, its form fields,
+// or the raw body for the other media types it accepts
+func (op *Operation) requestBody(schemas schemas, body *Param, form []Param) *openapi3.RequestBody {
+	accept := op.Accept
+	if len(accept) == 0 {
+		accept = []string{"application/json"}
+		if body == nil {
+			accept = []string{"multipart/form-data"}
+		}
+	}
+
+	requestBody := openapi3.NewRequestBody()
+	requestBody.Content = openapi3.NewContent()
+	for _, mediaType := range accept {
+		var schema *openapi3.SchemaRef
+		switch {
+		case isForm(mediaType) && len(form) > 0:
+			fields := openapi3.NewObjectSchema()
+			for _, p := range form {
+				fields.WithPropertyRef(p.Name, schemas.ref(p.Type))
+				if p.Required {
+					fields.Required = append(fields.Required, p.Name)
+				}
+			}
+			schema = openapi3.NewSchemaRef("", fields)
+		case body != nil:
+			schema = schemas.ref(body.Type)
+		default:
+			schema = openapi3.NewSchemaRef("", openapi3.NewStringSchema())
+		}
+		requestBody.Content[mediaType] = openapi3.NewMediaType().WithSchemaRef(schema)
+	}
+
+	if body != nil {
+		requestBody.Description = body.Description
+		requestBody.Required = body.Required
+	}
+	for _, p := range form {
+		requestBody.Required = requestBody.Required || p.Required
+	}
+	return requestBody
+}
+
+// statuses are the statuses op answers with, in the order they are listed
+func (op *Operation) statuses() []int {
+	var statuses []int
+	seen := make(map[int]bool)
+	for _, resp := range op.Responses {
+		if !seen[resp.Status] {
+			seen[resp.Status] = true
+			statuses = append(statuses, resp.Status)
+		}
+	}
+	return statuses
+}
+
+// response is op's answer with status, merging the responses listed for it
+func (op *Operation) response(schemas schemas, status int) *openapi3.Response {
+	var descriptions []string
+	var bodies []*openapi3.SchemaRef
+	headers := openapi3.Headers{}
+	for _, resp := range op.Responses {
+		if resp.Status != status {
+			continue
+		}
+		if resp.Description != "" {
+			descriptions = append(descriptions, resp.Description)
+		}
+		if resp.Type != nil {
+			bodies = append(bodies, schemas.ref(resp.Type))
+		}
+		for _, h := range resp.Headers {
+			headers[h.Name] = &openapi3.HeaderRef{Value: &openapi3.Header{Parameter: openapi3.Parameter{
+				Description: h.Description,
+				Schema:      schemas.ref(h.Type),
+			}}}
+		}
+	}
+
+	description := strings.Join(descriptions, "; ")
+	if description == "" {
+		description = http.StatusText(status)
+	}
+	resp := openapi3.NewResponse().WithDescription(description)
+	if len(headers) > 0 {
+		resp.Headers = headers
+	}
+	if len(bodies) == 0 {
+		return resp
+	}
+
+	body := bodies[0]
+	if len(bodies) > 1 {
+		body = openapi3.NewSchemaRef("", &openapi3.Schema{OneOf: bodies})
+	}
+	produce := op.Produce
+	if len(produce) == 0 {
+		produce = []string{"application/json"}
+	}
+	resp.Content = openapi3.NewContentWithSchemaRef(body, produce)
+	return resp
+}
+
+// isForm reports whether a body of mediaType is made of form fields
+func isForm(mediaType string) bool {
+	return mediaType == "multipart/form-data" || mediaType == "application/x-www-form-urlencoded"
+}
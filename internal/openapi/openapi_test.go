@@ -0,0 +1,127 @@
+package openapi
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type pet struct {
+	ID   int    `json:"id"`
+	Name string `json:"name" binding:"required"`
+}
+
+var testInfo = Info{
+	Title:   "Pets",
+	Version: "1.0",
+	SecuritySchemes: []SecurityScheme{
+		{Name: "Token", Type: SchemeAPIKey, In: "header", Param: "Authorization"},
+		{Name: "Admin", Type: SchemeBasic},
+	},
+}
+
+var testOperations = []Operation{
+	{
+		Routes:  []string{"GET /pets/{id}", "GET /v2/pets/{id}"},
+		Summary: "Get a pet",
+		Produce: []string{"application/json", "application/xml"},
+		Params: []Param{
+			{Name: "id", In: InPath, Type: reflect.TypeFor[int]()},
+			{Name: "fields", In: InQuery, Type: reflect.TypeFor[string](), Description: "Fields to return"},
+		},
+		Responses: []Response{
+			{Status: 200, Type: reflect.TypeFor[pet](), Headers: []Header{{Name: "ETag", Type: reflect.TypeFor[string]()}}},
+			{Status: 200, Type: reflect.TypeFor[[]pet](), Description: "In v2"},
+			{Status: 404},
+		},
+	},
+	{
+		Routes:    []string{"POST /pets"},
+		Params:    []Param{{Name: "pet", In: InBody, Type: reflect.TypeFor[pet](), Required: true}},
+		Responses: []Response{{Status: 201, Type: reflect.TypeFor[pet]()}},
+		Security:  []string{"Token", "Admin"},
+	},
+	{
+		Routes: []string{"PUT /pets/{id}/photo"},
+		Accept: []string{"multipart/form-data", "image/png"},
+		Params: []Param{
+			{Name: "id", In: InPath, Type: reflect.TypeFor[int]()},
+			{Name: "photo", In: InFormData, Type: reflect.TypeFor[File](), Required: true},
+		},
+		Responses: []Response{{Status: 204}},
+	},
+}
+
+func testRoutes(paths ...string) gin.RoutesInfo {
+	var routes gin.RoutesInfo
+	for i := 0; i < len(paths); i += 2 {
+		routes = append(routes, gin.RouteInfo{Method: paths[i], Path: paths[i+1]})
+	}
+	return routes
+}
+
+func TestPath(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, "/users/{id}/posts/{post_id}", Path("/users/:id/posts/:post_id"))
+	assert.Equal(t, "/swagger/{any}", Path("/swagger/*any"))
+	assert.Equal(t, "/healthz", Path("/healthz"))
+}
+
+func TestBuild(t *testing.T) {
+	t.Parallel()
+	doc, err := Build(testInfo, testRoutes("GET", "/pets/:id", "POST", "/pets", "PUT", "/pets/:id/photo"), testOperations)
+	require.NoError(t, err)
+	require.NoError(t, doc.Validate(context.Background()))
+
+	assert.Equal(t, "Pets", doc.Info.Title)
+	assert.Equal(t, "apiKey", doc.Components.SecuritySchemes["Token"].Value.Type)
+	assert.Equal(t, "basic", doc.Components.SecuritySchemes["Admin"].Value.Scheme)
+	assert.Nil(t, doc.Paths.Find("/v2/pets/{id}"), "only the routes served are documented")
+
+	get := doc.Paths.Find("/pets/{id}").Get
+	assert.Equal(t, "Get a pet", get.Summary)
+	assert.True(t, get.Parameters.GetByInAndName(InPath, "id").Required, "path parameters are required")
+	assert.Equal(t, "Fields to return", get.Parameters.GetByInAndName(InQuery, "fields").Description)
+	ok := get.Responses.Status(http.StatusOK).Value
+	assert.Equal(t, "In v2", *ok.Description)
+	assert.Contains(t, ok.Headers, "ETag")
+	for _, mediaType := range []string{"application/json", "application/xml"} {
+		alternatives := ok.Content.Get(mediaType).Schema.Value.OneOf
+		require.Len(t, alternatives, 2, mediaType)
+		assert.Equal(t, "#/components/schemas/openapi.pet", alternatives[0].Ref)
+	}
+	notFound := get.Responses.Status(http.StatusNotFound).Value
+	assert.Equal(t, "Not Found", *notFound.Description)
+	assert.Nil(t, notFound.Content)
+	assert.Nil(t, get.Security)
+
+	post := doc.Paths.Find("/pets").Post
+	assert.True(t, post.RequestBody.Value.Required)
+	assert.Equal(t, "#/components/schemas/openapi.pet", post.RequestBody.Value.Content.Get("application/json").Schema.Ref)
+	assert.Equal(t, openapi3.SecurityRequirements{{"Token": {}}, {"Admin": {}}}, *post.Security)
+
+	photo := doc.Paths.Find("/pets/{id}/photo").Put.RequestBody.Value
+	form := photo.Content.Get("multipart/form-data").Schema.Value
+	assert.Equal(t, "binary", form.Properties["photo"].Value.Format)
+	assert.Equal(t, []string{"photo"}, form.Required)
+	assert.True(t, photo.Content.Get("image/png").Schema.Value.Type.Is("string"), "a raw body")
+}
+
+func TestBuildRejectsUndocumentedRoutes(t *testing.T) {
+	t.Parallel()
+	_, err := Build(testInfo, testRoutes("GET", "/pets/:id", "GET", "/toys", "DELETE", "/pets/:id"), testOperations)
+	assert.EqualError(t, err, "openapi: undocumented routes: GET /toys, DELETE /pets/:id")
+}
+
+func TestBuildRejectsRoutesDocumentedTwice(t *testing.T) {
+	t.Parallel()
+	operations := append([]Operation{{Routes: []string{"POST /pets"}}}, testOperations...)
+	_, err := Build(testInfo, testRoutes("POST", "/pets"), operations)
+	assert.EqualError(t, err, "openapi: POST /pets is documented twice")
+}
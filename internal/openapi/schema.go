@@ -0,0 +1,199 @@
+package openapi
+
+import (
+	"encoding/json"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+var (
+	fileType      = reflect.TypeFor[File]()
+	timeType      = reflect.TypeFor[time.Time]()
+	marshalerType = reflect.TypeFor[json.Marshaler]()
+)
+
+// schemas turns Go types into schemas the way encoding/json renders them,
+// adding named structs to the document's components and referring to them
+// there, under names such as models.User
+type schemas struct {
+	components openapi3.Schemas
+}
+
+// ref is the schema of t
+func (s schemas) ref(t reflect.Type) *openapi3.SchemaRef {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch {
+	case t == fileType:
+		return inline(&openapi3.Schema{Type: &openapi3.Types{"string"}, Format: "binary"})
+	case t == timeType:
+		return inline(openapi3.NewDateTimeSchema())
+	case t.Implements(marshalerType) || reflect.PointerTo(t).Implements(marshalerType):
+		// Renders itself as it likes; fields of these types say how with swaggertype
+		return inline(&openapi3.Schema{})
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return inline(openapi3.NewBoolSchema())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return inline(openapi3.NewIntegerSchema())
+	case reflect.Float32, reflect.Float64:
+		return inline(openapi3.NewFloat64Schema())
+	case reflect.String:
+		return inline(openapi3.NewStringSchema())
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return inline(openapi3.NewBytesSchema())
+		}
+		items := openapi3.NewArraySchema()
+		items.Items = s.ref(t.Elem())
+		return inline(items)
+	case reflect.Map:
+		object := openapi3.NewObjectSchema()
+		object.AdditionalProperties = openapi3.AdditionalProperties{Schema: s.ref(t.Elem())}
+		return inline(object)
+	case reflect.Struct:
+		if t.Name() == "" {
+			return inline(s.object(t))
+		}
+		name := path.Base(t.PkgPath()) + "." + t.Name()
+		if _, ok := s.components[name]; !ok {
+			// Claimed before its fields are, so types that refer to themselves end
+			s.components[name] = &openapi3.SchemaRef{Value: &openapi3.Schema{}}
+			*s.components[name].Value = *s.object(t)
+		}
+		return openapi3.NewSchemaRef("#/components/schemas/"+name, s.components[name].Value)
+	}
+	// Interfaces, and whatever else encoding/json renders as it finds it
+	return inline(&openapi3.Schema{})
+}
+
+// object is the schema of the struct t
+func (s schemas) object(t reflect.Type) *openapi3.Schema {
+	object := openapi3.NewObjectSchema()
+	s.addFields(object, t)
+	return object
+}
+
+// addFields adds the fields encoding/json renders of the struct t to object,
+// including those of the structs t embeds
+func (s schemas) addFields(object *openapi3.Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" || field.Tag.Get("swaggerignore") == "true" {
+			continue
+		}
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				s.addFields(object, embedded)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		object.WithPropertyRef(name, s.field(field))
+		if isRequired(field) {
+			object.Required = append(object.Required, name)
+		}
+	}
+}
+
+// field is the schema of a struct field, as its swaggertype and example tags
+// refine it
+func (s schemas) field(field reflect.StructField) *openapi3.SchemaRef {
+	var schema *openapi3.SchemaRef
+	if swaggerType, ok := field.Tag.Lookup("swaggertype"); ok {
+		schema = inline(typeSchema(strings.Split(swaggerType, ",")))
+	} else {
+		schema = s.ref(field.Type)
+	}
+	// Siblings of a $ref are ignored, so only inline schemas take these
+	if schema.Ref != "" {
+		return schema
+	}
+	if field.Type.Kind() == reflect.Pointer {
+		schema.Value.Nullable = true
+	}
+	if example, ok := field.Tag.Lookup("example"); ok {
+		schema.Value.Example = exampleValue(schema.Value, example)
+	}
+	return schema
+}
+
+// typeSchema is the schema a swaggertype tag such as "array,string" names
+func typeSchema(names []string) *openapi3.Schema {
+	switch names[0] {
+	case "array":
+		array := openapi3.NewArraySchema()
+		if len(names) > 1 {
+			array.Items = inline(typeSchema(names[1:]))
+		}
+		return array
+	case "object":
+		return openapi3.NewObjectSchema()
+	case "primitive":
+		if len(names) > 1 {
+			return typeSchema(names[1:])
+		}
+	}
+	return &openapi3.Schema{Type: &openapi3.Types{names[0]}}
+}
+
+// exampleValue is the example tag value of a field as a value of its schema;
+// the items of an array example are separated by commas, as in swag
+func exampleValue(schema *openapi3.Schema, example string) any {
+	switch {
+	case schema.Type.Is("array") && schema.Items != nil && schema.Items.Value != nil:
+		values := []any{}
+		for _, item := range strings.Split(example, ",") {
+			values = append(values, exampleValue(schema.Items.Value, item))
+		}
+		return values
+	case schema.Type.Is("integer"):
+		if n, err := strconv.ParseInt(example, 10, 64); err == nil {
+			return n
+		}
+	case schema.Type.Is("number"):
+		if n, err := strconv.ParseFloat(example, 64); err == nil {
+			return n
+		}
+	case schema.Type.Is("boolean"):
+		if b, err := strconv.ParseBool(example); err == nil {
+			return b
+		}
+	}
+	return example
+}
+
+// isRequired reports whether the binding or validate tag of field requires it
+func isRequired(field reflect.StructField) bool {
+	for _, key := range []string{"binding", "validate"} {
+		for _, rule := range strings.Split(field.Tag.Get(key), ",") {
+			if rule == "required" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func inline(schema *openapi3.Schema) *openapi3.SchemaRef {
+	return openapi3.NewSchemaRef("", schema)
+}
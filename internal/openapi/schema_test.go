@@ -0,0 +1,91 @@
+package openapi
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type base struct {
+	ID      int       `json:"id" example:"42"`
+	Created time.Time `json:"created_at"`
+}
+
+type mask int
+
+func (mask) MarshalJSON() ([]byte, error) { return []byte(`["a"]`), nil }
+
+type node struct {
+	base
+	Name     string `json:"name,omitempty" binding:"required,max=10"`
+	Hidden   string `json:"-"`
+	Secret   string `json:"secret" swaggerignore:"true"`
+	Untagged bool
+	Parent   *node             `json:"parent"`
+	Children []node            `json:"children"`
+	Labels   map[string]string `json:"labels"`
+	Verified *time.Time        `json:"verified_at"`
+	Score    float64           `json:"score" example:"0.5"`
+	Mask     mask              `json:"mask" swaggertype:"array,string" example:"a,b"`
+	Raw      json.RawMessage   `json:"raw"`
+	Data     []byte            `json:"data"`
+	Any      interface{}       `json:"any" swaggertype:"object"`
+	private  int
+}
+
+func TestSchemas(t *testing.T) {
+	t.Parallel()
+	s := schemas{openapi3.Schemas{}}
+	ref := s.ref(reflect.TypeFor[*node]())
+	assert.Equal(t, "#/components/schemas/openapi.node", ref.Ref)
+
+	schema := s.components["openapi.node"].Value
+	assert.ElementsMatch(t, []string{
+		"id", "created_at", "name", "Untagged", "parent", "children", "labels",
+		"verified_at", "score", "mask", "raw", "data", "any",
+	}, keys(schema.Properties))
+	assert.Equal(t, []string{"name"}, schema.Required)
+
+	props := schema.Properties
+	assert.EqualValues(t, 42, props["id"].Value.Example)
+	assert.Equal(t, "date-time", props["created_at"].Value.Format)
+	assert.True(t, props["Untagged"].Value.Type.Is("boolean"))
+	assert.Equal(t, "#/components/schemas/openapi.node", props["parent"].Ref, "types can refer to themselves")
+	assert.Equal(t, "#/components/schemas/openapi.node", props["children"].Value.Items.Ref)
+	assert.True(t, props["labels"].Value.AdditionalProperties.Schema.Value.Type.Is("string"))
+	assert.True(t, props["verified_at"].Value.Nullable)
+	assert.Equal(t, 0.5, props["score"].Value.Example)
+	assert.True(t, props["mask"].Value.Items.Value.Type.Is("string"))
+	assert.Equal(t, []any{"a", "b"}, props["mask"].Value.Example)
+	assert.Nil(t, props["raw"].Value.Type, "raw JSON could be anything")
+	assert.Equal(t, "byte", props["data"].Value.Format)
+	assert.True(t, props["any"].Value.Type.Is("object"))
+
+	// Without swaggertype, a type that marshals itself could be anything
+	assert.Nil(t, s.ref(reflect.TypeFor[mask]()).Value.Type)
+	assert.Equal(t, "binary", s.ref(reflect.TypeFor[File]()).Value.Format)
+	assert.Nil(t, s.ref(reflect.TypeFor[any]()).Value.Type)
+}
+
+func TestSchemasAreValid(t *testing.T) {
+	t.Parallel()
+	s := schemas{openapi3.Schemas{}}
+	s.ref(reflect.TypeFor[node]())
+	for name, schema := range s.components {
+		require.NoError(t, schema.Validate(context.Background()), name)
+	}
+}
+
+func keys[V any](m map[string]V) []string {
+	var names []string
+	for name := range m {
+		names = append(names, name)
+	}
+	return names
+}
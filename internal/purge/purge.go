@@ -0,0 +1,179 @@
+// Package purge deletes soft-deleted users for good once they have been
+// deleted longer than the retention period, together with what the database
+// cascades to: their posts, addresses, API keys and tokens. The audit log
+// keeps their history.
+package purge
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"Unit-Test/internal/models"
+	"Unit-Test/internal/service"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"gorm.io/gorm"
+)
+
+// UsersPurged counts the users deleted for good; the API serves it on /metrics
+var UsersPurged = prometheus.NewCounter(prometheus.CounterOpts{
+	Name: "users_purged_total",
+	Help: "Soft-deleted users deleted for good.",
+})
+
+// Options tune a Purger; zero values take the defaults
+type Options struct {
+	// Interval is the time between the runs Start makes, 1h by default
+	Interval time.Duration
+	// Retention is how long a deleted user is kept before a run purges it,
+	// 30 days by default
+	Retention time.Duration
+	// BatchSize is how many users each statement deletes, 500 by default
+	BatchSize int
+	// Clock defaults to time.Now
+	Clock service.Clock
+	// Ticks starts a run on every value; a time.Ticker firing every Interval
+	// by default
+	Ticks <-chan time.Time
+}
+
+func (o *Options) setDefaults() {
+	if o.Interval <= 0 {
+		o.Interval = time.Hour
+	}
+	if o.Retention <= 0 {
+		o.Retention = 30 * 24 * time.Hour
+	}
+	if o.BatchSize <= 0 {
+		o.BatchSize = 500
+	}
+	if o.Clock == nil {
+		o.Clock = time.Now
+	}
+}
+
+// Purger purges the deleted users in db, when asked with Purge or on a
+// schedule once started
+type Purger struct {
+	db   *gorm.DB
+	opts Options
+
+	started, stopped sync.Once
+	stop             chan struct{}
+	done             chan struct{}
+	// ctx is cancelled when Close gives up waiting, abandoning the run
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// New returns a Purger of the users in db; it runs on its own only once started
+func New(db *gorm.DB, opts Options) *Purger {
+	opts.setDefaults()
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Purger{db: db, opts: opts, stop: make(chan struct{}), done: make(chan struct{}), ctx: ctx, cancel: cancel}
+}
+
+// Cutoff is when users must have been deleted before for a run to purge them
+func (p *Purger) Cutoff() time.Time {
+	return p.opts.Clock().Add(-p.opts.Retention)
+}
+
+// Purge deletes the users deleted before before for good, in batches of
+// BatchSize, and returns how many it deleted. The batches committed before
+// an error stay deleted.
+func (p *Purger) Purge(ctx context.Context, before time.Time) (int64, error) {
+	var total int64
+	for {
+		var batch []models.User
+		err := p.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			err := tx.Unscoped().Select("id", "avatar_path").
+				Where("deleted_at IS NOT NULL AND deleted_at < ?", before).
+				Order("id").Limit(p.opts.BatchSize).Find(&batch).Error
+			if err != nil || len(batch) == 0 {
+				return err
+			}
+			ids := make([]int, len(batch))
+			for i, user := range batch {
+				ids[i] = user.ID
+			}
+			return tx.Unscoped().Delete(&models.User{}, ids).Error
+		})
+		if err != nil {
+			return total, fmt.Errorf("purge: users deleted before %s: %w", before.Format(time.RFC3339), err)
+		}
+		total += int64(len(batch))
+		UsersPurged.Add(float64(len(batch)))
+		// The files go once the rows are gone, so a failed batch keeps its avatars
+		for _, user := range batch {
+			if user.AvatarPath != "" {
+				if err := os.Remove(user.AvatarPath); err != nil && !os.IsNotExist(err) {
+					slog.Warn("purged user's avatar not removed", "user_id", user.ID, "error", err.Error())
+				}
+			}
+		}
+		if len(batch) < p.opts.BatchSize {
+			return total, nil
+		}
+	}
+}
+
+// Start purges the users deleted longer than Retention ago on every tick,
+// until Close. Later calls do nothing.
+func (p *Purger) Start() {
+	p.started.Do(func() {
+		ticks := p.opts.Ticks
+		var ticker *time.Ticker
+		if ticks == nil {
+			ticker = time.NewTicker(p.opts.Interval)
+			ticks = ticker.C
+		}
+		go func() {
+			defer close(p.done)
+			if ticker != nil {
+				defer ticker.Stop()
+			}
+			for {
+				select {
+				case <-p.stop:
+					return
+				case <-ticks:
+					p.run()
+				}
+			}
+		}()
+	})
+}
+
+// run makes one scheduled purge, logging how it went
+func (p *Purger) run() {
+	before := p.Cutoff()
+	start := time.Now()
+	purged, err := p.Purge(p.ctx, before)
+	if err != nil {
+		slog.Error("purge failed", "purged", purged, "error", err.Error())
+		return
+	}
+	slog.Info("purged deleted users", "purged", purged, "before", before.Format(time.RFC3339), "duration", time.Since(start).String())
+}
+
+// Close stops the schedule, waiting for a run in progress until ctx is done
+// and abandoning it then. Purges asked for with Purge are not waited for.
+func (p *Purger) Close(ctx context.Context) error {
+	// Never started, there is nothing to wait for
+	p.started.Do(func() { close(p.done) })
+	p.stopped.Do(func() { close(p.stop) })
+
+	select {
+	case <-p.done:
+		p.cancel()
+		return nil
+	case <-ctx.Done():
+		p.cancel()
+		<-p.done
+		return fmt.Errorf("purge: run abandoned: %w", ctx.Err())
+	}
+}
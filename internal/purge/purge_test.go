@@ -0,0 +1,137 @@
+package purge
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"Unit-Test/internal/models"
+	"Unit-Test/internal/storage"
+	"Unit-Test/internal/testsupport/fixtures"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// now is the time of the fake clock
+var now = time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+// fakeClock is a Clock tests move by hand
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Set(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = now
+}
+
+// openTestDB is a migrated in-memory database of t's own, cascading deletes
+func openTestDB(t *testing.T) *gorm.DB {
+	conn, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared&_foreign_keys=1"), &gorm.Config{TranslateError: true})
+	require.NoError(t, err)
+	t.Cleanup(func() { storage.Close(conn) })
+	require.NoError(t, storage.AutoMigrate(conn))
+	return conn
+}
+
+// remaining are the ids of the users left in db, deleted or not
+func remaining(t *testing.T, db *gorm.DB) []int {
+	t.Helper()
+	var ids []int
+	require.NoError(t, db.Unscoped().Model(&models.User{}).Order("id").Pluck("id", &ids).Error)
+	return ids
+}
+
+func TestPurgeDeletesOnlyOldUsers(t *testing.T) {
+	db := openTestDB(t)
+	active := fixtures.NewUser(t, db)
+	recent := fixtures.NewUser(t, db, fixtures.DeletedAt(now.Add(-24*time.Hour)))
+	old := fixtures.SeedUsers(t, db, 5, fixtures.DeletedAt(now.Add(-60*24*time.Hour)))
+	fixtures.NewPost(t, db, old[0])
+	p := New(db, Options{BatchSize: 2, Clock: func() time.Time { return now }})
+	before := testutil.ToFloat64(UsersPurged)
+
+	purged, err := p.Purge(context.Background(), p.Cutoff())
+	require.NoError(t, err)
+	assert.EqualValues(t, 5, purged)
+	assert.Equal(t, []int{active.ID, recent.ID}, remaining(t, db))
+	assert.Equal(t, before+5, testutil.ToFloat64(UsersPurged))
+
+	var posts int64
+	require.NoError(t, db.Model(&models.Post{}).Where("user_id = ?", old[0].ID).Count(&posts).Error)
+	assert.Zero(t, posts, "the posts of purged users go with them")
+
+	purged, err = p.Purge(context.Background(), p.Cutoff())
+	require.NoError(t, err)
+	assert.Zero(t, purged)
+}
+
+func TestPurgeRemovesAvatars(t *testing.T) {
+	db := openTestDB(t)
+	user := fixtures.NewUser(t, db, fixtures.DeletedAt(now.Add(-time.Hour)))
+	avatar := filepath.Join(t.TempDir(), "avatar.png")
+	require.NoError(t, os.WriteFile(avatar, []byte("png"), 0o600))
+	require.NoError(t, db.Unscoped().Model(&user).UpdateColumn("avatar_path", avatar).Error)
+
+	purged, err := New(db, Options{}).Purge(context.Background(), now)
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, purged)
+	assert.NoFileExists(t, avatar)
+}
+
+func TestPurgerRunsOnEveryTick(t *testing.T) {
+	db := openTestDB(t)
+	clock := &fakeClock{now: now}
+	ticks := make(chan time.Time)
+	fixtures.NewUser(t, db, fixtures.DeletedAt(now.Add(-8*24*time.Hour)))
+	recent := fixtures.NewUser(t, db, fixtures.DeletedAt(now.Add(-6*24*time.Hour)))
+	active := fixtures.NewUser(t, db)
+
+	// Started after the fixtures, so it is closed before they are removed
+	p := New(db, Options{Retention: 7 * 24 * time.Hour, Clock: clock.Now, Ticks: ticks})
+	p.Start()
+	t.Cleanup(func() { p.Close(context.Background()) })
+
+	// A second tick is only taken once the first run is done
+	ticks <- now
+	ticks <- now
+	assert.Equal(t, []int{recent.ID, active.ID}, remaining(t, db))
+
+	clock.Set(now.Add(2 * 24 * time.Hour))
+	ticks <- clock.Now()
+	ticks <- clock.Now()
+	assert.Equal(t, []int{active.ID}, remaining(t, db))
+}
+
+func TestPurgerClose(t *testing.T) {
+	db := openTestDB(t)
+	ticks := make(chan time.Time)
+	p := New(db, Options{Ticks: ticks})
+	p.Start()
+	require.NoError(t, p.Close(context.Background()))
+	require.NoError(t, p.Close(context.Background()), "closing twice")
+
+	select {
+	case ticks <- now:
+		t.Fatal("a tick was taken after Close")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	// A Purger that never started has nothing to wait for
+	require.NoError(t, New(db, Options{}).Close(context.Background()))
+}
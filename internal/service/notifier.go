@@ -0,0 +1,41 @@
+package service
+
+import "log/slog"
+
+// Notifier delivers messages to users outside the API, such as password reset
+// links. Implementations must be safe for concurrent use, and should not keep
+// the caller waiting on the delivery: the request that triggers one never
+// fails because of it.
+type Notifier interface {
+	SendUserWelcome(email, name string) error
+	SendPasswordReset(email, token string) error
+	SendEmailVerification(email, token string) error
+}
+
+// LogNotifier writes notifications to the log instead of sending them.
+// It prints the secrets it is given, so it only suits development.
+type LogNotifier struct{}
+
+func (LogNotifier) SendUserWelcome(email, name string) error {
+	slog.Info("user welcome", "email", email, "name", name)
+	return nil
+}
+
+func (LogNotifier) SendPasswordReset(email, token string) error {
+	slog.Info("password reset", "email", email, "token", token)
+	return nil
+}
+
+func (LogNotifier) SendEmailVerification(email, token string) error {
+	slog.Info("email verification", "email", email, "token", token)
+	return nil
+}
+
+// NopNotifier sends nothing
+type NopNotifier struct{}
+
+func (NopNotifier) SendUserWelcome(string, string) error { return nil }
+
+func (NopNotifier) SendPasswordReset(string, string) error { return nil }
+
+func (NopNotifier) SendEmailVerification(string, string) error { return nil }
@@ -0,0 +1,58 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"Unit-Test/internal/models"
+	"Unit-Test/internal/storage"
+)
+
+// Names the seeded users are made of
+var (
+	seedFirstNames = []string{"Ada", "Alan", "Barbara", "Dennis", "Edsger", "Grace", "Ken", "Margaret", "Niklaus", "Radia"}
+	seedLastNames  = []string{"Hopper", "Knuth", "Lamport", "Liskov", "Lovelace", "Perlman", "Ritchie", "Thompson", "Turing", "Wirth"}
+)
+
+// SeedUser is the i-th fake user Seed creates. The same index always gives the
+// same user, so seeding is reproducible.
+func SeedUser(i int) models.User {
+	first := seedFirstNames[i%len(seedFirstNames)]
+	last := seedLastNames[(i/len(seedFirstNames))%len(seedLastNames)]
+	return models.User{
+		Name:  first + " " + last,
+		Email: fmt.Sprintf("seed-%04d@example.com", i),
+	}
+}
+
+// SeedSummary counts what Seed did
+type SeedSummary struct {
+	Created int
+	Skipped int
+}
+
+func (s SeedSummary) String() string {
+	return fmt.Sprintf("%d users created, %d already existed", s.Created, s.Skipped)
+}
+
+// Seed creates the fake users 1 to count for local development, skipping
+// those whose email is taken already, so running it again adds nothing. The
+// users go through Create like any other, audited as made by "seed".
+func (s *UserService) Seed(ctx context.Context, count int) (SeedSummary, error) {
+	ctx = WithActor(ctx, "seed")
+	var summary SeedSummary
+	for i := 1; i <= count; i++ {
+		user := SeedUser(i)
+		err := s.Create(ctx, &user)
+		switch {
+		case errors.Is(err, storage.ErrDuplicateEmail):
+			summary.Skipped++
+		case err != nil:
+			return summary, fmt.Errorf("seeding %s: %w", user.Email, err)
+		default:
+			summary.Created++
+		}
+	}
+	return summary, nil
+}
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"Unit-Test/internal/models"
+	"Unit-Test/internal/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// newSQLiteService returns a UserService over a migrated SQLite database of t's own
+func newSQLiteService(t *testing.T) (*UserService, *gorm.DB) {
+	conn, err := storage.Opener{
+		Driver: storage.DriverSQLite,
+		DSN:    "file:" + t.Name() + "?mode=memory",
+		Config: &gorm.Config{TranslateError: true},
+	}.Open()
+	require.NoError(t, err)
+	t.Cleanup(func() { storage.Close(conn) })
+	require.NoError(t, storage.Migrate(context.Background(), conn))
+
+	return NewUserService(Deps{
+		Users: storage.NewUserRepository(conn),
+		Audit: storage.NewAuditRepository(conn),
+		Tx:    storage.NewTransactor(conn),
+	}), conn
+}
+
+func TestSeedIsIdempotent(t *testing.T) {
+	users, conn := newSQLiteService(t)
+	ctx := context.Background()
+
+	summary, err := users.Seed(ctx, 25)
+	require.NoError(t, err)
+	assert.Equal(t, SeedSummary{Created: 25}, summary)
+
+	// A second run only adds the users past the first
+	summary, err = users.Seed(ctx, 30)
+	require.NoError(t, err)
+	assert.Equal(t, SeedSummary{Created: 5, Skipped: 25}, summary)
+	assert.Equal(t, "5 users created, 25 already existed", summary.String())
+
+	var count int64
+	conn.Model(&models.User{}).Count(&count)
+	assert.Equal(t, int64(30), count)
+
+	var first models.User
+	require.NoError(t, conn.First(&first, "email = ?", "seed-0001@example.com").Error)
+	assert.Equal(t, "Alan Hopper", first.Name)
+
+	var audited int64
+	conn.Model(&models.AuditLog{}).Where("actor = ?", "seed").Count(&audited)
+	assert.Equal(t, int64(30), audited)
+}
+
+func TestSeedUserIsDeterministic(t *testing.T) {
+	assert.Equal(t, SeedUser(42), SeedUser(42))
+	assert.Equal(t, models.User{Name: "Grace Lamport", Email: "seed-0025@example.com"}, SeedUser(25))
+
+	// Emails never repeat, even once the names do
+	emails := map[string]bool{}
+	for i := 1; i <= 250; i++ {
+		emails[SeedUser(i).Email] = true
+	}
+	assert.Len(t, emails, 250)
+}
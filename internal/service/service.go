@@ -0,0 +1,96 @@
+// Package service holds the business rules of the API between the handlers
+// and the repositories: normalization, duplicate checks, auditing, events and
+// where transactions start
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"Unit-Test/internal/models"
+)
+
+// Clock tells the services the time
+type Clock func() time.Time
+
+// Kinds of Event
+const (
+	EventUserCreated = "user.created"
+	EventUserUpdated = "user.updated"
+	EventUserDeleted = "user.deleted"
+)
+
+// Event is a change to a user, published once it is committed
+type Event struct {
+	Type   string
+	UserID int
+	Actor  string
+	At     time.Time
+	// User as it is after the change; for deletions, as it was before
+	User *models.User
+}
+
+// Publisher tells whoever listens about events. The change an event describes
+// is already committed, so a failure to publish it is logged, not returned.
+type Publisher interface {
+	Publish(ctx context.Context, event Event) error
+}
+
+// NopPublisher drops every event
+type NopPublisher struct{}
+
+func (NopPublisher) Publish(context.Context, Event) error { return nil }
+
+// Publishers publishes every event to each of its publishers, even when one
+// of them fails
+type Publishers []Publisher
+
+func (ps Publishers) Publish(ctx context.Context, event Event) error {
+	var errs []error
+	for _, p := range ps {
+		if err := p.Publish(ctx, event); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// MemoryPublisher keeps the events it is given, for tests to assert on.
+// Setting Err makes every Publish fail with it, after recording the event.
+type MemoryPublisher struct {
+	mu     sync.Mutex
+	events []Event
+	Err    error
+}
+
+func (p *MemoryPublisher) Publish(_ context.Context, event Event) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.events = append(p.events, event)
+	return p.Err
+}
+
+// Events returns the events published so far, oldest first
+func (p *MemoryPublisher) Events() []Event {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]Event(nil), p.events...)
+}
+
+type actorKey struct{}
+
+// WithActor names who makes the changes done with the returned context, for
+// the audit log and events
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// actorFrom is the actor ctx names, or "anonymous"
+func actorFrom(ctx context.Context) string {
+	if actor, ok := ctx.Value(actorKey{}).(string); ok && actor != "" {
+		return actor
+	}
+	return "anonymous"
+}
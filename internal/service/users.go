@@ -0,0 +1,393 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+
+	"Unit-Test/internal/models"
+	"Unit-Test/internal/storage"
+)
+
+// Deps are what a UserService is built from
+type Deps struct {
+	Users storage.UserRepository
+	Audit storage.AuditRepository
+	Tx    storage.Transactor
+	// Clock defaults to time.Now
+	Clock Clock
+	// Events defaults to a NopPublisher
+	Events Publisher
+	// Notifier welcomes the users created; defaults to a NopNotifier
+	Notifier Notifier
+	// Logger reports the events and welcomes that fail; defaults to slog.Default()
+	Logger *slog.Logger
+}
+
+// Errors the UserService returns besides the repositories'
+var (
+	// ErrNotDeleted is returned by Restore for a user that is not deleted
+	ErrNotDeleted = errors.New("user is not deleted")
+	// ErrRejected is returned by CreateMany when it rolls back every user
+	// because some were rejected
+	ErrRejected = errors.New("users rejected")
+)
+
+// Step is more work done in the transaction of a change, after the user is
+// written; before is nil for creates and after is nil for deletes. A failing
+// step rolls the change back.
+type Step func(ctx context.Context, before, after *models.User) error
+
+// UserService creates, updates and deletes users. Each change is normalized,
+// checked for duplicate emails and audited in one transaction, and published
+// once committed, when each user created is welcomed too.
+type UserService struct {
+	users    storage.UserRepository
+	audit    storage.AuditRepository
+	tx       storage.Transactor
+	now      Clock
+	events   Publisher
+	notifier Notifier
+	logger   *slog.Logger
+}
+
+// NewUserService returns the UserService working on deps
+func NewUserService(deps Deps) *UserService {
+	s := &UserService{users: deps.Users, audit: deps.Audit, tx: deps.Tx, now: deps.Clock, events: deps.Events, notifier: deps.Notifier, logger: deps.Logger}
+	if s.now == nil {
+		s.now = time.Now
+	}
+	if s.events == nil {
+		s.events = NopPublisher{}
+	}
+	if s.notifier == nil {
+		s.notifier = NopNotifier{}
+	}
+	if s.logger == nil {
+		s.logger = slog.Default()
+	}
+	return s
+}
+
+// Create stores user, filling in its id, timestamps and version. It returns
+// storage.ErrDuplicateEmail when an active user has the email already.
+func (s *UserService) Create(ctx context.Context, user *models.User, steps ...Step) error {
+	user.Normalize()
+	err := s.tx.InTx(ctx, func(ctx context.Context) error {
+		if err := s.checkEmailFree(ctx, user.Email, 0); err != nil {
+			return err
+		}
+		if err := s.users.Create(ctx, user); err != nil {
+			return err
+		}
+		return s.finish(ctx, models.AuditCreate, user.ID, nil, user, steps)
+	})
+	if err != nil {
+		return err
+	}
+	s.created(ctx, user)
+	return nil
+}
+
+// Rejection is why CreateMany skipped the user at Index: check's error, or
+// storage.ErrDuplicateEmail
+type Rejection struct {
+	Index int
+	Err   error
+}
+
+// CreateMany stores users in one transaction, each as Create would, except
+// that it skips those check fails once they are normalized and those whose
+// email an active user or an earlier one of users has. The others get their
+// ids filled in. With all set, any rejection rolls back the others too and
+// CreateMany returns ErrRejected along with the rejections.
+func (s *UserService) CreateMany(ctx context.Context, users []models.User, check func(user *models.User) error, all bool) ([]Rejection, error) {
+	var rejected []Rejection
+	var created []int
+	err := s.tx.InTx(ctx, func(ctx context.Context) error {
+		emails := make([]string, len(users))
+		for i := range users {
+			users[i].Normalize()
+			emails[i] = users[i].Email
+		}
+		taken, err := s.users.EmailsInUse(ctx, emails)
+		if err != nil {
+			return err
+		}
+
+		var batch []models.User
+		for i, user := range users {
+			email := strings.ToLower(user.Email)
+			if err := check(&user); err != nil {
+				rejected = append(rejected, Rejection{Index: i, Err: err})
+				continue
+			}
+			if taken[email] {
+				rejected = append(rejected, Rejection{Index: i, Err: storage.ErrDuplicateEmail})
+				continue
+			}
+			// Later users with the same email collide with this one
+			taken[email] = true
+			batch = append(batch, user)
+			created = append(created, i)
+		}
+		if all && len(rejected) > 0 {
+			return ErrRejected
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+
+		if err := s.users.CreateMany(ctx, batch); err != nil {
+			return err
+		}
+		for j, i := range created {
+			users[i] = batch[j]
+			if err := s.finish(ctx, models.AuditCreate, users[i].ID, nil, &users[i], nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, ErrRejected) {
+		return rejected, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, i := range created {
+		s.created(ctx, &users[i])
+	}
+	return rejected, nil
+}
+
+// Upsert creates the user with email, or updates the active user that has
+// it already; set makes the changes either way. It reports whether the user
+// was created. The lookup and the write share a transaction, so this works
+// the same on every database, without an upsert statement.
+func (s *UserService) Upsert(ctx context.Context, email string, set func(user *models.User), steps ...Step) (models.User, bool, error) {
+	var user models.User
+	var created bool
+	upsert := func(ctx context.Context) error {
+		created = false
+		before, err := s.users.GetByEmail(ctx, email)
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			user = models.User{Email: email}
+			set(&user)
+			user.Normalize()
+			created = true
+			if err := s.users.Create(ctx, &user); err != nil {
+				return err
+			}
+			return s.finish(ctx, models.AuditCreate, user.ID, nil, &user, steps)
+		case err != nil:
+			return err
+		}
+		user = before
+		set(&user)
+		user.Normalize()
+		if err := s.users.Update(ctx, &user); err != nil {
+			return err
+		}
+		return s.finish(ctx, models.AuditUpdate, user.ID, &before, &user, steps)
+	}
+	err := s.tx.InTx(ctx, upsert)
+	if created && errors.Is(err, storage.ErrDuplicateEmail) {
+		// Another request inserted the email after the lookup; this time the
+		// lookup finds its user, which is updated instead
+		err = s.tx.InTx(ctx, upsert)
+	}
+	if err != nil {
+		return models.User{}, false, err
+	}
+	if created {
+		s.created(ctx, &user)
+	} else {
+		s.publish(ctx, EventUserUpdated, user.ID, &user)
+	}
+	return user, created, nil
+}
+
+// Update stores user if user.Version is still the stored version, and bumps
+// it. It returns storage.ErrNotFound, storage.ErrVersionConflict or
+// storage.ErrDuplicateEmail.
+func (s *UserService) Update(ctx context.Context, user *models.User, steps ...Step) error {
+	user.Normalize()
+	version := user.Version
+	err := s.tx.InTx(ctx, func(ctx context.Context) error {
+		before, err := s.users.Get(ctx, user.ID)
+		if err != nil {
+			return err
+		}
+		if before.Email != user.Email {
+			if err := s.checkEmailFree(ctx, user.Email, user.ID); err != nil {
+				return err
+			}
+		}
+		if err := s.users.Update(ctx, user); err != nil {
+			return err
+		}
+		return s.finish(ctx, models.AuditUpdate, user.ID, &before, user, steps)
+	})
+	if err != nil {
+		// The rolled back update no longer counts
+		user.Version = version
+		return err
+	}
+	s.publish(ctx, EventUserUpdated, user.ID, user)
+	return nil
+}
+
+// Delete soft-deletes the user with id, or returns storage.ErrNotFound
+func (s *UserService) Delete(ctx context.Context, id int, steps ...Step) error {
+	var before models.User
+	err := s.tx.InTx(ctx, func(ctx context.Context) error {
+		var err error
+		before, err = s.users.Get(ctx, id)
+		if err != nil {
+			return err
+		}
+		if err := s.users.Delete(ctx, id); err != nil {
+			return err
+		}
+		return s.finish(ctx, models.AuditDelete, id, &before, nil, steps)
+	})
+	if err != nil {
+		return err
+	}
+	s.publish(ctx, EventUserDeleted, id, &before)
+	return nil
+}
+
+// UpdatePreferences replaces the preferences of the user with id with what
+// merge makes of them, and returns the user. It returns storage.ErrNotFound,
+// or merge's error.
+func (s *UserService) UpdatePreferences(ctx context.Context, id int, merge func(prefs models.Preferences) (models.Preferences, error)) (models.User, error) {
+	return s.updateColumns(ctx, id, func(ctx context.Context, user *models.User) error {
+		prefs, err := merge(user.Preferences)
+		if err != nil {
+			return err
+		}
+		user.Preferences = prefs
+		return s.users.UpdatePreferences(ctx, id, prefs)
+	})
+}
+
+// SetAvatar records path as the avatar of the user with id, and returns the
+// user. It returns storage.ErrNotFound.
+func (s *UserService) SetAvatar(ctx context.Context, id int, path string) (models.User, error) {
+	return s.updateColumns(ctx, id, func(ctx context.Context, user *models.User) error {
+		user.AvatarPath = path
+		return s.users.UpdateAvatar(ctx, id, path)
+	})
+}
+
+// updateColumns is an update of the user with id that write makes, audited
+// and published like Update's
+func (s *UserService) updateColumns(ctx context.Context, id int, write func(ctx context.Context, user *models.User) error) (models.User, error) {
+	var user models.User
+	err := s.tx.InTx(ctx, func(ctx context.Context) error {
+		before, err := s.users.Get(ctx, id)
+		if err != nil {
+			return err
+		}
+		user = before
+		if err := write(ctx, &user); err != nil {
+			return err
+		}
+		return s.finish(ctx, models.AuditUpdate, id, &before, &user, nil)
+	})
+	if err != nil {
+		return models.User{}, err
+	}
+	s.publish(ctx, EventUserUpdated, id, &user)
+	return user, nil
+}
+
+// Restore undoes the soft delete of the user with id, and returns the user.
+// It returns storage.ErrNotFound, ErrNotDeleted, or storage.ErrDuplicateEmail
+// when an active user has the email since. A restore is published as an
+// update.
+func (s *UserService) Restore(ctx context.Context, id int, steps ...Step) (models.User, error) {
+	var user models.User
+	err := s.tx.InTx(ctx, func(ctx context.Context) error {
+		found, err := s.users.List(ctx, storage.UserFilter{IDs: []int{id}, IncludeDeleted: true}, storage.ListOptions{})
+		switch {
+		case err != nil:
+			return err
+		case len(found) == 0:
+			return storage.ErrNotFound
+		case !found[0].DeletedAt.Valid:
+			return ErrNotDeleted
+		}
+		before := found[0]
+		if err := s.checkEmailFree(ctx, before.Email, id); err != nil {
+			return err
+		}
+		if err := s.users.Restore(ctx, id); err != nil {
+			return err
+		}
+		if user, err = s.users.Get(ctx, id); err != nil {
+			return err
+		}
+		return s.finish(ctx, models.AuditRestore, id, &before, &user, steps)
+	})
+	if err != nil {
+		return models.User{}, err
+	}
+	s.publish(ctx, EventUserUpdated, id, &user)
+	return user, nil
+}
+
+// checkEmailFree fails with storage.ErrDuplicateEmail if an active user other
+// than id has email
+func (s *UserService) checkEmailFree(ctx context.Context, email string, id int) error {
+	existing, err := s.users.GetByEmail(ctx, email)
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		return nil
+	case err != nil:
+		return err
+	case existing.ID != id:
+		return storage.ErrDuplicateEmail
+	}
+	return nil
+}
+
+// finish runs the caller's steps for a change and records it in the audit log
+func (s *UserService) finish(ctx context.Context, action string, userID int, before, after *models.User, steps []Step) error {
+	for _, step := range steps {
+		if err := step(ctx, before, after); err != nil {
+			return err
+		}
+	}
+	entry := models.AuditLog{
+		Actor:     actorFrom(ctx),
+		Action:    action,
+		UserID:    userID,
+		Before:    models.SnapshotOf(before),
+		After:     models.SnapshotOf(after),
+		CreatedAt: s.now(),
+	}
+	return s.audit.Record(ctx, &entry)
+}
+
+// created publishes the creation of user and welcomes them. A welcome that
+// can't be sent is logged, as the user is there all the same.
+func (s *UserService) created(ctx context.Context, user *models.User) {
+	s.publish(ctx, EventUserCreated, user.ID, user)
+	if err := s.notifier.SendUserWelcome(user.Email, user.Name); err != nil {
+		s.logger.Error("welcome email not sent", "user_id", user.ID, "error", err.Error())
+	}
+}
+
+// publish tells the listeners about a committed change, logging failures
+func (s *UserService) publish(ctx context.Context, kind string, userID int, user *models.User) {
+	event := Event{Type: kind, UserID: userID, Actor: actorFrom(ctx), At: s.now(), User: user}
+	if err := s.events.Publish(ctx, event); err != nil {
+		s.logger.Error("event not published", "type", kind, "user_id", userID, "error", err.Error())
+	}
+}
@@ -0,0 +1,520 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"Unit-Test/internal/models"
+	"Unit-Test/internal/storage"
+	"Unit-Test/internal/testsupport"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testFixture is a UserService over fakes, with the fakes to inspect
+type testFixture struct {
+	service *UserService
+	users   *testsupport.FakeUserRepository
+	audit   *testsupport.FakeAuditRepository
+	events  *MemoryPublisher
+}
+
+var testNow = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+func newFixture() testFixture {
+	users, audit := testsupport.NewFakeUserRepository(), testsupport.NewFakeAuditRepository()
+	events := &MemoryPublisher{}
+	service := NewUserService(Deps{
+		Users:  users,
+		Audit:  audit,
+		Tx:     testsupport.NewFakeTransactor(users, audit),
+		Clock:  func() time.Time { return testNow },
+		Events: events,
+	})
+	return testFixture{service: service, users: users, audit: audit, events: events}
+}
+
+func TestCreateNormalizesAndAudits(t *testing.T) {
+	f := newFixture()
+	ctx := WithActor(context.Background(), "7")
+
+	user := models.User{Name: "  Ada \t Lovelace ", Email: " Ada@Example.COM "}
+	require.NoError(t, f.service.Create(ctx, &user))
+	assert.Equal(t, "Ada Lovelace", user.Name)
+	assert.Equal(t, "ada@example.com", user.Email)
+
+	stored, err := f.users.GetByEmail(ctx, "ada@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, stored.ID)
+
+	entries := f.audit.Entries()
+	if assert.Len(t, entries, 1) {
+		assert.Equal(t, models.AuditCreate, entries[0].Action)
+		assert.Equal(t, "7", entries[0].Actor)
+		assert.Equal(t, user.ID, entries[0].UserID)
+		assert.Nil(t, entries[0].Before)
+		assert.Contains(t, string(entries[0].After), `"email":"ada@example.com"`)
+		assert.Equal(t, testNow, entries[0].CreatedAt)
+	}
+	if assert.Len(t, f.events.Events(), 1) {
+		assert.Equal(t, Event{Type: EventUserCreated, UserID: user.ID, Actor: "7", At: testNow, User: &user}, f.events.Events()[0])
+	}
+}
+
+func TestCreateDuplicateEmail(t *testing.T) {
+	f := newFixture()
+	ctx := context.Background()
+	require.NoError(t, f.service.Create(ctx, &models.User{Name: "Alice", Email: "alice@example.com"}))
+
+	err := f.service.Create(ctx, &models.User{Name: "Other", Email: " ALICE@example.com"})
+	assert.ErrorIs(t, err, storage.ErrDuplicateEmail)
+	count, _ := f.users.Count(ctx, storage.UserFilter{})
+	assert.Equal(t, int64(1), count)
+	assert.Len(t, f.audit.Entries(), 1)
+	assert.Len(t, f.events.Events(), 1)
+}
+
+func TestCreateRollsBackWhenAuditFails(t *testing.T) {
+	f := newFixture()
+	ctx := context.Background()
+	f.audit.Err = errors.New("audit log unavailable")
+
+	err := f.service.Create(ctx, &models.User{Name: "Alice", Email: "alice@example.com"})
+	assert.ErrorIs(t, err, f.audit.Err)
+
+	_, err = f.users.GetByEmail(ctx, "alice@example.com")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	assert.Empty(t, f.events.Events())
+}
+
+func TestCreateRollsBackWhenStepFails(t *testing.T) {
+	f := newFixture()
+	ctx := context.Background()
+	failed := errors.New("failed")
+
+	var seen *models.User
+	err := f.service.Create(ctx, &models.User{Name: "Alice", Email: "alice@example.com"}, func(_ context.Context, before, after *models.User) error {
+		assert.Nil(t, before)
+		seen = after
+		return failed
+	})
+	assert.ErrorIs(t, err, failed)
+	if assert.NotNil(t, seen) {
+		assert.NotZero(t, seen.ID)
+	}
+
+	count, _ := f.users.Count(ctx, storage.UserFilter{})
+	assert.Zero(t, count)
+	assert.Empty(t, f.audit.Entries())
+}
+
+func TestUpdate(t *testing.T) {
+	f := newFixture()
+	ctx := context.Background()
+	user := models.User{Name: "Alice", Email: "alice@example.com"}
+	require.NoError(t, f.service.Create(ctx, &user))
+
+	user.Name = " Alice  Smith "
+	require.NoError(t, f.service.Update(ctx, &user))
+	assert.Equal(t, "Alice Smith", user.Name)
+	assert.Equal(t, 2, user.Version)
+
+	entries := f.audit.Entries()
+	if assert.Len(t, entries, 2) {
+		assert.Equal(t, models.AuditUpdate, entries[1].Action)
+		assert.Contains(t, string(entries[1].Before), `"name":"Alice"`)
+		assert.Contains(t, string(entries[1].After), `"name":"Alice Smith"`)
+	}
+	if assert.Len(t, f.events.Events(), 2) {
+		assert.Equal(t, EventUserUpdated, f.events.Events()[1].Type)
+	}
+}
+
+func TestUpdateErrors(t *testing.T) {
+	f := newFixture()
+	ctx := context.Background()
+	alice := models.User{Name: "Alice", Email: "alice@example.com"}
+	bob := models.User{Name: "Bob", Email: "bob@example.com"}
+	require.NoError(t, f.service.Create(ctx, &alice))
+	require.NoError(t, f.service.Create(ctx, &bob))
+
+	taken := alice
+	taken.Email = "BOB@example.com"
+	assert.ErrorIs(t, f.service.Update(ctx, &taken), storage.ErrDuplicateEmail)
+
+	stale := alice
+	stale.Version = 5
+	assert.ErrorIs(t, f.service.Update(ctx, &stale), storage.ErrVersionConflict)
+
+	gone := models.User{ID: 99, Name: "Gone", Email: "gone@example.com", Version: 1}
+	assert.ErrorIs(t, f.service.Update(ctx, &gone), storage.ErrNotFound)
+
+	f.audit.Err = errors.New("audit log unavailable")
+	renamed := alice
+	renamed.Name = "Renamed"
+	assert.ErrorIs(t, f.service.Update(ctx, &renamed), f.audit.Err)
+	assert.Equal(t, 1, renamed.Version)
+	stored, _ := f.users.Get(ctx, alice.ID)
+	assert.Equal(t, "Alice", stored.Name)
+	assert.Equal(t, 1, stored.Version)
+
+	assert.Len(t, f.events.Events(), 2)
+}
+
+func TestDelete(t *testing.T) {
+	f := newFixture()
+	ctx := context.Background()
+	user := models.User{Name: "Alice", Email: "alice@example.com"}
+	require.NoError(t, f.service.Create(ctx, &user))
+
+	f.audit.Err = errors.New("audit log unavailable")
+	assert.ErrorIs(t, f.service.Delete(ctx, user.ID), f.audit.Err)
+	_, err := f.users.Get(ctx, user.ID)
+	assert.NoError(t, err, "the delete rolled back")
+
+	f.audit.Err = nil
+	require.NoError(t, f.service.Delete(ctx, user.ID))
+	_, err = f.users.Get(ctx, user.ID)
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	assert.ErrorIs(t, f.service.Delete(ctx, user.ID), storage.ErrNotFound)
+
+	entries := f.audit.Entries()
+	if assert.Len(t, entries, 2) {
+		assert.Equal(t, models.AuditDelete, entries[1].Action)
+		assert.Equal(t, "anonymous", entries[1].Actor)
+		assert.Nil(t, entries[1].After)
+	}
+	if assert.Len(t, f.events.Events(), 2) {
+		deleted := f.events.Events()[1]
+		assert.Equal(t, EventUserDeleted, deleted.Type)
+		assert.Equal(t, user.ID, deleted.UserID)
+		if assert.NotNil(t, deleted.User, "the user as it was") {
+			assert.Equal(t, "alice@example.com", deleted.User.Email)
+		}
+	}
+}
+
+// requireName rejects users without a name, like the handlers' checks do
+func requireName(user *models.User) error {
+	if user.Name == "" {
+		return errors.New("name is required")
+	}
+	return nil
+}
+
+func TestCreateMany(t *testing.T) {
+	f := newFixture()
+	ctx := WithActor(context.Background(), "7")
+	require.NoError(t, f.service.Create(ctx, &models.User{Name: "Alice", Email: "alice@example.com"}))
+
+	users := []models.User{
+		{Name: "Bob", Email: " BOB@example.com"},
+		{Name: "", Email: "nobody@example.com"},
+		{Name: "Alice Again", Email: "alice@example.com"},
+		{Name: "Bob Twin", Email: "bob@example.com"},
+		{Name: "Carol", Email: "carol@example.com"},
+	}
+	rejected, err := f.service.CreateMany(ctx, users, requireName, false)
+	require.NoError(t, err)
+	if assert.Len(t, rejected, 3) {
+		assert.Equal(t, 1, rejected[0].Index)
+		assert.EqualError(t, rejected[0].Err, "name is required")
+		assert.Equal(t, Rejection{Index: 2, Err: storage.ErrDuplicateEmail}, rejected[1])
+		assert.Equal(t, Rejection{Index: 3, Err: storage.ErrDuplicateEmail}, rejected[2])
+	}
+	assert.Equal(t, "bob@example.com", users[0].Email)
+	assert.NotZero(t, users[0].ID)
+	assert.NotZero(t, users[4].ID)
+
+	count, _ := f.users.Count(ctx, storage.UserFilter{})
+	assert.Equal(t, int64(3), count)
+	assert.Len(t, f.audit.Entries(), 3)
+	events := f.events.Events()
+	if assert.Len(t, events, 3) {
+		assert.Equal(t, Event{Type: EventUserCreated, UserID: users[0].ID, Actor: "7", At: testNow, User: &users[0]}, events[1])
+		assert.Equal(t, Event{Type: EventUserCreated, UserID: users[4].ID, Actor: "7", At: testNow, User: &users[4]}, events[2])
+	}
+}
+
+func TestCreateManyAll(t *testing.T) {
+	f := newFixture()
+	ctx := context.Background()
+
+	users := []models.User{
+		{Name: "Bob", Email: "bob@example.com"},
+		{Name: "Bob Twin", Email: "bob@example.com"},
+	}
+	rejected, err := f.service.CreateMany(ctx, users, requireName, true)
+	assert.ErrorIs(t, err, ErrRejected)
+	assert.Equal(t, []Rejection{{Index: 1, Err: storage.ErrDuplicateEmail}}, rejected)
+
+	count, _ := f.users.Count(ctx, storage.UserFilter{})
+	assert.Zero(t, count, "the valid user rolled back too")
+	assert.Empty(t, f.audit.Entries())
+	assert.Empty(t, f.events.Events())
+}
+
+func TestCreateManyRollsBackWhenAuditFails(t *testing.T) {
+	f := newFixture()
+	ctx := context.Background()
+	f.audit.Err = errors.New("audit log unavailable")
+
+	_, err := f.service.CreateMany(ctx, []models.User{{Name: "Bob", Email: "bob@example.com"}}, requireName, false)
+	assert.ErrorIs(t, err, f.audit.Err)
+	count, _ := f.users.Count(ctx, storage.UserFilter{})
+	assert.Zero(t, count)
+	assert.Empty(t, f.events.Events())
+}
+
+func TestUpsert(t *testing.T) {
+	f := newFixture()
+	ctx := context.Background()
+	rename := func(name string) func(*models.User) {
+		return func(user *models.User) { user.Name = name }
+	}
+
+	created, isNew, err := f.service.Upsert(ctx, "alice@example.com", rename("Alice"))
+	require.NoError(t, err)
+	assert.True(t, isNew)
+	assert.Equal(t, "Alice", created.Name)
+	assert.Equal(t, 1, created.Version)
+
+	updated, isNew, err := f.service.Upsert(ctx, "alice@example.com", rename(" Alice  Smith "))
+	require.NoError(t, err)
+	assert.False(t, isNew)
+	assert.Equal(t, created.ID, updated.ID)
+	assert.Equal(t, "Alice Smith", updated.Name)
+	assert.Equal(t, 2, updated.Version)
+
+	entries := f.audit.Entries()
+	if assert.Len(t, entries, 2) {
+		assert.Equal(t, models.AuditCreate, entries[0].Action)
+		assert.Equal(t, models.AuditUpdate, entries[1].Action)
+		assert.Contains(t, string(entries[1].Before), `"name":"Alice"`)
+	}
+	events := f.events.Events()
+	if assert.Len(t, events, 2) {
+		assert.Equal(t, EventUserCreated, events[0].Type)
+		assert.Equal(t, EventUserUpdated, events[1].Type)
+		assert.Equal(t, "Alice Smith", events[1].User.Name)
+	}
+}
+
+// racingUsers misses the first lookup by email, as if another request
+// inserted the user right after it
+type racingUsers struct {
+	*testsupport.FakeUserRepository
+	raced bool
+}
+
+func (r *racingUsers) GetByEmail(ctx context.Context, email string) (models.User, error) {
+	if !r.raced {
+		r.raced = true
+		return models.User{}, storage.ErrNotFound
+	}
+	return r.FakeUserRepository.GetByEmail(ctx, email)
+}
+
+func TestUpsertRacingInsert(t *testing.T) {
+	f := newFixture()
+	ctx := context.Background()
+	other := models.User{Name: "Alice", Email: "alice@example.com"}
+	require.NoError(t, f.users.Create(ctx, &other))
+	service := NewUserService(Deps{
+		Users:  &racingUsers{FakeUserRepository: f.users},
+		Audit:  f.audit,
+		Tx:     testsupport.NewFakeTransactor(f.users, f.audit),
+		Events: f.events,
+	})
+
+	user, created, err := service.Upsert(ctx, "alice@example.com", func(user *models.User) { user.Name = "Alice Smith" })
+	require.NoError(t, err)
+	assert.False(t, created, "the insert lost the race, so the user is updated")
+	assert.Equal(t, other.ID, user.ID)
+	assert.Equal(t, "Alice Smith", user.Name)
+
+	count, _ := f.users.Count(ctx, storage.UserFilter{})
+	assert.Equal(t, int64(1), count)
+	entries := f.audit.Entries()
+	if assert.Len(t, entries, 1) {
+		assert.Equal(t, models.AuditUpdate, entries[0].Action)
+	}
+	events := f.events.Events()
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, EventUserUpdated, events[0].Type)
+	}
+}
+
+// welcomeLog records the users a Notifier is asked to welcome
+type welcomeLog struct {
+	NopNotifier
+	welcomed []string
+}
+
+func (w *welcomeLog) SendUserWelcome(email, name string) error {
+	w.welcomed = append(w.welcomed, email)
+	return nil
+}
+
+func TestCreatedUsersAreWelcomed(t *testing.T) {
+	users, audit := testsupport.NewFakeUserRepository(), testsupport.NewFakeAuditRepository()
+	welcomes := &welcomeLog{}
+	service := NewUserService(Deps{
+		Users:    users,
+		Audit:    audit,
+		Tx:       testsupport.NewFakeTransactor(users, audit),
+		Notifier: welcomes,
+	})
+	ctx := context.Background()
+
+	require.NoError(t, service.Create(ctx, &models.User{Name: "Alice", Email: "alice@example.com"}))
+	assert.Error(t, service.Create(ctx, &models.User{Name: "Alice", Email: "alice@example.com"}))
+	_, err := service.CreateMany(ctx, []models.User{
+		{Name: "Bob", Email: "bob@example.com"},
+		{Name: "Alice", Email: "alice@example.com"},
+	}, requireName, false)
+	require.NoError(t, err)
+	_, err = service.CreateMany(ctx, []models.User{{Name: "Carol", Email: "carol@example.com"}, {Email: "nameless@example.com"}}, requireName, true)
+	assert.ErrorIs(t, err, ErrRejected)
+	for _, name := range []string{"Dave", "David"} {
+		_, _, err := service.Upsert(ctx, "dave@example.com", func(user *models.User) { user.Name = name })
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, []string{"alice@example.com", "bob@example.com", "dave@example.com"}, welcomes.welcomed)
+}
+
+// failingPublisher fails every event
+type failingPublisher struct{}
+
+func (failingPublisher) Publish(context.Context, Event) error {
+	return errors.New("broker down")
+}
+
+func TestFailuresAreLoggedThroughLogger(t *testing.T) {
+	users, audit := testsupport.NewFakeUserRepository(), testsupport.NewFakeAuditRepository()
+	var logs bytes.Buffer
+	service := NewUserService(Deps{
+		Users:  users,
+		Audit:  audit,
+		Tx:     testsupport.NewFakeTransactor(users, audit),
+		Events: failingPublisher{},
+		Logger: slog.New(slog.NewJSONHandler(&logs, nil)),
+	})
+
+	require.NoError(t, service.Create(context.Background(), &models.User{Name: "Alice", Email: "alice@example.com"}))
+	assert.Contains(t, logs.String(), `"msg":"event not published","type":"user.created","user_id":1,"error":"broker down"`)
+}
+
+func TestUpdatePreferencesAndAvatar(t *testing.T) {
+	f := newFixture()
+	ctx := context.Background()
+	user := models.User{Name: "Alice", Email: "alice@example.com"}
+	require.NoError(t, f.service.Create(ctx, &user))
+
+	updated, err := f.service.UpdatePreferences(ctx, user.ID, func(prefs models.Preferences) (models.Preferences, error) {
+		assert.Empty(t, prefs)
+		return models.Preferences{"theme": []byte(`"dark"`)}, nil
+	})
+	require.NoError(t, err)
+	assert.Contains(t, updated.Preferences, "theme")
+
+	updated, err = f.service.SetAvatar(ctx, user.ID, "avatars/1.png")
+	require.NoError(t, err)
+	assert.Equal(t, "avatars/1.png", updated.AvatarPath)
+
+	stored, _ := f.users.Get(ctx, user.ID)
+	assert.Contains(t, stored.Preferences, "theme")
+	assert.Equal(t, "avatars/1.png", stored.AvatarPath)
+	assert.Len(t, f.audit.Entries(), 3)
+	events := f.events.Events()
+	if assert.Len(t, events, 3) {
+		assert.Equal(t, EventUserUpdated, events[1].Type)
+		assert.Equal(t, EventUserUpdated, events[2].Type)
+	}
+
+	// A failing merge changes nothing and publishes nothing
+	failed := errors.New("too large")
+	_, err = f.service.UpdatePreferences(ctx, user.ID, func(models.Preferences) (models.Preferences, error) {
+		return nil, failed
+	})
+	assert.ErrorIs(t, err, failed)
+	_, err = f.service.SetAvatar(ctx, 99, "avatars/99.png")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	assert.Len(t, f.events.Events(), 3)
+}
+
+func TestRestore(t *testing.T) {
+	f := newFixture()
+	ctx := context.Background()
+	user := models.User{Name: "Alice", Email: "alice@example.com"}
+	require.NoError(t, f.service.Create(ctx, &user))
+
+	_, err := f.service.Restore(ctx, user.ID)
+	assert.ErrorIs(t, err, ErrNotDeleted)
+	_, err = f.service.Restore(ctx, 99)
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+
+	require.NoError(t, f.service.Delete(ctx, user.ID))
+	var deletedAt time.Time
+	restored, err := f.service.Restore(ctx, user.ID, func(_ context.Context, before, _ *models.User) error {
+		deletedAt = before.DeletedAt.Time
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "alice@example.com", restored.Email)
+	assert.False(t, deletedAt.IsZero(), "steps see when the user was deleted")
+	_, err = f.users.Get(ctx, user.ID)
+	assert.NoError(t, err)
+
+	entries := f.audit.Entries()
+	if assert.Len(t, entries, 3) {
+		assert.Equal(t, models.AuditRestore, entries[2].Action)
+	}
+	events := f.events.Events()
+	if assert.Len(t, events, 3) {
+		assert.Equal(t, EventUserUpdated, events[2].Type)
+		assert.Equal(t, user.ID, events[2].UserID)
+	}
+}
+
+func TestRestoreTakenEmail(t *testing.T) {
+	f := newFixture()
+	ctx := context.Background()
+	user := models.User{Name: "Alice", Email: "alice@example.com"}
+	require.NoError(t, f.service.Create(ctx, &user))
+	require.NoError(t, f.service.Delete(ctx, user.ID))
+	require.NoError(t, f.service.Create(ctx, &models.User{Name: "New Alice", Email: "alice@example.com"}))
+
+	_, err := f.service.Restore(ctx, user.ID)
+	assert.ErrorIs(t, err, storage.ErrDuplicateEmail)
+	assert.Len(t, f.events.Events(), 3)
+}
+
+func TestPublishFailureKeepsChange(t *testing.T) {
+	f := newFixture()
+	ctx := context.Background()
+	f.events.Err = errors.New("broker down")
+
+	user := models.User{Name: "Alice", Email: "alice@example.com"}
+	assert.NoError(t, f.service.Create(ctx, &user))
+	_, err := f.users.Get(ctx, user.ID)
+	assert.NoError(t, err)
+}
+
+func TestPublishersFanOut(t *testing.T) {
+	failing := &MemoryPublisher{Err: errors.New("broker down")}
+	working := &MemoryPublisher{}
+	event := Event{Type: EventUserCreated, UserID: 1}
+
+	err := Publishers{failing, working}.Publish(context.Background(), event)
+	assert.ErrorIs(t, err, failing.Err)
+	assert.Equal(t, []Event{event}, failing.Events())
+	assert.Equal(t, []Event{event}, working.Events(), "a failing publisher doesn't stop the others")
+	assert.NoError(t, Publishers{}.Publish(context.Background(), event))
+}
@@ -0,0 +1,29 @@
+package storage
+
+import (
+	"context"
+
+	"Unit-Test/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// AuditRepository stores the audit log
+type AuditRepository interface {
+	// Record appends entry to the log and fills in its id
+	Record(ctx context.Context, entry *models.AuditLog) error
+}
+
+// gormAuditRepository is the AuditRepository backed by the database
+type gormAuditRepository struct {
+	db *gorm.DB
+}
+
+// NewAuditRepository returns the AuditRepository storing the log in db
+func NewAuditRepository(db *gorm.DB) AuditRepository {
+	return gormAuditRepository{db: db}
+}
+
+func (r gormAuditRepository) Record(ctx context.Context, entry *models.AuditLog) error {
+	return Session(ctx, r.db).Create(entry).Error
+}
@@ -0,0 +1,26 @@
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"Unit-Test/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditRepositoryRecord(t *testing.T) {
+	conn := openTestDB(t)
+	require.NoError(t, AutoMigrate(conn))
+
+	entry := models.AuditLog{Actor: "1", Action: models.AuditDelete, UserID: 2, Before: models.Snapshot(`{"id":2}`)}
+	require.NoError(t, NewAuditRepository(conn).Record(context.Background(), &entry))
+	assert.NotZero(t, entry.ID)
+
+	var stored models.AuditLog
+	require.NoError(t, conn.First(&stored, entry.ID).Error)
+	assert.Equal(t, models.AuditDelete, stored.Action)
+	assert.JSONEq(t, `{"id":2}`, string(stored.Before))
+	assert.Nil(t, stored.After)
+}
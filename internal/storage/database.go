@@ -0,0 +1,154 @@
+// Package storage connects to the database and migrates its schema
+package storage
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DBOpener makes one attempt at connecting to the database
+type DBOpener interface {
+	Open() (*gorm.DB, error)
+}
+
+// Opener connects to the database at DSN with Driver, one of Drivers. gorm.Open
+// pings the server, so an unreachable or still-starting database fails here
+// rather than on first use.
+type Opener struct {
+	Driver string
+	DSN    string
+	Config *gorm.Config
+}
+
+func (o Opener) Open() (*gorm.DB, error) {
+	dialector, err := Dialector(o.Driver, o.DSN)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := gorm.Open(dialector, o.Config)
+	if err != nil {
+		// The pool may have been created before the ping failed
+		if conn != nil {
+			if sqlDB, dbErr := conn.DB(); dbErr == nil {
+				sqlDB.Close()
+			}
+		}
+		return nil, err
+	}
+	return conn, nil
+}
+
+// Delay before the second connection attempt, doubling up to connectMaxDelay
+var (
+	connectInitialDelay = 250 * time.Millisecond
+	connectMaxDelay     = 5 * time.Second
+)
+
+// Connect opens the database through opener, retrying with exponential
+// backoff and jitter until it succeeds or timeout has passed, as when the app
+// starts alongside a database that is not accepting connections yet. It gives
+// up early when ctx is cancelled.
+func Connect(ctx context.Context, opener DBOpener, timeout time.Duration) (*gorm.DB, error) {
+	deadline := time.Now().Add(timeout)
+	delay := connectInitialDelay
+	for attempt := 1; ; attempt++ {
+		conn, err := opener.Open()
+		if err == nil {
+			return conn, nil
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return nil, fmt.Errorf("giving up on the database after %d attempts: %w", attempt, err)
+		}
+		// Jitter keeps instances restarted together from retrying in step
+		wait := min(delay/2+rand.N(delay/2+1), remaining)
+		slog.Warn("database not reachable, retrying", "attempt", attempt, "error", err.Error(), "retry_in_ms", wait.Milliseconds())
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("connecting to the database: %w (last error: %v)", ctx.Err(), err)
+		case <-time.After(wait):
+		}
+		delay = min(delay*2, connectMaxDelay)
+	}
+}
+
+// PoolConfig sizes the connection pool
+type PoolConfig struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+}
+
+// ConfigurePool applies cfg to the connection pool of conn and logs the result.
+// database/sql leaves open connections unlimited by default, which lets a burst
+// of requests exhaust what the server allows.
+func ConfigurePool(conn *gorm.DB, cfg PoolConfig) error {
+	sqlDB, err := conn.DB()
+	if err != nil {
+		return err
+	}
+	sqlDB.SetMaxOpenConns(cfg.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(cfg.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	sqlDB.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+	slog.Info("database pool configured",
+		"max_open_conns", sqlDB.Stats().MaxOpenConnections,
+		"max_idle_conns", cfg.MaxIdleConns,
+		"conn_max_lifetime", cfg.ConnMaxLifetime.String(),
+		"conn_max_idle_time", cfg.ConnMaxIdleTime.String())
+	return nil
+}
+
+// PoolStats is a snapshot of the database connection pool
+type PoolStats struct {
+	MaxOpen        int   `json:"max_open" example:"25"`
+	Open           int   `json:"open" example:"3"`
+	InUse          int   `json:"in_use" example:"1"`
+	Idle           int   `json:"idle" example:"2"`
+	WaitCount      int64 `json:"wait_count" example:"0"`
+	WaitDurationMs int64 `json:"wait_duration_ms" example:"0"`
+}
+
+// Stats reports the current state of the pool behind conn, or nil when there
+// is none
+func Stats(conn *gorm.DB) *PoolStats {
+	sqlDB, err := conn.DB()
+	if err != nil {
+		return nil
+	}
+	stats := sqlDB.Stats()
+	return &PoolStats{
+		MaxOpen:        stats.MaxOpenConnections,
+		Open:           stats.OpenConnections,
+		InUse:          stats.InUse,
+		Idle:           stats.Idle,
+		WaitCount:      stats.WaitCount,
+		WaitDurationMs: stats.WaitDuration.Milliseconds(),
+	}
+}
+
+// Ping checks that conn answers before ctx is done
+func Ping(ctx context.Context, conn *gorm.DB) error {
+	sqlDB, err := conn.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
+
+// Close closes the connections of conn once nothing needs them
+func Close(conn *gorm.DB) error {
+	sqlDB, err := conn.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
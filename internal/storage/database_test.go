@@ -0,0 +1,166 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// openTestDB opens an empty in-memory SQLite database of its own for t
+func openTestDB(t *testing.T) *gorm.DB {
+	conn, err := gorm.Open(KeepKeyNames(sqlite.Open("file:"+t.Name()+"?mode=memory")), &gorm.Config{TranslateError: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { Close(conn) })
+	return conn
+}
+
+// captureLogs makes the default logger write JSON lines at level or above to
+// the returned buffer until t finishes
+func captureLogs(t *testing.T, level slog.Level) *bytes.Buffer {
+	saved := slog.Default()
+	var buf bytes.Buffer
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: level})))
+	t.Cleanup(func() { slog.SetDefault(saved) })
+	return &buf
+}
+
+// logLines decodes the captured JSON lines whose msg is msg
+func logLines(t *testing.T, buf *bytes.Buffer, msg string) []map[string]interface{} {
+	var lines []map[string]interface{}
+	scanner := bufio.NewScanner(bytes.NewReader(buf.Bytes()))
+	for scanner.Scan() {
+		var line map[string]interface{}
+		if !assert.NoError(t, json.Unmarshal(scanner.Bytes(), &line), scanner.Text()) {
+			continue
+		}
+		if line["msg"] == msg {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// flakyOpener fails its first failures attempts, then hands out conn
+type flakyOpener struct {
+	failures int
+	attempts int
+	conn     *gorm.DB
+}
+
+func (o *flakyOpener) Open() (*gorm.DB, error) {
+	o.attempts++
+	if o.attempts <= o.failures {
+		return nil, errors.New("connection refused")
+	}
+	return o.conn, nil
+}
+
+// fastRetries shrinks the backoff for the duration of a test
+func fastRetries(t *testing.T) {
+	savedInitial, savedMax := connectInitialDelay, connectMaxDelay
+	connectInitialDelay, connectMaxDelay = time.Millisecond, 4*time.Millisecond
+	t.Cleanup(func() { connectInitialDelay, connectMaxDelay = savedInitial, savedMax })
+}
+
+func TestConnectDBRetriesUntilReachable(t *testing.T) {
+	fastRetries(t)
+	logs := captureLogs(t, slog.LevelInfo)
+	db := openTestDB(t)
+	opener := &flakyOpener{failures: 2, conn: db}
+
+	conn, err := Connect(context.Background(), opener, time.Second)
+	assert.NoError(t, err)
+	assert.Same(t, db, conn)
+	assert.Equal(t, 3, opener.attempts)
+
+	retries := logLines(t, logs, "database not reachable, retrying")
+	if assert.Len(t, retries, 2) {
+		assert.Equal(t, float64(1), retries[0]["attempt"])
+		assert.Equal(t, float64(2), retries[1]["attempt"])
+		assert.Equal(t, "connection refused", retries[0]["error"])
+	}
+}
+
+func TestConnectDBGivesUpAfterTimeout(t *testing.T) {
+	fastRetries(t)
+	opener := &flakyOpener{failures: 1 << 30}
+
+	start := time.Now()
+	_, err := Connect(context.Background(), opener, 50*time.Millisecond)
+	assert.ErrorContains(t, err, "giving up on the database after")
+	assert.ErrorContains(t, err, "connection refused")
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Greater(t, opener.attempts, 2)
+}
+
+func TestConnectDBWithoutTimeoutTriesOnce(t *testing.T) {
+	opener := &flakyOpener{failures: 1}
+
+	_, err := Connect(context.Background(), opener, 0)
+	assert.EqualError(t, err, "giving up on the database after 1 attempts: connection refused")
+	assert.Equal(t, 1, opener.attempts)
+}
+
+func TestConnectDBStopsWhenCancelled(t *testing.T) {
+	// Long delays that cancellation has to cut short
+	opener := &flakyOpener{failures: 1 << 30}
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, err := Connect(ctx, opener, time.Minute)
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.Less(t, time.Since(start), connectInitialDelay)
+}
+
+func TestConfigurePool(t *testing.T) {
+	conn := openTestDB(t)
+	cfg := PoolConfig{
+		MaxOpenConns:    12,
+		MaxIdleConns:    4,
+		ConnMaxLifetime: 10 * time.Minute,
+		ConnMaxIdleTime: time.Minute,
+	}
+	logs := captureLogs(t, slog.LevelInfo)
+
+	assert.NoError(t, ConfigurePool(conn, cfg))
+
+	sqlDB, _ := conn.DB()
+	assert.Equal(t, 12, sqlDB.Stats().MaxOpenConnections)
+	// database/sql has no getters for the rest
+	settings := reflect.ValueOf(sqlDB).Elem()
+	assert.Equal(t, int64(4), settings.FieldByName("maxIdleCount").Int())
+	assert.Equal(t, int64(10*time.Minute), settings.FieldByName("maxLifetime").Int())
+	assert.Equal(t, int64(time.Minute), settings.FieldByName("maxIdleTime").Int())
+
+	lines := logLines(t, logs, "database pool configured")
+	if assert.Len(t, lines, 1) {
+		assert.Equal(t, float64(12), lines[0]["max_open_conns"])
+		assert.Equal(t, "10m0s", lines[0]["conn_max_lifetime"])
+	}
+}
+
+func TestPingAndStats(t *testing.T) {
+	conn := openTestDB(t)
+	assert.NoError(t, Ping(context.Background(), conn))
+	stats := Stats(conn)
+	if assert.NotNil(t, stats) {
+		assert.Equal(t, 1, stats.Open)
+		assert.Zero(t, stats.InUse)
+	}
+
+	assert.NoError(t, Close(conn))
+	assert.Error(t, Ping(context.Background(), conn))
+}
@@ -0,0 +1,143 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// Drivers the database can be opened with
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+	DriverMySQL    = "mysql"
+)
+
+// Drivers lists the supported drivers, for validating configuration
+var Drivers = []string{DriverPostgres, DriverSQLite, DriverMySQL}
+
+// sqliteBusyTimeout is how long SQLite waits for another connection's write
+// lock before failing with "database is locked"
+const sqliteBusyTimeout = 5 * time.Second
+
+// Dialector returns the GORM dialector opening dsn with driver, tuned for the
+// way the app uses it:
+//   - sqlite enforces foreign keys, waits for locks instead of failing at once
+//     and journals in WAL mode so reads don't block on a write. In-memory
+//     databases are shared by the whole pool.
+//   - mysql scans DATETIME columns into time.Time, in UTC. The driver already talks utf8mb4.
+//
+// With gorm.Config.TranslateError, unique violations keep the driver's message
+// naming the index they broke; see KeepKeyNames.
+func Dialector(driver, dsn string) (gorm.Dialector, error) {
+	switch driver {
+	case DriverPostgres:
+		return KeepKeyNames(postgres.Open(dsn)), nil
+	case DriverSQLite:
+		return KeepKeyNames(sqlite.Open(sqliteDSN(dsn))), nil
+	case DriverMySQL:
+		tuned, err := mysqlDSN(dsn)
+		if err != nil {
+			return nil, err
+		}
+		return KeepKeyNames(mysql.Open(tuned)), nil
+	}
+	return nil, fmt.Errorf("unsupported database driver %q, use one of %s", driver, strings.Join(Drivers, ", "))
+}
+
+// KeepKeyNames wraps dialector so the unique violations it translates to
+// gorm.ErrDuplicatedKey still carry the driver's error, which names the index
+// they broke. The repositories tell a taken email from other conflicts by it.
+func KeepKeyNames(dialector gorm.Dialector) gorm.Dialector {
+	return keyNamingDialector{Dialector: dialector}
+}
+
+type keyNamingDialector struct {
+	gorm.Dialector
+}
+
+func (d keyNamingDialector) Translate(err error) error {
+	translator, ok := d.Dialector.(gorm.ErrorTranslator)
+	if !ok {
+		return err
+	}
+	translated := translator.Translate(err)
+	if errors.Is(translated, gorm.ErrDuplicatedKey) {
+		return duplicateKeyError{err: err}
+	}
+	return translated
+}
+
+// SavePoint and RollbackTo pass nested transactions through to the driver,
+// which embedding alone would hide from GORM
+func (d keyNamingDialector) SavePoint(tx *gorm.DB, name string) error {
+	return d.Dialector.(gorm.SavePointerDialectorInterface).SavePoint(tx, name)
+}
+
+func (d keyNamingDialector) RollbackTo(tx *gorm.DB, name string) error {
+	return d.Dialector.(gorm.SavePointerDialectorInterface).RollbackTo(tx, name)
+}
+
+// duplicateKeyError is gorm.ErrDuplicatedKey with the driver's error behind it
+type duplicateKeyError struct {
+	err error
+}
+
+func (e duplicateKeyError) Error() string {
+	return e.err.Error()
+}
+
+func (e duplicateKeyError) Is(target error) bool {
+	return target == gorm.ErrDuplicatedKey
+}
+
+func (e duplicateKeyError) Unwrap() error {
+	return e.err
+}
+
+// sqliteDSN adds the driver's tuning to dsn, leaving settings it already has alone
+func sqliteDSN(dsn string) string {
+	path, query, _ := strings.Cut(dsn, "?")
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		// Let the driver report the malformed DSN
+		return dsn
+	}
+	setDefault := func(key, value string) {
+		if !params.Has(key) {
+			params.Set(key, value)
+		}
+	}
+	setDefault("_foreign_keys", "1")
+	setDefault("_busy_timeout", fmt.Sprint(sqliteBusyTimeout.Milliseconds()))
+	if path == ":memory:" {
+		// Only URIs take parameters such as cache
+		path = "file::memory:"
+	}
+	if path == "file::memory:" || params.Get("mode") == "memory" {
+		// Each connection would get a database of its own otherwise
+		setDefault("cache", "shared")
+	} else {
+		setDefault("_journal_mode", "WAL")
+	}
+	return path + "?" + params.Encode()
+}
+
+// mysqlDSN adds the driver's tuning to dsn
+func mysqlDSN(dsn string) (string, error) {
+	cfg, err := mysqldriver.ParseDSN(dsn)
+	if err != nil {
+		return "", fmt.Errorf("invalid MySQL DSN: %w", err)
+	}
+	cfg.ParseTime = true
+	cfg.Loc = time.UTC
+	return cfg.FormatDSN(), nil
+}
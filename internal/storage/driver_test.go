@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestOpenerSQLite(t *testing.T) {
+	conn, err := Opener{Driver: DriverSQLite, DSN: "file:" + t.Name() + "?mode=memory", Config: &gorm.Config{}}.Open()
+	require.NoError(t, err)
+	t.Cleanup(func() { Close(conn) })
+
+	var foreignKeys, busyTimeout int
+	require.NoError(t, conn.Raw("PRAGMA foreign_keys").Scan(&foreignKeys).Error)
+	require.NoError(t, conn.Raw("PRAGMA busy_timeout").Scan(&busyTimeout).Error)
+	assert.Equal(t, 1, foreignKeys)
+	assert.Equal(t, 5000, busyTimeout)
+
+	require.NoError(t, Migrate(context.Background(), conn))
+	assert.NoError(t, CheckSchema(context.Background(), conn))
+}
+
+func TestOpenerUnsupportedDriver(t *testing.T) {
+	_, err := Opener{Driver: "oracle", DSN: "whatever"}.Open()
+	assert.EqualError(t, err, `unsupported database driver "oracle", use one of postgres, sqlite, mysql`)
+
+	_, err = Opener{DSN: "whatever"}.Open()
+	assert.EqualError(t, err, `unsupported database driver "", use one of postgres, sqlite, mysql`)
+}
+
+func TestSQLiteDSN(t *testing.T) {
+	tests := []struct {
+		dsn, want string
+	}{
+		{"app.db", "app.db?_busy_timeout=5000&_foreign_keys=1&_journal_mode=WAL"},
+		{":memory:", "file::memory:?_busy_timeout=5000&_foreign_keys=1&cache=shared"},
+		{"file:test?mode=memory", "file:test?_busy_timeout=5000&_foreign_keys=1&cache=shared&mode=memory"},
+		// Settings already in the DSN win
+		{"app.db?_foreign_keys=0&_journal_mode=DELETE", "app.db?_busy_timeout=5000&_foreign_keys=0&_journal_mode=DELETE"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, sqliteDSN(tt.dsn), tt.dsn)
+	}
+}
+
+func TestMySQLDSN(t *testing.T) {
+	dsn, err := mysqlDSN("app:secret@tcp(db:3306)/app")
+	require.NoError(t, err)
+	assert.Contains(t, dsn, "parseTime=true")
+	assert.NotContains(t, dsn, "loc=", "UTC is the default")
+
+	dsn, err = mysqlDSN("app:secret@tcp(db:3306)/app?loc=Local&timeout=5s")
+	require.NoError(t, err)
+	assert.NotContains(t, dsn, "loc=")
+	assert.Contains(t, dsn, "timeout=5s")
+
+	_, err = Dialector(DriverMySQL, "not a dsn")
+	assert.ErrorContains(t, err, "invalid MySQL DSN")
+}
@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// gormLogger sends GORM's log through the default slog logger. Statements are logged at debug
+// level, slow ones as warnings and failed ones as errors.
+type gormLogger struct {
+	slowThreshold time.Duration
+}
+
+// NewGormLogger is the logger for a database connection. Queries slower
+// than slowThreshold are logged as warnings; zero turns that off.
+func NewGormLogger(slowThreshold time.Duration) gormLogger {
+	return gormLogger{slowThreshold: slowThreshold}
+}
+
+// LogMode is a no-op; LOG_LEVEL decides what is logged
+func (l gormLogger) LogMode(gormlogger.LogLevel) gormlogger.Interface {
+	return l
+}
+
+func (l gormLogger) Info(ctx context.Context, msg string, data ...interface{}) {
+	slog.InfoContext(ctx, fmt.Sprintf(msg, data...))
+}
+
+func (l gormLogger) Warn(ctx context.Context, msg string, data ...interface{}) {
+	slog.WarnContext(ctx, fmt.Sprintf(msg, data...))
+}
+
+func (l gormLogger) Error(ctx context.Context, msg string, data ...interface{}) {
+	slog.ErrorContext(ctx, fmt.Sprintf(msg, data...))
+}
+
+func (l gormLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	elapsed := time.Since(begin)
+	level := slog.LevelDebug
+	msg := "query"
+	switch {
+	// Handlers expect missing records, so those are no failure
+	case err != nil && !errors.Is(err, gorm.ErrRecordNotFound):
+		level, msg = slog.LevelError, "query failed"
+	case l.slowThreshold > 0 && elapsed > l.slowThreshold:
+		level, msg = slog.LevelWarn, "slow query"
+	}
+	if !slog.Default().Enabled(ctx, level) {
+		return
+	}
+
+	sql, rows := fc()
+	attrs := []slog.Attr{
+		slog.String("sql", sql),
+		slog.Int64("rows", rows),
+		slog.Float64("elapsed_ms", float64(elapsed.Microseconds())/1000),
+	}
+	if err != nil {
+		attrs = append(attrs, slog.String("error", err.Error()))
+	}
+	slog.LogAttrs(ctx, level, msg, attrs...)
+}
@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	"Unit-Test/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestGormLogger(t *testing.T) {
+	conn := openTestDB(t)
+	if err := conn.AutoMigrate(&models.User{}); err != nil {
+		t.Fatal(err)
+	}
+	logs := captureLogs(t, slog.LevelDebug)
+	logged := conn.Session(&gorm.Session{Logger: gormLogger{slowThreshold: time.Hour}})
+
+	var user models.User
+	logged.First(&user, 99)
+	logged.Exec("SELECT * FROM no_such_table")
+
+	queries := logLines(t, logs, "query")
+	if assert.Len(t, queries, 1) {
+		assert.Contains(t, queries[0]["sql"], "FROM `users`")
+		assert.Equal(t, "DEBUG", queries[0]["level"])
+	}
+	failed := logLines(t, logs, "query failed")
+	if assert.Len(t, failed, 1) {
+		assert.Equal(t, "ERROR", failed[0]["level"])
+		assert.Contains(t, failed[0]["error"], "no such table")
+	}
+}
+
+func TestGormLoggerSlowQuery(t *testing.T) {
+	logs := captureLogs(t, slog.LevelWarn)
+	l := gormLogger{slowThreshold: time.Millisecond}
+
+	l.Trace(context.Background(), time.Now().Add(-time.Second), func() (string, int64) { return "SELECT 1", 1 }, nil)
+	l.Trace(context.Background(), time.Now(), func() (string, int64) { return "SELECT 2", 1 }, nil)
+	l.Trace(context.Background(), time.Now(), func() (string, int64) { return "SELECT 3", 0 }, gorm.ErrRecordNotFound)
+
+	slow := logLines(t, logs, "slow query")
+	if assert.Len(t, slow, 1) {
+		assert.Equal(t, "SELECT 1", slow[0]["sql"])
+	}
+	assert.Empty(t, logLines(t, logs, "query failed"))
+}
@@ -0,0 +1,270 @@
+package storage
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"Unit-Test/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SchemaVersion is the schema this binary expects: the version of the last
+// migration. Bump it with every migration added, so instances are only ready
+// once it has run.
+const SchemaVersion = 2
+
+//go:embed migrations
+var migrationFiles embed.FS
+
+// migrationName matches the files of a migration, like 0002_add_phone.up.sql
+var migrationName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration is one step of the schema, as SQL going up and back down
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Migrations returns the migrations for the dialect (one of Drivers), in the
+// order they apply
+func Migrations(dialect string) ([]Migration, error) {
+	dir := path.Join("migrations", dialect)
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, fmt.Errorf("no migrations for %s", dialect)
+	}
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		m := migrationName.FindStringSubmatch(entry.Name())
+		if m == nil {
+			return nil, fmt.Errorf("unexpected migration file %s", entry.Name())
+		}
+		version, _ := strconv.Atoi(m[1])
+		data, err := migrationFiles.ReadFile(path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		migration := byVersion[version]
+		if migration == nil {
+			migration = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = migration
+		}
+		if migration.Name != m[2] {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, migration.Name, m[2])
+		}
+		if m[3] == "up" {
+			migration.Up = string(data)
+		} else {
+			migration.Down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %d needs both an up and a down file", migration.Version)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// appliedVersions returns the versions recorded in schema_migrations, creating
+// the table on first use
+func appliedVersions(tx *gorm.DB) (map[int]bool, error) {
+	if !tx.Migrator().HasTable(&models.SchemaMigration{}) {
+		if err := tx.Migrator().CreateTable(&models.SchemaMigration{}); err != nil {
+			return nil, err
+		}
+	}
+	var versions []int
+	if err := tx.Model(&models.SchemaMigration{}).Pluck("version", &versions).Error; err != nil {
+		return nil, err
+	}
+	applied := make(map[int]bool, len(versions))
+	for _, v := range versions {
+		applied[v] = true
+	}
+	return applied, nil
+}
+
+// execStatements runs the statements of a migration one at a time, as not every
+// driver accepts several in one Exec. Statements end with a semicolon at the
+// end of a line.
+func execStatements(tx *gorm.DB, sql string) error {
+	for _, statement := range strings.SplitAfter(sql, ";\n") {
+		if strings.TrimSpace(stripComments(statement)) == "" {
+			continue
+		}
+		if err := tx.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stripComments drops the lines of sql that are only a -- comment
+func stripComments(sql string) string {
+	var kept []string
+	for _, line := range strings.Split(sql, "\n") {
+		if !strings.HasPrefix(strings.TrimSpace(line), "--") {
+			kept = append(kept, line)
+		}
+	}
+	return strings.Join(kept, "\n")
+}
+
+// Migrate applies the migrations for conn's dialect that have not run yet, in
+// order. Each runs in a transaction with the schema_migrations row recording it,
+// so a failing one leaves the versions before it applied. MySQL commits DDL as
+// it goes, so there a failing migration has to be cleaned up by hand.
+func Migrate(ctx context.Context, conn *gorm.DB) error {
+	conn = conn.WithContext(ctx)
+	migrations, err := Migrations(conn.Dialector.Name())
+	if err != nil {
+		return err
+	}
+	applied, err := appliedVersions(conn)
+	if err != nil {
+		return fmt.Errorf("reading applied migrations: %w", err)
+	}
+	for _, m := range migrations {
+		if applied[m.Version] {
+			continue
+		}
+		err := conn.Transaction(func(tx *gorm.DB) error {
+			if err := execStatements(tx, m.Up); err != nil {
+				return err
+			}
+			return tx.Create(&models.SchemaMigration{Version: m.Version, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			return fmt.Errorf("migration %d_%s: %w", m.Version, m.Name, err)
+		}
+		slog.Info("applied migration", "version", m.Version, "name", m.Name)
+	}
+	return nil
+}
+
+// MigrateDown reverts the last n applied migrations, newest first
+func MigrateDown(ctx context.Context, conn *gorm.DB, n int) error {
+	conn = conn.WithContext(ctx)
+	migrations, err := Migrations(conn.Dialector.Name())
+	if err != nil {
+		return err
+	}
+	applied, err := appliedVersions(conn)
+	if err != nil {
+		return fmt.Errorf("reading applied migrations: %w", err)
+	}
+	known := map[int]bool{}
+	for _, m := range migrations {
+		known[m.Version] = true
+	}
+	for v := range applied {
+		if !known[v] {
+			return fmt.Errorf("migration %d is applied but unknown to this binary", v)
+		}
+	}
+	if n > len(applied) {
+		return fmt.Errorf("only %d migrations are applied, can't revert %d", len(applied), n)
+	}
+	for i := len(migrations) - 1; i >= 0 && n > 0; i-- {
+		m := migrations[i]
+		if !applied[m.Version] {
+			continue
+		}
+		err := conn.Transaction(func(tx *gorm.DB) error {
+			if err := execStatements(tx, m.Down); err != nil {
+				return err
+			}
+			return tx.Delete(&models.SchemaMigration{}, m.Version).Error
+		})
+		if err != nil {
+			return fmt.Errorf("reverting migration %d_%s: %w", m.Version, m.Name, err)
+		}
+		slog.Info("reverted migration", "version", m.Version, "name", m.Name)
+		n--
+	}
+	return nil
+}
+
+// AutoMigrate builds the schema from the models with GORM's AutoMigrate and
+// records it as SchemaVersion. It is for SQLite test databases only: it can't
+// rename columns or drop them, so production databases go through Migrate.
+func AutoMigrate(tx *gorm.DB) error {
+	// Migration note: emails became case-insensitive, so stored ones are lowercased
+	// before AutoMigrate builds the unique index on LOWER(email). This fails while two
+	// active users differ only by case; such pairs have to be merged by hand.
+	if tx.Migrator().HasTable(&models.User{}) {
+		if err := tx.Exec("UPDATE users SET email = LOWER(email) WHERE email <> LOWER(email)").Error; err != nil {
+			slog.Error("failed to lowercase stored emails", "error", err.Error())
+		}
+	}
+
+	// Auto-migrate the models to create the 'users', 'addresses', 'posts', 'api_keys',
+	// 'refresh_tokens', 'audit_logs', 'password_resets', 'email_verifications',
+	// 'webhooks' and 'schema_migrations' tables
+	if err := tx.AutoMigrate(&models.User{}, &models.Address{}, &models.Post{}, &models.APIKey{}, &models.RefreshToken{}, &models.AuditLog{}, &models.PasswordReset{}, &models.EmailVerification{}, &models.Webhook{}, &models.SchemaMigration{}); err != nil {
+		return fmt.Errorf("auto-migrating: %w", err)
+	}
+
+	// Migration note: soft delete replaced the table-wide unique index on email
+	// (idx_users_email) with one that only covers active users, so the email of a
+	// deleted user can be registered again. That index and the plain LOWER(email)
+	// lookup index were then folded into idx_users_email_lower_active. AutoMigrate
+	// never drops indexes, so remove the old ones explicitly.
+	for _, index := range []string{"idx_users_email", "idx_users_email_active", "idx_users_email_lower"} {
+		if tx.Migrator().HasIndex(&models.User{}, index) {
+			if err := tx.Migrator().DropIndex(&models.User{}, index); err != nil {
+				return fmt.Errorf("dropping %s: %w", index, err)
+			}
+		}
+	}
+
+	if err := RecordSchemaVersion(tx); err != nil {
+		return fmt.Errorf("recording the schema version: %w", err)
+	}
+	return nil
+}
+
+// RecordSchemaVersion marks the database as migrated to SchemaVersion, with
+// every migration up to it applied
+func RecordSchemaVersion(tx *gorm.DB) error {
+	migrations := make([]models.SchemaMigration, SchemaVersion)
+	for i := range migrations {
+		migrations[i] = models.SchemaMigration{Version: i + 1, AppliedAt: time.Now()}
+	}
+	return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&migrations).Error
+}
+
+// CheckSchema returns an error unless the database behind conn has been
+// migrated to SchemaVersion
+func CheckSchema(ctx context.Context, conn *gorm.DB) error {
+	var version *int
+	if err := conn.WithContext(ctx).Model(&models.SchemaMigration{}).Select("MAX(version)").Scan(&version).Error; err != nil {
+		return err
+	}
+	if version == nil {
+		return errors.New("database has not been migrated")
+	}
+	if *version != SchemaVersion {
+		return fmt.Errorf("database schema is at version %d, expected %d", *version, SchemaVersion)
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"testing"
+
+	"Unit-Test/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestMigrateFreshDatabase(t *testing.T) {
+	fresh := openTestDB(t)
+	ctx := context.Background()
+
+	require.NoError(t, Migrate(ctx, fresh))
+	for _, table := range []string{"users", "addresses", "posts", "api_keys", "refresh_tokens", "audit_logs", "password_resets", "email_verifications", "webhooks"} {
+		assert.True(t, fresh.Migrator().HasTable(table), table)
+	}
+	assert.True(t, fresh.Migrator().HasIndex(&models.User{}, "idx_users_email_lower_active"))
+	assert.NoError(t, CheckSchema(ctx, fresh))
+
+	// Running again is a no-op
+	require.NoError(t, Migrate(ctx, fresh))
+	var applied int64
+	fresh.Model(&models.SchemaMigration{}).Count(&applied)
+	assert.Equal(t, int64(SchemaVersion), applied)
+}
+
+// columnsAndIndexes describes the schema of the SQLite database conn: the columns of each table
+// with their nullability, and the names of its indexes
+func columnsAndIndexes(t *testing.T, conn *gorm.DB) map[string][]string {
+	tables, err := conn.Migrator().GetTables()
+	require.NoError(t, err)
+	schema := map[string][]string{}
+	for _, table := range tables {
+		if table == "sqlite_sequence" {
+			continue
+		}
+		columns, err := conn.Migrator().ColumnTypes(table)
+		require.NoError(t, err)
+		for _, column := range columns {
+			nullable, _ := column.Nullable()
+			schema[table] = append(schema[table], fmt.Sprintf("%s nullable=%t", column.Name(), nullable))
+		}
+		// GetIndexes can't read expression indexes such as idx_users_email_lower_active
+		var indexes []string
+		require.NoError(t, conn.Raw("SELECT name FROM sqlite_master WHERE type = 'index' AND tbl_name = ? AND sql IS NOT NULL", table).Scan(&indexes).Error)
+		for _, index := range indexes {
+			schema[table] = append(schema[table], "index "+index)
+		}
+		sort.Strings(schema[table])
+	}
+	return schema
+}
+
+// The migrations must build the schema the models describe
+func TestMigrateMatchesModels(t *testing.T) {
+	migrated, automigrated := openTestDB(t), openTestDB(t)
+	require.NoError(t, Migrate(context.Background(), migrated))
+	require.NoError(t, AutoMigrate(automigrated))
+
+	assert.Equal(t, columnsAndIndexes(t, automigrated), columnsAndIndexes(t, migrated))
+}
+
+func TestMigrateDown(t *testing.T) {
+	conn := openTestDB(t)
+	ctx := context.Background()
+	require.NoError(t, Migrate(ctx, conn))
+
+	assert.Error(t, MigrateDown(ctx, conn, SchemaVersion+1))
+	require.NoError(t, MigrateDown(ctx, conn, SchemaVersion))
+	assert.False(t, conn.Migrator().HasTable("users"))
+	assert.EqualError(t, CheckSchema(ctx, conn), "database has not been migrated")
+
+	// And back up again
+	require.NoError(t, Migrate(ctx, conn))
+	assert.NoError(t, CheckSchema(ctx, conn))
+}
+
+func TestMigrateDownRefusesUnknownMigrations(t *testing.T) {
+	conn := openTestDB(t)
+	ctx := context.Background()
+	require.NoError(t, Migrate(ctx, conn))
+	conn.Create(&models.SchemaMigration{Version: SchemaVersion + 1})
+
+	assert.EqualError(t, MigrateDown(ctx, conn, 1), "migration 3 is applied but unknown to this binary")
+	assert.True(t, conn.Migrator().HasTable("users"))
+}
+
+func TestMigrations(t *testing.T) {
+	postgres, err := Migrations(DriverPostgres)
+	require.NoError(t, err)
+	assert.Equal(t, SchemaVersion, postgres[len(postgres)-1].Version)
+
+	// Every driver goes through the same steps, ending at SchemaVersion
+	for _, driver := range Drivers {
+		migrations, err := Migrations(driver)
+		require.NoError(t, err, driver)
+		require.Len(t, migrations, len(postgres), driver)
+		for i := range postgres {
+			assert.Equal(t, i+1, migrations[i].Version, driver)
+			assert.Equal(t, postgres[i].Name, migrations[i].Name, driver)
+		}
+	}
+
+	_, err = Migrations("oracle")
+	assert.EqualError(t, err, "no migrations for oracle")
+}
+
+func TestExecStatements(t *testing.T) {
+	conn := openTestDB(t)
+	sql := "-- Two tables\nCREATE TABLE a (id integer);\n\nCREATE TABLE b (\n    id integer\n);\n-- trailing comment\n"
+
+	require.NoError(t, execStatements(conn, sql))
+	assert.True(t, conn.Migrator().HasTable("a"))
+	assert.True(t, conn.Migrator().HasTable("b"))
+}
+
+func TestMigrateFailure(t *testing.T) {
+	broken, _ := gorm.Open(sqlite.Open("file:migrate_broken?mode=memory"), &gorm.Config{})
+	sqlDB, _ := broken.DB()
+	sqlDB.Close()
+
+	assert.Error(t, Migrate(context.Background(), broken))
+	assert.Error(t, AutoMigrate(broken))
+}
+
+func TestAutoMigrateFreshDatabase(t *testing.T) {
+	fresh := openTestDB(t)
+
+	assert.NoError(t, AutoMigrate(fresh))
+	assert.True(t, fresh.Migrator().HasTable(&models.User{}))
+	var version int
+	fresh.Model(&models.SchemaMigration{}).Select("MAX(version)").Scan(&version)
+	assert.Equal(t, SchemaVersion, version)
+
+	// Running again is a no-op, and so is migrating afterwards
+	assert.NoError(t, AutoMigrate(fresh))
+	require.NoError(t, Migrate(context.Background(), fresh))
+	var applied int64
+	fresh.Model(&models.SchemaMigration{}).Count(&applied)
+	assert.Equal(t, int64(SchemaVersion), applied)
+}
+
+func TestAutoMigrateLowercasesStoredEmails(t *testing.T) {
+	conn := openTestDB(t)
+	assert.NoError(t, conn.Exec("CREATE TABLE users (id integer PRIMARY KEY, name text, email text)").Error)
+	assert.NoError(t, conn.Exec("INSERT INTO users (id, name, email) VALUES (1, 'Alice', ' Alice@Example.COM')").Error)
+
+	assert.NoError(t, AutoMigrate(conn))
+
+	var email string
+	conn.Raw("SELECT email FROM users WHERE id = 1").Scan(&email)
+	assert.Equal(t, " alice@example.com", email)
+}
+
+func TestCheckSchema(t *testing.T) {
+	conn := openTestDB(t)
+	assert.NoError(t, conn.AutoMigrate(&models.SchemaMigration{}))
+	assert.EqualError(t, CheckSchema(context.Background(), conn), "database has not been migrated")
+
+	conn.Create(&models.SchemaMigration{Version: SchemaVersion + 1})
+	assert.EqualError(t, CheckSchema(context.Background(), conn), "database schema is at version 3, expected 2")
+}
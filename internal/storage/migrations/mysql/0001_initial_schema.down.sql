@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS email_verifications;
+DROP TABLE IF EXISTS password_resets;
+DROP TABLE IF EXISTS audit_logs;
+DROP TABLE IF EXISTS refresh_tokens;
+DROP TABLE IF EXISTS api_keys;
+DROP TABLE IF EXISTS posts;
+DROP TABLE IF EXISTS addresses;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,109 @@
+-- The MySQL counterpart of postgres/0001_initial_schema.up.sql. MySQL has no
+-- partial indexes, so emails are unique among active users through a generated
+-- column that is NULL for deleted ones.
+
+CREATE TABLE IF NOT EXISTS users (
+    id bigint AUTO_INCREMENT PRIMARY KEY,
+    name varchar(100) NOT NULL,
+    email varchar(100) NOT NULL,
+    created_at datetime(3),
+    updated_at datetime(3),
+    deleted_at datetime(3),
+    version bigint NOT NULL DEFAULT 1,
+    avatar_path varchar(255),
+    role varchar(20) NOT NULL DEFAULT 'member',
+    phone varchar(20),
+    email_verified_at datetime(3),
+    preferences text,
+    password_hash varchar(255),
+    active_email varchar(100) GENERATED ALWAYS AS (IF(deleted_at IS NULL, LOWER(email), NULL)) VIRTUAL,
+    INDEX idx_users_deleted_at (deleted_at),
+    UNIQUE INDEX idx_users_email_lower_active (active_email)
+);
+
+CREATE TABLE IF NOT EXISTS addresses (
+    id bigint AUTO_INCREMENT PRIMARY KEY,
+    user_id bigint NOT NULL,
+    street varchar(200) NOT NULL,
+    city varchar(100) NOT NULL,
+    country varchar(100) NOT NULL,
+    postal_code varchar(20),
+    created_at datetime(3),
+    updated_at datetime(3),
+    deleted_at datetime(3),
+    INDEX idx_addresses_deleted_at (deleted_at),
+    INDEX idx_addresses_user_id (user_id),
+    CONSTRAINT fk_addresses_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS posts (
+    id bigint AUTO_INCREMENT PRIMARY KEY,
+    user_id bigint NOT NULL,
+    title varchar(200) NOT NULL,
+    body text NOT NULL,
+    created_at datetime(3),
+    INDEX idx_posts_user_id (user_id),
+    CONSTRAINT fk_users_posts FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS api_keys (
+    id bigint AUTO_INCREMENT PRIMARY KEY,
+    user_id bigint NOT NULL,
+    key_hash char(64) NOT NULL,
+    label varchar(100) NOT NULL,
+    created_at datetime(3),
+    last_used_at datetime(3),
+    UNIQUE INDEX idx_api_keys_key_hash (key_hash),
+    INDEX idx_api_keys_user_id (user_id),
+    CONSTRAINT fk_api_keys_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    id bigint AUTO_INCREMENT PRIMARY KEY,
+    user_id bigint NOT NULL,
+    token_hash char(64) NOT NULL,
+    family_id char(64) NOT NULL,
+    expires_at datetime(3) NOT NULL,
+    revoked_at datetime(3),
+    created_at datetime(3),
+    INDEX idx_refresh_tokens_family_id (family_id),
+    UNIQUE INDEX idx_refresh_tokens_token_hash (token_hash),
+    INDEX idx_refresh_tokens_user_id (user_id),
+    CONSTRAINT fk_refresh_tokens_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+-- before is a reserved word in MySQL
+CREATE TABLE IF NOT EXISTS audit_logs (
+    id bigint AUTO_INCREMENT PRIMARY KEY,
+    actor varchar(100) NOT NULL,
+    action varchar(20) NOT NULL,
+    user_id bigint NOT NULL,
+    `before` text,
+    `after` text,
+    created_at datetime(3),
+    INDEX idx_audit_logs_user_id (user_id)
+);
+
+CREATE TABLE IF NOT EXISTS password_resets (
+    id bigint AUTO_INCREMENT PRIMARY KEY,
+    user_id bigint NOT NULL,
+    token_hash char(64) NOT NULL,
+    expires_at datetime(3) NOT NULL,
+    used_at datetime(3),
+    created_at datetime(3),
+    UNIQUE INDEX idx_password_resets_token_hash (token_hash),
+    INDEX idx_password_resets_user_id (user_id),
+    CONSTRAINT fk_password_resets_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS email_verifications (
+    id bigint AUTO_INCREMENT PRIMARY KEY,
+    user_id bigint NOT NULL,
+    token_hash char(64) NOT NULL,
+    expires_at datetime(3) NOT NULL,
+    used_at datetime(3),
+    created_at datetime(3),
+    INDEX idx_email_verifications_user_id (user_id),
+    UNIQUE INDEX idx_email_verifications_token_hash (token_hash),
+    CONSTRAINT fk_email_verifications_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
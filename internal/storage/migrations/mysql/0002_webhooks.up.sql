@@ -0,0 +1,11 @@
+-- The MySQL counterpart of postgres/0002_webhooks.up.sql
+
+CREATE TABLE IF NOT EXISTS webhooks (
+    id bigint AUTO_INCREMENT PRIMARY KEY,
+    url varchar(2048) NOT NULL,
+    secret varchar(64) NOT NULL,
+    enabled boolean NOT NULL,
+    event_mask bigint NOT NULL,
+    created_at datetime(3),
+    updated_at datetime(3)
+);
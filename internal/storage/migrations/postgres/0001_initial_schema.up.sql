@@ -0,0 +1,106 @@
+-- The schema AutoMigrate had built when migrations were introduced. Databases
+-- migrated by AutoMigrate already record version 1 and skip this file.
+
+CREATE TABLE IF NOT EXISTS users (
+    id bigserial PRIMARY KEY,
+    name varchar(100) NOT NULL,
+    email varchar(100) NOT NULL,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    version bigint NOT NULL DEFAULT 1,
+    avatar_path varchar(255),
+    role varchar(20) NOT NULL DEFAULT 'member',
+    phone varchar(20),
+    email_verified_at timestamptz,
+    preferences jsonb,
+    password_hash varchar(255)
+);
+CREATE INDEX IF NOT EXISTS idx_users_deleted_at ON users (deleted_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email_lower_active ON users (LOWER(email)) WHERE deleted_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS addresses (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL,
+    street varchar(200) NOT NULL,
+    city varchar(100) NOT NULL,
+    country varchar(100) NOT NULL,
+    postal_code varchar(20),
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    CONSTRAINT fk_addresses_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_addresses_deleted_at ON addresses (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_addresses_user_id ON addresses (user_id);
+
+CREATE TABLE IF NOT EXISTS posts (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL,
+    title varchar(200) NOT NULL,
+    body text NOT NULL,
+    created_at timestamptz,
+    CONSTRAINT fk_users_posts FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_posts_user_id ON posts (user_id);
+
+CREATE TABLE IF NOT EXISTS api_keys (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL,
+    key_hash char(64) NOT NULL,
+    label varchar(100) NOT NULL,
+    created_at timestamptz,
+    last_used_at timestamptz,
+    CONSTRAINT fk_api_keys_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_api_keys_key_hash ON api_keys (key_hash);
+CREATE INDEX IF NOT EXISTS idx_api_keys_user_id ON api_keys (user_id);
+
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL,
+    token_hash char(64) NOT NULL,
+    family_id char(64) NOT NULL,
+    expires_at timestamptz NOT NULL,
+    revoked_at timestamptz,
+    created_at timestamptz,
+    CONSTRAINT fk_refresh_tokens_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family_id ON refresh_tokens (family_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_refresh_tokens_token_hash ON refresh_tokens (token_hash);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_user_id ON refresh_tokens (user_id);
+
+CREATE TABLE IF NOT EXISTS audit_logs (
+    id bigserial PRIMARY KEY,
+    actor varchar(100) NOT NULL,
+    action varchar(20) NOT NULL,
+    user_id bigint NOT NULL,
+    before jsonb,
+    after jsonb,
+    created_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_audit_logs_user_id ON audit_logs (user_id);
+
+CREATE TABLE IF NOT EXISTS password_resets (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL,
+    token_hash char(64) NOT NULL,
+    expires_at timestamptz NOT NULL,
+    used_at timestamptz,
+    created_at timestamptz,
+    CONSTRAINT fk_password_resets_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_password_resets_token_hash ON password_resets (token_hash);
+CREATE INDEX IF NOT EXISTS idx_password_resets_user_id ON password_resets (user_id);
+
+CREATE TABLE IF NOT EXISTS email_verifications (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL,
+    token_hash char(64) NOT NULL,
+    expires_at timestamptz NOT NULL,
+    used_at timestamptz,
+    created_at timestamptz,
+    CONSTRAINT fk_email_verifications_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_email_verifications_user_id ON email_verifications (user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_email_verifications_token_hash ON email_verifications (token_hash);
@@ -0,0 +1,11 @@
+-- Subscriptions to the user events, delivered by internal/webhooks
+
+CREATE TABLE IF NOT EXISTS webhooks (
+    id bigserial PRIMARY KEY,
+    url varchar(2048) NOT NULL,
+    secret varchar(64) NOT NULL,
+    enabled boolean NOT NULL,
+    event_mask bigint NOT NULL,
+    created_at timestamptz,
+    updated_at timestamptz
+);
@@ -0,0 +1,11 @@
+-- The SQLite counterpart of postgres/0002_webhooks.up.sql
+
+CREATE TABLE IF NOT EXISTS webhooks (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    url varchar(2048) NOT NULL,
+    secret varchar(64) NOT NULL,
+    enabled numeric NOT NULL,
+    event_mask integer NOT NULL,
+    created_at datetime,
+    updated_at datetime
+);
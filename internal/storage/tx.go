@@ -0,0 +1,48 @@
+package storage
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+)
+
+// Transactor runs functions in a transaction
+type Transactor interface {
+	// InTx calls fn with a context carrying a transaction, committing it if fn
+	// returns nil and rolling it back otherwise. Inside a transaction already,
+	// fn runs in a nested one.
+	InTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+type txKey struct{}
+
+// ContextWithTx makes repositories called with the returned context work in
+// tx, so they commit or roll back with whatever else tx does
+func ContextWithTx(ctx context.Context, tx *gorm.DB) context.Context {
+	return context.WithValue(ctx, txKey{}, tx)
+}
+
+// Session is the transaction ctx carries, or db, bound to ctx. Queries the
+// repositories don't cover use it to join the caller's transaction.
+func Session(ctx context.Context, db *gorm.DB) *gorm.DB {
+	if tx, ok := ctx.Value(txKey{}).(*gorm.DB); ok {
+		db = tx
+	}
+	return db.WithContext(ctx)
+}
+
+// gormTransactor is the Transactor for db
+type gormTransactor struct {
+	db *gorm.DB
+}
+
+// NewTransactor returns the Transactor running transactions on db
+func NewTransactor(db *gorm.DB) Transactor {
+	return gormTransactor{db: db}
+}
+
+func (t gormTransactor) InTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return Session(ctx, t.db).Transaction(func(tx *gorm.DB) error {
+		return fn(ContextWithTx(ctx, tx))
+	})
+}
@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"Unit-Test/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInTxCommits(t *testing.T) {
+	users, conn := newTestUsers(t)
+
+	err := NewTransactor(conn).InTx(context.Background(), func(ctx context.Context) error {
+		user := models.User{Name: "alice", Email: "alice@example.com"}
+		return users.Create(ctx, &user)
+	})
+	require.NoError(t, err)
+
+	count, _ := users.Count(context.Background(), UserFilter{})
+	assert.Equal(t, int64(1), count)
+}
+
+func TestInTxRollsBack(t *testing.T) {
+	users, conn := newTestUsers(t)
+	audit := NewAuditRepository(conn)
+	failed := errors.New("failed")
+
+	err := NewTransactor(conn).InTx(context.Background(), func(ctx context.Context) error {
+		user := models.User{Name: "alice", Email: "alice@example.com"}
+		if err := users.Create(ctx, &user); err != nil {
+			return err
+		}
+		if err := audit.Record(ctx, &models.AuditLog{Actor: "1", Action: models.AuditCreate, UserID: user.ID}); err != nil {
+			return err
+		}
+		return failed
+	})
+	assert.ErrorIs(t, err, failed)
+
+	// Both writes rolled back with the transaction
+	count, _ := users.Count(context.Background(), UserFilter{})
+	assert.Zero(t, count)
+	var entries int64
+	conn.Model(&models.AuditLog{}).Count(&entries)
+	assert.Zero(t, entries)
+}
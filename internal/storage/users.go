@@ -0,0 +1,386 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"Unit-Test/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Errors the repositories return in place of the driver's, so callers don't
+// depend on GORM to tell what went wrong
+var (
+	ErrNotFound        = errors.New("record not found")
+	ErrDuplicateEmail  = errors.New("email already in use")
+	ErrVersionConflict = errors.New("version conflict")
+	ErrUnlistedColumn  = errors.New("column can't be listed")
+)
+
+// UserColumns are the columns List may load, and loads when not told which.
+// Secrets such as the password hash are never among them, and neither are
+// the avatar path and preferences, which have endpoints of their own.
+var UserColumns = []string{"id", "name", "email", "created_at", "updated_at", "deleted_at", "version", "role", "phone", "email_verified_at"}
+
+// CheckColumns returns ErrUnlistedColumn for the first column List may not load
+func CheckColumns(columns []string) error {
+	for _, column := range columns {
+		if !slices.Contains(UserColumns, column) {
+			return fmt.Errorf("%w: %q", ErrUnlistedColumn, column)
+		}
+	}
+	return nil
+}
+
+// UserRepository stores users. Deleted users are only seen by List and Count
+// with UserFilter.IncludeDeleted.
+type UserRepository interface {
+	// List returns the users matching filter, shaped by opts
+	List(ctx context.Context, filter UserFilter, opts ListOptions) ([]models.User, error)
+	// Get returns the user with id, or ErrNotFound
+	Get(ctx context.Context, id int) (models.User, error)
+	// GetByEmail returns the user with email, ignoring case, or ErrNotFound
+	GetByEmail(ctx context.Context, email string) (models.User, error)
+	// GetForLogin is GetByEmail loading only the id and password hash
+	GetForLogin(ctx context.Context, email string) (models.User, error)
+	// Search returns the users whose name or email contains text, ignoring
+	// case, with exact email matches first and then by id. Only the columns,
+	// limit and offset of opts apply.
+	Search(ctx context.Context, text string, opts ListOptions) ([]models.User, error)
+	// Stream loads the users matching filter by id in batches of at most
+	// batchSize, passing each to fn. An error from fn stops it and is returned.
+	// Only columns, out of UserColumns or all of those when empty, are loaded.
+	Stream(ctx context.Context, filter UserFilter, columns []string, batchSize int, fn func([]models.User) error) error
+	// Create inserts user and fills in its id, timestamps and version. It
+	// returns ErrDuplicateEmail when another user has the email.
+	Create(ctx context.Context, user *models.User) error
+	// Update stores user if its version is still the stored one and bumps
+	// that version. It returns ErrNotFound, ErrVersionConflict or ErrDuplicateEmail.
+	Update(ctx context.Context, user *models.User) error
+	// CreateMany inserts users in batches, filling in their ids, timestamps
+	// and versions. It returns ErrDuplicateEmail when an email is taken.
+	CreateMany(ctx context.Context, users []models.User) error
+	// EmailsInUse returns which of emails, lowercased, active users have
+	EmailsInUse(ctx context.Context, emails []string) (map[string]bool, error)
+	// UpdatePreferences replaces the preferences of the user with id, or
+	// returns ErrNotFound. The version is left alone.
+	UpdatePreferences(ctx context.Context, id int, prefs models.Preferences) error
+	// UpdateAvatar sets the avatar path of the user with id, or returns
+	// ErrNotFound. The version is left alone.
+	UpdateAvatar(ctx context.Context, id int, path string) error
+	// Delete soft-deletes the user with id, or returns ErrNotFound
+	Delete(ctx context.Context, id int) error
+	// Restore undoes the soft delete of the user with id, or returns
+	// ErrNotFound when no deleted user has it. It returns ErrDuplicateEmail
+	// when an active user has the email since.
+	Restore(ctx context.Context, id int) error
+	// Count returns the number of users matching filter
+	Count(ctx context.Context, filter UserFilter) (int64, error)
+}
+
+// UserFilter selects users; zero fields select everyone
+type UserFilter struct {
+	Name     string // case-insensitive substring of the name
+	Search   string // case-insensitive substring of the name or the email
+	Email    string // ignoring case
+	Role     string
+	Verified *bool // whether the email has been verified
+	// IDs restricts the users to these ids when not nil; an empty list matches nothing
+	IDs            []int
+	IncludeDeleted bool
+}
+
+// ListOptions shape the users List returns
+type ListOptions struct {
+	// Columns to load, out of UserColumns, or all of those when empty
+	Columns []string
+	Sort    []Sort
+	// Limit caps the number of users when positive. Limited lists are ordered
+	// by id after Sort, and skip Offset users or, with AfterID, resume after
+	// the user with that id.
+	Limit     int
+	Offset    int
+	AfterID   *int
+	WithPosts bool // load the posts of every user, oldest first
+}
+
+// Sort orders users by Column
+type Sort struct {
+	Column string
+	Desc   bool
+}
+
+// emailIndex is the unique index that keeps two active users from sharing an email
+const emailIndex = "idx_users_email_lower_active"
+
+// translateError maps GORM's errors onto the repository's. Only a violation of
+// emailIndex is ErrDuplicateEmail; others, such as a taken id, pass through.
+func translateError(err error) error {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return ErrNotFound
+	case errors.Is(err, gorm.ErrDuplicatedKey) && strings.Contains(err.Error(), emailIndex):
+		return ErrDuplicateEmail
+	}
+	return err
+}
+
+// gormUserRepository is the UserRepository backed by the database
+type gormUserRepository struct {
+	db *gorm.DB
+}
+
+// NewUserRepository returns the UserRepository storing users in db
+func NewUserRepository(db *gorm.DB) UserRepository {
+	return gormUserRepository{db: db}
+}
+
+// FilterUsers is a GORM scope applying filter
+func FilterUsers(filter UserFilter) func(*gorm.DB) *gorm.DB {
+	return func(query *gorm.DB) *gorm.DB {
+		if filter.IncludeDeleted {
+			query = query.Unscoped()
+		}
+		if filter.Name != "" {
+			query = query.Where(ContainsInsensitive(query, "name", filter.Name))
+		}
+		if filter.Search != "" {
+			nameCond, nameArg := ContainsInsensitive(query, "name", filter.Search)
+			emailCond, emailArg := ContainsInsensitive(query, "email", filter.Search)
+			query = query.Where(query.Session(&gorm.Session{NewDB: true}).Where(nameCond, nameArg).Or(emailCond, emailArg))
+		}
+		if filter.Email != "" {
+			// Emails are stored normalized; the emailIndex expression index serves this
+			query = query.Where("LOWER(email) = ?", models.NormalizeEmail(filter.Email))
+		}
+		if filter.Role != "" {
+			query = query.Where("role = ?", filter.Role)
+		}
+		if filter.Verified != nil {
+			if *filter.Verified {
+				query = query.Where("email_verified_at IS NOT NULL")
+			} else {
+				query = query.Where("email_verified_at IS NULL")
+			}
+		}
+		if filter.IDs != nil {
+			// An empty list renders as IN (NULL) and matches nothing
+			query = query.Where("id IN ?", filter.IDs)
+		}
+		return query
+	}
+}
+
+// likeEscaper escapes LIKE's wildcards, and the backslash escaping them
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// ContainsInsensitive builds a case-insensitive substring condition for column,
+// with any % and _ in value matched literally.
+// Postgres gets ILIKE, other drivers (SQLite in tests) fall back to LOWER + LIKE.
+func ContainsInsensitive(query *gorm.DB, column, value string) (string, string) {
+	pattern := "%" + likeEscaper.Replace(value) + "%"
+	switch query.Dialector.Name() {
+	case DriverPostgres:
+		return column + ` ILIKE ? ESCAPE '\'`, pattern
+	case DriverMySQL:
+		// Backslash is MySQL's escape already, and would need escaping itself in the literal
+		return "LOWER(" + column + ") LIKE ?", strings.ToLower(pattern)
+	}
+	return "LOWER(" + column + `) LIKE ? ESCAPE '\'`, strings.ToLower(pattern)
+}
+
+func (r gormUserRepository) List(ctx context.Context, filter UserFilter, opts ListOptions) ([]models.User, error) {
+	columns := opts.Columns
+	if len(columns) == 0 {
+		columns = UserColumns
+	}
+	if err := CheckColumns(columns); err != nil {
+		return nil, err
+	}
+	query := Session(ctx, r.db).Scopes(FilterUsers(filter)).Select(columns)
+	for _, s := range opts.Sort {
+		query = query.Order(clause.OrderByColumn{Column: clause.Column{Name: s.Column}, Desc: s.Desc})
+	}
+	switch {
+	case opts.Limit > 0 && opts.AfterID != nil:
+		query = query.Where("id > ?", *opts.AfterID).Order("id").Limit(opts.Limit)
+	case opts.Limit > 0:
+		query = query.Order("id").Offset(opts.Offset).Limit(opts.Limit)
+	case filter.IDs != nil:
+		query = query.Order("id")
+	}
+	if opts.WithPosts {
+		query = query.Preload("Posts", func(tx *gorm.DB) *gorm.DB {
+			return tx.Order("id")
+		})
+	}
+
+	var users []models.User
+	if err := query.Find(&users).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return users, nil
+}
+
+func (r gormUserRepository) Get(ctx context.Context, id int) (models.User, error) {
+	var user models.User
+	err := Session(ctx, r.db).First(&user, id).Error
+	return user, translateError(err)
+}
+
+func (r gormUserRepository) GetByEmail(ctx context.Context, email string) (models.User, error) {
+	// Served by the emailIndex expression index
+	var user models.User
+	err := Session(ctx, r.db).Where("LOWER(email) = ?", strings.ToLower(email)).First(&user).Error
+	return user, translateError(err)
+}
+
+func (r gormUserRepository) GetForLogin(ctx context.Context, email string) (models.User, error) {
+	var user models.User
+	err := Session(ctx, r.db).Select("id", "password_hash").Where("LOWER(email) = ?", strings.ToLower(email)).First(&user).Error
+	return user, translateError(err)
+}
+
+func (r gormUserRepository) Search(ctx context.Context, text string, opts ListOptions) ([]models.User, error) {
+	columns := opts.Columns
+	if len(columns) == 0 {
+		columns = UserColumns
+	}
+	if err := CheckColumns(columns); err != nil {
+		return nil, err
+	}
+	query := Session(ctx, r.db).Scopes(FilterUsers(UserFilter{Search: text})).
+		Select(strings.Join(columns, ", ")+", CASE WHEN LOWER(email) = ? THEN 0 ELSE 1 END AS search_rank", strings.ToLower(text)).
+		Order("search_rank").Order("id")
+	if opts.Limit > 0 {
+		query = query.Offset(opts.Offset).Limit(opts.Limit)
+	}
+
+	var users []models.User
+	if err := query.Find(&users).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return users, nil
+}
+
+func (r gormUserRepository) Stream(ctx context.Context, filter UserFilter, columns []string, batchSize int, fn func([]models.User) error) error {
+	if len(columns) == 0 {
+		columns = UserColumns
+	}
+	if err := CheckColumns(columns); err != nil {
+		return err
+	}
+	var batch []models.User
+	err := Session(ctx, r.db).Scopes(FilterUsers(filter)).Select(columns).FindInBatches(&batch, batchSize, func(*gorm.DB, int) error {
+		return fn(batch)
+	}).Error
+	return translateError(err)
+}
+
+func (r gormUserRepository) Create(ctx context.Context, user *models.User) error {
+	return translateError(Session(ctx, r.db).Create(user).Error)
+}
+
+// createBatchSize is how many users CreateMany inserts per statement
+const createBatchSize = 100
+
+func (r gormUserRepository) CreateMany(ctx context.Context, users []models.User) error {
+	return translateError(Session(ctx, r.db).CreateInBatches(&users, createBatchSize).Error)
+}
+
+func (r gormUserRepository) EmailsInUse(ctx context.Context, emails []string) (map[string]bool, error) {
+	lowered := make([]string, len(emails))
+	for i, email := range emails {
+		lowered[i] = strings.ToLower(email)
+	}
+	var existing []string
+	err := Session(ctx, r.db).Model(&models.User{}).Where("LOWER(email) IN ?", lowered).Pluck("LOWER(email)", &existing).Error
+	if err != nil {
+		return nil, translateError(err)
+	}
+	inUse := make(map[string]bool, len(existing))
+	for _, email := range existing {
+		inUse[email] = true
+	}
+	return inUse, nil
+}
+
+func (r gormUserRepository) Update(ctx context.Context, user *models.User) error {
+	db := Session(ctx, r.db)
+	expected := user.Version
+	user.Version = expected + 1
+	result := db.Model(user).Where("version = ?", expected).
+		Select("*").Omit("id", "created_at", "deleted_at", "preferences", "password_hash", "email_verified_at").Updates(user)
+	if result.Error != nil {
+		user.Version = expected
+		return translateError(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		user.Version = expected
+		// Tell a stale version from a user that is gone
+		var count int64
+		if err := db.Model(&models.User{}).Where("id = ?", user.ID).Count(&count).Error; err != nil {
+			return translateError(err)
+		}
+		if count == 0 {
+			return ErrNotFound
+		}
+		return ErrVersionConflict
+	}
+	return nil
+}
+
+func (r gormUserRepository) UpdatePreferences(ctx context.Context, id int, prefs models.Preferences) error {
+	return r.updateColumn(ctx, id, "preferences", prefs)
+}
+
+func (r gormUserRepository) UpdateAvatar(ctx context.Context, id int, path string) error {
+	return r.updateColumn(ctx, id, "avatar_path", path)
+}
+
+// updateColumn sets column of the active user with id to value
+func (r gormUserRepository) updateColumn(ctx context.Context, id int, column string, value interface{}) error {
+	result := Session(ctx, r.db).Model(&models.User{}).Where("id = ?", id).Update(column, value)
+	if result.Error != nil {
+		return translateError(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r gormUserRepository) Delete(ctx context.Context, id int) error {
+	result := Session(ctx, r.db).Delete(&models.User{}, id)
+	if result.Error != nil {
+		return translateError(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r gormUserRepository) Restore(ctx context.Context, id int) error {
+	// The unique index on active emails rejects it if the email was reused
+	result := Session(ctx, r.db).Unscoped().Model(&models.User{}).
+		Where("id = ? AND deleted_at IS NOT NULL", id).Update("deleted_at", nil)
+	if result.Error != nil {
+		return translateError(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r gormUserRepository) Count(ctx context.Context, filter UserFilter) (int64, error) {
+	var count int64
+	err := Session(ctx, r.db).Model(&models.User{}).Scopes(FilterUsers(filter)).Count(&count).Error
+	return count, translateError(err)
+}
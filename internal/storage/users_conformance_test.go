@@ -0,0 +1,26 @@
+package storage_test
+
+import (
+	"testing"
+
+	"Unit-Test/internal/storage"
+	"Unit-Test/internal/testsupport"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// The GORM repository passes the same suite as the fake handler tests use
+func TestUserRepositoryConformance(t *testing.T) {
+	testsupport.RunUserRepositoryTests(t, func(t *testing.T) storage.UserRepository {
+		conn, err := gorm.Open(storage.KeepKeyNames(sqlite.Open("file:"+t.Name()+"?mode=memory")), &gorm.Config{TranslateError: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { storage.Close(conn) })
+		if err := storage.AutoMigrate(conn); err != nil {
+			t.Fatal(err)
+		}
+		return storage.NewUserRepository(conn)
+	})
+}
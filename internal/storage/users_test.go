@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+
+	"Unit-Test/internal/models"
+	"Unit-Test/internal/testsupport/fixtures"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// The behaviour shared with the fake repository is covered by
+// TestUserRepositoryConformance; these tests need the database itself.
+
+// newTestUsers migrates a database of t's own and returns its user repository
+func newTestUsers(t *testing.T) (UserRepository, *gorm.DB) {
+	conn := openTestDB(t)
+	require.NoError(t, AutoMigrate(conn))
+	return NewUserRepository(conn), conn
+}
+
+// createUsers stores a user for each name, with an email derived from it
+func createUsers(t *testing.T, users UserRepository, names ...string) []models.User {
+	var created []models.User
+	for _, name := range names {
+		user := models.User{Name: name, Email: name + "@example.com"}
+		require.NoError(t, users.Create(context.Background(), &user))
+		created = append(created, user)
+	}
+	return created
+}
+
+func TestUserRepositoryVerifiedFilter(t *testing.T) {
+	users, conn := newTestUsers(t)
+	ctx := context.Background()
+	fixtures.NewUser(t, conn)
+	verifiedUser := fixtures.NewUser(t, conn, fixtures.Verified())
+
+	verified, unverified := true, false
+	found, err := users.List(ctx, UserFilter{Verified: &verified}, ListOptions{})
+	assert.NoError(t, err)
+	if assert.Len(t, found, 1) {
+		assert.Equal(t, verifiedUser.ID, found[0].ID)
+	}
+	count, _ := users.Count(ctx, UserFilter{Verified: &unverified})
+	assert.Equal(t, int64(1), count)
+}
+
+func TestUserRepositoryTakenIDIsNotDuplicateEmail(t *testing.T) {
+	users, _ := newTestUsers(t)
+	alice := createUsers(t, users, "alice")[0]
+
+	clash := models.User{ID: alice.ID, Name: "Bob", Email: "bob@example.com"}
+	err := users.Create(context.Background(), &clash)
+	assert.ErrorIs(t, err, gorm.ErrDuplicatedKey)
+	assert.NotErrorIs(t, err, ErrDuplicateEmail)
+
+	taken := models.User{Name: "Alice", Email: "ALICE@example.com"}
+	assert.ErrorIs(t, users.Create(context.Background(), &taken), ErrDuplicateEmail)
+}
+
+func TestUserRepositoryUpdateKeepsOmittedColumns(t *testing.T) {
+	users, conn := newTestUsers(t)
+	ctx := context.Background()
+	user := createUsers(t, users, "alice")[0]
+	conn.Model(&models.User{}).Where("id = ?", user.ID).Update("password_hash", "hash")
+
+	user.Name = "Alice Smith"
+	require.NoError(t, users.Update(ctx, &user))
+	got, _ := users.Get(ctx, user.ID)
+	assert.Equal(t, "hash", got.PasswordHash)
+}
+
+func TestUserRepositoryListWithPosts(t *testing.T) {
+	users, conn := newTestUsers(t)
+	author := fixtures.SeedUsers(t, conn, 2)[0]
+	first := fixtures.NewPost(t, conn, author)
+	fixtures.NewPost(t, conn, author)
+
+	found, err := users.List(context.Background(), UserFilter{}, ListOptions{WithPosts: true})
+	assert.NoError(t, err)
+	if assert.Len(t, found, 2) {
+		if assert.Len(t, found[0].Posts, 2) {
+			assert.Equal(t, first.Title, found[0].Posts[0].Title)
+		}
+		assert.Empty(t, found[1].Posts)
+	}
+}
+
+func TestUserRepositoryListSelectsColumns(t *testing.T) {
+	_, conn := newTestUsers(t)
+	users := NewUserRepository(conn.Session(&gorm.Session{Logger: NewGormLogger(0)}))
+	createUsers(t, users, "alice")
+	ctx := context.Background()
+
+	// listedSQL is the SQL each List call ran
+	listedSQL := func(opts ListOptions) string {
+		logs := captureLogs(t, slog.LevelDebug)
+		_, err := users.List(ctx, UserFilter{}, opts)
+		require.NoError(t, err)
+		queries := logLines(t, logs, "query")
+		require.Len(t, queries, 1)
+		return queries[0]["sql"].(string)
+	}
+
+	sql := listedSQL(ListOptions{})
+	assert.Contains(t, sql, "SELECT `id`,`name`,`email`,`created_at`,`updated_at`,`deleted_at`,`version`,`role`,`phone`,`email_verified_at` FROM `users`")
+	assert.NotContains(t, sql, "*")
+	assert.NotContains(t, sql, "password_hash")
+
+	assert.Contains(t, listedSQL(ListOptions{Columns: []string{"id", "email"}}), "SELECT `id`,`email` FROM `users`")
+
+	logs := captureLogs(t, slog.LevelDebug)
+	_, err := users.List(ctx, UserFilter{}, ListOptions{Columns: []string{"id", "password_hash"}})
+	assert.ErrorIs(t, err, ErrUnlistedColumn)
+	assert.Empty(t, logLines(t, logs, "query"), "refused before querying")
+}
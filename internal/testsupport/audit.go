@@ -0,0 +1,63 @@
+package testsupport
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"Unit-Test/internal/models"
+	"Unit-Test/internal/storage"
+)
+
+// FakeAuditRepository is a storage.AuditRepository keeping the log in a slice.
+// Setting Err makes every Record fail with it, to test what a failed audit
+// write undoes.
+type FakeAuditRepository struct {
+	mu      sync.Mutex
+	entries []models.AuditLog
+	Err     error
+}
+
+// NewFakeAuditRepository returns an empty FakeAuditRepository
+func NewFakeAuditRepository() *FakeAuditRepository {
+	return &FakeAuditRepository{}
+}
+
+var _ storage.AuditRepository = (*FakeAuditRepository)(nil)
+
+func (f *FakeAuditRepository) Record(ctx context.Context, entry *models.AuditLog) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return f.Err
+	}
+	entry.ID = len(f.entries) + 1
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now()
+	}
+	f.entries = append(f.entries, *entry)
+	return nil
+}
+
+// Entries returns the log recorded so far, oldest first
+func (f *FakeAuditRepository) Entries() []models.AuditLog {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]models.AuditLog(nil), f.entries...)
+}
+
+// Snapshot lets a FakeTransactor roll the log back
+func (f *FakeAuditRepository) Snapshot() (restore func()) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	saved := len(f.entries)
+	return func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.entries = f.entries[:saved]
+	}
+}
@@ -0,0 +1,376 @@
+package testsupport
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"Unit-Test/internal/models"
+	"Unit-Test/internal/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// RunUserRepositoryTests checks the behaviour every storage.UserRepository must
+// share, so the fake stays interchangeable with the GORM repository. newRepo
+// returns an empty repository of the test's own.
+func RunUserRepositoryTests(t *testing.T, newRepo func(t *testing.T) storage.UserRepository) {
+	t.Run("CreateAndGet", func(t *testing.T) { testCreateAndGet(t, newRepo(t)) })
+	t.Run("DuplicateEmail", func(t *testing.T) { testDuplicateEmail(t, newRepo(t)) })
+	t.Run("Update", func(t *testing.T) { testUpdate(t, newRepo(t)) })
+	t.Run("Delete", func(t *testing.T) { testDelete(t, newRepo(t)) })
+	t.Run("Restore", func(t *testing.T) { testRestore(t, newRepo(t)) })
+	t.Run("CreateMany", func(t *testing.T) { testCreateMany(t, newRepo(t)) })
+	t.Run("UpdateColumns", func(t *testing.T) { testUpdateColumns(t, newRepo(t)) })
+	t.Run("Filters", func(t *testing.T) { testFilters(t, newRepo(t)) })
+	t.Run("ListOptions", func(t *testing.T) { testListOptions(t, newRepo(t)) })
+	t.Run("ListColumns", func(t *testing.T) { testListColumns(t, newRepo(t)) })
+	t.Run("Search", func(t *testing.T) { testSearch(t, newRepo(t)) })
+	t.Run("Stream", func(t *testing.T) { testStream(t, newRepo(t)) })
+}
+
+// createUsers stores a user for each name, with an email derived from it
+func createUsers(t *testing.T, users storage.UserRepository, names ...string) []models.User {
+	var created []models.User
+	for _, name := range names {
+		user := models.User{Name: name, Email: name + "@example.com"}
+		require.NoError(t, users.Create(context.Background(), &user))
+		created = append(created, user)
+	}
+	return created
+}
+
+// userIDs returns the ids of users, in order
+func userIDs(users []models.User) []int {
+	var ids []int
+	for _, u := range users {
+		ids = append(ids, u.ID)
+	}
+	return ids
+}
+
+func testCreateAndGet(t *testing.T, users storage.UserRepository) {
+	ctx := context.Background()
+
+	user := models.User{Name: " Alice ", Email: "Alice@Example.com", Version: 7}
+	require.NoError(t, users.Create(ctx, &user))
+	assert.NotZero(t, user.ID)
+	assert.Equal(t, 1, user.Version)
+	assert.Equal(t, models.RoleMember, user.Role)
+	assert.False(t, user.CreatedAt.IsZero())
+
+	got, err := users.Get(ctx, user.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "Alice", got.Name)
+	assert.Equal(t, "alice@example.com", got.Email)
+	assert.Equal(t, 1, got.Version)
+
+	got, err = users.GetByEmail(ctx, "ALICE@example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, user.ID, got.ID)
+
+	second := createUsers(t, users, "bob")[0]
+	assert.Greater(t, second.ID, user.ID)
+
+	_, err = users.Get(ctx, 999)
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	_, err = users.GetByEmail(ctx, "nobody@example.com")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+func testDuplicateEmail(t *testing.T, users storage.UserRepository) {
+	ctx := context.Background()
+	alice := createUsers(t, users, "alice")[0]
+
+	duplicate := models.User{Name: "Other", Email: "ALICE@example.com"}
+	assert.ErrorIs(t, users.Create(ctx, &duplicate), storage.ErrDuplicateEmail)
+
+	// Deleted users give their email up
+	require.NoError(t, users.Delete(ctx, alice.ID))
+	assert.NoError(t, users.Create(ctx, &duplicate))
+}
+
+func testUpdate(t *testing.T, users storage.UserRepository) {
+	ctx := context.Background()
+	created := createUsers(t, users, "alice", "bob")
+
+	user := created[0]
+	user.Name = " Alice  Smith "
+	user.Role = models.RoleAdmin
+	require.NoError(t, users.Update(ctx, &user))
+	assert.Equal(t, 2, user.Version)
+	assert.Equal(t, "Alice Smith", user.Name)
+
+	got, err := users.Get(ctx, user.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "Alice Smith", got.Name)
+	assert.Equal(t, models.RoleAdmin, got.Role)
+	assert.Equal(t, 2, got.Version)
+
+	// A copy read before the update is stale now, and is left as it was
+	stale := created[0]
+	stale.Name = "Too late"
+	assert.ErrorIs(t, users.Update(ctx, &stale), storage.ErrVersionConflict)
+	assert.Equal(t, 1, stale.Version)
+
+	user.Email = "bob@example.com"
+	assert.ErrorIs(t, users.Update(ctx, &user), storage.ErrDuplicateEmail)
+	got, _ = users.Get(ctx, user.ID)
+	assert.Equal(t, "alice@example.com", got.Email)
+
+	gone := models.User{ID: 999, Name: "Gone", Email: "gone@example.com", Version: 1}
+	assert.ErrorIs(t, users.Update(ctx, &gone), storage.ErrNotFound)
+}
+
+func testDelete(t *testing.T, users storage.UserRepository) {
+	ctx := context.Background()
+	created := createUsers(t, users, "alice", "bob")
+
+	require.NoError(t, users.Delete(ctx, created[0].ID))
+	_, err := users.Get(ctx, created[0].ID)
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	_, err = users.GetByEmail(ctx, created[0].Email)
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	assert.ErrorIs(t, users.Delete(ctx, created[0].ID), storage.ErrNotFound)
+	assert.ErrorIs(t, users.Update(ctx, &created[0]), storage.ErrNotFound)
+
+	count, err := users.Count(ctx, storage.UserFilter{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+	count, _ = users.Count(ctx, storage.UserFilter{IncludeDeleted: true})
+	assert.Equal(t, int64(2), count)
+
+	found, _ := users.List(ctx, storage.UserFilter{IncludeDeleted: true}, storage.ListOptions{Sort: []storage.Sort{{Column: "id"}}})
+	if assert.Len(t, found, 2) {
+		assert.True(t, found[0].DeletedAt.Valid)
+		assert.False(t, found[1].DeletedAt.Valid)
+	}
+}
+
+func testRestore(t *testing.T, users storage.UserRepository) {
+	ctx := context.Background()
+	created := createUsers(t, users, "alice", "bob")
+
+	assert.ErrorIs(t, users.Restore(ctx, created[0].ID), storage.ErrNotFound, "not deleted")
+	assert.ErrorIs(t, users.Restore(ctx, 999), storage.ErrNotFound)
+
+	require.NoError(t, users.Delete(ctx, created[0].ID))
+	require.NoError(t, users.Restore(ctx, created[0].ID))
+	got, err := users.Get(ctx, created[0].ID)
+	assert.NoError(t, err)
+	assert.False(t, got.DeletedAt.Valid)
+
+	// A restore can't bring back an email that is in use again
+	require.NoError(t, users.Delete(ctx, created[1].ID))
+	reused := models.User{Name: "New Bob", Email: "bob@example.com"}
+	require.NoError(t, users.Create(ctx, &reused))
+	assert.ErrorIs(t, users.Restore(ctx, created[1].ID), storage.ErrDuplicateEmail)
+}
+
+func testCreateMany(t *testing.T, users storage.UserRepository) {
+	ctx := context.Background()
+	createUsers(t, users, "alice")
+
+	batch := []models.User{{Name: "Bob", Email: "Bob@example.com"}, {Name: "Carol", Email: "carol@example.com"}}
+	require.NoError(t, users.CreateMany(ctx, batch))
+	for _, user := range batch {
+		assert.NotZero(t, user.ID)
+		assert.Equal(t, 1, user.Version)
+	}
+	got, err := users.GetByEmail(ctx, "bob@example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, batch[0].ID, got.ID)
+
+	inUse, err := users.EmailsInUse(ctx, []string{"ALICE@example.com", "bob@example.com", "dave@example.com"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]bool{"alice@example.com": true, "bob@example.com": true}, inUse)
+
+	require.NoError(t, users.Delete(ctx, batch[1].ID))
+	inUse, _ = users.EmailsInUse(ctx, []string{"carol@example.com"})
+	assert.Empty(t, inUse, "deleted users' emails are free")
+}
+
+func testUpdateColumns(t *testing.T, users storage.UserRepository) {
+	ctx := context.Background()
+	user := createUsers(t, users, "alice")[0]
+
+	require.NoError(t, users.UpdatePreferences(ctx, user.ID, models.Preferences{"theme": []byte(`"dark"`)}))
+	require.NoError(t, users.UpdateAvatar(ctx, user.ID, "avatars/1.png"))
+	got, err := users.Get(ctx, user.ID)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `"dark"`, string(got.Preferences["theme"]))
+	assert.Equal(t, "avatars/1.png", got.AvatarPath)
+	assert.Equal(t, 1, got.Version, "the version is left alone")
+
+	require.NoError(t, users.Delete(ctx, user.ID))
+	assert.ErrorIs(t, users.UpdatePreferences(ctx, user.ID, models.Preferences{}), storage.ErrNotFound)
+	assert.ErrorIs(t, users.UpdateAvatar(ctx, 999, "avatars/999.png"), storage.ErrNotFound)
+}
+
+func testFilters(t *testing.T, users storage.UserRepository) {
+	ctx := context.Background()
+	created := createUsers(t, users, "alice", "bob", "alicia")
+	bob := created[1]
+	bob.Role = models.RoleAdmin
+	require.NoError(t, users.Update(ctx, &bob))
+
+	unverified := false
+	tests := []struct {
+		name   string
+		filter storage.UserFilter
+		want   []int
+	}{
+		{"everyone", storage.UserFilter{}, []int{1, 2, 3}},
+		{"name ignores case", storage.UserFilter{Name: "ALI"}, []int{1, 3}},
+		{"name wildcards are literal", storage.UserFilter{Name: "%"}, nil},
+		{"search name or email", storage.UserFilter{Search: "LICIA"}, []int{3}},
+		{"search email", storage.UserFilter{Search: "bob@"}, []int{2}},
+		{"search wildcards are literal", storage.UserFilter{Search: "a_i"}, nil},
+		{"name underscore is literal", storage.UserFilter{Name: "b_b"}, nil},
+		{"email", storage.UserFilter{Email: "bob@example.com"}, []int{2}},
+		{"email ignores case", storage.UserFilter{Email: " Bob@Example.COM"}, []int{2}},
+		{"role", storage.UserFilter{Role: models.RoleAdmin}, []int{2}},
+		{"unverified", storage.UserFilter{Verified: &unverified}, []int{1, 2, 3}},
+		{"ids", storage.UserFilter{IDs: []int{3, 1}}, []int{1, 3}},
+		{"no ids", storage.UserFilter{IDs: []int{}}, nil},
+		{"combined", storage.UserFilter{Name: "ali", IDs: []int{2, 3}}, []int{3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			found, err := users.List(ctx, tt.filter, storage.ListOptions{Sort: []storage.Sort{{Column: "id"}}})
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, userIDs(found))
+
+			count, err := users.Count(ctx, tt.filter)
+			assert.NoError(t, err)
+			assert.Equal(t, int64(len(tt.want)), count)
+		})
+	}
+}
+
+func testListOptions(t *testing.T, users storage.UserRepository) {
+	ctx := context.Background()
+	createUsers(t, users, "carol", "alice", "bob")
+
+	found, err := users.List(ctx, storage.UserFilter{}, storage.ListOptions{Sort: []storage.Sort{{Column: "name", Desc: true}}})
+	assert.NoError(t, err)
+	assert.Equal(t, []int{1, 3, 2}, userIDs(found))
+
+	found, _ = users.List(ctx, storage.UserFilter{}, storage.ListOptions{Sort: []storage.Sort{{Column: "name"}}, Limit: 2})
+	assert.Equal(t, []int{2, 3}, userIDs(found))
+
+	found, _ = users.List(ctx, storage.UserFilter{}, storage.ListOptions{Limit: 2, Offset: 1})
+	assert.Equal(t, []int{2, 3}, userIDs(found))
+
+	found, _ = users.List(ctx, storage.UserFilter{}, storage.ListOptions{Limit: 2, Offset: 5})
+	assert.Empty(t, found)
+
+	after := 1
+	found, _ = users.List(ctx, storage.UserFilter{}, storage.ListOptions{Limit: 1, AfterID: &after})
+	assert.Equal(t, []int{2}, userIDs(found))
+
+	found, _ = users.List(ctx, storage.UserFilter{IDs: []int{3, 2}}, storage.ListOptions{})
+	assert.Equal(t, []int{2, 3}, userIDs(found))
+
+	found, _ = users.List(ctx, storage.UserFilter{IDs: []int{2}}, storage.ListOptions{Columns: []string{"id", "name"}, WithPosts: true})
+	if assert.Len(t, found, 1) {
+		assert.Equal(t, 2, found[0].ID)
+		assert.Equal(t, "alice", found[0].Name)
+		assert.Empty(t, found[0].Email)
+		assert.Zero(t, found[0].Version)
+		assert.Empty(t, found[0].Posts)
+	}
+}
+
+func testListColumns(t *testing.T, users storage.UserRepository) {
+	ctx := context.Background()
+	user := models.User{Name: "alice", Email: "alice@example.com", PasswordHash: "hash", AvatarPath: "avatars/1.png"}
+	require.NoError(t, users.Create(ctx, &user))
+
+	found, err := users.List(ctx, storage.UserFilter{}, storage.ListOptions{})
+	require.NoError(t, err)
+	if assert.Len(t, found, 1) {
+		assert.Equal(t, "alice@example.com", found[0].Email)
+		assert.Equal(t, 1, found[0].Version)
+		assert.Empty(t, found[0].PasswordHash, "never listed")
+		assert.Empty(t, found[0].AvatarPath)
+	}
+
+	for _, columns := range [][]string{{"id", "password_hash"}, {"avatar_path"}, {"no_such_column"}} {
+		_, err := users.List(ctx, storage.UserFilter{}, storage.ListOptions{Columns: columns})
+		assert.ErrorIs(t, err, storage.ErrUnlistedColumn, "%v", columns)
+	}
+
+	// Get is for the service's own use, and loads the whole user
+	stored, err := users.Get(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "hash", stored.PasswordHash)
+
+	login, err := users.GetForLogin(ctx, "ALICE@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, models.User{ID: user.ID, PasswordHash: "hash"}, login)
+	_, err = users.GetForLogin(ctx, "bob@example.com")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+func testSearch(t *testing.T, users storage.UserRepository) {
+	ctx := context.Background()
+	created := createUsers(t, users, "alice", "bob", "malice", "carol")
+	bob := created[1]
+	bob.Name = "alice@example.com"
+	require.NoError(t, users.Update(ctx, &bob))
+	require.NoError(t, users.Delete(ctx, created[3].ID))
+
+	// The exact email match leads, the rest follow by id
+	found, err := users.Search(ctx, "ALICE@example.com", storage.ListOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 2, 3}, userIDs(found))
+
+	found, err = users.Search(ctx, "alice@example.com", storage.ListOptions{Limit: 2, Offset: 1})
+	require.NoError(t, err)
+	assert.Equal(t, []int{2, 3}, userIDs(found))
+
+	found, err = users.Search(ctx, "carol", storage.ListOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, found, "deleted users are not found")
+
+	found, err = users.Search(ctx, "bob", storage.ListOptions{Columns: []string{"id", "name"}})
+	require.NoError(t, err)
+	if assert.Len(t, found, 1) {
+		assert.Equal(t, "alice@example.com", found[0].Name)
+		assert.Empty(t, found[0].Email)
+	}
+
+	_, err = users.Search(ctx, "bob", storage.ListOptions{Columns: []string{"password_hash"}})
+	assert.ErrorIs(t, err, storage.ErrUnlistedColumn)
+}
+
+func testStream(t *testing.T, users storage.UserRepository) {
+	ctx := context.Background()
+	createUsers(t, users, "alice", "bob", "alicia", "carol", "alina")
+
+	var batches [][]int
+	err := users.Stream(ctx, storage.UserFilter{Name: "ali"}, []string{"id", "name"}, 2, func(batch []models.User) error {
+		batches = append(batches, userIDs(batch))
+		for _, u := range batch {
+			assert.NotEmpty(t, u.Name)
+			assert.Empty(t, u.Email, "only the given columns are loaded")
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, [][]int{{1, 3}, {5}}, batches)
+
+	stop := errors.New("stop")
+	calls := 0
+	err = users.Stream(ctx, storage.UserFilter{}, nil, 2, func([]models.User) error {
+		calls++
+		return stop
+	})
+	assert.ErrorIs(t, err, stop)
+	assert.Equal(t, 1, calls)
+
+	err = users.Stream(ctx, storage.UserFilter{}, []string{"password_hash"}, 2, func([]models.User) error { return nil })
+	assert.ErrorIs(t, err, storage.ErrUnlistedColumn)
+}
@@ -0,0 +1,173 @@
+// Package fixtures creates the rows tests start from. Every row gets unique
+// defaults, so tests only spell out what they assert on, and is removed again
+// when the test finishes. A failing insert fails the test.
+package fixtures
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"Unit-Test/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// UserOption changes a user before NewUser stores it
+type UserOption func(*userSpec)
+
+// userSpec is the user NewUser stores, and what happens to it afterwards
+type userSpec struct {
+	user     models.User
+	verified bool
+	deleted  bool
+	// deletedAt backdates the soft delete when set
+	deletedAt time.Time
+}
+
+// WithName names the user
+func WithName(name string) UserOption {
+	return func(s *userSpec) { s.user.Name = name }
+}
+
+// WithEmail gives the user email in place of a unique one
+func WithEmail(email string) UserOption {
+	return func(s *userSpec) { s.user.Email = email }
+}
+
+// WithRole gives the user role; users are members otherwise
+func WithRole(role string) UserOption {
+	return func(s *userSpec) { s.user.Role = role }
+}
+
+// WithPhone gives the user a phone number
+func WithPhone(phone string) UserOption {
+	return func(s *userSpec) { s.user.Phone = phone }
+}
+
+// WithPasswordHash stores hash as the user's password hash
+func WithPasswordHash(hash string) UserOption {
+	return func(s *userSpec) { s.user.PasswordHash = hash }
+}
+
+// Verified marks the user's email verified. Creating a user always clears
+// the verification, so it is set once the user is stored.
+func Verified() UserOption {
+	return func(s *userSpec) { s.verified = true }
+}
+
+// Deleted soft-deletes the user once it is stored
+func Deleted() UserOption {
+	return func(s *userSpec) { s.deleted = true }
+}
+
+// DeletedAt soft-deletes the user once it is stored, as if it had been at at
+func DeletedAt(at time.Time) UserOption {
+	return func(s *userSpec) { s.deleted, s.deletedAt = true, at }
+}
+
+// sequence numbers the defaults, so they never collide, even across tests
+// sharing a database
+var sequence atomic.Int64
+
+// newUserSpec is a user with a unique name and email, changed by opts
+func newUserSpec(opts []UserOption) userSpec {
+	n := sequence.Add(1)
+	spec := userSpec{user: models.User{Name: fmt.Sprintf("User %d", n), Email: fmt.Sprintf("user-%d@example.com", n)}}
+	for _, opt := range opts {
+		opt(&spec)
+	}
+	return spec
+}
+
+// NewUser stores a user built from opts and returns it as stored
+func NewUser(t testing.TB, db *gorm.DB, opts ...UserOption) models.User {
+	t.Helper()
+	spec := newUserSpec(opts)
+	if err := db.Create(&spec.user).Error; err != nil {
+		t.Fatalf("fixtures: creating user %q <%s>: %v", spec.user.Name, spec.user.Email, err)
+	}
+	removeUsers(t, db, spec.user.ID)
+	finish(t, db, &spec)
+	return spec.user
+}
+
+// SeedUsers stores n users, each built from opts with its own unique
+// defaults, in id order
+func SeedUsers(t testing.TB, db *gorm.DB, n int, opts ...UserOption) []models.User {
+	t.Helper()
+	if n == 0 {
+		return nil
+	}
+	specs := make([]userSpec, n)
+	users := make([]models.User, n)
+	for i := range specs {
+		specs[i] = newUserSpec(opts)
+		users[i] = specs[i].user
+	}
+	if err := db.CreateInBatches(&users, 100).Error; err != nil {
+		t.Fatalf("fixtures: seeding %d users: %v", n, err)
+	}
+	ids := make([]int, n)
+	for i := range users {
+		ids[i] = users[i].ID
+	}
+	removeUsers(t, db, ids...)
+	for i := range specs {
+		specs[i].user = users[i]
+		finish(t, db, &specs[i])
+		users[i] = specs[i].user
+	}
+	return users
+}
+
+// finish applies what has to wait until the user is stored
+func finish(t testing.TB, db *gorm.DB, spec *userSpec) {
+	t.Helper()
+	if spec.verified {
+		now := time.Now().UTC()
+		if err := db.Model(&spec.user).UpdateColumn("email_verified_at", now).Error; err != nil {
+			t.Fatalf("fixtures: verifying user %d: %v", spec.user.ID, err)
+		}
+		spec.user.EmailVerifiedAt = &now
+	}
+	if spec.deleted {
+		err := db.Delete(&spec.user).Error
+		if err == nil && !spec.deletedAt.IsZero() {
+			err = db.Unscoped().Model(&spec.user).UpdateColumn("deleted_at", spec.deletedAt).Error
+			spec.user.DeletedAt = gorm.DeletedAt{Time: spec.deletedAt, Valid: true}
+		}
+		if err != nil {
+			t.Fatalf("fixtures: deleting user %d: %v", spec.user.ID, err)
+		}
+	}
+}
+
+// NewPost stores a post of user's with a unique title
+func NewPost(t testing.TB, db *gorm.DB, user models.User) models.Post {
+	t.Helper()
+	post := models.Post{UserID: user.ID, Title: fmt.Sprintf("Post %d", sequence.Add(1)), Body: "Hello"}
+	if err := db.Create(&post).Error; err != nil {
+		t.Fatalf("fixtures: creating a post of user %d: %v", user.ID, err)
+	}
+	t.Cleanup(func() {
+		if err := db.Delete(&models.Post{}, post.ID).Error; err != nil {
+			t.Errorf("fixtures: removing post %d: %v", post.ID, err)
+		}
+	})
+	return post
+}
+
+// removeUsers deletes the users with ids, and their posts, when t finishes
+func removeUsers(t testing.TB, db *gorm.DB, ids ...int) {
+	t.Cleanup(func() {
+		err := db.Where("user_id IN ?", ids).Delete(&models.Post{}).Error
+		if err == nil {
+			err = db.Unscoped().Delete(&models.User{}, ids).Error
+		}
+		if err != nil {
+			t.Errorf("fixtures: removing users %v: %v", ids, err)
+		}
+	})
+}
@@ -0,0 +1,204 @@
+package fixtures
+
+import (
+	"fmt"
+	"runtime"
+	"testing"
+	"time"
+
+	"Unit-Test/internal/models"
+	"Unit-Test/internal/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// openTestDB is a migrated in-memory database of t's own
+func openTestDB(t *testing.T) *gorm.DB {
+	conn, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory"), &gorm.Config{TranslateError: true})
+	require.NoError(t, err)
+	t.Cleanup(func() { storage.Close(conn) })
+	require.NoError(t, storage.AutoMigrate(conn))
+	return conn
+}
+
+// countUsers counts the users in conn, deleted ones included
+func countUsers(t *testing.T, conn *gorm.DB) int64 {
+	var count int64
+	require.NoError(t, conn.Unscoped().Model(&models.User{}).Count(&count).Error)
+	return count
+}
+
+// fatalRecorder keeps the message of the Fatalf that stops the test
+type fatalRecorder struct {
+	*testing.T
+	message string
+}
+
+func (r *fatalRecorder) Fatalf(format string, args ...interface{}) {
+	r.message = fmt.Sprintf(format, args...)
+	runtime.Goexit()
+}
+
+// fatalMessage runs fn as a test of its own and returns what it failed with
+func fatalMessage(t *testing.T, fn func(t testing.TB)) string {
+	r := &fatalRecorder{T: t}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fn(r)
+	}()
+	<-done
+	return r.message
+}
+
+func TestNewUser(t *testing.T) {
+	conn := openTestDB(t)
+
+	alice := NewUser(t, conn, WithName("Alice"), WithEmail("alice@example.com"), WithRole(models.RoleAdmin))
+	other := NewUser(t, conn)
+
+	var stored models.User
+	require.NoError(t, conn.First(&stored, alice.ID).Error)
+	assert.Equal(t, "Alice", stored.Name)
+	assert.Equal(t, "alice@example.com", stored.Email)
+	assert.Equal(t, models.RoleAdmin, stored.Role)
+	assert.NotEqual(t, alice.Email, other.Email)
+	assert.NotEqual(t, alice.ID, other.ID)
+}
+
+func TestNewUserVerifiedAndDeleted(t *testing.T) {
+	conn := openTestDB(t)
+
+	verified := NewUser(t, conn, Verified())
+	assert.NotNil(t, verified.EmailVerifiedAt)
+	var stored models.User
+	require.NoError(t, conn.First(&stored, verified.ID).Error)
+	assert.NotNil(t, stored.EmailVerifiedAt)
+
+	deleted := NewUser(t, conn, Deleted())
+	assert.ErrorIs(t, conn.First(&models.User{}, deleted.ID).Error, gorm.ErrRecordNotFound)
+	assert.NoError(t, conn.Unscoped().First(&models.User{}, deleted.ID).Error)
+
+	at := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	backdated := NewUser(t, conn, DeletedAt(at))
+	var row models.User
+	require.NoError(t, conn.Unscoped().First(&row, backdated.ID).Error)
+	assert.True(t, row.DeletedAt.Time.Equal(at), "deleted at %s", row.DeletedAt.Time)
+	assert.True(t, backdated.DeletedAt.Time.Equal(at))
+}
+
+func TestSeedUsers(t *testing.T) {
+	conn := openTestDB(t)
+
+	users := SeedUsers(t, conn, 250, WithRole(models.RoleAdmin))
+	require.Len(t, users, 250)
+	emails := map[string]bool{}
+	for i, user := range users {
+		if i > 0 {
+			assert.Greater(t, user.ID, users[i-1].ID)
+		}
+		assert.Equal(t, models.RoleAdmin, user.Role)
+		emails[user.Email] = true
+	}
+	assert.Len(t, emails, 250)
+	assert.Equal(t, int64(250), countUsers(t, conn))
+	assert.Empty(t, SeedUsers(t, conn, 0))
+}
+
+func TestFixturesAreRemoved(t *testing.T) {
+	conn := openTestDB(t)
+
+	t.Run("fixtures", func(t *testing.T) {
+		user := NewUser(t, conn, Deleted())
+		NewPost(t, conn, SeedUsers(t, conn, 3)[0])
+		NewPost(t, conn, user)
+	})
+
+	assert.Zero(t, countUsers(t, conn))
+	var posts int64
+	require.NoError(t, conn.Model(&models.Post{}).Count(&posts).Error)
+	assert.Zero(t, posts)
+}
+
+func TestFixtureFailuresFailTheTest(t *testing.T) {
+	conn := openTestDB(t)
+	NewUser(t, conn, WithEmail("taken@example.com"))
+
+	message := fatalMessage(t, func(t testing.TB) {
+		NewUser(t, conn, WithName("Bob"), WithEmail("taken@example.com"))
+	})
+	assert.Contains(t, message, `creating user "Bob" <taken@example.com>`)
+	assert.Contains(t, message, gorm.ErrDuplicatedKey.Error())
+
+	message = fatalMessage(t, func(t testing.TB) {
+		SeedUsers(t, conn, 2, WithEmail("twice@example.com"))
+	})
+	assert.Contains(t, message, "seeding 2 users")
+}
+
+func TestLoad(t *testing.T) {
+	conn := openTestDB(t)
+
+	t.Run("load", func(t *testing.T) {
+		start := time.Now()
+		Load(t, conn, "scenario.yaml")
+
+		var alice models.User
+		require.NoError(t, conn.First(&alice, 1).Error)
+		assert.Equal(t, models.RoleAdmin, alice.Role)
+		assert.WithinDuration(t, start.Add(-48*time.Hour), alice.CreatedAt, time.Minute, "stored as written, hooks skipped")
+		if assert.NotNil(t, alice.EmailVerifiedAt) {
+			assert.WithinDuration(t, start.Add(-24*time.Hour), *alice.EmailVerifiedAt, time.Minute)
+		}
+		assert.JSONEq(t, `"dark"`, string(alice.Preferences["theme"]))
+		assert.Equal(t, 1, alice.Version, "defaults fill what is left out")
+
+		assert.ErrorIs(t, conn.First(&models.User{}, 2).Error, gorm.ErrRecordNotFound, "soft-deleted")
+
+		var posts []models.Post
+		require.NoError(t, conn.Order("id").Find(&posts, "user_id = ?", 1).Error)
+		if assert.Len(t, posts, 2) {
+			assert.WithinDuration(t, start.Add(-2*time.Hour), posts[0].CreatedAt, time.Minute)
+			assert.WithinDuration(t, start, posts[1].CreatedAt, time.Minute)
+		}
+
+		var entry models.AuditLog
+		require.NoError(t, conn.First(&entry, "user_id = ?", 1).Error)
+		assert.JSONEq(t, `{"name":"Alice","email":"alice@example.com"}`, string(entry.After))
+	})
+
+	assert.Zero(t, countUsers(t, conn), "removed when the test finished")
+	var entries int64
+	require.NoError(t, conn.Model(&models.AuditLog{}).Count(&entries).Error)
+	assert.Zero(t, entries)
+}
+
+func TestLoadJSON(t *testing.T) {
+	conn := openTestDB(t)
+	Load(t, conn, "scenario.json")
+
+	var address models.Address
+	require.NoError(t, conn.First(&address, "user_id = ?", 1).Error)
+	assert.Equal(t, "Springfield", address.City)
+}
+
+func TestLoadFailures(t *testing.T) {
+	conn := openTestDB(t)
+
+	tests := []struct {
+		file    string
+		message string
+	}{
+		{"unknown_table.yaml", `testdata/unknown_table.yaml:3: unknown table "comments"`},
+		{"unknown_column.yaml", `testdata/unknown_column.yaml:6: users: unknown column "nickname"`},
+		{"missing.yaml", "testdata/missing.yaml: no such file or directory"},
+	}
+	for _, tt := range tests {
+		message := fatalMessage(t, func(t testing.TB) { Load(t, conn, tt.file) })
+		assert.Contains(t, message, tt.message)
+	}
+	assert.Zero(t, countUsers(t, conn), "nothing is stored from a file that fails")
+}
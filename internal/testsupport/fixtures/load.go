@@ -0,0 +1,196 @@
+package fixtures
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+
+	"Unit-Test/internal/models"
+
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// loadableTable is a table a fixture file may fill, and the model of its rows
+type loadableTable struct {
+	table string
+	model func() interface{}
+}
+
+// loadable are the tables a fixture file may fill, in the order they are
+// inserted so every row's references exist before it
+var loadable = []loadableTable{
+	{"users", func() interface{} { return &models.User{} }},
+	{"addresses", func() interface{} { return &models.Address{} }},
+	{"posts", func() interface{} { return &models.Post{} }},
+	{"api_keys", func() interface{} { return &models.APIKey{} }},
+	{"refresh_tokens", func() interface{} { return &models.RefreshToken{} }},
+	{"password_resets", func() interface{} { return &models.PasswordReset{} }},
+	{"email_verifications", func() interface{} { return &models.EmailVerification{} }},
+	{"audit_logs", func() interface{} { return &models.AuditLog{} }},
+	{"webhooks", func() interface{} { return &models.Webhook{} }},
+}
+
+// fixtureFuncs are what a fixture file's templates can call: now "-2h" is
+// the time two hours ago, now "" the current one
+func fixtureFuncs(now time.Time) template.FuncMap {
+	return template.FuncMap{
+		"now": func(offset string) (string, error) {
+			if offset == "" {
+				return now.Format(time.RFC3339Nano), nil
+			}
+			d, err := time.ParseDuration(offset)
+			if err != nil {
+				return "", err
+			}
+			return now.Add(d).Format(time.RFC3339Nano), nil
+		},
+	}
+}
+
+// Load stores the rows of testdata/name, a YAML (or JSON) file mapping each
+// table to its rows, and removes them when t finishes:
+//
+//	users:
+//	  - id: 1
+//	    name: Alice
+//	    created_at: '{{ now "-2h" }}'
+//
+// Rows are stored as written, without the models' hooks, so timestamps and
+// versions can be set; columns left out get their defaults. Give rows the ids
+// other rows refer to them by. A table or column the models don't have fails
+// the test at its line.
+func Load(t testing.TB, db *gorm.DB, name string) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("fixtures: %v", err)
+	}
+	tmpl, err := template.New(name).Funcs(fixtureFuncs(time.Now().UTC())).Parse(string(data))
+	if err != nil {
+		t.Fatalf("fixtures: %s: %v", path, err)
+	}
+	var expanded bytes.Buffer
+	if err := tmpl.Execute(&expanded, nil); err != nil {
+		t.Fatalf("fixtures: %s: %v", path, err)
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(expanded.Bytes(), &doc); err != nil {
+		t.Fatalf("fixtures: %s: %v", path, err)
+	}
+	if len(doc.Content) == 0 {
+		return
+	}
+	tables := doc.Content[0]
+	if tables.Kind != yaml.MappingNode {
+		t.Fatalf("fixtures: %s:%d: expected tables mapped to their rows", path, tables.Line)
+	}
+	rows := map[string][]interface{}{}
+	for i := 0; i < len(tables.Content); i += 2 {
+		key, value := tables.Content[i], tables.Content[i+1]
+		index := slices.IndexFunc(loadable, func(l loadableTable) bool { return l.table == key.Value })
+		if index < 0 {
+			t.Fatalf("fixtures: %s:%d: unknown table %q", path, key.Line, key.Value)
+		}
+		if value.Kind != yaml.SequenceNode {
+			t.Fatalf("fixtures: %s:%d: expected a list of %s rows", path, value.Line, key.Value)
+		}
+		for _, row := range value.Content {
+			record, err := decodeRow(db, loadable[index].model(), row)
+			if err != nil {
+				t.Fatalf("fixtures: %s:%d: %s: %v", path, err.line, key.Value, err.err)
+			}
+			rows[key.Value] = append(rows[key.Value], record)
+		}
+	}
+
+	plain := db.Session(&gorm.Session{SkipHooks: true})
+	for _, l := range loadable {
+		for _, record := range rows[l.table] {
+			if err := plain.Create(record).Error; err != nil {
+				t.Fatalf("fixtures: %s: storing %s: %v", path, l.table, err)
+			}
+		}
+	}
+	t.Cleanup(func() {
+		for i := len(loadable) - 1; i >= 0; i-- {
+			for _, record := range rows[loadable[i].table] {
+				if err := db.Unscoped().Delete(record).Error; err != nil {
+					t.Errorf("fixtures: %s: removing %s: %v", path, loadable[i].table, err)
+				}
+			}
+		}
+	})
+}
+
+// rowError is a row that doesn't fit its table, at line
+type rowError struct {
+	line int
+	err  error
+}
+
+// decodeRow sets the columns of a mapping node on model
+func decodeRow(db *gorm.DB, model interface{}, row *yaml.Node) (interface{}, *rowError) {
+	if row.Kind != yaml.MappingNode {
+		return nil, &rowError{row.Line, fmt.Errorf("expected a row of columns")}
+	}
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return nil, &rowError{row.Line, err}
+	}
+	target := reflect.ValueOf(model).Elem()
+	for i := 0; i < len(row.Content); i += 2 {
+		key, node := row.Content[i], row.Content[i+1]
+		field := stmt.Schema.FieldsByDBName[key.Value]
+		if field == nil {
+			return nil, &rowError{key.Line, fmt.Errorf("unknown column %q", key.Value)}
+		}
+		value, err := columnValue(field, node)
+		if err == nil {
+			err = field.Set(context.Background(), target, value)
+		}
+		if err != nil {
+			return nil, &rowError{node.Line, fmt.Errorf("column %s: %w", key.Value, err)}
+		}
+	}
+	return model, nil
+}
+
+// columnValue is what a node holds, in a form field can be set from: nested
+// documents as JSON, timestamps as times
+func columnValue(field *schema.Field, node *yaml.Node) (interface{}, error) {
+	var value interface{}
+	if err := node.Decode(&value); err != nil {
+		return nil, err
+	}
+	switch v := value.(type) {
+	case map[string]interface{}, []interface{}:
+		return json.Marshal(v)
+	case string:
+		if isTimeField(field) {
+			return time.Parse(time.RFC3339Nano, strings.TrimSpace(v))
+		}
+	}
+	return value, nil
+}
+
+// isTimeField reports whether field holds a point in time
+func isTimeField(field *schema.Field) bool {
+	switch field.FieldType {
+	case reflect.TypeOf(time.Time{}), reflect.TypeOf(&time.Time{}), reflect.TypeOf(gorm.DeletedAt{}):
+		return true
+	}
+	return false
+}
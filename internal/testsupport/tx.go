@@ -0,0 +1,41 @@
+package testsupport
+
+import (
+	"context"
+
+	"Unit-Test/internal/storage"
+)
+
+// Snapshotter is a fake whose state can be rolled back
+type Snapshotter interface {
+	// Snapshot saves the current state and returns the function restoring it
+	Snapshot() (restore func())
+}
+
+// FakeTransactor is a storage.Transactor over fakes: a function that fails
+// leaves them as they were before it ran. Transactions are not isolated from
+// each other, so it only suits tests running one at a time.
+type FakeTransactor struct {
+	stores []Snapshotter
+}
+
+// NewFakeTransactor returns a FakeTransactor rolling back stores
+func NewFakeTransactor(stores ...Snapshotter) FakeTransactor {
+	return FakeTransactor{stores: stores}
+}
+
+var _ storage.Transactor = FakeTransactor{}
+
+func (t FakeTransactor) InTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	restores := make([]func(), len(t.stores))
+	for i, store := range t.stores {
+		restores[i] = store.Snapshot()
+	}
+	if err := fn(ctx); err != nil {
+		for _, restore := range restores {
+			restore()
+		}
+		return err
+	}
+	return nil
+}
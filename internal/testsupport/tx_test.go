@@ -0,0 +1,49 @@
+package testsupport
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"Unit-Test/internal/models"
+	"Unit-Test/internal/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFakeTransactorRollsBack(t *testing.T) {
+	users, audit := NewFakeUserRepository(), NewFakeAuditRepository()
+	tx := NewFakeTransactor(users, audit)
+	ctx := context.Background()
+	createUsers(t, users, "alice")
+
+	failed := errors.New("failed")
+	err := tx.InTx(ctx, func(ctx context.Context) error {
+		bob := models.User{Name: "bob", Email: "bob@example.com"}
+		require.NoError(t, users.Create(ctx, &bob))
+		require.NoError(t, audit.Record(ctx, &models.AuditLog{Action: models.AuditCreate, UserID: bob.ID}))
+		require.NoError(t, users.Delete(ctx, 1))
+		return failed
+	})
+	assert.ErrorIs(t, err, failed)
+
+	count, _ := users.Count(ctx, storage.UserFilter{})
+	assert.Equal(t, int64(1), count)
+	_, err = users.Get(ctx, 1)
+	assert.NoError(t, err)
+	assert.Empty(t, audit.Entries())
+
+	// The id handed out in the rolled back transaction is reused
+	carol := models.User{Name: "carol", Email: "carol@example.com"}
+	require.NoError(t, tx.InTx(ctx, func(ctx context.Context) error { return users.Create(ctx, &carol) }))
+	assert.Equal(t, 2, carol.ID)
+}
+
+func TestFakeAuditRepositoryErr(t *testing.T) {
+	audit := NewFakeAuditRepository()
+	audit.Err = errors.New("disk full")
+
+	assert.ErrorIs(t, audit.Record(context.Background(), &models.AuditLog{}), audit.Err)
+	assert.Empty(t, audit.Entries())
+}
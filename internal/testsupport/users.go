@@ -0,0 +1,456 @@
+// Package testsupport holds test doubles for the storage layer, so handlers can
+// be tested without a database, SQLite or cgo
+package testsupport
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"Unit-Test/internal/models"
+	"Unit-Test/internal/storage"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// userSchema maps the users table's columns onto User's fields, for the
+// projections and orderings List accepts
+var userSchema = func() *schema.Schema {
+	s, err := schema.Parse(&models.User{}, &sync.Map{}, schema.NamingStrategy{})
+	if err != nil {
+		panic(err)
+	}
+	return s
+}()
+
+// FakeUserRepository is a storage.UserRepository keeping users in a map. It
+// enforces unique emails among active users and returns the same errors as the
+// GORM repository. Posts are not stored, so WithPosts lists every user with
+// none. Transactions carried by the context are ignored; a FakeTransactor
+// rolls the users back instead. FailWith makes it fail like a broken database.
+type FakeUserRepository struct {
+	mu     sync.Mutex
+	users  map[int]models.User
+	nextID int
+	err    error
+}
+
+// NewFakeUserRepository returns an empty FakeUserRepository
+func NewFakeUserRepository() *FakeUserRepository {
+	return &FakeUserRepository{users: map[int]models.User{}, nextID: 1}
+}
+
+var _ storage.UserRepository = (*FakeUserRepository)(nil)
+
+// active is the stored user with id unless it is missing or deleted
+func (f *FakeUserRepository) active(id int) (models.User, bool) {
+	user, ok := f.users[id]
+	return user, ok && !user.DeletedAt.Valid
+}
+
+// emailTaken reports whether an active user other than id has email
+func (f *FakeUserRepository) emailTaken(email string, id int) bool {
+	for _, user := range f.users {
+		if user.ID != id && !user.DeletedAt.Valid && strings.EqualFold(user.Email, email) {
+			return true
+		}
+	}
+	return false
+}
+
+// FailWith makes every later call return err, until it is called with nil
+func (f *FakeUserRepository) FailWith(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.err = err
+}
+
+// failure is the error a call fails with before touching the users: the
+// context's, or the one set with FailWith
+func (f *FakeUserRepository) failure(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.err
+}
+
+// Snapshot lets a FakeTransactor roll the users back
+func (f *FakeUserRepository) Snapshot() (restore func()) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	saved, nextID := maps.Clone(f.users), f.nextID
+	return func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.users, f.nextID = saved, nextID
+	}
+}
+
+func (f *FakeUserRepository) List(ctx context.Context, filter storage.UserFilter, opts storage.ListOptions) ([]models.User, error) {
+	if err := f.failure(ctx); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	users := f.matching(filter)
+	for _, s := range opts.Sort {
+		if userSchema.LookUpField(s.Column) == nil {
+			return nil, fmt.Errorf("unknown column %q", s.Column)
+		}
+	}
+	sort.SliceStable(users, func(i, j int) bool {
+		for _, s := range opts.Sort {
+			if c := compareColumn(users[i], users[j], s.Column); c != 0 {
+				return (c < 0) != s.Desc
+			}
+		}
+		return users[i].ID < users[j].ID
+	})
+
+	if opts.Limit > 0 {
+		start := opts.Offset
+		if opts.AfterID != nil {
+			start = 0
+			for start < len(users) && users[start].ID <= *opts.AfterID {
+				start++
+			}
+		}
+		users = users[min(start, len(users)):]
+		users = users[:min(opts.Limit, len(users))]
+	}
+
+	columns := opts.Columns
+	if len(columns) == 0 {
+		columns = storage.UserColumns
+	}
+	if err := storage.CheckColumns(columns); err != nil {
+		return nil, err
+	}
+	for i := range users {
+		users[i] = project(users[i], columns)
+		if opts.WithPosts {
+			users[i].Posts = []models.Post{}
+		}
+	}
+	return users, nil
+}
+
+// matching returns the users filter selects, ordered by id
+func (f *FakeUserRepository) matching(filter storage.UserFilter) []models.User {
+	var ids map[int]bool
+	if filter.IDs != nil {
+		ids = map[int]bool{}
+		for _, id := range filter.IDs {
+			ids[id] = true
+		}
+	}
+
+	users := []models.User{}
+	for _, user := range f.users {
+		switch {
+		case user.DeletedAt.Valid && !filter.IncludeDeleted:
+		case filter.Name != "" && !containsFold(user.Name, filter.Name):
+		case filter.Search != "" && !containsFold(user.Name, filter.Search) && !containsFold(user.Email, filter.Search):
+		case filter.Email != "" && !strings.EqualFold(user.Email, models.NormalizeEmail(filter.Email)):
+		case filter.Role != "" && user.Role != filter.Role:
+		case filter.Verified != nil && (user.EmailVerifiedAt != nil) != *filter.Verified:
+		case ids != nil && !ids[user.ID]:
+		default:
+			users = append(users, user)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	return users
+}
+
+// containsFold reports whether substr is within s, ignoring case
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+// project keeps only the given columns of user, which List has already checked
+func project(user models.User, columns []string) models.User {
+	var projected models.User
+	from, to := reflect.ValueOf(user), reflect.ValueOf(&projected).Elem()
+	for _, column := range columns {
+		index := userSchema.LookUpField(column).StructField.Index
+		to.FieldByIndex(index).Set(from.FieldByIndex(index))
+	}
+	return projected
+}
+
+// compareColumn orders a and b by column, which List has already checked exists
+func compareColumn(a, b models.User, column string) int {
+	index := userSchema.LookUpField(column).StructField.Index
+	x, y := reflect.ValueOf(a).FieldByIndex(index).Interface(), reflect.ValueOf(b).FieldByIndex(index).Interface()
+	switch x := x.(type) {
+	case int:
+		return x - y.(int)
+	case string:
+		return strings.Compare(x, y.(string))
+	case time.Time:
+		return x.Compare(y.(time.Time))
+	}
+	return 0
+}
+
+func (f *FakeUserRepository) Get(ctx context.Context, id int) (models.User, error) {
+	if err := f.failure(ctx); err != nil {
+		return models.User{}, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	user, ok := f.active(id)
+	if !ok {
+		return models.User{}, storage.ErrNotFound
+	}
+	return user, nil
+}
+
+func (f *FakeUserRepository) GetByEmail(ctx context.Context, email string) (models.User, error) {
+	if err := f.failure(ctx); err != nil {
+		return models.User{}, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, user := range f.users {
+		if !user.DeletedAt.Valid && strings.EqualFold(user.Email, email) {
+			return user, nil
+		}
+	}
+	return models.User{}, storage.ErrNotFound
+}
+
+func (f *FakeUserRepository) GetForLogin(ctx context.Context, email string) (models.User, error) {
+	user, err := f.GetByEmail(ctx, email)
+	if err != nil {
+		return models.User{}, err
+	}
+	return models.User{ID: user.ID, PasswordHash: user.PasswordHash}, nil
+}
+
+func (f *FakeUserRepository) Search(ctx context.Context, text string, opts storage.ListOptions) ([]models.User, error) {
+	if err := f.failure(ctx); err != nil {
+		return nil, err
+	}
+	columns := opts.Columns
+	if len(columns) == 0 {
+		columns = storage.UserColumns
+	}
+	if err := storage.CheckColumns(columns); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	users := f.matching(storage.UserFilter{Search: text})
+	// Exact email matches first, keeping the id order within each group
+	sort.SliceStable(users, func(i, j int) bool {
+		return strings.EqualFold(users[i].Email, text) && !strings.EqualFold(users[j].Email, text)
+	})
+	if opts.Limit > 0 {
+		users = users[min(opts.Offset, len(users)):]
+		users = users[:min(opts.Limit, len(users))]
+	}
+	for i := range users {
+		users[i] = project(users[i], columns)
+	}
+	return users, nil
+}
+
+func (f *FakeUserRepository) Stream(ctx context.Context, filter storage.UserFilter, columns []string, batchSize int, fn func([]models.User) error) error {
+	if err := f.failure(ctx); err != nil {
+		return err
+	}
+	if len(columns) == 0 {
+		columns = storage.UserColumns
+	}
+	if err := storage.CheckColumns(columns); err != nil {
+		return err
+	}
+	// fn runs unlocked, so it may use the repository itself
+	f.mu.Lock()
+	users := f.matching(filter)
+	f.mu.Unlock()
+
+	for start := 0; start < len(users); start += batchSize {
+		batch := users[start:min(start+batchSize, len(users))]
+		for i := range batch {
+			batch[i] = project(batch[i], columns)
+		}
+		if err := fn(batch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *FakeUserRepository) Create(ctx context.Context, user *models.User) error {
+	if err := f.failure(ctx); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// What the model's BeforeSave and BeforeCreate hooks do for the GORM repository
+	user.Normalize()
+	if f.emailTaken(user.Email, 0) {
+		return storage.ErrDuplicateEmail
+	}
+	now := time.Now()
+	user.ID = f.nextID
+	user.CreatedAt, user.UpdatedAt = now, now
+	user.EmailVerifiedAt = nil
+	user.Version = 1
+	if user.Role == "" {
+		user.Role = models.RoleMember
+	}
+	f.nextID++
+	f.users[user.ID] = *user
+	return nil
+}
+
+func (f *FakeUserRepository) CreateMany(ctx context.Context, users []models.User) error {
+	for i := range users {
+		if err := f.Create(ctx, &users[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *FakeUserRepository) EmailsInUse(ctx context.Context, emails []string) (map[string]bool, error) {
+	if err := f.failure(ctx); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	inUse := map[string]bool{}
+	for _, email := range emails {
+		if f.emailTaken(email, 0) {
+			inUse[strings.ToLower(email)] = true
+		}
+	}
+	return inUse, nil
+}
+
+func (f *FakeUserRepository) Update(ctx context.Context, user *models.User) error {
+	if err := f.failure(ctx); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	stored, ok := f.active(user.ID)
+	switch {
+	case !ok:
+		return storage.ErrNotFound
+	case stored.Version != user.Version:
+		return storage.ErrVersionConflict
+	}
+	user.Normalize()
+	if f.emailTaken(user.Email, user.ID) {
+		return storage.ErrDuplicateEmail
+	}
+
+	user.Version++
+	user.UpdatedAt = time.Now()
+	// The columns the GORM repository leaves alone keep their stored values
+	updated := *user
+	updated.CreatedAt = stored.CreatedAt
+	updated.DeletedAt = stored.DeletedAt
+	updated.Preferences = stored.Preferences
+	updated.PasswordHash = stored.PasswordHash
+	updated.EmailVerifiedAt = stored.EmailVerifiedAt
+	updated.Posts = nil
+	f.users[user.ID] = updated
+	return nil
+}
+
+func (f *FakeUserRepository) UpdatePreferences(ctx context.Context, id int, prefs models.Preferences) error {
+	return f.updateActive(ctx, id, func(user *models.User) {
+		user.Preferences = prefs
+	})
+}
+
+func (f *FakeUserRepository) UpdateAvatar(ctx context.Context, id int, path string) error {
+	return f.updateActive(ctx, id, func(user *models.User) {
+		user.AvatarPath = path
+	})
+}
+
+// updateActive applies set to the active user with id, as a single column update
+func (f *FakeUserRepository) updateActive(ctx context.Context, id int, set func(user *models.User)) error {
+	if err := f.failure(ctx); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	user, ok := f.active(id)
+	if !ok {
+		return storage.ErrNotFound
+	}
+	set(&user)
+	user.UpdatedAt = time.Now()
+	f.users[id] = user
+	return nil
+}
+
+func (f *FakeUserRepository) Delete(ctx context.Context, id int) error {
+	if err := f.failure(ctx); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	user, ok := f.active(id)
+	if !ok {
+		return storage.ErrNotFound
+	}
+	user.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+	f.users[id] = user
+	return nil
+}
+
+func (f *FakeUserRepository) Restore(ctx context.Context, id int) error {
+	if err := f.failure(ctx); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	user, ok := f.users[id]
+	if !ok || !user.DeletedAt.Valid {
+		return storage.ErrNotFound
+	}
+	if f.emailTaken(user.Email, id) {
+		return storage.ErrDuplicateEmail
+	}
+	user.DeletedAt = gorm.DeletedAt{}
+	user.UpdatedAt = time.Now()
+	f.users[id] = user
+	return nil
+}
+
+func (f *FakeUserRepository) Count(ctx context.Context, filter storage.UserFilter) (int64, error) {
+	if err := f.failure(ctx); err != nil {
+		return 0, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return int64(len(f.matching(filter))), nil
+}
@@ -0,0 +1,42 @@
+package testsupport
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"Unit-Test/internal/models"
+	"Unit-Test/internal/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFakeUserRepository(t *testing.T) {
+	RunUserRepositoryTests(t, func(t *testing.T) storage.UserRepository {
+		return NewFakeUserRepository()
+	})
+}
+
+func TestFakeUserRepositoryFailWith(t *testing.T) {
+	users := NewFakeUserRepository()
+	ctx := context.Background()
+	alice := models.User{Name: "Alice", Email: "alice@example.com"}
+	require.NoError(t, users.Create(ctx, &alice))
+
+	down := errors.New("database is down")
+	users.FailWith(down)
+	_, err := users.Get(ctx, alice.ID)
+	assert.ErrorIs(t, err, down)
+	_, err = users.List(ctx, storage.UserFilter{}, storage.ListOptions{})
+	assert.ErrorIs(t, err, down)
+	assert.ErrorIs(t, users.Create(ctx, &models.User{Name: "Bob", Email: "bob@example.com"}), down)
+	assert.ErrorIs(t, users.Delete(ctx, alice.ID), down)
+
+	users.FailWith(nil)
+	got, err := users.Get(ctx, alice.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "Alice", got.Name)
+	count, _ := users.Count(ctx, storage.UserFilter{})
+	assert.Equal(t, int64(1), count, "nothing changed while failing")
+}
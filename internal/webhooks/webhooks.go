@@ -0,0 +1,213 @@
+// Package webhooks tells the URLs subscribed in the webhooks table about the
+// user events the services publish. Each delivery is a signed JSON POST, sent
+// in the background and retried with exponential backoff until the receiver
+// answers with a 2xx or the attempts run out.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"Unit-Test/internal/jobs"
+	"Unit-Test/internal/models"
+	"Unit-Test/internal/service"
+
+	"gorm.io/gorm"
+)
+
+// Headers sent with every delivery
+const (
+	// SignatureHeader carries "sha256=" and the hex HMAC-SHA256 of the body,
+	// keyed with the webhook's secret
+	SignatureHeader = "X-Webhook-Signature"
+	// EventHeader names the event, as the payload does
+	EventHeader = "X-Webhook-Event"
+	// DeliveryHeader identifies the delivery; retries send the same one, so
+	// receivers can tell them apart from new events
+	DeliveryHeader = "X-Webhook-Delivery"
+)
+
+// ErrClosed is returned for events published after Close
+var ErrClosed = jobs.ErrClosed
+
+// Payload is the body of a delivery
+type Payload struct {
+	Event  string `json:"event"`
+	UserID int    `json:"user_id"`
+	// User as it is after the change; for deletions, as it was before
+	User      *models.User `json:"user"`
+	Timestamp time.Time    `json:"timestamp"`
+}
+
+// Options tune a Dispatcher; zero values take the defaults
+type Options struct {
+	// MaxAttempts is how often a delivery is tried, 5 by default
+	MaxAttempts int
+	// Backoff is the wait before the first retry, doubled for every retry
+	// after it; 1s by default
+	Backoff time.Duration
+	// Timeout bounds each attempt, 10s by default
+	Timeout time.Duration
+	// Workers is how many deliveries are sent at once, 4 by default
+	Workers int
+	// QueueSize is how many deliveries can wait for a worker before new ones
+	// are dropped, 1000 by default
+	QueueSize int
+}
+
+func (o *Options) setDefaults() {
+	if o.MaxAttempts <= 0 {
+		o.MaxAttempts = 5
+	}
+	if o.Backoff <= 0 {
+		o.Backoff = time.Second
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = 10 * time.Second
+	}
+	if o.Workers <= 0 {
+		o.Workers = 4
+	}
+	if o.QueueSize <= 0 {
+		o.QueueSize = 1000
+	}
+}
+
+// delivery is one payload on its way to one webhook, a job of the
+// dispatcher's queue
+type delivery struct {
+	d       *Dispatcher
+	id      string
+	webhook models.Webhook
+	event   string
+	body    []byte
+}
+
+func (del *delivery) Kind() string { return "webhook.delivery" }
+
+func (del *delivery) Run(ctx context.Context) error { return del.d.send(ctx, del) }
+
+func (del *delivery) LogValue() slog.Value {
+	return slog.GroupValue(slog.Int("webhook_id", del.webhook.ID), slog.String("event", del.event), slog.String("delivery", del.id))
+}
+
+// Dispatcher is a service.Publisher delivering events to the webhooks
+// subscribed to them. The services publish once the change is committed, so
+// a receiver never hears of a change it can't read back. Deliveries are sent
+// concurrently and retried, so they can arrive out of order; receivers order
+// them by their timestamp.
+type Dispatcher struct {
+	db     *gorm.DB
+	client *http.Client
+	queue  *jobs.Queue
+}
+
+// NewDispatcher starts the workers delivering the events published to it to
+// the webhooks stored in db
+func NewDispatcher(db *gorm.DB, opts Options) *Dispatcher {
+	opts.setDefaults()
+	return &Dispatcher{
+		db:     db,
+		client: &http.Client{Timeout: opts.Timeout},
+		queue: jobs.NewQueue(jobs.Options{
+			Name:        "webhooks",
+			Workers:     opts.Workers,
+			QueueSize:   opts.QueueSize,
+			MaxAttempts: opts.MaxAttempts,
+			Backoff:     opts.Backoff,
+		}),
+	}
+}
+
+// Publish queues event for every enabled webhook subscribed to it. It only
+// fails when deliveries can't be queued; how they go is logged.
+func (d *Dispatcher) Publish(ctx context.Context, event service.Event) error {
+	// The request that made the change may end before the lookup does
+	var webhooks []models.Webhook
+	if err := d.db.WithContext(context.WithoutCancel(ctx)).Where("enabled = ?", true).Order("id").Find(&webhooks).Error; err != nil {
+		return fmt.Errorf("webhooks: listing subscriptions: %w", err)
+	}
+	body, err := json.Marshal(Payload{Event: event.Type, UserID: event.UserID, User: event.User, Timestamp: event.At.UTC()})
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, webhook := range webhooks {
+		if !webhook.Events.Has(event.Type) {
+			continue
+		}
+		id, err := newDeliveryID()
+		if err != nil {
+			return err
+		}
+		err = d.queue.Enqueue(&delivery{d: d, id: id, webhook: webhook, event: event.Type, body: body})
+		if errors.Is(err, ErrClosed) {
+			return err
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("webhooks: dropped %s for webhook %d: %w", event.Type, webhook.ID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close stops taking events and waits for the queued deliveries, retries
+// included, until ctx is done. Deliveries still pending then are abandoned.
+func (d *Dispatcher) Close(ctx context.Context) error {
+	if err := d.queue.Close(ctx); err != nil {
+		return fmt.Errorf("webhooks: deliveries abandoned: %w", err)
+	}
+	return nil
+}
+
+// send makes one attempt at del, failing unless it is answered with a 2xx
+func (d *Dispatcher) send(ctx context.Context, del *delivery) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, del.webhook.URL, bytes.NewReader(del.body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, del.event)
+	req.Header.Set(DeliveryHeader, del.id)
+	req.Header.Set(SignatureHeader, Sign(del.webhook.Secret, del.body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// Read a little of the body, so the connection can be reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("answered %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Sign is the SignatureHeader value of body for a webhook with secret
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// newDeliveryID is a random id for a delivery
+func newDeliveryID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,214 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"Unit-Test/internal/models"
+	"Unit-Test/internal/service"
+	"Unit-Test/internal/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// received is a delivery as the receiver saw it
+type received struct {
+	header http.Header
+	body   []byte
+	at     time.Time
+}
+
+// receiver is a webhook endpoint answering with the statuses it is given in
+// turn, and 200 once they run out
+type receiver struct {
+	*httptest.Server
+	mu       sync.Mutex
+	statuses []int
+	got      []received
+	arrived  chan struct{}
+}
+
+func newReceiver(t *testing.T, statuses ...int) *receiver {
+	r := &receiver{statuses: statuses, arrived: make(chan struct{}, 100)}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		r.mu.Lock()
+		r.got = append(r.got, received{header: req.Header.Clone(), body: body, at: time.Now()})
+		status := http.StatusOK
+		if len(r.statuses) > 0 {
+			status, r.statuses = r.statuses[0], r.statuses[1:]
+		}
+		r.mu.Unlock()
+		w.WriteHeader(status)
+		r.arrived <- struct{}{}
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+// wait blocks until n more deliveries have arrived
+func (r *receiver) wait(t *testing.T, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		select {
+		case <-r.arrived:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("only %d of %d deliveries arrived", i, n)
+		}
+	}
+}
+
+func (r *receiver) deliveries() []received {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]received(nil), r.got...)
+}
+
+// openTestDB is a migrated in-memory database of t's own
+func openTestDB(t *testing.T) *gorm.DB {
+	conn, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{TranslateError: true})
+	require.NoError(t, err)
+	t.Cleanup(func() { storage.Close(conn) })
+	require.NoError(t, storage.AutoMigrate(conn))
+	return conn
+}
+
+// subscribe stores an enabled webhook for url
+func subscribe(t *testing.T, db *gorm.DB, url string, events models.EventMask) models.Webhook {
+	webhook := models.Webhook{URL: url, Secret: "s3cret", Enabled: true, Events: events}
+	require.NoError(t, db.Create(&webhook).Error)
+	return webhook
+}
+
+// startDispatcher is a Dispatcher on db that t closes when it finishes
+func startDispatcher(t *testing.T, db *gorm.DB, opts Options) *Dispatcher {
+	d := NewDispatcher(db, opts)
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_ = d.Close(ctx)
+	})
+	return d
+}
+
+var aliceCreated = service.Event{
+	Type:   service.EventUserCreated,
+	UserID: 1,
+	Actor:  "2",
+	At:     time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+	User:   &models.User{ID: 1, Name: "Alice", Email: "alice@example.com", Version: 1},
+}
+
+func TestDeliveryIsSigned(t *testing.T) {
+	db := openTestDB(t)
+	r := newReceiver(t)
+	subscribe(t, db, r.URL, models.EventMaskUserCreated)
+	d := startDispatcher(t, db, Options{})
+
+	require.NoError(t, d.Publish(context.Background(), aliceCreated))
+	r.wait(t, 1)
+
+	got := r.deliveries()[0]
+	assert.Equal(t, "application/json", got.header.Get("Content-Type"))
+	assert.Equal(t, service.EventUserCreated, got.header.Get(EventHeader))
+	assert.Len(t, got.header.Get(DeliveryHeader), 32)
+
+	// The receiver checks the signature with the secret alone
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write(got.body)
+	expected := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	assert.True(t, hmac.Equal([]byte(expected), []byte(got.header.Get(SignatureHeader))))
+	assert.NotEqual(t, Sign("other secret", got.body), got.header.Get(SignatureHeader))
+
+	var payload Payload
+	require.NoError(t, json.Unmarshal(got.body, &payload))
+	assert.Equal(t, service.EventUserCreated, payload.Event)
+	assert.Equal(t, 1, payload.UserID)
+	assert.True(t, aliceCreated.At.Equal(payload.Timestamp))
+	if assert.NotNil(t, payload.User) {
+		assert.Equal(t, "alice@example.com", payload.User.Email)
+	}
+}
+
+func TestDeliveryRetriesWithBackoff(t *testing.T) {
+	db := openTestDB(t)
+	r := newReceiver(t, http.StatusInternalServerError, http.StatusServiceUnavailable)
+	subscribe(t, db, r.URL, models.EventMaskUserCreated)
+	d := startDispatcher(t, db, Options{Backoff: 20 * time.Millisecond})
+
+	require.NoError(t, d.Publish(context.Background(), aliceCreated))
+	r.wait(t, 3)
+
+	got := r.deliveries()
+	require.Len(t, got, 3)
+	// A retry is the same delivery, and waits twice as long as the one before
+	for _, retry := range got[1:] {
+		assert.Equal(t, got[0].header.Get(DeliveryHeader), retry.header.Get(DeliveryHeader))
+		assert.Equal(t, got[0].body, retry.body)
+	}
+	assert.GreaterOrEqual(t, got[1].at.Sub(got[0].at), 20*time.Millisecond)
+	assert.GreaterOrEqual(t, got[2].at.Sub(got[1].at), 40*time.Millisecond)
+
+	// Answered with 200, so there are no more attempts
+	require.NoError(t, d.Close(context.Background()))
+	assert.Len(t, r.deliveries(), 3)
+}
+
+func TestDeliveryGivesUp(t *testing.T) {
+	db := openTestDB(t)
+	r := newReceiver(t, 500, 500, 500, 500, 500)
+	subscribe(t, db, r.URL, models.EventMaskUserCreated)
+	d := startDispatcher(t, db, Options{MaxAttempts: 3, Backoff: time.Millisecond})
+
+	require.NoError(t, d.Publish(context.Background(), aliceCreated))
+	require.NoError(t, d.Close(context.Background()))
+	assert.Len(t, r.deliveries(), 3)
+}
+
+func TestPublishOnlyToSubscribers(t *testing.T) {
+	db := openTestDB(t)
+	r := newReceiver(t)
+	subscribe(t, db, r.URL+"/deletions", models.EventMaskUserDeleted)
+	disabled := subscribe(t, db, r.URL+"/disabled", models.EventMaskUserCreated)
+	require.NoError(t, db.Model(&disabled).Update("enabled", false).Error)
+	subscribe(t, db, r.URL+"/all", models.EventMaskUserCreated|models.EventMaskUserUpdated|models.EventMaskUserDeleted)
+	d := startDispatcher(t, db, Options{})
+
+	require.NoError(t, d.Publish(context.Background(), aliceCreated))
+	require.NoError(t, d.Close(context.Background()))
+
+	got := r.deliveries()
+	if assert.Len(t, got, 1) {
+		var payload Payload
+		require.NoError(t, json.Unmarshal(got[0].body, &payload))
+		assert.Equal(t, service.EventUserCreated, payload.Event)
+	}
+}
+
+func TestCloseAbandonsRetries(t *testing.T) {
+	db := openTestDB(t)
+	r := newReceiver(t, 500)
+	subscribe(t, db, r.URL, models.EventMaskUserCreated)
+	d := startDispatcher(t, db, Options{Backoff: time.Hour})
+
+	require.NoError(t, d.Publish(context.Background(), aliceCreated))
+	r.wait(t, 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, d.Close(ctx), context.DeadlineExceeded)
+	assert.Len(t, r.deliveries(), 1)
+	assert.ErrorIs(t, d.Publish(context.Background(), aliceCreated), ErrClosed)
+}
@@ -1,199 +1,230 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
-	"net/http"
+	"log/slog"
+	"net"
 	"os"
+	"os/signal"
+	"syscall"
+
+	"Unit-Test/internal/cache"
+	"Unit-Test/internal/events"
+	"Unit-Test/internal/handlers"
+	"Unit-Test/internal/mail"
+	"Unit-Test/internal/purge"
+	"Unit-Test/internal/service"
+	"Unit-Test/internal/storage"
+	"Unit-Test/internal/webhooks"
 
-	"github.com/gin-contrib/cors"
-	"github.com/gin-gonic/gin"
 	_ "github.com/lib/pq"
-	swaggerFiles "github.com/swaggo/files"
-	ginSwagger "github.com/swaggo/gin-swagger"
-	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
-type User struct {
-	ID    int    `json:"id" gorm:"primaryKey;autoIncrement"`
-	Name  string `json:"name" gorm:"type:varchar(100);not null"`
-	Email string `json:"email" gorm:"type:varchar(100);uniqueIndex;not null"`
-}
-
-type ErrorResponse struct {
-	Message string `json:"message"`
-}
-
-// Global variable to hold the DB connection
-var db *gorm.DB
-var err error
-
 // @title User API
 // @version 1.0
 // @description This is a simple API for managing users in a PostgreSQL database.
-// @host localhost:8000
-// BasePath /api/v1 Because of this in url "/api/v1" was repeating and causing the error.
+// The host and the path a proxy serves the API under come from SWAGGER_HOST
+// and SWAGGER_BASE_PATH at runtime, so there is no @host or @BasePath. Both
+// API versions are documented under their full /api/v1 and /api/v2 paths.
+// v2 answers every paginated list with the envelope and deletes with 204.
 // @contact.name API Support
 // @contact.url http://localhost:8000/support   // Local URL for your development environment
 // @contact.email support@localhost.com
+// @securityDefinitions.apikey BearerAuth
+// @in header
+// @name Authorization
+// @description JWT sent as "Bearer <token>"; required for every POST, PUT, PATCH and DELETE
+// @securityDefinitions.apikey ApiKeyAuth
+// @in header
+// @name X-API-Key
+// @description API key created under /users/{id}/api-keys; accepted wherever BearerAuth is
+// @securityDefinitions.basic BasicAuth
+// @description BASIC_AUTH_USER and BASIC_AUTH_PASSWORD, for the docs, metrics and profiles when both are set
 func main() {
-	// Initialize the DB
-	initDB()
-
-	r := gin.Default()
-	r.Use(cors.Default())
-	// Serve Swagger UI
-	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
-
-	// Define other routes here...
-	r.GET("/api/v1/users", getUsers)
-	r.GET("/api/v1/users/:id", getUser)
-	r.POST("/api/v1/users", createUser)
-	r.PUT("/api/v1/users/:id", updateUser)
-	r.DELETE("/api/v1/users/:id", deleteUser)
-
-	// Start the server
-	if err := r.Run(":8000"); err != nil {
-		log.Fatal("Failed to start the server:", err)
+	// Flags override the environment. Fail fast, listing every missing or
+	// invalid setting at once.
+	cfg, opts, err := parseFlags(os.Args[1:], os.LookupEnv, os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return
 	}
-}
-
-// Initialize DB connection
-func initDB() {
-
-	dsn := os.Getenv("DATABASE_URL")
-	db, err = gorm.Open(postgres.Open(dsn), &gorm.Config{})
 	if err != nil {
-		log.Fatal("failed to connect to database", err)
+		log.Fatal(err)
 	}
-
-	// Auto-migrate the User struct to create the 'users' table
-	db.AutoMigrate(&User{})
-}
-
-// Fetch all users
-// @Summary Get all users
-// @Description Retrieve a list of all users in the database
-// @Tags Users
-// @Accept  json
-// @Produce  json
-// @Success 200 {array} User
-// @Failure 500 {object} ErrorResponse
-// @Router /api/v1/users [get]
-func getUsers(c *gin.Context) {
-	var users []User
-	if err := db.Find(&users).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Error fetching users"})
+	if opts.Version {
+		fmt.Println(buildVersion())
 		return
 	}
-	c.JSON(200, users)
-}
-
-// Fetch a single user by ID
-// @Summary Get user by ID
-// @Description Retrieve a single user's details by their ID
-// @Tags Users
-// @Accept json
-// @Produce json
-// @Param id path int true "User ID" // The ID of the user to retrieve
-// @Success 200 {object} User // The user object returned in the response
-// @Failure 400 {object} ErrorResponse // Bad request if the ID is invalid
-// @Failure 404 {object} ErrorResponse // User not found
-// @Failure 500 {object} ErrorResponse // Internal server error
-// @Router /api/v1/users/{id} [get]
-func getUser(c *gin.Context) {
-	id := c.Param("id")
-	var user User
-	if err := db.First(&user, id).Error; err != nil {
-		c.JSON(http.StatusNotFound, ErrorResponse{Message: "User not found"})
-		return
+	logger := handlers.ConfigureLogging(cfg.LogLevel)
+	// A bad certificate fails before waiting on the database
+	tlsCfg, err := tlsConfig(cfg, opts.DevTLS)
+	if err != nil {
+		log.Fatal(err)
 	}
-	c.JSON(200, user)
-}
 
-// Create a new user
-// @Summary Create a new user
-// @Description Create a new user by providing a name and email
-// @Tags Users
-// @Accept  json
-// @Produce  json
-// @Param user body User true "New user information"
-// @Success 201 {object} User
-// @Failure 400 {object} ErrorResponse
-// @Failure 500 {object} ErrorResponse
-// @Router /api/v1/users [post]
-func createUser(c *gin.Context) {
-	var user User
-	if err := c.ShouldBindJSON(&user); err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{Message: "Invalid input"})
-		return
-	}
+	// A signal stops the server, or the wait for the database during startup
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	if err := db.Create(&user).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to create user"})
-		return
+	// Initialize the DB
+	conn, err := initDB(ctx, cfg)
+	if err != nil {
+		if ctx.Err() != nil {
+			slog.Info("interrupted while waiting for the database")
+			return
+		}
+		log.Fatal("Failed to connect to the database: ", err)
 	}
-
-	c.JSON(201, user)
-}
-
-// Update an existing user
-// @Summary Update an existing user
-// @Description Update a user's name and email by their ID
-// @Tags Users
-// @Accept json
-// @Produce json
-// @Param id path int true "User ID" // This is the ID parameter from the URL path
-// @Param user body User true "Updated user information" // The request body (updated user data)
-// @Success 200 {object} User // The updated user object returned in the response
-// @Failure 400 {object} ErrorResponse // Bad request if the input is invalid
-// @Failure 404 {object} ErrorResponse // If the user is not found
-// @Failure 500 {object} ErrorResponse // Internal server error
-// @Router /api/v1/users/{id} [put]
-func updateUser(c *gin.Context) {
-	id := c.Param("id")
-	var user User
-	if err := db.First(&user, id).Error; err != nil {
-		c.JSON(http.StatusNotFound, ErrorResponse{Message: "User not found"})
-		return
+	if opts.MigrateDown > 0 {
+		if err := storage.MigrateDown(ctx, conn, opts.MigrateDown); err != nil {
+			log.Fatal("Reverting migrations failed: ", err)
+		}
 	}
-
-	if err := c.ShouldBindJSON(&user); err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{Message: "Invalid input"})
+	// Without --migrate the schema is left alone, and /readyz reports it
+	// until someone migrates it
+	if opts.Migrate || opts.MigrateOnly {
+		if err := storage.Migrate(ctx, conn); err != nil {
+			log.Fatal("Migration failed: ", err)
+		}
+	}
+	if opts.Seed > 0 {
+		users := service.NewUserService(service.Deps{
+			Users:  storage.NewUserRepository(conn),
+			Audit:  storage.NewAuditRepository(conn),
+			Tx:     storage.NewTransactor(conn),
+			Logger: logger,
+		})
+		summary, err := users.Seed(ctx, opts.Seed)
+		if err != nil {
+			log.Fatal("Seeding failed: ", err)
+		}
+		fmt.Println("Seeded the database:", summary)
+	}
+	if opts.MigrateOnly || opts.MigrateDown > 0 || opts.Seed > 0 {
+		if err := storage.Close(conn); err != nil {
+			log.Fatal("Failed to close the database: ", err)
+		}
 		return
 	}
 
-	if err := db.Save(&user).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to update user"})
-		return
+	var responses cache.Cache
+	if cfg.CacheEnabled {
+		responses = cache.Open(ctx, cfg.RedisURL, cfg.CacheMaxEntries)
+	}
+	hooks := webhooks.NewDispatcher(conn, webhooks.Options{
+		MaxAttempts: cfg.WebhookMaxAttempts,
+		Backoff:     cfg.WebhookBackoff,
+		Timeout:     cfg.WebhookTimeout,
+		Workers:     cfg.WebhookWorkers,
+	})
+	publishers := service.Publishers{hooks}
+	var bus *events.NATSPublisher
+	var outbox *events.Outbox
+	if cfg.NATSURL != "" {
+		bus, err = events.ConnectNATS(ctx, cfg.NATSURL, cfg.NATSStream)
+		if err != nil {
+			log.Fatal(err)
+		}
+		outbox = events.NewOutbox(bus, events.OutboxOptions{})
+		publishers = append(publishers, outbox)
+	}
+	var notifier service.Notifier = service.LogNotifier{}
+	var smtp *mail.Notifier
+	if cfg.SMTPHost != "" {
+		smtp, err = mail.NewNotifier(mail.Config{
+			Host:     cfg.SMTPHost,
+			Port:     cfg.SMTPPort,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			From:     cfg.SMTPFrom,
+			TLS:      cfg.SMTPTLS,
+		}, mail.Options{})
+		if err != nil {
+			log.Fatal(err)
+		}
+		notifier = smtp
+	}
+	purger := purge.New(conn, purge.Options{
+		Interval:  cfg.PurgeInterval,
+		Retention: cfg.PurgeRetention,
+		BatchSize: cfg.PurgeBatchSize,
+	})
+	if cfg.PurgeInterval > 0 {
+		purger.Start()
+	}
+	live := handlers.NewLiveFeed(handlers.LiveOptions{})
+	r, err := handlers.NewRouter(handlers.Deps{DB: conn, Config: cfg, Logger: logger, Cache: responses, Events: publishers, Live: live, Notifier: notifier, Purger: purger})
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	c.JSON(200, user)
+	// Serve until SIGINT or SIGTERM, then let in-flight requests finish
+	ln, err := net.Listen("tcp", fmt.Sprintf(":%d", cfg.Port))
+	if err != nil {
+		log.Fatal("Failed to start the server: ", err)
+	}
+	srv := newHTTPServer(cfg, r, tlsCfg)
+	// Shutdown doesn't wait for WebSockets, so tell their clients to reconnect elsewhere
+	srv.RegisterOnShutdown(live.Close)
+	slog.Info("listening", "port", cfg.Port, "tls", tlsCfg != nil)
+	logServerLimits(srv)
+	if err := serve(ctx, srv, ln, cfg.ShutdownTimeout); err != nil {
+		log.Fatal("Server stopped: ", err)
+	}
+	// The requests are done, so no more events or emails; send the ones still queued
+	closeCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := purger.Close(closeCtx); err != nil {
+		slog.Error("purge not finished", "error", err.Error())
+	}
+	if err := hooks.Close(closeCtx); err != nil {
+		slog.Error("webhook deliveries not sent", "error", err.Error())
+	}
+	if outbox != nil {
+		if err := outbox.Close(closeCtx); err != nil {
+			slog.Error("events not published", "error", err.Error())
+		}
+		if err := bus.Close(); err != nil {
+			slog.Error("closing the NATS connection", "error", err.Error())
+		}
+	}
+	if smtp != nil {
+		if err := smtp.Close(closeCtx); err != nil {
+			slog.Error("emails not sent", "error", err.Error())
+		}
+	}
+	if err := storage.Close(conn); err != nil {
+		log.Fatal("Failed to close the database: ", err)
+	}
 }
 
-// Delete a user by ID
-// @Summary Delete a user
-// @Description Delete a user by their ID
-// @Tags Users
-// @Accept json
-// @Produce json
-// @Param id path int true "User ID" // ID of the user to delete
-// @Success 200 {string} string "User deleted" // Success message
-// @Failure 404 {object} ErrorResponse // If the user is not found
-// @Failure 500 {object} ErrorResponse // Internal server error
-// @Router /api/v1/users/{id} [delete]
-func deleteUser(c *gin.Context) {
-	id := c.Param("id")
-	var user User
-	if err := db.First(&user, id).Error; err != nil {
-		c.JSON(http.StatusNotFound, ErrorResponse{Message: "User not found"})
-		return
+// Initialize DB connection, waiting up to cfg.DBConnectTimeout for the database to come up
+func initDB(ctx context.Context, cfg handlers.Config) (*gorm.DB, error) {
+	// TranslateError maps driver-specific errors such as unique violations to gorm.ErrDuplicatedKey
+	opener := storage.Opener{
+		Driver: cfg.DBDriver,
+		DSN:    cfg.DatabaseURL,
+		Config: &gorm.Config{TranslateError: true, Logger: storage.NewGormLogger(cfg.SlowQueryThreshold)},
 	}
-
-	if err := db.Delete(&user).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to delete user"})
-		return
+	conn, err := storage.Connect(ctx, opener, cfg.DBConnectTimeout)
+	if err != nil {
+		return nil, err
 	}
-
-	c.JSON(200, gin.H{"message": "User deleted"})
+	pool := storage.PoolConfig{
+		MaxOpenConns:    cfg.DBMaxOpenConns,
+		MaxIdleConns:    cfg.DBMaxIdleConns,
+		ConnMaxLifetime: cfg.DBConnMaxLifetime,
+		ConnMaxIdleTime: cfg.DBConnMaxIdleTime,
+	}
+	if err := storage.ConfigurePool(conn, pool); err != nil {
+		return nil, err
+	}
+	if err := handlers.InstrumentQueries(conn); err != nil {
+		return nil, err
+	}
+	return conn, nil
 }
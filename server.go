@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"Unit-Test/internal/handlers"
+)
+
+// newHTTPServer builds the server answering with handler, with the timeouts
+// and header limit of cfg. http.Server leaves them all unlimited, which lets
+// a client that sends slowly, or never, hold a connection forever.
+func newHTTPServer(cfg handlers.Config, handler http.Handler, tlsCfg *tls.Config) *http.Server {
+	return &http.Server{
+		Handler:           handler,
+		TLSConfig:         tlsCfg,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		MaxHeaderBytes:    int(cfg.MaxHeaderBytes),
+	}
+}
+
+// logServerLimits reports the limits srv enforces, so the effective values
+// show up in the startup log
+func logServerLimits(srv *http.Server) {
+	slog.Info("server limits",
+		"read_header_timeout", srv.ReadHeaderTimeout.String(),
+		"read_timeout", srv.ReadTimeout.String(),
+		"write_timeout", srv.WriteTimeout.String(),
+		"idle_timeout", srv.IdleTimeout.String(),
+		"max_header_bytes", srv.MaxHeaderBytes)
+}
+
+// serve answers requests on ln with srv until ctx is done, then stops accepting
+// connections and waits up to timeout for in-flight requests to finish. With
+// srv.TLSConfig set it serves HTTPS.
+func serve(ctx context.Context, srv *http.Server, ln net.Listener, timeout time.Duration) error {
+	served := make(chan error, 1)
+	go func() {
+		if srv.TLSConfig != nil {
+			// The certificate is in TLSConfig already
+			served <- srv.ServeTLS(ln, "", "")
+			return
+		}
+		served <- srv.Serve(ln)
+	}()
+
+	select {
+	case err := <-served:
+		return err
+	case <-ctx.Done():
+	}
+
+	slog.Info("shutting down", "timeout", timeout.String())
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("requests still running after %s: %w", timeout, err)
+	}
+	if err := <-served; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
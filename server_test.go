@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"Unit-Test/internal/handlers"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// quietLogs discards what serve logs until t finishes
+func quietLogs(t *testing.T) {
+	saved := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(io.Discard, nil)))
+	t.Cleanup(func() { slog.SetDefault(saved) })
+}
+
+// startServer serves handler on a random local port until the returned cancel
+// is called; serve's result arrives on the returned channel
+func startServer(t *testing.T, handler http.Handler, timeout time.Duration) (string, context.CancelFunc, <-chan error) {
+	quietLogs(t)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- serve(ctx, &http.Server{Handler: handler}, ln, timeout)
+	}()
+	t.Cleanup(cancel)
+	return ln.Addr().String(), cancel, done
+}
+
+// slowRouter answers GET /slow after release is closed, signaling started first
+func slowRouter(started chan<- struct{}, release <-chan struct{}) *gin.Engine {
+	r := gin.New()
+	r.GET("/slow", func(c *gin.Context) {
+		close(started)
+		<-release
+		c.String(http.StatusOK, "done")
+	})
+	return r
+}
+
+func TestShutdownDrainsInFlightRequests(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	addr, cancel, done := startServer(t, slowRouter(started, release), 5*time.Second)
+
+	type result struct {
+		status int
+		body   string
+		err    error
+	}
+	responses := make(chan result, 1)
+	go func() {
+		resp, err := http.Get("http://" + addr + "/slow")
+		if err != nil {
+			responses <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		responses <- result{status: resp.StatusCode, body: string(body), err: err}
+	}()
+
+	<-started
+	cancel()
+	// Shutdown closes the listener at once, while the request is still running
+	assert.Eventually(t, func() bool {
+		conn, err := net.Dial("tcp", addr)
+		if err == nil {
+			conn.Close()
+		}
+		return err != nil
+	}, time.Second, 10*time.Millisecond)
+
+	close(release)
+	r := <-responses
+	assert.NoError(t, r.err)
+	assert.Equal(t, http.StatusOK, r.status)
+	assert.Equal(t, "done", r.body)
+	assert.NoError(t, <-done)
+}
+
+func TestShutdownGivesUpAfterTimeout(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	defer close(release)
+	addr, cancel, done := startServer(t, slowRouter(started, release), 50*time.Millisecond)
+
+	go func() {
+		resp, err := http.Get("http://" + addr + "/slow")
+		if err == nil {
+			resp.Body.Close()
+		}
+	}()
+	<-started
+	cancel()
+
+	assert.ErrorIs(t, <-done, context.DeadlineExceeded)
+}
+
+func TestServeReportsListenerFailure(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln.Close()
+
+	err = serve(context.Background(), &http.Server{Handler: gin.New()}, ln, time.Second)
+	assert.Error(t, err)
+}
+
+func TestNewHTTPServerUsesConfig(t *testing.T) {
+	cfg := handlers.Config{
+		ReadHeaderTimeout: 2 * time.Second,
+		ReadTimeout:       3 * time.Second,
+		WriteTimeout:      4 * time.Second,
+		IdleTimeout:       5 * time.Second,
+		MaxHeaderBytes:    4096,
+	}
+	handler := gin.New()
+
+	srv := newHTTPServer(cfg, handler, nil)
+	assert.Equal(t, handler, srv.Handler)
+	assert.Nil(t, srv.TLSConfig)
+	assert.Equal(t, 2*time.Second, srv.ReadHeaderTimeout)
+	assert.Equal(t, 3*time.Second, srv.ReadTimeout)
+	assert.Equal(t, 4*time.Second, srv.WriteTimeout)
+	assert.Equal(t, 5*time.Second, srv.IdleTimeout)
+	assert.Equal(t, 4096, srv.MaxHeaderBytes)
+}
+
+func TestSlowClientIsDisconnected(t *testing.T) {
+	quietLogs(t)
+	srv := newHTTPServer(handlers.Config{ReadHeaderTimeout: 100 * time.Millisecond}, gin.New(), nil)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go serve(ctx, srv, ln, time.Second)
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	// Start a request and never finish its headers
+	_, err = conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n"))
+	require.NoError(t, err)
+
+	start := time.Now()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err = io.ReadAll(conn)
+	assert.NoError(t, err, "the server closes the connection")
+	assert.Less(t, time.Since(start), 2*time.Second)
+}
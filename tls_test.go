@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"Unit-Test/internal/handlers"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeCertFiles saves cert and its key as PEM files in a directory of t's own
+func writeCertFiles(t *testing.T, cert tls.Certificate) (certFile, keyFile string) {
+	dir := t.TempDir()
+	key, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	require.NoError(t, err)
+	certFile, keyFile = filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: key}), 0o600))
+	return certFile, keyFile
+}
+
+func TestServeTLS(t *testing.T) {
+	quietLogs(t)
+	cert, err := selfSignedCert("localhost", "127.0.0.1")
+	require.NoError(t, err)
+	certFile, keyFile := writeCertFiles(t, cert)
+	tlsCfg, err := tlsConfig(handlers.Config{TLSCertFile: certFile, TLSKeyFile: keyFile}, false)
+	require.NoError(t, err)
+
+	r := gin.New()
+	r.GET("/proto", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"tls": c.Request.TLS != nil})
+	})
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- serve(ctx, &http.Server{Handler: r, TLSConfig: tlsCfg}, ln, time.Second)
+	}()
+
+	// A client trusting the certificate gets through...
+	roots := x509.NewCertPool()
+	roots.AddCert(cert.Leaf)
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+	resp, err := client.Get("https://" + ln.Addr().String() + "/proto")
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.JSONEq(t, `{"tls":true}`, string(body))
+
+	// ...one relying on the system roots does not
+	_, err = http.Get("https://" + ln.Addr().String() + "/proto")
+	assert.Error(t, err)
+
+	cancel()
+	assert.NoError(t, <-done)
+}
+
+func TestTLSConfig(t *testing.T) {
+	tlsCfg, err := tlsConfig(handlers.Config{}, false)
+	assert.NoError(t, err)
+	assert.Nil(t, tlsCfg, "plain HTTP by default")
+
+	tlsCfg, err = tlsConfig(handlers.Config{}, true)
+	require.NoError(t, err)
+	if assert.Len(t, tlsCfg.Certificates, 1) {
+		leaf := tlsCfg.Certificates[0].Leaf
+		assert.NoError(t, leaf.VerifyHostname("localhost"))
+		assert.NoError(t, leaf.VerifyHostname("127.0.0.1"))
+		assert.Error(t, leaf.VerifyHostname("example.com"))
+	}
+
+	_, err = tlsConfig(handlers.Config{TLSCertFile: "missing.crt", TLSKeyFile: "missing.key"}, false)
+	assert.ErrorContains(t, err, "loading the TLS certificate")
+}
+
+func TestDevTLSFlag(t *testing.T) {
+	_, opts, err := parseFlags([]string{"--dev-tls"}, envMap(requiredEnv()), io.Discard)
+	assert.NoError(t, err)
+	assert.True(t, opts.DevTLS)
+
+	_, _, err = parseFlags([]string{"--dev-tls", "--tls-cert", "server.crt", "--tls-key", "server.key"}, envMap(requiredEnv()), io.Discard)
+	assert.EqualError(t, err, "--dev-tls can't be combined with TLS_CERT_FILE")
+}